@@ -0,0 +1,156 @@
+package backupfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+const (
+	// extended attributes that store the POSIX ACLs on Linux
+	xattrACLAccess  = "system.posix_acl_access"
+	xattrACLDefault = "system.posix_acl_default"
+
+	aclVersion     = 2
+	aclHeaderSize  = 4
+	aclEntrySize   = 8
+	aclUndefinedID = 0xffffffff
+)
+
+var (
+	// ErrInvalidACL is returned in case that an ACL cannot be decoded.
+	ErrInvalidACL = errors.New("invalid ACL")
+)
+
+// ACLType selects the access ACL of a file or the default ACL of a directory,
+// which is inherited by files that are created in the directory.
+type ACLType int
+
+const (
+	ACLAccess ACLType = iota
+	ACLDefault
+)
+
+// ACLTag is the type of an ACL entry.
+type ACLTag uint16
+
+const (
+	ACLUserObj  ACLTag = 0x01
+	ACLUser     ACLTag = 0x02
+	ACLGroupObj ACLTag = 0x04
+	ACLGroup    ACLTag = 0x08
+	ACLMask     ACLTag = 0x10
+	ACLOther    ACLTag = 0x20
+)
+
+// ACLEntry is a single entry of a POSIX ACL.
+type ACLEntry struct {
+	Tag ACLTag
+	// ID is the uid or gid of ACLUser and ACLGroup entries, -1 for all other entries.
+	ID int
+	// Perm contains the read, write and execute bits, e.g. 0o6 for read and write.
+	Perm fs.FileMode
+}
+
+// ACL is a POSIX ACL. A nil ACL means that the file has no ACL besides its permission bits.
+type ACL []ACLEntry
+
+// ACLer is implemented by filesystems that support POSIX ACLs, like OSFS on Linux.
+// Symlinks are followed. Setting a nil ACL removes the ACL of the file.
+// Methods return an error that wraps errors.ErrUnsupported in case that the wrapped filesystem does not support them.
+type ACLer interface {
+	GetACL(name string, typ ACLType) (ACL, error)
+	SetACL(name string, typ ACLType, acl ACL) error
+}
+
+// GetACL returns the POSIX ACL of the named file, see ACLer.
+func GetACL(fsys FS, name string, typ ACLType) (ACL, error) {
+	a, ok := fsys.(ACLer)
+	if !ok {
+		return nil, &fs.PathError{Op: "getacl", Path: name, Err: errors.ErrUnsupported}
+	}
+	return a.GetACL(name, typ)
+}
+
+// SetACL sets the POSIX ACL of the named file, see ACLer.
+func SetACL(fsys FS, name string, typ ACLType, acl ACL) error {
+	a, ok := fsys.(ACLer)
+	if !ok {
+		return &fs.PathError{Op: "setacl", Path: name, Err: errors.ErrUnsupported}
+	}
+	return a.SetACL(name, typ, acl)
+}
+
+// copyACLs copies the access ACL and, in case of directories, the default ACL of name from source to target.
+// ACLs of target that do not exist in source are removed. Filesystems without ACL support are skipped.
+func copyACLs(source, target FS, name string, info fs.FileInfo) error {
+	types := []ACLType{ACLAccess}
+	if info.IsDir() {
+		types = append(types, ACLDefault)
+	}
+
+	for _, typ := range types {
+		acl, err := GetACL(source, name, typ)
+		if err == nil {
+			err = SetACL(target, name, typ, acl)
+		}
+		err = ignoreXattrError(err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func aclXattr(typ ACLType) string {
+	if typ == ACLDefault {
+		return xattrACLDefault
+	}
+	return xattrACLAccess
+}
+
+// decodeACL decodes the extended attribute format of the Linux kernel.
+func decodeACL(data []byte) (ACL, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) < aclHeaderSize || (len(data)-aclHeaderSize)%aclEntrySize != 0 {
+		return nil, fmt.Errorf("%w: unexpected size of %d bytes", ErrInvalidACL, len(data))
+	}
+	if v := binary.LittleEndian.Uint32(data); v != aclVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidACL, v)
+	}
+
+	data = data[aclHeaderSize:]
+	acl := make(ACL, 0, len(data)/aclEntrySize)
+	for len(data) > 0 {
+		e := ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(data[0:])),
+			Perm: fs.FileMode(binary.LittleEndian.Uint16(data[2:])),
+			ID:   -1,
+		}
+		if id := binary.LittleEndian.Uint32(data[4:]); id != aclUndefinedID {
+			e.ID = int(id)
+		}
+		acl = append(acl, e)
+		data = data[aclEntrySize:]
+	}
+	return acl, nil
+}
+
+// encodeACL encodes the ACL in the extended attribute format of the Linux kernel.
+func encodeACL(acl ACL) []byte {
+	data := make([]byte, aclHeaderSize, aclHeaderSize+len(acl)*aclEntrySize)
+	binary.LittleEndian.PutUint32(data, aclVersion)
+	for _, e := range acl {
+		id := uint32(aclUndefinedID)
+		if e.ID >= 0 {
+			id = uint32(e.ID)
+		}
+		data = binary.LittleEndian.AppendUint16(data, uint16(e.Tag))
+		data = binary.LittleEndian.AppendUint16(data, uint16(e.Perm&0o7))
+		data = binary.LittleEndian.AppendUint32(data, id)
+	}
+	return data
+}
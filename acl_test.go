@@ -0,0 +1,83 @@
+package backupfs
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestACL_EncodeDecode(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	acl := ACL{
+		{Tag: ACLUserObj, ID: -1, Perm: 0o6},
+		{Tag: ACLUser, ID: 1000, Perm: 0o4},
+		{Tag: ACLGroupObj, ID: -1, Perm: 0o4},
+		{Tag: ACLMask, ID: -1, Perm: 0o4},
+		{Tag: ACLOther, ID: -1, Perm: 0},
+	}
+
+	data := encodeACL(acl)
+	require.Len(data, aclHeaderSize+len(acl)*aclEntrySize)
+
+	decoded, err := decodeACL(data)
+	require.NoError(err)
+	require.Equal(acl, decoded)
+
+	decoded, err = decodeACL(nil)
+	require.NoError(err)
+	require.Nil(decoded)
+
+	_, err = decodeACL(data[:len(data)-1])
+	require.ErrorIs(err, ErrInvalidACL)
+
+	data[0] = 1
+	_, err = decodeACL(data)
+	require.ErrorIs(err, ErrInvalidACL)
+}
+
+func TestBackupFS_ACLs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		dirPath            = filepath.FromSlash("/test/dir")
+		filePath           = filepath.FromSlash("/test/dir/file.txt")
+		acl                = ACL{
+			{Tag: ACLUserObj, ID: -1, Perm: 0o6},
+			{Tag: ACLUser, ID: 1000, Perm: 0o4},
+			{Tag: ACLGroupObj, ID: -1, Perm: 0o4},
+			{Tag: ACLMask, ID: -1, Perm: 0o4},
+			{Tag: ACLOther, ID: -1, Perm: 0},
+		}
+	)
+
+	createFile(t, base, filePath, "original")
+	err := SetACL(base, filePath, ACLAccess, acl)
+	if errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+		t.Skipf("ACLs are not supported: %v", err)
+	}
+	require.NoError(err)
+	require.NoError(SetACL(base, dirPath, ACLDefault, acl))
+
+	backupFS := NewBackupFS(base, backup)
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Chmod(dirPath, 0700))
+	require.NoError(SetACL(base, filePath, ACLAccess, nil))
+	require.NoError(SetACL(base, dirPath, ACLDefault, nil))
+
+	require.NoError(backupFS.Rollback())
+
+	fileMustContainText(t, base, filePath, "original")
+	restored, err := GetACL(base, filePath, ACLAccess)
+	require.NoError(err)
+	require.Equal(acl, restored)
+	restored, err = GetACL(base, dirPath, ACLDefault)
+	require.NoError(err)
+	require.Equal(acl, restored)
+}
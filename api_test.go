@@ -0,0 +1,295 @@
+package backupfs
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateAPI = flag.Bool("update-api", false, "regenerate the public API manifest file")
+
+// apiManifestFile contains the public API of this package.
+// Every line describes a single exported declaration.
+var apiManifestFile = filepath.Join("api", "backupfs.txt")
+
+// TestAPIManifest prevents accidental breaking changes of the public API.
+// Intended API changes require the manifest file to be regenerated with:
+//
+//	go test -run TestAPIManifest -update-api
+//
+// Removed or changed declarations as well as new methods of interfaces are breaking changes
+// that require a new major version.
+func TestAPIManifest(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	current := generateAPIManifest(t)
+	if *updateAPI {
+		require.NoError(os.MkdirAll(filepath.Dir(apiManifestFile), 0755))
+		require.NoError(os.WriteFile(apiManifestFile, []byte(strings.Join(current, "\n")+"\n"), 0644))
+		return
+	}
+
+	data, err := os.ReadFile(apiManifestFile)
+	require.NoError(err, "run: go test -run TestAPIManifest -update-api")
+	previous := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	breaking, compatible := diffAPIManifest(previous, current)
+	require.Emptyf(breaking, "breaking API changes detected, these require a new major version:\n%s", strings.Join(breaking, "\n"))
+	require.Emptyf(compatible, "API additions detected, run: go test -run TestAPIManifest -update-api\n%s", strings.Join(compatible, "\n"))
+}
+
+func TestDiffAPIManifest(t *testing.T) {
+	t.Parallel()
+
+	previous := []string{
+		"func New(string) *BackupFS",
+		"method (FS) Name() string",
+		"method (*BackupFS) Rollback() error",
+		"type FS interface",
+	}
+	current := []string{
+		"func New(string, ...BackupFSOption) *BackupFS",
+		"method (FS) Name() string",
+		"method (FS) Truncate(string, int64) error",
+		"method (*BackupFS) Commit() error",
+		"method (*BackupFS) Rollback() error",
+		"type FS interface",
+	}
+
+	breaking, compatible := diffAPIManifest(previous, current)
+	require.Equal(t, []string{
+		"- func New(string) *BackupFS",
+		"+ func New(string, ...BackupFSOption) *BackupFS",
+		"+ method (FS) Truncate(string, int64) error",
+	}, breaking)
+	require.Equal(t, []string{
+		"+ method (*BackupFS) Commit() error",
+	}, compatible)
+}
+
+// diffAPIManifest classifies the differences between two manifests.
+func diffAPIManifest(previous, current []string) (breaking, compatible []string) {
+	var (
+		prev       = make(map[string]bool, len(previous))
+		curr       = make(map[string]bool, len(current))
+		interfaces = make(map[string]bool)
+	)
+	for _, line := range previous {
+		prev[line] = true
+	}
+	for _, line := range current {
+		curr[line] = true
+		if name, found := strings.CutSuffix(line, " interface"); found {
+			interfaces[strings.TrimPrefix(name, "type ")] = true
+		}
+	}
+
+	breaking = make([]string, 0)
+	compatible = make([]string, 0)
+	for _, line := range previous {
+		if !curr[line] {
+			breaking = append(breaking, "- "+line)
+		}
+	}
+	for _, line := range current {
+		if prev[line] {
+			continue
+		}
+
+		// changed declarations were already reported as removed
+		// new interface methods break all implementations
+		if isChangedAPI(line, prev) || isInterfaceMethod(line, interfaces) {
+			breaking = append(breaking, "+ "+line)
+			continue
+		}
+		compatible = append(compatible, "+ "+line)
+	}
+	return breaking, compatible
+}
+
+// isChangedAPI returns true in case that a declaration with the same name existed previously
+func isChangedAPI(line string, previous map[string]bool) bool {
+	key := apiKey(line)
+	for p := range previous {
+		if apiKey(p) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKey returns the declaration without its signature or type
+func apiKey(line string) string {
+	if i := strings.IndexAny(line, "(["); i >= 0 && !strings.HasPrefix(line, "method ") {
+		return line[:i]
+	}
+	if strings.HasPrefix(line, "method ") {
+		// method (*T) Name(...)
+		end := strings.Index(line, ") ")
+		if end < 0 {
+			return line
+		}
+		rest := line[end+2:]
+		if i := strings.Index(rest, "("); i >= 0 {
+			rest = rest[:i]
+		}
+		return line[:end+2] + rest
+	}
+	fields := strings.Fields(line)
+	if len(fields) >= 2 {
+		return fields[0] + " " + fields[1]
+	}
+	return line
+}
+
+func isInterfaceMethod(line string, interfaces map[string]bool) bool {
+	if !strings.HasPrefix(line, "method (") {
+		return false
+	}
+	end := strings.Index(line, ")")
+	return interfaces[line[len("method ("):end]]
+}
+
+func generateAPIManifest(t *testing.T) []string {
+	t.Helper()
+
+	// only files of the current build are considered
+	bpkg, err := build.Default.ImportDir(".", 0)
+	require.NoError(t, err)
+
+	var (
+		fset  = token.NewFileSet()
+		files = make([]*ast.File, 0, len(bpkg.GoFiles))
+	)
+	for _, name := range bpkg.GoFiles {
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		require.NoError(t, err)
+		files = append(files, f)
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+	}
+	pkg, err := conf.Check(bpkg.ImportPath, fset, files, nil)
+	require.NoError(t, err)
+	return apiManifest(pkg)
+}
+
+func apiManifest(pkg *types.Package) []string {
+	var (
+		lines     = make([]string, 0, 256)
+		qualifier = types.RelativeTo(pkg)
+		scope     = pkg.Scope()
+	)
+
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+
+		switch o := obj.(type) {
+		case *types.Const:
+			lines = append(lines, fmt.Sprintf("const %s %s", name, types.TypeString(o.Type(), qualifier)))
+		case *types.Var:
+			lines = append(lines, fmt.Sprintf("var %s %s", name, types.TypeString(o.Type(), qualifier)))
+		case *types.Func:
+			lines = append(lines, fmt.Sprintf("func %s%s", name, signatureString(o.Type().(*types.Signature), qualifier)))
+		case *types.TypeName:
+			lines = append(lines, typeManifest(o, qualifier)...)
+		}
+	}
+	return lines
+}
+
+func typeManifest(tn *types.TypeName, qualifier types.Qualifier) []string {
+	name := tn.Name()
+	lines := make([]string, 0, 8)
+
+	if tn.IsAlias() {
+		return append(lines, fmt.Sprintf("type %s = %s", name, types.TypeString(tn.Type(), qualifier)))
+	}
+
+	switch u := tn.Type().Underlying().(type) {
+	case *types.Interface:
+		lines = append(lines, fmt.Sprintf("type %s interface", name))
+		for i := 0; i < u.NumMethods(); i++ {
+			m := u.Method(i)
+			lines = append(lines, fmt.Sprintf("method (%s) %s%s", name, m.Name(), signatureString(m.Type().(*types.Signature), qualifier)))
+		}
+		return lines
+	case *types.Struct:
+		lines = append(lines, fmt.Sprintf("type %s struct", name))
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if !f.Exported() {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("field %s.%s %s", name, f.Name(), types.TypeString(f.Type(), qualifier)))
+		}
+	default:
+		lines = append(lines, fmt.Sprintf("type %s %s", name, types.TypeString(u, qualifier)))
+	}
+
+	// the method set of the pointer type contains all methods
+	mset := types.NewMethodSet(types.NewPointer(tn.Type()))
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+		m := sel.Obj().(*types.Func)
+		if !m.Exported() {
+			continue
+		}
+		sig := m.Type().(*types.Signature)
+		recv := name
+		if _, isPtr := sig.Recv().Type().(*types.Pointer); isPtr {
+			recv = "*" + name
+		}
+		lines = append(lines, fmt.Sprintf("method (%s) %s%s", recv, m.Name(), signatureString(sig, qualifier)))
+	}
+	return lines
+}
+
+// signatureString returns the signature without parameter names,
+// as renaming parameters is not a breaking change.
+func signatureString(sig *types.Signature, qualifier types.Qualifier) string {
+	tupleString := func(t *types.Tuple, variadic bool) []string {
+		result := make([]string, 0, t.Len())
+		for i := 0; i < t.Len(); i++ {
+			typ := t.At(i).Type()
+			if variadic && i == t.Len()-1 {
+				result = append(result, "..."+types.TypeString(typ.(*types.Slice).Elem(), qualifier))
+				continue
+			}
+			result = append(result, types.TypeString(typ, qualifier))
+		}
+		return result
+	}
+
+	var sb strings.Builder
+	sb.WriteString("(")
+	sb.WriteString(strings.Join(tupleString(sig.Params(), sig.Variadic()), ", "))
+	sb.WriteString(")")
+
+	results := tupleString(sig.Results(), false)
+	switch len(results) {
+	case 0:
+	case 1:
+		sb.WriteString(" " + results[0])
+	default:
+		sb.WriteString(" (" + strings.Join(results, ", ") + ")")
+	}
+	return sb.String()
+}
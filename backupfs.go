@@ -1,15 +1,17 @@
 package backupfs
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -20,6 +22,15 @@ var (
 	// ErrRollbackFailed is returned when the rollback fails due to e.g. network problems.
 	// when this error is returned it might make sense to retry the rollback
 	ErrRollbackFailed = errors.New("rollback failed")
+
+	// ErrReservedPath is returned when a path in the base filesystem is modified that collides with
+	// the internal files in the backup filesystem, see internalDir.
+	ErrReservedPath = fmt.Errorf("path is reserved for the internal files of the backup: %w", fs.ErrPermission)
+
+	// internalDir contains the saved state, the journal, the trash and the backups of later generations.
+	// Backups of the mirror layout are stored with their original path next to it, which is why
+	// the same path in the base filesystem cannot be backed up.
+	internalDir = filepath.Join(separator, ".backupfs")
 )
 
 // Options in order to manipulate the behavior of the BackupFS
@@ -29,6 +40,8 @@ type BackupFSOption func(*backupFSOptions)
 // existing file in the OS filesystem is about to be overwritten or removed.
 // The backup location is hidden from the user's access in order to prevent infinite backup recursions.
 // The returned BackupFS is OS-independent and can also be used with Windows paths.
+// The package level default options (see SetDefaultOptions) and the environment
+// variables EnvDisableChown and EnvBufferSize are applied before the passed options.
 func New(backupLocation string, opts ...BackupFSOption) *BackupFS {
 	return NewWithFS(NewOSFS(), backupLocation, opts...)
 }
@@ -37,28 +50,46 @@ func New(backupLocation string, opts ...BackupFSOption) *BackupFS {
 // existing file in fs is about to be overwritten or removed.
 // The backup location is hidden from the user's access i norder to prevent infinite backup recursions.
 // The returned BackupFS is OS-independent and can also be used with Windows paths.
+// The package level default options (see SetDefaultOptions) and the environment
+// variables EnvDisableChown and EnvBufferSize are applied before the passed options.
 func NewWithFS(baseFS FS, backupLocation string, opts ...BackupFSOption) *BackupFS {
-	fsys := NewBackupFS(
-		NewHiddenFS(baseFS, backupLocation),
-		NewPrefixFS(baseFS, backupLocation),
-		// put our default option first in order for it to be overwritable later
-		append([]BackupFSOption{ /* default options that can be overwritten afterwards */ }, opts...)...,
+	// put our default option first in order for it to be overwritable later
+	opts = append(defaultBackupFSOptions(), opts...)
+
+	var o backupFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		hidden = NewHiddenFS(baseFS, backupLocation)
+		prefix = NewPrefixFS(baseFS, backupLocation)
 	)
-	return fsys
+	keys := pathKeys{caseInsensitive: o.caseInsensitive, form: o.unicodeForm}
+	hidden.setPathKeys(keys)
+	prefix.keys = keys
+	return NewBackupFS(hidden, prefix, opts...)
 }
 
 // NewBackupFS creates a new layered backup file system that backups files from fs to backup in case that an
 // existing file in fs is about to be overwritten or removed.
 func NewBackupFS(base, backup FS, opts ...BackupFSOption) *BackupFS {
-	opt := &backupFSOptions{}
+	opt := &backupFSOptions{
+		clock: SystemClock(),
+	}
 
 	for _, o := range opts {
 		o(opt)
 	}
 
+	rootBackup := backup
+	backup = layoutFS(opt.backupLayout, backup)
+
 	bfsys := &BackupFS{
-		base:   base,
-		backup: backup,
+		base:       base,
+		backup:     backup,
+		rootBackup: rootBackup,
+		opts:       opt,
 
 		// this map is needed in order to keep track of non existing files
 		// consecutive changes might lead to files being backed up
@@ -66,7 +97,13 @@ func NewBackupFS(base, backup FS, opts ...BackupFSOption) *BackupFS {
 		// but could have been written by us in the mean time.
 		// without this structure we would never know whether there was actually
 		// no previous file to be backed up.
-		baseInfos: make(map[string]fs.FileInfo),
+		baseInfos: newTrackedInfos(rootBackup, opt.stateIndex),
+
+		noSymlinks: !SupportsSymlinks(base),
+	}
+
+	if opt.handleTracking {
+		bfsys.handles = newHandleRegistry(opt.handleTrackingDebug, opt.clock)
 	}
 	return bfsys
 }
@@ -85,9 +122,67 @@ type BackupFS struct {
 	// fs.FileInfo may be nil in case that the file never existed on the base
 	// file system.
 	// it is not nil in case that the file existed on the base file system
-	baseInfos map[string]fs.FileInfo
-
-	mu sync.Mutex
+	baseInfos *trackedInfos
+
+	opts *backupFSOptions
+
+	// nil in case that handle tracking is disabled
+	handles *handleRegistry
+
+	// number of compacted subtree entries in baseInfos
+	subtrees int
+	// estimated number of inodes of the backups of the current generation, see WithInodeQuota
+	inodes int
+	// estimated number of bytes of the backups of the current generation, see WithBackupQuota
+	backupBytes int64
+
+	// report of the most recent rollback
+	lastRollback *RollbackReport
+	// armed by BeginWithDeadline, nil in case that no watchdog is armed
+	watchdog *watchdog
+	// progress stream of the running rollback, nil in case that it is disabled
+	progress *progressWriter
+	// paths of the phase that is reported to the function of WithProgressFunc
+	progressCount progressCounter
+
+	// backup filesystem without any storage layout or generation
+	rootBackup FS
+	// frozen generations, oldest first, see Snapshot.
+	generations []generation
+
+	// checksums of the backed up files, nil in case that checksums are disabled
+	checksums map[string][]byte
+
+	// sequence number of the last journal record
+	journalSeq uint64
+
+	// recorded write operations in dry run mode
+	plannedOps []PlannedOp
+	// paths that would have been backed up in dry run mode
+	plannedPaths map[string]struct{}
+
+	// largest number of tracked paths since baseInfos has been allocated.
+	// maps do not shrink when entries are deleted.
+	peakTracked int
+
+	// paths that have been read, see WithReadTracking.
+	// guarded by readsMu, as read operations do not lock mu.
+	reads   map[string]struct{}
+	readsMu sync.Mutex
+
+	// true in case that the base filesystem has been wrapped with AdaptNoSymlinkFS.
+	// paths are not resolved segment by segment in that case.
+	noSymlinks bool
+
+	// mu is held exclusively by operations that modify the whole tree or replace the internal state
+	// and shared by all other operations, see lock, rlock and lockPath.
+	mu sync.RWMutex
+	// stateMu guards the internal state while mu is only held shared.
+	stateMu sync.RWMutex
+	// locks of the paths that are modified while mu is held shared, see lockPath.
+	paths pathLocks
+	// spellings of the tracked paths, see WithCaseInsensitivePaths and WithUnicodeNormalization.
+	spellings spellingIndex
 }
 
 // BaseFS returns the fs layer that is being written to
@@ -105,22 +200,54 @@ func (fsys *BackupFS) Name() string {
 	return "BackupFS"
 }
 
+// Unwrap returns the base filesystem that is being written to.
+func (fsys *BackupFS) Unwrap() FS {
+	return fsys.base
+}
+
+// OpenHandles returns all file handles that were returned by the BackupFS and
+// that have not yet been closed.
+// Returns nil in case that the BackupFS was not created with WithHandleTracking.
+func (fsys *BackupFS) OpenHandles() []HandleInfo {
+	if fsys.handles == nil {
+		return nil
+	}
+	return fsys.handles.openHandles()
+}
+
+func (fsys *BackupFS) trackHandle(f File, name string, flag int) File {
+	if fsys.handles == nil {
+		return f
+	}
+	return fsys.handles.track(f, name, flag)
+}
+
+// Map returns the file infos of all tracked paths of the current generation.
+// In case that the index file of WithStateIndex cannot be read, the file infos
+// do not contain their modification times and owners, see MarshalJSON.
 func (fsys *BackupFS) Map() (metadata map[string]fs.FileInfo) {
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
+	defer fsys.rlockState()()
 
-	m := make(map[string]fs.FileInfo, len(fsys.baseInfos))
-	for path, info := range fsys.baseInfos {
+	m := make(map[string]fs.FileInfo, fsys.baseInfos.len())
+	fsys.baseInfos.each(func(path string, info fs.FileInfo) bool {
 		if info == nil {
 			m[path] = nil // nil w/o type information is needed here
-			continue
+			return true
 		}
 
+		// the index file is removed upon rollback and commit
+		loaded, err := loadFileInfo(info)
+		if err == nil {
+			info = loaded
+		}
 		m[path] = info
-	}
+		return true
+	})
 	return m
 }
 
+// SetMap replaces the tracked file infos of the current generation.
+// The file infos are kept in memory regardless of WithStateIndex, see UnmarshalJSON.
 func (fsys *BackupFS) SetMap(metadata map[string]fs.FileInfo) {
 	fsys.mu.Lock()
 	defer fsys.mu.Unlock()
@@ -135,31 +262,22 @@ func (fsys *BackupFS) SetMap(metadata map[string]fs.FileInfo) {
 		m[path] = info
 	}
 
-	fsys.baseInfos = m
+	// cannot fail, as nothing is written to an index file
+	_ = fsys.setInfos(newTrackedInfos(nil, StateIndexMemory), m)
 }
 
+// MarshalJSON returns the versioned JSON representation of the internal state of the current generation,
+// see UnmarshalJSON.
 func (fsys *BackupFS) MarshalJSON() ([]byte, error) {
-	m := fsys.Map()
-
-	fiMap := make(map[string]*fInfo, len(m))
-
-	for path, fi := range m {
-		if fi == nil {
-			fiMap[path] = nil
-			continue
-		}
+	defer fsys.rlockState()()
 
-		fiMap[path] = toFInfo(path, fi)
-	}
-
-	return json.Marshal(fiMap)
+	return fsys.marshalState()
 }
 
+// UnmarshalJSON replaces the internal state with the state that was serialized with MarshalJSON.
+// States of older versions are migrated.
 func (fsys *BackupFS) UnmarshalJSON(data []byte) error {
-
-	fiMap := make(map[string]*fInfo)
-
-	err := json.Unmarshal(data, &fiMap)
+	m, checksums, err := unmarshalState(data)
 	if err != nil {
 		return err
 	}
@@ -167,35 +285,72 @@ func (fsys *BackupFS) UnmarshalJSON(data []byte) error {
 	fsys.mu.Lock()
 	defer fsys.mu.Unlock()
 
-	fsys.baseInfos = make(map[string]fs.FileInfo, len(fiMap))
-	for k, v := range fiMap {
-		if v == nil {
-			// required, otherwise the value cannot be checked whethe rit's nil or not
-			// due to the additional type information of k, which is of type *fInfo
-			fsys.baseInfos[k] = nil
-			continue
+	err = fsys.setInfos(fsys.newTrackedInfos(), m)
+	if err != nil {
+		return err
+	}
+	fsys.checksums = checksums
+	return nil
+}
+
+// setInfos replaces the tracked file infos with the file infos of m, which are added to infos,
+// and recalculates the derived counters.
+// The internal state is not modified in case that the file infos cannot be added.
+func (fsys *BackupFS) setInfos(infos *trackedInfos, m map[string]fs.FileInfo) error {
+	for path, info := range m {
+		err := infos.set(path, info)
+		if err != nil {
+			return errors.Join(err, infos.reset())
 		}
-		fsys.baseInfos[k] = v
+	}
+	for path := range m {
+		fsys.trackSpelling(path)
 	}
 
+	// best effort, a left over index file is removed by removeStaleIndexFiles
+	_ = fsys.baseInfos.reset()
+	fsys.baseInfos = infos
+	fsys.subtrees = countSubtrees(fsys.baseInfos)
+	fsys.inodes = countInodes(fsys.baseInfos)
+	fsys.backupBytes = countBackupBytes(fsys.baseInfos)
+	fsys.peakTracked = fsys.baseInfos.len()
 	return nil
 }
 
 func (fsys *BackupFS) ForceBackup(name string) (err error) {
+	return fsys.ForceBackupContext(context.Background(), name)
+}
+
+// ForceBackupContext is like ForceBackup but is aborted in case that the context is canceled
+// before the backup is created.
+func (fsys *BackupFS) ForceBackupContext(ctx context.Context, name string) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "force_backup", Err: err, Path: name}
+			err = newBackupError(OpForceBackup, name, err)
 		}
 	}()
 
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
+	defer fsys.lock(OpForceBackup)()
+
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
 
 	resolvedName, err := fsys.realPath(name)
 	if err != nil {
 		return err
 	}
 
+	if fsys.opts.dryRun {
+		return fsys.plan(OpForceBackup, resolvedName)
+	}
+
+	err = fsys.journalOp(OpForceBackup, resolvedName)
+	if err != nil {
+		return err
+	}
+
 	err = fsys.tryRemoveBackup(resolvedName)
 	if err != nil {
 		return err
@@ -213,13 +368,22 @@ func (fsys *BackupFS) ForceBackup(name string) (err error) {
 func (fsys *BackupFS) Create(name string) (_ File, err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "create", Path: name, Err: err}
+			err = newBackupError(OpCreate, name, err)
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
 
-	resolvedName, err := fsys.realPath(name)
+	// the symlink target is written, not the symlink
+	resolvedName, unlock, err := fsys.lockPath(OpCreate, name, fsys.realTargetPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.planFile(OpCreate, resolvedName)
+	}
+
+	err = fsys.journalOp(OpCreate, resolvedName)
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +398,7 @@ func (fsys *BackupFS) Create(name string) (_ File, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return file, nil
+	return fsys.trackHandle(file, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC), nil
 }
 
 // Mkdir creates a directory in the filesystem, return an error if any
@@ -242,13 +406,21 @@ func (fsys *BackupFS) Create(name string) (_ File, err error) {
 func (fsys *BackupFS) Mkdir(name string, perm fs.FileMode) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "mkdir", Path: name, Err: err}
+			err = newBackupError(OpMkdir, name, err)
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
 
-	resolvedName, err := fsys.realPath(name)
+	resolvedName, unlock, err := fsys.lockPath(OpMkdir, name, fsys.realPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpMkdir, resolvedName)
+	}
+
+	err = fsys.journalOp(OpMkdir, resolvedName)
 	if err != nil {
 		return err
 	}
@@ -270,14 +442,22 @@ func (fsys *BackupFS) Mkdir(name string, perm fs.FileMode) (err error) {
 func (fsys *BackupFS) MkdirAll(name string, perm fs.FileMode) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "mkdir_all", Path: name, Err: err}
+			err = newBackupError(OpMkdirAll, name, err)
 		}
 	}()
 
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
+	// missing parent directories are locked shared, which allows to create sibling directories concurrently
+	resolvedName, unlock, err := fsys.lockPath(OpMkdirAll, name, fsys.realPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	resolvedName, err := fsys.realPath(name)
+	if fsys.opts.dryRun {
+		return fsys.plan(OpMkdirAll, resolvedName)
+	}
+
+	err = fsys.journalOp(OpMkdirAll, resolvedName)
 	if err != nil {
 		return err
 	}
@@ -298,26 +478,41 @@ func (fsys *BackupFS) MkdirAll(name string, perm fs.FileMode) (err error) {
 func (fsys *BackupFS) OpenFile(name string, flag int, perm fs.FileMode) (_ File, err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "open", Path: name, Err: err}
+			err = newBackupError(OpOpen, name, err)
 		}
 	}()
 
 	// read only operations do not require backups nor path resolution
 	if flag == os.O_RDONLY {
+		fsys.trackRead(name)
+		if fsys.opts.isolation == IsolationSnapshot {
+			f, err := fsys.snapshotOpen(name)
+			if err != nil {
+				return nil, err
+			}
+			return fsys.trackHandle(f, name, flag), nil
+		}
 		// in read only mode the perm is not used.
 		f, err := fsys.base.OpenFile(name, os.O_RDONLY, 0)
 		if err != nil {
 			return nil, err
 		}
-		return f, nil
+		return fsys.trackHandle(f, name, flag), nil
 	}
 
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
-
 	// write operations require path resolution due to
-	// potentially required backups
-	resolvedName, err := fsys.realPath(name)
+	// potentially required backups, the symlink target is written, not the symlink
+	resolvedName, unlock, err := fsys.lockPath(OpOpenFile, name, fsys.realTargetPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.planFile(OpOpenFile, resolvedName)
+	}
+
+	err = fsys.journalOp(OpOpenFile, resolvedName)
 	if err != nil {
 		return nil, err
 	}
@@ -332,33 +527,65 @@ func (fsys *BackupFS) OpenFile(name string, flag int, perm fs.FileMode) (_ File,
 	if err != nil {
 		return nil, err
 	}
-	return file, nil
+	return fsys.trackHandle(file, name, flag), nil
 }
 
 // Remove removes a file identified by name, returning an error, if any
 // happens.
 func (fsys *BackupFS) Remove(name string) (err error) {
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
-	return fsys.remove(name)
+	resolvedName, unlock, err := fsys.lockPath(OpRemove, name, fsys.realPath)
+	if err != nil {
+		return newBackupError(OpRemove, name, err)
+	}
+	defer unlock()
+
+	return fsys.removeResolved(name, resolvedName, true)
+}
+
+// remove removes the file and copies it into the trash in case that trash is true, see WithTrash.
+func (fsys *BackupFS) remove(name string, trash bool) (err error) {
+	resolvedName, err := fsys.realPath(name)
+	if err != nil {
+		return newBackupError(OpRemove, name, err)
+	}
+	return fsys.removeResolved(name, resolvedName, trash)
 }
 
-func (fsys *BackupFS) remove(name string) (err error) {
+func (fsys *BackupFS) removeResolved(name, resolvedName string, trash bool) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "remove", Path: name, Err: err}
+			err = newBackupError(OpRemove, name, err)
 		}
 	}()
 
-	resolvedName, err := fsys.realPath(name)
+	if fsys.opts.dryRun {
+		return fsys.plan(OpRemove, resolvedName)
+	}
+
+	err = fsys.journalOp(OpRemove, resolvedName)
 	if err != nil {
 		return err
 	}
 
-	err = fsys.tryBackup(resolvedName)
+	err = fsys.tryBackupUnlinked(resolvedName)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			// the file is still in place
+			if uerr := fsys.unlinkBackupFile(resolvedName); uerr != nil {
+				err = errors.Join(err, uerr)
+			}
+		}
+	}()
+
+	if trash && fsys.opts.trashRetention > 0 {
+		err = fsys.moveToTrash(resolvedName)
+		if err != nil {
+			return err
+		}
+	}
 
 	err = fsys.base.Remove(resolvedName)
 	if err != nil {
@@ -371,36 +598,71 @@ func (fsys *BackupFS) remove(name string) (err error) {
 // does not fail if the path does not exist (return nil).
 // not supported
 func (fsys *BackupFS) RemoveAll(name string) (err error) {
+	return fsys.RemoveAllContext(context.Background(), name)
+}
+
+// RemoveAllContext is like RemoveAll but stops removing files in case that the context is canceled.
+// All files that were removed up to that point stay removed and are restored by a Rollback.
+func (fsys *BackupFS) RemoveAllContext(ctx context.Context, name string) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "remove_all", Path: name, Err: err}
+			err = newBackupError(OpRemoveAll, name, err)
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
+	defer fsys.lock(OpRemoveAll)()
+
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
 
 	resolvedName, err := fsys.realPath(name)
 	if err != nil {
 		return err
 	}
 
+	if fsys.opts.dryRun {
+		return fsys.plan(OpRemoveAll, resolvedName)
+	}
+
+	err = fsys.journalOp(OpRemoveAll, resolvedName)
+	if err != nil {
+		return err
+	}
+
 	// does not exist or no access, nothing to do
-	fi, err := fsys.Lstat(resolvedName)
+	fi, err := fsys.base.Lstat(resolvedName)
 	if err != nil {
 		return err
 	}
 
+	if fsys.opts.trashRetention > 0 {
+		// the whole tree is moved into a single trash directory
+		err = fsys.moveToTrash(resolvedName)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !fi.IsDir() {
 		// if it's a file or a symlink, directly remove it
-		err = fsys.remove(resolvedName)
+		err = fsys.remove(resolvedName, false)
 		if err != nil {
 			return err
 		}
 		return nil
 	}
 
-	resolvedDirPaths := make([]string, 0, 1)
-	err = Walk(fsys.base, resolvedName, func(resolvedSubPath string, info fs.FileInfo, err error) error {
+	compaction := fsys.opts.subtreeCompaction || fsys.opts.subtreeSnapshotter != nil
+	if compaction && fsys.compactable(resolvedName) {
+		return fsys.removeAllCompacted(resolvedName, fi)
+	}
+
+	var (
+		resolvedDirPaths  = make([]string, 0, 1)
+		resolvedFilePaths = make([]string, 0, 1)
+	)
+	err = WalkContext(ctx, fsys.base, resolvedName, func(resolvedSubPath string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -413,19 +675,57 @@ func (fsys *BackupFS) RemoveAll(name string) (err error) {
 			return nil
 		}
 
-		return fsys.remove(resolvedSubPath)
+		resolvedFilePaths = append(resolvedFilePaths, resolvedSubPath)
+		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	fsys.notifyProgress(Progress{
+		Phase: PhaseBackup,
+		Event: ProgressStarted,
+		Total: len(resolvedFilePaths) + len(resolvedDirPaths),
+	})
+	defer func() {
+		fsys.notifyProgress(Progress{
+			Phase: PhaseBackup,
+			Event: ProgressFinished,
+			Err:   err,
+		})
+	}()
+
+	if fsys.opts.backupWorkers > 1 {
+		fsys.backupFilesParallel(ctx, resolvedFilePaths)
+	}
+
+	for i, filePath := range resolvedFilePaths {
+		err = ctx.Err()
+		if err == nil {
+			err = fsys.remove(filePath, false)
+			fsys.reportRemoved(filePath, err)
+		}
+		if err != nil {
+			// files that were linked into the backup in parallel are still in place
+			if uerr := fsys.unlinkBackupFiles(resolvedFilePaths[i+1:]); uerr != nil {
+				return errors.Join(err, uerr)
+			}
+			return err
+		}
+	}
+
 	// after deleting all of the files
 	//now we want to sort all of the file paths from the most
 	//nested file to the least nested file (count file path separators)
 	sort.Sort(ByMostFilePathSeparators(resolvedDirPaths))
 
 	for _, emptyDir := range resolvedDirPaths {
-		err = fsys.remove(emptyDir)
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+		err = fsys.remove(emptyDir, false)
+		fsys.reportRemoved(emptyDir, err)
 		if err != nil {
 			return err
 		}
@@ -438,59 +738,138 @@ func (fsys *BackupFS) RemoveAll(name string) (err error) {
 func (fsys *BackupFS) Rename(oldname, newname string) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+			err = &os.LinkError{Op: string(OpRename), Old: oldname, New: newname, Err: err}
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
+	defer fsys.lock(OpRename)()
 
 	resolvedOldname, err := fsys.realPath(oldname)
 	if err != nil {
 		return err
 	}
 
-	resolvedNewname, newNameFound, err := fsys.realPathWithFound(newname)
+	resolvedNewname, err := fsys.realPath(newname)
 	if err != nil {
 		return err
 	}
 
-	if !newNameFound {
-		// only make file known in case that it does not exist, otherwise
-		// overwriting would return an error anyway.
-		err = fsys.tryBackup(resolvedNewname)
-		if err != nil {
-			return err
-		}
+	if fsys.opts.dryRun {
+		return fsys.plan(OpRename, resolvedOldname, resolvedNewname)
+	}
+
+	err = fsys.journalOp(OpRename, resolvedOldname, resolvedNewname)
+	if err != nil {
+		return err
+	}
 
-		// there either was no previous file to be backed up
-		// but now we know that there was no file or there
-		// was a target file that has to be backed up which was then backed up
-		err = fsys.tryBackup(resolvedOldname)
+	// an existing file or empty directory at newname is replaced by the rename,
+	// which is why it is backed up as well.
+	err = fsys.tryBackupUnlinked(resolvedNewname)
+	if err != nil {
+		return err
+	}
+	defer func() {
 		if err != nil {
-			return err
+			// the file has not been replaced
+			if uerr := fsys.unlinkBackupFile(resolvedNewname); uerr != nil {
+				err = errors.Join(err, uerr)
+			}
 		}
+	}()
+
+	err = fsys.tryBackup(resolvedOldname)
+	if err != nil {
+		return err
+	}
+
+	movedPaths, err := fsys.backupMovedTree(resolvedOldname)
+	if err != nil {
+		return err
 	}
-	// in the else case Renaming to a file that already exists
-	// the Rename call will return an error anyway, so we do not backup anything in that case.
 
 	err = fsys.base.Rename(resolvedOldname, resolvedNewname)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// the moved paths did not exist at their new location before
+	for _, movedPath := range movedPaths {
+		err = errors.Join(err, fsys.setInfoIfNotAlreadySeen(resolvedNewname+strings.TrimPrefix(movedPath, resolvedOldname), nil))
+	}
+	return err
+}
+
+// createdPathExists returns true in case that a path that did not exist in the base filesystem prior
+// to its modification still exists at its location. In case that one of its parent directories has been replaced
+// with a symlink in the meantime, the path points to a file that was not created via the BackupFS and must be kept.
+func (fsys *BackupFS) createdPathExists(path string) (bool, error) {
+	resolve := fsys.opts.pathResolver
+	if resolve == nil {
+		resolve = ResolvePath
+	}
+
+	resolvedName, fi, err := resolve(fsys.base, path)
+	if isNotFoundError(err) || errors.Is(err, syscall.ELOOP) {
+		// parent directory does not exist anymore or is a symlink loop
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return fi != nil && resolvedName == path, nil
+}
+
+// backupMovedTree backs up the content of a directory that is renamed, as the whole directory tree is moved.
+// Returns the paths of the content, nothing in case that resolvedName is not a directory.
+func (fsys *BackupFS) backupMovedTree(resolvedName string) (movedPaths []string, err error) {
+	fi, err := fsys.base.Lstat(resolvedName)
+	if err != nil || !fi.IsDir() {
+		// errors are returned by the rename
+		return nil, nil
+	}
+
+	err = Walk(fsys.base, resolvedName, func(path string, _ fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == resolvedName {
+			// already backed up
+			return nil
+		}
+
+		err = fsys.tryBackup(path)
+		if err != nil {
+			return err
+		}
+		movedPaths = append(movedPaths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return movedPaths, nil
 }
 
 // Chmod changes the mode of the named file to mode.
 func (fsys *BackupFS) Chmod(name string, mode fs.FileMode) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "chmod", Path: name, Err: err}
+			err = newBackupError(OpChmod, name, err)
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
 
-	resolvedName, err := fsys.realPath(name)
+	// the symlink target is modified, not the symlink
+	resolvedName, unlock, err := fsys.lockPath(OpChmod, name, fsys.realTargetPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpChmod, resolvedName)
+	}
+
+	err = fsys.journalOp(OpChmod, resolvedName)
 	if err != nil {
 		return err
 	}
@@ -511,13 +890,22 @@ func (fsys *BackupFS) Chmod(name string, mode fs.FileMode) (err error) {
 func (fsys *BackupFS) Chown(name string, uid, gid int) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "chown", Path: name, Err: err}
+			err = newBackupError(OpChown, name, err)
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
 
-	resolvedName, err := fsys.realPath(name)
+	// the symlink target is modified, not the symlink
+	resolvedName, unlock, err := fsys.lockPath(OpChown, name, fsys.realTargetPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpChown, resolvedName)
+	}
+
+	err = fsys.journalOp(OpChown, resolvedName)
 	if err != nil {
 		return err
 	}
@@ -538,13 +926,22 @@ func (fsys *BackupFS) Chown(name string, uid, gid int) (err error) {
 func (fsys *BackupFS) Chtimes(name string, atime, mtime time.Time) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "chown", Path: name, Err: err}
+			err = newBackupError(OpChtimes, name, err)
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
 
-	resolvedName, err := fsys.realPath(name)
+	// the symlink target is modified, not the symlink
+	resolvedName, unlock, err := fsys.lockPath(OpChtimes, name, fsys.realTargetPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpChtimes, resolvedName)
+	}
+
+	err = fsys.journalOp(OpChtimes, resolvedName)
 	if err != nil {
 		return err
 	}
@@ -561,18 +958,68 @@ func (fsys *BackupFS) Chtimes(name string, atime, mtime time.Time) (err error) {
 	return nil
 }
 
+// Truncate changes the size of the named file.
+// The file content is backed up before it is truncated.
+func (fsys *BackupFS) Truncate(name string, size int64) (err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpTruncate, name, err)
+		}
+	}()
+
+	// the content of the symlink target is modified, not the symlink
+	resolvedName, unlock, err := fsys.lockPath(OpTruncate, name, fsys.realTargetPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpTruncate, resolvedName)
+	}
+
+	err = fsys.journalOp(OpTruncate, resolvedName)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.tryBackup(resolvedName)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.base.Truncate(resolvedName, size)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // Symlink changes the access and modification times of the named file
 func (fsys *BackupFS) Symlink(oldname, newname string) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+			err = &os.LinkError{Op: string(OpSymlink), Old: oldname, New: newname, Err: err}
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
+
+	if fsys.noSymlinks {
+		// nothing to back up for a symlink that cannot be created
+		return errors.ErrUnsupported
+	}
 
 	// cannot resolve oldname because it is not touched and it may also contain relative paths
-	resolvedNewname, err := fsys.realPath(newname)
+	resolvedNewname, unlock, err := fsys.lockPath(OpSymlink, newname, fsys.realPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpSymlink, resolvedNewname)
+	}
+
+	err = fsys.journalOp(OpSymlink, resolvedNewname)
 	if err != nil {
 		return err
 	}
@@ -598,13 +1045,21 @@ func (fsys *BackupFS) Symlink(oldname, newname string) (err error) {
 func (fsys *BackupFS) Lchown(name string, uid, gid int) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "lchown", Path: name, Err: err}
+			err = newBackupError(OpLchown, name, err)
 		}
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
 
-	resolvedName, err := fsys.realPath(name)
+	resolvedName, unlock, err := fsys.lockPath(OpLchown, name, fsys.realPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpLchown, resolvedName)
+	}
+
+	err = fsys.journalOp(OpLchown, resolvedName)
 	if err != nil {
 		return err
 	}
@@ -626,15 +1081,79 @@ func (fsys *BackupFS) Lchown(name string, uid, gid int) (err error) {
 // modification on the backup site are skipped
 // This is a heavy weight operation which blocks the file system
 // until the rollback is done.
+// All generations are rolled back, see Snapshot and RollbackTo.
 func (fsys *BackupFS) Rollback() (multiErr error) {
+	return fsys.RollbackContext(context.Background())
+}
+
+// RollbackContext is like Rollback but stops restoring files in case that the context is canceled.
+// A canceled rollback returns an error with the code CodeCanceled and keeps the internal state,
+// so that it can be retried later on. Once all files are restored, the deletion of the backup
+// is not canceled anymore.
+func (fsys *BackupFS) RollbackContext(ctx context.Context) (multiErr error) {
+	defer fsys.lock(OpRollback)()
+
+	fsys.disarmWatchdog()
+	return fsys.rollback(ctx)
+}
+
+// rollback rolls back all generations.
+func (fsys *BackupFS) rollback(ctx context.Context) error {
+	err := fsys.rollbackGenerations(ctx, 0)
+	if ctx.Err() != nil {
+		return err
+	}
+	fsys.resetReads()
+	fsys.spellings.reset()
+	return errors.Join(err, fsys.removeJournal(), fsys.removeState())
+}
+
+// rollbackGenerations rolls back all generations newer than the keep oldest ones, see Snapshot.
+func (fsys *BackupFS) rollbackGenerations(ctx context.Context, keep int) (multiErr error) {
+	report := RollbackReport{StartedAt: fsys.opts.clock.Now()}
 	defer func() {
+		report.FinishedAt = fsys.opts.clock.Now()
 		if multiErr != nil {
-			multiErr = errors.Join(ErrRollbackFailed, multiErr)
+			rerr := newRollbackError(multiErr)
+			report.Error = rerr.Error()
+			report.Errors = rerr.Errors
+			multiErr = rerr
+			if m := fsys.opts.metrics; m != nil {
+				for _, perr := range rerr.Errors {
+					m.ObserveRollbackError(perr.Code)
+				}
+			}
 		}
+		fsys.lastRollback = &report
+		fsys.finishProgress(&report, multiErr)
 	}()
-	fsys.mu.Lock()
-	defer fsys.mu.Unlock()
+	fsys.startProgress()
+
+	// tampered backups must not be restored
+	err := fsys.verifySeals(keep)
+	if err != nil {
+		return newRollbackPathError(CodeSealBroken, "", err)
+	}
+
+	// newest generation first
+	for {
+		err := fsys.rollbackGeneration(ctx, &report)
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+		if ctx.Err() != nil || len(fsys.generations) <= keep {
+			return multiErr
+		}
+
+		err = fsys.popGeneration()
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+}
 
+// rollbackGeneration rolls back the modifications of the current generation.
+func (fsys *BackupFS) rollbackGeneration(ctx context.Context, report *RollbackReport) (multiErr error) {
 	var (
 		// these file sneed to be removed in a certain order, so we keep track of them
 		// from most nested to least nested files
@@ -645,21 +1164,31 @@ func (fsys *BackupFS) Rollback() (multiErr error) {
 		// from least nested to most nested
 		restoreDirPaths     = make([]string, 0, 4)
 		restoreFilePaths    = make([]string, 0, 4)
+		restorePlaceholders = make([]string, 0)
 		restoreSymlinkPaths = make([]string, 0, 4)
+		restoreSubtreePaths = make([]string, 0)
 
 		err    error
 		exists bool
 	)
+	defer func() {
+		report.Removed += len(removeBasePaths)
+		report.Restored += len(restoreDirPaths) + len(restoreFilePaths) + len(restoreSymlinkPaths) + len(restoreSubtreePaths) + len(restorePlaceholders)
+	}()
 
-	for path, info := range fsys.baseInfos {
+	for _, path := range fsys.baseInfos.paths() {
+		if ctx.Err() != nil {
+			break
+		}
+		info, _ := fsys.baseInfos.get(path)
 		if info == nil {
 			// file did not exist in the base filesystem at the point of
 			// filesystem modification.
-			_, exists, err = lexists(fsys.base, path)
+			exists, err = fsys.createdPathExists(path)
 			if err != nil {
 				multiErr = errors.Join(
 					multiErr,
-					fmt.Errorf("failed to check whether file %s exists in base filesystem: %w", path, err),
+					newRollbackPathError(CodeStatFailed, path, fmt.Errorf("failed to check whether file exists in base filesystem: %w", err)),
 				)
 				continue
 			}
@@ -677,6 +1206,15 @@ func (fsys *BackupFS) Rollback() (multiErr error) {
 			continue
 		}
 
+		if isSubtreeInfo(info) {
+			restoreSubtreePaths = append(restoreSubtreePaths, path)
+			continue
+		}
+		if isPlaceholderInfo(info) {
+			restorePlaceholders = append(restorePlaceholders, path)
+			continue
+		}
+
 		mode := info.Mode()
 		switch {
 		case mode.IsDir():
@@ -686,30 +1224,54 @@ func (fsys *BackupFS) Rollback() (multiErr error) {
 		case mode&os.ModeSymlink != 0:
 			restoreSymlinkPaths = append(restoreSymlinkPaths, path)
 		default:
-			log.Printf("unknown file type: %s\n", path)
+			fsys.logger().Warn("unknown file type", "path", path, "mode", mode)
 		}
 	}
 
-	err = fsys.tryRemoveBasePaths(removeBasePaths)
+	fsys.reportGeneration(len(removeBasePaths) + len(restoreDirPaths) + len(restoreFilePaths) +
+		len(restoreSymlinkPaths) + len(restoreSubtreePaths) + len(restorePlaceholders))
+
+	err = fsys.tryRemoveBasePaths(ctx, removeBasePaths)
+	if err != nil {
+		multiErr = errors.Join(multiErr, err)
+	}
+
+	err = fsys.tryRestoreDirPaths(ctx, restoreDirPaths)
+	if err != nil {
+		multiErr = errors.Join(multiErr, err)
+	}
+
+	// subtrees require their parent directories to exist
+	err = fsys.tryRestoreSubtreePaths(ctx, restoreSubtreePaths)
 	if err != nil {
-		multiErr = errors.Join(err)
+		multiErr = errors.Join(multiErr, err)
 	}
 
-	err = fsys.tryRestoreDirPaths(restoreDirPaths)
+	err = fsys.tryRestoreFilePaths(ctx, restoreFilePaths)
 	if err != nil {
 		multiErr = errors.Join(multiErr, err)
 	}
 
-	err = fsys.tryRestoreFilePaths(restoreFilePaths)
+	err = fsys.tryRestorePlaceholderPaths(ctx, restorePlaceholders)
 	if err != nil {
 		multiErr = errors.Join(multiErr, err)
 	}
 
-	err = fsys.tryRestoreSymlinkPaths(restoreSymlinkPaths)
+	err = fsys.tryRestoreSymlinkPaths(ctx, restoreSymlinkPaths)
 	if err != nil {
 		multiErr = errors.Join(multiErr, err)
 	}
 
+	err = ctx.Err()
+	if err != nil {
+		// keep the internal state in order to be able to retry the rollback
+		return errors.Join(multiErr, newRollbackPathError(CodeCanceled, "", err))
+	}
+
+	if fsys.opts.symlinkValidation {
+		report.Warnings = append(report.Warnings, fsys.validateSymlinks(restoreSymlinkPaths)...)
+	}
+
 	// TODO: make this optional?: whether to delete the backup upon rollback
 
 	// at this point we were able to restore all of the files
@@ -725,6 +1287,12 @@ func (fsys *BackupFS) Rollback() (multiErr error) {
 		multiErr = errors.Join(multiErr, err)
 	}
 
+	// subtrees were entirely created by us, they do not contain user content
+	err = fsys.tryRemoveBackupSubtreePaths(restoreSubtreePaths)
+	if err != nil {
+		multiErr = errors.Join(multiErr, err)
+	}
+
 	// best effort deletion of backup files
 	// so we ignore the error
 	// we only delete directories that we did create.
@@ -743,25 +1311,38 @@ func (fsys *BackupFS) Rollback() (multiErr error) {
 	// removed all of the backup files and directories
 
 	// now we can reset the internal data structure for book keeping of filesystem modifications
-	fsys.baseInfos = make(map[string]fs.FileInfo, 1)
+	err = fsys.baseInfos.reset()
+	if err != nil {
+		multiErr = errors.Join(multiErr, fmt.Errorf("failed to remove state index: %w", err))
+	}
+	fsys.subtrees = 0
+	fsys.inodes = 0
+	fsys.backupBytes = 0
+	fsys.peakTracked = 0
+	fsys.checksums = nil
 	return multiErr
 }
 
-func (fsys *BackupFS) tryRemoveBasePaths(removeBasePaths []string) (multiErr error) {
+func (fsys *BackupFS) tryRemoveBasePaths(ctx context.Context, removeBasePaths []string) (multiErr error) {
 	var err error
 	// remove files from most nested to least nested
 	sort.Sort(ByMostFilePathSeparators(removeBasePaths))
 	for _, remPath := range removeBasePaths {
+		if ctx.Err() != nil {
+			// reported by RollbackContext
+			return multiErr
+		}
 		// remove all files that were not there before the backup.
 		// ignore error, as this is a best effort restoration.
 		// folders and files did not exist in the first place
-		err = fsys.base.Remove(remPath)
+		err = fsys.retry(ctx, func() error {
+			return fsys.base.Remove(remPath)
+		})
 		if err != nil {
-			multiErr = errors.Join(
-				multiErr,
-				fmt.Errorf("failed to remove path in base filesystem %s: %w", remPath, err),
-			)
+			err = newRollbackPathError(CodeRemoveFailed, remPath, fmt.Errorf("failed to remove path in base filesystem: %w", err))
+			multiErr = errors.Join(multiErr, err)
 		}
+		fsys.reportProgress(ProgressRemoved, remPath, err)
 	}
 	return multiErr
 }
@@ -779,7 +1360,7 @@ func (fsys *BackupFS) tryRemoveBackupPaths(fileType string, removeBackupPaths []
 		if err != nil {
 			multiErr = errors.Join(
 				multiErr,
-				fmt.Errorf("failed to check whether %s exists in backup filesystem %s: %w", fileType, remPath, err),
+				newRollbackPathError(CodeStatFailed, remPath, fmt.Errorf("failed to check whether %s exists in backup filesystem: %w", fileType, err)),
 			)
 			continue
 		}
@@ -796,96 +1377,272 @@ func (fsys *BackupFS) tryRemoveBackupPaths(fileType string, removeBackupPaths []
 		if err != nil {
 			multiErr = errors.Join(
 				multiErr,
-				fmt.Errorf("failed to remove %s in backup filesystem %s: %w", fileType, remPath, err),
+				newRollbackPathError(CodeRemoveBackupFailed, remPath, fmt.Errorf("failed to remove %s in backup filesystem: %w", fileType, err)),
 			)
 		}
 	}
 	return multiErr
 }
 
-func (fsys *BackupFS) tryRestoreDirPaths(restoreDirPaths []string) (multiErr error) {
+func (fsys *BackupFS) tryRestoreDirPaths(ctx context.Context, restoreDirPaths []string) (multiErr error) {
 	// in order to iterate over parent directories before child directories
 	sort.Sort(ByLeastFilePathSeparators(restoreDirPaths))
 	var err error
 	for _, dirPath := range restoreDirPaths {
-		// backup -> base filesystem
-		err = copyDir(fsys.base, dirPath, fsys.baseInfos[dirPath])
+		if ctx.Err() != nil {
+			// reported by RollbackContext
+			return multiErr
+		}
+		// a symlink or file at the directory path must not be followed,
+		// otherwise the restored directory content ends up in the symlink target
+		err = removeNonDir(fsys.base, dirPath)
+		if err == nil {
+			// backup -> base filesystem
+			var info fs.FileInfo
+			info, err = fsys.baseInfos.load(dirPath)
+			if err == nil {
+				err = fsys.retry(ctx, func() error {
+					return copyDirWithXattrs(fsys.backup, fsys.base, dirPath, info, fsys.opts)
+				})
+			}
+		}
 		if err != nil {
+			err = newRollbackPathError(CodeRestoreDirFailed, dirPath, err)
 			multiErr = errors.Join(multiErr, err)
 		}
+		fsys.reportProgress(ProgressRestored, dirPath, err)
 	}
 	return multiErr
 }
 
-func (fsys *BackupFS) tryRestoreSymlinkPaths(restoreSymlinkPaths []string) (multiErr error) {
-	// in this case it does not matter whether we sort the symlink paths or not
-	// we prefer to sort them in order to see potential errors better
-	sort.Strings(restoreSymlinkPaths)
+func (fsys *BackupFS) tryRestoreSymlinkPaths(ctx context.Context, restoreSymlinkPaths []string) (multiErr error) {
+	// symlinks that point at or through other restored symlinks are restored after them,
+	// otherwise in lexical order in order to see potential errors better
 	var err error
-	for _, symlinkPath := range restoreSymlinkPaths {
-		err = restoreSymlink(
-			symlinkPath,
-			fsys.baseInfos[symlinkPath],
-			fsys.base,
-			fsys.backup,
-		)
+	for _, symlinkPath := range orderSymlinksByTarget(fsys.backup, restoreSymlinkPaths) {
+		if ctx.Err() != nil {
+			// reported by RollbackContext
+			return multiErr
+		}
+		err = fsys.checkBackup(symlinkPath, os.ModeSymlink)
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+			fsys.reportProgress(ProgressRestored, symlinkPath, err)
+			continue
+		}
+
+		var info fs.FileInfo
+		info, err = fsys.baseInfos.load(symlinkPath)
+		if err == nil {
+			err = fsys.retry(ctx, func() error {
+				return restoreSymlink(symlinkPath, info, fsys.base, fsys.backup, fsys.opts)
+			})
+		}
 		if err != nil {
 			// in this case it might make sense to retry the rollback
+			err = newRollbackPathError(CodeRestoreSymlinkFailed, symlinkPath, err)
 			multiErr = errors.Join(multiErr, err)
 		}
+		fsys.reportProgress(ProgressRestored, symlinkPath, err)
 	}
 
 	return multiErr
 }
 
-func (fsys *BackupFS) tryRestoreFilePaths(restoreFilePaths []string) (multiErr error) {
+// checkBackup returns a rollback error with the code CodeBackupMissing in case that the backup
+// of the path does not exist or has a different file type.
+func (fsys *BackupFS) checkBackup(path string, fileType fs.FileMode) error {
+	fi, found, err := lexists(fsys.backup, path)
+	if err != nil {
+		return newRollbackPathError(CodeStatFailed, path, fmt.Errorf("failed to check whether backup exists: %w", err))
+	}
+	if !found || fi.Mode().Type() != fileType {
+		return newRollbackPathError(CodeBackupMissing, path, ErrMissingBackup)
+	}
+	return nil
+}
+
+// validateSymlinks returns a warning for every restored symlink whose target does not exist
+func (fsys *BackupFS) validateSymlinks(restoredSymlinkPaths []string) (warnings []string) {
+	for _, symlinkPath := range restoredSymlinkPaths {
+		_, found, err := lexists(fsys.base, symlinkPath)
+		if err != nil || !found {
+			// symlink could not be restored, which is reported as error
+			continue
+		}
+
+		target, found, err := resolveSymlinkTarget(fsys.base, symlinkPath)
+		switch {
+		case err != nil:
+			warnings = append(warnings, fmt.Sprintf("failed to validate restored symlink %s: %v", symlinkPath, err))
+		case !found:
+			warnings = append(warnings, fmt.Sprintf("restored symlink %s points to non-existing target %s", symlinkPath, target))
+		}
+	}
+	return warnings
+}
+
+func (fsys *BackupFS) tryRestoreFilePaths(ctx context.Context, restoreFilePaths []string) (multiErr error) {
 	// in this case it does not matter whether we sort the file paths or not
 	// we prefer to sort them in order to see potential errors better
 	sort.Strings(restoreFilePaths)
 	var err error
 	for _, filePath := range restoreFilePaths {
-		err = restoreFile(filePath, fsys.baseInfos[filePath], fsys.base, fsys.backup)
+		if ctx.Err() != nil {
+			// reported by RollbackContext
+			return multiErr
+		}
+		err = fsys.checkBackup(filePath, 0)
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+			fsys.reportProgress(ProgressRestored, filePath, err)
+			continue
+		}
+
+		err = fsys.checkBackupIntegrity(filePath)
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+			fsys.reportProgress(ProgressRestored, filePath, err)
+			continue
+		}
+
+		var info fs.FileInfo
+		info, err = fsys.baseInfos.load(filePath)
+		if err == nil {
+			err = fsys.retry(ctx, func() error {
+				return restoreFile(filePath, info, fsys.base, fsys.backup, fsys.opts)
+			})
+		}
 		if err != nil {
 			// in this case it might make sense to retry the rollback
+			err = newRollbackPathError(CodeRestoreFileFailed, filePath, err)
 			multiErr = errors.Join(multiErr, err)
 		}
+		fsys.reportProgress(ProgressRestored, filePath, err)
 	}
 
 	return multiErr
 }
 
+// logger returns the logger of WithLogger or the default logger of the slog package.
+func (fsys *BackupFS) logger() *slog.Logger {
+	return loggerOrDefault(fsys.opts.logger)
+}
+
 // returns the cleaned path
 func (fsys *BackupFS) realPath(name string) (resolvedName string, err error) {
-	return resolvePath(fsys, filepath.Clean(name))
+	resolvedName, _, err = fsys.realPathWithFound(name)
+	return resolvedName, err
 }
 
+// realPathWithFound resolves the path and backs up all symlinks that are traversed as
+// parent directories, as they may be replaced by directories later on.
+// Only modifying operations resolve paths, so the symlinks are tracked before any modification.
 func (fsys *BackupFS) realPathWithFound(name string) (resolvedName string, found bool, err error) {
-	return resolvePathWithFound(fsys, filepath.Clean(name))
+	if resolve := fsys.opts.pathResolver; resolve != nil {
+		resolvedName, fi, err := resolve(fsys.base, normalizePath(name))
+		if err != nil {
+			return "", false, err
+		}
+		return fsys.canonicalPath(resolvedName), fi != nil, nil
+	}
+
+	if fsys.noSymlinks {
+		resolvedName, found, err := resolvePathWithoutSymlinks(fsys.base, normalizePath(name))
+		if err != nil {
+			return "", false, err
+		}
+		return fsys.canonicalPath(resolvedName), found, nil
+	}
+
+	resolvedName, fi, symlinks, err := resolvePathWithSymlinks(fsys.base, normalizePath(name))
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, symlink := range symlinks {
+		err = fsys.tryBackup(symlink)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	fsys.logger().Debug("resolved path", "path", name, "resolved", resolvedName, "symlinks", len(symlinks))
+	return fsys.canonicalPath(resolvedName), fi != nil, nil
+}
+
+// realTargetPath resolves the path like realPath and additionally follows the
+// symlink that the path may point at.
+func (fsys *BackupFS) realTargetPath(name string) (string, error) {
+	resolvedName, err := fsys.realPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := fsys.base.Lstat(resolvedName)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		// non existing paths are reported by the caller
+		return resolvedName, nil
+	}
+
+	target, _, err := resolveSymlinkTarget(fsys.base, resolvedName)
+	if err != nil {
+		return "", err
+	}
+	return fsys.canonicalPath(target), nil
 }
 
 // keeps track of files in the base filesystem.
 // Files are saved only once, any consecutive update is ignored.
-func (fsys *BackupFS) setInfoIfNotAlreadySeen(path string, info fs.FileInfo) {
-	_, found := fsys.baseInfos[path]
-	if !found {
-		fsys.baseInfos[path] = info
+// In case that the path cannot be journaled, it is not tracked and the error is returned.
+func (fsys *BackupFS) setInfoIfNotAlreadySeen(path string, info fs.FileInfo) error {
+	_, found := fsys.baseInfos.get(path)
+	if found {
+		return nil
+	}
+	return fsys.track(path, info)
+}
+
+// track adds the file info of the path to the internal state and to the journal.
+// The path is not tracked in case that either of both fails.
+func (fsys *BackupFS) track(path string, info fs.FileInfo) error {
+	err := fsys.baseInfos.set(path, info)
+	if err != nil {
+		return err
+	}
+	err = fsys.journalTrack(path, info)
+	if err != nil {
+		fsys.baseInfos.delete(path)
+		return err
 	}
+	fsys.trackSpelling(path)
+	fsys.trackPeak()
+	return nil
 }
 
 func (fsys *BackupFS) alreadySeen(path string) bool {
-	_, found := fsys.baseInfos[path]
+	_, found := fsys.alreadySeenWithInfo(path)
 	return found
 }
 
 func (fsys *BackupFS) alreadySeenWithInfo(path string) (fs.FileInfo, bool) {
-	fi, found := fsys.baseInfos[path]
-	return fi, found
+	fi, found := fsys.baseInfos.get(path)
+	if found {
+		return fi, true
+	}
+
+	// anything inside of a compacted subtree has been backed up already
+	root, found := fsys.compactedSubtreeOf(path)
+	if found {
+		fi, _ = fsys.baseInfos.get(root)
+		return fi, true
+	}
+	return nil, false
 }
 
 func (fsys *BackupFS) tryRemoveBackup(resolvedName string) (err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "try_remove_backup", Path: resolvedName, Err: err}
+			err = newBackupError(OpTryRemoveBackup, resolvedName, err)
 		}
 	}()
 
@@ -894,6 +1651,20 @@ func (fsys *BackupFS) tryRemoveBackup(resolvedName string) (err error) {
 		return nil
 	}
 
+	if _, found := fsys.compactedSubtreeOf(resolvedName); found {
+		// the backup of a compacted subtree is only removed as a whole
+		return nil
+	}
+	if fi, _ := fsys.baseInfos.get(resolvedName); isSubtreeInfo(fi) {
+		err = fsys.removeBackupSubtree(resolvedName)
+		if err != nil {
+			return err
+		}
+		fsys.baseInfos.delete(resolvedName)
+		fsys.subtrees--
+		return fsys.journalUntrack(resolvedName)
+	}
+
 	fi, err := fsys.backup.Lstat(resolvedName)
 	if err != nil && !isNotFoundError(err) {
 		return err
@@ -903,8 +1674,8 @@ func (fsys *BackupFS) tryRemoveBackup(resolvedName string) (err error) {
 	if fi == nil {
 		// nothing to remove, except internal state if it exists
 
-		delete(fsys.baseInfos, resolvedName)
-		return nil
+		fsys.baseInfos.delete(resolvedName)
+		return fsys.journalUntrack(resolvedName)
 	}
 
 	if !fi.IsDir() {
@@ -916,8 +1687,8 @@ func (fsys *BackupFS) tryRemoveBackup(resolvedName string) (err error) {
 		// only delete from internal state
 		// when file has been deleted
 		// this allows to retry the deletion attempt
-		delete(fsys.baseInfos, resolvedName)
-		return nil
+		fsys.baseInfos.delete(resolvedName)
+		return fsys.journalUntrack(resolvedName)
 	}
 
 	dirs := make([]string, 0)
@@ -941,8 +1712,8 @@ func (fsys *BackupFS) tryRemoveBackup(resolvedName string) (err error) {
 		}
 		// delete dirs and files from internal map
 		// but only after re have removed the file successfully
-		delete(fsys.baseInfos, path)
-		return nil
+		fsys.baseInfos.delete(path)
+		return fsys.journalUntrack(path)
 	})
 	if err != nil {
 		return err
@@ -959,16 +1730,35 @@ func (fsys *BackupFS) tryRemoveBackup(resolvedName string) (err error) {
 
 		// delete directory from internal
 		// state only after it has been actually deleted
-		delete(fsys.baseInfos, dir)
+		fsys.baseInfos.delete(dir)
+		err = fsys.journalUntrack(dir)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (fsys *BackupFS) tryBackup(resolvedName string) (err error) {
+func (fsys *BackupFS) tryBackup(resolvedName string) error {
+	return fsys.tryBackupWithLink(resolvedName, false)
+}
+
+// tryBackupUnlinked is like tryBackup for files that are removed or replaced afterwards without being modified,
+// which allows to hard link them into the backup, see WithHardlinkBackups.
+func (fsys *BackupFS) tryBackupUnlinked(resolvedName string) error {
+	return fsys.tryBackupWithLink(resolvedName, fsys.opts.hardlinkBackups)
+}
+
+func (fsys *BackupFS) tryBackupWithLink(resolvedName string, link bool) (err error) {
+	resolvedName = fsys.canonicalPath(resolvedName)
+
+	fsys.stateMu.Lock()
+	defer fsys.stateMu.Unlock()
+
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "try_backup", Path: resolvedName, Err: err}
+			err = newBackupError(OpTryBackup, resolvedName, err)
 		}
 	}()
 
@@ -998,31 +1788,78 @@ func (fsys *BackupFS) tryBackup(resolvedName string) (err error) {
 		// we did already backup all of the directory tree
 		return nil
 	case fileMode.IsRegular():
+		if fsys.placeholderRequired(info) {
+			// only keep track of the metadata
+			return fsys.setInfoIfNotAlreadySeen(resolvedName, &placeholderInfo{FileInfo: info})
+		}
+
 		// name was a path to a file
 		// create the file
-		sf, err := fsys.base.Open(resolvedName)
+		err = fsys.reserveBytes(info)
 		if err != nil {
 			return err
 		}
-		defer sf.Close()
-		err = copyFile(fsys.backup, resolvedName, info, sf)
+		defer func() {
+			if err != nil {
+				// the file has not been backed up
+				fsys.releaseBytes(info)
+			}
+		}()
+		err = fsys.reserveInode()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				fsys.releaseInode()
+			}
+		}()
+		linked := false
+		if link {
+			linked, err = fsys.linkBackupFile(resolvedName, info)
+			if err != nil {
+				return err
+			}
+		}
+		if !linked {
+			// the content is copied without blocking operations on other paths,
+			// the file itself is guarded by its path lock, see lockPath.
+			fsys.stateMu.Unlock()
+			sum, err := fsys.copyBackupFile(resolvedName, info)
+			fsys.stateMu.Lock()
+			if err != nil {
+				return err
+			}
+			fsys.setChecksum(resolvedName, sum)
+		}
+		// the backup must be journaled before the base filesystem is modified
+		err = fsys.setInfoIfNotAlreadySeen(resolvedName, info)
 		if err != nil {
+			if linked {
+				// a subsequent copy must not write into the linked file
+				_ = fsys.backup.Remove(resolvedName)
+			}
 			return err
 		}
-		fsys.setInfoIfNotAlreadySeen(resolvedName, info)
+		fsys.reportBackup(resolvedName, info)
 		return nil
 	case fileMode&os.ModeSymlink != 0:
 		// symlink
-		err = copySymlink(
-			fsys.base,
-			fsys.backup,
-			resolvedName,
-			info,
-		)
+		err = fsys.reserveInode()
+		if err != nil {
+			return err
+		}
+		err = fsys.retry(context.Background(), func() error {
+			return copySymlink(fsys.base, fsys.backup, resolvedName, info, fsys.opts)
+		})
+		if err == nil {
+			err = fsys.setInfoIfNotAlreadySeen(resolvedName, fsys.toSymlinkInfo(resolvedName, info))
+		}
 		if err != nil {
+			fsys.releaseInode()
 			return err
 		}
-		fsys.setInfoIfNotAlreadySeen(resolvedName, info)
+		fsys.reportBackup(resolvedName, info)
 		return nil
 	default:
 		// unsupported file for backing up
@@ -1048,42 +1885,144 @@ func (fsys *BackupFS) backupDirs(resolvedDirPath string) (err error) {
 		}
 
 		// is a directory, backup the directory
-		err = copyDir(fsys.backup, resolvedSubDirPath, fi)
+		err = fsys.reserveInode()
+		if err != nil {
+			return false, err
+		}
+		err = fsys.retry(context.Background(), func() error {
+			return copyDirWithXattrs(fsys.base, fsys.backup, resolvedSubDirPath, fsys.backupDirInfo(fi), fsys.opts)
+		})
+		if err == nil {
+			err = fsys.setInfoIfNotAlreadySeen(resolvedSubDirPath, fi)
+		}
 		if err != nil {
+			fsys.releaseInode()
 			return false, err
 		}
-		fsys.setInfoIfNotAlreadySeen(resolvedSubDirPath, fi)
+		fsys.reportBackup(resolvedSubDirPath, fi)
 
 		return true, nil
 	})
 	if err != nil {
-		return &os.PathError{Op: "backup_dirs", Path: resolvedDirPath, Err: err}
+		return newBackupError(OpBackupDirs, resolvedDirPath, err)
 	}
 	return nil
 }
 
+// backupDirInfo applies the umask of the backup directories to the mode of the directory, see WithBackupUmask.
+// Restored directories get the mode of the original file info.
+func (fsys *BackupFS) backupDirInfo(fi fs.FileInfo) fs.FileInfo {
+	umask := fsys.opts.backupUmask
+	if umask == 0 || fi.Mode()&umask == 0 {
+		return fi
+	}
+	return &umaskInfo{FileInfo: fi, mode: fi.Mode() &^ umask}
+}
+
+// umaskInfo overrides the mode of a file info
+type umaskInfo struct {
+	fs.FileInfo
+	mode fs.FileMode
+}
+
+func (fi *umaskInfo) Mode() fs.FileMode {
+	return fi.mode
+}
+
 // backupRequired checks whether a file that is about to be changed needs to be backed up.
 // files that do not exist in the BackupFS need to be backed up.
 // files that do exist in the BackupFS either as files or in the baseInfos map as non-existing files
 // do not  need to be backed up (again)
+// files and symlinks may additionally be skipped by the BackupRequiredFunc option.
 func (fsys *BackupFS) backupRequired(resolvedName string) (info fs.FileInfo, required bool, err error) {
+	if fsys.isInternalPath(resolvedName) {
+		return nil, false, ErrReservedPath
+	}
 
 	info, found := fsys.alreadySeenWithInfo(resolvedName)
+	if m := fsys.opts.metrics; m != nil {
+		m.ObserveLookup(found)
+	}
 	if found {
 		// base infos is the truth, if nothing is found, nothing needs to be backed up
+		fsys.logger().Debug("backup not required, already tracked", "path", resolvedName)
 		return info, false, nil
 	}
 
 	// fill fsys.baseInfos
 	// of symlink, file & directory as well as their parent directories.
-	info, err = fsys.Lstat(resolvedName)
+	info, err = fsys.base.Lstat(resolvedName)
 	if isNotFoundError(err) {
-		fsys.setInfoIfNotAlreadySeen(resolvedName, nil)
+		err = fsys.setInfoIfNotAlreadySeen(resolvedName, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		// missing parent directories are created by operations like MkdirAll
+		// and must be removed upon rollback as well.
+		err = fsys.markMissingParents(resolvedName)
+		if err != nil {
+			return nil, false, err
+		}
 		// not found, no backup needed
+		fsys.logger().Debug("backup not required, tracked as created", "path", resolvedName)
 		return nil, false, nil
 	} else if err != nil {
 		return nil, false, err
 	}
 
+	if f := fsys.opts.backupRequiredFunc; f != nil && !info.IsDir() && !f(resolvedName, info) {
+		// skipped by the user
+		fsys.logger().Debug("backup not required, skipped by backup required func", "path", resolvedName)
+		return info, false, nil
+	}
+
+	required, err = fsys.largeFileRequired(info)
+	if err != nil {
+		return nil, false, err
+	}
+	if !required {
+		fsys.logger().Debug("backup not required, large file skipped", "path", resolvedName, "size", info.Size())
+		return info, false, nil
+	}
+
+	fsys.logger().Debug("backup required", "path", resolvedName, "mode", info.Mode())
 	return info, true, nil
 }
+
+// isInternalPath is true in case that resolvedName would be backed up to internalDir or one of its children.
+func (fsys *BackupFS) isInternalPath(resolvedName string) bool {
+	if fsys.opts.backupLayout != LayoutMirror {
+		return false
+	}
+	_, ok := fsys.pathKeys().trimPrefix(resolvedName, internalDir)
+	return ok
+}
+
+// removeInternalDir removes internalDir in case that it does not contain any internal files anymore.
+func (fsys *BackupFS) removeInternalDir() {
+	// best effort, fails in case that the directory is not empty
+	_ = fsys.rootBackup.Remove(internalDir)
+}
+
+// markMissingParents marks all parent directories of resolvedName that do not exist
+// in the base filesystem as created by us.
+func (fsys *BackupFS) markMissingParents(resolvedName string) error {
+	for dir := filepath.Dir(resolvedName); dir != resolvedName; resolvedName, dir = dir, filepath.Dir(dir) {
+		if fsys.alreadySeen(dir) {
+			return nil
+		}
+
+		_, err := fsys.base.Lstat(dir)
+		if err == nil {
+			return nil
+		}
+		if !isNotFoundError(err) {
+			return err
+		}
+		err = fsys.setInfoIfNotAlreadySeen(dir, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
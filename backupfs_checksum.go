@@ -0,0 +1,211 @@
+package backupfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrChecksumMismatch is returned by VerifyChecksums in case that the content of a backup
+	// does not match the checksum that was calculated during its creation.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// backupFile copies the regular file from the base to the backup filesystem.
+// The checksum of the file is calculated from the same reads, see WithChecksums.
+func (fsys *BackupFS) backupFile(resolvedName string, info fs.FileInfo) error {
+	sum, err := fsys.copyBackupFile(resolvedName, info)
+	if err != nil {
+		return err
+	}
+	fsys.setChecksum(resolvedName, sum)
+	return nil
+}
+
+// copyBackupFile copies the file without modifying the internal state,
+// which is why it may be called concurrently. sum is nil in case that checksums are disabled.
+func (fsys *BackupFS) copyBackupFile(resolvedName string, info fs.FileInfo) (sum []byte, err error) {
+	err = fsys.retry(context.Background(), func() (err error) {
+		sum, err = fsys.copyBackupFileOnce(resolvedName, info)
+		return err
+	})
+	return sum, err
+}
+
+func (fsys *BackupFS) copyBackupFileOnce(resolvedName string, info fs.FileInfo) (sum []byte, err error) {
+	sf, err := fsys.openBackupSource(resolvedName)
+	if err != nil {
+		return nil, err
+	}
+	defer sf.Close()
+
+	if fsys.opts.newHash == nil {
+		err = copyFile(fsys.backup, resolvedName, info, sf, fsys.opts)
+		if err != nil {
+			return nil, err
+		}
+		return nil, copyExtendedAttrs(fsys.base, fsys.backup, resolvedName, info)
+	}
+
+	if fsys.opts.reflink != ReflinkNever {
+		// files can only be cloned without reading them, which is why they are hashed afterwards
+		err = copyFile(fsys.backup, resolvedName, info, sf, fsys.opts)
+		if err != nil {
+			return nil, err
+		}
+		_, err = sf.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		h := fsys.opts.newHash()
+		_, err = io.Copy(h, sf)
+		if err != nil {
+			return nil, err
+		}
+		return h.Sum(nil), copyExtendedAttrs(fsys.base, fsys.backup, resolvedName, info)
+	}
+
+	h := fsys.opts.newHash()
+	err = copyFile(fsys.backup, resolvedName, info, io.TeeReader(sf, h), fsys.opts)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), copyExtendedAttrs(fsys.base, fsys.backup, resolvedName, info)
+}
+
+func (fsys *BackupFS) setChecksum(resolvedName string, sum []byte) {
+	if sum == nil {
+		return
+	}
+	if fsys.checksums == nil {
+		fsys.checksums = make(map[string][]byte)
+	}
+	fsys.checksums[resolvedName] = sum
+}
+
+// Checksums returns the checksums of all backed up files of the current generation.
+// Returns nil in case that checksums are disabled, see WithChecksums.
+// Checksums are part of the serialized state, see MarshalJSON.
+func (fsys *BackupFS) Checksums() map[string][]byte {
+	defer fsys.rlockState()()
+
+	if fsys.opts.newHash == nil {
+		return nil
+	}
+
+	checksums := make(map[string][]byte, len(fsys.checksums))
+	for path, sum := range fsys.checksums {
+		checksums[path] = bytes.Clone(sum)
+	}
+	return checksums
+}
+
+// VerifyChecksums hashes all backed up files of the current generation with up to workers goroutines
+// and compares them with the checksums that were calculated during their backup.
+// A value of workers <= 0 uses runtime.GOMAXPROCS(0) goroutines.
+// Mismatches are reported with ErrChecksumMismatch.
+func (fsys *BackupFS) VerifyChecksums(workers int) error {
+	defer fsys.lock(OpVerifyChecksums)()
+
+	return fsys.verifyChecksums([]generation{{backup: fsys.backup, checksums: fsys.checksums}}, workers)
+}
+
+// VerifyBackupIntegrity hashes the backed up files of all generations and compares them with the checksums
+// that were calculated during their backup, see WithChecksums. Every corrupted backup is reported with
+// an *fs.PathError that wraps ErrChecksumMismatch, see WithRollbackVerification in order to skip corrupted
+// backups upon rollback. Returns nil in case that checksums are disabled.
+func (fsys *BackupFS) VerifyBackupIntegrity() error {
+	defer fsys.lock(OpVerifyChecksums)()
+
+	return fsys.verifyChecksums(fsys.allGenerations(), 0)
+}
+
+// checksumJob is the backup of a single file that is verified by verifyChecksums.
+type checksumJob struct {
+	backup FS
+	path   string
+	sum    []byte
+}
+
+func (fsys *BackupFS) verifyChecksums(generations []generation, workers int) error {
+	if fsys.opts.newHash == nil {
+		return nil
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := make([]checksumJob, 0, len(fsys.checksums))
+	for _, g := range generations {
+		paths := make([]string, 0, len(g.checksums))
+		for path := range g.checksums {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			jobs = append(jobs, checksumJob{backup: g.backup, path: path, sum: g.checksums[path]})
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		queue = make(chan int)
+		errs  = make([]error, len(jobs))
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				job := jobs[idx]
+				errs[idx] = fsys.verifyChecksum(job.backup, job.path, job.sum)
+			}
+		}()
+	}
+	for idx := range jobs {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// verifyChecksum hashes the backup of path and compares it with sum.
+func (fsys *BackupFS) verifyChecksum(backup FS, path string, sum []byte) error {
+	actual, err := fsys.hashFile(backup, path)
+	if err != nil {
+		return newBackupError(OpVerifyChecksums, path, err)
+	}
+
+	if !bytes.Equal(actual, sum) {
+		return newBackupError(OpVerifyChecksums, path, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// checkBackupIntegrity returns a rollback error with the code CodeBackupCorrupted in case that
+// the backup of the file does not match its checksum, see WithRollbackVerification.
+// Files without checksum, e.g. after the state was restored from a state of version 1, are not checked.
+func (fsys *BackupFS) checkBackupIntegrity(path string) error {
+	if !fsys.opts.rollbackVerification || fsys.opts.newHash == nil {
+		return nil
+	}
+	sum, found := fsys.checksums[path]
+	if !found {
+		return nil
+	}
+
+	err := fsys.verifyChecksum(fsys.backup, path, sum)
+	if err != nil {
+		return newRollbackPathError(CodeBackupCorrupted, path, err)
+	}
+	return nil
+}
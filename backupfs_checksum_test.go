@@ -0,0 +1,83 @@
+package backupfs
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithChecksums(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithChecksums(sha256.New))
+		filePath           = filepath.FromSlash("/test/file.txt")
+		otherPath          = filepath.FromSlash("/test/other.txt")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, base, otherPath, "other")
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Remove(otherPath))
+
+	sum := sha256.Sum256([]byte("original"))
+	checksums := backupFS.Checksums()
+	require.Len(checksums, 2)
+	require.Equal(sum[:], checksums[filePath])
+
+	require.NoError(backupFS.VerifyChecksums(2))
+
+	// tamper with the backup
+	createFile(t, backup, otherPath, "tampered")
+	err := backupFS.VerifyChecksums(0)
+	require.ErrorIs(err, ErrChecksumMismatch)
+	require.True(HasOp(err, OpVerifyChecksums))
+
+	createFile(t, backup, otherPath, "other")
+	require.NoError(backupFS.Rollback())
+	require.Empty(backupFS.Checksums())
+}
+
+func TestBackupFS_WithRollbackVerification(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithChecksums(sha256.New), WithRollbackVerification(true))
+		filePath           = filepath.FromSlash("/test/file.txt")
+		corruptedPath      = filepath.FromSlash("/test/corrupted.txt")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, base, corruptedPath, "original")
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Snapshot("first"))
+	createFile(t, backupFS, corruptedPath, "modified")
+
+	require.NoError(backupFS.VerifyBackupIntegrity())
+
+	// tamper with the backup of the current generation
+	createFile(t, backupFS.backup, corruptedPath, "tampered")
+	err := backupFS.VerifyBackupIntegrity()
+	require.ErrorIs(err, ErrChecksumMismatch)
+	var pathErr *fs.PathError
+	require.ErrorAs(err, &pathErr)
+	require.Equal(corruptedPath, pathErr.Path)
+
+	err = backupFS.Rollback()
+	require.ErrorIs(err, ErrChecksumMismatch)
+	var rerr *RollbackError
+	require.ErrorAs(err, &rerr)
+	require.Len(rerr.Errors, 1, rerr.Error())
+	require.Equal(CodeBackupCorrupted, rerr.Errors[0].Code)
+
+	// the corrupted content is not restored
+	fileMustContainText(t, base, corruptedPath, "modified")
+	fileMustContainText(t, base, filePath, "original")
+}
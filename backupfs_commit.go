@@ -0,0 +1,135 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// Commit finalizes all modifications of the base filesystem.
+// All backups are deleted and the internal state is reset, so that a subsequent Rollback
+// does not revert any of the committed modifications.
+// Paths whose backups could not be deleted stay tracked, which allows to retry the Commit.
+// This is a heavy weight operation which blocks the file system until the commit is done.
+// All generations are committed and all snapshots are dropped, see Snapshot.
+// Trash entries that are older than the retention of WithTrash are purged.
+func (fsys *BackupFS) Commit() error {
+	defer fsys.lock(OpCommit)()
+
+	fsys.disarmWatchdog()
+
+	// newest generation first
+	for {
+		err := fsys.commitGeneration()
+		if err != nil {
+			return err
+		}
+		if len(fsys.generations) == 0 {
+			fsys.resetReads()
+			fsys.spellings.reset()
+			err = errors.Join(fsys.removeJournal(), fsys.removeState())
+			if err != nil {
+				return err
+			}
+			if fsys.opts.trashRetention > 0 {
+				// expired trash entries are purged, recent ones outlive the commit
+				return fsys.purge(fsys.opts.trashRetention)
+			}
+			return nil
+		}
+
+		err = fsys.popGeneration()
+		if err != nil {
+			return newBackupError(OpCommit, separator, err)
+		}
+	}
+}
+
+// commitGeneration deletes the backups of the current generation.
+func (fsys *BackupFS) commitGeneration() (multiErr error) {
+	var (
+		dirPaths     = make([]string, 0, 4)
+		filePaths    = make([]string, 0, 4)
+		symlinkPaths = make([]string, 0, 4)
+		subtreePaths = make([]string, 0)
+	)
+
+	for _, path := range fsys.baseInfos.paths() {
+		info := fsys.baseInfos.info(path)
+		switch {
+		case info == nil, isPlaceholderInfo(info):
+			// nothing was backed up
+			fsys.baseInfos.delete(path)
+			multiErr = errors.Join(multiErr, fsys.journalUntrack(path))
+		case TrimVolume(path) == separator:
+			// the root directory of the backup filesystem is kept
+			fsys.baseInfos.delete(path)
+			multiErr = errors.Join(multiErr, fsys.journalUntrack(path))
+		case isSubtreeInfo(info):
+			subtreePaths = append(subtreePaths, path)
+		case info.IsDir():
+			dirPaths = append(dirPaths, path)
+		case info.Mode()&os.ModeSymlink != 0:
+			symlinkPaths = append(symlinkPaths, path)
+		default:
+			filePaths = append(filePaths, path)
+		}
+	}
+
+	for _, root := range subtreePaths {
+		err := fsys.removeBackupSubtree(root)
+		if err != nil {
+			multiErr = errors.Join(multiErr, newBackupError(OpCommit, root, fmt.Errorf("failed to remove subtree in backup filesystem: %w", err)))
+			continue
+		}
+		fsys.baseInfos.delete(root)
+		fsys.subtrees--
+		multiErr = errors.Join(multiErr, fsys.journalUntrack(root))
+	}
+
+	// delete files before directories in order for directories to be empty
+	paths := append(append(symlinkPaths, filePaths...), dirPaths...)
+	sort.Sort(ByMostFilePathSeparators(paths))
+	for _, path := range paths {
+		err := fsys.removeBackup(path)
+		if err != nil {
+			multiErr = errors.Join(multiErr, newBackupError(OpCommit, path, err))
+			continue
+		}
+		fsys.baseInfos.delete(path)
+		delete(fsys.checksums, path)
+		multiErr = errors.Join(multiErr, fsys.journalUntrack(path))
+	}
+
+	// backups that could not be removed are still occupying their inodes and bytes
+	fsys.inodes = countInodes(fsys.baseInfos)
+	fsys.backupBytes = countBackupBytes(fsys.baseInfos)
+	if fsys.baseInfos.len() == 0 {
+		// removes the index file, see WithStateIndex
+		err := fsys.baseInfos.reset()
+		if err != nil {
+			multiErr = errors.Join(multiErr, newBackupError(OpCommit, separator, fmt.Errorf("failed to remove state index: %w", err)))
+		}
+	}
+	fsys.shrink()
+	return multiErr
+}
+
+// removeBackup removes a single file, symlink or empty directory from the backup filesystem.
+func (fsys *BackupFS) removeBackup(path string) error {
+	_, found, err := lexists(fsys.backup, path)
+	if err != nil {
+		return fmt.Errorf("failed to check whether backup exists: %w", err)
+	}
+	if !found {
+		return nil
+	}
+
+	err = fsys.backup.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_Commit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		modifiedPath              = filepath.FromSlash("/test/modified.txt")
+		removedPath               = filepath.FromSlash("/test/removed.txt")
+		createdPath               = filepath.FromSlash("/test/created.txt")
+		symlinkPath               = filepath.FromSlash("/test/symlink")
+	)
+
+	createFile(t, base, modifiedPath, "original")
+	createFile(t, base, removedPath, "original")
+	createSymlink(t, base, modifiedPath, symlinkPath)
+
+	createFile(t, backupFS, modifiedPath, "modified")
+	require.NoError(backupFS.Remove(removedPath))
+	require.NoError(backupFS.Remove(symlinkPath))
+	createFile(t, backupFS, createdPath, "created")
+
+	fileMustContainText(t, backup, modifiedPath, "original")
+	fileMustContainText(t, backup, removedPath, "original")
+	mustLExist(t, backup, symlinkPath)
+
+	require.NoError(backupFS.Commit())
+	require.Empty(backupFS.TrackedPaths())
+	mustExist(t, backup, separator)
+
+	// backups are gone
+	mustNotExist(t, backup, modifiedPath)
+	mustNotExist(t, backup, removedPath)
+	mustNotLExist(t, backup, symlinkPath)
+	mustNotExist(t, backup, filepath.FromSlash("/test"))
+
+	// modifications stay
+	fileMustContainText(t, base, modifiedPath, "modified")
+	fileMustContainText(t, base, createdPath, "created")
+	mustNotExist(t, base, removedPath)
+	mustNotLExist(t, base, symlinkPath)
+
+	// a rollback after the commit does not revert anything
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, modifiedPath, "modified")
+	fileMustContainText(t, base, createdPath, "created")
+
+	// the committed state is the new initial state
+	createFile(t, backupFS, modifiedPath, "modified again")
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, modifiedPath, "modified")
+}
+
+func TestBackupFS_Shrink(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require              = require.New(t)
+		_, base, _, backupFS = NewTestBackupFS("/base", "/backup")
+	)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		createFile(t, base, filepath.Join("/test", name), "original")
+		createFile(t, backupFS, filepath.Join("/test", name), "modified")
+	}
+
+	stats := backupFS.Stats()
+	require.Equal(stats.Tracked, stats.PeakTracked)
+
+	require.NoError(backupFS.Commit())
+	stats = backupFS.Stats()
+	require.Zero(stats.Tracked)
+	require.Zero(stats.PeakTracked)
+
+	createFile(t, backupFS, filepath.FromSlash("/test/a.txt"), "modified again")
+	backupFS.Shrink()
+	stats = backupFS.Stats()
+	require.NotZero(stats.Tracked)
+	require.Equal(stats.Tracked, stats.PeakTracked)
+}
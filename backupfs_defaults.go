@@ -0,0 +1,65 @@
+package backupfs
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	// EnvDisableChown is the environment variable that can be used in order to disable
+	// the ownership restoration of files. The value is parsed with strconv.ParseBool.
+	EnvDisableChown = "BACKUPFS_DISABLE_CHOWN"
+
+	// EnvBufferSize is the environment variable that can be used in order to set the
+	// copy buffer size in bytes. The value is parsed with strconv.Atoi.
+	EnvBufferSize = "BACKUPFS_BUFFER_SIZE"
+)
+
+var (
+	defaultOptionsMu sync.Mutex
+	defaultOptions   []BackupFSOption
+)
+
+// SetDefaultOptions sets the package level default options that are used by New and NewWithFS.
+// The default options are applied first, followed by the options that are derived from
+// the environment variables and finally the options that are passed to the constructor.
+// Calling SetDefaultOptions without any options resets the package level default options.
+func SetDefaultOptions(opts ...BackupFSOption) {
+	defaultOptionsMu.Lock()
+	defer defaultOptionsMu.Unlock()
+
+	defaultOptions = append(make([]BackupFSOption, 0, len(opts)), opts...)
+}
+
+// defaultBackupFSOptions returns the package level default options followed by the
+// options that are derived from the environment.
+func defaultBackupFSOptions() []BackupFSOption {
+	defaultOptionsMu.Lock()
+	opts := append(make([]BackupFSOption, 0, len(defaultOptions)+2), defaultOptions...)
+	defaultOptionsMu.Unlock()
+
+	return append(opts, envBackupFSOptions()...)
+}
+
+// envBackupFSOptions returns the options that are configured via environment variables.
+// invalid values are ignored.
+func envBackupFSOptions() []BackupFSOption {
+	opts := make([]BackupFSOption, 0, 2)
+
+	if v, ok := os.LookupEnv(EnvDisableChown); ok {
+		disable, err := strconv.ParseBool(v)
+		if err == nil {
+			opts = append(opts, WithDisableChown(disable))
+		}
+	}
+
+	if v, ok := os.LookupEnv(EnvBufferSize); ok {
+		size, err := strconv.Atoi(v)
+		if err == nil {
+			opts = append(opts, WithBufferSize(size))
+		}
+	}
+
+	return opts
+}
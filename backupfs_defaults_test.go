@@ -0,0 +1,45 @@
+package backupfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultOptions(t *testing.T) {
+	// modifies package level state and the environment, must not run in parallel
+	defer SetDefaultOptions()
+
+	require := require.New(t)
+
+	fsys := NewWithFS(NewOSFS(), CallerPathTmp())
+	require.False(fsys.opts.disableChown)
+	require.Equal(0, fsys.opts.bufferSize)
+
+	SetDefaultOptions(WithBufferSize(1024))
+	fsys = NewWithFS(NewOSFS(), CallerPathTmp())
+	require.False(fsys.opts.disableChown)
+	require.Equal(1024, fsys.opts.bufferSize)
+
+	// environment overrides package level defaults
+	t.Setenv(EnvDisableChown, "true")
+	t.Setenv(EnvBufferSize, "4096")
+	fsys = NewWithFS(NewOSFS(), CallerPathTmp())
+	require.True(fsys.opts.disableChown)
+	require.Equal(4096, fsys.opts.bufferSize)
+
+	// explicitly passed options override the environment
+	fsys = NewWithFS(NewOSFS(), CallerPathTmp(), WithDisableChown(false))
+	require.False(fsys.opts.disableChown)
+	require.Equal(4096, fsys.opts.bufferSize)
+
+	// invalid values are ignored
+	t.Setenv(EnvBufferSize, "not a number")
+	fsys = NewWithFS(NewOSFS(), CallerPathTmp())
+	require.Equal(1024, fsys.opts.bufferSize)
+
+	// NewBackupFS does not consult any defaults
+	fsys = NewBackupFS(NewOSFS(), NewOSFS())
+	require.False(fsys.opts.disableChown)
+	require.Equal(0, fsys.opts.bufferSize)
+}
@@ -0,0 +1,76 @@
+package backupfs
+
+import (
+	"path/filepath"
+)
+
+// PlannedOp is a write operation that has been recorded in dry run mode, see WithDryRun.
+type PlannedOp struct {
+	Op Op `json:"op"`
+	// Path is the resolved path in the base filesystem
+	Path string `json:"path"`
+	// Backup is true in case that the path would have been backed up by this operation
+	Backup bool `json:"backup"`
+}
+
+// Plan returns all write operations that have been recorded in dry run mode in the order
+// of their execution. See WithDryRun.
+func (fsys *BackupFS) Plan() []PlannedOp {
+	defer fsys.rlockState()()
+
+	plan := make([]PlannedOp, len(fsys.plannedOps))
+	copy(plan, fsys.plannedOps)
+	return plan
+}
+
+// plan records an operation on the given resolved paths instead of executing it
+func (fsys *BackupFS) plan(op Op, resolvedNames ...string) error {
+	fsys.stateMu.Lock()
+	defer fsys.stateMu.Unlock()
+
+	for _, name := range resolvedNames {
+		backup, err := fsys.planBackup(name)
+		if err != nil {
+			return err
+		}
+		fsys.plannedOps = append(fsys.plannedOps, PlannedOp{Op: op, Path: name, Backup: backup})
+	}
+	return nil
+}
+
+// planFile records an operation that opens a file for writing and returns an in-memory scratch file.
+func (fsys *BackupFS) planFile(op Op, resolvedName string) (File, error) {
+	err := fsys.plan(op, resolvedName)
+	if err != nil {
+		return nil, err
+	}
+	scratch := NewMemFSWithClock(fsys.opts.clock)
+	return scratch.Create(filepath.Join(separator, filepath.Base(resolvedName)))
+}
+
+// planBackup returns true in case that the file would be backed up for the first time.
+// Contrary to backupRequired the state of the BackupFS is not modified.
+func (fsys *BackupFS) planBackup(resolvedName string) (bool, error) {
+	if fsys.alreadySeen(resolvedName) {
+		return false, nil
+	}
+	if _, found := fsys.plannedPaths[resolvedName]; found {
+		return false, nil
+	}
+	if fsys.plannedPaths == nil {
+		fsys.plannedPaths = make(map[string]struct{})
+	}
+	fsys.plannedPaths[resolvedName] = struct{}{}
+
+	info, err := fsys.base.Lstat(resolvedName)
+	if isNotFoundError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if f := fsys.opts.backupRequiredFunc; f != nil && !info.IsDir() && !f(resolvedName, info) {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,46 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithDryRun(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithDryRun(true))
+		filePath           = filepath.FromSlash("/test/file.txt")
+		createdPath        = filepath.FromSlash("/test/created.txt")
+		dirPath            = filepath.FromSlash("/test/dir")
+	)
+
+	createFile(t, base, filePath, "original")
+	before := createFSState(t, base, "/")
+
+	createFile(t, backupFS, filePath, "modified")
+	createFile(t, backupFS, createdPath, "created")
+	require.NoError(backupFS.Chmod(filePath, 0600))
+	require.NoError(backupFS.Mkdir(dirPath, 0755))
+	require.NoError(backupFS.Rename(filePath, createdPath))
+	require.NoError(backupFS.RemoveAll(filepath.FromSlash("/test")))
+
+	// nothing was modified
+	mustEqualFSState(t, before, base, "/")
+	mustNotExist(t, backup, filePath)
+	require.Empty(backupFS.TrackedPaths())
+
+	require.Equal([]PlannedOp{
+		{Op: OpCreate, Path: filePath, Backup: true},
+		{Op: OpCreate, Path: createdPath},
+		{Op: OpChmod, Path: filePath},
+		{Op: OpMkdir, Path: dirPath},
+		{Op: OpRename, Path: filePath},
+		{Op: OpRename, Path: createdPath},
+		{Op: OpRemoveAll, Path: filepath.FromSlash("/test"), Backup: true},
+	}, backupFS.Plan())
+}
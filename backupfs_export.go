@@ -0,0 +1,182 @@
+package backupfs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ExportFormat is the output format of ExportChanges.
+type ExportFormat string
+
+const (
+	// ExportJSONL writes one JSON object per line.
+	ExportJSONL ExportFormat = "jsonl"
+	// ExportCSV writes a header line followed by one comma separated line per change.
+	ExportCSV ExportFormat = "csv"
+)
+
+// ChangeType describes how a tracked path was modified.
+type ChangeType string
+
+const (
+	// ChangeCreated marks paths that did not exist prior to their modification.
+	ChangeCreated ChangeType = "created"
+	// ChangeRemoved marks paths that existed prior to their modification and that do not exist anymore.
+	ChangeRemoved ChangeType = "removed"
+	// ChangeModified marks paths whose file type, size or modification time changed.
+	ChangeModified ChangeType = "modified"
+	// ChangeMetadata marks paths whose permissions or ownership changed.
+	ChangeMetadata ChangeType = "metadata"
+	// ChangeUnchanged marks tracked paths that are identical to their original state,
+	// e.g. files that were created and removed again.
+	ChangeUnchanged ChangeType = "unchanged"
+)
+
+// FileMetadata is the metadata of a file at a specific point in time.
+type FileMetadata struct {
+	Mode    fs.FileMode `json:"mode"`
+	UID     int         `json:"uid"`
+	GID     int         `json:"gid"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mtime"`
+}
+
+// Change describes a single tracked path with its original and its current metadata.
+type Change struct {
+	Path string     `json:"path"`
+	Type ChangeType `json:"change"`
+	// Old is nil in case that the path did not exist prior to its modification.
+	Old *FileMetadata `json:"old,omitempty"`
+	// New is nil in case that the path does not exist anymore.
+	New *FileMetadata `json:"new,omitempty"`
+}
+
+var changeCSVHeader = []string{
+	"path", "change",
+	"old_mode", "old_uid", "old_gid", "old_size", "old_mtime",
+	"new_mode", "new_uid", "new_gid", "new_size", "new_mtime",
+}
+
+// Changes returns the sorted list of all tracked paths with their original metadata
+// and the metadata of their current state in the base filesystem.
+// Directory trees that were backed up as a whole are reported as a single change.
+// The change set is reset by Rollback, so it needs to be generated before committing
+// or rolling back the modifications.
+func (fsys *BackupFS) Changes() ([]Change, error) {
+	defer fsys.lock(OpExport)()
+
+	changes := make([]Change, 0, fsys.baseInfos.len())
+	for _, path := range fsys.baseInfos.paths() {
+		info, err := fsys.baseInfos.load(path)
+		if err != nil {
+			return nil, newBackupError(OpExport, path, err)
+		}
+		fi, found, err := lexists(fsys.base, path)
+		if err != nil {
+			return nil, newBackupError(OpExport, path, err)
+		}
+
+		c := Change{Path: path}
+		if info != nil {
+			c.Old = toFileMetadata(info)
+		}
+		if found {
+			c.New = toFileMetadata(fi)
+		}
+		c.Type = changeTypeOf(c.Old, c.New)
+		changes = append(changes, c)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// ExportChanges writes the tracked change set to w in the given format,
+// e.g. for the ingestion into audit pipelines. See Changes.
+// File contents are not exported.
+func (fsys *BackupFS) ExportChanges(w io.Writer, format ExportFormat) error {
+	changes, err := fsys.Changes()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ExportJSONL:
+		enc := json.NewEncoder(w)
+		for _, c := range changes {
+			err = enc.Encode(c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		err = cw.Write(changeCSVHeader)
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			record := append([]string{c.Path, string(c.Type)}, c.Old.csvRecord()...)
+			record = append(record, c.New.csvRecord()...)
+			err = cw.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unsupported export format: %q", format)
+	}
+}
+
+func toFileMetadata(fi fs.FileInfo) *FileMetadata {
+	return &FileMetadata{
+		Mode:    fi.Mode(),
+		UID:     toUID(fi),
+		GID:     toGID(fi),
+		Size:    fi.Size(),
+		ModTime: fi.ModTime().UTC(),
+	}
+}
+
+func changeTypeOf(old, new *FileMetadata) ChangeType {
+	switch {
+	case old == nil && new == nil:
+		return ChangeUnchanged
+	case old == nil:
+		return ChangeCreated
+	case new == nil:
+		return ChangeRemoved
+	case old.Mode.Type() != new.Mode.Type() ||
+		old.Size != new.Size ||
+		!old.ModTime.Equal(new.ModTime):
+		return ChangeModified
+	case old.Mode != new.Mode || old.UID != new.UID || old.GID != new.GID:
+		return ChangeMetadata
+	default:
+		return ChangeUnchanged
+	}
+}
+
+func (m *FileMetadata) csvRecord() []string {
+	if m == nil {
+		return []string{"", "", "", "", ""}
+	}
+	return []string{
+		m.Mode.String(),
+		strconv.Itoa(m.UID),
+		strconv.Itoa(m.GID),
+		strconv.FormatInt(m.Size, 10),
+		m.ModTime.Format(time.RFC3339Nano),
+	}
+}
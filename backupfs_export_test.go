@@ -0,0 +1,77 @@
+package backupfs
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_ExportChanges(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require              = require.New(t)
+		_, base, _, backupFS = NewTestBackupFS("/base", "/backup")
+		modifiedPath         = filepath.FromSlash("/test/modified.txt")
+		chmodPath            = filepath.FromSlash("/test/chmod.txt")
+		removedPath          = filepath.FromSlash("/test/removed.txt")
+		createdPath          = filepath.FromSlash("/test/created.txt")
+		expectedChanges      = map[string]ChangeType{
+			modifiedPath: ChangeModified,
+			chmodPath:    ChangeMetadata,
+			removedPath:  ChangeRemoved,
+			createdPath:  ChangeCreated,
+		}
+	)
+
+	createFile(t, base, modifiedPath, "original")
+	createFile(t, base, chmodPath, "original")
+	createFile(t, base, removedPath, "original")
+
+	createFile(t, backupFS, modifiedPath, "modified content")
+	require.NoError(backupFS.Chmod(chmodPath, 0600))
+	require.NoError(backupFS.Remove(removedPath))
+	createFile(t, backupFS, createdPath, "created")
+
+	changes, err := backupFS.Changes()
+	require.NoError(err)
+
+	found := make(map[string]ChangeType)
+	for _, c := range changes {
+		found[c.Path] = c.Type
+	}
+	for path, typ := range expectedChanges {
+		require.Equal(typ, found[path], path)
+	}
+
+	var jsonl bytes.Buffer
+	require.NoError(backupFS.ExportChanges(&jsonl, ExportJSONL))
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	require.Len(lines, len(changes))
+	for i, line := range lines {
+		var c Change
+		require.NoError(json.Unmarshal([]byte(line), &c))
+		require.Equal(changes[i].Path, c.Path)
+		require.Equal(changes[i].Type, c.Type)
+		require.Equal(changes[i].Old == nil, c.Old == nil)
+		require.Equal(changes[i].New == nil, c.New == nil)
+	}
+
+	var csvBuf bytes.Buffer
+	require.NoError(backupFS.ExportChanges(&csvBuf, ExportCSV))
+	records, err := csv.NewReader(&csvBuf).ReadAll()
+	require.NoError(err)
+	require.Len(records, len(changes)+1)
+	require.Equal(changeCSVHeader, records[0])
+	for i, record := range records[1:] {
+		require.Equal(changes[i].Path, record[0])
+		require.Equal(string(changes[i].Type), record[1])
+	}
+
+	require.Error(backupFS.ExportChanges(&csvBuf, ExportFormat("xml")))
+}
@@ -0,0 +1,174 @@
+package backupfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	// ErrSnapshotNotFound is returned by RollbackTo in case that there is no snapshot with the given name.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrSnapshotExists is returned by Snapshot in case that a snapshot with the given name already exists.
+	ErrSnapshotExists = errors.New("snapshot already exists")
+)
+
+// generationsDir contains the backups of all generations except for the oldest one,
+// which is stored directly in the backup filesystem.
+var generationsDir = filepath.Join(internalDir, "generations")
+
+// generation is the frozen state of a batch of modifications that precede a snapshot.
+type generation struct {
+	// name of the snapshot that was taken after this generation
+	name        string
+	backup      FS
+	baseInfos   *trackedInfos
+	subtrees    int
+	inodes      int
+	backupBytes int64
+	checksums   map[string][]byte
+	// HMAC of the manifest of the generation, nil in case that sealing is disabled, see WithSealing.
+	seal []byte
+}
+
+// Snapshot creates a named snapshot of the current state.
+// All following modifications are backed up in a new generation, which allows
+// to roll back to this snapshot with RollbackTo without reverting the modifications
+// that were made before the snapshot. Rollback and Commit cover all generations.
+// Stats, Changes and Map only describe the modifications since the most recent snapshot.
+func (fsys *BackupFS) Snapshot(name string) (err error) {
+	defer fsys.lock(OpSnapshot)()
+
+	err = fsys.snapshot(name)
+	if err != nil {
+		return err
+	}
+	return fsys.journalOp(OpSnapshot, name)
+}
+
+func (fsys *BackupFS) snapshot(name string) (err error) {
+	if fsys.snapshotIndex(name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshotExists, name)
+	}
+
+	var seal []byte
+	if len(fsys.opts.sealKey) > 0 {
+		seal, err = fsys.seal(fsys.backup, fsys.baseInfos)
+		if err != nil {
+			return fmt.Errorf("failed to seal snapshot: %s: %w", name, err)
+		}
+	}
+
+	backup, err := fsys.generationBackup(len(fsys.generations) + 1)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %s: %w", name, err)
+	}
+
+	fsys.generations = append(fsys.generations, generation{
+		name:        name,
+		backup:      fsys.backup,
+		baseInfos:   fsys.baseInfos,
+		subtrees:    fsys.subtrees,
+		inodes:      fsys.inodes,
+		backupBytes: fsys.backupBytes,
+		checksums:   fsys.checksums,
+		seal:        seal,
+	})
+	fsys.backup = backup
+	fsys.baseInfos = fsys.newTrackedInfos()
+	fsys.subtrees = 0
+	fsys.inodes = 0
+	fsys.backupBytes = 0
+	fsys.peakTracked = 0
+	fsys.checksums = nil
+	return nil
+}
+
+// Snapshots returns the names of all snapshots, oldest first.
+func (fsys *BackupFS) Snapshots() []string {
+	defer fsys.rlockState()()
+
+	names := make([]string, 0, len(fsys.generations))
+	for _, g := range fsys.generations {
+		names = append(names, g.name)
+	}
+	return names
+}
+
+// RollbackTo rolls back all modifications that were made after the named snapshot was created.
+// The snapshot itself is kept, which allows to roll back to it again later on,
+// all newer snapshots are removed.
+func (fsys *BackupFS) RollbackTo(name string) error {
+	defer fsys.lock(OpRollbackTo)()
+
+	idx := fsys.snapshotIndex(name)
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	err := fsys.rollbackGenerations(context.Background(), idx+1)
+	return errors.Join(err, fsys.journalOp(OpRollbackTo, name))
+}
+
+func (fsys *BackupFS) snapshotIndex(name string) int {
+	for idx, g := range fsys.generations {
+		if g.name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// allGenerations returns all generations including the current one, oldest first.
+func (fsys *BackupFS) allGenerations() []generation {
+	generations := make([]generation, 0, len(fsys.generations)+1)
+	generations = append(generations, fsys.generations...)
+	return append(generations, generation{
+		backup:    fsys.backup,
+		baseInfos: fsys.baseInfos,
+		checksums: fsys.checksums,
+	})
+}
+
+// generationBackup creates the backup filesystem of the generation with the given index.
+func (fsys *BackupFS) generationBackup(idx int) (FS, error) {
+	dir := filepath.Join(generationsDir, strconv.Itoa(idx))
+	err := fsys.rootBackup.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return layoutFS(fsys.opts.backupLayout, NewPrefixFS(fsys.rootBackup, dir)), nil
+}
+
+// popGeneration removes the backup of the current generation, which must not track any modifications anymore,
+// and continues with the previous generation.
+func (fsys *BackupFS) popGeneration() error {
+	idx := len(fsys.generations)
+	err := fsys.rootBackup.RemoveAll(filepath.Join(generationsDir, strconv.Itoa(idx)))
+	if err != nil {
+		return fmt.Errorf("failed to remove backup of generation %d: %w", idx, err)
+	}
+	err = fsys.baseInfos.reset()
+	if err != nil {
+		return fmt.Errorf("failed to remove state index of generation %d: %w", idx, err)
+	}
+
+	g := fsys.generations[idx-1]
+	fsys.generations = fsys.generations[:idx-1]
+	fsys.backup = g.backup
+	fsys.baseInfos = g.baseInfos
+	fsys.subtrees = g.subtrees
+	fsys.inodes = g.inodes
+	fsys.backupBytes = g.backupBytes
+	fsys.checksums = g.checksums
+	fsys.peakTracked = g.baseInfos.len()
+
+	if len(fsys.generations) == 0 {
+		// best effort
+		_ = fsys.rootBackup.Remove(generationsDir)
+		fsys.removeInternalDir()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+		createdPath               = filepath.FromSlash("/test/created.txt")
+		upgradePath               = filepath.FromSlash("/test/upgrade.txt")
+	)
+
+	createFile(t, base, filePath, "v0")
+	createFile(t, backupFS, filePath, "v1")
+
+	require.NoError(backupFS.Snapshot("first"))
+	require.ErrorIs(backupFS.Snapshot("first"), ErrSnapshotExists)
+	createFile(t, backupFS, filePath, "v2")
+	createFile(t, backupFS, createdPath, "created")
+
+	require.NoError(backupFS.Snapshot("pre-upgrade"))
+	createFile(t, backupFS, filePath, "v3")
+	createFile(t, backupFS, upgradePath, "upgrade")
+	require.Equal([]string{"first", "pre-upgrade"}, backupFS.Snapshots())
+
+	require.ErrorIs(backupFS.RollbackTo("unknown"), ErrSnapshotNotFound)
+
+	// roll back the upgrade only
+	require.NoError(backupFS.RollbackTo("pre-upgrade"))
+	fileMustContainText(t, base, filePath, "v2")
+	fileMustContainText(t, base, createdPath, "created")
+	mustNotExist(t, base, upgradePath)
+	require.Equal([]string{"first", "pre-upgrade"}, backupFS.Snapshots())
+
+	// the snapshot can be rolled back to again
+	createFile(t, backupFS, upgradePath, "upgrade")
+	require.NoError(backupFS.RollbackTo("pre-upgrade"))
+	mustNotExist(t, base, upgradePath)
+
+	// roll back to an older generation
+	require.NoError(backupFS.RollbackTo("first"))
+	fileMustContainText(t, base, filePath, "v1")
+	mustNotExist(t, base, createdPath)
+	require.Equal([]string{"first"}, backupFS.Snapshots())
+
+	// roll back everything
+	createFile(t, backupFS, filePath, "v2")
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, filePath, "v0")
+	require.Empty(backupFS.Snapshots())
+	mustNotExist(t, backup, generationsDir)
+	mustNotExist(t, backup, filePath)
+}
+
+func TestBackupFS_SnapshotCommit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+	)
+
+	createFile(t, base, filePath, "v0")
+	createFile(t, backupFS, filePath, "v1")
+	require.NoError(backupFS.Snapshot("first"))
+	createFile(t, backupFS, filePath, "v2")
+
+	require.NoError(backupFS.Commit())
+	require.Empty(backupFS.Snapshots())
+	mustNotExist(t, backup, generationsDir)
+	mustNotExist(t, backup, filePath)
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, filePath, "v2")
+}
@@ -0,0 +1,138 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// OSPath returns the path of the named file in the filesystem of the operating system, see OSPather.
+func OSPath(fsys FS, name string) (string, error) {
+	p, ok := fsys.(OSPather)
+	if !ok {
+		return "", &fs.PathError{Op: "ospath", Path: name, Err: errors.ErrUnsupported}
+	}
+	return p.OSPath(name)
+}
+
+// linkBackupFile creates a hard link of the regular file in the backup filesystem instead of copying it,
+// see WithHardlinkBackups. The file must be removed or replaced afterwards without being modified.
+// Returns false in case that the file must be copied instead.
+func (fsys *BackupFS) linkBackupFile(resolvedName string, info fs.FileInfo) (linked bool, err error) {
+	if !fsys.opts.hardlinkBackups {
+		return false, nil
+	}
+	if n, ok := toLinkCount(info); !ok || n != 1 {
+		// the backup would be modified via the other links
+		return false, nil
+	}
+
+	basePath, err := OSPath(fsys.base, resolvedName)
+	if err != nil {
+		return false, nil
+	}
+	backupPath, err := OSPath(fsys.backup, resolvedName)
+	if err != nil {
+		return false, nil
+	}
+
+	err = os.Link(basePath, backupPath)
+	if err != nil {
+		// cross device links, missing privileges or filesystems without hard links
+		fsys.logger().Debug("hard link backup failed, copying file", "path", resolvedName, "error", err)
+		return false, nil
+	}
+
+	if fsys.opts.newHash != nil {
+		sum, err := fsys.hashFile(fsys.backup, resolvedName)
+		if err != nil {
+			// a subsequent copy must not write into the linked file
+			_ = fsys.backup.Remove(resolvedName)
+			return false, err
+		}
+		fsys.setChecksum(resolvedName, sum)
+	}
+	return true, nil
+}
+
+// unlinkBackupFile replaces the hard link of the backup of resolvedName with a copy in case that
+// the base file still exists, because the removal or replacement that it was linked for failed.
+// Otherwise subsequent modifications of the base file would modify its backup as well.
+// A file whose backup cannot be copied is not tracked anymore, so that it is backed up again.
+func (fsys *BackupFS) unlinkBackupFile(resolvedName string) error {
+	if !fsys.opts.hardlinkBackups {
+		return nil
+	}
+
+	baseInfo, err := fsys.base.Lstat(resolvedName)
+	if err != nil || !baseInfo.Mode().IsRegular() {
+		return nil
+	}
+	backupInfo, err := fsys.backup.Lstat(resolvedName)
+	if err != nil || !sameInode(baseInfo, backupInfo) {
+		return nil
+	}
+
+	err = fsys.backup.Remove(resolvedName)
+	if err != nil {
+		return fmt.Errorf("failed to remove hard link of backup: %w", err)
+	}
+
+	sum, err := fsys.copyBackupFile(resolvedName, baseInfo)
+
+	fsys.stateMu.Lock()
+	defer fsys.stateMu.Unlock()
+
+	if err != nil {
+		_ = fsys.backup.Remove(resolvedName)
+		fsys.baseInfos.delete(resolvedName)
+		delete(fsys.checksums, resolvedName)
+		fsys.inodes = countInodes(fsys.baseInfos)
+		fsys.backupBytes = countBackupBytes(fsys.baseInfos)
+		return errors.Join(
+			fmt.Errorf("failed to replace hard link of backup with a copy: %w", err),
+			fsys.journalUntrack(resolvedName),
+		)
+	}
+	fsys.setChecksum(resolvedName, sum)
+	return nil
+}
+
+// unlinkBackupFiles is unlinkBackupFile for multiple files.
+func (fsys *BackupFS) unlinkBackupFiles(resolvedNames []string) (multiErr error) {
+	if !fsys.opts.hardlinkBackups {
+		return nil
+	}
+	for _, resolvedName := range resolvedNames {
+		multiErr = errors.Join(multiErr, fsys.unlinkBackupFile(resolvedName))
+	}
+	return multiErr
+}
+
+// sameInode returns true in case that both file infos describe the same file.
+func sameInode(a, b fs.FileInfo) bool {
+	aDev, aIno, ok := toDevIno(a)
+	if !ok {
+		return false
+	}
+	bDev, bIno, ok := toDevIno(b)
+	return ok && aDev == bDev && aIno == bIno
+}
+
+// hashFile calculates the checksum of the named file, see WithChecksums.
+func (fsys *BackupFS) hashFile(from FS, name string) ([]byte, error) {
+	f, err := from.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := fsys.opts.newHash()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
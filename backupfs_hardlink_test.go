@@ -0,0 +1,95 @@
+package backupfs
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithHardlinkBackups(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithHardlinkBackups(true), WithChecksums(sha256.New))
+		removedPath        = filepath.FromSlash("/test/removed.txt")
+		replacedPath       = filepath.FromSlash("/test/replaced.txt")
+		renamedPath        = filepath.FromSlash("/test/renamed.txt")
+		modifiedPath       = filepath.FromSlash("/test/modified.txt")
+	)
+
+	createFile(t, base, removedPath, "removed")
+	createFile(t, base, replacedPath, "replaced")
+	createFile(t, base, renamedPath, "renamed")
+	createFile(t, base, modifiedPath, "modified")
+
+	inode := func(fsys FS, name string) (dev, ino uint64) {
+		fi, err := fsys.Lstat(name)
+		require.NoError(err)
+		dev, ino, ok := toDevIno(fi)
+		if !ok {
+			t.Skip("inode numbers are not supported")
+		}
+		return dev, ino
+	}
+	removedDev, removedIno := inode(base, removedPath)
+	replacedDev, replacedIno := inode(base, replacedPath)
+	modifiedDev, modifiedIno := inode(base, modifiedPath)
+
+	require.NoError(backupFS.Remove(removedPath))
+	require.NoError(backupFS.Rename(renamedPath, replacedPath))
+	createFile(t, backupFS, modifiedPath, "changed")
+
+	// removed and replaced files are linked
+	dev, ino := inode(backup, removedPath)
+	require.Equal(removedDev, dev)
+	require.Equal(removedIno, ino)
+	dev, ino = inode(backup, replacedPath)
+	require.Equal(replacedDev, dev)
+	require.Equal(replacedIno, ino)
+
+	// files that are modified in place are copied
+	dev, ino = inode(backup, modifiedPath)
+	require.False(dev == modifiedDev && ino == modifiedIno)
+	fileMustContainText(t, backup, modifiedPath, "modified")
+
+	require.Len(backupFS.Checksums(), 4)
+	require.NoError(backupFS.VerifyChecksums(0))
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, removedPath, "removed")
+	fileMustContainText(t, base, replacedPath, "replaced")
+	fileMustContainText(t, base, renamedPath, "renamed")
+	fileMustContainText(t, base, modifiedPath, "modified")
+}
+
+func TestBackupFS_WithHardlinkBackupsFailedRename(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithHardlinkBackups(true))
+		existingPath       = filepath.FromSlash("/existing.txt")
+	)
+	createFile(t, base, existingPath, "original")
+
+	// the file is linked into the backup before the rename fails
+	err := backupFS.Rename(filepath.FromSlash("/missing"), existingPath)
+	require.ErrorIs(err, fs.ErrNotExist)
+
+	f, err := backupFS.OpenFile(existingPath, os.O_WRONLY|os.O_TRUNC, 0644)
+	require.NoError(err)
+	_, err = f.Write([]byte("modified"))
+	require.NoError(err)
+	require.NoError(f.Close())
+	fileMustContainText(t, backup, existingPath, "original")
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, existingPath, "original")
+}
@@ -0,0 +1,492 @@
+package backupfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StateIndex selects where the file infos of the tracked paths are kept, see WithStateIndex.
+type StateIndex int
+
+const (
+	// StateIndexMemory keeps the file infos of all tracked paths in memory.
+	StateIndexMemory StateIndex = iota
+	// StateIndexDisk keeps only the tracked paths, their sizes and file modes in memory.
+	// The modification times and owners are appended to an index file in the internal directory
+	// of the backup filesystem and read back when they are needed, e.g. upon rollback.
+	StateIndexDisk
+)
+
+// stateIndexDir contains the index files of all generations, see StateIndexDisk.
+var stateIndexDir = filepath.Join(internalDir, "index")
+
+// indexRecordSize is the size of a record of the index file, which contains
+// the modification time in seconds and nanoseconds, the owner and the group.
+const indexRecordSize = 8 + 4 + 4 + 4
+
+// trackedKey is the key of a tracked path.
+// The parent directories are interned, so that the paths of large directory trees share the memory
+// of their common prefixes and only keep their base names.
+type trackedKey struct {
+	dir  uint32
+	name string
+}
+
+// infoFlags are the markers of a file info whose metadata is stored in the index file.
+type infoFlags uint8
+
+const (
+	// flagExists is not set in case that the path did not exist
+	flagExists infoFlags = 1 << iota
+	flagOwned
+	flagPlaceholder
+	flagSubtree
+	flagSnapshot
+	flagLinkDir
+)
+
+// indexedEntry is the part of a file info that is kept in memory in case that the index file is used.
+type indexedEntry struct {
+	// offset of the record in the index file
+	off   int64
+	size  int64
+	mode  fs.FileMode
+	flags infoFlags
+}
+
+// trackedInfos contains the file infos of the tracked paths of a generation.
+// The file infos are either kept in memory or in an index file, see StateIndexDisk.
+type trackedInfos struct {
+	// interned parent directories of the tracked paths, see trackedKey
+	dirIDs map[string]uint32
+	dirs   []string
+
+	// file infos of the tracked paths, nil in case that the index file is used
+	infos map[trackedKey]fs.FileInfo
+	// in-memory part of the file infos in case that the index file is used
+	entries map[trackedKey]indexedEntry
+
+	// backup filesystem that contains the index file
+	fsys FS
+	// name of the index file, empty until the first file info is written
+	name string
+	file File
+	size int64
+}
+
+func newTrackedInfos(fsys FS, index StateIndex) *trackedInfos {
+	t := &trackedInfos{
+		dirIDs: make(map[string]uint32),
+	}
+	if index == StateIndexDisk {
+		t.fsys = fsys
+		t.entries = make(map[trackedKey]indexedEntry)
+	} else {
+		t.infos = make(map[trackedKey]fs.FileInfo)
+	}
+	return t
+}
+
+// newTrackedInfos creates the tracked file infos of a new generation, see WithStateIndex.
+func (fsys *BackupFS) newTrackedInfos() *trackedInfos {
+	return newTrackedInfos(fsys.rootBackup, fsys.opts.stateIndex)
+}
+
+func (t *trackedInfos) onDisk() bool {
+	return t.entries != nil
+}
+
+// splitTracked splits the path after its last separator.
+func splitTracked(path string) (dir, name string) {
+	idx := strings.LastIndexByte(path, filepath.Separator)
+	return path[:idx+1], path[idx+1:]
+}
+
+// intern returns the id of the directory and adds it in case that it does not exist yet.
+func (t *trackedInfos) intern(dir string) uint32 {
+	id, found := t.dirIDs[dir]
+	if found {
+		return id
+	}
+	// the directory must not keep the memory of the whole path
+	dir = strings.Clone(dir)
+	id = uint32(len(t.dirs))
+	t.dirIDs[dir] = id
+	t.dirs = append(t.dirs, dir)
+	return id
+}
+
+// key returns the key of path and interns its parent directory.
+func (t *trackedInfos) key(path string) trackedKey {
+	dir, name := splitTracked(path)
+	return trackedKey{dir: t.intern(dir), name: strings.Clone(name)}
+}
+
+// lookup returns the key of a tracked path without interning its parent directory.
+func (t *trackedInfos) lookup(path string) (trackedKey, bool) {
+	dir, name := splitTracked(path)
+	id, found := t.dirIDs[dir]
+	return trackedKey{dir: id, name: name}, found
+}
+
+func (t *trackedInfos) path(k trackedKey) string {
+	return t.dirs[k.dir] + k.name
+}
+
+func (t *trackedInfos) len() int {
+	if t.onDisk() {
+		return len(t.entries)
+	}
+	return len(t.infos)
+}
+
+// get returns the file info of the tracked path.
+// The modification time and owner of file infos that are stored in the index file
+// are read on demand, see load.
+func (t *trackedInfos) get(path string) (fs.FileInfo, bool) {
+	k, found := t.lookup(path)
+	if !found {
+		return nil, false
+	}
+	if !t.onDisk() {
+		info, found := t.infos[k]
+		return info, found
+	}
+	e, found := t.entries[k]
+	if !found {
+		return nil, false
+	}
+	return t.indexedInfo(k, e), true
+}
+
+// info returns the file info of the tracked path, nil in case that the path is not tracked, see get.
+func (t *trackedInfos) info(path string) fs.FileInfo {
+	info, _ := t.get(path)
+	return info
+}
+
+// load is like get but reads the whole file info from the index file.
+func (t *trackedInfos) load(path string) (fs.FileInfo, error) {
+	return loadFileInfo(t.info(path))
+}
+
+// set tracks the file info of path, which replaces the previously tracked file info.
+// The file info is packed, see compactFileInfo.
+func (t *trackedInfos) set(path string, info fs.FileInfo) error {
+	k := t.key(path)
+	if !t.onDisk() {
+		t.infos[k] = compactFileInfo(k.name, info)
+		return nil
+	}
+
+	e, err := t.write(info)
+	if err != nil {
+		return err
+	}
+	t.entries[k] = e
+	return nil
+}
+
+func (t *trackedInfos) delete(path string) {
+	k, found := t.lookup(path)
+	if !found {
+		return
+	}
+	if t.onDisk() {
+		delete(t.entries, k)
+	} else {
+		delete(t.infos, k)
+	}
+}
+
+// each calls fn for every tracked path until fn returns false.
+// Paths may be deleted by fn.
+func (t *trackedInfos) each(fn func(path string, info fs.FileInfo) bool) {
+	if !t.onDisk() {
+		for k, info := range t.infos {
+			if !fn(t.path(k), info) {
+				return
+			}
+		}
+		return
+	}
+	for k, e := range t.entries {
+		if !fn(t.path(k), t.indexedInfo(k, e)) {
+			return
+		}
+	}
+}
+
+// paths returns all tracked paths in arbitrary order.
+func (t *trackedInfos) paths() []string {
+	paths := make([]string, 0, t.len())
+	t.each(func(path string, _ fs.FileInfo) bool {
+		paths = append(paths, path)
+		return true
+	})
+	return paths
+}
+
+// shrink releases the memory of deleted paths and of interned directories that are not used anymore.
+// The records of deleted paths are kept in the index file until it is reset.
+func (t *trackedInfos) shrink() {
+	var (
+		dirIDs = make(map[string]uint32)
+		dirs   = make([]string, 0)
+		intern = func(k trackedKey) trackedKey {
+			dir := t.dirs[k.dir]
+			id, found := dirIDs[dir]
+			if !found {
+				id = uint32(len(dirs))
+				dirIDs[dir] = id
+				dirs = append(dirs, dir)
+			}
+			return trackedKey{dir: id, name: k.name}
+		}
+	)
+
+	if t.onDisk() {
+		entries := make(map[trackedKey]indexedEntry, len(t.entries))
+		for k, e := range t.entries {
+			entries[intern(k)] = e
+		}
+		t.entries = entries
+	} else {
+		infos := make(map[trackedKey]fs.FileInfo, len(t.infos))
+		for k, info := range t.infos {
+			infos[intern(k)] = info
+		}
+		t.infos = infos
+	}
+	t.dirIDs = dirIDs
+	t.dirs = dirs
+}
+
+// reset removes all tracked paths and the index file.
+func (t *trackedInfos) reset() error {
+	t.dirIDs = make(map[string]uint32)
+	t.dirs = nil
+	if !t.onDisk() {
+		t.infos = make(map[trackedKey]fs.FileInfo, 1)
+		return nil
+	}
+
+	t.entries = make(map[trackedKey]indexedEntry, 1)
+	if t.name == "" {
+		return nil
+	}
+
+	var (
+		name = t.name
+		err  = t.file.Close()
+	)
+	t.name = ""
+	t.file = nil
+	t.size = 0
+
+	rerr := t.fsys.Remove(name)
+	if rerr != nil && !isNotFoundError(rerr) {
+		err = errors.Join(err, rerr)
+	}
+	// best effort, the directory is kept in case that other generations use it
+	_ = t.fsys.Remove(stateIndexDir)
+	return err
+}
+
+// write appends the modification time and owner of info to the index file
+// and returns the remaining file info.
+func (t *trackedInfos) write(info fs.FileInfo) (indexedEntry, error) {
+	fi, flags := markersOf(info)
+	if fi == nil {
+		return indexedEntry{}, nil
+	}
+
+	if t.name == "" {
+		err := t.open()
+		if err != nil {
+			return indexedEntry{}, err
+		}
+	}
+
+	var (
+		ci     = compactFileInfo(fi.Name(), fi).(*compactInfo)
+		record [indexRecordSize]byte
+	)
+	binary.LittleEndian.PutUint64(record[0:], uint64(ci.modSec))
+	binary.LittleEndian.PutUint32(record[8:], uint32(ci.modNsec))
+	binary.LittleEndian.PutUint32(record[12:], ci.uid)
+	binary.LittleEndian.PutUint32(record[16:], ci.gid)
+
+	_, err := t.file.WriteAt(record[:], t.size)
+	if err != nil {
+		return indexedEntry{}, err
+	}
+
+	if ci.owned {
+		flags |= flagOwned
+	}
+	e := indexedEntry{off: t.size, size: ci.size, mode: ci.mode, flags: flags}
+	t.size += indexRecordSize
+	return e, nil
+}
+
+func (t *trackedInfos) open() error {
+	err := t.fsys.MkdirAll(stateIndexDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(stateIndexDir, RandomTempName(""))
+	f, err := t.fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	t.name = name
+	t.file = f
+	t.size = 0
+	return nil
+}
+
+func (t *trackedInfos) indexedInfo(k trackedKey, e indexedEntry) fs.FileInfo {
+	if e.flags&flagExists == 0 {
+		return nil
+	}
+	return withMarkers(&indexedInfo{file: t.file, name: k.name, entry: e}, e.flags)
+}
+
+// markersOf returns the file info that is wrapped by markers like placeholders
+// or compacted subtrees and the flags of these markers.
+func markersOf(fi fs.FileInfo) (fs.FileInfo, infoFlags) {
+	switch info := fi.(type) {
+	case nil:
+		return nil, 0
+	case *placeholderInfo:
+		inner, flags := markersOf(info.FileInfo)
+		return inner, flags | flagPlaceholder
+	case *subtreeInfo:
+		inner, flags := markersOf(info.FileInfo)
+		if info.snapshot {
+			flags |= flagSnapshot
+		}
+		return inner, flags | flagSubtree
+	case *dirSymlinkInfo:
+		inner, flags := markersOf(info.FileInfo)
+		return inner, flags | flagLinkDir
+	default:
+		return fi, flagExists
+	}
+}
+
+// withMarkers wraps the file info with the markers of flags, see markersOf.
+func withMarkers(fi fs.FileInfo, flags infoFlags) fs.FileInfo {
+	switch {
+	case flags&flagSubtree != 0:
+		return &subtreeInfo{FileInfo: fi, snapshot: flags&flagSnapshot != 0}
+	case flags&flagPlaceholder != 0:
+		return &placeholderInfo{FileInfo: fi}
+	case flags&flagLinkDir != 0:
+		return &dirSymlinkInfo{FileInfo: fi}
+	default:
+		return fi
+	}
+}
+
+// loadFileInfo reads the modification time and owner of a file info that is stored in the index file.
+// Other file infos are returned as they are.
+func loadFileInfo(fi fs.FileInfo) (fs.FileInfo, error) {
+	inner, flags := markersOf(fi)
+	info, ok := inner.(*indexedInfo)
+	if !ok {
+		return fi, nil
+	}
+	ci, err := info.load()
+	if err != nil {
+		return nil, err
+	}
+	return withMarkers(ci, flags), nil
+}
+
+// indexedInfo is a file info whose modification time and owner are read from the index file on demand.
+// Both are unknown in case that the index file cannot be read, see loadFileInfo.
+type indexedInfo struct {
+	file  File
+	name  string
+	entry indexedEntry
+}
+
+func (fi *indexedInfo) load() (*compactInfo, error) {
+	var record [indexRecordSize]byte
+	_, err := fi.file.ReadAt(record[:], fi.entry.off)
+	if err != nil {
+		return nil, err
+	}
+	return &compactInfo{
+		name:    fi.name,
+		size:    fi.entry.size,
+		modSec:  int64(binary.LittleEndian.Uint64(record[0:])),
+		modNsec: int32(binary.LittleEndian.Uint32(record[8:])),
+		mode:    fi.entry.mode,
+		uid:     binary.LittleEndian.Uint32(record[12:]),
+		gid:     binary.LittleEndian.Uint32(record[16:]),
+		owned:   fi.entry.flags&flagOwned != 0,
+	}, nil
+}
+
+func (fi *indexedInfo) Name() string {
+	return fi.name
+}
+
+func (fi *indexedInfo) Size() int64 {
+	return fi.entry.size
+}
+
+func (fi *indexedInfo) Mode() fs.FileMode {
+	return fi.entry.mode
+}
+
+func (fi *indexedInfo) ModTime() time.Time {
+	ci, err := fi.load()
+	if err != nil {
+		return time.Time{}
+	}
+	return ci.ModTime()
+}
+
+func (fi *indexedInfo) IsDir() bool {
+	return fi.entry.mode.IsDir()
+}
+
+func (fi *indexedInfo) Sys() any {
+	ci, err := fi.load()
+	if err != nil {
+		return nil
+	}
+	return ci.Sys()
+}
+
+// removeStaleIndexFiles removes the index files that do not belong to any generation,
+// e.g. the index files of a previous process whose transaction is continued with LoadState or Recover.
+func (fsys *BackupFS) removeStaleIndexFiles() {
+	entries, err := fsys.rootBackup.ReadDir(stateIndexDir)
+	if err != nil {
+		return
+	}
+
+	used := make(map[string]bool, len(fsys.generations)+1)
+	for _, g := range fsys.allGenerations() {
+		used[g.baseInfos.name] = true
+	}
+	for _, e := range entries {
+		name := filepath.Join(stateIndexDir, e.Name())
+		if !used[name] {
+			// best effort
+			_ = fsys.rootBackup.Remove(name)
+		}
+	}
+	_ = fsys.rootBackup.Remove(stateIndexDir)
+}
@@ -0,0 +1,198 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackedInfos_Interning(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		infos   = newTrackedInfos(nil, StateIndexMemory)
+		base    = NewMemFS()
+		dir     = filepath.FromSlash("/test/dir")
+		paths   = []string{
+			filepath.Join(dir, "a.txt"),
+			filepath.Join(dir, "b.txt"),
+			filepath.Join(dir, "sub"),
+			filepath.Join(dir, "sub", "c.txt"),
+		}
+	)
+	createFile(t, base, paths[0], "a")
+	createFile(t, base, paths[1], "bb")
+	createFile(t, base, paths[3], "c")
+
+	for _, path := range paths {
+		info, err := base.Lstat(path)
+		require.NoError(err)
+		require.NoError(infos.set(path, info))
+	}
+	require.NoError(infos.set(dir, nil))
+
+	// the files in dir share its interned path
+	require.Equal([]string{
+		filepath.FromSlash("/test/dir/"),
+		filepath.FromSlash("/test/dir/sub/"),
+		filepath.FromSlash("/test/"),
+	}, infos.dirs)
+	require.Equal(len(paths)+1, infos.len())
+
+	got := infos.paths()
+	sort.Strings(got)
+	require.Equal(append([]string{dir}, paths...), got)
+
+	fi, found := infos.get(paths[1])
+	require.True(found)
+	require.Equal("b.txt", fi.Name())
+	require.Equal(int64(2), fi.Size())
+	fi, found = infos.get(dir)
+	require.True(found)
+	require.Nil(fi)
+	_, found = infos.get(filepath.FromSlash("/test/dir/missing.txt"))
+	require.False(found)
+	_, found = infos.get(filepath.FromSlash("/missing/a.txt"))
+	require.False(found)
+
+	// directories that do not contain any tracked paths anymore are released
+	infos.delete(paths[3])
+	infos.shrink()
+	require.ElementsMatch([]string{filepath.FromSlash("/test/dir/"), filepath.FromSlash("/test/")}, infos.dirs)
+	fi, found = infos.get(paths[2])
+	require.True(found)
+	require.Equal("sub", fi.Name())
+
+	require.NoError(infos.reset())
+	require.Zero(infos.len())
+	require.Empty(infos.dirs)
+}
+
+func TestBackupFS_WithStateIndex(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require     = require.New(t)
+		base        = NewMemFS()
+		backup      = NewMemFS()
+		backupFS    = NewBackupFS(base, backup, WithStateIndex(StateIndexDisk))
+		filePath    = filepath.FromSlash("/test/file.txt")
+		dirPath     = filepath.FromSlash("/test/dir")
+		symlinkPath = filepath.FromSlash("/test/link")
+		createdPath = filepath.FromSlash("/test/created.txt")
+		modTime     = time.Date(1600, 1, 1, 0, 0, 0, 123, time.UTC)
+	)
+	createFile(t, base, filePath, "original")
+	mkdirAll(t, base, dirPath, 0750)
+	createSymlink(t, base, filePath, symlinkPath)
+	require.NoError(base.Chtimes(filePath, modTime, modTime))
+	baseFSState := createFSState(t, base, "/")
+
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Chmod(dirPath, 0700))
+	removeFile(t, backupFS, symlinkPath)
+	createFile(t, backupFS, createdPath, "created")
+
+	// only the metadata that is required in memory is kept in memory
+	for path, info := range backupFS.Map() {
+		if info != nil {
+			require.IsType(&compactInfo{}, info, path)
+		}
+	}
+	info, found := backupFS.baseInfos.get(filePath)
+	require.True(found)
+	require.IsType(&indexedInfo{}, info)
+	require.True(modTime.Equal(info.ModTime()))
+	mustExist(t, backup, backupFS.baseInfos.name)
+
+	data, err := json.Marshal(backupFS)
+	require.NoError(err)
+	restored := NewBackupFS(base, backup, WithStateIndex(StateIndexDisk))
+	require.NoError(json.Unmarshal(data, restored))
+	require.Equal(backupFS.Stats(), restored.Stats())
+
+	// the index file of the restored state is a different one
+	entries, err := backup.ReadDir(stateIndexDir)
+	require.NoError(err)
+	require.Len(entries, 2)
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseFSState, base, "/")
+	fi, err := base.Lstat(filePath)
+	require.NoError(err)
+	require.True(modTime.Equal(fi.ModTime()), fi.ModTime())
+	fi, err = base.Lstat(dirPath)
+	require.NoError(err)
+	require.Equal(fs.ModeDir|0750, fi.Mode())
+
+	entries, err = backup.ReadDir(stateIndexDir)
+	require.NoError(err)
+	require.Len(entries, 1)
+
+	require.NoError(restored.Commit())
+	mustNotExist(t, backup, internalDir)
+}
+
+func TestBackupFS_WithStateIndexSnapshots(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backup   = NewMemFS()
+		backupFS = NewBackupFS(base, backup, WithStateIndex(StateIndexDisk))
+		filePath = filepath.FromSlash("/test/file.txt")
+	)
+	createFile(t, base, filePath, "original")
+
+	createFile(t, backupFS, filePath, "first")
+	require.NoError(backupFS.Snapshot("first"))
+	createFile(t, backupFS, filePath, "second")
+
+	// every generation has its own index file
+	entries, err := backup.ReadDir(stateIndexDir)
+	require.NoError(err)
+	require.Len(entries, 2)
+
+	require.NoError(backupFS.RollbackTo("first"))
+	fileMustContainText(t, base, filePath, "first")
+	entries, err = backup.ReadDir(stateIndexDir)
+	require.NoError(err)
+	require.Len(entries, 1)
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+	mustNotExist(t, backup, internalDir)
+}
+
+func TestBackupFS_WithStateIndexStaleFiles(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backup   = NewMemFS()
+		opts     = []BackupFSOption{WithStateIndex(StateIndexDisk), WithJournal(true)}
+		backupFS = NewBackupFS(base, backup, opts...)
+		filePath = filepath.FromSlash("/test/file.txt")
+	)
+	createFile(t, base, filePath, "original")
+	createFile(t, backupFS, filePath, "modified")
+	mustExist(t, backup, backupFS.baseInfos.name)
+
+	// e.g. a crash of the process
+	recovered := NewBackupFS(base, backup, opts...)
+	require.NoError(recovered.Recover())
+	mustNotExist(t, backup, backupFS.baseInfos.name)
+	mustExist(t, backup, recovered.baseInfos.name)
+
+	require.NoError(recovered.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+	mustNotExist(t, backup, internalDir)
+}
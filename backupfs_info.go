@@ -0,0 +1,90 @@
+package backupfs
+
+import (
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// compactInfo is the packed representation of a tracked file info.
+// File infos of the os package keep the whole platform specific stat structure,
+// which is the largest part of the internal state when millions of paths are tracked.
+// Only the metadata that is required in order to restore a file is kept, the name
+// shares the memory of the base name of the tracked path, see trackedKey.
+type compactInfo struct {
+	name string
+	size int64
+	// the modification time is kept in seconds and nanoseconds,
+	// as UnixNano cannot represent times before 1678 or after 2262.
+	modSec  int64
+	modNsec int32
+	mode    fs.FileMode
+	uid     uint32
+	gid     uint32
+	// owned is false in case that the owner is unknown
+	owned bool
+}
+
+// compactFileInfo returns the packed representation of the file info of the tracked path.
+// Markers like placeholders or compacted subtrees are kept, only the wrapped file info is packed.
+func compactFileInfo(path string, fi fs.FileInfo) fs.FileInfo {
+	switch info := fi.(type) {
+	case nil:
+		return nil
+	case *compactInfo:
+		return info
+	case *placeholderInfo:
+		return &placeholderInfo{FileInfo: compactFileInfo(path, info.FileInfo)}
+	case *subtreeInfo:
+		return &subtreeInfo{FileInfo: compactFileInfo(path, info.FileInfo), snapshot: info.snapshot}
+	case *dirSymlinkInfo:
+		return &dirSymlinkInfo{FileInfo: compactFileInfo(path, info.FileInfo)}
+	}
+
+	name := fi.Name()
+	if strings.HasSuffix(path, name) {
+		// share the memory of the map key instead of keeping a copy of the name
+		name = path[len(path)-len(name):]
+	}
+	uid, gid := toUID(fi), toGID(fi)
+	modTime := fi.ModTime()
+	return &compactInfo{
+		name:    name,
+		size:    fi.Size(),
+		modSec:  modTime.Unix(),
+		modNsec: int32(modTime.Nanosecond()),
+		mode:    fi.Mode(),
+		uid:     uint32(uid),
+		gid:     uint32(gid),
+		owned:   uid != -1 && gid != -1,
+	}
+}
+
+func (fi *compactInfo) Name() string {
+	return fi.name
+}
+
+func (fi *compactInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi *compactInfo) Mode() fs.FileMode {
+	return fi.mode
+}
+
+func (fi *compactInfo) ModTime() time.Time {
+	return time.Unix(fi.modSec, int64(fi.modNsec))
+}
+
+func (fi *compactInfo) IsDir() bool {
+	return fi.mode.IsDir()
+}
+
+// Sys returns the owner of the file in the platform specific format, see toUID and toGID.
+// Returns nil in case that the owner is unknown.
+func (fi *compactInfo) Sys() any {
+	if !fi.owned {
+		return nil
+	}
+	return toSys(int(fi.uid), int(fi.gid))
+}
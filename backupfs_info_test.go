@@ -0,0 +1,219 @@
+package backupfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactFileInfo(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require             = require.New(t)
+		root, base, _, fsys = NewTestBackupFS("/base", "/backup")
+		filePath            = filepath.FromSlash("/test/file.txt")
+	)
+	createFile(t, base, filePath, "original")
+
+	info, err := base.Lstat(filePath)
+	require.NoError(err)
+
+	compact := compactFileInfo(filePath, info)
+	require.IsType(&compactInfo{}, compact)
+	require.Equal(info.Name(), compact.Name())
+	require.Equal(info.Size(), compact.Size())
+	require.Equal(info.Mode(), compact.Mode())
+	require.Equal(info.IsDir(), compact.IsDir())
+	require.True(info.ModTime().Equal(compact.ModTime()))
+	if CanChown(root) {
+		require.Equal(toUID(info), toUID(compact))
+		require.Equal(toGID(info), toGID(compact))
+	}
+	require.Same(compact, compactFileInfo(filePath, compact))
+
+	// markers are kept
+	require.True(isPlaceholderInfo(compactFileInfo(filePath, &placeholderInfo{FileInfo: info})))
+	require.True(isSnapshotInfo(compactFileInfo(filePath, &subtreeInfo{FileInfo: info, snapshot: true})))
+	require.Nil(compactFileInfo(filePath, nil))
+
+	// file infos without an owner have no system specific information
+	memFS := NewMemFS()
+	createFile(t, memFS, filePath, "original")
+	info, err = memFS.Lstat(filePath)
+	require.NoError(err)
+	if toUID(info) < 0 {
+		require.Nil(compactFileInfo(filePath, info).Sys())
+	}
+
+	// ids that exceed the range of int32 are kept
+	var uid, gid uint32 = 1<<31 + 5, 1<<32 - 2
+	if sys := toSys(int(uid), int(gid)); sys != nil {
+		compact = compactFileInfo(filePath, &sysFileInfo{FileInfo: info, sys: sys})
+		require.NotNil(compact.Sys())
+		require.Equal(uid, uint32(toUID(compact)))
+		require.Equal(gid, uint32(toGID(compact)))
+	}
+
+	// tracked infos are packed
+	createFile(t, fsys, filePath, "modified")
+	for path, info := range fsys.Map() {
+		if info != nil {
+			require.IsType(&compactInfo{}, info, path)
+		}
+	}
+	require.NoError(fsys.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+}
+
+func TestCompactFileInfo_ModTimeOutOfRange(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backup   = NewMemFS()
+		filePath = filepath.FromSlash("/test/file.txt")
+		modTimes = []time.Time{
+			time.Date(1600, 1, 1, 0, 0, 0, 123, time.UTC),
+			time.Date(2300, 1, 1, 0, 0, 0, 456, time.UTC),
+		}
+	)
+	createFile(t, base, filePath, "original")
+
+	info, err := base.Lstat(filePath)
+	require.NoError(err)
+	compact := compactFileInfo(filePath, &modTimeFileInfo{FileInfo: info})
+	require.True(compact.ModTime().IsZero())
+
+	for _, modTime := range modTimes {
+		require.NoError(base.Chtimes(filePath, modTime, modTime))
+		info, err = base.Lstat(filePath)
+		require.NoError(err)
+		require.True(modTime.Equal(compactFileInfo(filePath, info).ModTime()), modTime)
+
+		// UnixNano overflows for these times
+		for _, index := range []StateIndex{StateIndexMemory, StateIndexDisk} {
+			backupFS := NewBackupFS(base, backup, WithStateIndex(index))
+			require.NoError(backupFS.Chmod(filePath, 0600))
+			require.NoError(backupFS.Rollback())
+			info, err = base.Lstat(filePath)
+			require.NoError(err)
+			require.True(modTime.Equal(info.ModTime()), "expected %s, got %s", modTime, info.ModTime())
+		}
+	}
+}
+
+// sysFileInfo replaces the system specific information of a file info.
+type sysFileInfo struct {
+	fs.FileInfo
+	sys any
+}
+
+func (fi *sysFileInfo) Sys() any {
+	return fi.sys
+}
+
+// modTimeFileInfo replaces the modification time of a file info.
+type modTimeFileInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (fi *modTimeFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+
+func BenchmarkCompactFileInfo(b *testing.B) {
+	const n = 100_000
+
+	dir := b.TempDir()
+	f, err := os.Create(filepath.Join(dir, "file.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	_ = f.Close()
+	info, err := os.Lstat(f.Name())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/usr/share/doc/pkg%d/file%d.txt", i/100, i)
+	}
+
+	// os.Lstat allocates a new file info for every path
+	lstat := func(string, fs.FileInfo) fs.FileInfo {
+		fi, err := os.Lstat(f.Name())
+		if err != nil {
+			b.Fatal(err)
+		}
+		return fi
+	}
+
+	for _, bc := range []struct {
+		name    string
+		convert func(path string, fi fs.FileInfo) fs.FileInfo
+	}{
+		{name: "os", convert: lstat},
+		{name: "compact", convert: compactFileInfo},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				m := make(map[string]fs.FileInfo, n)
+				for _, path := range paths {
+					// the map owns its keys like the internal state owns the tracked paths
+					key := strings.Clone(path)
+					m[key] = bc.convert(key, info)
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/n, "bytes/path")
+				runtime.KeepAlive(m)
+			}
+		})
+	}
+
+	for _, bc := range []struct {
+		name  string
+		index StateIndex
+	}{
+		{name: "interned", index: StateIndexMemory},
+		{name: "disk", index: StateIndexDisk},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				infos := newTrackedInfos(NewTempDirPrefixFS(b.TempDir()), bc.index)
+				for _, path := range paths {
+					err := infos.set(filepath.FromSlash(path), info)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/n, "bytes/path")
+				runtime.KeepAlive(infos)
+				_ = infos.reset()
+			}
+		})
+	}
+}
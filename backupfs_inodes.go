@@ -0,0 +1,93 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+var (
+	// ErrInodeQuotaExceeded is returned by modifying operations in case that the backup of a file would exceed
+	// the inode quota of the backup filesystem, see WithInodeQuota.
+	ErrInodeQuotaExceeded = errors.New("backup inode quota exceeded")
+)
+
+// countInodes estimates the number of inodes that the backups of the tracked paths occupy.
+// Compacted subtrees are counted as a single inode, as their content is not tracked.
+func countInodes(infos *trackedInfos) int {
+	cnt := 0
+	infos.each(func(_ string, fi fs.FileInfo) bool {
+		if fi != nil && !isPlaceholderInfo(fi) && !isSnapshotInfo(fi) {
+			cnt++
+		}
+		return true
+	})
+	return cnt
+}
+
+// totalInodes returns the estimated number of inodes of the backups of all generations.
+func (fsys *BackupFS) totalInodes() int {
+	total := fsys.inodes
+	for _, g := range fsys.generations {
+		total += g.inodes
+	}
+	return total
+}
+
+// reserveInode must be called before a file, directory or symlink is created in the backup filesystem.
+// It fails early in case that the inode quota would be exceeded.
+func (fsys *BackupFS) reserveInode() error {
+	quota := fsys.opts.inodeQuota
+	if quota > 0 && fsys.totalInodes() >= quota {
+		return fmt.Errorf("%w: %d inodes", ErrInodeQuotaExceeded, quota)
+	}
+	fsys.inodes++
+	return nil
+}
+
+// releaseInode releases the inode of reserveInode in case that the path has not been backed up.
+func (fsys *BackupFS) releaseInode() {
+	fsys.inodes--
+}
+
+// checkSubtreeQuota fails in case that the backup of the whole directory tree would exceed the inode
+// or byte quota.
+func (fsys *BackupFS) checkSubtreeQuota(resolvedDirPath string) error {
+	var (
+		quota      = fsys.opts.inodeQuota
+		bytesQuota = fsys.opts.backupQuota
+	)
+	if quota <= 0 && bytesQuota <= 0 {
+		return nil
+	}
+
+	var (
+		required      = fsys.totalInodes()
+		requiredBytes = fsys.totalBackupBytes()
+	)
+	err := Walk(fsys.base, resolvedDirPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f := fsys.opts.backupRequiredFunc; f != nil && !info.IsDir() && !f(path, info) {
+			// skipped by the user
+			return nil
+		}
+
+		mode := info.Mode()
+		if mode.IsDir() || mode.IsRegular() || mode&fs.ModeSymlink != 0 {
+			required++
+		}
+		if mode.IsRegular() {
+			requiredBytes += info.Size()
+		}
+		if quota > 0 && required > quota {
+			return fmt.Errorf("%w: %d inodes", ErrInodeQuotaExceeded, quota)
+		}
+		if bytesQuota > 0 && requiredBytes > bytesQuota {
+			return fmt.Errorf("%w: %d bytes", ErrQuotaExceeded, bytesQuota)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,78 @@
+package backupfs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithInodeQuota(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = NewMemFS()
+	)
+	backupFS := NewBackupFS(base, backup, WithInodeQuota(5), WithSubtreeCompaction(true))
+
+	createFile(t, base, "/test/dir/a.txt", "a")
+	createFile(t, base, "/test/dir/b.txt", "b")
+	createFile(t, base, "/test/dir/c.txt", "c")
+	initialState := createFSState(t, base, "/")
+
+	// root, /test, /test/dir and the file
+	createFile(t, backupFS, "/test/dir/a.txt", "modified")
+	require.Equal(4, backupFS.Stats().BackupInodes)
+	require.Equal(5, backupFS.Stats().InodeQuota)
+
+	createFile(t, backupFS, "/test/dir/b.txt", "modified")
+	require.Equal(5, backupFS.Stats().BackupInodes)
+
+	// fails before the base filesystem is modified
+	err := backupFS.Remove("/test/dir/c.txt")
+	require.ErrorIs(err, ErrInodeQuotaExceeded)
+	fileMustContainText(t, base, "/test/dir/c.txt", "c")
+
+	// new files do not require backups
+	createFile(t, backupFS, "/test/dir/d.txt", "d")
+	require.Equal(5, backupFS.Stats().BackupInodes)
+
+	require.NoError(backupFS.Rollback())
+	require.Equal(0, backupFS.Stats().BackupInodes)
+	mustEqualFSState(t, initialState, base, "/")
+
+	// whole subtrees are checked before anything is backed up
+	err = backupFS.RemoveAll("/test")
+	require.ErrorIs(err, ErrInodeQuotaExceeded)
+	fileMustContainText(t, base, "/test/dir/c.txt", "c")
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, initialState, base, "/")
+}
+
+func TestBackupFS_WithInodeQuotaFailedBackup(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = &flakyFS{FS: NewMemFS(), err: syscall.EACCES}
+	)
+	backupFS := NewBackupFS(base, backup, WithInodeQuota(3))
+	createFile(t, base, "/test/file.txt", "original")
+	initialState := createFSState(t, base, "/")
+
+	// the inode of the failed backup is released, the parent directories are backed up
+	backup.failures = 1
+	require.ErrorIs(backupFS.Chmod("/test/file.txt", 0600), syscall.EACCES)
+	require.Equal(2, backupFS.Stats().BackupInodes)
+
+	// root, /test and the file
+	require.NoError(backupFS.Chmod("/test/file.txt", 0600))
+	require.Equal(3, backupFS.Stats().BackupInodes)
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, initialState, base, "/")
+}
@@ -0,0 +1,310 @@
+package backupfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// Isolation is the state of the base filesystem that reads through the BackupFS observe, see WithIsolation.
+type Isolation int
+
+const (
+	// IsolationReadModified reads the current state of the base filesystem including all modifications.
+	IsolationReadModified Isolation = iota
+	// IsolationSnapshot reads the original state of modified paths from their backups
+	// until the modifications are committed or rolled back.
+	// Reads of files whose content has not been backed up fail with ErrContentNotBackedUp, see WithPlaceholders,
+	// reads within directory trees that were backed up with a native snapshot fail with ErrSnapshotUnsupported.
+	IsolationSnapshot
+)
+
+func (i Isolation) String() string {
+	switch i {
+	case IsolationReadModified:
+		return "read_modified"
+	case IsolationSnapshot:
+		return "snapshot"
+	default:
+		return fmt.Sprintf("isolation(%d)", int(i))
+	}
+}
+
+// originalEntry is the state of a path prior to all modifications.
+type originalEntry struct {
+	// tracked is false in case that the path has not been modified, it is read from the base filesystem.
+	tracked bool
+	// info is nil in case that the path did not exist.
+	info fs.FileInfo
+	// backup contains the original content, nil in case that the content has not been backed up.
+	backup FS
+	// subtree is true in case that backup contains the entire original directory tree of the path.
+	subtree bool
+}
+
+// originalState returns the state of resolvedName prior to all modifications.
+// The oldest generation that tracks the path knows its original state.
+func (fsys *BackupFS) originalState(resolvedName string) (originalEntry, error) {
+	for _, g := range fsys.allGenerations() {
+		info, found := g.baseInfos.get(resolvedName)
+		info, err := loadFileInfo(info)
+		if err != nil {
+			return originalEntry{}, err
+		}
+		switch {
+		case found && info == nil:
+			return originalEntry{tracked: true}, nil
+		case found && isSnapshotInfo(info):
+			// only the metadata of the root directory is known
+			return originalEntry{tracked: true, info: info}, nil
+		case found && isPlaceholderInfo(info):
+			return originalEntry{tracked: true, info: info}, nil
+		case found:
+			return originalEntry{tracked: true, info: info, backup: g.backup, subtree: isSubtreeInfo(info)}, nil
+		}
+
+		root, ok := subtreeRootOf(g.baseInfos, resolvedName)
+		if ok {
+			if isSnapshotInfo(g.baseInfos.info(root)) {
+				return originalEntry{}, fmt.Errorf("%w: backed up with a subtree snapshot", ErrSnapshotUnsupported)
+			}
+			// files within compacted subtrees are not tracked individually
+			fi, found, err := lexists(g.backup, resolvedName)
+			if err != nil || !found {
+				return originalEntry{tracked: true}, err
+			}
+			return originalEntry{tracked: true, info: fi, backup: g.backup, subtree: fi.IsDir()}, nil
+		}
+
+		if createdParentOf(g.baseInfos, resolvedName) {
+			return originalEntry{tracked: true}, nil
+		}
+	}
+	return originalEntry{}, nil
+}
+
+// createdParentOf returns true in case that a parent directory of resolvedName did not exist
+// or was not a directory prior to its modification.
+func createdParentOf(baseInfos *trackedInfos, resolvedName string) bool {
+	for dir := filepath.Dir(resolvedName); dir != resolvedName; resolvedName, dir = dir, filepath.Dir(dir) {
+		info, found := baseInfos.get(dir)
+		if found && (info == nil || !info.IsDir()) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotResolver resolves paths in the original state of the base filesystem.
+type snapshotResolver struct {
+	fsys *BackupFS
+}
+
+func (s snapshotResolver) Lstat(name string) (fs.FileInfo, error) {
+	e, err := s.fsys.originalState(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case !e.tracked:
+		return s.fsys.base.Lstat(name)
+	case e.info == nil:
+		return nil, fs.ErrNotExist
+	default:
+		return e.info, nil
+	}
+}
+
+func (s snapshotResolver) Readlink(name string) (string, error) {
+	e, err := s.fsys.originalState(name)
+	switch {
+	case err != nil:
+		return "", err
+	case !e.tracked:
+		return s.fsys.base.Readlink(name)
+	case e.info == nil:
+		return "", fs.ErrNotExist
+	case e.info.Mode()&os.ModeSymlink == 0:
+		return "", syscall.EINVAL
+	default:
+		return e.backup.Readlink(name)
+	}
+}
+
+// snapshotLstat is Lstat in the original state of the base filesystem.
+func (fsys *BackupFS) snapshotLstat(name string) (fs.FileInfo, error) {
+	defer fsys.rlock(OpLstat)()
+
+	_, fi, err := resolvePathWithInfo(snapshotResolver{fsys}, normalizePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if fi == nil {
+		return nil, fs.ErrNotExist
+	}
+	return fi, nil
+}
+
+// snapshotStat is Stat in the original state of the base filesystem.
+func (fsys *BackupFS) snapshotStat(name string) (fs.FileInfo, error) {
+	defer fsys.rlock(OpStat)()
+
+	return statResolved(snapshotResolver{fsys}, name)
+}
+
+// snapshotReadlink is Readlink in the original state of the base filesystem.
+func (fsys *BackupFS) snapshotReadlink(name string) (string, error) {
+	defer fsys.rlock(OpReadlink)()
+
+	resolvedName, fi, err := resolvePathWithInfo(snapshotResolver{fsys}, normalizePath(name))
+	if err != nil {
+		return "", err
+	}
+	if fi == nil {
+		return "", fs.ErrNotExist
+	}
+	return snapshotResolver{fsys}.Readlink(resolvedName)
+}
+
+// snapshotTarget resolves all symlinks of name in the original state of the base filesystem.
+func (fsys *BackupFS) snapshotTarget(name string) (string, originalEntry, error) {
+	r := snapshotResolver{fsys}
+	resolvedName, fi, err := resolvePathWithInfo(r, normalizePath(name))
+	if err != nil {
+		return "", originalEntry{}, err
+	}
+	if fi == nil {
+		return "", originalEntry{}, fs.ErrNotExist
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var found bool
+		resolvedName, found, err = resolveSymlinkTarget(r, resolvedName)
+		if err != nil {
+			return "", originalEntry{}, err
+		}
+		if !found {
+			return "", originalEntry{}, fs.ErrNotExist
+		}
+	}
+
+	e, err := fsys.originalState(resolvedName)
+	if err != nil {
+		return "", originalEntry{}, err
+	}
+	if !e.tracked {
+		e.info, err = fsys.base.Lstat(resolvedName)
+		if err != nil {
+			return "", originalEntry{}, err
+		}
+	}
+	return resolvedName, e, nil
+}
+
+// snapshotReadDir lists the directory entries of name in the original state of the base filesystem.
+func (fsys *BackupFS) snapshotReadDir(name string) ([]fs.DirEntry, error) {
+	defer fsys.rlock(OpReadDir)()
+
+	resolvedName, e, err := fsys.snapshotTarget(name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.info.IsDir() {
+		return nil, syscall.ENOTDIR
+	}
+	infos, err := fsys.snapshotDirInfos(resolvedName, e)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// snapshotDirInfos lists the original directory entries of the resolved directory path sorted by filename.
+func (fsys *BackupFS) snapshotDirInfos(resolvedDirPath string, e originalEntry) ([]fs.FileInfo, error) {
+	switch {
+	case e.subtree:
+		// the backup contains the original directory tree
+		return readDirInfos(e.backup, resolvedDirPath)
+	case isSnapshotInfo(e.info):
+		return nil, fmt.Errorf("%w: backed up with a subtree snapshot", ErrSnapshotUnsupported)
+	}
+
+	infos := make(map[string]fs.FileInfo)
+	if fi, found, err := lexists(fsys.base, resolvedDirPath); err == nil && found && fi.IsDir() {
+		// unmodified entries are listed from the base filesystem
+		current, err := readDirInfos(fsys.base, resolvedDirPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range current {
+			infos[fi.Name()] = fi
+		}
+	}
+
+	// modified entries are replaced with their original state
+	for _, g := range fsys.allGenerations() {
+		for _, path := range g.baseInfos.paths() {
+			if filepath.Dir(path) != resolvedDirPath || path == resolvedDirPath {
+				continue
+			}
+			child, err := fsys.originalState(path)
+			if err != nil {
+				return nil, err
+			}
+			if child.info == nil {
+				delete(infos, filepath.Base(path))
+				continue
+			}
+			infos[filepath.Base(path)] = child.info
+		}
+	}
+
+	result := make([]fs.FileInfo, 0, len(infos))
+	for _, fi := range infos {
+		result = append(result, fi)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+// snapshotOpen opens name for reading in the original state of the base filesystem.
+func (fsys *BackupFS) snapshotOpen(name string) (File, error) {
+	defer fsys.rlock(OpOpen)()
+
+	resolvedName, e, err := fsys.snapshotTarget(name)
+	if err != nil {
+		return nil, err
+	}
+
+	src := fsys.base
+	if e.tracked {
+		if e.backup == nil {
+			if isSnapshotInfo(e.info) {
+				return nil, fmt.Errorf("%w: backed up with a subtree snapshot", ErrSnapshotUnsupported)
+			}
+			return nil, ErrContentNotBackedUp
+		}
+		src = e.backup
+	}
+
+	f, err := src.OpenFile(resolvedName, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !e.info.IsDir() {
+		return f, nil
+	}
+	return newListedDir(f, func() ([]fs.FileInfo, error) {
+		defer fsys.rlock(OpReadDir)()
+
+		return fsys.snapshotDirInfos(resolvedName, e)
+	}), nil
+}
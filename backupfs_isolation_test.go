@@ -0,0 +1,97 @@
+package backupfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_IsolationSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		testIsolationSnapshot(t)
+	})
+	t.Run("subtree compaction", func(t *testing.T) {
+		t.Parallel()
+		testIsolationSnapshot(t, WithSubtreeCompaction(true))
+	})
+}
+
+func testIsolationSnapshot(t *testing.T, opts ...BackupFSOption) {
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backupFS = NewBackupFS(base, NewMemFS(), append(opts, WithIsolation(IsolationSnapshot))...)
+	)
+
+	createFile(t, base, "/test/modified.txt", "original")
+	createFile(t, base, "/test/removed.txt", "removed")
+	createFile(t, base, "/test/dir/nested.txt", "nested")
+	createSymlink(t, base, "/test/modified.txt", "/test/link")
+	require.NoError(base.Chmod("/test/modified.txt", 0644))
+
+	createFile(t, backupFS, "/test/modified.txt", "modified")
+	require.NoError(backupFS.Chmod("/test/modified.txt", 0600))
+	require.NoError(backupFS.Snapshot("first"))
+	require.NoError(backupFS.Remove("/test/removed.txt"))
+	createFile(t, backupFS, "/test/created.txt", "created")
+	require.NoError(backupFS.RemoveAll("/test/dir"))
+	require.NoError(backupFS.Remove("/test/link"))
+	createSymlink(t, backupFS, "/test/created.txt", "/test/link")
+
+	// the base filesystem contains the modifications
+	fileMustContainText(t, base, "/test/modified.txt", "modified")
+
+	// reads observe the original state
+	fileMustContainText(t, backupFS, "/test/modified.txt", "original")
+	fileMustContainText(t, backupFS, "/test/removed.txt", "removed")
+	fileMustContainText(t, backupFS, "/test/dir/nested.txt", "nested")
+	fileMustContainText(t, backupFS, "/test/link", "original")
+
+	fi, err := backupFS.Stat("/test/link")
+	require.NoError(err)
+	require.Equal(fs.FileMode(0644), fi.Mode().Perm())
+	target, err := backupFS.Readlink("/test/link")
+	require.NoError(err)
+	require.Equal("/test/modified.txt", target)
+
+	_, err = backupFS.Lstat("/test/created.txt")
+	require.ErrorIs(err, fs.ErrNotExist)
+	_, err = backupFS.Open("/test/created.txt")
+	require.ErrorIs(err, fs.ErrNotExist)
+
+	entries, err := backupFS.ReadDir("/test")
+	require.NoError(err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.Equal([]string{"dir", "link", "modified.txt", "removed.txt"}, names)
+
+	f, err := backupFS.Open("/test/dir")
+	require.NoError(err)
+	dirNames, err := f.Readdirnames(-1)
+	require.NoError(err)
+	require.Equal([]string{"nested.txt"}, dirNames)
+	require.NoError(f.Close())
+
+	// writes still apply to the current state
+	f, err = backupFS.OpenFile("/test/modified.txt", os.O_WRONLY, 0)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	// committed modifications become visible
+	require.NoError(backupFS.Commit())
+	fileMustContainText(t, backupFS, "/test/modified.txt", "modified")
+	f, err = backupFS.Open("/test/created.txt")
+	require.NoError(err)
+	b, err := io.ReadAll(f)
+	require.NoError(err)
+	require.Equal("created", string(b))
+	require.NoError(f.Close())
+}
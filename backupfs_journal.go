@@ -0,0 +1,233 @@
+package backupfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// journalFile is the path of the journal in the backup filesystem, see WithJournal.
+var journalFile = filepath.Join(internalDir, "journal")
+
+// JournalEntry is a mutating operation that has been recorded in the journal, see WithJournal.
+type JournalEntry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Op   Op        `json:"op"`
+	// Paths are the resolved paths of the base filesystem that are modified by the operation.
+	// The name of the snapshot in case of OpSnapshot and OpRollbackTo.
+	Paths []string `json:"paths"`
+}
+
+// journalRecord is a single line of the journal file.
+// It is either an operation or a change of the tracked state.
+type journalRecord struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+
+	Op    Op       `json:"op,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+
+	// Track is a newly tracked path with its original file info.
+	// Info is nil in case that the path did not exist.
+	Track string `json:"track,omitempty"`
+	Info  *fInfo `json:"info,omitempty"`
+	// Untrack is a path that is not tracked anymore
+	Untrack string `json:"untrack,omitempty"`
+}
+
+// LoadJournal returns all operations that have been recorded in the journal since the last
+// Rollback or Commit. Returns an empty list in case that there is no journal.
+func (fsys *BackupFS) LoadJournal() (_ []JournalEntry, err error) {
+	defer fsys.rlockState()()
+
+	records, err := fsys.readJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]JournalEntry, 0, len(records))
+	for _, r := range records {
+		if r.Op == "" {
+			continue
+		}
+		entries = append(entries, JournalEntry{Seq: r.Seq, Time: r.Time, Op: r.Op, Paths: r.Paths})
+	}
+	return entries, nil
+}
+
+// Recover restores the internal state from the journal, e.g. after a crash of the process
+// that used a BackupFS with the same base and backup filesystem and the same options.
+// Afterwards the recovered modifications can be rolled back, committed or continued.
+// The journal is continued by all following operations.
+func (fsys *BackupFS) Recover() (err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpRecover, journalFile, err)
+		}
+	}()
+
+	defer fsys.lock(OpRecover)()
+
+	records, err := fsys.readJournal()
+	if err != nil {
+		return err
+	}
+
+	err = fsys.baseInfos.reset()
+	if err != nil {
+		return err
+	}
+	fsys.checksums = nil
+	for _, r := range records {
+		fsys.journalSeq = r.Seq
+		switch {
+		case r.Track != "":
+			err = fsys.baseInfos.set(r.Track, fromFInfo(r.Info))
+			if err != nil {
+				return err
+			}
+			fsys.trackSpelling(r.Track)
+		case r.Untrack != "":
+			fsys.baseInfos.delete(r.Untrack)
+		case r.Op == OpSnapshot && len(r.Paths) == 1:
+			fsys.inodes = countInodes(fsys.baseInfos)
+			fsys.backupBytes = countBackupBytes(fsys.baseInfos)
+			err = fsys.snapshot(r.Paths[0])
+			if err != nil {
+				return err
+			}
+		case r.Op == OpRollbackTo && len(r.Paths) == 1:
+			err = fsys.replayRollbackTo(r.Paths[0])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	fsys.subtrees = countSubtrees(fsys.baseInfos)
+	fsys.inodes = countInodes(fsys.baseInfos)
+	fsys.backupBytes = countBackupBytes(fsys.baseInfos)
+	fsys.peakTracked = fsys.baseInfos.len()
+	fsys.removeStaleIndexFiles()
+	return nil
+}
+
+// replayRollbackTo drops all generations newer than the snapshot, which have already been rolled back.
+func (fsys *BackupFS) replayRollbackTo(name string) error {
+	idx := fsys.snapshotIndex(name)
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+
+	for len(fsys.generations) > idx+1 {
+		err := fsys.popGeneration()
+		if err != nil {
+			return err
+		}
+	}
+	return fsys.baseInfos.reset()
+}
+
+func (fsys *BackupFS) readJournal() ([]journalRecord, error) {
+	f, err := fsys.rootBackup.Open(journalFile)
+	if isNotFoundError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]journalRecord, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r journalRecord
+		err = json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			// the last record may be incomplete due to a crash while it was written
+			break
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// journalOp records an operation before it is executed
+func (fsys *BackupFS) journalOp(op Op, paths ...string) error {
+	fsys.stateMu.Lock()
+	defer fsys.stateMu.Unlock()
+
+	return fsys.appendJournal(journalRecord{Op: op, Paths: paths})
+}
+
+// journalTrack records a newly tracked path.
+// The path must only be tracked in case that it has been recorded.
+func (fsys *BackupFS) journalTrack(path string, info fs.FileInfo) error {
+	r := journalRecord{Track: path}
+	if info != nil {
+		r.Info = toFInfo(path, info)
+	}
+	return fsys.appendJournal(r)
+}
+
+// journalUntrack records a path that is not tracked anymore.
+func (fsys *BackupFS) journalUntrack(path string) error {
+	return fsys.appendJournal(journalRecord{Untrack: path})
+}
+
+func (fsys *BackupFS) appendJournal(r journalRecord) (err error) {
+	if !fsys.opts.journal {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to write journal: %w", err)
+		}
+	}()
+
+	fsys.journalSeq++
+	r.Seq = fsys.journalSeq
+	r.Time = fsys.opts.clock.Now()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.rootBackup.MkdirAll(internalDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := fsys.rootBackup.OpenFile(journalFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// removeJournal removes the journal after the transaction has been finished.
+func (fsys *BackupFS) removeJournal() error {
+	if !fsys.opts.journal {
+		return nil
+	}
+
+	err := fsys.rootBackup.Remove(journalFile)
+	if err != nil && !isNotFoundError(err) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
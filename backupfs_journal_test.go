@@ -0,0 +1,138 @@
+package backupfs
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithJournal(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithJournal(true))
+		filePath           = filepath.FromSlash("/test/file.txt")
+		removedPath        = filepath.FromSlash("/test/removed.txt")
+		createdPath        = filepath.FromSlash("/test/created.txt")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, base, removedPath, "removed")
+	before := createFSState(t, base, "/")
+
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Remove(removedPath))
+	require.NoError(backupFS.Snapshot("first"))
+	createFile(t, backupFS, createdPath, "created")
+	require.NoError(backupFS.Chmod(filePath, 0600))
+
+	entries, err := backupFS.LoadJournal()
+	require.NoError(err)
+	ops := make([]Op, 0, len(entries))
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	require.Equal([]Op{OpCreate, OpRemove, OpSnapshot, OpCreate, OpChmod}, ops)
+	require.Equal([]string{"first"}, entries[2].Paths)
+
+	// simulate a crash, a new instance continues the transaction
+	recovered := NewBackupFS(base, backup, WithJournal(true))
+	require.NoError(recovered.Recover())
+	require.Equal(backupFS.Snapshots(), recovered.Snapshots())
+	require.Equal(backupFS.TrackedPaths(), recovered.TrackedPaths())
+
+	require.NoError(recovered.Rollback())
+	mustEqualFSState(t, before, base, "/")
+	mustNotExist(t, backup, journalFile)
+
+	entries, err = recovered.LoadJournal()
+	require.NoError(err)
+	require.Empty(entries)
+}
+
+// journalFailFS fails the writes of journal records that contain the configured field.
+type journalFailFS struct {
+	FS
+
+	mu    sync.Mutex
+	field string
+}
+
+func (f *journalFailFS) failOn(field string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.field = field
+}
+
+func (f *journalFailFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil || name != journalFile {
+		return file, err
+	}
+	return &journalFailFile{File: file, fsys: f}, nil
+}
+
+type journalFailFile struct {
+	File
+	fsys *journalFailFS
+}
+
+func (f *journalFailFile) Write(p []byte) (int, error) {
+	f.fsys.mu.Lock()
+	field := f.fsys.field
+	f.fsys.mu.Unlock()
+
+	if field != "" && bytes.Contains(p, []byte(`"`+field+`":`)) {
+		return 0, syscall.ENOSPC
+	}
+	return f.File.Write(p)
+}
+
+func TestBackupFS_WithJournalWriteFails(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		journal            = &journalFailFS{FS: backup}
+		backupFS           = NewBackupFS(base, journal, WithJournal(true))
+		filePath           = filepath.FromSlash("/test/file.txt")
+		otherPath          = filepath.FromSlash("/other.txt")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, base, otherPath, "other")
+
+	// the backup cannot be journaled, the file must not be modified
+	journal.failOn("track")
+	_, err := backupFS.Create(filePath)
+	require.ErrorIs(err, syscall.ENOSPC)
+	require.True(HasOp(err, OpTryBackup))
+	fileMustContainText(t, base, filePath, "original")
+	require.NotContains(backupFS.TrackedPaths(), filePath)
+
+	journal.failOn("")
+	createFile(t, backupFS, filePath, "modified")
+	require.Contains(backupFS.TrackedPaths(), filePath)
+
+	// the failed untrack is reported by the operation that caused it
+	journal.failOn("untrack")
+	err = backupFS.ForceBackup(filePath)
+	require.ErrorIs(err, syscall.ENOSPC)
+	require.True(HasOp(err, OpTryRemoveBackup))
+
+	journal.failOn("")
+	require.NoError(backupFS.Chmod(otherPath, 0600))
+
+	require.NoError(backupFS.Rollback())
+	// the original backup has been replaced by ForceBackup
+	fileMustContainText(t, base, filePath, "modified")
+	fileMustContainText(t, base, otherPath, "other")
+}
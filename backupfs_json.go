@@ -1,13 +1,177 @@
 package backupfs
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
+	"os/user"
 	"path"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
+// stateVersion is the version of the serialized state, see BackupFS.MarshalJSON.
+//
+//	1: map of paths to file infos
+//	2: versioned envelope, file infos contain owner names, symlink targets and checksums
+const stateVersion = 2
+
+var (
+	// ErrUnsupportedStateVersion is returned in case that a serialized state was written
+	// by a newer version of this package.
+	ErrUnsupportedStateVersion = errors.New("unsupported state version")
+)
+
+// stateEnvelope is the serialized state starting with version 2.
+type stateEnvelope struct {
+	Version int               `json:"version"`
+	Entries map[string]*fInfo `json:"entries"`
+}
+
+// marshalState returns the JSON representation of the tracked file infos of the current generation.
+func (fsys *BackupFS) marshalState() ([]byte, error) {
+	var (
+		entries = make(map[string]*fInfo, fsys.baseInfos.len())
+		names   = newOwnerNames()
+	)
+	for _, path := range fsys.baseInfos.paths() {
+		fi, err := fsys.baseInfos.load(path)
+		if err != nil {
+			return nil, err
+		}
+		entries[path] = fsys.stateEntry(path, fi, names)
+	}
+
+	return json.Marshal(stateEnvelope{Version: stateVersion, Entries: entries})
+}
+
+// stateEntry converts a tracked file info into its serialized form of the current state version.
+func (fsys *BackupFS) stateEntry(path string, fi fs.FileInfo, names *ownerNames) *fInfo {
+	if fi == nil {
+		return nil
+	}
+
+	info := toFInfo(path, fi)
+	info.Owner = names.user(info.FileUid)
+	info.Group = names.group(info.FileGid)
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		// best effort, the symlink is restored from the backup
+		info.Target, _ = fsys.backup.Readlink(path)
+	}
+	info.Checksum = fsys.checksums[path]
+	return info
+}
+
+// unmarshalState parses the JSON representation of marshalState and migrates older versions.
+func unmarshalState(data []byte) (_ map[string]fs.FileInfo, checksums map[string][]byte, err error) {
+	var probe struct {
+		Version *int `json:"version"`
+	}
+	err = json.Unmarshal(data, &probe)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries map[string]*fInfo
+	switch {
+	case probe.Version == nil:
+		// version 1 is a plain map, the key cannot collide, as paths are absolute
+		err = json.Unmarshal(data, &entries)
+	case *probe.Version == stateVersion:
+		var envelope stateEnvelope
+		err = json.Unmarshal(data, &envelope)
+		entries = envelope.Entries
+	default:
+		err = fmt.Errorf("%w: %d", ErrUnsupportedStateVersion, *probe.Version)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := make(map[string]fs.FileInfo, len(entries))
+	for path, info := range entries {
+		checksums = addStateEntry(m, checksums, path, info)
+	}
+	return m, checksums, nil
+}
+
+// addStateEntry adds a deserialized entry to the tracked file infos and its checksum to checksums,
+// which is allocated in case that it is nil.
+func addStateEntry(m map[string]fs.FileInfo, checksums map[string][]byte, path string, info *fInfo) map[string][]byte {
+	if info != nil {
+		info.resolveOwner()
+		if info.Checksum != nil {
+			if checksums == nil {
+				checksums = make(map[string][]byte)
+			}
+			checksums[path] = info.Checksum
+		}
+	}
+	m[path] = fromFInfo(info)
+	return checksums
+}
+
+// ownerNames caches the lookups of user and group names.
+type ownerNames struct {
+	users  map[int]string
+	groups map[int]string
+}
+
+func newOwnerNames() *ownerNames {
+	return &ownerNames{
+		users:  make(map[int]string),
+		groups: make(map[int]string),
+	}
+}
+
+func (o *ownerNames) user(uid int) string {
+	if uid < 0 {
+		return ""
+	}
+	name, found := o.users[uid]
+	if !found {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			name = u.Username
+		}
+		o.users[uid] = name
+	}
+	return name
+}
+
+func (o *ownerNames) group(gid int) string {
+	if gid < 0 {
+		return ""
+	}
+	name, found := o.groups[gid]
+	if !found {
+		if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+			name = g.Name
+		}
+		o.groups[gid] = name
+	}
+	return name
+}
+
 func toFInfo(filePath string, fi fs.FileInfo) *fInfo {
+	if st, ok := fi.(*subtreeInfo); ok {
+		info := toFInfo(filePath, st.FileInfo)
+		info.Subtree = true
+		info.Snapshot = st.snapshot
+		return info
+	}
+	if sl, ok := fi.(*dirSymlinkInfo); ok {
+		info := toFInfo(filePath, sl.FileInfo)
+		info.LinkDir = true
+		return info
+	}
+	if ph, ok := fi.(*placeholderInfo); ok {
+		info := toFInfo(filePath, ph.FileInfo)
+		info.Placeholder = true
+		return info
+	}
+
 	return &fInfo{
 		FileName:    filepath.ToSlash(filePath),
 		FileMode:    uint32(fi.Mode()),
@@ -18,6 +182,24 @@ func toFInfo(filePath string, fi fs.FileInfo) *fInfo {
 	}
 }
 
+// fromFInfo restores the file info that was converted with toFInfo.
+func fromFInfo(fi *fInfo) fs.FileInfo {
+	switch {
+	case fi == nil:
+		// required, otherwise the value cannot be checked whether it's nil or not
+		// due to the additional type information, which is of type *fInfo
+		return nil
+	case fi.Subtree:
+		return &subtreeInfo{FileInfo: fi, snapshot: fi.Snapshot}
+	case fi.Placeholder:
+		return &placeholderInfo{FileInfo: fi}
+	case fi.LinkDir:
+		return &dirSymlinkInfo{FileInfo: fi}
+	default:
+		return fi
+	}
+}
+
 type fInfo struct {
 	FileName    string `json:"name"`
 	FileMode    uint32 `json:"mode"`
@@ -25,6 +207,41 @@ type fInfo struct {
 	FileSize    int64  `json:"size"`
 	FileUid     int    `json:"uid"`
 	FileGid     int    `json:"gid"`
+	// Subtree marks a directory whose entire subtree has been backed up
+	Subtree bool `json:"subtree,omitempty"`
+	// Snapshot marks a subtree that has been backed up with a native filesystem snapshot
+	Snapshot bool `json:"snapshot,omitempty"`
+	// Placeholder marks a file whose content has not been backed up
+	Placeholder bool `json:"placeholder,omitempty"`
+	// LinkDir marks a symlink that pointed to a directory
+	LinkDir bool `json:"link_dir,omitempty"`
+
+	// Owner and Group are the names of FileUid and FileGid, which take precedence
+	// in case that they exist on the host that loads the state.
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Target is the target of a symlink
+	Target string `json:"target,omitempty"`
+	// Checksum is the checksum of the backup, see WithChecksums
+	Checksum []byte `json:"checksum,omitempty"`
+}
+
+// resolveOwner replaces the uid and gid with the ids of the owner names on this host.
+func (fi *fInfo) resolveOwner() {
+	if fi.Owner != "" {
+		if u, err := user.Lookup(fi.Owner); err == nil {
+			if uid, err := strconv.Atoi(u.Uid); err == nil {
+				fi.FileUid = uid
+			}
+		}
+	}
+	if fi.Group != "" {
+		if g, err := user.LookupGroup(fi.Group); err == nil {
+			if gid, err := strconv.Atoi(g.Gid); err == nil {
+				fi.FileGid = gid
+			}
+		}
+	}
 }
 
 func (fi *fInfo) Name() string {
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package backupfs
+
+func toSys(_, _ int) any {
+	return nil
+}
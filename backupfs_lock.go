@@ -0,0 +1,275 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// assert interfaces implemented
+	_ LockMetrics = LockMetricsFunc(nil)
+	_ LockMetrics = (*LockProfile)(nil)
+)
+
+// LockMetrics receives the lock timings of the BackupFS, see WithLockMetrics.
+// Modifications of single paths only wait for operations on the same path or on one of its parent directories,
+// whereas heavy weight operations like Rollback or RemoveAll of large directory trees delay all other operations.
+type LockMetrics interface {
+	// ObserveLock is called after op released the lock with the duration that op waited for the lock
+	// and the duration of the critical section that op executed while it held the lock.
+	// It is called concurrently and must not call any methods of the BackupFS.
+	ObserveLock(op Op, wait, hold time.Duration)
+}
+
+// LockMetricsFunc is a function that implements the LockMetrics interface.
+type LockMetricsFunc func(op Op, wait, hold time.Duration)
+
+func (f LockMetricsFunc) ObserveLock(op Op, wait, hold time.Duration) {
+	f(op, wait, hold)
+}
+
+// lock acquires the exclusive lock of the BackupFS for op and returns the function that releases it.
+// Operations that modify more than a single path or that replace the internal state as a whole,
+// like RemoveAll, Rename or Rollback, block all other operations.
+// RemoveAll is no candidate for path locks, as its progress is reported as a phase of its own
+// and it may compact the tracked paths of its subtree, see WithSubtreeCompaction.
+func (fsys *BackupFS) lock(op Op) (unlock func()) {
+	return fsys.observeLock(op, func() func() {
+		fsys.mu.Lock()
+		return fsys.mu.Unlock
+	})
+}
+
+// rlock acquires the shared lock of the BackupFS for op, which only reads the internal state,
+// see rlockState.
+func (fsys *BackupFS) rlock(op Op) (unlock func()) {
+	return fsys.observeLock(op, fsys.rlockState)
+}
+
+// rlockState acquires the shared locks that allow to read the internal state concurrently to other
+// readers. Modifications of single paths are blocked while they update the internal state, see lockPath.
+func (fsys *BackupFS) rlockState() (unlock func()) {
+	fsys.mu.RLock()
+	fsys.stateMu.RLock()
+	return func() {
+		fsys.stateMu.RUnlock()
+		fsys.mu.RUnlock()
+	}
+}
+
+// lockPath resolves name with resolve and acquires the shared lock of the BackupFS as well as the path locks
+// of the resolved name for op, see pathLocks. Operations on unrelated paths do not block each other.
+// The internal state is guarded by stateMu, which is acquired by the functions that access it.
+//
+// The name is resolved again after the path locks have been acquired, as a concurrent operation
+// may have replaced one of the parent directories in the meantime.
+func (fsys *BackupFS) lockPath(op Op, name string, resolve func(string) (string, error)) (resolvedName string, unlock func(), err error) {
+	unlock = fsys.observeLock(op, func() func() {
+		fsys.mu.RLock()
+		for {
+			resolvedName, err = resolve(name)
+			if err != nil {
+				return fsys.mu.RUnlock
+			}
+
+			unlockPath := fsys.paths.lock(fsys.lockKey(resolvedName))
+			var again string
+			again, err = resolve(name)
+			if err == nil && again == resolvedName {
+				return func() {
+					unlockPath()
+					fsys.mu.RUnlock()
+				}
+			}
+			unlockPath()
+			if err != nil {
+				return fsys.mu.RUnlock
+			}
+		}
+	})
+	if err != nil {
+		unlock()
+		return "", nil, err
+	}
+	return resolvedName, unlock, nil
+}
+
+// observeLock calls acquire and reports the lock timings of op to the LockMetrics, see WithLockMetrics.
+func (fsys *BackupFS) observeLock(op Op, acquire func() (release func())) (unlock func()) {
+	m := fsys.opts.lockMetrics
+	if m == nil {
+		return acquire()
+	}
+
+	clock := fsys.opts.clock
+	start := clock.Now()
+	release := acquire()
+	acquired := clock.Now()
+
+	return func() {
+		hold := clock.Now().Sub(acquired)
+		release()
+		m.ObserveLock(op, acquired.Sub(start), hold)
+	}
+}
+
+// pathLockShards is the number of independently locked partitions of the path locks,
+// which keeps concurrent operations from contending on a single lock table.
+const pathLockShards = 64
+
+// pathLocks are hierarchical locks of resolved paths.
+// An operation locks its path exclusively and all of its parent directories shared, from the root downwards.
+// Operations on unrelated paths run concurrently, whereas an operation on a directory waits
+// for all operations inside of that directory and vice versa.
+type pathLocks struct {
+	shards [pathLockShards]pathLockShard
+}
+
+type pathLockShard struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.RWMutex
+	// number of operations that hold or wait for the lock
+	refs int
+}
+
+// lock locks resolvedName exclusively and its parent directories shared.
+func (l *pathLocks) lock(resolvedName string) (unlock func()) {
+	paths := []string{resolvedName}
+	for dir := filepath.Dir(resolvedName); dir != paths[len(paths)-1]; dir = filepath.Dir(dir) {
+		paths = append(paths, dir)
+	}
+
+	// lock from the root downwards, which prevents deadlocks between operations on the same tree
+	locks := make([]*pathLock, len(paths))
+	for i := len(paths) - 1; i >= 0; i-- {
+		locks[i] = l.acquire(paths[i])
+		if i == 0 {
+			locks[i].Lock()
+		} else {
+			locks[i].RLock()
+		}
+	}
+
+	return func() {
+		for i, pl := range locks {
+			if i == 0 {
+				pl.Unlock()
+			} else {
+				pl.RUnlock()
+			}
+			l.release(paths[i], pl)
+		}
+	}
+}
+
+// shard returns the partition of path based on its FNV-1a hash.
+func (l *pathLocks) shard(path string) *pathLockShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(path); i++ {
+		h ^= uint32(path[i])
+		h *= 16777619
+	}
+	return &l.shards[h%pathLockShards]
+}
+
+func (l *pathLocks) acquire(path string) *pathLock {
+	s := l.shard(path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locks == nil {
+		s.locks = make(map[string]*pathLock)
+	}
+	pl, found := s.locks[path]
+	if !found {
+		pl = &pathLock{}
+		s.locks[path] = pl
+	}
+	pl.refs++
+	return pl
+}
+
+// release removes the lock of path once no operation holds it anymore.
+func (l *pathLocks) release(path string, pl *pathLock) {
+	s := l.shard(path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pl.refs--
+	if pl.refs == 0 {
+		delete(s.locks, path)
+	}
+}
+
+// LockStats are the aggregated lock timings of a single operation.
+type LockStats struct {
+	Op Op
+	// Count is the number of times that the lock was acquired.
+	Count   int
+	WaitSum time.Duration
+	WaitMax time.Duration
+	HoldSum time.Duration
+	HoldMax time.Duration
+}
+
+// NewLockProfile creates LockMetrics that aggregate the lock timings per operation.
+func NewLockProfile() *LockProfile {
+	return &LockProfile{
+		stats: make(map[Op]*LockStats),
+	}
+}
+
+// LockProfile aggregates the lock timings per operation, e.g. in order to quantify lock contention
+// before tuning an application. It is safe for concurrent use.
+type LockProfile struct {
+	mu    sync.Mutex
+	stats map[Op]*LockStats
+}
+
+func (p *LockProfile) ObserveLock(op Op, wait, hold time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, found := p.stats[op]
+	if !found {
+		s = &LockStats{Op: op}
+		p.stats[op] = s
+	}
+	s.Count++
+	s.WaitSum += wait
+	s.WaitMax = max(s.WaitMax, wait)
+	s.HoldSum += hold
+	s.HoldMax = max(s.HoldMax, hold)
+}
+
+// Stats returns the aggregated lock timings of all operations sorted by their total wait time, highest first.
+func (p *LockProfile) Stats() []LockStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]LockStats, 0, len(p.stats))
+	for _, s := range p.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].WaitSum != stats[j].WaitSum {
+			return stats[i].WaitSum > stats[j].WaitSum
+		}
+		return stats[i].Op < stats[j].Op
+	})
+	return stats
+}
+
+// Reset discards all aggregated lock timings.
+func (p *LockProfile) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	clear(p.stats)
+}
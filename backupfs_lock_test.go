@@ -0,0 +1,234 @@
+package backupfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_LockMetrics(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		clock   = NewManualClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+		profile = NewLockProfile()
+	)
+	backupFS := NewBackupFS(base, NewMemFS(), WithClock(clock), WithLockMetrics(profile))
+	createFile(t, base, "/test/file.txt", "original")
+
+	// every call to Now advances the clock by one second,
+	// which makes the wait time of every lock acquisition exactly one second
+	clock.SetStep(time.Second)
+	require.NoError(backupFS.Chmod("/test/file.txt", 0600))
+	require.NoError(backupFS.Chmod("/test/file.txt", 0644))
+	require.NoError(backupFS.Rollback())
+	clock.SetStep(0)
+
+	stats := profile.Stats()
+	require.Len(stats, 2)
+	require.Equal(OpChmod, stats[0].Op)
+	require.Equal(2, stats[0].Count)
+	require.Equal(2*time.Second, stats[0].WaitSum)
+	require.Equal(time.Second, stats[0].WaitMax)
+	require.GreaterOrEqual(stats[0].HoldMax, time.Second)
+	require.Equal(OpRollback, stats[1].Op)
+	require.Equal(1, stats[1].Count)
+
+	profile.Reset()
+	require.Empty(profile.Stats())
+
+	// concurrent operations report their timings concurrently
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		count int
+	)
+	backupFS = NewBackupFS(base, NewMemFS(), WithLockMetrics(LockMetricsFunc(func(op Op, wait, hold time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+	})))
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(backupFS.Chtimes("/test/file.txt", time.Now(), time.Now()))
+		}()
+	}
+	wg.Wait()
+	require.Equal(10, count)
+}
+
+type blockingChmodFS struct {
+	FS
+	name    string
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingChmodFS) Chmod(name string, mode fs.FileMode) error {
+	if name == b.name {
+		close(b.entered)
+		<-b.release
+	}
+	return b.FS.Chmod(name, mode)
+}
+
+func TestBackupFS_LockPath(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		slowDir  = filepath.FromSlash("/slow")
+		slowPath = filepath.FromSlash("/slow/file.txt")
+		fastPath = filepath.FromSlash("/fast/file.txt")
+		newPath  = filepath.FromSlash("/fast/new.txt")
+	)
+	createFile(t, base, slowPath, "slow")
+	createFile(t, base, fastPath, "fast")
+
+	blocking := &blockingChmodFS{
+		FS:      base,
+		name:    slowPath,
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	backupFS := NewBackupFS(blocking, NewMemFS())
+
+	slowDone := make(chan error, 1)
+	go func() {
+		slowDone <- backupFS.Chmod(slowPath, 0600)
+	}()
+	<-blocking.entered
+
+	// modifications of unrelated paths and readers of the internal state do not wait
+	require.NoError(backupFS.Chmod(fastPath, 0600))
+	createFile(t, backupFS, newPath, "new")
+	m := backupFS.Map()
+	require.Contains(m, slowPath)
+	require.Contains(m, fastPath)
+	require.Contains(m, newPath)
+
+	// modifications of the parent directory wait for the modification inside of it
+	dirDone := make(chan error, 1)
+	go func() {
+		dirDone <- backupFS.Chmod(slowDir, 0700)
+	}()
+	select {
+	case err := <-dirDone:
+		require.FailNow("parent directory was modified concurrently", "error: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(blocking.release)
+	require.NoError(<-slowDone)
+	require.NoError(<-dirDone)
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, slowPath, "slow")
+	fileMustContainText(t, base, fastPath, "fast")
+	mustNotExist(t, base, newPath)
+	for _, path := range []string{slowDir, slowPath, fastPath} {
+		fi, err := base.Lstat(path)
+		require.NoError(err)
+		require.NotEqual(fs.FileMode(0600), fi.Mode().Perm(), path)
+		require.NotEqual(fs.FileMode(0700), fi.Mode().Perm(), path)
+	}
+}
+
+func TestBackupFS_ConcurrentModifications(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		workers = 8
+		files   = 20
+	)
+	for w := 0; w < workers; w++ {
+		for f := 0; f < files; f++ {
+			createFile(t, base, fmt.Sprintf("/dir%d/file%d.txt", w, f), "original")
+		}
+	}
+
+	backupFS := NewBackupFS(base, NewMemFS(), WithChecksums(sha256.New))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for f := 0; f < files; f++ {
+				name := fmt.Sprintf("/dir%d/file%d.txt", w, f)
+				switch f % 3 {
+				case 0:
+					require.NoError(backupFS.Remove(name))
+				case 1:
+					require.NoError(backupFS.Truncate(name, 0))
+				default:
+					file, err := backupFS.Create(name)
+					require.NoError(err)
+					_, err = file.Write([]byte("modified"))
+					require.NoError(err)
+					require.NoError(file.Close())
+				}
+				_ = backupFS.Stats()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	require.Len(backupFS.Map(), 1+workers+workers*files)
+	require.NoError(backupFS.Rollback())
+	for w := 0; w < workers; w++ {
+		for f := 0; f < files; f++ {
+			fileMustContainText(t, base, fmt.Sprintf("/dir%d/file%d.txt", w, f), "original")
+		}
+	}
+}
+
+func TestBackupFS_ConcurrentMkdirAll(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		workers = 8
+	)
+	createFile(t, base, "/usr/share/existing.txt", "original")
+	backupFS := NewBackupFS(base, NewMemFS())
+
+	// installers create sibling trees below shared missing parent directories
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			dir := fmt.Sprintf("/usr/share/pkg/lib%d/bin", w)
+			require.NoError(backupFS.MkdirAll(dir, 0755))
+			file, err := backupFS.Create(filepath.Join(dir, "tool"))
+			require.NoError(err)
+			require.NoError(file.Close())
+			require.NoError(backupFS.Chmod(filepath.Join(dir, "tool"), 0755))
+		}(w)
+	}
+	wg.Wait()
+
+	// all path locks are released
+	for i := range backupFS.paths.shards {
+		require.Empty(backupFS.paths.shards[i].locks)
+	}
+
+	require.NoError(backupFS.Rollback())
+	mustNotExist(t, base, "/usr/share/pkg")
+	fileMustContainText(t, base, "/usr/share/existing.txt", "original")
+}
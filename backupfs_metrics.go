@@ -0,0 +1,129 @@
+package backupfs
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// assert interfaces implemented
+	_ Metrics = (*CounterMetrics)(nil)
+)
+
+// Metrics receives the instrumentation of the BackupFS, see WithMetrics.
+// The methods are called while the BackupFS is locked, which is why they must be fast
+// and must not call any methods of the BackupFS. Implementations that are shared by
+// multiple BackupFS instances must be safe for concurrent use.
+type Metrics interface {
+	// ObserveBackup is called after a path has been backed up.
+	// bytes is the size of backed up regular files, zero for directories and symlinks.
+	ObserveBackup(bytes int64)
+	// ObserveRollbackError is called for every classified failure of a rollback.
+	ObserveRollbackError(code RollbackErrorCode)
+	// ObserveLookup is called whenever the BackupFS decides whether a path needs to be backed up.
+	// hit is true in case that the path was already tracked, which makes the backup unnecessary.
+	ObserveLookup(hit bool)
+}
+
+// MetricsCounters are the accumulated counters of CounterMetrics.
+type MetricsCounters struct {
+	BackedUp       int64                       `json:"backed_up"`
+	BytesCopied    int64                       `json:"bytes_copied"`
+	RollbackErrors map[RollbackErrorCode]int64 `json:"rollback_errors,omitempty"`
+	LookupHits     int64                       `json:"lookup_hits"`
+	LookupMisses   int64                       `json:"lookup_misses"`
+}
+
+// NewCounterMetrics creates Metrics that accumulate counters which can be exported in the
+// Prometheus text format, see CounterMetrics.WritePrometheus.
+func NewCounterMetrics() *CounterMetrics {
+	return &CounterMetrics{
+		c: MetricsCounters{
+			RollbackErrors: make(map[RollbackErrorCode]int64),
+		},
+	}
+}
+
+// CounterMetrics accumulates the Metrics of one or multiple BackupFS instances.
+// It is safe for concurrent use. The counters can be exposed to a Prometheus scraper without any
+// dependency on a Prometheus client library, see backupfshttp.NewMetricsHandler.
+type CounterMetrics struct {
+	mu sync.Mutex
+	c  MetricsCounters
+}
+
+func (m *CounterMetrics) ObserveBackup(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.c.BackedUp++
+	m.c.BytesCopied += bytes
+}
+
+func (m *CounterMetrics) ObserveRollbackError(code RollbackErrorCode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.c.RollbackErrors[code]++
+}
+
+func (m *CounterMetrics) ObserveLookup(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hit {
+		m.c.LookupHits++
+	} else {
+		m.c.LookupMisses++
+	}
+}
+
+// Counters returns a copy of the accumulated counters.
+func (m *CounterMetrics) Counters() MetricsCounters {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.c
+	c.RollbackErrors = make(map[RollbackErrorCode]int64, len(m.c.RollbackErrors))
+	for code, n := range m.c.RollbackErrors {
+		c.RollbackErrors[code] = n
+	}
+	return c
+}
+
+// WritePrometheus writes the counters in the Prometheus text exposition format to w.
+func (m *CounterMetrics) WritePrometheus(w io.Writer) error {
+	c := m.Counters()
+
+	codes := make([]string, 0, len(c.RollbackErrors))
+	for code := range c.RollbackErrors {
+		codes = append(codes, string(code))
+	}
+	sort.Strings(codes)
+
+	var sb strings.Builder
+	writeCounter := func(name, help string, values ...string) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, v := range values {
+			fmt.Fprintf(&sb, "%s%s\n", name, v)
+		}
+	}
+	writeCounter("backupfs_backed_up_total", "Number of backed up paths.", fmt.Sprintf(" %d", c.BackedUp))
+	writeCounter("backupfs_copied_bytes_total", "Number of bytes of backed up regular files.", fmt.Sprintf(" %d", c.BytesCopied))
+
+	errs := make([]string, 0, len(codes))
+	for _, code := range codes {
+		errs = append(errs, fmt.Sprintf("{code=%q} %d", code, c.RollbackErrors[RollbackErrorCode(code)]))
+	}
+	writeCounter("backupfs_rollback_errors_total", "Number of failed paths of rollbacks by error code.", errs...)
+	writeCounter("backupfs_lookups_total", "Number of backup decisions by whether the path was already tracked.",
+		fmt.Sprintf("{result=\"hit\"} %d", c.LookupHits),
+		fmt.Sprintf("{result=\"miss\"} %d", c.LookupMisses),
+	)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
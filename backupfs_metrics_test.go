@@ -0,0 +1,44 @@
+package backupfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithMetrics(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backup   = NewMemFS()
+		metrics  = NewCounterMetrics()
+		backupFS = NewBackupFS(base, backup, WithMetrics(metrics))
+	)
+
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, backupFS, "/test/file.txt", "modified")
+	createFile(t, backupFS, "/test/file.txt", "modified again")
+
+	c := metrics.Counters()
+	// root, directory and file
+	require.Equal(int64(3), c.BackedUp)
+	require.Equal(int64(len("original")), c.BytesCopied)
+	require.Positive(c.LookupHits)
+	require.Positive(c.LookupMisses)
+
+	// the backup of the file is missing
+	require.NoError(backup.Remove("/test/file.txt"))
+	require.Error(backupFS.Rollback())
+	require.Equal(int64(1), metrics.Counters().RollbackErrors[CodeBackupMissing])
+
+	var sb strings.Builder
+	require.NoError(metrics.WritePrometheus(&sb))
+	out := sb.String()
+	require.Contains(out, "# TYPE backupfs_backed_up_total counter\nbackupfs_backed_up_total 3\n")
+	require.Contains(out, "backupfs_copied_bytes_total 8\n")
+	require.Contains(out, `backupfs_rollback_errors_total{code="BackupMissing"} 1`)
+	require.Contains(out, `backupfs_lookups_total{result="hit"}`)
+}
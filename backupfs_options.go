@@ -1,3 +1,575 @@
 package backupfs
 
-type backupFSOptions struct{}
+import (
+	"bytes"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"time"
+)
+
+type backupFSOptions struct {
+	// disableChown skips the ownership restoration of backed up and restored
+	// files, directories and symlinks.
+	disableChown bool
+
+	// bufferSize is the size of the buffer that is used in order to copy file contents
+	// from one filesystem to another. A value <= 0 uses the io.Copy default.
+	bufferSize int
+
+	// handleTracking enables the tracking of open file handles
+	handleTracking bool
+	// handleTrackingDebug additionally records the stack traces of opened file handles
+	handleTrackingDebug bool
+
+	// subtreeCompaction tracks the backup of entirely removed directory trees
+	// with a single entry.
+	subtreeCompaction bool
+
+	// backupRequiredFunc allows to skip backups of files
+	backupRequiredFunc BackupRequiredFunc
+
+	// snapshotProvider is used as fallback source for backups
+	// in case that files cannot be opened directly
+	snapshotProvider SnapshotProvider
+
+	// subtreeSnapshotter backs up directory trees that are removed as a whole
+	// with native filesystem snapshots
+	subtreeSnapshotter SubtreeSnapshotter
+
+	// clock provides all time stamps that are created by the BackupFS
+	clock Clock
+
+	// symlinkValidation checks the targets of restored symlinks after a rollback
+	symlinkValidation bool
+
+	// backupLayout is the storage layout of the backup filesystem
+	backupLayout BackupLayout
+
+	// placeholderSize is the size in bytes above which only the metadata of files is backed up.
+	// A value <= 0 backs up the content of all files.
+	placeholderSize int64
+	// placeholderTruncate truncates restored placeholders to their recorded size
+	placeholderTruncate bool
+
+	// maxBackupFileSize is the size in bytes above which the largeFileStrategy is applied
+	maxBackupFileSize int64
+	largeFileStrategy LargeFileStrategy
+
+	// junctionFallback restores directory symlinks as junctions in case that
+	// symlink privileges are missing
+	junctionFallback bool
+
+	// dryRun records write operations instead of executing them
+	dryRun bool
+
+	// backupUmask is removed from the mode of directories that are created in the backup filesystem
+	backupUmask fs.FileMode
+
+	// journal records all mutating operations in a journal file in the backup filesystem
+	journal bool
+
+	// newHash creates the hash of the backup checksums, nil disables checksums
+	newHash func() hash.Hash
+	// inPlaceRestore overwrites files upon rollback instead of renaming a restored temporary file into place
+	inPlaceRestore bool
+	// rollbackVerification skips the restoration of backups that do not match their checksums
+	rollbackVerification bool
+	// hardlinkBackups links removed and replaced files into the backup instead of copying them
+	hardlinkBackups bool
+	// reflink clones files instead of copying their content
+	reflink ReflinkMode
+	// stateEncoding is the encoding of SaveState and WriteState
+	stateEncoding StateEncoding
+	// stateIndex selects where the file infos of the tracked paths are kept
+	stateIndex StateIndex
+
+	// readTracking records the paths of read operations
+	readTracking bool
+
+	// backupWorkers is the number of goroutines that back up the files of a removed directory tree.
+	// A value <= 1 backs up one file after another.
+	backupWorkers int
+
+	// trashRetention is the duration that removed files are kept in the trash after a Commit.
+	// A value <= 0 disables the trash.
+	trashRetention time.Duration
+
+	// sealKey is the HMAC key of the generation seals, nil disables sealing
+	sealKey []byte
+
+	// progressWriter receives the rollback progress as newline delimited JSON
+	progressWriter io.Writer
+
+	// progressFunc is called for every backed up, removed and restored path
+	progressFunc func(Progress)
+
+	// metrics receives the instrumentation of backups, rollbacks and lookups, nil disables it
+	metrics Metrics
+
+	// pathResolver replaces the resolution of the symlinks of parent directories, nil uses ResolvePath
+	pathResolver PathResolver
+
+	// caseInsensitive tracks different spellings of a path as the same path
+	caseInsensitive bool
+	// unicodeForm tracks paths in different Unicode normal forms as the same path
+	unicodeForm UnicodeForm
+
+	// logger receives the debug logs of backup decisions, path resolutions and rollback steps,
+	// nil uses the default logger of the slog package
+	logger *slog.Logger
+
+	// watchdogFunc receives the result of rollbacks that were triggered by the watchdog
+	watchdogFunc WatchdogFunc
+
+	// inodeQuota is the maximum number of files, directories and symlinks in the backup filesystem.
+	// A value <= 0 disables the quota.
+	inodeQuota int
+
+	// backupQuota is the maximum number of bytes of backed up files in the backup filesystem.
+	// A value <= 0 disables the quota.
+	backupQuota int64
+
+	// isolation configures the state that is observed by reads
+	isolation Isolation
+
+	// lockMetrics receives the lock timings of all operations
+	lockMetrics LockMetrics
+
+	// retryAttempts is the maximum number of attempts of single copy and remove operations.
+	// A value <= 1 does not retry.
+	retryAttempts int
+	// retryBackoff is the wait time before the first retry, it doubles with every further retry.
+	retryBackoff time.Duration
+}
+
+// BackupRequiredFunc decides whether an existing file or symlink that has not been backed up yet
+// needs to be backed up before it is modified.
+// resolvedName is the path of the file in the base filesystem with all of its parent directory
+// symlinks resolved. info is the Lstat result of the file.
+type BackupRequiredFunc func(resolvedName string, info fs.FileInfo) bool
+
+// WithDisableChown allows to disable the ownership (uid/gid) restoration of
+// backed up and restored files, directories and symlinks.
+// This may be required in environments where chown is not permitted at all.
+func WithDisableChown(disable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.disableChown = disable
+	}
+}
+
+// WithBufferSize sets the size of the buffer that is used in order to copy file contents
+// between the base and the backup filesystem.
+// A size <= 0 falls back to the default buffer size of io.Copy.
+func WithBufferSize(size int) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.bufferSize = size
+	}
+}
+
+// WithHandleTracking enables the tracking of file handles that are returned by the BackupFS
+// and that have not yet been closed. See BackupFS.OpenHandles.
+// In debug mode the stack trace of the opening call is recorded for every file handle.
+func WithHandleTracking(debug bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.handleTracking = true
+		o.handleTrackingDebug = debug
+	}
+}
+
+// WithSubtreeCompaction enables the compact tracking of directory trees that are removed
+// as a whole with RemoveAll. Instead of keeping track of every single file of the removed tree,
+// a single entry marks the entire subtree as backed up.
+// Upon rollback the subtree is restored as a whole from the backup filesystem.
+// This drastically reduces the memory footprint and the size of the serialized state
+// when huge directory trees are removed.
+func WithSubtreeCompaction(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.subtreeCompaction = enable
+	}
+}
+
+// WithBackupRequiredFunc allows to skip unnecessary backups of well known volatile files, e.g. files
+// whose modification time is older than a specific point in time or files whose path matches a cache list.
+// Files that are skipped are not tracked, so they are neither restored nor removed upon rollback.
+// Directories are always backed up, as they are required as parent directories of other backups.
+func WithBackupRequiredFunc(f BackupRequiredFunc) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.backupRequiredFunc = f
+	}
+}
+
+// WithSnapshotFallback configures a snapshot provider that is used as source for backups of files
+// that cannot be opened directly in the base filesystem, e.g. because they are locked by other processes.
+// See the vss package for a Windows Volume Shadow Copy Service based implementation.
+func WithSnapshotFallback(p SnapshotProvider) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.snapshotProvider = p
+	}
+}
+
+// WithSubtreeSnapshots delegates the backup of directory trees that are removed as a whole
+// with RemoveAll to native snapshots of the base filesystem. This implies WithSubtreeCompaction.
+// In case that the snapshotter does not support a directory tree, its files are copied instead.
+// Snapshots are taken of the whole directory tree, so files are not filtered by WithBackupRequiredFunc.
+func WithSubtreeSnapshots(s SubtreeSnapshotter) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.subtreeSnapshotter = s
+	}
+}
+
+// WithClock configures the clock that provides all time stamps that are created by the BackupFS,
+// e.g. the time stamps of rollback reports and open file handles.
+// A deterministic clock like ManualClock allows for reproducible tests.
+func WithClock(c Clock) BackupFSOption {
+	return func(o *backupFSOptions) {
+		if c == nil {
+			c = SystemClock()
+		}
+		o.clock = c
+	}
+}
+
+// WithSymlinkValidation enables a validation pass after the rollback that checks whether the targets
+// of restored symlinks exist. Targets may have been removed legitimately outside of the BackupFS.
+// Dangling symlinks do not fail the rollback, they are reported as warnings of the RollbackReport.
+func WithSymlinkValidation(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.symlinkValidation = enable
+	}
+}
+
+// WithBackupLayout selects the storage layout of the backup filesystem.
+// LayoutHashed stores the backups in a flat hash based store, which prevents very long paths
+// from exceeding the path length limits of the backup volume, see HashedLayoutFS.
+// LayoutDedup stores identical file contents only once, which keeps repeatedly backed up files small, see DedupFS.
+// The layout is transparent to Rollback, but it must not change between
+// a BackupFS instance and one that continues its transaction from a saved state.
+func WithBackupLayout(layout BackupLayout) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.backupLayout = layout
+	}
+}
+
+// WithPlaceholders backs up only the metadata of regular files that are larger than maxSize bytes.
+// Upon rollback the metadata of such files is restored and files that do not exist anymore are recreated empty.
+// In case that truncate is true, the files are additionally truncated or extended with zeros to their recorded size.
+// Their content cannot be restored, which is reported with the code CodeContentNotRestored.
+// A maxSize <= 0 disables placeholders. Directory trees that are backed up as a whole, see WithSubtreeCompaction,
+// are always backed up with their content.
+func WithPlaceholders(maxSize int64, truncate bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.placeholderSize = maxSize
+		o.placeholderTruncate = truncate
+	}
+}
+
+// WithMaxBackupFileSize applies the strategy to regular files that are larger than maxSize bytes
+// and would need to be backed up: their metadata is backed up without their content (LargeFileMetadataOnly),
+// they are not backed up at all (LargeFileSkip) or their modification fails (LargeFileFail).
+// A maxSize <= 0 disables the limit.
+func WithMaxBackupFileSize(maxSize int64, strategy LargeFileStrategy) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.maxBackupFileSize = maxSize
+		o.largeFileStrategy = strategy
+	}
+}
+
+// WithJunctionFallback restores directory symlinks as directory junctions in case that the creation of
+// symlinks fails due to missing privileges on Windows, e.g. when the Developer Mode is disabled.
+// Junctions behave like directory symlinks, but they always point to absolute paths and are reported
+// as irregular files by Lstat. This option has no effect on other operating systems.
+func WithJunctionFallback(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.junctionFallback = enable
+	}
+}
+
+// WithDryRun records all write operations in a plan instead of executing them, see BackupFS.Plan.
+// Neither the base nor the backup filesystem are modified. Files that are opened for writing
+// are backed by in-memory scratch files whose content is discarded.
+// Read operations are executed against the unmodified base filesystem.
+func WithDryRun(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.dryRun = enable
+	}
+}
+
+// WithChecksums calculates a checksum of every backed up file with the given hash, e.g. sha256.New.
+// Any hash implementation can be plugged in, e.g. xxhash or blake3.
+// The checksum is calculated while the file is copied, so the file is not read twice.
+// See BackupFS.Checksums and BackupFS.VerifyChecksums.
+func WithChecksums(newHash func() hash.Hash) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.newHash = newHash
+	}
+}
+
+// WithAtomicRestore configures how files are restored upon rollback. By default the content of a file
+// is restored into a temporary file next to it, which is then renamed into place, so that a crash during the rollback
+// never leaves a partially restored file behind. Disabling it overwrites the files in place, which is required
+// for filesystems that cannot rename a file onto an existing file and which keeps hard links of the restored files intact.
+func WithAtomicRestore(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.inPlaceRestore = !enable
+	}
+}
+
+// WithHardlinkBackups creates hard links of files that are removed or replaced by a rename in the backup filesystem
+// instead of copying their content, which makes backups of large files almost free. Files are still copied in case that
+// base and backup filesystem reside on different devices, do not implement OSPather, or the file has further hard links,
+// as well as for all operations that modify a file in place, e.g. writes or chmod, which would modify the linked backup as well.
+// Processes that modify a removed file via a handle that they opened before the removal modify its backup as well.
+func WithHardlinkBackups(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.hardlinkBackups = enable
+	}
+}
+
+// WithReflink clones files upon backup and rollback instead of copying their content, which makes copies of
+// large files almost instant on copy on write filesystems like btrfs or XFS. Cloning requires that both, the base and
+// the backup filesystem, are backed by files of the operating system on the same filesystem and is currently only
+// supported on Linux. ReflinkAuto falls back to copying, ReflinkAlways fails with ErrReflinkUnsupported instead.
+// Contrary to WithHardlinkBackups, clones do not share modifications. The default is ReflinkNever.
+func WithReflink(mode ReflinkMode) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.reflink = mode
+	}
+}
+
+// WithStateEncoding selects the encoding of SaveState, LoadState, WriteState and ReadState.
+// StateEncodingGob is considerably faster and smaller than the default StateEncodingJSON
+// in case that hundreds of thousands of paths are tracked.
+func WithStateEncoding(enc StateEncoding) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.stateEncoding = enc
+	}
+}
+
+// WithStateIndex selects where the file infos of the tracked paths are kept.
+// StateIndexDisk moves the modification times and owners into an index file in the backup filesystem,
+// which reduces the memory footprint of runs that track millions of paths.
+// The parent directories of the tracked paths are kept in memory only once with either index.
+// StateIndexDisk requires a backup filesystem whose files can be read while they are written,
+// which is not the case for object stores like the s3fs package.
+func WithStateIndex(index StateIndex) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.stateIndex = index
+	}
+}
+
+// WithRollbackVerification verifies the backups of files against their checksums before they are restored,
+// see WithChecksums. Corrupted backups are not restored but reported with the code CodeBackupCorrupted,
+// so that a rollback never writes corrupted content into the base filesystem.
+// Has no effect without WithChecksums.
+func WithRollbackVerification(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.rollbackVerification = enable
+	}
+}
+
+// WithJournal appends every mutating operation and every change of the tracked state to a journal file
+// in the backup filesystem before the base filesystem is modified.
+// After a crash, a new BackupFS with the same base and backup filesystem can restore its state
+// from the journal with Recover and roll back the interrupted transaction.
+// The journal is removed by Rollback and Commit.
+func WithJournal(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.journal = enable
+	}
+}
+
+// WithBackupUmask removes the permission bits of umask from the mode of parent directories that are
+// created in the backup filesystem, e.g. 0022 or 0077 in order to prevent world writable
+// backup directories on shared hosts. Restored directories keep their original mode.
+// Directory trees that are backed up as a whole, see WithSubtreeCompaction, keep their original modes.
+func WithBackupUmask(umask fs.FileMode) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.backupUmask = umask.Perm()
+	}
+}
+
+// WithTrash copies every file and directory tree that is removed with Remove or RemoveAll into a
+// timestamped trash directory /.backupfs/trash/<unix nano> in the backup filesystem before it is
+// removed from the base filesystem.
+// In contrast to the backups, the trash is kept after a Commit, which gives interactive tools
+// a safety net even after a transaction has been committed.
+// Commit purges all trash entries that are older than retention, see BackupFS.Purge.
+// A retention <= 0 disables the trash.
+func WithTrash(retention time.Duration) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.trashRetention = retention
+	}
+}
+
+// WithReadTracking records the paths that are read with Open, OpenFile in read only mode, Stat, Lstat,
+// Readlink and ReadDir during a transaction, see BackupFS.ReadSet.
+// The read set allows to analyze which files a process depends on, e.g. in order to decide
+// which tests need to run after a configuration change.
+func WithReadTracking() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.readTracking = true
+	}
+}
+
+// WithBackupWorkers backs up the files of directory trees that are removed with RemoveAll
+// with up to workers goroutines before the files are removed one after another.
+// The backup filesystem must support concurrent writes of different files.
+// A value <= 1 backs up one file after another, which is the default.
+// The buffer size of every copy can be configured with WithBufferSize.
+func WithBackupWorkers(workers int) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.backupWorkers = workers
+	}
+}
+
+// WithSealing seals every generation with an HMAC-SHA256 of its backup manifest when a snapshot is taken, see BackupFS.Snapshot.
+// The manifest consists of the tracked paths as well as the type, mode, size and content hash or symlink target of their backups.
+// Rollback and RollbackTo verify the seals of all generations that are about to be restored and refuse to restore anything
+// in case that the backup directory was tampered with, see BackupFS.VerifySeals.
+// An empty key disables sealing.
+func WithSealing(key []byte) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.sealKey = bytes.Clone(key)
+	}
+}
+
+// WithRollbackProgress streams the progress of every rollback as newline delimited JSON to w,
+// e.g. a file or a pipe, so that supervisors that are not written in Go are able to track long restores
+// and to decide whether to resume a rollback after the process died.
+// Every line is a RollbackProgress. Write errors are ignored in order not to interrupt the rollback.
+// The writer is only used while the BackupFS is locked, it does not need to be safe for concurrent use.
+func WithRollbackProgress(w io.Writer) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.progressWriter = w
+	}
+}
+
+// WithProgressFunc configures a function that is called for every path that is backed up, removed or restored,
+// e.g. in order to display progress bars for long backups like a RemoveAll of a huge tree, or for long rollbacks.
+// Rollbacks and RemoveAll additionally report the total number of paths with a ProgressStarted
+// and their end with a ProgressFinished, see Progress.
+// The function is called while the BackupFS is locked, which is why it must not call any method of the BackupFS.
+func WithProgressFunc(f func(Progress)) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.progressFunc = f
+	}
+}
+
+// WithMetrics configures Metrics that are called for every backed up path, every rollback error
+// and every backup decision, e.g. NewCounterMetrics, in order to monitor large backup and rollback runs.
+func WithMetrics(m Metrics) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.metrics = m
+	}
+}
+
+// WithPathResolver replaces the path resolution of modifying operations, which resolves the symlinks
+// of the parent directories segment by segment with Lstat and Readlink of the base filesystem, see ResolvePath.
+// This allows to use cheaper or more correct implementations, e.g. for case-insensitive base filesystems
+// or network filesystems with a native realpath.
+// Contrary to the default resolution, the symlinks that are traversed as parent directories are not backed up,
+// which is why a rollback does not restore them in case that they are replaced.
+func WithPathResolver(resolver PathResolver) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.pathResolver = resolver
+	}
+}
+
+// WithCaseInsensitivePaths treats paths that only differ in their case as the same path,
+// which is required for case-insensitive base filesystems, e.g. NTFS or APFS by default.
+// Otherwise a file that is modified via C:\Foo and c:\foo is backed up twice and the
+// rollback restores the backup of the later spelling.
+// Paths are tracked and restored with the spelling of their first modification.
+// NewWithFS and New additionally hide the backup location case-insensitively.
+func WithCaseInsensitivePaths(enable bool) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.caseInsensitive = enable
+	}
+}
+
+// WithUnicodeNormalization treats paths that are equal in the Unicode normal form as the same path,
+// which is required for trees with names in mixed normal forms, e.g. names created on macOS (NFD)
+// and names created on Linux (NFC). Otherwise a file that is modified via both spellings is backed up twice
+// and the rollback restores the backup of the later spelling.
+// Paths are tracked and restored with the spelling of their first modification.
+// NewWithFS and New additionally hide the backup location in the normal form.
+// UnicodeFormNone, the default, compares paths byte by byte.
+func WithUnicodeNormalization(form UnicodeForm) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.unicodeForm = form
+	}
+}
+
+// WithLogger sets the logger that receives warnings and the debug logs of backup decisions,
+// path resolutions and rollback steps. The default logger of the slog package is used by default.
+func WithLogger(l *slog.Logger) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.logger = l
+	}
+}
+
+// WithWatchdogFunc configures a function that is called with the result of every rollback that is triggered
+// by the watchdog, e.g. in order to log the automatic revert or to restart services, see BackupFS.BeginWithDeadline.
+// The function is called after the BackupFS has been unlocked.
+func WithWatchdogFunc(f WatchdogFunc) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.watchdogFunc = f
+	}
+}
+
+// WithInodeQuota limits the number of files, directories and symlinks that the backups of all generations
+// may create in the backup filesystem. Backup targets with a limited number of inodes otherwise fail late with ENOSPC,
+// e.g. while a huge directory tree is backed up, despite free bytes.
+// A modification whose backup would exceed the quota fails with ErrInodeQuotaExceeded before the base filesystem
+// is modified. The usage is an estimate that only shrinks with a Commit or Rollback, see Stats.
+// A value <= 0 disables the quota, which is the default.
+func WithInodeQuota(quota int) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.inodeQuota = quota
+	}
+}
+
+// WithBackupQuota limits the number of bytes that the backed up files of all generations may occupy
+// in the backup filesystem, so that the backup of an unexpectedly huge directory tree does not fill the disk.
+// A modification whose backup would exceed the quota fails with ErrQuotaExceeded before the base filesystem
+// is modified. Like WithInodeQuota, the usage is an estimate that only shrinks with a Commit or Rollback, see Stats.
+// A value <= 0 disables the quota, which is the default.
+func WithBackupQuota(maxBytes int64) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.backupQuota = maxBytes
+	}
+}
+
+// WithIsolation configures the state of the base filesystem that reads through the BackupFS observe.
+// IsolationReadModified, the default, reads the current state including all modifications.
+// IsolationSnapshot reads the original state of modified paths from their backups until the modifications
+// are committed or rolled back, which provides a stable view to consumers while the modifications accumulate.
+func WithIsolation(isolation Isolation) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.isolation = isolation
+	}
+}
+
+// WithLockMetrics reports how long every operation waited for the lock of the BackupFS and how long it held the lock,
+// e.g. in order to quantify the contention of concurrent modifications, see LockProfile.
+// Durations are measured with the clock of the BackupFS, see WithClock.
+// Operations that merely read the internal state, like Stats or Map, are not reported.
+func WithLockMetrics(m LockMetrics) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.lockMetrics = m
+	}
+}
+
+// WithRetry retries the individual copy and remove operations of backups, ForceBackup and rollbacks
+// up to attempts times in total, so that transient errors of network filesystems like NFS or SMB
+// do not abort the whole operation. The first retry waits for backoff, every further retry waits twice as long.
+// Errors that are not transient, e.g. fs.ErrNotExist or fs.ErrPermission, are not retried.
+// An attempts value <= 1 disables retries, which is the default.
+func WithRetry(attempts int, backoff time.Duration) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.retryAttempts = attempts
+		o.retryBackoff = backoff
+	}
+}
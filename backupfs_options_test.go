@@ -0,0 +1,241 @@
+package backupfs
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithBackupRequiredFunc(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup, WithBackupRequiredFunc(func(resolvedName string, info fs.FileInfo) bool {
+		return filepath.Ext(resolvedName) != ".cache"
+	}))
+
+	createFile(t, base, "/test/config.txt", "config")
+	createFile(t, base, "/test/volatile.cache", "cache")
+
+	createFile(t, backupFS, "/test/config.txt", "config_new")
+	createFile(t, backupFS, "/test/volatile.cache", "cache_new")
+
+	fileMustContainText(t, backup, "/test/config.txt", "config")
+	mustNotExist(t, backup, "/test/volatile.cache")
+
+	_, seen := backupFS.baseInfos.get(filepath.FromSlash("/test/volatile.cache"))
+	require.False(seen, "skipped files must not be tracked")
+
+	err := backupFS.Rollback()
+	require.NoError(err)
+
+	fileMustContainText(t, base, "/test/config.txt", "config")
+	// skipped files are neither restored nor removed
+	fileMustContainText(t, base, "/test/volatile.cache", "cache_new")
+}
+
+func TestBackupFS_WithSymlinkValidation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup, WithSymlinkValidation(true))
+
+	createFile(t, base, "/test/target.txt", "target")
+	createFile(t, base, "/test/other.txt", "other")
+	createSymlink(t, base, "/test/target.txt", "/test/dangling")
+	createSymlink(t, base, "/test/other.txt", "/test/valid")
+
+	require.NoError(backupFS.Remove("/test/dangling"))
+	require.NoError(backupFS.Remove("/test/valid"))
+
+	// target is removed outside of the transaction
+	require.NoError(base.Remove(filepath.FromSlash("/test/target.txt")))
+
+	require.NoError(backupFS.Rollback())
+	symlinkMustExistWithTragetPath(t, base, "/test/dangling", "/test/target.txt")
+	symlinkMustExistWithTragetPath(t, base, "/test/valid", "/test/other.txt")
+
+	report := backupFS.LastRollback()
+	require.NotNil(report)
+	require.Empty(report.Error)
+	require.Len(report.Warnings, 1)
+	require.Contains(report.Warnings[0], filepath.FromSlash("/test/dangling"))
+}
+
+func TestBackupFS_WithBackupUmask(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup, WithBackupUmask(0077))
+
+	mkdirAll(t, base, "/shared", 0755)
+	chmod(t, base, "/shared", 0777)
+	createFile(t, base, "/shared/test.txt", "test")
+
+	createFile(t, backupFS, "/shared/test.txt", "modified")
+
+	fi, err := backup.Lstat("/shared")
+	require.NoError(err)
+	modeMustBeEqual(t, 0700, fi.Mode().Perm())
+
+	require.NoError(backupFS.Rollback())
+
+	// the original mode is restored
+	fi, err = base.Lstat("/shared")
+	require.NoError(err)
+	modeMustBeEqual(t, 0777, fi.Mode().Perm())
+}
+
+func TestBackupFS_WithPathResolver(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		calls   = 0
+	)
+	// emulates a case-insensitive base filesystem
+	backupFS := NewBackupFS(base, NewMemFS(), WithPathResolver(func(fsys FS, name string) (string, fs.FileInfo, error) {
+		calls++
+		return ResolvePath(fsys, strings.ToLower(name))
+	}))
+
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, backupFS, "/TEST/File.txt", "modified")
+	require.Positive(calls)
+	fileMustContainText(t, base, "/test/file.txt", "modified")
+	mustNotLExist(t, base, "/TEST")
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, "/test/file.txt", "original")
+}
+
+func TestBackupFS_WithCaseInsensitivePaths(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backupFS = NewWithFS(base, "/backup", WithCaseInsensitivePaths(true))
+	)
+	mkdirAll(t, base, "/backup", 0755)
+	createFile(t, base, "/Test/File.txt", "original")
+
+	// different spellings of the same path are tracked once with the spelling of the first modification
+	createFile(t, backupFS, "/Test/File.txt", "modified")
+	createFile(t, backupFS, "/TEST/FILE.TXT", "modified again")
+	createFile(t, backupFS, "/test/new.txt", "new")
+	fileMustContainText(t, base, "/Test/File.txt", "modified again")
+	fileMustContainText(t, base, "/Test/new.txt", "new")
+	mustNotLExist(t, base, "/TEST")
+	mustNotLExist(t, base, "/test")
+
+	m := backupFS.Map()
+	require.Contains(m, filepath.FromSlash("/Test/File.txt"))
+	require.Contains(m, filepath.FromSlash("/Test/new.txt"))
+	require.NotContains(m, filepath.FromSlash("/TEST/FILE.TXT"))
+
+	// the backup location is hidden independent of its case
+	createFile(t, base, "/BACKUP/file.txt", "hidden")
+	mustNotLExist(t, backupFS, "/BACKUP/file.txt")
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, "/Test/File.txt", "original")
+	mustNotLExist(t, base, "/Test/new.txt")
+}
+
+func TestBackupFS_WithUnicodeNormalization(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backupFS = NewWithFS(base, "/b\u00e4ckup", WithUnicodeNormalization(UnicodeFormNFC))
+		// macOS
+		nfd = filepath.FromSlash("/cafe\u0301/file.txt")
+		// Linux
+		nfc = filepath.FromSlash("/caf\u00e9/file.txt")
+	)
+	mkdirAll(t, base, "/b\u00e4ckup", 0755)
+	createFile(t, base, nfd, "original")
+
+	// paths in different normal forms are tracked once with the spelling of the first modification
+	createFile(t, backupFS, nfd, "modified")
+	createFile(t, backupFS, nfc, "modified again")
+	fileMustContainText(t, base, nfd, "modified again")
+	mustNotLExist(t, base, nfc)
+
+	m := backupFS.Map()
+	require.Contains(m, nfd)
+	require.NotContains(m, nfc)
+
+	// the backup location is hidden in any normal form
+	createFile(t, base, "/ba\u0308ckup/file.txt", "hidden")
+	mustNotLExist(t, backupFS, "/ba\u0308ckup/file.txt")
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, nfd, "original")
+}
+
+// renameRecordingFS records the renamed paths.
+type renameRecordingFS struct {
+	FS
+	renamed []string
+}
+
+func (fsys *renameRecordingFS) Rename(oldname, newname string) error {
+	fsys.renamed = append(fsys.renamed, newname)
+	return fsys.FS.Rename(oldname, newname)
+}
+
+func TestBackupFS_WithAtomicRestore(t *testing.T) {
+	t.Parallel()
+
+	for _, atomic := range []bool{true, false} {
+		atomic := atomic
+		t.Run(fmt.Sprintf("atomic=%t", atomic), func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				require            = require.New(t)
+				_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+				recording          = &renameRecordingFS{FS: base}
+				backupFS           = NewBackupFS(recording, backup, WithAtomicRestore(atomic))
+			)
+
+			createFile(t, base, "/test/file.txt", "original")
+			createFile(t, backupFS, "/test/file.txt", "modified")
+			require.NoError(backupFS.Rollback())
+
+			fileMustContainText(t, base, "/test/file.txt", "original")
+			entries, err := base.ReadDir("/test")
+			require.NoError(err)
+			require.Len(entries, 1, "temporary files must not be left behind")
+
+			if atomic {
+				require.Equal([]string{filepath.FromSlash("/test/file.txt")}, recording.renamed)
+			} else {
+				require.Empty(recording.renamed)
+			}
+		})
+	}
+}
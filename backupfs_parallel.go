@@ -0,0 +1,128 @@
+package backupfs
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+type backupJob struct {
+	resolvedName string
+	info         fs.FileInfo
+}
+
+type backupResult struct {
+	backupJob
+	sum []byte
+	err error
+}
+
+// backupFilesParallel copies the regular files that require a backup with multiple goroutines,
+// see WithBackupWorkers. Only the copies are made concurrently, the internal state is updated
+// by the calling goroutine. Files that could not be backed up are not tracked, which is why
+// their backup is retried and their errors are reported by the subsequent tryBackup.
+func (fsys *BackupFS) backupFilesParallel(ctx context.Context, resolvedFilePaths []string) {
+	jobs := make([]backupJob, 0, len(resolvedFilePaths))
+	for _, resolvedName := range resolvedFilePaths {
+		resolvedName = fsys.canonicalPath(resolvedName)
+		info, required, err := fsys.backupRequired(resolvedName)
+		if err != nil || !required || !info.Mode().IsRegular() || fsys.placeholderRequired(info) {
+			// symlinks and placeholders are cheap and backed up by tryBackup
+			continue
+		}
+
+		// parent directories must exist before the files are copied concurrently
+		err = fsys.backupDirs(filepath.Dir(resolvedName))
+		if err != nil {
+			continue
+		}
+		err = fsys.reserveBytes(info)
+		if err != nil {
+			// reported by tryBackup
+			continue
+		}
+		err = fsys.reserveInode()
+		if err != nil {
+			// reported by tryBackup
+			fsys.releaseBytes(info)
+			continue
+		}
+
+		// the files are removed afterwards, which is why they may be linked instead of copied
+		linked, err := fsys.linkBackupFile(resolvedName, info)
+		if err != nil {
+			fsys.releaseBytes(info)
+			fsys.releaseInode()
+			continue
+		}
+		if linked {
+			err = fsys.setInfoIfNotAlreadySeen(resolvedName, info)
+			if err != nil {
+				// reported by tryBackup, which must not copy into the linked file
+				_ = fsys.backup.Remove(resolvedName)
+				fsys.releaseBytes(info)
+				fsys.releaseInode()
+				continue
+			}
+			fsys.reportBackup(resolvedName, info)
+			continue
+		}
+		jobs = append(jobs, backupJob{resolvedName: resolvedName, info: info})
+	}
+
+	var (
+		workers = min(fsys.opts.backupWorkers, len(jobs))
+		jobCh   = make(chan backupJob)
+		results = make(chan backupResult, workers)
+		wg      sync.WaitGroup
+	)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				sum, err := fsys.copyBackupFile(job.resolvedName, job.info)
+				results <- backupResult{backupJob: job, sum: sum, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobCh)
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			jobCh <- job
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	backedUp := make(map[string]bool, len(jobs))
+	for r := range results {
+		if r.err != nil {
+			continue
+		}
+		err := fsys.setInfoIfNotAlreadySeen(r.resolvedName, r.info)
+		if err != nil {
+			// the backup is repeated and the error reported by tryBackup
+			continue
+		}
+		backedUp[r.resolvedName] = true
+		fsys.setChecksum(r.resolvedName, r.sum)
+		fsys.reportBackup(r.resolvedName, r.info)
+	}
+
+	// failed and canceled jobs are retried by tryBackup
+	for _, job := range jobs {
+		if !backedUp[job.resolvedName] {
+			fsys.releaseBytes(job.info)
+			fsys.releaseInode()
+		}
+	}
+}
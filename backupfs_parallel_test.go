@@ -0,0 +1,41 @@
+package backupfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithBackupWorkers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup, WithBackupWorkers(4), WithChecksums(sha256.New))
+
+	for i := 0; i < 64; i++ {
+		filePath := path.Join("/test", fmt.Sprintf("dir_%d", i%8), fmt.Sprintf("file_%d.txt", i))
+		createFile(t, base, filePath, fmt.Sprintf("content_%d", i))
+	}
+	createSymlink(t, base, "/test/dir_0/file_0.txt", "/test/link")
+
+	baseFSState := createFSState(t, base, "/")
+	backupFSState := createFSState(t, backup, "/")
+
+	require.NoError(backupFS.RemoveAll("/test"))
+	mustNotExist(t, base, "/test")
+	fileMustContainText(t, backup, "/test/dir_7/file_63.txt", "content_63")
+	require.Len(backupFS.Checksums(), 64)
+	require.NoError(backupFS.VerifyChecksums(0))
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseFSState, base, "/")
+	mustEqualFSState(t, backupFSState, backup, "/")
+}
@@ -0,0 +1,101 @@
+package backupfs
+
+import (
+	"io/fs"
+	"sort"
+)
+
+const (
+	// ChangeChmod marks paths whose permissions changed.
+	// It is only reported as one of the Kinds of a ChangeRecord.
+	ChangeChmod ChangeType = "chmod"
+	// ChangeChown marks paths whose ownership changed.
+	// It is only reported as one of the Kinds of a ChangeRecord.
+	ChangeChown ChangeType = "chown"
+)
+
+// ChangeRecord describes a single path that is reverted by a Rollback.
+type ChangeRecord struct {
+	Change
+	// Kinds lists all modifications of the path, e.g. a file whose content and permissions changed
+	// is reported as ChangeModified and ChangeChmod. Created and removed paths only have a single kind.
+	Kinds []ChangeType `json:"kinds"`
+}
+
+// PendingChanges returns the sorted list of all paths that a Rollback would revert, with their original
+// metadata, which is restored by the Rollback, and their current metadata in the base filesystem.
+// Contrary to Changes, all generations are taken into account, see Snapshot, and paths that are
+// identical to their original state are omitted.
+// Directory trees that were backed up as a whole are reported as a single record.
+func (fsys *BackupFS) PendingChanges() ([]ChangeRecord, error) {
+	defer fsys.lock(OpPendingChanges)()
+
+	// the oldest generation knows the original state of a path
+	original := make(map[string]fs.FileInfo, fsys.baseInfos.len())
+	for _, g := range fsys.allGenerations() {
+		err := addMissingInfos(original, g.baseInfos)
+		if err != nil {
+			return nil, newBackupError(OpPendingChanges, separator, err)
+		}
+	}
+
+	records := make([]ChangeRecord, 0, len(original))
+	for path, info := range original {
+		fi, found, err := lexists(fsys.base, path)
+		if err != nil {
+			return nil, newBackupError(OpPendingChanges, path, err)
+		}
+
+		c := Change{Path: path}
+		if info != nil {
+			c.Old = toFileMetadata(info)
+		}
+		if found {
+			c.New = toFileMetadata(fi)
+		}
+		c.Type = changeTypeOf(c.Old, c.New)
+		if c.Type == ChangeUnchanged {
+			continue
+		}
+		records = append(records, ChangeRecord{
+			Change: c,
+			Kinds:  changeKindsOf(c.Old, c.New),
+		})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Path < records[j].Path
+	})
+	return records, nil
+}
+
+func addMissingInfos(dst map[string]fs.FileInfo, src *trackedInfos) (err error) {
+	src.each(func(path string, info fs.FileInfo) bool {
+		if _, ok := dst[path]; ok {
+			return true
+		}
+		dst[path], err = loadFileInfo(info)
+		return err == nil
+	})
+	return err
+}
+
+// changeKindsOf returns all modifications between old and new, see changeTypeOf.
+func changeKindsOf(old, new *FileMetadata) []ChangeType {
+	switch typ := changeTypeOf(old, new); typ {
+	case ChangeCreated, ChangeRemoved, ChangeUnchanged:
+		return []ChangeType{typ}
+	}
+
+	kinds := make([]ChangeType, 0, 3)
+	if old.Mode.Type() != new.Mode.Type() || old.Size != new.Size || !old.ModTime.Equal(new.ModTime) {
+		kinds = append(kinds, ChangeModified)
+	}
+	if old.Mode.Type() == new.Mode.Type() && old.Mode != new.Mode {
+		kinds = append(kinds, ChangeChmod)
+	}
+	if old.UID != new.UID || old.GID != new.GID {
+		kinds = append(kinds, ChangeChown)
+	}
+	return kinds
+}
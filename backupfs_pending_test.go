@@ -0,0 +1,72 @@
+package backupfs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_PendingChanges(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backupFS = NewBackupFS(base, NewMemFS())
+	)
+
+	createFile(t, base, "/test/modified.txt", "original")
+	createFile(t, base, "/test/metadata.txt", "original")
+	createFile(t, base, "/test/removed.txt", "original")
+	require.NoError(base.Chmod("/test/modified.txt", 0644))
+	require.NoError(base.Chmod("/test/metadata.txt", 0644))
+
+	createFile(t, backupFS, "/test/modified.txt", "modified content")
+	require.NoError(backupFS.Chmod("/test/modified.txt", 0600))
+	require.NoError(backupFS.Snapshot("first"))
+
+	// the original state is known to the oldest generation
+	createFile(t, backupFS, "/test/modified.txt", "modified again")
+	require.NoError(backupFS.Chmod("/test/metadata.txt", 0600))
+	require.NoError(backupFS.Chown("/test/metadata.txt", 1000, 1000))
+	require.NoError(backupFS.Remove("/test/removed.txt"))
+	createFile(t, backupFS, "/test/created.txt", "created")
+	createFile(t, backupFS, "/test/temporary.txt", "temporary")
+	require.NoError(backupFS.Remove("/test/temporary.txt"))
+
+	records, err := backupFS.PendingChanges()
+	require.NoError(err)
+
+	found := make(map[string][]ChangeType, len(records))
+	for _, r := range records {
+		found[filepath.ToSlash(r.Path)] = r.Kinds
+	}
+	require.Equal(map[string][]ChangeType{
+		// the modification time of the parent directory changed
+		"/test":              {ChangeModified},
+		"/test/modified.txt": {ChangeModified, ChangeChmod},
+		"/test/metadata.txt": {ChangeChmod, ChangeChown},
+		"/test/removed.txt":  {ChangeRemoved},
+		"/test/created.txt":  {ChangeCreated},
+	}, found)
+
+	for _, r := range records {
+		if filepath.ToSlash(r.Path) != "/test/modified.txt" {
+			continue
+		}
+		require.Equal(ChangeModified, r.Type)
+		require.Equal(fs.FileMode(0644), r.Old.Mode.Perm())
+		require.Equal(int64(len("original")), r.Old.Size)
+		require.Equal(fs.FileMode(0600), r.New.Mode.Perm())
+	}
+
+	// the preview does not modify anything
+	fileMustContainText(t, base, "/test/modified.txt", "modified again")
+
+	require.NoError(backupFS.Rollback())
+	records, err = backupFS.PendingChanges()
+	require.NoError(err)
+	require.Empty(records)
+}
@@ -0,0 +1,159 @@
+package backupfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+var (
+	// ErrContentNotBackedUp is the underlying error of rollback failures with the code CodeContentNotRestored.
+	// The metadata of such files is restored, but their content is not.
+	ErrContentNotBackedUp = errors.New("content not backed up")
+
+	// ErrFileTooLarge is returned by modifications of files that are larger than the size
+	// of WithMaxBackupFileSize with the strategy LargeFileFail.
+	ErrFileTooLarge = errors.New("file too large for backup")
+)
+
+// LargeFileStrategy decides what happens to files that are too large to be backed up, see WithMaxBackupFileSize.
+type LargeFileStrategy int
+
+const (
+	// LargeFileMetadataOnly backs up only the metadata of large files, like WithPlaceholders.
+	// Upon rollback their permissions, ownership and modification times are restored, but their content is not.
+	LargeFileMetadataOnly LargeFileStrategy = iota
+	// LargeFileSkip does not back up large files at all, like a BackupRequiredFunc that returns false.
+	// Their modifications are kept upon rollback.
+	LargeFileSkip
+	// LargeFileFail refuses modifications of large files with an error that wraps ErrFileTooLarge.
+	LargeFileFail
+)
+
+func (s LargeFileStrategy) String() string {
+	switch s {
+	case LargeFileMetadataOnly:
+		return "metadata-only"
+	case LargeFileSkip:
+		return "skip"
+	case LargeFileFail:
+		return "fail"
+	default:
+		return fmt.Sprintf("LargeFileStrategy(%d)", int(s))
+	}
+}
+
+// largeFile returns true in case that info describes a regular file that exceeds the size of WithMaxBackupFileSize.
+func (fsys *BackupFS) largeFile(info fs.FileInfo) bool {
+	limit := fsys.opts.maxBackupFileSize
+	return limit > 0 && info.Mode().IsRegular() && info.Size() > limit
+}
+
+// largeFileRequired applies the LargeFileSkip and LargeFileFail strategies to a file that requires a backup.
+func (fsys *BackupFS) largeFileRequired(info fs.FileInfo) (required bool, err error) {
+	if !fsys.largeFile(info) {
+		return true, nil
+	}
+	switch fsys.opts.largeFileStrategy {
+	case LargeFileSkip:
+		return false, nil
+	case LargeFileFail:
+		return false, fmt.Errorf("%w: size of %d bytes exceeds %d bytes", ErrFileTooLarge, info.Size(), fsys.opts.maxBackupFileSize)
+	default:
+		return true, nil
+	}
+}
+
+// placeholderInfo marks a regular file whose content has not been backed up
+// due to its size. Only its metadata is tracked.
+type placeholderInfo struct {
+	fs.FileInfo
+}
+
+func isPlaceholderInfo(fi fs.FileInfo) bool {
+	_, ok := fi.(*placeholderInfo)
+	return ok
+}
+
+// placeholderRequired returns true in case that only the metadata of the file is backed up
+func (fsys *BackupFS) placeholderRequired(info fs.FileInfo) bool {
+	if fsys.opts.largeFileStrategy == LargeFileMetadataOnly && fsys.largeFile(info) {
+		return true
+	}
+	limit := fsys.opts.placeholderSize
+	return limit > 0 && info.Mode().IsRegular() && info.Size() > limit
+}
+
+func (fsys *BackupFS) tryRestorePlaceholderPaths(ctx context.Context, restorePlaceholderPaths []string) (multiErr error) {
+	sort.Strings(restorePlaceholderPaths)
+	for _, path := range restorePlaceholderPaths {
+		if ctx.Err() != nil {
+			// reported by RollbackContext
+			return multiErr
+		}
+		err := fsys.restorePlaceholder(path, fsys.baseInfos.info(path))
+		if err != nil {
+			err = newRollbackPathError(CodeRestoreFileFailed, path, err)
+		} else {
+			// the metadata was restored, the content was not
+			err = newRollbackPathError(CodeContentNotRestored, path, ErrContentNotBackedUp)
+		}
+		multiErr = errors.Join(multiErr, err)
+		fsys.reportProgress(ProgressRestored, path, err)
+	}
+	return multiErr
+}
+
+// restorePlaceholder restores the metadata of the file and optionally its size.
+// Files that do not exist anymore are recreated empty.
+func (fsys *BackupFS) restorePlaceholder(name string, info fs.FileInfo) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to restore placeholder: %s: %w", name, err)
+		}
+	}()
+
+	fi, found, err := lexists(fsys.base, name)
+	if err != nil {
+		return err
+	}
+	if found && !fi.Mode().IsRegular() {
+		// remove dir/symlink/etc and create a file there
+		err = fsys.base.RemoveAll(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := fsys.base.OpenFile(name, os.O_WRONLY|os.O_CREATE, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if fsys.opts.placeholderTruncate {
+		err = f.Truncate(info.Size())
+		if err != nil {
+			return errors.Join(err, f.Close())
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = fsys.base.Chmod(name, info.Mode())
+	if err != nil {
+		return err
+	}
+	err = ignoreChtimesError(fsys.base.Chtimes(name, info.ModTime(), info.ModTime()))
+	if err != nil {
+		return err
+	}
+
+	if fsys.opts.disableChown {
+		return nil
+	}
+	return ignoreChownError(chown(info, name, fsys.base))
+}
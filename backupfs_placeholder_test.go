@@ -0,0 +1,143 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithPlaceholders(16, true))
+		largeContent       = strings.Repeat("large", 10)
+		modifiedPath       = filepath.FromSlash("/test/modified.bin")
+		removedPath        = filepath.FromSlash("/test/removed.bin")
+		smallPath          = filepath.FromSlash("/test/small.txt")
+	)
+
+	createFile(t, base, modifiedPath, largeContent)
+	createFile(t, base, removedPath, largeContent)
+	createFile(t, base, smallPath, "small")
+	require.NoError(base.Chmod(modifiedPath, 0640))
+
+	modifiedInfo, err := base.Lstat(modifiedPath)
+	require.NoError(err)
+	removedInfo, err := base.Lstat(removedPath)
+	require.NoError(err)
+
+	createFile(t, backupFS, modifiedPath, "short")
+	require.NoError(backupFS.Chmod(modifiedPath, 0600))
+	require.NoError(backupFS.Remove(removedPath))
+	createFile(t, backupFS, smallPath, "modified")
+
+	// content of large files is not backed up
+	mustNotExist(t, backup, modifiedPath)
+	mustNotExist(t, backup, removedPath)
+	fileMustContainText(t, backup, smallPath, "small")
+	require.Equal(2, backupFS.Stats().Placeholders)
+
+	// placeholders survive the serialization of the state
+	data, err := json.Marshal(backupFS)
+	require.NoError(err)
+	restored := NewBackupFS(base, backup, WithPlaceholders(16, true))
+	require.NoError(json.Unmarshal(data, restored))
+
+	err = restored.Rollback()
+	require.Error(err)
+	require.ErrorIs(err, ErrContentNotBackedUp)
+
+	var rerr *RollbackError
+	require.ErrorAs(err, &rerr)
+	require.Len(rerr.Errors, 2, rerr.Error())
+	for _, perr := range rerr.Errors {
+		require.Equal(CodeContentNotRestored, perr.Code)
+	}
+
+	fileMustContainText(t, base, smallPath, "small")
+	for path, info := range map[string]os.FileInfo{
+		modifiedPath: modifiedInfo,
+		removedPath:  removedInfo,
+	} {
+		fi, err := base.Lstat(path)
+		require.NoError(err)
+		require.Equal(info.Mode(), fi.Mode())
+		require.Equal(info.Size(), fi.Size())
+		require.True(info.ModTime().Equal(fi.ModTime()))
+	}
+}
+
+func TestBackupFS_WithMaxBackupFileSize(t *testing.T) {
+	t.Parallel()
+
+	var (
+		largeContent = strings.Repeat("large", 10)
+		largePath    = filepath.FromSlash("/test/large.bin")
+		smallPath    = filepath.FromSlash("/test/small.txt")
+	)
+
+	setup := func(t *testing.T, strategy LargeFileStrategy) (base, backup FS, backupFS *BackupFS) {
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		createFile(t, base, largePath, largeContent)
+		createFile(t, base, smallPath, "small")
+		require.NoError(t, base.Chmod(largePath, 0640))
+		return base, backup, NewBackupFS(base, backup, WithMaxBackupFileSize(16, strategy))
+	}
+
+	t.Run("metadata only", func(t *testing.T) {
+		t.Parallel()
+		require := require.New(t)
+		base, backup, backupFS := setup(t, LargeFileMetadataOnly)
+
+		require.NoError(backupFS.Chmod(largePath, 0600))
+		createFile(t, backupFS, largePath, "short")
+		createFile(t, backupFS, smallPath, "modified")
+		mustNotExist(t, backup, largePath)
+		fileMustContainText(t, backup, smallPath, "small")
+
+		err := backupFS.Rollback()
+		require.ErrorIs(err, ErrContentNotBackedUp)
+
+		fi, err := base.Lstat(largePath)
+		require.NoError(err)
+		require.Equal(os.FileMode(0640), fi.Mode().Perm())
+		fileMustContainText(t, base, largePath, "short")
+		fileMustContainText(t, base, smallPath, "small")
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		t.Parallel()
+		require := require.New(t)
+		base, backup, backupFS := setup(t, LargeFileSkip)
+
+		createFile(t, backupFS, largePath, "short")
+		createFile(t, backupFS, smallPath, "modified")
+		mustNotExist(t, backup, largePath)
+
+		require.NoError(backupFS.Rollback())
+		fileMustContainText(t, base, largePath, "short")
+		fileMustContainText(t, base, smallPath, "small")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		t.Parallel()
+		require := require.New(t)
+		base, backup, backupFS := setup(t, LargeFileFail)
+
+		err := backupFS.Remove(largePath)
+		require.ErrorIs(err, ErrFileTooLarge)
+		fileMustContainText(t, base, largePath, largeContent)
+		mustNotExist(t, backup, largePath)
+
+		createFile(t, backupFS, smallPath, "modified")
+		require.NoError(backupFS.Rollback())
+		fileMustContainText(t, base, smallPath, "small")
+	})
+}
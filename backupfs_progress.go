@@ -0,0 +1,236 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// ProgressEvent is the type of a rollback progress line, see WithRollbackProgress,
+// and of the progress that is passed to the function of WithProgressFunc.
+type ProgressEvent string
+
+const (
+	// ProgressStarted is written before the paths of a generation are rolled back
+	// and before the paths of a RemoveAll are backed up and removed.
+	ProgressStarted ProgressEvent = "started"
+	// ProgressBackedUp is reported after a path has been backed up.
+	ProgressBackedUp ProgressEvent = "backed_up"
+	// ProgressRemoved is written after a path that did not exist before has been removed.
+	ProgressRemoved ProgressEvent = "removed"
+	// ProgressRestored is written after a path has been restored from its backup.
+	ProgressRestored ProgressEvent = "restored"
+	// ProgressFailed is written in case that a path could not be removed or restored.
+	ProgressFailed ProgressEvent = "failed"
+	// ProgressFinished is written after all generations have been rolled back
+	// and after all paths of a RemoveAll have been removed.
+	ProgressFinished ProgressEvent = "finished"
+)
+
+// ProgressPhase distinguishes backups from rollbacks, see WithProgressFunc.
+type ProgressPhase string
+
+const (
+	PhaseBackup   ProgressPhase = "backup"
+	PhaseRollback ProgressPhase = "rollback"
+)
+
+// Progress is passed to the function of WithProgressFunc.
+type Progress struct {
+	Phase ProgressPhase
+	Event ProgressEvent
+	// Path is the path of the base filesystem, empty for ProgressStarted and ProgressFinished.
+	Path string
+	// Bytes is the size of a backed up or restored regular file.
+	Bytes int64
+	// Files is the number of removed, restored and failed paths since the last ProgressStarted.
+	Files int
+	// Total is the number of paths that are going to be removed or restored, set for rollbacks and RemoveAll.
+	Total int
+	// Err is set for ProgressFailed and for ProgressFinished in case that the operation failed.
+	Err error
+}
+
+// progressCounter counts the paths of the phase that is reported to the function of WithProgressFunc.
+type progressCounter struct {
+	files int
+	total int
+}
+
+// notifyProgress passes p to the function of WithProgressFunc.
+func (fsys *BackupFS) notifyProgress(p Progress) {
+	if fsys.opts.progressFunc == nil {
+		return
+	}
+
+	switch p.Event {
+	case ProgressStarted:
+		fsys.progressCount = progressCounter{total: p.Total}
+	case ProgressRemoved, ProgressRestored, ProgressFailed:
+		fsys.progressCount.files++
+	}
+	p.Files = fsys.progressCount.files
+	p.Total = fsys.progressCount.total
+	if p.Event == ProgressFinished {
+		fsys.progressCount = progressCounter{}
+	}
+	fsys.opts.progressFunc(p)
+}
+
+// reportRemoved reports a path that has been removed by RemoveAll.
+func (fsys *BackupFS) reportRemoved(path string, err error) {
+	event := ProgressRemoved
+	if err != nil {
+		event = ProgressFailed
+	}
+	fsys.notifyProgress(Progress{
+		Phase: PhaseBackup,
+		Event: event,
+		Path:  path,
+		Err:   err,
+	})
+}
+
+// reportBackup reports a path that has been backed up.
+func (fsys *BackupFS) reportBackup(path string, info fs.FileInfo) {
+	p := Progress{
+		Phase: PhaseBackup,
+		Event: ProgressBackedUp,
+		Path:  path,
+	}
+	if info.Mode().IsRegular() {
+		p.Bytes = info.Size()
+	}
+	if fsys.opts.metrics != nil {
+		fsys.opts.metrics.ObserveBackup(p.Bytes)
+	}
+	fsys.notifyProgress(p)
+}
+
+// RollbackProgress is a single line of the rollback progress stream, see WithRollbackProgress.
+type RollbackProgress struct {
+	// Seq is the number of the line within the rollback, starting at 1.
+	Seq   uint64        `json:"seq"`
+	Time  time.Time     `json:"time"`
+	Event ProgressEvent `json:"event"`
+	// Generation is the index of the generation that is rolled back, 0 for the oldest one, see BackupFS.Snapshot.
+	Generation int `json:"generation"`
+	// Total is the number of paths of the generation, set for ProgressStarted.
+	Total int `json:"total,omitempty"`
+	// Path is the path of the base filesystem for ProgressRemoved, ProgressRestored and ProgressFailed.
+	Path string `json:"path,omitempty"`
+	// Code classifies the failure of ProgressFailed.
+	Code RollbackErrorCode `json:"code,omitempty"`
+	// Error is set for ProgressFailed and for ProgressFinished in case that the rollback failed.
+	Error string `json:"error,omitempty"`
+	// Removed and Restored are the number of paths of the whole rollback, set for ProgressFinished.
+	Removed  int `json:"removed,omitempty"`
+	Restored int `json:"restored,omitempty"`
+}
+
+// progressWriter writes the rollback progress as newline delimited JSON.
+type progressWriter struct {
+	enc *json.Encoder
+	seq uint64
+}
+
+func newProgressWriter(w io.Writer) *progressWriter {
+	return &progressWriter{enc: json.NewEncoder(w)}
+}
+
+// write is best effort, a failing supervisor must not prevent the rollback.
+func (p *progressWriter) write(clock Clock, line RollbackProgress) {
+	p.seq++
+	line.Seq = p.seq
+	line.Time = clock.Now()
+	_ = p.enc.Encode(line)
+}
+
+// startProgress starts a new progress stream for a rollback.
+func (fsys *BackupFS) startProgress() {
+	if fsys.opts.progressWriter == nil {
+		return
+	}
+	fsys.progress = newProgressWriter(fsys.opts.progressWriter)
+}
+
+// reportProgress writes a line for a single path of the current generation.
+// A nil error reports the successful event, any other error a failure.
+func (fsys *BackupFS) reportProgress(event ProgressEvent, path string, err error) {
+	p := Progress{
+		Phase: PhaseRollback,
+		Event: event,
+		Path:  path,
+		Err:   err,
+	}
+	fsys.logger().Debug("rollback step", "event", event, "path", path, "generation", len(fsys.generations), "error", err)
+	if err != nil {
+		p.Event = ProgressFailed
+	} else if info := fsys.baseInfos.info(path); event == ProgressRestored && info != nil && info.Mode().IsRegular() {
+		p.Bytes = info.Size()
+	}
+	fsys.notifyProgress(p)
+
+	if fsys.progress == nil {
+		return
+	}
+
+	line := RollbackProgress{
+		Event:      event,
+		Generation: len(fsys.generations),
+		Path:       path,
+	}
+	if err != nil {
+		line.Event = ProgressFailed
+		line.Code = CodeUnknown
+		line.Error = err.Error()
+
+		var perr *RollbackPathError
+		if errors.As(err, &perr) {
+			line.Code = perr.Code
+		}
+	}
+	fsys.progress.write(fsys.opts.clock, line)
+}
+
+// reportGeneration writes the start line of the current generation.
+func (fsys *BackupFS) reportGeneration(total int) {
+	fsys.logger().Debug("rollback of generation started", "generation", len(fsys.generations), "paths", total)
+	fsys.notifyProgress(Progress{
+		Phase: PhaseRollback,
+		Event: ProgressStarted,
+		Total: total,
+	})
+
+	if fsys.progress == nil {
+		return
+	}
+	fsys.progress.write(fsys.opts.clock, RollbackProgress{
+		Event:      ProgressStarted,
+		Generation: len(fsys.generations),
+		Total:      total,
+	})
+}
+
+// finishProgress writes the final line of the rollback and ends the progress stream.
+func (fsys *BackupFS) finishProgress(report *RollbackReport, err error) {
+	fsys.notifyProgress(Progress{
+		Phase: PhaseRollback,
+		Event: ProgressFinished,
+		Err:   err,
+	})
+
+	if fsys.progress == nil {
+		return
+	}
+	fsys.progress.write(fsys.opts.clock, RollbackProgress{
+		Event:      ProgressFinished,
+		Generation: len(fsys.generations),
+		Error:      report.Error,
+		Removed:    report.Removed,
+		Restored:   report.Restored,
+	})
+	fsys.progress = nil
+}
@@ -0,0 +1,156 @@
+package backupfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithRollbackProgress(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = NewMemFS()
+		buf     bytes.Buffer
+		start   = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock   = NewManualClock(start)
+	)
+	clock.SetStep(time.Second)
+	backupFS := NewBackupFS(base, backup, WithRollbackProgress(&buf), WithClock(clock))
+
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, backupFS, "/test/file.txt", "first")
+	require.NoError(backupFS.Snapshot("first"))
+
+	createFile(t, backupFS, "/test/created.txt", "created")
+
+	// the backup of the oldest generation is missing
+	require.NoError(backup.Remove("/test/file.txt"))
+
+	err := backupFS.Rollback()
+	require.ErrorIs(err, ErrMissingBackup)
+
+	var lines []RollbackProgress
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line RollbackProgress
+		require.NoError(json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.NoError(scanner.Err())
+	require.Len(lines, 6)
+
+	for i, line := range lines {
+		require.Equal(uint64(i+1), line.Seq)
+		require.False(line.Time.Before(start))
+	}
+
+	// newest generation first
+	require.Equal(ProgressStarted, lines[0].Event)
+	require.Equal(1, lines[0].Generation)
+	require.Equal(1, lines[0].Total)
+
+	require.Equal(ProgressRemoved, lines[1].Event)
+	require.Equal(1, lines[1].Generation)
+	require.Equal("/test/created.txt", lines[1].Path)
+
+	require.Equal(ProgressStarted, lines[2].Event)
+	require.Equal(0, lines[2].Generation)
+	require.Equal(2, lines[2].Total)
+
+	require.Equal(ProgressRestored, lines[3].Event)
+	require.Equal("/test", lines[3].Path)
+
+	require.Equal(ProgressFailed, lines[4].Event)
+	require.Equal("/test/file.txt", lines[4].Path)
+	require.Equal(CodeBackupMissing, lines[4].Code)
+	require.NotEmpty(lines[4].Error)
+
+	require.Equal(ProgressFinished, lines[5].Event)
+	require.Equal(1, lines[5].Removed)
+	require.Equal(2, lines[5].Restored)
+	require.NotEmpty(lines[5].Error)
+
+	// a successful rollback starts a new stream
+	buf.Reset()
+	createFile(t, backupFS, "/test/other.txt", "other")
+	require.NoError(backupFS.Rollback())
+	mustNotExist(t, base, "/test/other.txt")
+
+	lines = lines[:0]
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var line RollbackProgress
+		require.NoError(dec.Decode(&line))
+		lines = append(lines, line)
+	}
+	require.Len(lines, 3)
+	require.Equal(uint64(1), lines[0].Seq)
+	require.Equal(ProgressFinished, lines[2].Event)
+	require.Empty(lines[2].Error)
+}
+
+func TestBackupFS_WithProgressFunc(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backup   = NewMemFS()
+		progress []Progress
+	)
+	backupFS := NewBackupFS(base, backup, WithProgressFunc(func(p Progress) {
+		progress = append(progress, p)
+	}))
+
+	createFile(t, base, "/tree/a.txt", "aaa")
+	createFile(t, base, "/tree/sub/b.txt", "bb")
+
+	require.NoError(backupFS.RemoveAll("/tree"))
+
+	require.Equal(Progress{Phase: PhaseBackup, Event: ProgressStarted, Total: 4}, progress[0])
+	require.Equal(Progress{Phase: PhaseBackup, Event: ProgressFinished, Files: 4, Total: 4}, progress[len(progress)-1])
+
+	backedUp := make(map[string]int64)
+	removed := 0
+	for _, p := range progress[1 : len(progress)-1] {
+		require.Equal(PhaseBackup, p.Phase)
+		require.Equal(4, p.Total)
+		switch p.Event {
+		case ProgressBackedUp:
+			backedUp[p.Path] = p.Bytes
+		case ProgressRemoved:
+			removed++
+			require.Equal(removed, p.Files)
+		default:
+			require.Failf("unexpected event", "%s: %s", p.Event, p.Path)
+		}
+	}
+	require.Equal(4, removed)
+	require.Equal(int64(3), backedUp["/tree/a.txt"])
+	require.Equal(int64(2), backedUp["/tree/sub/b.txt"])
+	require.Contains(backedUp, "/tree/sub")
+
+	progress = nil
+	require.NoError(backupFS.Rollback())
+
+	require.Equal(PhaseRollback, progress[0].Phase)
+	require.Equal(ProgressStarted, progress[0].Event)
+	total := progress[0].Total
+	require.Equal(Progress{Phase: PhaseRollback, Event: ProgressFinished, Files: total, Total: total}, progress[len(progress)-1])
+
+	restored := make(map[string]int64)
+	for _, p := range progress[1 : len(progress)-1] {
+		require.Equal(ProgressRestored, p.Event)
+		restored[p.Path] = p.Bytes
+	}
+	require.Len(restored, total)
+	require.Equal(int64(3), restored["/tree/a.txt"])
+	fileMustContainText(t, base, "/tree/sub/b.txt", "bb")
+}
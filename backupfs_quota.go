@@ -0,0 +1,53 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+var (
+	// ErrQuotaExceeded is returned by modifying operations in case that the backup of a file would exceed
+	// the byte quota of the backup filesystem, see WithBackupQuota.
+	ErrQuotaExceeded = errors.New("backup quota exceeded")
+)
+
+// countBackupBytes estimates the number of bytes that the backups of the tracked regular files occupy.
+// The content of compacted subtrees is not tracked and therefore not counted.
+func countBackupBytes(infos *trackedInfos) int64 {
+	var cnt int64
+	infos.each(func(_ string, fi fs.FileInfo) bool {
+		if fi == nil || isPlaceholderInfo(fi) || isSnapshotInfo(fi) || !fi.Mode().IsRegular() {
+			// nothing was backed up
+			return true
+		}
+		cnt += fi.Size()
+		return true
+	})
+	return cnt
+}
+
+// totalBackupBytes returns the estimated number of bytes of the backups of all generations.
+func (fsys *BackupFS) totalBackupBytes() int64 {
+	total := fsys.backupBytes
+	for _, g := range fsys.generations {
+		total += g.backupBytes
+	}
+	return total
+}
+
+// reserveBytes must be called before a regular file is copied into the backup filesystem.
+// It fails early in case that the byte quota would be exceeded.
+func (fsys *BackupFS) reserveBytes(info fs.FileInfo) error {
+	quota := fsys.opts.backupQuota
+	if quota > 0 && fsys.totalBackupBytes()+info.Size() > quota {
+		return fmt.Errorf("%w: %d bytes", ErrQuotaExceeded, quota)
+	}
+	fsys.backupBytes += info.Size()
+	return nil
+}
+
+// releaseBytes releases the bytes of reserveBytes in case that the file has not been backed up.
+func (fsys *BackupFS) releaseBytes(info fs.FileInfo) {
+	fsys.backupBytes -= info.Size()
+}
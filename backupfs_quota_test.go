@@ -0,0 +1,88 @@
+package backupfs
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithBackupQuota(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = NewMemFS()
+		content = strings.Repeat("x", 10)
+	)
+	backupFS := NewBackupFS(base, backup, WithBackupQuota(25), WithSubtreeCompaction(true))
+
+	createFile(t, base, "/test/dir/a.txt", content)
+	createFile(t, base, "/test/dir/b.txt", content)
+	createFile(t, base, "/test/dir/c.txt", content)
+	initialState := createFSState(t, base, "/")
+
+	createFile(t, backupFS, "/test/dir/a.txt", "modified")
+	require.Equal(int64(10), backupFS.Stats().TotalBackupBytes)
+	require.Equal(int64(25), backupFS.Stats().BackupQuota)
+
+	// the usage of previous generations counts as well
+	require.NoError(backupFS.Snapshot("first"))
+	createFile(t, backupFS, "/test/dir/b.txt", "modified")
+	require.Equal(int64(20), backupFS.Stats().TotalBackupBytes)
+
+	// fails before the base filesystem is modified
+	err := backupFS.Remove("/test/dir/c.txt")
+	require.ErrorIs(err, ErrQuotaExceeded)
+	fileMustContainText(t, base, "/test/dir/c.txt", content)
+
+	// new files do not require backups
+	createFile(t, backupFS, "/test/dir/d.txt", content)
+	require.Equal(int64(20), backupFS.Stats().TotalBackupBytes)
+
+	require.NoError(backupFS.Rollback())
+	require.Equal(int64(0), backupFS.Stats().TotalBackupBytes)
+	mustEqualFSState(t, initialState, base, "/")
+
+	// whole subtrees are checked before anything is backed up
+	err = backupFS.RemoveAll("/test")
+	require.ErrorIs(err, ErrQuotaExceeded)
+	fileMustContainText(t, base, "/test/dir/c.txt", content)
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, initialState, base, "/")
+}
+
+func TestBackupFS_WithBackupQuotaFailedBackup(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = &flakyFS{FS: NewMemFS(), err: syscall.EACCES}
+	)
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, base, "/dir/a.txt", "aaaa")
+	createFile(t, base, "/dir/b.txt", "bbbb")
+	initialState := createFSState(t, base, "/")
+
+	// the bytes of failed backups are released
+	backupFS := NewBackupFS(base, backup, WithBackupQuota(10))
+	backup.failures = 1
+	require.ErrorIs(backupFS.Chmod("/test/file.txt", 0600), syscall.EACCES)
+	require.Equal(int64(0), backupFS.Stats().TotalBackupBytes)
+	require.NoError(backupFS.Chmod("/test/file.txt", 0600))
+	require.Equal(int64(8), backupFS.Stats().TotalBackupBytes)
+	require.NoError(backupFS.Rollback())
+
+	// failed parallel backups are retried
+	backupFS = NewBackupFS(base, backup, WithBackupQuota(10), WithBackupWorkers(2))
+	backup.failures = 1
+	removeAll(t, backupFS, "/dir")
+	require.Equal(int64(8), backupFS.Stats().TotalBackupBytes)
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, initialState, base, "/")
+}
@@ -0,0 +1,130 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// RestoreRange restores length bytes of the regular file name starting at offset off from its backup,
+// without rewriting the rest of the file, e.g. in order to undo a corrupted header of a huge file.
+// The bytes are restored to their state at the beginning of the transaction, which is the oldest backup
+// of the file in case that snapshots were taken. Bytes beyond the original size of the file are not modified.
+// The file stays tracked, a subsequent Rollback restores the whole file.
+//
+// Files that did not exist or were not backed up are reported with ErrMissingBackup,
+// files of which only the metadata was backed up with ErrContentNotBackedUp, see WithPlaceholders.
+func (fsys *BackupFS) RestoreRange(name string, off, length int64) (err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpRestoreRange, name, err)
+		}
+	}()
+
+	if off < 0 || length < 0 {
+		return syscall.EINVAL
+	}
+
+	defer fsys.lock(OpRestoreRange)()
+
+	resolvedName, err := fsys.realTargetPath(name)
+	if err != nil {
+		return err
+	}
+
+	backup, info, err := fsys.originalBackup(resolvedName)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s", errFileInfoExpected, resolvedName)
+	}
+
+	length = min(length, info.Size()-off)
+	if length <= 0 {
+		// the file did not contain this range
+		return nil
+	}
+
+	if fsys.opts.dryRun {
+		return fsys.plan(OpRestoreRange, resolvedName)
+	}
+
+	src, err := backup.Open(resolvedName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := fsys.base.OpenFile(resolvedName, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, dst.Close())
+	}()
+
+	var (
+		r   = io.NewSectionReader(src, off, length)
+		w   = io.NewOffsetWriter(dst, off)
+		buf []byte
+	)
+	if fsys.opts.bufferSize > 0 {
+		buf = make([]byte, fsys.opts.bufferSize)
+	}
+	_, err = io.CopyBuffer(w, r, buf)
+	return err
+}
+
+// originalBackup returns the backup filesystem and the recorded file info of the oldest backup of resolvedName.
+func (fsys *BackupFS) originalBackup(resolvedName string) (FS, fs.FileInfo, error) {
+	for _, g := range fsys.allGenerations() {
+		info, found := g.baseInfos.get(resolvedName)
+		if !found {
+			root, ok := subtreeRootOf(g.baseInfos, resolvedName)
+			if !ok {
+				continue
+			}
+			if isSnapshotInfo(g.baseInfos.info(root)) {
+				return nil, nil, fmt.Errorf("%w: backed up with a subtree snapshot", ErrSnapshotUnsupported)
+			}
+
+			// files within compacted subtrees are not tracked individually
+			fi, err := g.backup.Lstat(resolvedName)
+			if err != nil {
+				if isNotFoundError(err) {
+					return nil, nil, ErrMissingBackup
+				}
+				return nil, nil, err
+			}
+			return g.backup, fi, nil
+		}
+
+		switch {
+		case info == nil:
+			return nil, nil, fmt.Errorf("%w: file did not exist", ErrMissingBackup)
+		case isPlaceholderInfo(info):
+			return nil, nil, ErrContentNotBackedUp
+		}
+		info, err := loadFileInfo(info)
+		if err != nil {
+			return nil, nil, err
+		}
+		return g.backup, info, nil
+	}
+	return nil, nil, ErrMissingBackup
+}
+
+// subtreeRootOf returns the root directory of the compacted subtree in baseInfos that contains resolvedName.
+func subtreeRootOf(baseInfos *trackedInfos, resolvedName string) (string, bool) {
+	for dir := filepath.Dir(resolvedName); dir != resolvedName; resolvedName, dir = dir, filepath.Dir(dir) {
+		if isSubtreeInfo(baseInfos.info(dir)) {
+			return dir, true
+		}
+	}
+	return "", false
+}
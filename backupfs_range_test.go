@@ -0,0 +1,62 @@
+package backupfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_RestoreRange(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = NewMemFS()
+	)
+	backupFS := NewBackupFS(base, backup, WithBufferSize(2), WithPlaceholders(64, false))
+
+	createFile(t, base, "/test/file.bin", "HEADER|payload")
+	createFile(t, base, "/test/huge.bin", strings.Repeat("x", 128))
+
+	f, err := backupFS.OpenFile("/test/file.bin", os.O_WRONLY, 0)
+	require.NoError(err)
+	_, err = f.WriteAt([]byte("broken"), 0)
+	require.NoError(err)
+	_, err = f.WriteAt([]byte("PAYLOAD"), 7)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	require.NoError(backupFS.Snapshot("snapshot"))
+	f, err = backupFS.OpenFile("/test/file.bin", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(err)
+	_, err = f.WriteString("|trailer")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	// only the header is restored from the oldest backup
+	require.NoError(backupFS.RestoreRange("/test/file.bin", 0, 6))
+	fileMustContainText(t, base, "/test/file.bin", "HEADER|PAYLOAD|trailer")
+
+	// the range is limited to the original size
+	require.NoError(backupFS.RestoreRange("/test/file.bin", 10, 100))
+	fileMustContainText(t, base, "/test/file.bin", "HEADER|PAYload|trailer")
+	require.NoError(backupFS.RestoreRange("/test/file.bin", 20, 100))
+	fileMustContainText(t, base, "/test/file.bin", "HEADER|PAYload|trailer")
+
+	createFile(t, backupFS, "/test/new.bin", "new")
+	require.ErrorIs(backupFS.RestoreRange("/test/new.bin", 0, 1), ErrMissingBackup)
+
+	createFile(t, backupFS, "/test/huge.bin", "modified")
+	require.ErrorIs(backupFS.RestoreRange("/test/huge.bin", 0, 1), ErrContentNotBackedUp)
+
+	createFile(t, base, "/test/untouched.bin", "untouched")
+	require.ErrorIs(backupFS.RestoreRange("/test/untouched.bin", 0, 1), ErrMissingBackup)
+	require.Error(backupFS.RestoreRange("/test/file.bin", -1, 1))
+
+	// the file stays tracked, the placeholder content cannot be restored
+	require.ErrorIs(backupFS.Rollback(), ErrContentNotBackedUp)
+	fileMustContainText(t, base, "/test/file.bin", "HEADER|payload")
+}
@@ -0,0 +1,67 @@
+package backupfs
+
+import (
+	"sort"
+)
+
+// trackRead records a path that has been read, see WithReadTracking.
+func (fsys *BackupFS) trackRead(name string) {
+	if !fsys.opts.readTracking {
+		return
+	}
+
+	fsys.readsMu.Lock()
+	defer fsys.readsMu.Unlock()
+
+	if fsys.reads == nil {
+		fsys.reads = make(map[string]struct{})
+	}
+	fsys.reads[normalizePath(name)] = struct{}{}
+}
+
+// resetReads starts a new read set for the next transaction.
+func (fsys *BackupFS) resetReads() {
+	fsys.readsMu.Lock()
+	defer fsys.readsMu.Unlock()
+
+	fsys.reads = nil
+}
+
+// ReadSet returns the sorted paths that have been read but not modified since the BackupFS
+// has been created or since the last Commit or Rollback, see WithReadTracking.
+// Parent directories of modified paths count as modified, as they are backed up as well.
+// Paths are recorded as they were passed to the read operations, without resolving symlinks.
+// Returns nil in case that read tracking is disabled.
+func (fsys *BackupFS) ReadSet() []string {
+	defer fsys.rlockState()()
+
+	fsys.readsMu.Lock()
+	defer fsys.readsMu.Unlock()
+
+	if !fsys.opts.readTracking {
+		return nil
+	}
+
+	paths := make([]string, 0, len(fsys.reads))
+	for path := range fsys.reads {
+		if fsys.modified(path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// modified returns true in case that the path has been modified in any generation.
+func (fsys *BackupFS) modified(path string) bool {
+	if _, found := fsys.baseInfos.get(path); found {
+		return true
+	}
+	for _, g := range fsys.generations {
+		if _, found := g.baseInfos.get(path); found {
+			return true
+		}
+	}
+	return false
+}
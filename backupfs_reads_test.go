@@ -0,0 +1,52 @@
+package backupfs
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithReadTracking(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+	)
+	backupFS := NewBackupFS(base, NewMemFS(), WithReadTracking())
+
+	createFile(t, base, "/etc/app/config.yaml", "config")
+	createFile(t, base, "/etc/app/secrets.yaml", "secrets")
+	createSymlink(t, base, "/etc/app/config.yaml", "/etc/app/link")
+	createFile(t, base, "/usr/share/data.txt", "data")
+
+	f, err := backupFS.Open("/etc/app/config.yaml")
+	require.NoError(err)
+	_, err = io.ReadAll(f)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	_, err = backupFS.Stat("/etc/app/secrets.yaml")
+	require.NoError(err)
+	_, err = backupFS.Readlink("/etc/app/link")
+	require.NoError(err)
+	_, err = backupFS.ReadDir("/usr/share")
+	require.NoError(err)
+
+	// modified paths and their backed up parent directories are not part of the read set
+	createFile(t, backupFS, "/etc/app/secrets.yaml", "new secrets")
+
+	require.Equal([]string{
+		filepath.FromSlash("/etc/app/config.yaml"),
+		filepath.FromSlash("/etc/app/link"),
+		filepath.FromSlash("/usr/share"),
+	}, backupFS.ReadSet())
+
+	require.NoError(backupFS.Commit())
+	require.Empty(backupFS.ReadSet())
+
+	// disabled by default
+	require.Nil(NewBackupFS(base, NewMemFS()).ReadSet())
+}
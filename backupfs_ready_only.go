@@ -8,32 +8,45 @@ import (
 func (fsys *BackupFS) Lstat(name string) (fi fs.FileInfo, err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "lstat", Path: name, Err: err}
+			err = newBackupError(OpLstat, name, err)
 		}
 	}()
 
+	fsys.trackRead(name)
+	if fsys.opts.isolation == IsolationSnapshot {
+		return fsys.snapshotLstat(name)
+	}
 	return fsys.base.Lstat(name)
 }
 
 // Stat returns a FileInfo describing the named file, or an error, if any happens.
-// Stat only looks at the base filesystem and returns the stat of the files at the specified path
+// Stat only looks at the base filesystem and returns the stat of the files at the specified path,
+// see WithIsolation.
 func (fsys *BackupFS) Stat(name string) (_ fs.FileInfo, err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "stat", Path: name, Err: err}
+			err = newBackupError(OpStat, name, err)
 		}
 	}()
 
+	fsys.trackRead(name)
+	if fsys.opts.isolation == IsolationSnapshot {
+		return fsys.snapshotStat(name)
+	}
 	return fsys.base.Stat(name)
 }
 
 func (fsys *BackupFS) Readlink(name string) (_ string, err error) {
 	defer func() {
 		if err != nil {
-			err = &os.PathError{Op: "readlink", Path: name, Err: err}
+			err = newBackupError(OpReadlink, name, err)
 		}
 	}()
 
+	fsys.trackRead(name)
+	if fsys.opts.isolation == IsolationSnapshot {
+		return fsys.snapshotReadlink(name)
+	}
 	path, err := fsys.base.Readlink(name)
 	if err != nil {
 		return "", err
@@ -41,6 +54,22 @@ func (fsys *BackupFS) Readlink(name string) (_ string, err error) {
 	return path, nil
 }
 
+// ReadDir reads the named directory of the base filesystem and returns
+// all its directory entries sorted by filename.
+func (fsys *BackupFS) ReadDir(name string) (_ []fs.DirEntry, err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpReadDir, name, err)
+		}
+	}()
+
+	fsys.trackRead(name)
+	if fsys.opts.isolation == IsolationSnapshot {
+		return fsys.snapshotReadDir(name)
+	}
+	return fsys.base.ReadDir(name)
+}
+
 // Open opens a file, returning it or an error, if any happens.
 // This returns a ready only file
 func (fsys *BackupFS) Open(name string) (File, error) {
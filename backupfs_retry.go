@@ -0,0 +1,67 @@
+package backupfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// permanentErrors are not retried, as another attempt fails the same way.
+var permanentErrors = []error{
+	fs.ErrNotExist,
+	fs.ErrExist,
+	fs.ErrPermission,
+	fs.ErrInvalid,
+	fs.ErrClosed,
+	errors.ErrUnsupported,
+	syscall.ENOTDIR,
+	syscall.EISDIR,
+	syscall.ENOTEMPTY,
+	syscall.ELOOP,
+	syscall.ENAMETOOLONG,
+	syscall.EROFS,
+	ErrInodeQuotaExceeded,
+	ErrQuotaExceeded,
+	ErrContentNotBackedUp,
+	ErrReflinkUnsupported,
+	context.Canceled,
+	context.DeadlineExceeded,
+}
+
+// isTransientError returns true in case that err might not occur again, e.g. a timeout of a network filesystem.
+func isTransientError(err error) bool {
+	for _, perr := range permanentErrors {
+		if errors.Is(err, perr) {
+			return false
+		}
+	}
+	return true
+}
+
+// retry calls f until it succeeds, fails with a permanent error or the attempts of WithRetry are exhausted.
+// The wait time between two attempts starts with the backoff of WithRetry and doubles after every attempt.
+// The last error is returned, the wait is interrupted in case that ctx is canceled.
+func (fsys *BackupFS) retry(ctx context.Context, f func() error) error {
+	var (
+		attempts = max(fsys.opts.retryAttempts, 1)
+		backoff  = fsys.opts.retryBackoff
+		err      error
+	)
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || attempt >= attempts || !isTransientError(err) {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,89 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errFlaky = errors.New("flaky network filesystem")
+
+// flakyFS fails the first failures calls of OpenFile with write flags and of Remove.
+type flakyFS struct {
+	FS
+
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyFS) fail() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag != os.O_RDONLY {
+		if err := f.fail(); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return f.FS.OpenFile(name, flag, perm)
+}
+
+func (f *flakyFS) Remove(name string) error {
+	if err := f.fail(); err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return f.FS.Remove(name)
+}
+
+func TestBackupFS_Retry(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = &flakyFS{FS: NewMemFS(), err: errFlaky}
+	)
+	createFile(t, base, "/test/file.txt", "original")
+
+	// without retries the first transient error aborts the modification
+	backup.failures = 1
+	backupFS := NewBackupFS(base, backup)
+	err := backupFS.Chmod("/test/file.txt", 0600)
+	require.ErrorIs(err, errFlaky)
+
+	// the backup is retried
+	backup.failures = 2
+	backupFS = NewBackupFS(base, backup, WithRetry(3, time.Millisecond))
+	createFile(t, backupFS, "/test/file.txt", "modified")
+
+	// the rollback is retried
+	flakyBase := &flakyFS{FS: base, err: errFlaky}
+	backupFS = NewBackupFS(flakyBase, NewMemFS(), WithRetry(3, time.Millisecond))
+	createFile(t, backupFS, "/test/created.txt", "created")
+	flakyBase.failures = 2
+	require.NoError(backupFS.Rollback())
+	mustNotExist(t, base, "/test/created.txt")
+
+	// permanent errors are not retried
+	backup = &flakyFS{FS: NewMemFS(), err: fs.ErrPermission, failures: 1}
+	backupFS = NewBackupFS(base, backup, WithRetry(3, time.Millisecond))
+	err = backupFS.Chmod("/test/file.txt", 0600)
+	require.ErrorIs(err, fs.ErrPermission)
+	require.Equal(1, backup.calls)
+}
@@ -0,0 +1,133 @@
+package backupfs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// seal returns the HMAC of the manifest of a generation, see WithSealing.
+func (fsys *BackupFS) seal(backup FS, baseInfos *trackedInfos) ([]byte, error) {
+	mac := hmac.New(sha256.New, fsys.opts.sealKey)
+	err := writeManifest(mac, backup, baseInfos)
+	if err != nil {
+		return nil, err
+	}
+	return mac.Sum(nil), nil
+}
+
+// VerifySeals checks that the backups of all sealed generations have not been modified
+// since their snapshots were taken. Modified generations are reported with ErrSealBroken.
+// Returns nil in case that sealing is disabled, see WithSealing.
+func (fsys *BackupFS) VerifySeals() error {
+	defer fsys.lock(OpVerifySeals)()
+
+	return fsys.verifySeals(0)
+}
+
+// verifySeals verifies the seals of all generations starting at the generation with the index from.
+func (fsys *BackupFS) verifySeals(from int) error {
+	if len(fsys.opts.sealKey) == 0 {
+		return nil
+	}
+
+	for _, g := range fsys.generations[from:] {
+		if g.seal == nil {
+			// taken before sealing was enabled
+			continue
+		}
+
+		sum, err := fsys.seal(g.backup, g.baseInfos)
+		if err != nil {
+			return newBackupError(OpVerifySeals, g.name, fmt.Errorf("%w: %w", ErrSealBroken, err))
+		}
+		if !hmac.Equal(sum, g.seal) {
+			return newBackupError(OpVerifySeals, g.name, ErrSealBroken)
+		}
+	}
+	return nil
+}
+
+// writeManifest writes one line per tracked path sorted by path.
+// Every line describes the backup of the path in the backup filesystem.
+func writeManifest(w io.Writer, backup FS, baseInfos *trackedInfos) error {
+	paths := baseInfos.paths()
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		info := baseInfos.info(path)
+		switch {
+		case info == nil:
+			// nothing was backed up
+			fmt.Fprintf(w, "%q created\n", path)
+		case isPlaceholderInfo(info):
+			// only the metadata was recorded
+			fmt.Fprintf(w, "%q placeholder %d %d\n", path, info.Mode(), info.Size())
+		case isSnapshotInfo(info):
+			// the subtree is not part of the backup filesystem
+			fmt.Fprintf(w, "%q snapshot\n", path)
+		case isSubtreeInfo(info):
+			err := Walk(backup, path, func(subPath string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				return writeManifestEntry(w, backup, subPath, info)
+			})
+			if err != nil {
+				return err
+			}
+		default:
+			fi, err := backup.Lstat(path)
+			if err != nil {
+				return err
+			}
+			err = writeManifestEntry(w, backup, path, fi)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeManifestEntry describes the backup of a single file.
+// info must be the Lstat result of the path in the backup filesystem.
+func writeManifestEntry(w io.Writer, backup FS, path string, info fs.FileInfo) error {
+	mode := info.Mode()
+	switch {
+	case mode.IsRegular():
+		sum, err := hashFile(backup, path, sha256.New())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%q %d %d %x\n", path, mode, info.Size(), sum)
+	case mode&os.ModeSymlink != 0:
+		target, err := backup.Readlink(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%q %d %q\n", path, mode, target)
+	default:
+		fmt.Fprintf(w, "%q %d\n", path, mode)
+	}
+	return nil
+}
+
+func hashFile(fsys FS, path string, h hash.Hash) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
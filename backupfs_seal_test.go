@@ -0,0 +1,66 @@
+package backupfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithSealing(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = NewMemFS()
+	)
+	backupFS := NewBackupFS(base, backup, WithSealing([]byte("secret")))
+
+	createFile(t, base, "/test/file.txt", "original")
+	createSymlink(t, base, "/test/file.txt", "/test/link")
+	createFile(t, base, "/test/dir/nested.txt", "nested")
+
+	createFile(t, backupFS, "/test/file.txt", "first")
+	require.NoError(backupFS.Remove("/test/link"))
+	require.NoError(backupFS.RemoveAll("/test/dir"))
+	require.NoError(backupFS.Snapshot("first"))
+	require.NoError(backupFS.VerifySeals())
+
+	createFile(t, backupFS, "/test/file.txt", "second")
+	require.NoError(backupFS.Snapshot("second"))
+	createFile(t, backupFS, "/test/file.txt", "third")
+
+	// the current generation is not sealed
+	require.NoError(backupFS.RollbackTo("second"))
+	fileMustContainText(t, base, "/test/file.txt", "second")
+	require.NoError(backupFS.VerifySeals())
+
+	// the backup of the oldest generation is stored directly in the backup filesystem
+	createFile(t, backup, "/test/dir/nested.txt", "tampered")
+	require.ErrorIs(backupFS.VerifySeals(), ErrSealBroken)
+
+	// newer generations can still be rolled back
+	require.NoError(backupFS.RollbackTo("first"))
+	fileMustContainText(t, base, "/test/file.txt", "first")
+
+	err := backupFS.Rollback()
+	require.ErrorIs(err, ErrSealBroken)
+	require.ErrorIs(err, ErrRollbackFailed)
+
+	var rerr *RollbackError
+	require.ErrorAs(err, &rerr)
+	require.Len(rerr.Errors, 1)
+	require.Equal(CodeSealBroken, rerr.Errors[0].Code)
+
+	// nothing was restored
+	fileMustContainText(t, base, "/test/file.txt", "first")
+	mustNotExist(t, base, "/test/dir")
+	require.Equal([]string{"first"}, backupFS.Snapshots())
+
+	// restoring the original backup repairs the seal
+	createFile(t, backup, "/test/dir/nested.txt", "nested")
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, "/test/file.txt", "original")
+	fileMustContainText(t, base, "/test/dir/nested.txt", "nested")
+	symlinkMustExistWithTragetPath(t, base, "/test/link", "/test/file.txt")
+}
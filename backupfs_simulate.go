@@ -0,0 +1,330 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RollbackSimulation is the result of a simulated rollback.
+type RollbackSimulation struct {
+	// Base is an in-memory clone of all affected paths of the base filesystem
+	// in the state after the simulated rollback.
+	// The content of files that were not backed up is not cloned, such files are empty.
+	Base *MemFS
+	// State contains the file infos of all tracked paths after the simulated rollback.
+	// The file info is nil in case that the path does not exist after the rollback.
+	State map[string]fs.FileInfo
+	// Errors contains all errors that are expected to occur during the actual rollback.
+	Errors []error
+	// Report is the report of the simulated rollback.
+	Report RollbackReport
+}
+
+// SimulateRollback clones all affected paths of the base and backup filesystem into in-memory
+// filesystems and executes the rollback against these clones.
+// The real base and backup filesystems are not modified.
+// It predicts errors like missing backups (CodeBackupMissing) or missing write permissions that would
+// occur during the actual rollback.
+// Subtrees that were backed up with native filesystem snapshots cannot be simulated and are skipped.
+func (fsys *BackupFS) SimulateRollback() (_ *RollbackSimulation, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to simulate rollback: %w", err)
+		}
+	}()
+
+	defer fsys.lock(OpSimulateRollback)()
+
+	var (
+		simBase   = NewMemFSWithClock(fsys.opts.clock)
+		simBackup = NewMemFSWithClock(fsys.opts.clock)
+		opts      = *fsys.opts
+		predicted = make([]error, 0)
+		sim       = &BackupFS{
+			base:       simBase,
+			backup:     simBackup,
+			rootBackup: simBackup,
+			baseInfos:  newTrackedInfos(nil, StateIndexMemory),
+			opts:       &opts,
+		}
+		baseCloner   = newMemCloner(fsys.base, simBase, false)
+		backupCloner = newMemCloner(fsys.backup, simBackup, true)
+	)
+	// snapshots cannot be restored in memory
+	opts.subtreeSnapshotter = nil
+
+	paths := fsys.baseInfos.paths()
+	sort.Sort(ByLeastFilePathSeparators(paths))
+
+	for _, path := range paths {
+		info, err := fsys.baseInfos.load(path)
+		if err != nil {
+			return nil, err
+		}
+		if isSnapshotInfo(info) {
+			continue
+		}
+		err = sim.baseInfos.set(path, info)
+		if err != nil {
+			return nil, err
+		}
+
+		err = baseCloner.clone(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if perr := fsys.predictPermissionError(path); perr != nil {
+			predicted = append(predicted, perr)
+		}
+
+		if info == nil {
+			continue
+		}
+
+		if isSubtreeInfo(info) {
+			err = backupCloner.cloneTree(path)
+		} else {
+			err = backupCloner.clone(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = errors.Join(baseCloner.finish(), backupCloner.finish())
+	if err != nil {
+		return nil, err
+	}
+	sim.subtrees = countSubtrees(sim.baseInfos)
+
+	rollbackErr := sim.Rollback()
+	if rollbackErr != nil {
+		predicted = append(predicted, unwrapJoined(rollbackErr)...)
+	}
+
+	state := make(map[string]fs.FileInfo, len(paths))
+	for _, path := range paths {
+		fi, _, err := lexists(simBase, path)
+		if err != nil {
+			predicted = append(predicted, err)
+		}
+		state[path] = fi
+	}
+
+	return &RollbackSimulation{
+		Base:   simBase,
+		State:  state,
+		Errors: predicted,
+		Report: *sim.lastRollback,
+	}, nil
+}
+
+// predictPermissionError checks whether the parent directory of the path is writable
+func (fsys *BackupFS) predictPermissionError(path string) error {
+	parent := filepath.Dir(path)
+	if parent == path {
+		return nil
+	}
+
+	fi, found, err := lexists(fsys.base, parent)
+	if err != nil || !found {
+		return nil
+	}
+	if !isWritable(fi) {
+		return newBackupError(OpSimulateRollback, path, fs.ErrPermission)
+	}
+	return nil
+}
+
+// isWritable checks the permission bits of the file info for the current user.
+// Returns true in case that the ownership cannot be determined.
+func isWritable(fi fs.FileInfo) bool {
+	uid, gid := toUID(fi), toGID(fi)
+	euid := os.Geteuid()
+	if uid < 0 || euid <= 0 {
+		// unknown ownership or root user
+		return true
+	}
+
+	perm := fi.Mode().Perm()
+	switch {
+	case uid == euid:
+		return perm&0200 != 0
+	case gid == os.Getegid():
+		return perm&0020 != 0
+	default:
+		return perm&0002 != 0
+	}
+}
+
+func newMemCloner(src FS, dst *MemFS, withContent bool) *memCloner {
+	return &memCloner{
+		src:         src,
+		dst:         dst,
+		withContent: withContent,
+		dirs:        make(map[string]fs.FileInfo),
+		opts:        &backupFSOptions{},
+	}
+}
+
+// memCloner clones paths of a filesystem into an in-memory filesystem.
+type memCloner struct {
+	src         FS
+	dst         *MemFS
+	withContent bool
+	// cloned directories, their metadata is reapplied at the end
+	dirs map[string]fs.FileInfo
+	opts *backupFSOptions
+}
+
+// clone clones the path, its parent directories and in case of a directory its direct children.
+func (c *memCloner) clone(path string) error {
+	fi, found, err := lexists(c.src, path)
+	if err != nil || !found {
+		return err
+	}
+
+	err = c.cloneParents(path)
+	if err != nil {
+		return err
+	}
+
+	err = c.cloneEntry(path, fi, c.withContent)
+	if err != nil || !fi.IsDir() || c.withContent {
+		return err
+	}
+
+	// untracked directory content prevents the removal of directories in the base filesystem
+	f, err := c.src.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	children, err := f.Readdir(-1)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		err = c.cloneEntry(filepath.Join(path, child.Name()), child, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneTree clones the whole directory tree
+func (c *memCloner) cloneTree(root string) error {
+	_, found, err := lexists(c.src, root)
+	if err != nil || !found {
+		return err
+	}
+
+	err = c.cloneParents(root)
+	if err != nil {
+		return err
+	}
+
+	return Walk(c.src, root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return c.cloneEntry(path, info, c.withContent)
+	})
+}
+
+func (c *memCloner) cloneParents(path string) error {
+	parent := filepath.Dir(path)
+	if parent == path {
+		return nil
+	}
+
+	_, err := IterateDirTree(parent, func(dir string) (bool, error) {
+		if _, found := c.dirs[dir]; found {
+			return true, nil
+		}
+		fi, found, err := lexists(c.src, dir)
+		if err != nil || !found {
+			return false, err
+		}
+		return true, c.cloneEntry(dir, fi, false)
+	})
+	return err
+}
+
+func (c *memCloner) cloneEntry(path string, fi fs.FileInfo, withContent bool) error {
+	if _, found, err := lexists(c.dst, path); err != nil || found {
+		return err
+	}
+
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		c.dirs[path] = fi
+		return copyDir(c.dst, path, fi, c.opts)
+	case mode.IsRegular():
+		if withContent {
+			f, err := c.src.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return copyFile(c.dst, path, fi, f, c.opts)
+		}
+
+		f, err := c.dst.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+		if err != nil {
+			return err
+		}
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+		return c.cloneMetadata(path, fi)
+	case mode&os.ModeSymlink != 0:
+		return copySymlink(c.src, c.dst, path, fi, c.opts)
+	default:
+		// other file types are cloned as empty files
+		f, err := c.dst.Create(path)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
+
+func (c *memCloner) cloneMetadata(path string, fi fs.FileInfo) error {
+	err := c.dst.Chmod(path, fi.Mode())
+	if err != nil {
+		return err
+	}
+	err = c.dst.Chtimes(path, fi.ModTime(), fi.ModTime())
+	if err != nil {
+		return err
+	}
+	return c.dst.Lchown(path, toUID(fi), toGID(fi))
+}
+
+// finish reapplies the metadata of directories, as their modification times
+// change when their content is cloned.
+func (c *memCloner) finish() error {
+	paths := make([]string, 0, len(c.dirs))
+	for path := range c.dirs {
+		paths = append(paths, path)
+	}
+	sort.Sort(ByMostFilePathSeparators(paths))
+
+	var multiErr error
+	for _, path := range paths {
+		err := c.dst.Chtimes(path, c.dirs[path].ModTime(), c.dirs[path].ModTime())
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+	return multiErr
+}
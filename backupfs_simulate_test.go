@@ -0,0 +1,102 @@
+package backupfs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_SimulateRollback(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+		newFilePath               = filepath.FromSlash("/test/new/new.txt")
+		symlinkPath               = filepath.FromSlash("/test/link")
+	)
+
+	createFile(t, base, filePath, "original")
+	createSymlink(t, base, filePath, symlinkPath)
+	mkdirAll(t, base, "/test/dir/subdir", 0755)
+	createFile(t, base, "/test/dir/subdir/nested.txt", "nested")
+
+	createFile(t, backupFS, filePath, "modified")
+	createFile(t, backupFS, newFilePath, "new")
+	removeAll(t, backupFS, "/test/dir")
+	require.NoError(backupFS.Remove(symlinkPath))
+
+	baseState := createFSState(t, base, "/")
+	backupState := createFSState(t, backup, "/")
+
+	sim, err := backupFS.SimulateRollback()
+	require.NoError(err)
+	require.Empty(sim.Errors)
+	require.Empty(sim.Report.Error)
+	require.NotZero(sim.Report.Removed)
+	require.NotZero(sim.Report.Restored)
+
+	// real filesystems are untouched
+	mustEqualFSState(t, baseState, base, "/")
+	mustEqualFSState(t, backupState, backup, "/")
+	require.NotEmpty(backupFS.TrackedPaths())
+
+	// virtual state after rollback
+	fileMustContainText(t, sim.Base, filePath, "original")
+	fileMustContainText(t, sim.Base, "/test/dir/subdir/nested.txt", "nested")
+	symlinkMustExistWithTragetPath(t, sim.Base, symlinkPath, filePath)
+	mustNotExist(t, sim.Base, newFilePath)
+
+	require.Contains(sim.State, newFilePath)
+	require.Nil(sim.State[newFilePath])
+	require.Contains(sim.State, filePath)
+	require.NotNil(sim.State[filePath])
+	require.True(sim.State[filePath].Mode().IsRegular())
+
+	// the actual rollback yields the simulated state
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+	mustNotExist(t, base, newFilePath)
+}
+
+func TestBackupFS_SimulateRollbackPredictsErrors(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+		newDirPath                = filepath.FromSlash("/test/new")
+	)
+
+	createFile(t, base, filePath, "original")
+
+	createFile(t, backupFS, filePath, "modified")
+	mkdir(t, backupFS, newDirPath, 0755)
+
+	// untracked content in a created directory prevents its removal
+	createFile(t, base, "/test/new/untracked.txt", "untracked")
+	// backup disappeared
+	require.NoError(backup.Remove(filePath))
+
+	baseState := createFSState(t, base, "/")
+
+	sim, err := backupFS.SimulateRollback()
+	require.NoError(err)
+	require.NotEmpty(sim.Errors)
+	require.NotEmpty(sim.Report.Error)
+
+	var missingBackup bool
+	for _, err := range sim.Errors {
+		if errors.Is(err, ErrMissingBackup) {
+			missingBackup = true
+		}
+	}
+	require.True(missingBackup, "expected missing backup to be predicted: %v", sim.Errors)
+
+	require.NotNil(sim.State[newDirPath])
+	mustEqualFSState(t, baseState, base, "/")
+}
@@ -0,0 +1,91 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// spellingIndex maps the keys of the tracked paths to the spelling that they were tracked with,
+// see WithCaseInsensitivePaths and WithUnicodeNormalization.
+// Paths are never removed until the whole state is dropped, as the spelling of a path
+// that is not tracked anymore still refers to the same file of the base filesystem.
+type spellingIndex struct {
+	mu    sync.Mutex
+	paths map[string]string
+}
+
+func (idx *spellingIndex) add(key, path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.paths == nil {
+		idx.paths = make(map[string]string)
+	}
+	if _, found := idx.paths[key]; !found {
+		idx.paths[key] = path
+	}
+}
+
+func (idx *spellingIndex) reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.paths = nil
+}
+
+// canonical replaces the longest parent directory of resolvedName, or resolvedName itself,
+// that is tracked with a different spelling with the tracked spelling.
+func (idx *spellingIndex) canonical(resolvedName string, keys pathKeys) string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if len(idx.paths) == 0 {
+		return resolvedName
+	}
+
+	for dir := resolvedName; ; {
+		tracked, found := idx.paths[keys.key(dir)]
+		if found {
+			return tracked + resolvedName[len(dir):]
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return resolvedName
+		}
+		dir = parent
+	}
+}
+
+// pathKeys returns the keys that different spellings of the same path share.
+func (fsys *BackupFS) pathKeys() pathKeys {
+	return pathKeys{
+		caseInsensitive: fsys.opts.caseInsensitive,
+		form:            fsys.opts.unicodeForm,
+	}
+}
+
+// canonicalPath returns the spelling of resolvedName that the path is tracked with,
+// which differs from resolvedName only for case-insensitive paths or paths in another
+// Unicode normal form, see WithCaseInsensitivePaths and WithUnicodeNormalization.
+func (fsys *BackupFS) canonicalPath(resolvedName string) string {
+	keys := fsys.pathKeys()
+	if keys.exact() {
+		return resolvedName
+	}
+	return fsys.spellings.canonical(resolvedName, keys)
+}
+
+// trackSpelling adds the spelling of a newly tracked path to the spelling index.
+func (fsys *BackupFS) trackSpelling(path string) {
+	keys := fsys.pathKeys()
+	if !keys.exact() {
+		fsys.spellings.add(keys.key(path), path)
+	}
+}
+
+// lockKey returns the key of the path locks of resolvedName,
+// so that different spellings of a path share the same lock.
+func (fsys *BackupFS) lockKey(resolvedName string) string {
+	return fsys.pathKeys().key(resolvedName)
+}
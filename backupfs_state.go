@@ -0,0 +1,207 @@
+package backupfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// stateFile is the path of the saved state in the backup filesystem, see SaveState.
+	stateFile = filepath.Join(internalDir, "state.json")
+	// binaryStateFile is the path of the saved state in case of StateEncodingGob.
+	binaryStateFile = filepath.Join(internalDir, "state.gob")
+)
+
+// StateEncoding is the encoding of the state that is written by SaveState and WriteState, see WithStateEncoding.
+type StateEncoding int
+
+const (
+	// StateEncodingJSON encodes the state like MarshalJSON.
+	StateEncodingJSON StateEncoding = iota
+	// StateEncodingGob encodes the state like MarshalBinary, which is smaller and faster
+	// for hundreds of thousands of tracked paths.
+	StateEncodingGob
+)
+
+func (e StateEncoding) String() string {
+	switch e {
+	case StateEncodingJSON:
+		return "json"
+	case StateEncodingGob:
+		return "gob"
+	default:
+		return fmt.Sprintf("StateEncoding(%d)", int(e))
+	}
+}
+
+// SaveState saves the internal state to a file in the backup filesystem, so that a new process can load it with
+// LoadState and roll back the modifications of this process. The state is encoded like MarshalJSON or, in case of
+// StateEncodingGob, like MarshalBinary, see WithStateEncoding.
+// The file is replaced atomically and removed by Rollback and Commit.
+// Snapshots cannot be saved, WithJournal and Recover persist them as well.
+func (fsys *BackupFS) SaveState() (err error) {
+	name := fsys.stateFile()
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpSaveState, name, err)
+		}
+	}()
+
+	defer fsys.lock(OpSaveState)()
+
+	err = fsys.rootBackup.MkdirAll(internalDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmpName := filepath.Join(internalDir, RandomTempName(filepath.Base(name)+".tmp-"))
+	defer func() {
+		if err != nil {
+			_ = fsys.rootBackup.Remove(tmpName)
+		}
+	}()
+
+	f, err := fsys.rootBackup.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = fsys.writeState(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		return err
+	}
+	return fsys.rootBackup.Rename(tmpName, name)
+}
+
+// LoadState replaces the internal state with the state that has been saved with SaveState,
+// e.g. after a restart of the process that used a BackupFS with the same base and backup filesystem
+// and the same StateEncoding.
+// Returns an error that wraps fs.ErrNotExist in case that no state has been saved.
+func (fsys *BackupFS) LoadState() (err error) {
+	name := fsys.stateFile()
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpLoadState, name, err)
+		}
+	}()
+
+	defer fsys.lock(OpLoadState)()
+
+	f, err := fsys.rootBackup.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = fsys.readState(f)
+	if err != nil {
+		return err
+	}
+	fsys.removeStaleIndexFiles()
+	return nil
+}
+
+// WriteState streams the internal state to w in the encoding of WithStateEncoding, see SaveState.
+func (fsys *BackupFS) WriteState(w io.Writer) (err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpSaveState, separator, err)
+		}
+	}()
+
+	defer fsys.lock(OpSaveState)()
+
+	return fsys.writeState(w)
+}
+
+// ReadState replaces the internal state with the state that was written with WriteState.
+func (fsys *BackupFS) ReadState(r io.Reader) (err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpLoadState, separator, err)
+		}
+	}()
+
+	defer fsys.lock(OpLoadState)()
+
+	return fsys.readState(r)
+}
+
+func (fsys *BackupFS) writeState(w io.Writer) error {
+	if len(fsys.generations) > 0 {
+		return fmt.Errorf("%w: the state of snapshots cannot be saved", errors.ErrUnsupported)
+	}
+
+	if fsys.opts.stateEncoding == StateEncodingGob {
+		bw := bufio.NewWriter(w)
+		err := fsys.encodeBinaryState(bw)
+		if err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+
+	data, err := fsys.marshalState()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (fsys *BackupFS) readState(r io.Reader) error {
+	var (
+		m         map[string]fs.FileInfo
+		checksums map[string][]byte
+		err       error
+	)
+	if fsys.opts.stateEncoding == StateEncodingGob {
+		m, checksums, err = decodeBinaryState(bufio.NewReader(r))
+	} else {
+		var data []byte
+		data, err = io.ReadAll(r)
+		if err == nil {
+			m, checksums, err = unmarshalState(data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = fsys.setInfos(fsys.newTrackedInfos(), m)
+	if err != nil {
+		return err
+	}
+	fsys.checksums = checksums
+	return nil
+}
+
+func (fsys *BackupFS) stateFile() string {
+	if fsys.opts.stateEncoding == StateEncodingGob {
+		return binaryStateFile
+	}
+	return stateFile
+}
+
+// removeState removes the saved state after the transaction has been finished.
+// The journal must have been removed before, as the internal directory is removed as well
+// in case that nothing else is left in it.
+func (fsys *BackupFS) removeState() error {
+	var errs []error
+	for _, name := range []string{stateFile, binaryStateFile} {
+		err := fsys.rootBackup.Remove(name)
+		if err != nil && !isNotFoundError(err) {
+			errs = append(errs, fmt.Errorf("failed to remove state: %w", err))
+		}
+	}
+	fsys.removeInternalDir()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package backupfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// binaryStateHeader is the first value of the binary state, which is followed by Entries values of binaryStateEntry.
+type binaryStateHeader struct {
+	Version int
+	Entries int
+}
+
+type binaryStateEntry struct {
+	Path string
+	// Info is nil in case that the path did not exist
+	Info *fInfo
+}
+
+// MarshalBinary returns the gob encoded representation of the internal state of the current generation,
+// which contains the same information as MarshalJSON.
+func (fsys *BackupFS) MarshalBinary() ([]byte, error) {
+	defer fsys.rlockState()()
+
+	var buf bytes.Buffer
+	err := fsys.encodeBinaryState(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the internal state with the state that was serialized with MarshalBinary.
+func (fsys *BackupFS) UnmarshalBinary(data []byte) error {
+	m, checksums, err := decodeBinaryState(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	err = fsys.setInfos(fsys.newTrackedInfos(), m)
+	if err != nil {
+		return err
+	}
+	fsys.checksums = checksums
+	return nil
+}
+
+// encodeBinaryState streams the tracked file infos entry by entry to w
+// without building the whole representation in memory.
+func (fsys *BackupFS) encodeBinaryState(w io.Writer) error {
+	var (
+		enc   = gob.NewEncoder(w)
+		names = newOwnerNames()
+	)
+	err := enc.Encode(binaryStateHeader{Version: stateVersion, Entries: fsys.baseInfos.len()})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range fsys.baseInfos.paths() {
+		fi, err := fsys.baseInfos.load(path)
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(binaryStateEntry{Path: path, Info: fsys.stateEntry(path, fi, names)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeBinaryState(r io.Reader) (_ map[string]fs.FileInfo, checksums map[string][]byte, err error) {
+	dec := gob.NewDecoder(r)
+
+	var header binaryStateHeader
+	err = dec.Decode(&header)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Version != stateVersion {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUnsupportedStateVersion, header.Version)
+	}
+	if header.Entries < 0 {
+		return nil, nil, fmt.Errorf("invalid number of entries: %d", header.Entries)
+	}
+
+	// the number of entries is not trusted for the allocation
+	m := make(map[string]fs.FileInfo, min(header.Entries, 1<<16))
+	for i := 0; i < header.Entries; i++ {
+		var entry binaryStateEntry
+		err = dec.Decode(&entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		checksums = addStateEntry(m, checksums, entry.Path, entry.Info)
+	}
+	return m, checksums, nil
+}
@@ -0,0 +1,225 @@
+package backupfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_SaveState(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+		createdPath               = filepath.FromSlash("/test/created.txt")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, backupFS, filePath, "modified")
+	createFile(t, backupFS, createdPath, "created")
+	require.NoError(backupFS.SaveState())
+	mustExist(t, backup, stateFile)
+
+	// e.g. a restart of the process
+	restarted := NewBackupFS(base, backup)
+	err := restarted.LoadState()
+	require.NoError(err)
+	require.Len(restarted.Map(), len(backupFS.Map()))
+	require.Contains(restarted.Map(), createdPath)
+
+	require.NoError(restarted.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+	mustNotExist(t, base, createdPath)
+	mustNotExist(t, backup, stateFile)
+	mustNotExist(t, backup, internalDir)
+
+	err = restarted.LoadState()
+	require.ErrorIs(err, fs.ErrNotExist)
+	require.True(HasOp(err, OpLoadState))
+
+	require.NoError(restarted.Snapshot("first"))
+	require.ErrorIs(restarted.SaveState(), errors.ErrUnsupported)
+}
+
+func TestBackupFS_ReservedPath(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		reservedPath              = filepath.Join(internalDir, "state.json")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+	)
+
+	createFile(t, base, reservedPath, "base")
+	createFile(t, base, filePath, "original")
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.SaveState())
+
+	// the base file would be backed up to the saved state
+	_, err := backupFS.OpenFile(reservedPath, os.O_WRONLY|os.O_TRUNC, 0644)
+	require.ErrorIs(err, ErrReservedPath)
+	require.ErrorIs(backupFS.Remove(reservedPath), ErrReservedPath)
+	require.ErrorIs(backupFS.MkdirAll(filepath.Join(internalDir, "dir"), 0755), ErrReservedPath)
+	fileMustContainText(t, base, reservedPath, "base")
+
+	restarted := NewBackupFS(base, backup)
+	require.NoError(restarted.LoadState())
+	require.NoError(restarted.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+	fileMustContainText(t, base, reservedPath, "base")
+	mustNotExist(t, backup, internalDir)
+
+	// hashed backups do not collide with the internal files
+	hashed := NewBackupFS(base, backup, WithBackupLayout(LayoutHashed))
+	createFile(t, hashed, reservedPath, "modified")
+	require.NoError(hashed.Rollback())
+	fileMustContainText(t, base, reservedPath, "base")
+}
+
+func TestBackupFS_JSONVersions(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithChecksums(sha256.New))
+		filePath           = filepath.FromSlash("/test/file.txt")
+		linkPath           = filepath.FromSlash("/test/link")
+	)
+
+	createFile(t, base, filePath, "original")
+	require.NoError(base.Symlink("file.txt", linkPath))
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Remove(linkPath))
+
+	data, err := json.Marshal(backupFS)
+	require.NoError(err)
+
+	var envelope stateEnvelope
+	require.NoError(json.Unmarshal(data, &envelope))
+	require.Equal(stateVersion, envelope.Version)
+	require.Equal("file.txt", envelope.Entries[linkPath].Target)
+	sum := sha256.Sum256([]byte("original"))
+	require.Equal(sum[:], envelope.Entries[filePath].Checksum)
+
+	loaded := NewBackupFS(base, backup, WithChecksums(sha256.New))
+	require.NoError(json.Unmarshal(data, loaded))
+	require.Equal(backupFS.Checksums(), loaded.Checksums())
+
+	// version 1 is a plain map of file infos
+	v1, err := json.Marshal(envelope.Entries)
+	require.NoError(err)
+	migrated := NewBackupFS(base, backup)
+	require.NoError(json.Unmarshal(v1, migrated))
+	require.Len(migrated.Map(), len(backupFS.Map()))
+
+	err = json.Unmarshal([]byte(`{"version":3,"entries":{}}`), migrated)
+	require.ErrorIs(err, ErrUnsupportedStateVersion)
+
+	require.NoError(migrated.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+	target, err := base.Readlink(linkPath)
+	require.NoError(err)
+	require.Equal("file.txt", target)
+}
+
+func TestBackupFS_WithStateEncoding(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithStateEncoding(StateEncodingGob), WithChecksums(sha256.New))
+		filePath           = filepath.FromSlash("/test/file.txt")
+		createdPath        = filepath.FromSlash("/test/created.txt")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, backupFS, filePath, "modified")
+	createFile(t, backupFS, createdPath, "created")
+
+	data, err := backupFS.MarshalBinary()
+	require.NoError(err)
+	unmarshaled := NewBackupFS(base, backup, WithChecksums(sha256.New))
+	require.NoError(unmarshaled.UnmarshalBinary(data))
+	require.Len(unmarshaled.Map(), len(backupFS.Map()))
+	require.Equal(backupFS.Checksums(), unmarshaled.Checksums())
+
+	var buf bytes.Buffer
+	require.NoError(backupFS.WriteState(&buf))
+	streamed := NewBackupFS(base, backup, WithStateEncoding(StateEncodingGob))
+	require.NoError(streamed.ReadState(&buf))
+	require.Len(streamed.Map(), len(backupFS.Map()))
+
+	require.NoError(backupFS.SaveState())
+	mustExist(t, backup, binaryStateFile)
+	mustNotExist(t, backup, stateFile)
+
+	restarted := NewBackupFS(base, backup, WithStateEncoding(StateEncodingGob))
+	require.NoError(restarted.LoadState())
+	require.Contains(restarted.Map(), createdPath)
+
+	require.NoError(restarted.Rollback())
+	fileMustContainText(t, base, filePath, "original")
+	mustNotExist(t, base, createdPath)
+	mustNotExist(t, backup, binaryStateFile)
+}
+
+// newLargeStateBackupFS returns a BackupFS that tracks n paths.
+func newLargeStateBackupFS(n int) *BackupFS {
+	fsys := NewBackupFS(NewMemFS(), NewMemFS())
+	m := make(map[string]fs.FileInfo, n)
+	for i := 0; i < n; i++ {
+		path := filepath.FromSlash("/data/" + strconv.Itoa(i/1000) + "/file_" + strconv.Itoa(i) + ".txt")
+		if i%10 == 0 {
+			m[path] = nil
+			continue
+		}
+		m[path] = &fInfo{FileName: path, FileMode: 0644, FileSize: int64(i), FileUid: -1, FileGid: -1}
+	}
+	fsys.SetMap(m)
+	return fsys
+}
+
+func BenchmarkBackupFS_State(b *testing.B) {
+	fsys := newLargeStateBackupFS(100_000)
+
+	b.Run("json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			data, err := fsys.MarshalJSON()
+			if err != nil {
+				b.Fatal(err)
+			}
+			err = fsys.UnmarshalJSON(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(len(data)), "bytes/state")
+		}
+	})
+
+	b.Run("gob", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			data, err := fsys.MarshalBinary()
+			if err != nil {
+				b.Fatal(err)
+			}
+			err = fsys.UnmarshalBinary(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(len(data)), "bytes/state")
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// Stats describes the current transaction state of a BackupFS.
+type Stats struct {
+	// Tracked is the number of tracked paths
+	Tracked int `json:"tracked"`
+	// Created is the number of tracked paths that did not exist in the base filesystem
+	// prior to their creation. They are removed upon rollback.
+	Created int `json:"created"`
+	// Dirs is the number of backed up directories
+	Dirs int `json:"dirs"`
+	// Files is the number of backed up regular files
+	Files int `json:"files"`
+	// Symlinks is the number of backed up symlinks
+	Symlinks int `json:"symlinks"`
+	// Subtrees is the number of directory trees that were backed up as a whole
+	Subtrees int `json:"subtrees"`
+	// Placeholders is the number of files whose content was not backed up
+	Placeholders int `json:"placeholders"`
+	// BackupBytes is the accumulated size of all backed up regular files
+	BackupBytes int64 `json:"backup_bytes"`
+	// OpenHandles is the number of open file handles.
+	// Always zero in case that handle tracking is disabled.
+	OpenHandles int `json:"open_handles"`
+	// PeakTracked is the largest number of tracked paths since the internal state was last
+	// allocated. The memory of the internal state is proportional to this value, see Shrink.
+	PeakTracked int `json:"peak_tracked"`
+	// BackupInodes is the estimated number of files, directories and symlinks that the backups
+	// of all generations occupy in the backup filesystem, see WithInodeQuota.
+	BackupInodes int `json:"backup_inodes"`
+	// InodeQuota is the configured inode quota, zero in case that there is none.
+	InodeQuota int `json:"inode_quota,omitempty"`
+	// TotalBackupBytes is the estimated number of bytes that the backed up files of all generations
+	// occupy in the backup filesystem, see WithBackupQuota.
+	TotalBackupBytes int64 `json:"total_backup_bytes"`
+	// BackupQuota is the configured byte quota, zero in case that there is none.
+	BackupQuota int64 `json:"backup_quota,omitempty"`
+}
+
+// RollbackReport describes the outcome of a rollback.
+type RollbackReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Removed is the number of paths that were removed from the base filesystem
+	Removed int `json:"removed"`
+	// Restored is the number of paths that were restored in the base filesystem
+	Restored int `json:"restored"`
+	// Error is empty in case that the rollback succeeded
+	Error string `json:"error,omitempty"`
+	// Errors contains the classified failures of the rollback
+	Errors []*RollbackPathError `json:"errors,omitempty"`
+	// Warnings contains issues that did not prevent the rollback,
+	// e.g. restored symlinks whose targets do not exist, see WithSymlinkValidation.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Stats returns statistics about the currently tracked filesystem modifications.
+func (fsys *BackupFS) Stats() Stats {
+	defer fsys.rlockState()()
+
+	var s Stats
+	s.Tracked = fsys.baseInfos.len()
+	s.PeakTracked = fsys.peakTracked
+	s.BackupInodes = fsys.totalInodes()
+	s.InodeQuota = fsys.opts.inodeQuota
+	s.TotalBackupBytes = fsys.totalBackupBytes()
+	s.BackupQuota = fsys.opts.backupQuota
+	fsys.baseInfos.each(func(_ string, info fs.FileInfo) bool {
+		switch {
+		case info == nil:
+			s.Created++
+		case isSubtreeInfo(info):
+			s.Subtrees++
+		case isPlaceholderInfo(info):
+			s.Placeholders++
+		case info.Mode().IsDir():
+			s.Dirs++
+		case info.Mode().IsRegular():
+			s.Files++
+			s.BackupBytes += info.Size()
+		case info.Mode()&os.ModeSymlink != 0:
+			s.Symlinks++
+		}
+		return true
+	})
+
+	if fsys.handles != nil {
+		s.OpenHandles = len(fsys.handles.openHandles())
+	}
+	return s
+}
+
+// TrackedPaths returns the sorted list of paths that are tracked by the BackupFS.
+func (fsys *BackupFS) TrackedPaths() []string {
+	defer fsys.rlockState()()
+
+	paths := fsys.baseInfos.paths()
+	sort.Strings(paths)
+	return paths
+}
+
+// LastRollback returns the report of the most recent rollback.
+// Returns nil in case that Rollback has not been called yet.
+func (fsys *BackupFS) LastRollback() *RollbackReport {
+	defer fsys.rlockState()()
+
+	if fsys.lastRollback == nil {
+		return nil
+	}
+	report := *fsys.lastRollback
+	report.Errors = append([]*RollbackPathError(nil), report.Errors...)
+	report.Warnings = append([]string(nil), report.Warnings...)
+	return &report
+}
+
+// Shrink releases the memory of the internal state that is not needed anymore
+// after a large number of tracked paths has been removed, e.g. by Commit.
+// Long-lived processes may call Shrink periodically in order to keep their memory footprint bounded.
+func (fsys *BackupFS) Shrink() {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	fsys.shrink()
+}
+
+func (fsys *BackupFS) shrink() {
+	if fsys.baseInfos.len() >= fsys.peakTracked {
+		return
+	}
+
+	// maps never release their buckets, so the remaining entries are copied into new maps
+	fsys.baseInfos.shrink()
+	fsys.peakTracked = fsys.baseInfos.len()
+}
+
+func (fsys *BackupFS) trackPeak() {
+	if n := fsys.baseInfos.len(); n > fsys.peakTracked {
+		fsys.peakTracked = n
+	}
+}
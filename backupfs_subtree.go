@@ -0,0 +1,311 @@
+package backupfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// subtreeInfo marks a directory whose entire subtree has been backed up at once.
+// Paths inside of the subtree are not tracked individually.
+type subtreeInfo struct {
+	fs.FileInfo
+	// snapshot is true in case that the subtree has been backed up
+	// with a native filesystem snapshot instead of the backup filesystem.
+	snapshot bool
+}
+
+func isSubtreeInfo(fi fs.FileInfo) bool {
+	_, ok := fi.(*subtreeInfo)
+	return ok
+}
+
+func isSnapshotInfo(fi fs.FileInfo) bool {
+	st, ok := fi.(*subtreeInfo)
+	return ok && st.snapshot
+}
+
+func countSubtrees(infos *trackedInfos) int {
+	cnt := 0
+	infos.each(func(_ string, fi fs.FileInfo) bool {
+		if isSubtreeInfo(fi) {
+			cnt++
+		}
+		return true
+	})
+	return cnt
+}
+
+// compactedSubtreeOf returns the root directory of the compacted subtree
+// that contains the resolved path. The root directory itself is not contained.
+func (fsys *BackupFS) compactedSubtreeOf(resolvedName string) (root string, found bool) {
+	if fsys.subtrees == 0 {
+		return "", false
+	}
+
+	parent := filepath.Dir(resolvedName)
+	if parent == resolvedName {
+		return "", false
+	}
+	_, _ = IterateDirTree(parent, func(subdirPath string) (bool, error) {
+		if isSubtreeInfo(fsys.baseInfos.info(subdirPath)) {
+			root = subdirPath
+			found = true
+			return false, nil
+		}
+		return true, nil
+	})
+	return root, found
+}
+
+// compactable returns true in case that neither the directory nor any path
+// inside of it has been seen before.
+func (fsys *BackupFS) compactable(resolvedDirPath string) bool {
+	if fsys.alreadySeen(resolvedDirPath) {
+		return false
+	}
+
+	compactable := true
+	fsys.baseInfos.each(func(path string, _ fs.FileInfo) bool {
+		contains, err := dirContains(resolvedDirPath, path)
+		compactable = err == nil && !contains
+		return compactable
+	})
+	return compactable
+}
+
+// removeAllCompacted backs up the whole directory tree and removes it afterwards.
+// Only a single entry is added to the internal state.
+func (fsys *BackupFS) removeAllCompacted(resolvedDirPath string, info fs.FileInfo) (err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpRemoveAllCompacted, resolvedDirPath, err)
+		}
+	}()
+
+	err = fsys.backupDirs(filepath.Dir(resolvedDirPath))
+	if err != nil {
+		return err
+	}
+
+	// a partial backup of the subtree would be restored upon rollback
+	err = fsys.checkSubtreeQuota(resolvedDirPath)
+	if err != nil {
+		return err
+	}
+
+	st := &subtreeInfo{FileInfo: info}
+	st.snapshot, err = fsys.snapshotSubtree(resolvedDirPath)
+	if err != nil {
+		return err
+	}
+
+	backupBytes, inodes := fsys.backupBytes, fsys.inodes
+	if !st.snapshot {
+		err = fsys.backupSubtree(resolvedDirPath)
+		if err != nil {
+			fsys.backupBytes, fsys.inodes = backupBytes, inodes
+			// the subtree is only tracked once it has been backed up completely,
+			// otherwise the rollback would replace the untouched subtree with the partial backup.
+			return errors.Join(err, fsys.backup.RemoveAll(resolvedDirPath))
+		}
+	}
+
+	// the subtree must be journaled before it is removed from the base filesystem
+	err = fsys.track(resolvedDirPath, st)
+	if err != nil {
+		fsys.backupBytes, fsys.inodes = backupBytes, inodes
+		return errors.Join(err, fsys.deleteBackupSubtree(resolvedDirPath, st.snapshot))
+	}
+	fsys.subtrees++
+
+	return fsys.base.RemoveAll(resolvedDirPath)
+}
+
+// snapshotSubtree tries to back up the directory tree with a native filesystem snapshot.
+// Returns false in case that no snapshot was created and the files need to be copied instead.
+func (fsys *BackupFS) snapshotSubtree(resolvedDirPath string) (bool, error) {
+	s := fsys.opts.subtreeSnapshotter
+	if s == nil {
+		return false, nil
+	}
+
+	err := s.CreateSnapshot(resolvedDirPath)
+	if err != nil {
+		if errors.Is(err, ErrSnapshotUnsupported) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (fsys *BackupFS) backupSubtree(resolvedDirPath string) error {
+	return Walk(fsys.base, resolvedDirPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if f := fsys.opts.backupRequiredFunc; f != nil && !info.IsDir() && !f(path, info) {
+			// skipped by the user
+			return nil
+		}
+
+		mode := info.Mode()
+		if mode.IsRegular() {
+			err = fsys.reserveBytes(info)
+			if err != nil {
+				return err
+			}
+		}
+		if mode.IsDir() || mode.IsRegular() || mode&os.ModeSymlink != 0 {
+			err = fsys.reserveInode()
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case mode.IsDir():
+			return copyDirWithXattrs(fsys.base, fsys.backup, path, info, fsys.opts)
+		case mode.IsRegular():
+			return fsys.backupFile(path, info)
+		case mode&os.ModeSymlink != 0:
+			return copySymlink(fsys.base, fsys.backup, path, info, fsys.opts)
+		default:
+			// unsupported file for backing up
+			return nil
+		}
+	})
+}
+
+func (fsys *BackupFS) tryRestoreSubtreePaths(ctx context.Context, restoreSubtreePaths []string) (multiErr error) {
+	sort.Sort(ByLeastFilePathSeparators(restoreSubtreePaths))
+	for _, root := range restoreSubtreePaths {
+		if ctx.Err() != nil {
+			// reported by RollbackContext
+			return multiErr
+		}
+		if !isSnapshotInfo(fsys.baseInfos.info(root)) {
+			err := fsys.checkBackup(root, fs.ModeDir)
+			if err != nil {
+				multiErr = errors.Join(multiErr, err)
+				fsys.reportProgress(ProgressRestored, root, err)
+				continue
+			}
+		}
+
+		err := fsys.restoreSubtree(root)
+		if err != nil {
+			err = newRollbackPathError(CodeRestoreSubtreeFailed, root, err)
+			multiErr = errors.Join(multiErr, err)
+		}
+		fsys.reportProgress(ProgressRestored, root, err)
+	}
+	return multiErr
+}
+
+// restoreSubtree replaces whatever is located at root in the base filesystem
+// with the backed up subtree
+func (fsys *BackupFS) restoreSubtree(root string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to restore subtree: %s: %w", root, err)
+		}
+	}()
+
+	if isSnapshotInfo(fsys.baseInfos.info(root)) {
+		s := fsys.opts.subtreeSnapshotter
+		if s == nil {
+			return fmt.Errorf("no subtree snapshotter configured: %w", ErrSnapshotUnsupported)
+		}
+		return s.RestorePath(root)
+	}
+
+	_, exists, err := lexists(fsys.backup, root)
+	if err != nil || !exists {
+		// best effort, if backup was tempered with, we cannot restore the subtree.
+		return nil
+	}
+
+	err = fsys.base.RemoveAll(root)
+	if err != nil {
+		return err
+	}
+
+	var (
+		multiErr error
+		dirs     = make(map[string]fs.FileInfo)
+	)
+	err = Walk(fsys.backup, root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			dirs[path] = info
+			err = copyDirWithXattrs(fsys.backup, fsys.base, path, info, fsys.opts)
+		case mode.IsRegular():
+			err = restoreFile(path, info, fsys.base, fsys.backup, fsys.opts)
+		case mode&os.ModeSymlink != 0:
+			err = restoreSymlink(path, info, fsys.base, fsys.backup, fsys.opts)
+		}
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Join(multiErr, err)
+	}
+
+	// restoring directory content modifies the modification times of the directories
+	dirPaths := make([]string, 0, len(dirs))
+	for path := range dirs {
+		dirPaths = append(dirPaths, path)
+	}
+	sort.Sort(ByMostFilePathSeparators(dirPaths))
+	for _, path := range dirPaths {
+		err = copyDir(fsys.base, path, dirs[path], fsys.opts)
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+	return multiErr
+}
+
+func (fsys *BackupFS) tryRemoveBackupSubtreePaths(removeSubtreePaths []string) (multiErr error) {
+	for _, root := range removeSubtreePaths {
+		err := fsys.removeBackupSubtree(root)
+		if err != nil {
+			multiErr = errors.Join(
+				multiErr,
+				newRollbackPathError(CodeRemoveBackupFailed, root, fmt.Errorf("failed to remove subtree in backup filesystem: %w", err)),
+			)
+		}
+	}
+	return multiErr
+}
+
+func (fsys *BackupFS) removeBackupSubtree(root string) error {
+	return fsys.deleteBackupSubtree(root, isSnapshotInfo(fsys.baseInfos.info(root)))
+}
+
+// deleteBackupSubtree removes the copied backup or the snapshot of the subtree at root.
+func (fsys *BackupFS) deleteBackupSubtree(root string, snapshot bool) error {
+	if !snapshot {
+		return fsys.backup.RemoveAll(root)
+	}
+
+	s := fsys.opts.subtreeSnapshotter
+	if s == nil {
+		return fmt.Errorf("no subtree snapshotter configured: %w", ErrSnapshotUnsupported)
+	}
+	return s.DeleteSnapshot(root)
+}
@@ -0,0 +1,136 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_RemoveAllCompacted(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup, WithSubtreeCompaction(true))
+
+	var (
+		fileDirRoot = "/test"
+		fileDir     = "/test/001"
+		fileDir2    = "/test/0/2"
+		symlinkDir  = "/test/sym"
+		fileContent = "test_content"
+	)
+
+	mkdirAll(t, base, fileDir, 0755)
+	mkdirAll(t, base, fileDir2, 0755)
+	mkdirAll(t, base, symlinkDir, 0755)
+
+	createFile(t, base, fileDir+"/test01.txt", fileContent)
+	createFile(t, base, fileDir+"/test02.txt", fileContent)
+	createFile(t, base, fileDir2+"/test03.txt", fileContent)
+	createFile(t, base, fileDir2+"/test04.txt", fileContent)
+	createSymlink(t, base, fileDir+"/test00.txt", symlinkDir+"/link")
+
+	baseFSState := createFSState(t, base, "/")
+	backupFSState := createFSState(t, backup, "/")
+
+	removeAll(t, backupFS, fileDirRoot)
+	mustNotExist(t, base, fileDirRoot)
+
+	// only the root directory and the subtree are tracked
+	require.Equal(2, backupFS.baseInfos.len())
+	require.True(isSubtreeInfo(backupFS.baseInfos.info(filepath.FromSlash(fileDirRoot))))
+
+	fileMustContainText(t, backup, fileDir+"/test01.txt", fileContent)
+	fileMustContainText(t, backup, fileDir2+"/test04.txt", fileContent)
+	symlinkMustExistWithTragetPath(t, backup, symlinkDir+"/link", fileDir+"/test00.txt")
+
+	// new files inside of the removed subtree are not tracked individually
+	createFile(t, backupFS, fileDir+"/test05_new.txt", fileContent)
+	mustNotExist(t, backup, fileDir+"/test05_new.txt")
+	require.Equal(2, backupFS.baseInfos.len())
+
+	// the compact representation survives serialization
+	data, err := json.Marshal(backupFS)
+	require.NoError(err)
+	backupFSNew := NewBackupFS(base, backup)
+	require.NoError(json.Unmarshal(data, backupFSNew))
+	require.True(isSubtreeInfo(backupFSNew.baseInfos.info(filepath.FromSlash(fileDirRoot))))
+	require.Equal(1, backupFSNew.subtrees)
+
+	// ROLLBACK
+	err = backupFSNew.Rollback()
+	require.NoError(err)
+	// ROLLBACK
+
+	mustNotExist(t, base, fileDir+"/test05_new.txt")
+	mustEqualFSState(t, baseFSState, base, "/")
+	mustEqualFSState(t, backupFSState, backup, "/")
+}
+
+func TestBackupFS_RemoveAllNotCompactable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup, WithSubtreeCompaction(true))
+
+	createFile(t, base, "/test/001/test01.txt", "test_content")
+	createFile(t, base, "/test/001/test02.txt", "test_content")
+
+	baseFSState := createFSState(t, base, "/")
+	backupFSState := createFSState(t, backup, "/")
+
+	// a path inside of the tree is already known
+	createFile(t, backupFS, "/test/001/test01.txt", "test_content_new")
+	removeAll(t, backupFS, "/test")
+
+	require.Zero(countSubtrees(backupFS.baseInfos))
+	require.Equal(0, backupFS.subtrees)
+
+	err := backupFS.Rollback()
+	require.NoError(err)
+
+	mustEqualFSState(t, baseFSState, base, "/")
+	mustEqualFSState(t, backupFSState, backup, "/")
+}
+
+func TestBackupFS_RemoveAllCompactedBackupFails(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+		lockedFile   = filepath.FromSlash("/d/c/f.txt")
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(&lockedFS{FS: base, locked: lockedFile}, backup, WithSubtreeCompaction(true))
+
+	createFile(t, base, "/d/a.txt", "a")
+	createFile(t, base, lockedFile, "f")
+
+	baseFSState := createFSState(t, base, "/")
+
+	// the partial backup of the subtree is neither tracked nor kept
+	err := backupFS.RemoveAll("/d")
+	require.ErrorIs(err, syscall.EBUSY)
+	fileMustContainText(t, base, lockedFile, "f")
+	require.Zero(countSubtrees(backupFS.baseInfos))
+	require.Equal(0, backupFS.subtrees)
+	mustNotExist(t, backup, "/d/a.txt")
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseFSState, base, "/")
+}
@@ -1,13 +1,14 @@
 package backupfs
 
 import (
+	"context"
 	"encoding/json"
 	"io/fs"
 	"log"
 	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -257,6 +258,8 @@ func TestBackupFS_Rename(t *testing.T) {
 	err := base.MkdirAll(oldDirName, 0755)
 	require.NoError(err)
 	mustExist(t, root, "base"+oldDirName)
+	// the content of renamed directories is restored as well
+	createFile(t, base, oldDirName+"/file.txt", "content")
 
 	baseFSState := createFSState(t, base, "/")
 	backupFSState := createFSState(t, backup, "/")
@@ -293,6 +296,48 @@ func TestBackupFS_Rename(t *testing.T) {
 	mustEqualFSState(t, backupFSState, backup, "/")
 }
 
+func TestBackupFS_RenameReplace(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, backupFS := NewTestBackupFS("/base", "/backup")
+
+	createFile(t, base, "/test/old.txt", "old")
+	createFile(t, base, "/test/existing.txt", "existing")
+	baseFSState := createFSState(t, base, "/")
+
+	// existing files are replaced by the rename
+	require.NoError(backupFS.Rename("/test/old.txt", "/test/existing.txt"))
+	fileMustContainText(t, base, "/test/existing.txt", "old")
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseFSState, base, "/")
+}
+
+func TestBackupFS_RollbackSymlinkedParent(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, backupFS := NewTestBackupFS("/base", "/backup")
+
+	createFile(t, base, "/etc/app/config.yaml", "config")
+	baseFSState := createFSState(t, base, "/")
+
+	// writes through dangling symlinks create their targets
+	require.NoError(backupFS.Symlink("/etc/app/created.yaml", "/etc/app/link.yaml"))
+	createFile(t, backupFS, "/etc/app/link.yaml", "created")
+	fileMustContainText(t, base, "/etc/app/created.yaml", "created")
+
+	// /opt/config.yaml is created and removed, then /opt is replaced with a symlink
+	// that points at a directory with a file of the same name
+	createFile(t, backupFS, "/opt/config.yaml", "created")
+	require.NoError(backupFS.RemoveAll("/opt"))
+	require.NoError(backupFS.Symlink("/etc/app", "/opt"))
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseFSState, base, "/")
+}
+
 func TestBackupFS_Rollback(t *testing.T) {
 	t.Parallel()
 
@@ -491,6 +536,71 @@ func TestBackupFS_RollbackWithForcedBackup(t *testing.T) {
 	mustNotExist(t, backupFS, fileDir)
 }
 
+func TestBackupFS_RollbackContext(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, backupFS, filePath, "modified")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := backupFS.RollbackContext(ctx)
+	require.ErrorIs(err, ErrRollbackFailed)
+	require.ErrorIs(err, context.Canceled)
+
+	var rerr *RollbackError
+	require.ErrorAs(err, &rerr)
+	require.Len(rerr.Errors, 1)
+	require.Equal(CodeCanceled, rerr.Errors[0].Code)
+
+	// nothing was restored, the state is kept for a retry
+	fileMustContainText(t, base, filePath, "modified")
+	fileMustContainText(t, backup, filePath, "original")
+	require.NotEmpty(backupFS.TrackedPaths())
+
+	require.NoError(backupFS.RollbackContext(context.Background()))
+	fileMustContainText(t, base, filePath, "original")
+	mustNotExist(t, backup, filePath)
+}
+
+func TestBackupFS_RemoveAllContext(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require              = require.New(t)
+		_, base, _, backupFS = NewTestBackupFS("/base", "/backup")
+		dirPath              = filepath.FromSlash("/test/dir")
+	)
+
+	createFile(t, base, filepath.Join(dirPath, "a.txt"), "a")
+	createFile(t, base, filepath.Join(dirPath, "b.txt"), "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := backupFS.RemoveAllContext(ctx, dirPath)
+	require.ErrorIs(err, context.Canceled)
+	require.True(HasOp(err, OpRemoveAll))
+	mustExist(t, base, filepath.Join(dirPath, "a.txt"))
+
+	err = backupFS.ForceBackupContext(ctx, dirPath)
+	require.ErrorIs(err, context.Canceled)
+
+	require.NoError(backupFS.RemoveAllContext(context.Background(), dirPath))
+	mustNotExist(t, base, dirPath)
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, filepath.Join(dirPath, "a.txt"), "a")
+	fileMustContainText(t, base, filepath.Join(dirPath, "b.txt"), "b")
+}
+
 func TestBackupFS_JSON(t *testing.T) {
 	t.Parallel()
 
@@ -500,7 +610,7 @@ func TestBackupFS_JSON(t *testing.T) {
 		backupPrefix = "/backup"
 	)
 
-	_, base, backup, backupFS := NewTestBackupFS(basePrefix, backupPrefix)
+	root, base, backup, backupFS := NewTestBackupFS(basePrefix, backupPrefix)
 
 	var (
 		// different number of file path separators
@@ -564,8 +674,9 @@ func TestBackupFS_JSON(t *testing.T) {
 	require.NoError(err)
 
 	// JSON
-	oldMap := backupFS.baseInfos
-	newMap := backupFSNew.baseInfos
+	canChown := CanChown(root)
+	oldMap := backupFS.Map()
+	newMap := backupFSNew.Map()
 
 	for path, info := range oldMap {
 		newInfo := newMap[path]
@@ -581,7 +692,7 @@ func TestBackupFS_JSON(t *testing.T) {
 		require.Equal(info.ModTime().UnixNano(), newInfo.ModTime().UnixNano())
 		require.Equal(info.Mode(), newInfo.Mode())
 
-		if runtime.GOOS != "windows" {
+		if canChown {
 			require.Greater(toUID(info), -1)
 			require.Greater(toGID(info), -1)
 
@@ -807,6 +918,50 @@ func TestBackupFS_Chmod(t *testing.T) {
 	mustEqualFSState(t, backupFSState, backup, "/")
 }
 
+func TestBackupFS_Truncate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+
+	_, base, backup, backupFS := NewTestBackupFS(basePrefix, backupPrefix)
+
+	var (
+		filePath    = "/test/test_file_truncate.txt"
+		symlinkPath = "/test/symlink"
+	)
+	createFile(t, base, filePath, "truncate test file")
+	createSymlink(t, base, filePath, symlinkPath)
+
+	baseFSState := createFSState(t, base, "/")
+	backupFSState := createFSState(t, backup, "/")
+
+	err := backupFS.Truncate(symlinkPath, 8)
+	require.NoError(err)
+	fileMustContainText(t, base, filePath, "truncate")
+	fileMustContainText(t, backup, filePath, "truncate test file")
+
+	err = backupFS.Truncate("/test/missing.txt", 0)
+	require.ErrorIs(err, fs.ErrNotExist)
+	require.True(HasOp(err, OpTruncate))
+
+	err = backupFS.Rollback()
+	require.NoError(err)
+
+	mustEqualFSState(t, baseFSState, base, "/")
+	mustEqualFSState(t, backupFSState, backup, "/")
+
+	// the in-memory filesystem extends files with zeros
+	memFS := NewMemFS()
+	createFile(t, memFS, filePath, "text")
+	require.NoError(memFS.Truncate(filePath, 6))
+	fileMustContainText(t, memFS, filePath, "text\x00\x00")
+	require.ErrorIs(memFS.Truncate("/test", 0), syscall.EISDIR)
+}
+
 func TestTime(t *testing.T) {
 	require := require.New(t)
 
@@ -967,6 +1122,162 @@ func TestRemoveDirInSymlinkDir(t *testing.T) {
 	mustEqualFSState(t, backupFsState, backup, "/")
 }
 
+func TestReplaceTraversedSymlinkDir(t *testing.T) {
+	t.Parallel()
+
+	var (
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+
+	_, base, backup, backupFS := NewTestBackupFS(basePrefix, backupPrefix)
+
+	var (
+		originalLinkedDir   = "/usr/lib"
+		originalSubDir      = path.Join(originalLinkedDir, "/systemd/system")
+		originalFilePath    = path.Join(originalSubDir, "test.txt")
+		originalFileContent = "test_content"
+		symlinkDir          = "/lib"
+		symlinkFilePath     = path.Join(symlinkDir, "/systemd/system/test.txt")
+	)
+
+	// prepare existing files
+	mkdirAll(t, base, originalSubDir, 0755)
+	createSymlink(t, base, originalLinkedDir, symlinkDir)
+	createFile(t, base, originalFilePath, originalFileContent)
+
+	baseFsState := createFSState(t, base, "/")
+	backupFsState := createFSState(t, backup, "/")
+
+	// write through the symlinked folder, which tracks the symlink itself
+	createFile(t, backupFS, symlinkFilePath, "updated_content")
+	symlinkMustExistWithTragetPath(t, backup, symlinkDir, originalLinkedDir)
+
+	// replace the symlink with a real directory through the underlying filesystem
+	require.NoError(t, base.Remove(symlinkDir))
+	mkdirAll(t, base, path.Join(symlinkDir, "/systemd/system"), 0755)
+	createFile(t, backupFS, symlinkFilePath, "replaced_content")
+
+	err := backupFS.Rollback()
+	require.NoError(t, err)
+
+	symlinkMustExistWithTragetPath(t, base, symlinkDir, originalLinkedDir)
+	fileMustContainText(t, base, originalFilePath, originalFileContent)
+	mustEqualFSState(t, baseFsState, base, "/")
+	mustEqualFSState(t, backupFsState, backup, "/")
+}
+
+func TestRestoreDirReplacedBySymlink(t *testing.T) {
+	t.Parallel()
+
+	var (
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+
+	_, base, backup, backupFS := NewTestBackupFS(basePrefix, backupPrefix)
+
+	var (
+		dirPath      = "/usr/lib/systemd"
+		filePath     = path.Join(dirPath, "test.txt")
+		otherDirPath = "/opt/other"
+	)
+
+	createFile(t, base, filePath, "test_content")
+	mkdirAll(t, base, otherDirPath, 0755)
+
+	baseFsState := createFSState(t, base, "/")
+	backupFsState := createFSState(t, backup, "/")
+
+	// replace the directory with a symlink to another directory
+	require.NoError(t, backupFS.RemoveAll(dirPath))
+	require.NoError(t, backupFS.Symlink(otherDirPath, dirPath))
+
+	err := backupFS.Rollback()
+	require.NoError(t, err)
+
+	// the directory content must not be restored into the symlink target
+	mustNotExist(t, base, path.Join(otherDirPath, "test.txt"))
+	fileMustContainText(t, base, filePath, "test_content")
+	mustEqualFSState(t, baseFsState, base, "/")
+	mustEqualFSState(t, backupFsState, backup, "/")
+}
+
+func TestRestoreFileReplacedBySymlink(t *testing.T) {
+	t.Parallel()
+
+	var (
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+
+	_, base, backup, backupFS := NewTestBackupFS(basePrefix, backupPrefix)
+
+	var (
+		filePath   = "/etc/config.txt"
+		targetPath = "/etc/target.txt"
+	)
+
+	createFile(t, base, filePath, "config")
+	createFile(t, base, targetPath, "target")
+
+	baseFsState := createFSState(t, base, "/")
+	backupFsState := createFSState(t, backup, "/")
+
+	require.NoError(t, backupFS.Remove(filePath))
+	require.NoError(t, backupFS.Symlink(targetPath, filePath))
+
+	err := backupFS.Rollback()
+	require.NoError(t, err)
+
+	// the file content must not be written into the symlink target
+	fileMustContainText(t, base, targetPath, "target")
+	fileMustContainText(t, base, filePath, "config")
+	mustEqualFSState(t, baseFsState, base, "/")
+	mustEqualFSState(t, backupFsState, backup, "/")
+}
+
+func TestRestoreSymlinkChainInSymlinkDir(t *testing.T) {
+	t.Parallel()
+
+	var (
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+
+	_, base, backup, backupFS := NewTestBackupFS(basePrefix, backupPrefix)
+
+	var (
+		linkedDir = "/usr/lib"
+		filePath  = path.Join(linkedDir, "systemd/test.txt")
+		// /lib -> /usr/lib, /a_link -> /lib/systemd
+		symlinkDir   = "/lib"
+		chainedLink  = "/a_link"
+		chainedFile  = path.Join(chainedLink, "test.txt")
+		chainedValue = path.Join(symlinkDir, "systemd")
+	)
+
+	createFile(t, base, filePath, "test_content")
+	createSymlink(t, base, linkedDir, symlinkDir)
+	createSymlink(t, base, chainedValue, chainedLink)
+
+	baseFsState := createFSState(t, base, "/")
+	backupFsState := createFSState(t, backup, "/")
+
+	createFile(t, backupFS, chainedFile, "updated_content")
+	require.NoError(t, backupFS.Remove(chainedLink))
+	require.NoError(t, backupFS.Remove(symlinkDir))
+	require.NoError(t, backupFS.RemoveAll(linkedDir))
+
+	err := backupFS.Rollback()
+	require.NoError(t, err)
+
+	fileMustContainText(t, base, chainedFile, "test_content")
+	symlinkMustExistWithTragetPath(t, base, chainedLink, chainedValue)
+	mustEqualFSState(t, baseFsState, base, "/")
+	mustEqualFSState(t, backupFsState, backup, "/")
+}
+
 func CallerPathTmp(up ...int) string {
 	caller := 1
 	if len(up) > 0 {
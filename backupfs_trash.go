@@ -0,0 +1,131 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// trashDir contains a timestamped directory for every removal, see WithTrash.
+var trashDir = filepath.Join(internalDir, "trash")
+
+// moveToTrash copies the file or directory tree at resolvedName into a new trash directory
+// before it is removed from the base filesystem.
+func (fsys *BackupFS) moveToTrash(resolvedName string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to move to trash: %s: %w", resolvedName, err)
+		}
+	}()
+
+	err = fsys.rootBackup.MkdirAll(trashDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	// the directory name is the time of the removal,
+	// removals at the same time get consecutive names.
+	ts := fsys.opts.clock.Now().UnixNano()
+	var dir string
+	for {
+		dir = filepath.Join(trashDir, strconv.FormatInt(ts, 10))
+		err = fsys.rootBackup.Mkdir(dir, 0700)
+		if errors.Is(err, fs.ErrExist) {
+			ts++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	trash := NewPrefixFS(fsys.rootBackup, dir)
+	err = trash.MkdirAll(filepath.Dir(resolvedName), 0700)
+	if err != nil {
+		return err
+	}
+
+	return Walk(fsys.base, resolvedName, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			return copyDir(trash, path, info, fsys.opts)
+		case mode.IsRegular():
+			f, err := fsys.base.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return copyFile(trash, path, info, f, fsys.opts)
+		case mode&os.ModeSymlink != 0:
+			return copySymlink(fsys.base, trash, path, info, fsys.opts)
+		default:
+			// unsupported file for moving to the trash
+			return nil
+		}
+	})
+}
+
+// Purge deletes all removed files and directories from the trash that are older than maxAge.
+// A maxAge <= 0 empties the trash. See WithTrash.
+func (fsys *BackupFS) Purge(maxAge time.Duration) error {
+	defer fsys.lock(OpPurge)()
+
+	return fsys.purge(maxAge)
+}
+
+func (fsys *BackupFS) purge(maxAge time.Duration) (err error) {
+	defer func() {
+		if err != nil {
+			err = newBackupError(OpPurge, trashDir, err)
+		}
+	}()
+
+	entries, err := fsys.rootBackup.ReadDir(trashDir)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	var (
+		now      = fsys.opts.clock.Now()
+		multiErr error
+		kept     = 0
+	)
+	for _, e := range entries {
+		ts, err := strconv.ParseInt(e.Name(), 10, 64)
+		if err != nil {
+			// not created by us
+			kept++
+			continue
+		}
+
+		if maxAge > 0 && now.Sub(time.Unix(0, ts)) < maxAge {
+			kept++
+			continue
+		}
+
+		err = fsys.rootBackup.RemoveAll(filepath.Join(trashDir, e.Name()))
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+			kept++
+		}
+	}
+
+	if kept == 0 {
+		multiErr = errors.Join(multiErr, fsys.rootBackup.Remove(trashDir))
+		fsys.removeInternalDir()
+	}
+	return multiErr
+}
@@ -0,0 +1,56 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithTrash(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		start   = time.Unix(1700000000, 0)
+		clock   = NewManualClock(start)
+		base    = NewMemFS()
+		backup  = NewMemFS()
+	)
+	backupFS := NewBackupFS(base, backup, WithTrash(time.Hour), WithClock(clock))
+
+	createFile(t, base, "/test/file.txt", "file")
+	createFile(t, base, "/test/dir/nested.txt", "nested")
+	createSymlink(t, base, "/test/file.txt", "/test/dir/link")
+
+	require.NoError(backupFS.Remove("/test/file.txt"))
+	clock.Advance(time.Minute)
+	require.NoError(backupFS.RemoveAll("/test/dir"))
+
+	firstTrash := filepath.Join(trashDir, strconv.FormatInt(start.UnixNano(), 10))
+	secondTrash := filepath.Join(trashDir, strconv.FormatInt(start.Add(time.Minute).UnixNano(), 10))
+
+	// the trash is kept after the commit
+	require.NoError(backupFS.Commit())
+	mustNotExist(t, base, "/test/file.txt")
+	mustNotExist(t, base, "/test/dir")
+	fileMustContainText(t, backup, filepath.Join(firstTrash, "test", "file.txt"), "file")
+	fileMustContainText(t, backup, filepath.Join(secondTrash, "test", "dir", "nested.txt"), "nested")
+	// absolute symlink targets are located relative to the trash directory
+	symlinkMustExistWithTragetPath(t, NewPrefixFS(backup, secondTrash), "/test/dir/link", "/test/file.txt")
+
+	// only expired entries are purged on commit
+	clock.Advance(time.Hour - time.Minute)
+	createFile(t, backupFS, "/test/new.txt", "new")
+	require.NoError(backupFS.Commit())
+	mustNotExist(t, backup, firstTrash)
+	fileMustContainText(t, backup, filepath.Join(secondTrash, "test", "dir", "nested.txt"), "nested")
+
+	require.NoError(backupFS.Purge(0))
+	mustNotExist(t, backup, trashDir)
+
+	// purging an empty trash is fine
+	require.NoError(backupFS.Purge(0))
+}
@@ -0,0 +1,84 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// modTimeTolerance covers the timestamp granularity of filesystems like FAT.
+const modTimeTolerance = 2 * time.Second
+
+var (
+	// ErrBackupModified is returned by Verify in case that a backup does not match the state of the file
+	// that was recorded when it was backed up.
+	ErrBackupModified = errors.New("backup modified")
+)
+
+// Verify compares the backups of all generations with the file infos that were recorded when they were
+// backed up and reports backups that are missing or whose type, size, modification time or permissions
+// differ with ErrBackupModified. This detects tampering with the backup location before a rollback is attempted.
+// Placeholders, snapshots and the content of compacted subtrees are not verified, see VerifyChecksums and
+// VerifySeals for verifying the file contents.
+func (fsys *BackupFS) Verify() error {
+	defer fsys.lock(OpVerify)()
+
+	var errs []error
+	for _, g := range fsys.allGenerations() {
+		paths := g.baseInfos.paths()
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			info, err := g.baseInfos.load(path)
+			if err == nil {
+				err = fsys.verifyBackup(g.backup, path, info)
+			}
+			if err != nil {
+				errs = append(errs, newBackupError(OpVerify, path, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// verifyBackup compares the backup of path with the recorded info.
+func (fsys *BackupFS) verifyBackup(backup FS, path string, info fs.FileInfo) error {
+	if info == nil || isPlaceholderInfo(info) || isSnapshotInfo(info) || TrimVolume(path) == separator {
+		// nothing was backed up
+		return nil
+	}
+
+	fi, err := backup.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBackupModified, err)
+	}
+
+	mode := info.Mode()
+	if mode.Type() != fi.Mode().Type() {
+		return fmt.Errorf("%w: type %s differs from %s", ErrBackupModified, fi.Mode().Type(), mode.Type())
+	}
+
+	switch {
+	case mode.IsDir():
+		// the modification time of directories changes with their backed up content
+		mode = fsys.backupDirInfo(info).Mode()
+	case mode.IsRegular():
+		if fi.Size() != info.Size() {
+			return fmt.Errorf("%w: size %d differs from %d", ErrBackupModified, fi.Size(), info.Size())
+		}
+		if d := fi.ModTime().Sub(info.ModTime()); d > modTimeTolerance || d < -modTimeTolerance {
+			return fmt.Errorf("%w: modification time %s differs from %s", ErrBackupModified, fi.ModTime(), info.ModTime())
+		}
+	case mode&os.ModeSymlink != 0:
+		// symlinks have no permissions of their own
+		return nil
+	}
+
+	if !equalMode(mode, fi.Mode()) {
+		return fmt.Errorf("%w: mode %s differs from %s", ErrBackupModified, fi.Mode(), mode)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_Verify(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, backupFS := NewTestBackupFS("/base", "/backup")
+
+	createFile(t, base, "/test/resized.txt", "content")
+	createFile(t, base, "/test/chmod.txt", "content")
+	createFile(t, base, "/test/removed.txt", "content")
+	createFile(t, base, "/test/untouched.txt", "content")
+
+	createFile(t, backupFS, "/test/resized.txt", "modified")
+	createFile(t, backupFS, "/test/chmod.txt", "modified")
+	require.NoError(backupFS.Snapshot("first"))
+	createFile(t, backupFS, "/test/removed.txt", "modified")
+	createFile(t, backupFS, "/test/untouched.txt", "modified")
+	createFile(t, backupFS, "/test/created.txt", "created")
+
+	require.NoError(backupFS.Verify())
+
+	// tamper with the backups of both generations
+	generationBackup := backupFS.generations[0].backup
+	createFile(t, generationBackup, "/test/resized.txt", "tampered content")
+	require.NoError(generationBackup.Chmod("/test/chmod.txt", 0600))
+	require.NoError(backupFS.backup.Remove("/test/removed.txt"))
+
+	err := backupFS.Verify()
+	require.ErrorIs(err, ErrBackupModified)
+
+	var joined interface{ Unwrap() []error }
+	require.True(errors.As(err, &joined))
+	paths := make([]string, 0, 3)
+	for _, err := range joined.Unwrap() {
+		var pathErr *fs.PathError
+		require.ErrorAs(err, &pathErr)
+		require.Equal(OpVerify, Op(pathErr.Op))
+		paths = append(paths, pathErr.Path)
+	}
+	require.ElementsMatch([]string{"/test/resized.txt", "/test/chmod.txt", "/test/removed.txt"}, paths)
+}
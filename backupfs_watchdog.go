@@ -0,0 +1,84 @@
+package backupfs
+
+import (
+	"context"
+	"time"
+)
+
+// WatchdogFunc is called with the result of a rollback that was triggered by the watchdog, see BeginWithDeadline.
+type WatchdogFunc func(err error)
+
+type watchdog struct {
+	timer    Timer
+	deadline time.Time
+}
+
+// BeginWithDeadline arms a watchdog that rolls back all modifications in case that neither Commit nor Rollback
+// is called within d, like the "commit confirmed" semantics of network devices: a remote configuration change
+// that cuts off the connection to the operator is reverted automatically.
+// The watchdog is scheduled with the clock of WithClock in case that it implements TimerClock.
+// Calling BeginWithDeadline again re-arms the watchdog with the new deadline.
+// Commit, Rollback and RollbackContext disarm the watchdog, RollbackTo does not.
+//
+// The automatic rollback behaves like Rollback, its report is available via LastRollback and
+// its result is passed to the function that is configured with WithWatchdogFunc.
+func (fsys *BackupFS) BeginWithDeadline(d time.Duration) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	fsys.disarmWatchdog()
+
+	w := &watchdog{deadline: fsys.opts.clock.Now().Add(d)}
+	w.timer = afterFunc(fsys.opts.clock, d, func() {
+		fsys.expireWatchdog(w)
+	})
+	fsys.watchdog = w
+}
+
+// CancelDeadline disarms the watchdog without committing the modifications, see BeginWithDeadline.
+// Returns false in case that no watchdog was armed.
+func (fsys *BackupFS) CancelDeadline() bool {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	armed := fsys.watchdog != nil
+	fsys.disarmWatchdog()
+	return armed
+}
+
+// Deadline returns the point in time at which the watchdog rolls back all modifications
+// and whether a watchdog is armed, see BeginWithDeadline.
+func (fsys *BackupFS) Deadline() (time.Time, bool) {
+	defer fsys.rlockState()()
+
+	if fsys.watchdog == nil {
+		return time.Time{}, false
+	}
+	return fsys.watchdog.deadline, true
+}
+
+func (fsys *BackupFS) disarmWatchdog() {
+	if fsys.watchdog == nil {
+		return
+	}
+	fsys.watchdog.timer.Stop()
+	fsys.watchdog = nil
+}
+
+// expireWatchdog rolls back all modifications in case that w has neither been disarmed nor re-armed
+// while the timer was waiting for the lock.
+func (fsys *BackupFS) expireWatchdog(w *watchdog) {
+	unlock := fsys.lock(OpRollback)
+	if fsys.watchdog != w {
+		unlock()
+		return
+	}
+	fsys.watchdog = nil
+
+	err := fsys.rollback(context.Background())
+	unlock()
+
+	if fsys.opts.watchdogFunc != nil {
+		fsys.opts.watchdogFunc(err)
+	}
+}
@@ -0,0 +1,76 @@
+package backupfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_BeginWithDeadline(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		backup  = NewMemFS()
+		done    = make(chan error, 1)
+		clock   = NewManualClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	)
+	backupFS := NewBackupFS(base, backup, WithClock(clock), WithWatchdogFunc(func(err error) {
+		done <- err
+	}))
+
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, backupFS, "/test/file.txt", "modified")
+
+	_, armed := backupFS.Deadline()
+	require.False(armed)
+
+	// not confirmed in time
+	backupFS.BeginWithDeadline(time.Minute)
+	deadline, armed := backupFS.Deadline()
+	require.True(armed)
+	require.Equal(clock.Now().Add(time.Minute), deadline)
+
+	clock.Advance(time.Minute - time.Second)
+	select {
+	case <-done:
+		require.FailNow("watchdog rolled back before the deadline")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case err := <-done:
+		require.NoError(err)
+	case <-time.After(10 * time.Second):
+		require.FailNow("watchdog did not roll back")
+	}
+	fileMustContainText(t, base, "/test/file.txt", "original")
+	require.NotNil(backupFS.LastRollback())
+	_, armed = backupFS.Deadline()
+	require.False(armed)
+
+	// confirmed in time
+	createFile(t, backupFS, "/test/file.txt", "confirmed")
+	backupFS.BeginWithDeadline(time.Minute)
+	require.NoError(backupFS.Commit())
+	_, armed = backupFS.Deadline()
+	require.False(armed)
+
+	// canceled
+	createFile(t, backupFS, "/test/file.txt", "canceled")
+	backupFS.BeginWithDeadline(time.Minute)
+	require.True(backupFS.CancelDeadline())
+	require.False(backupFS.CancelDeadline())
+
+	// disarmed timers are not fired
+	clock.Advance(time.Hour)
+	select {
+	case <-done:
+		require.FailNow("disarmed watchdog rolled back")
+	default:
+	}
+	fileMustContainText(t, base, "/test/file.txt", "canceled")
+}
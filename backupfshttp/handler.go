@@ -0,0 +1,121 @@
+// Package backupfshttp provides a read-only net/http handler that exposes the transaction
+// state of a backupfs.BackupFS as JSON, e.g. for the admin port of long-running agents.
+//
+// The following endpoints are served relative to the handler's mount point:
+//
+//	GET /status    overall transaction status
+//	GET /stats     statistics about the tracked paths
+//	GET /paths     sorted list of tracked paths
+//	GET /manifest  serialized BackupFS state, see backupfs.BackupFS.MarshalJSON
+//	GET /rollback  report of the most recent rollback
+//
+// NewMetricsHandler additionally exposes backupfs.CounterMetrics in the Prometheus text format.
+package backupfshttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jxsl13/backupfs"
+)
+
+// Status is the response of the status endpoint.
+type Status struct {
+	Name string `json:"name"`
+	// Clean is true in case that no modifications are tracked.
+	Clean        bool                     `json:"clean"`
+	Stats        backupfs.Stats           `json:"stats"`
+	LastRollback *backupfs.RollbackReport `json:"last_rollback"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns a handler that exposes read-only JSON endpoints of bfs.
+// Mount it with http.StripPrefix in case that it is not served at the root path.
+func NewHandler(bfs *backupfs.BackupFS) http.Handler {
+	h := &handler{bfs: bfs}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", h.get(h.status))
+	mux.HandleFunc("/stats", h.get(h.stats))
+	mux.HandleFunc("/paths", h.get(h.paths))
+	mux.HandleFunc("/manifest", h.get(h.manifest))
+	mux.HandleFunc("/rollback", h.get(h.rollback))
+	return mux
+}
+
+// NewMetricsHandler returns a handler that serves the counters of m in the Prometheus text exposition format,
+// e.g. mounted at /metrics.
+func NewMetricsHandler(m *backupfs.CounterMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.WritePrometheus(w)
+	})
+}
+
+type handler struct {
+	bfs *backupfs.BackupFS
+}
+
+// get rejects any request that does not only read.
+func (h *handler) get(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	stats := h.bfs.Stats()
+	writeJSON(w, http.StatusOK, Status{
+		Name:         h.bfs.Name(),
+		Clean:        stats.Tracked == 0,
+		Stats:        stats,
+		LastRollback: h.bfs.LastRollback(),
+	})
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.bfs.Stats())
+}
+
+func (h *handler) paths(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.bfs.TrackedPaths())
+}
+
+func (h *handler) manifest(w http.ResponseWriter, r *http.Request) {
+	data, err := h.bfs.MarshalJSON()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (h *handler) rollback(w http.ResponseWriter, r *http.Request) {
+	report := h.bfs.LastRollback()
+	if report == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "no rollback has been executed yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,94 @@
+package backupfshttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jxsl13/backupfs"
+	"github.com/jxsl13/backupfs/testingfs"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, h http.Handler, path string, v any) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	if v != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+	return rec.Code
+}
+
+func TestNewHandler(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, bfs := testingfs.NewBackupFS(t, "/base", "/backup")
+	h := NewHandler(bfs)
+
+	var status Status
+	require.Equal(http.StatusOK, get(t, h, "/status", &status))
+	require.True(status.Clean)
+	require.Nil(status.LastRollback)
+	require.Equal(http.StatusNotFound, get(t, h, "/rollback", nil))
+
+	f, err := base.Create("/existing.txt")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	f, err = bfs.Create("/existing.txt")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	var stats backupfs.Stats
+	require.Equal(http.StatusOK, get(t, h, "/stats", &stats))
+	require.Equal(1, stats.Files)
+	require.Equal(1, stats.Dirs)
+
+	var paths []string
+	require.Equal(http.StatusOK, get(t, h, "/paths", &paths))
+	require.Equal([]string{filepath.FromSlash("/"), filepath.FromSlash("/existing.txt")}, paths)
+
+	var manifest map[string]any
+	require.Equal(http.StatusOK, get(t, h, "/manifest", &manifest))
+	require.Len(manifest, 2)
+
+	require.NoError(bfs.Rollback())
+
+	var report backupfs.RollbackReport
+	require.Equal(http.StatusOK, get(t, h, "/rollback", &report))
+	require.Empty(report.Error)
+	require.Equal(1, report.Restored)
+
+	require.Equal(http.StatusOK, get(t, h, "/status", &status))
+	require.True(status.Clean)
+	require.NotNil(status.LastRollback)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	require.Equal(http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestNewMetricsHandler(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	m := backupfs.NewCounterMetrics()
+	m.ObserveBackup(42)
+	h := NewMetricsHandler(m)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(http.StatusOK, rec.Code)
+	require.Contains(rec.Header().Get("Content-Type"), "text/plain")
+	require.Contains(rec.Body.String(), "backupfs_copied_bytes_total 42\n")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	require.Equal(http.StatusMethodNotAllowed, rec.Code)
+}
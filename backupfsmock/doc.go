@@ -0,0 +1,5 @@
+// Package backupfsmock provides gomock mocks of the backupfs.FS and backupfs.File interfaces
+// that allow downstream code to test its error handling, e.g. failing writes or removals.
+package backupfsmock
+
+//go:generate go run go.uber.org/mock/mockgen -destination=mock.go -package=backupfsmock -write_package_comment=false github.com/jxsl13/backupfs FS,File
@@ -0,0 +1,88 @@
+package backupfsmock
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/jxsl13/backupfs"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMockFS(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	ctrl := gomock.NewController(t)
+	mem := backupfs.NewMemFS()
+
+	f, err := mem.Create("/file.txt")
+	require.NoError(err)
+	_, err = f.WriteString("original")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	// only removals fail, expectations are matched in the order in which they are added
+	base := NewMockFS(ctrl)
+	base.EXPECT().Remove("/file.txt").Return(&fs.PathError{Op: "remove", Path: "/file.txt", Err: syscall.EBUSY})
+	delegate(base, mem)
+
+	backupFS := backupfs.NewBackupFS(base, backupfs.NewMemFS())
+	err = backupFS.Remove("/file.txt")
+	require.ErrorIs(err, syscall.EBUSY)
+
+	fi, err := base.Stat("/file.txt")
+	require.NoError(err)
+	require.Equal(int64(len("original")), fi.Size())
+}
+
+func TestMockFile(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	ctrl := gomock.NewController(t)
+	errDiskFull := errors.New("disk full")
+
+	file := NewMockFile(ctrl)
+	gomock.InOrder(
+		file.EXPECT().Write([]byte("content")).Return(0, errDiskFull),
+		file.EXPECT().Name().Return("/file.txt"),
+		file.EXPECT().Close().Return(nil),
+	)
+
+	fsys := NewMockFS(ctrl)
+	fsys.EXPECT().OpenFile("/file.txt", os.O_WRONLY|os.O_CREATE, fs.FileMode(0644)).Return(file, nil)
+
+	f, err := fsys.OpenFile("/file.txt", os.O_WRONLY|os.O_CREATE, 0644)
+	require.NoError(err)
+	_, err = f.Write([]byte("content"))
+	require.ErrorIs(err, errDiskFull)
+	require.Equal("/file.txt", f.Name())
+	require.NoError(f.Close())
+}
+
+// delegate allows any number of calls to all methods of m and delegates them to fsys.
+func delegate(m *MockFS, fsys backupfs.FS) {
+	m.EXPECT().Chmod(gomock.Any(), gomock.Any()).DoAndReturn(fsys.Chmod).AnyTimes()
+	m.EXPECT().Chown(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(fsys.Chown).AnyTimes()
+	m.EXPECT().Chtimes(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(fsys.Chtimes).AnyTimes()
+	m.EXPECT().Create(gomock.Any()).DoAndReturn(fsys.Create).AnyTimes()
+	m.EXPECT().Lchown(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(fsys.Lchown).AnyTimes()
+	m.EXPECT().Lstat(gomock.Any()).DoAndReturn(fsys.Lstat).AnyTimes()
+	m.EXPECT().Mkdir(gomock.Any(), gomock.Any()).DoAndReturn(fsys.Mkdir).AnyTimes()
+	m.EXPECT().MkdirAll(gomock.Any(), gomock.Any()).DoAndReturn(fsys.MkdirAll).AnyTimes()
+	m.EXPECT().Name().DoAndReturn(fsys.Name).AnyTimes()
+	m.EXPECT().Open(gomock.Any()).DoAndReturn(fsys.Open).AnyTimes()
+	m.EXPECT().OpenFile(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(fsys.OpenFile).AnyTimes()
+	m.EXPECT().ReadDir(gomock.Any()).DoAndReturn(fsys.ReadDir).AnyTimes()
+	m.EXPECT().Readlink(gomock.Any()).DoAndReturn(fsys.Readlink).AnyTimes()
+	m.EXPECT().Remove(gomock.Any()).DoAndReturn(fsys.Remove).AnyTimes()
+	m.EXPECT().RemoveAll(gomock.Any()).DoAndReturn(fsys.RemoveAll).AnyTimes()
+	m.EXPECT().Rename(gomock.Any(), gomock.Any()).DoAndReturn(fsys.Rename).AnyTimes()
+	m.EXPECT().Stat(gomock.Any()).DoAndReturn(fsys.Stat).AnyTimes()
+	m.EXPECT().Symlink(gomock.Any(), gomock.Any()).DoAndReturn(fsys.Symlink).AnyTimes()
+	m.EXPECT().Truncate(gomock.Any(), gomock.Any()).DoAndReturn(fsys.Truncate).AnyTimes()
+}
@@ -0,0 +1,6 @@
+//go:build tools
+
+package backupfsmock
+
+// keeps the version of mockgen that is used by go generate in the go.mod file
+import _ "go.uber.org/mock/mockgen"
@@ -0,0 +1,73 @@
+package backupfsrpc
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"time"
+)
+
+// Client controls a BackupFS of another process.
+type Client struct {
+	rpc   *rpc.Client
+	token string
+}
+
+// Dial connects to the server at the given address.
+// token is sent with every request in order to be authenticated by the server.
+func Dial(network, address, token string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn, token), nil
+}
+
+// NewClient creates a new client that uses an already established connection.
+func NewClient(conn io.ReadWriteCloser, token string) *Client {
+	return &Client{
+		rpc:   jsonrpc.NewClient(conn),
+		token: token,
+	}
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// Status returns the transaction status of the remote BackupFS.
+func (c *Client) Status() (*StatusReply, error) {
+	var reply StatusReply
+	err := c.rpc.Call(ServiceName+".Status", &Request{Token: c.token}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Rollback rolls back the remote BackupFS.
+func (c *Client) Rollback() error {
+	return c.rpc.Call(ServiceName+".Rollback", &Request{Token: c.token}, &Empty{})
+}
+
+// Commit commits the remote BackupFS.
+func (c *Client) Commit() error {
+	return c.rpc.Call(ServiceName+".Commit", &Request{Token: c.token}, &Empty{})
+}
+
+// Events returns all progress events with a sequence number greater than after.
+// In case that there are no such events, the server waits up to wait for new events.
+func (c *Client) Events(after uint64, wait time.Duration) ([]Event, error) {
+	var reply EventsReply
+	err := c.rpc.Call(ServiceName+".Events", &EventsRequest{
+		Request: Request{Token: c.token},
+		After:   after,
+		Wait:    wait,
+	}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Events, nil
+}
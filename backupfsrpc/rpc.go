@@ -0,0 +1,72 @@
+// Package backupfsrpc allows a supervising process to control a backupfs.BackupFS
+// that lives inside of another process via JSON-RPC (net/rpc/jsonrpc).
+//
+// The server exposes the service methods Status, Commit, Rollback and Events.
+// Events provides a long polling stream of progress events of operations that
+// were triggered remotely.
+package backupfsrpc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jxsl13/backupfs"
+)
+
+// ServiceName is the name of the JSON-RPC service, e.g. "BackupFS.Rollback".
+const ServiceName = "BackupFS"
+
+var (
+	// ErrUnauthenticated is returned in case that the authenticator rejects a request.
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// Request is the base request that is sent with every call.
+type Request struct {
+	// Token is passed to the server's Authenticator.
+	Token string
+}
+
+// Empty is the reply of calls that do not return any data.
+type Empty struct{}
+
+// StatusReply is the reply of the Status call.
+type StatusReply struct {
+	Stats        backupfs.Stats
+	LastRollback *backupfs.RollbackReport
+}
+
+// EventsRequest requests all events with a sequence number greater than After.
+type EventsRequest struct {
+	Request
+	After uint64
+	// Wait is the maximum duration that the server waits for new events.
+	// Zero returns immediately.
+	Wait time.Duration
+}
+
+// EventsReply contains the requested events ordered by their sequence number.
+type EventsReply struct {
+	Events []Event
+}
+
+// EventType describes the progress of a remotely triggered operation.
+type EventType string
+
+const (
+	EventStarted  EventType = "started"
+	EventFinished EventType = "finished"
+	EventFailed   EventType = "failed"
+)
+
+// Event is a progress event of a remotely triggered operation.
+type Event struct {
+	// Seq is a unique, monotonically increasing sequence number starting at 1.
+	Seq  uint64
+	Time time.Time
+	// Op is the name of the operation, e.g. "rollback" or "commit".
+	Op   string
+	Type EventType
+	// Error is set for events of type EventFailed.
+	Error string
+}
@@ -0,0 +1,93 @@
+package backupfsrpc
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jxsl13/backupfs/testingfs"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, token string, opts ...ServerOption) *Client {
+	t.Helper()
+
+	_, base, _, bfs := testingfs.NewBackupFS(t, "/base", "/backup")
+	f, err := base.Create("/existing.txt")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, bfs.ForceBackup("/existing.txt"))
+
+	server, err := NewServer(bfs, opts...)
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	client := NewClient(clientConn, token)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	client := newTestClient(t, "secret")
+
+	status, err := client.Status()
+	require.NoError(err)
+	require.Equal(1, status.Stats.Files)
+	require.Nil(status.LastRollback)
+
+	events, err := client.Events(0, 0)
+	require.NoError(err)
+	require.Empty(events)
+
+	// wait for events in the background
+	done := make(chan []Event, 1)
+	go func() {
+		events, _ := client.Events(0, time.Minute)
+		done <- events
+	}()
+
+	require.NoError(client.Rollback())
+	events = <-done
+	require.NotEmpty(events)
+	require.Equal(EventStarted, events[0].Type)
+
+	events, err = client.Events(events[0].Seq, 0)
+	require.NoError(err)
+	require.Len(events, 1)
+	require.Equal(EventFinished, events[0].Type)
+	require.Equal("rollback", events[0].Op)
+
+	status, err = client.Status()
+	require.NoError(err)
+	require.Zero(status.Stats.Tracked)
+	require.NotNil(status.LastRollback)
+
+	require.NoError(client.Commit())
+}
+
+func TestServer_WithAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	auth := WithAuthenticator(func(token string) error {
+		if token != "secret" {
+			return errors.New("invalid token")
+		}
+		return nil
+	})
+
+	client := newTestClient(t, "invalid", auth)
+	_, err := client.Status()
+	require.ErrorContains(t, err, ErrUnauthenticated.Error())
+
+	client = newTestClient(t, "secret", auth)
+	_, err = client.Status()
+	require.NoError(t, err)
+}
@@ -0,0 +1,233 @@
+package backupfsrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+
+	"github.com/jxsl13/backupfs"
+)
+
+// Authenticator validates the token of a request.
+// A non-nil error rejects the request.
+type Authenticator func(token string) error
+
+// ServerOption configures the Server.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	auth      Authenticator
+	maxEvents int
+	clock     backupfs.Clock
+}
+
+// WithAuthenticator configures a hook that authenticates every request.
+// By default all requests are accepted.
+func WithAuthenticator(auth Authenticator) ServerOption {
+	return func(o *serverOptions) {
+		o.auth = auth
+	}
+}
+
+// WithMaxEvents limits the number of events that the server keeps for clients to poll.
+// Older events are dropped. The default is 1024.
+func WithMaxEvents(n int) ServerOption {
+	return func(o *serverOptions) {
+		if n > 0 {
+			o.maxEvents = n
+		}
+	}
+}
+
+// WithClock configures the clock that provides the time stamps of events.
+func WithClock(c backupfs.Clock) ServerOption {
+	return func(o *serverOptions) {
+		if c != nil {
+			o.clock = c
+		}
+	}
+}
+
+// Server provides remote control of a BackupFS.
+type Server struct {
+	bfs    *backupfs.BackupFS
+	opts   serverOptions
+	rpc    *rpc.Server
+	events *eventLog
+
+	// serializes remotely triggered operations
+	opMu sync.Mutex
+}
+
+// NewServer creates a new server that controls bfs.
+func NewServer(bfs *backupfs.BackupFS, opts ...ServerOption) (*Server, error) {
+	o := serverOptions{
+		maxEvents: 1024,
+		clock:     backupfs.SystemClock(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &Server{
+		bfs:    bfs,
+		opts:   o,
+		rpc:    rpc.NewServer(),
+		events: newEventLog(o.maxEvents, o.clock),
+	}
+
+	err := s.rpc.RegisterName(ServiceName, &service{s: s})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ServeConn serves a single JSON-RPC connection until the client hangs up.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	s.rpc.ServeCodec(jsonrpc.NewServerCodec(conn))
+}
+
+// Serve accepts connections on the listener and serves each of them in a separate goroutine.
+// Serve blocks until the listener is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+func (s *Server) authenticate(r Request) error {
+	if s.opts.auth == nil {
+		return nil
+	}
+	if err := s.opts.auth(r.Token); err != nil {
+		return errors.Join(ErrUnauthenticated, err)
+	}
+	return nil
+}
+
+// run executes a remotely triggered operation and records its progress events.
+func (s *Server) run(op string, f func() error) error {
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	s.events.add(Event{Op: op, Type: EventStarted})
+	err := f()
+	if err != nil {
+		s.events.add(Event{Op: op, Type: EventFailed, Error: err.Error()})
+		return err
+	}
+	s.events.add(Event{Op: op, Type: EventFinished})
+	return nil
+}
+
+// service contains the exported JSON-RPC methods
+type service struct {
+	s *Server
+}
+
+func (svc *service) Status(args *Request, reply *StatusReply) error {
+	if err := svc.s.authenticate(*args); err != nil {
+		return err
+	}
+	reply.Stats = svc.s.bfs.Stats()
+	reply.LastRollback = svc.s.bfs.LastRollback()
+	return nil
+}
+
+func (svc *service) Rollback(args *Request, reply *Empty) error {
+	if err := svc.s.authenticate(*args); err != nil {
+		return err
+	}
+	return svc.s.run("rollback", svc.s.bfs.Rollback)
+}
+
+func (svc *service) Commit(args *Request, reply *Empty) error {
+	if err := svc.s.authenticate(*args); err != nil {
+		return err
+	}
+	return svc.s.run("commit", svc.s.bfs.Commit)
+}
+
+func (svc *service) Events(args *EventsRequest, reply *EventsReply) error {
+	if err := svc.s.authenticate(args.Request); err != nil {
+		return err
+	}
+
+	// a non-positive wait duration returns immediately
+	ctx, cancel := context.WithTimeout(context.Background(), args.Wait)
+	defer cancel()
+	reply.Events = svc.s.events.since(ctx, args.After)
+	return nil
+}
+
+func newEventLog(max int, clock backupfs.Clock) *eventLog {
+	return &eventLog{
+		max:     max,
+		clock:   clock,
+		changed: make(chan struct{}),
+	}
+}
+
+type eventLog struct {
+	mu     sync.Mutex
+	max    int
+	clock  backupfs.Clock
+	seq    uint64
+	events []Event
+	// closed and replaced whenever a new event is added
+	changed chan struct{}
+}
+
+func (l *eventLog) add(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.Seq = l.seq
+	e.Time = l.clock.Now()
+	l.events = append(l.events, e)
+	if len(l.events) > l.max {
+		l.events = append(l.events[:0:0], l.events[len(l.events)-l.max:]...)
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// since returns all events after the given sequence number.
+// In case that there are none, it waits for new events until the context is done.
+func (l *eventLog) since(ctx context.Context, after uint64) []Event {
+	for {
+		l.mu.Lock()
+		result := make([]Event, 0)
+		for _, e := range l.events {
+			if e.Seq > after {
+				result = append(result, e)
+			}
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		if len(result) > 0 {
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			return result
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package btrfs provides a backupfs.SubtreeSnapshotter that backs up directory trees
+// which are Btrfs subvolumes with read-only subvolume snapshots.
+//
+// The btrfs command line tool is required. Directory trees that are not subvolumes
+// are reported as unsupported, which makes the BackupFS fall back to copying their files.
+package btrfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/jxsl13/backupfs"
+)
+
+var _ backupfs.SubtreeSnapshotter = (*Snapshotter)(nil)
+
+// Snapshotter creates Btrfs subvolume snapshots.
+type Snapshotter struct {
+	mountDir    string
+	snapshotDir string
+}
+
+// New creates a new snapshotter.
+// mountDir is the operating system path that corresponds to the root of the base filesystem,
+// e.g. the prefix of a backupfs.PrefixFS or "/" for a backupfs.OSFS.
+// snapshotDir is the operating system directory that the snapshots are stored in.
+// It must be located on the same Btrfs filesystem as the snapshotted subvolumes.
+func New(mountDir, snapshotDir string) *Snapshotter {
+	return &Snapshotter{
+		mountDir:    filepath.Clean(mountDir),
+		snapshotDir: filepath.Clean(snapshotDir),
+	}
+}
+
+// CreateSnapshot creates a read-only snapshot of the subvolume at root.
+// Returns backupfs.ErrSnapshotUnsupported in case that root is not a subvolume.
+func (s *Snapshotter) CreateSnapshot(root string) error {
+	subvolume := s.osPath(root)
+	if !isSubvolume(subvolume) {
+		return &os.PathError{Op: "create_snapshot", Path: root, Err: backupfs.ErrSnapshotUnsupported}
+	}
+
+	err := os.MkdirAll(s.snapshotDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	return run("subvolume", "snapshot", "-r", subvolume, s.snapshotPath(root))
+}
+
+// RestorePath replaces whatever is located at root with a writable
+// snapshot of the previously created read-only snapshot.
+func (s *Snapshotter) RestorePath(root string) error {
+	subvolume := s.osPath(root)
+	if isSubvolume(subvolume) {
+		err := run("subvolume", "delete", subvolume)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := os.RemoveAll(subvolume)
+		if err != nil {
+			return err
+		}
+	}
+
+	return run("subvolume", "snapshot", s.snapshotPath(root), subvolume)
+}
+
+// DeleteSnapshot deletes the read-only snapshot of root.
+func (s *Snapshotter) DeleteSnapshot(root string) error {
+	return run("subvolume", "delete", s.snapshotPath(root))
+}
+
+func (s *Snapshotter) osPath(root string) string {
+	return filepath.Join(s.mountDir, root)
+}
+
+// snapshotPath returns a unique and flat snapshot directory path for root
+func (s *Snapshotter) snapshotPath(root string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(root)))
+	return filepath.Join(s.snapshotDir, hex.EncodeToString(sum[:]))
+}
+
+func isSubvolume(path string) bool {
+	if _, err := exec.LookPath("btrfs"); err != nil {
+		return false
+	}
+	return run("subvolume", "show", path) == nil
+}
+
+func run(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("btrfs", args...)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := bytes.TrimSpace(stderr.Bytes())
+		if len(msg) == 0 {
+			return err
+		}
+		return errors.Join(err, fmt.Errorf("btrfs: %s", msg))
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package btrfs
+
+import (
+	"testing"
+
+	"github.com/jxsl13/backupfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSnapshotUnsupported(t *testing.T) {
+	t.Parallel()
+
+	s := New(t.TempDir(), t.TempDir())
+
+	// a plain directory is never a subvolume
+	err := s.CreateSnapshot("/")
+	require.ErrorIs(t, err, backupfs.ErrSnapshotUnsupported)
+}
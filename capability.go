@@ -0,0 +1,35 @@
+package backupfs
+
+// CanChown reports whether fsys reports the ownership of its files and allows to change it.
+// The check creates a temporary file in the default temp directory of fsys, changes its ownership
+// to its current owner and removes it again.
+//
+// Platforms without uids and gids, e.g. windows, as well as filesystems that reject chown,
+// e.g. rootless containers or user namespaces with unmapped owners, report false.
+// BackupFS does not consult CanChown, it ignores the chown errors of those environments instead,
+// e.g. EPERM, EINVAL for unmapped owners or unsupported operations, so that backups and rollbacks
+// succeed and restored files keep the owner that created them. WithDisableChown skips chown entirely.
+func CanChown(fsys FS) bool {
+	f, err := CreateTemp(fsys, "", ".backupfs-chown-")
+	if err != nil {
+		return false
+	}
+	name := f.Name()
+	defer func() {
+		_ = fsys.Remove(name)
+	}()
+
+	fi, err := f.Stat()
+	_ = f.Close()
+	if err != nil {
+		return false
+	}
+
+	uid, gid := toUID(fi), toGID(fi)
+	if uid < 0 || gid < 0 {
+		return false
+	}
+
+	err = fsys.Chown(name, uid, gid)
+	return err == nil
+}
@@ -0,0 +1,33 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type chownRejectingFS struct {
+	FS
+}
+
+func (c *chownRejectingFS) Chown(name string, _, _ int) error {
+	return &fs.PathError{Op: "chown", Path: name, Err: fs.ErrPermission}
+}
+
+func TestCanChown(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	memFS := NewMemFS()
+	require.Equal(runtime.GOOS == "linux" || runtime.GOOS == "darwin", CanChown(memFS))
+	require.False(CanChown(&chownRejectingFS{FS: memFS}))
+
+	// the probe file is removed again
+	entries, err := memFS.ReadDir(os.TempDir())
+	require.NoError(err)
+	require.Empty(entries)
+}
@@ -0,0 +1,189 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrInvalidChain is returned by Chain in case that the layers cannot be stacked.
+	ErrInvalidChain = errors.New("invalid filesystem chain")
+)
+
+type layerKind int
+
+// the order of the layer kinds is the order in which they are stacked
+// from the bottom to the top.
+const (
+	layerVolume layerKind = iota
+	layerPrefix
+	layerHidden
+	layerBackup
+	layerTracking
+	layerNormalize
+)
+
+func (k layerKind) String() string {
+	switch k {
+	case layerVolume:
+		return "volume"
+	case layerPrefix:
+		return "prefix"
+	case layerHidden:
+		return "hidden"
+	case layerBackup:
+		return "backup"
+	case layerTracking:
+		return "tracking"
+	case layerNormalize:
+		return "normalize"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(k))
+	}
+}
+
+// Layer is a filesystem layer that can be stacked with Chain.
+type Layer struct {
+	kind  layerKind
+	apply func(s *Stack) error
+}
+
+// VolumeLayer adds a VolumeFS layer. See NewVolumeFS.
+func VolumeLayer(volume string) Layer {
+	return Layer{
+		kind: layerVolume,
+		apply: func(s *Stack) error {
+			s.Volume = NewVolumeFS(volume, s.Top)
+			s.push(s.Volume)
+			return nil
+		},
+	}
+}
+
+// PrefixLayer adds a PrefixFS layer. See NewPrefixFS.
+func PrefixLayer(prefix string) Layer {
+	return Layer{
+		kind: layerPrefix,
+		apply: func(s *Stack) error {
+			s.Prefix = NewPrefixFS(s.Top, prefix)
+			s.push(s.Prefix)
+			return nil
+		},
+	}
+}
+
+// HiddenLayer adds a HiddenFS layer. See NewHiddenFS.
+func HiddenLayer(hiddenPaths ...string) Layer {
+	return Layer{
+		kind: layerHidden,
+		apply: func(s *Stack) error {
+			if len(hiddenPaths) == 0 {
+				return fmt.Errorf("%w: no hidden paths provided", ErrInvalidChain)
+			}
+			s.Hidden = NewHiddenFS(s.Top, hiddenPaths...)
+			s.push(s.Hidden)
+			return nil
+		},
+	}
+}
+
+// BackupLayer adds a BackupFS layer that backs up the files of the underlying layers to backup.
+// The backup filesystem is not wrapped by the volume and prefix layers. See NewBackupFS.
+func BackupLayer(backup FS, opts ...BackupFSOption) Layer {
+	return Layer{
+		kind: layerBackup,
+		apply: func(s *Stack) error {
+			if backup == nil {
+				return fmt.Errorf("%w: backup filesystem is nil", ErrInvalidChain)
+			}
+			s.Backup = NewBackupFS(s.Top, backup, opts...)
+			s.push(s.Backup)
+			return nil
+		},
+	}
+}
+
+// TrackingLayer adds a TrackingFS layer on top of all other layers. See NewTrackingFS.
+func TrackingLayer(debug bool) Layer {
+	return Layer{
+		kind: layerTracking,
+		apply: func(s *Stack) error {
+			s.Tracking = NewTrackingFS(s.Top, debug)
+			s.push(s.Tracking)
+			return nil
+		},
+	}
+}
+
+// NormalizeLayer adds a NormalizeFS layer on top of all other layers. See NewNormalizeFS.
+func NormalizeLayer() Layer {
+	return Layer{
+		kind: layerNormalize,
+		apply: func(s *Stack) error {
+			s.Normalize = NewNormalizeFS(s.Top)
+			s.push(s.Normalize)
+			return nil
+		},
+	}
+}
+
+// Stack is the result of Chain.
+// Layers that were not requested are nil.
+type Stack struct {
+	// Top is the topmost layer that should be used.
+	Top FS
+	// Layers contains all layers from the bottom (base filesystem) to the top.
+	Layers []FS
+
+	Volume    *VolumeFS
+	Prefix    *PrefixFS
+	Hidden    *HiddenFS
+	Backup    *BackupFS
+	Tracking  *TrackingFS
+	Normalize *NormalizeFS
+}
+
+func (s *Stack) push(fsys FS) {
+	s.Top = fsys
+	s.Layers = append(s.Layers, fsys)
+}
+
+// Chain stacks the layers on top of the base filesystem.
+// Independent of the order in which the layers are passed, they are stacked in the order
+// volume, prefix, hidden, backup, tracking and normalize, from the bottom to the top.
+// That way the backup location can be hidden from the BackupFS user.
+// The volume and prefix are only applied to the base filesystem, the backup filesystem of BackupLayer
+// is used as passed, e.g. a PrefixFS of the base filesystem in order to keep the backup inside of the hidden path.
+// Every kind of layer may only be passed once.
+func Chain(base FS, layers ...Layer) (*Stack, error) {
+	if base == nil {
+		return nil, fmt.Errorf("%w: base filesystem is nil", ErrInvalidChain)
+	}
+
+	sorted := make([]Layer, len(layers))
+	copy(sorted, layers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].kind < sorted[j].kind
+	})
+
+	s := &Stack{
+		Top:    base,
+		Layers: make([]FS, 0, len(sorted)+1),
+	}
+	s.Layers = append(s.Layers, base)
+
+	for i, l := range sorted {
+		if l.apply == nil {
+			return nil, fmt.Errorf("%w: uninitialized layer", ErrInvalidChain)
+		}
+		if i > 0 && sorted[i-1].kind == l.kind {
+			return nil, fmt.Errorf("%w: duplicate %s layer", ErrInvalidChain, l.kind)
+		}
+		err := l.apply(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
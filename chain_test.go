@@ -0,0 +1,66 @@
+package backupfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/base/backup"
+	)
+	_, base, _, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backup := NewPrefixFS(base, "/backup")
+
+	// layers are stacked in the correct order independent of the argument order
+	s, err := Chain(base,
+		TrackingLayer(false),
+		BackupLayer(backup),
+		HiddenLayer("/backup"),
+		PrefixLayer("/"),
+		VolumeLayer(""),
+	)
+	require.NoError(err)
+	require.Len(s.Layers, 6)
+	require.Equal(base, s.Layers[0])
+	require.Equal(s.Volume, s.Layers[1])
+	require.Equal(s.Prefix, s.Layers[2])
+	require.Equal(s.Hidden, s.Layers[3])
+	require.Equal(s.Backup, s.Layers[4])
+	require.Equal(s.Tracking, s.Top)
+	require.Equal(s.Hidden, s.Backup.BaseFS())
+
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, s.Top, "/test/file.txt", "modified")
+	fileMustContainText(t, backup, "/test/file.txt", "original")
+	require.Empty(s.Tracking.OpenHandles())
+
+	// the backup location is not visible via the top layer
+	_, err = s.Top.Stat("/backup")
+	require.ErrorIs(err, ErrHiddenNotExist)
+
+	require.NoError(s.Backup.Rollback())
+	fileMustContainText(t, base, "/test/file.txt", "original")
+
+	_, err = Chain(base, PrefixLayer("/a"), PrefixLayer("/b"))
+	require.ErrorIs(err, ErrInvalidChain)
+
+	_, err = Chain(base, BackupLayer(nil))
+	require.ErrorIs(err, ErrInvalidChain)
+
+	_, err = Chain(base, Layer{})
+	require.ErrorIs(err, ErrInvalidChain)
+
+	_, err = Chain(nil)
+	require.ErrorIs(err, ErrInvalidChain)
+
+	s, err = Chain(base)
+	require.NoError(err)
+	require.Equal(base, s.Top)
+	require.Nil(s.Backup)
+}
@@ -0,0 +1,148 @@
+package backupfs
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// assert interfaces implemented
+	_ Clock      = (*ManualClock)(nil)
+	_ TimerClock = (*ManualClock)(nil)
+	_ Clock      = ClockFunc(nil)
+)
+
+// Clock provides the current time.
+// It allows to control all time stamps that are created by this package, e.g. in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// Timer is a scheduled function call, see TimerClock.
+type Timer interface {
+	// Stop prevents the call and returns false in case that it has already been made or stopped.
+	Stop() bool
+}
+
+// TimerClock is a Clock that also schedules function calls, e.g. for the watchdog of BeginWithDeadline.
+// Clocks that do not implement it schedule calls with time.AfterFunc.
+type TimerClock interface {
+	Clock
+	// AfterFunc calls f in its own goroutine once the clock has advanced by d.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// afterFunc schedules f with the clock c, see TimerClock.
+func afterFunc(c Clock, d time.Duration, f func()) Timer {
+	if tc, ok := c.(TimerClock); ok {
+		return tc.AfterFunc(d, f)
+	}
+	return time.AfterFunc(d, f)
+}
+
+// ClockFunc is a function that implements the Clock interface.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock returns the clock that is backed by time.Now.
+func SystemClock() Clock {
+	return ClockFunc(time.Now)
+}
+
+// NewManualClock creates a deterministic clock that only advances when it is told to.
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{
+		now: start,
+	}
+}
+
+// ManualClock is a deterministic Clock.
+// It is safe for concurrent use.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	step   time.Duration
+	timers []*manualTimer
+}
+
+// Now returns the current time of the clock.
+// In case that a step is configured, every call advances the clock by that step afterwards.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// Set sets the current time of the clock and fires the timers that are due, see AfterFunc.
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	c.fire()
+}
+
+// Advance moves the clock forward by d and fires the timers that are due, see AfterFunc.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// AfterFunc calls f in its own goroutine as soon as Set or Advance move the clock
+// to or past the current time plus d. The steps of SetStep do not fire timers.
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &manualTimer{c: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// fire starts the timers that are due, the lock must be held.
+func (c *ManualClock) fire() {
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		go t.f()
+	}
+	clear(c.timers[len(pending):])
+	c.timers = pending
+}
+
+type manualTimer struct {
+	c  *ManualClock
+	at time.Time
+	f  func()
+}
+
+func (t *manualTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+
+	for i, pending := range t.c.timers {
+		if pending == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetStep makes the clock advance by d after every call to Now.
+// This yields strictly monotonic time stamps without sleeping.
+func (c *ManualClock) SetStep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.step = d
+}
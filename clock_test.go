@@ -0,0 +1,85 @@
+package backupfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualClock(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	require.Equal(start, clock.Now())
+	require.Equal(start, clock.Now())
+
+	clock.Advance(time.Hour)
+	require.Equal(start.Add(time.Hour), clock.Now())
+
+	clock.SetStep(time.Second)
+	require.Equal(start.Add(time.Hour), clock.Now())
+	require.Equal(start.Add(time.Hour+time.Second), clock.Now())
+
+	clock.Set(start)
+	require.Equal(start, clock.Now())
+}
+
+func TestManualClock_AfterFunc(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		clock   = NewManualClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+		fired   = make(chan int, 2)
+	)
+
+	clock.AfterFunc(time.Minute, func() { fired <- 1 })
+	stopped := clock.AfterFunc(time.Minute, func() { fired <- 2 })
+	require.True(stopped.Stop())
+	require.False(stopped.Stop())
+
+	clock.Advance(time.Minute - time.Second)
+	require.Len(fired, 0)
+
+	clock.Advance(time.Second)
+	select {
+	case n := <-fired:
+		require.Equal(1, n)
+	case <-time.After(10 * time.Second):
+		require.FailNow("timer did not fire")
+	}
+	require.Len(fired, 0)
+}
+
+func TestBackupFS_WithClock(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+		start        = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		clock        = NewManualClock(start)
+	)
+	clock.SetStep(time.Second)
+
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup, WithClock(clock), WithHandleTracking(false))
+
+	f, err := backupFS.Create("/test.txt")
+	require.NoError(err)
+	handles := backupFS.OpenHandles()
+	require.Len(handles, 1)
+	require.Equal(start, handles[0].OpenedAt)
+	require.NoError(f.Close())
+
+	require.NoError(backupFS.Rollback())
+	report := backupFS.LastRollback()
+	require.NotNil(report)
+	require.Equal(start.Add(time.Second), report.StartedAt)
+	require.Equal(start.Add(2*time.Second), report.FinishedAt)
+}
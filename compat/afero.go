@@ -0,0 +1,238 @@
+package compat
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/jxsl13/backupfs"
+	"github.com/spf13/afero"
+)
+
+var (
+	// assert interfaces implemented
+	_ backupfs.FS     = (*fromAferoFS)(nil)
+	_ afero.Fs        = (*toAferoFS)(nil)
+	_ afero.Symlinker = (*toAferoFS)(nil)
+)
+
+// fromAferoFS wraps an afero.Fs in order to be used as backupfs.FS.
+type fromAferoFS struct {
+	base afero.Fs
+}
+
+func newFromAferoFS(base afero.Fs) backupfs.FS {
+	if t, ok := base.(*toAferoFS); ok {
+		// do not wrap twice
+		return t.base
+	}
+	return &fromAferoFS{base: base}
+}
+
+func (a *fromAferoFS) Create(name string) (backupfs.File, error) {
+	f, err := a.base.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (a *fromAferoFS) Mkdir(name string, perm fs.FileMode) error {
+	return a.base.Mkdir(name, perm)
+}
+
+func (a *fromAferoFS) MkdirAll(path string, perm fs.FileMode) error {
+	return a.base.MkdirAll(path, perm)
+}
+
+func (a *fromAferoFS) Open(name string) (backupfs.File, error) {
+	f, err := a.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (a *fromAferoFS) OpenFile(name string, flag int, perm fs.FileMode) (backupfs.File, error) {
+	f, err := a.base.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (a *fromAferoFS) Remove(name string) error {
+	return a.base.Remove(name)
+}
+
+func (a *fromAferoFS) RemoveAll(path string) error {
+	return a.base.RemoveAll(path)
+}
+
+func (a *fromAferoFS) Rename(oldname, newname string) error {
+	return a.base.Rename(oldname, newname)
+}
+
+func (a *fromAferoFS) Stat(name string) (fs.FileInfo, error) {
+	return a.base.Stat(name)
+}
+
+func (a *fromAferoFS) Name() string {
+	return a.base.Name()
+}
+
+func (a *fromAferoFS) Chmod(name string, mode fs.FileMode) error {
+	return a.base.Chmod(name, mode)
+}
+
+func (a *fromAferoFS) Chown(name string, uid, gid int) error {
+	return a.base.Chown(name, uid, gid)
+}
+
+func (a *fromAferoFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return a.base.Chtimes(name, atime, mtime)
+}
+
+// Truncate is not part of the afero.Fs interface, the file is opened and truncated instead.
+func (a *fromAferoFS) Truncate(name string, size int64) error {
+	f, err := a.base.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (a *fromAferoFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := afero.ReadDir(a.base, name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, fi := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	return entries, nil
+}
+
+// Lstat falls back to Stat in case that the afero filesystem does not support Lstat.
+func (a *fromAferoFS) Lstat(name string) (fs.FileInfo, error) {
+	if l, ok := a.base.(afero.Lstater); ok {
+		fi, _, err := l.LstatIfPossible(name)
+		return fi, err
+	}
+	return a.base.Stat(name)
+}
+
+func (a *fromAferoFS) Symlink(oldname, newname string) error {
+	if l, ok := a.base.(afero.Linker); ok {
+		return l.SymlinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: afero.ErrNoSymlink}
+}
+
+func (a *fromAferoFS) Readlink(name string) (string, error) {
+	if l, ok := a.base.(afero.LinkReader); ok {
+		return l.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+}
+
+// Lchown is not part of the afero interfaces, only the afero.OsFs supports it.
+func (a *fromAferoFS) Lchown(name string, uid int, gid int) error {
+	if _, ok := a.base.(*afero.OsFs); ok {
+		return os.Lchown(name, uid, gid)
+	}
+	return &os.PathError{Op: "lchown", Path: name, Err: errors.ErrUnsupported}
+}
+
+// toAferoFS wraps a backupfs.FS in order to be used as afero.Fs.
+type toAferoFS struct {
+	base backupfs.FS
+}
+
+func newToAferoFS(base backupfs.FS) *toAferoFS {
+	return &toAferoFS{base: base}
+}
+
+func (a *toAferoFS) Create(name string) (afero.File, error) {
+	f, err := a.base.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (a *toAferoFS) Mkdir(name string, perm fs.FileMode) error {
+	return a.base.Mkdir(name, perm)
+}
+
+func (a *toAferoFS) MkdirAll(path string, perm fs.FileMode) error {
+	return a.base.MkdirAll(path, perm)
+}
+
+func (a *toAferoFS) Open(name string) (afero.File, error) {
+	f, err := a.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (a *toAferoFS) OpenFile(name string, flag int, perm fs.FileMode) (afero.File, error) {
+	f, err := a.base.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (a *toAferoFS) Remove(name string) error {
+	return a.base.Remove(name)
+}
+
+func (a *toAferoFS) RemoveAll(path string) error {
+	return a.base.RemoveAll(path)
+}
+
+func (a *toAferoFS) Rename(oldname, newname string) error {
+	return a.base.Rename(oldname, newname)
+}
+
+func (a *toAferoFS) Stat(name string) (fs.FileInfo, error) {
+	return a.base.Stat(name)
+}
+
+func (a *toAferoFS) Name() string {
+	return a.base.Name()
+}
+
+func (a *toAferoFS) Chmod(name string, mode fs.FileMode) error {
+	return a.base.Chmod(name, mode)
+}
+
+func (a *toAferoFS) Chown(name string, uid, gid int) error {
+	return a.base.Chown(name, uid, gid)
+}
+
+func (a *toAferoFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return a.base.Chtimes(name, atime, mtime)
+}
+
+func (a *toAferoFS) LstatIfPossible(name string) (fs.FileInfo, bool, error) {
+	fi, err := a.base.Lstat(name)
+	return fi, true, err
+}
+
+func (a *toAferoFS) SymlinkIfPossible(oldname, newname string) error {
+	return a.base.Symlink(oldname, newname)
+}
+
+func (a *toAferoFS) ReadlinkIfPossible(name string) (string, error) {
+	return a.base.Readlink(name)
+}
@@ -0,0 +1,66 @@
+package compat
+
+import (
+	"github.com/spf13/afero"
+)
+
+// BehaviorChange describes a difference in behavior between the afero based v0 API
+// and the current backupfs.FS based API.
+type BehaviorChange struct {
+	// ID is a short, stable identifier of the behavior change.
+	ID string
+	// Description describes the behavior change and how to migrate.
+	Description string
+}
+
+// behavior changes that affect every user of the v0 API
+var generalChanges = []BehaviorChange{
+	{
+		ID:          "fs-interface",
+		Description: "layers are constructed on top of backupfs.FS instead of afero.Fs, use compat.ToFS and compat.ToAfero at the boundaries",
+	},
+	{
+		ID:          "prefixfs-parameters",
+		Description: "backupfs.NewPrefixFS(fs, prefix) takes the filesystem as first and the prefix as second parameter",
+	},
+	{
+		ID:          "symlinks-required",
+		Description: "backupfs.FS requires Lstat, Symlink, Readlink and Lchown, symlinks are resolved by BackupFS itself",
+	},
+}
+
+// CheckCompat audits the passed afero filesystem and returns the behavior changes that
+// the caller needs to be aware of when migrating from the v0 API to the backupfs.FS based API.
+func CheckCompat(fsys afero.Fs) []BehaviorChange {
+	changes := append(make([]BehaviorChange, 0, len(generalChanges)+4), generalChanges...)
+
+	if _, ok := fsys.(afero.Lstater); !ok {
+		changes = append(changes, BehaviorChange{
+			ID:          "no-lstat",
+			Description: "the filesystem does not support Lstat, Lstat falls back to Stat which follows symlinks",
+		})
+	}
+
+	if _, ok := fsys.(afero.Linker); !ok {
+		changes = append(changes, BehaviorChange{
+			ID:          "no-symlink",
+			Description: "the filesystem does not support Symlink, backups and rollbacks of symlinks fail",
+		})
+	}
+
+	if _, ok := fsys.(afero.LinkReader); !ok {
+		changes = append(changes, BehaviorChange{
+			ID:          "no-readlink",
+			Description: "the filesystem does not support Readlink, paths containing symlinks cannot be resolved",
+		})
+	}
+
+	if _, ok := fsys.(*afero.OsFs); !ok {
+		changes = append(changes, BehaviorChange{
+			ID:          "no-lchown",
+			Description: "the filesystem does not support Lchown, the ownership of symlinks is not restored",
+		})
+	}
+
+	return changes
+}
@@ -0,0 +1,110 @@
+// Package compat reproduces the afero based constructors of the v0 API on top of the
+// backupfs.FS interface. It allows large code bases to upgrade incrementally.
+// New code should use the backupfs package directly.
+package compat
+
+import (
+	"io/fs"
+
+	"github.com/jxsl13/backupfs"
+	"github.com/spf13/afero"
+)
+
+// NewBackupFs creates a new layered backup file system that backups files from base to backup in case that an
+// existing file in base is about to be overwritten or removed.
+//
+// Deprecated: use backupfs.NewBackupFS instead.
+func NewBackupFs(base, backup afero.Fs) *BackupFs {
+	bfs := backupfs.NewBackupFS(newFromAferoFS(base), newFromAferoFS(backup))
+	return &BackupFs{
+		toAferoFS: newToAferoFS(bfs),
+		bfs:       bfs,
+	}
+}
+
+// BackupFs is the afero compatible counterpart of backupfs.BackupFS.
+//
+// Deprecated: use backupfs.BackupFS instead.
+type BackupFs struct {
+	*toAferoFS
+	bfs *backupfs.BackupFS
+}
+
+// BackupFS returns the underlying backupfs.BackupFS.
+func (b *BackupFs) BackupFS() *backupfs.BackupFS {
+	return b.bfs
+}
+
+// GetBaseFs returns the fs layer that is being written to
+func (b *BackupFs) GetBaseFs() afero.Fs {
+	return newToAferoFS(b.bfs.BaseFS())
+}
+
+// GetBackupFs returns the fs layer that is used to store the backups
+func (b *BackupFs) GetBackupFs() afero.Fs {
+	return newToAferoFS(b.bfs.BackupFS())
+}
+
+// Rollback see backupfs.BackupFS.Rollback
+func (b *BackupFs) Rollback() error {
+	return b.bfs.Rollback()
+}
+
+// ForceBackup see backupfs.BackupFS.ForceBackup
+func (b *BackupFs) ForceBackup(name string) error {
+	return b.bfs.ForceBackup(name)
+}
+
+// Map see backupfs.BackupFS.Map
+func (b *BackupFs) Map() map[string]fs.FileInfo {
+	return b.bfs.Map()
+}
+
+// SetMap see backupfs.BackupFS.SetMap
+func (b *BackupFs) SetMap(metadata map[string]fs.FileInfo) {
+	b.bfs.SetMap(metadata)
+}
+
+func (b *BackupFs) MarshalJSON() ([]byte, error) {
+	return b.bfs.MarshalJSON()
+}
+
+func (b *BackupFs) UnmarshalJSON(data []byte) error {
+	return b.bfs.UnmarshalJSON(data)
+}
+
+// NewPrefixFs creates a new file system abstraction that forces any path to be prepended with
+// the provided prefix.
+//
+// Deprecated: use backupfs.NewPrefixFS instead, which has swapped parameters.
+func NewPrefixFs(prefixPath string, fsys afero.Fs) afero.Fs {
+	return newToAferoFS(backupfs.NewPrefixFS(newFromAferoFS(fsys), prefixPath))
+}
+
+// NewHiddenFs hides away anthing beneath the specified paths.
+//
+// Deprecated: use backupfs.NewHiddenFS instead.
+func NewHiddenFs(base afero.Fs, hiddenPaths ...string) afero.Fs {
+	return newToAferoFS(backupfs.NewHiddenFS(newFromAferoFS(base), hiddenPaths...))
+}
+
+// NewVolumeFs prefixes absolute paths with the provided volume.
+//
+// Deprecated: use backupfs.NewVolumeFS instead.
+func NewVolumeFs(volume string, fsys afero.Fs) afero.Fs {
+	return newToAferoFS(backupfs.NewVolumeFS(volume, newFromAferoFS(fsys)))
+}
+
+// ToFS converts an afero.Fs into a backupfs.FS.
+func ToFS(fsys afero.Fs) backupfs.FS {
+	return newFromAferoFS(fsys)
+}
+
+// ToAfero converts a backupfs.FS into an afero.Fs.
+func ToAfero(fsys backupfs.FS) afero.Fs {
+	if f, ok := fsys.(*fromAferoFS); ok {
+		// do not wrap twice
+		return f.base
+	}
+	return newToAferoFS(fsys)
+}
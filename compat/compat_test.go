@@ -0,0 +1,102 @@
+package compat
+
+import (
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAferoFile(t *testing.T, fsys afero.Fs, name, content string) {
+	require := require.New(t)
+	f, err := fsys.Create(name)
+	require.NoError(err)
+	_, err = f.WriteString(content)
+	require.NoError(err)
+	require.NoError(f.Close())
+}
+
+func readAferoFile(t *testing.T, fsys afero.Fs, name string) string {
+	require := require.New(t)
+	f, err := fsys.Open(name)
+	require.NoError(err)
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	require.NoError(err)
+	return string(b)
+}
+
+func TestNewBackupFs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		mem     = afero.NewMemMapFs()
+		base    = NewPrefixFs("/base", mem)
+		backup  = NewPrefixFs("/backup", mem)
+	)
+	require.NoError(mem.MkdirAll("/base/test", 0755))
+	require.NoError(mem.MkdirAll("/backup", 0755))
+	writeAferoFile(t, base, "/test/file.txt", "original")
+
+	bfs := NewBackupFs(NewHiddenFs(base, "/hidden"), backup)
+	writeAferoFile(t, bfs, "/test/file.txt", "modified")
+	writeAferoFile(t, bfs, "/test/new.txt", "new")
+
+	require.Equal("modified", readAferoFile(t, base, "/test/file.txt"))
+	require.Equal("original", readAferoFile(t, backup, "/test/file.txt"))
+
+	data, err := bfs.MarshalJSON()
+	require.NoError(err)
+	require.NotEmpty(data)
+
+	require.NoError(bfs.Rollback())
+
+	require.Equal("original", readAferoFile(t, base, "/test/file.txt"))
+	_, err = base.Stat("/test/new.txt")
+	require.ErrorIs(err, afero.ErrFileNotFound)
+	require.Empty(bfs.Map())
+}
+
+func TestToAfero(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		mem     = afero.NewMemMapFs()
+	)
+
+	// no double wrapping
+	require.Same(mem, ToAfero(ToFS(mem)))
+
+	fsys := ToFS(mem)
+	_, err := fsys.Readlink("/does/not/exist")
+	require.ErrorIs(err, afero.ErrNoReadlink)
+}
+
+func TestCheckCompat(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	ids := func(changes []BehaviorChange) []string {
+		result := make([]string, 0, len(changes))
+		for _, c := range changes {
+			result = append(result, c.ID)
+		}
+		return result
+	}
+
+	memChanges := ids(CheckCompat(afero.NewMemMapFs()))
+	require.Contains(memChanges, "fs-interface")
+	require.Contains(memChanges, "no-symlink")
+	require.Contains(memChanges, "no-lchown")
+	require.NotContains(memChanges, "no-lstat")
+
+	osChanges := ids(CheckCompat(afero.NewOsFs()))
+	require.Contains(osChanges, "fs-interface")
+	require.NotContains(osChanges, "no-symlink")
+	require.NotContains(osChanges, "no-readlink")
+	require.NotContains(osChanges, "no-lchown")
+}
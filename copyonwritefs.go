@@ -0,0 +1,757 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// assert interfaces implemented
+	_ FS = (*CopyOnWriteFS)(nil)
+)
+
+// whiteoutPrefix marks removed base files in the layer, like the whiteouts of AUFS and OverlayFS.
+const whiteoutPrefix = ".wh."
+
+// NewCopyOnWriteFS creates a union filesystem that reads from layer and falls back to base.
+// All modifications are applied to layer, base is never modified: files, directories and symlinks
+// are copied up to the layer including their mode, ownership and modification time before they are changed.
+// Removed base files are hidden with whiteout files named ".wh.<name>" in the layer,
+// which is why files with that prefix cannot be created.
+//
+// Contrary to a BackupFS, which modifies the base filesystem and allows to roll back the changes,
+// a CopyOnWriteFS is a sandbox: discarding the layer discards all modifications.
+func NewCopyOnWriteFS(base, layer FS) *CopyOnWriteFS {
+	return &CopyOnWriteFS{
+		base:  base,
+		layer: layer,
+		opts:  &backupFSOptions{},
+	}
+}
+
+// CopyOnWriteFS is a union filesystem of a read-only base filesystem and a writable layer.
+type CopyOnWriteFS struct {
+	base  FS
+	layer FS
+	// options of the copy up
+	opts *backupFSOptions
+}
+
+// Name returns the name of this FileSystem
+func (c *CopyOnWriteFS) Name() string {
+	return "CopyOnWriteFS"
+}
+
+// Unwrap returns the base filesystem.
+func (c *CopyOnWriteFS) Unwrap() FS {
+	return c.base
+}
+
+// Layer returns the filesystem that contains all modifications.
+func (c *CopyOnWriteFS) Layer() FS {
+	return c.layer
+}
+
+func whiteoutPath(name string) string {
+	return filepath.Join(filepath.Dir(name), whiteoutPrefix+filepath.Base(name))
+}
+
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), whiteoutPrefix)
+}
+
+// baseHidden returns true in case that the base file at resolvedName or any of its parent directories
+// has been removed. Entries of the layer are not hidden by whiteouts, which allows to replace removed
+// base directories with new directories whose base content stays hidden.
+func (c *CopyOnWriteFS) baseHidden(resolvedName string) (bool, error) {
+	for name := resolvedName; ; name = filepath.Dir(name) {
+		if TrimVolume(name) == separator {
+			return false, nil
+		}
+		_, found, err := lexists(c.layer, whiteoutPath(name))
+		if err != nil || found {
+			return found, err
+		}
+	}
+}
+
+// inLayer returns the file info of resolvedName in the layer.
+func (c *CopyOnWriteFS) inLayer(resolvedName string) (fs.FileInfo, bool, error) {
+	fi, found, err := lexists(c.layer, resolvedName)
+	if errors.Is(err, syscall.ENOTDIR) {
+		// a parent directory was replaced by a file
+		return nil, false, nil
+	}
+	return fi, found, err
+}
+
+// inBase returns the file info of resolvedName in the base filesystem in case that it is visible.
+func (c *CopyOnWriteFS) inBase(resolvedName string) (fs.FileInfo, bool, error) {
+	hidden, err := c.baseHidden(resolvedName)
+	if err != nil || hidden {
+		return nil, false, err
+	}
+	fi, found, err := lexists(c.base, resolvedName)
+	if errors.Is(err, syscall.ENOTDIR) {
+		return nil, false, nil
+	}
+	return fi, found, err
+}
+
+// lstat describes the path whose parent directories are already resolved within the union.
+func (c *CopyOnWriteFS) lstat(resolvedName string) (fs.FileInfo, error) {
+	if isWhiteout(resolvedName) {
+		return nil, fs.ErrNotExist
+	}
+	fi, found, err := c.inLayer(resolvedName)
+	if err != nil || found {
+		return fi, err
+	}
+	fi, found, err = c.inBase(resolvedName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	return fi, nil
+}
+
+// readlink reads the symlink whose parent directories are already resolved within the union.
+func (c *CopyOnWriteFS) readlink(resolvedName string) (string, error) {
+	_, found, err := c.inLayer(resolvedName)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return c.layer.Readlink(resolvedName)
+	}
+	return c.base.Readlink(resolvedName)
+}
+
+// unionResolver resolves paths with the raw lookups of the union.
+type unionResolver struct {
+	c *CopyOnWriteFS
+}
+
+func (u unionResolver) Lstat(name string) (fs.FileInfo, error) {
+	return u.c.lstat(name)
+}
+
+func (u unionResolver) Readlink(name string) (string, error) {
+	return u.c.readlink(name)
+}
+
+// resolve resolves all symlinks in the parent directories of name.
+// The returned file info is nil in case that the path does not exist.
+func (c *CopyOnWriteFS) resolve(name string) (string, fs.FileInfo, error) {
+	resolvedName, fi, err := resolvePathWithInfo(unionResolver{c}, normalizePath(name))
+	if err != nil {
+		return "", nil, err
+	}
+	if isWhiteout(resolvedName) {
+		return "", nil, fs.ErrPermission
+	}
+	return resolvedName, fi, nil
+}
+
+// resolveTarget resolves name like resolve and additionally follows the symlink that name may point at.
+func (c *CopyOnWriteFS) resolveTarget(name string) (string, fs.FileInfo, error) {
+	resolvedName, fi, err := c.resolve(name)
+	if err != nil || fi == nil || fi.Mode()&os.ModeSymlink == 0 {
+		return resolvedName, fi, err
+	}
+
+	target, found, err := resolveSymlinkTarget(unionResolver{c}, resolvedName)
+	if err != nil {
+		return "", nil, err
+	}
+	if !found {
+		return target, nil, nil
+	}
+	fi, err = c.lstat(target)
+	if err != nil {
+		return "", nil, err
+	}
+	return target, fi, nil
+}
+
+// parentDir returns an error in case that the parent directory of resolvedName does not exist in the union.
+func (c *CopyOnWriteFS) parentDir(resolvedName string) error {
+	fi, err := c.lstat(filepath.Dir(resolvedName))
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return syscall.ENOTDIR
+	}
+	return nil
+}
+
+// copyUpDirs copies all directories of resolvedDirPath that only exist in the base filesystem to the layer.
+func (c *CopyOnWriteFS) copyUpDirs(resolvedDirPath string) error {
+	_, err := IterateDirTree(resolvedDirPath, func(dir string) (bool, error) {
+		_, found, err := c.inLayer(dir)
+		if err != nil || found {
+			return err == nil, err
+		}
+		fi, err := c.base.Lstat(dir)
+		if err != nil {
+			return false, err
+		}
+		return true, copyDir(c.layer, dir, fi, c.opts)
+	})
+	return err
+}
+
+// copyUp copies the file, directory or symlink at resolvedName to the layer in case that it only exists in the base filesystem.
+// Directories are copied without their content.
+func (c *CopyOnWriteFS) copyUp(resolvedName string) error {
+	_, found, err := c.inLayer(resolvedName)
+	if err != nil || found {
+		return err
+	}
+
+	fi, found, err := c.inBase(resolvedName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fs.ErrNotExist
+	}
+
+	err = c.copyUpDirs(filepath.Dir(resolvedName))
+	if err != nil {
+		return err
+	}
+
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		return copyDir(c.layer, resolvedName, fi, c.opts)
+	case mode.IsRegular():
+		f, err := c.base.Open(resolvedName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return copyFile(c.layer, resolvedName, fi, f, c.opts)
+	case mode&os.ModeSymlink != 0:
+		return copySymlink(c.base, c.layer, resolvedName, fi, c.opts)
+	default:
+		return syscall.ENOTSUP
+	}
+}
+
+// copyUpTree copies the directory tree at resolvedName to the layer.
+func (c *CopyOnWriteFS) copyUpTree(resolvedName string) error {
+	err := c.copyUp(resolvedName)
+	if err != nil {
+		return err
+	}
+	fi, err := c.lstat(resolvedName)
+	if err != nil || !fi.IsDir() {
+		return err
+	}
+
+	infos, err := c.readDir(resolvedName)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		err = c.copyUpTree(filepath.Join(resolvedName, info.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// whiteout hides the base file at resolvedName in case that it exists.
+func (c *CopyOnWriteFS) whiteout(resolvedName string) error {
+	_, found, err := c.inBase(resolvedName)
+	if err != nil || !found {
+		return err
+	}
+
+	err = c.copyUpDirs(filepath.Dir(resolvedName))
+	if err != nil {
+		return err
+	}
+	f, err := c.layer.OpenFile(whiteoutPath(resolvedName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readDir returns the merged directory entries of the layer and the base filesystem sorted by filename.
+func (c *CopyOnWriteFS) readDir(resolvedDirPath string) ([]fs.FileInfo, error) {
+	var (
+		infos     = make(map[string]fs.FileInfo)
+		whiteouts = make(map[string]bool)
+	)
+
+	_, found, err := c.inLayer(resolvedDirPath)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		entries, err := c.layer.ReadDir(resolvedDirPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if strings.HasPrefix(name, whiteoutPrefix) {
+				whiteouts[strings.TrimPrefix(name, whiteoutPrefix)] = true
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos[name] = fi
+		}
+	}
+
+	fi, found, err := c.inBase(resolvedDirPath)
+	if err != nil {
+		return nil, err
+	}
+	if found && fi.IsDir() {
+		entries, err := c.base.ReadDir(resolvedDirPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if _, ok := infos[name]; ok || whiteouts[name] {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos[name] = fi
+		}
+	}
+
+	result := make([]fs.FileInfo, 0, len(infos))
+	for _, fi := range infos {
+		result = append(result, fi)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (c *CopyOnWriteFS) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (c *CopyOnWriteFS) Mkdir(name string, perm fs.FileMode) error {
+	err := c.mkdir(name, perm)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (c *CopyOnWriteFS) mkdir(name string, perm fs.FileMode) error {
+	resolvedName, fi, err := c.resolve(name)
+	if err != nil {
+		return err
+	}
+	if fi != nil {
+		return fs.ErrExist
+	}
+	err = c.parentDir(resolvedName)
+	if err != nil {
+		return err
+	}
+	err = c.copyUpDirs(filepath.Dir(resolvedName))
+	if err != nil {
+		return err
+	}
+	return c.layer.Mkdir(resolvedName, perm)
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (c *CopyOnWriteFS) MkdirAll(name string, perm fs.FileMode) error {
+	_, err := IterateDirTree(normalizePath(name), func(dir string) (bool, error) {
+		fi, err := c.Stat(dir)
+		switch {
+		case isNotFoundError(err):
+			err = c.Mkdir(dir, perm)
+			if err != nil && !errors.Is(err, fs.ErrExist) {
+				return false, err
+			}
+		case err != nil:
+			return false, err
+		case !fi.IsDir():
+			return false, &os.PathError{Op: "mkdir_all", Path: dir, Err: syscall.ENOTDIR}
+		}
+		return true, nil
+	})
+	return err
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (c *CopyOnWriteFS) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+// Files that are opened for writing are copied up to the layer.
+func (c *CopyOnWriteFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := c.openFile(name, flag, perm)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (c *CopyOnWriteFS) openFile(name string, flag int, perm fs.FileMode) (File, error) {
+	resolvedName, fi, err := c.resolveTarget(name)
+	if err != nil {
+		return nil, err
+	}
+
+	modify := flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+	switch {
+	case fi == nil && flag&os.O_CREATE == 0:
+		return nil, fs.ErrNotExist
+	case fi == nil:
+		err = c.parentDir(resolvedName)
+		if err != nil {
+			return nil, err
+		}
+		err = c.copyUpDirs(filepath.Dir(resolvedName))
+		if err != nil {
+			return nil, err
+		}
+	case fi.IsDir():
+		if modify {
+			return nil, syscall.EISDIR
+		}
+		return c.openDir(resolvedName, name)
+	case modify:
+		err = c.copyUp(resolvedName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, found, err := c.inLayer(resolvedName)
+	if err != nil {
+		return nil, err
+	}
+	if found || modify {
+		return c.layer.OpenFile(resolvedName, flag, perm)
+	}
+	return c.base.OpenFile(resolvedName, flag, perm)
+}
+
+func (c *CopyOnWriteFS) openDir(resolvedName, name string) (File, error) {
+	fsys := c.base
+	_, found, err := c.inLayer(resolvedName)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		fsys = c.layer
+	}
+
+	f, err := fsys.Open(resolvedName)
+	if err != nil {
+		return nil, err
+	}
+	return newListedDir(f, func() ([]fs.FileInfo, error) {
+		return c.readDir(resolvedName)
+	}), nil
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (c *CopyOnWriteFS) Remove(name string) error {
+	err := c.remove(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (c *CopyOnWriteFS) remove(name string) error {
+	resolvedName, fi, err := c.resolve(name)
+	if err != nil {
+		return err
+	}
+	if fi == nil {
+		return fs.ErrNotExist
+	}
+
+	if fi.IsDir() {
+		infos, err := c.readDir(resolvedName)
+		if err != nil {
+			return err
+		}
+		if len(infos) > 0 {
+			return syscall.ENOTEMPTY
+		}
+	}
+	return c.removePath(resolvedName)
+}
+
+// removePath removes resolvedName from the layer and hides it in the base filesystem.
+func (c *CopyOnWriteFS) removePath(resolvedName string) error {
+	_, found, err := c.inLayer(resolvedName)
+	if err != nil {
+		return err
+	}
+	if found {
+		// directories may still contain whiteouts
+		err = c.layer.RemoveAll(resolvedName)
+		if err != nil {
+			return err
+		}
+	}
+	return c.whiteout(resolvedName)
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (c *CopyOnWriteFS) RemoveAll(name string) error {
+	resolvedName, fi, err := c.resolve(name)
+	if err == nil && fi != nil {
+		err = c.removePath(resolvedName)
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove_all", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Rename renames a file.
+// Directories that exist in the base filesystem are copied up to the layer as a whole.
+func (c *CopyOnWriteFS) Rename(oldname, newname string) error {
+	err := c.rename(oldname, newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (c *CopyOnWriteFS) rename(oldname, newname string) error {
+	oldPath, oldInfo, err := c.resolve(oldname)
+	if err != nil {
+		return err
+	}
+	if oldInfo == nil {
+		return fs.ErrNotExist
+	}
+	newPath, newInfo, err := c.resolve(newname)
+	if err != nil {
+		return err
+	}
+	if oldPath == newPath {
+		return nil
+	}
+
+	if newInfo != nil {
+		switch {
+		case newInfo.IsDir() && !oldInfo.IsDir():
+			return syscall.EISDIR
+		case !newInfo.IsDir() && oldInfo.IsDir():
+			return syscall.ENOTDIR
+		case newInfo.IsDir():
+			infos, err := c.readDir(newPath)
+			if err != nil {
+				return err
+			}
+			if len(infos) > 0 {
+				return syscall.ENOTEMPTY
+			}
+		}
+
+		// the renamed file replaces the target, base content must not show through
+		err = c.removePath(newPath)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = c.parentDir(newPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.copyUpTree(oldPath)
+	if err != nil {
+		return err
+	}
+	err = c.copyUpDirs(filepath.Dir(newPath))
+	if err != nil {
+		return err
+	}
+	err = c.layer.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	return c.whiteout(oldPath)
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (c *CopyOnWriteFS) Stat(name string) (fs.FileInfo, error) {
+	return statResolved(unionResolver{c}, name)
+}
+
+// Lstat returns a FileInfo describing the named file without following symlinks.
+func (c *CopyOnWriteFS) Lstat(name string) (fs.FileInfo, error) {
+	_, fi, err := c.resolve(name)
+	if err == nil && fi == nil {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+// modify copies the file up to the layer and applies f to it.
+func (c *CopyOnWriteFS) modify(op, name string, follow bool, f func(resolvedName string) error) error {
+	var (
+		resolvedName string
+		fi           fs.FileInfo
+		err          error
+	)
+	if follow {
+		resolvedName, fi, err = c.resolveTarget(name)
+	} else {
+		resolvedName, fi, err = c.resolve(name)
+	}
+	if err == nil && fi == nil {
+		err = fs.ErrNotExist
+	}
+	if err == nil {
+		err = c.copyUp(resolvedName)
+	}
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return f(resolvedName)
+}
+
+// Chmod changes the mode of the named file to mode.
+func (c *CopyOnWriteFS) Chmod(name string, mode fs.FileMode) error {
+	return c.modify("chmod", name, true, func(resolvedName string) error {
+		return c.layer.Chmod(resolvedName, mode)
+	})
+}
+
+// Chown changes the uid and gid of the named file.
+func (c *CopyOnWriteFS) Chown(name string, uid, gid int) error {
+	return c.modify("chown", name, true, func(resolvedName string) error {
+		return c.layer.Chown(resolvedName, uid, gid)
+	})
+}
+
+// Lchown does not fallback to chown. It does return an error in case that lchown cannot be called.
+func (c *CopyOnWriteFS) Lchown(name string, uid, gid int) error {
+	return c.modify("lchown", name, false, func(resolvedName string) error {
+		return c.layer.Lchown(resolvedName, uid, gid)
+	})
+}
+
+// Chtimes changes the access and modification times of the named file
+func (c *CopyOnWriteFS) Chtimes(name string, atime, mtime time.Time) error {
+	return c.modify("chtimes", name, true, func(resolvedName string) error {
+		return c.layer.Chtimes(resolvedName, atime, mtime)
+	})
+}
+
+// Truncate changes the size of the named file.
+func (c *CopyOnWriteFS) Truncate(name string, size int64) error {
+	return c.modify("truncate", name, true, func(resolvedName string) error {
+		return c.layer.Truncate(resolvedName, size)
+	})
+}
+
+// ReadDir reads the named directory and returns the merged directory entries of the layer
+// and the base filesystem sorted by filename.
+func (c *CopyOnWriteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	resolvedName, fi, err := c.resolveTarget(name)
+	switch {
+	case err != nil:
+	case fi == nil:
+		err = fs.ErrNotExist
+	case !fi.IsDir():
+		err = syscall.ENOTDIR
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	infos, err := c.readDir(resolvedName)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// Symlink creates a symlink at newname that points to oldname.
+func (c *CopyOnWriteFS) Symlink(oldname, newname string) error {
+	err := c.symlink(oldname, newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (c *CopyOnWriteFS) symlink(oldname, newname string) error {
+	resolvedName, fi, err := c.resolve(newname)
+	if err != nil {
+		return err
+	}
+	if fi != nil {
+		return fs.ErrExist
+	}
+	err = c.parentDir(resolvedName)
+	if err != nil {
+		return err
+	}
+	err = c.copyUpDirs(filepath.Dir(resolvedName))
+	if err != nil {
+		return err
+	}
+	return c.layer.Symlink(oldname, resolvedName)
+}
+
+// Readlink returns the target of the symlink.
+func (c *CopyOnWriteFS) Readlink(name string) (string, error) {
+	resolvedName, fi, err := c.resolve(name)
+	if err == nil && fi == nil {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return c.readlink(resolvedName)
+}
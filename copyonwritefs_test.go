@@ -0,0 +1,95 @@
+package backupfs
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyOnWriteFS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		layer   = NewMemFS()
+		cow     = NewCopyOnWriteFS(base, layer)
+	)
+
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, base, "/test/dir/nested.txt", "nested")
+	createFile(t, base, "/test/removed/file.txt", "removed")
+	createSymlink(t, base, "/test/file.txt", "/test/link")
+	require.NoError(base.Chmod("/test/dir", 0700))
+	initialState := createFSState(t, base, "/")
+
+	// reads fall back to the base filesystem
+	fileMustContainText(t, cow, "/test/link", "original")
+	fileMustContainText(t, cow, "/test/dir/nested.txt", "nested")
+
+	// writes are copied up
+	createFile(t, cow, "/test/link", "modified")
+	fileMustContainText(t, cow, "/test/file.txt", "modified")
+	fileMustContainText(t, layer, "/test/file.txt", "modified")
+	mustNotLExist(t, layer, "/test/link")
+
+	createFile(t, cow, "/test/dir/new.txt", "new")
+	fi, err := layer.Stat("/test/dir")
+	require.NoError(err)
+	require.Equal(fs.FileMode(0700), fi.Mode().Perm())
+
+	require.NoError(cow.Lchown("/test/link", 1000, 1000))
+	mustLExist(t, layer, "/test/link")
+	require.NoError(cow.Chmod("/test/dir/nested.txt", 0600))
+	fi, err = cow.Stat("/test/dir/nested.txt")
+	require.NoError(err)
+	require.Equal(fs.FileMode(0600), fi.Mode().Perm())
+
+	// removed base files are hidden
+	require.NoError(cow.Remove("/test/dir/nested.txt"))
+	mustNotLExist(t, cow, "/test/dir/nested.txt")
+	require.NoError(cow.RemoveAll("/test/removed"))
+	mustNotLExist(t, cow, "/test/removed/file.txt")
+	mustNotLExist(t, cow, "/test/removed")
+	require.ErrorIs(cow.Remove("/test/removed"), fs.ErrNotExist)
+
+	// recreated directories do not show the removed base content
+	mkdirAll(t, cow, "/test/removed", 0755)
+	entries, err := cow.ReadDir("/test/removed")
+	require.NoError(err)
+	require.Empty(entries)
+
+	// merged directory listing without whiteouts
+	entries, err = cow.ReadDir("/test")
+	require.NoError(err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.Equal([]string{"dir", "file.txt", "link", "removed"}, names)
+
+	f, err := cow.Open("/test/dir")
+	require.NoError(err)
+	dirNames, err := f.Readdirnames(-1)
+	require.NoError(err)
+	require.Equal([]string{"new.txt"}, dirNames)
+	require.NoError(f.Close())
+
+	// whiteouts cannot be accessed
+	_, err = cow.Create("/test/.wh.file.txt")
+	require.ErrorIs(err, fs.ErrPermission)
+
+	// renamed base directories are copied up as a whole
+	createFile(t, base, "/move/a/b.txt", "b")
+	mkdirAll(t, base, "/move/target", 0755)
+	initialState = createFSState(t, base, "/")
+	require.NoError(cow.Rename("/move/a", "/move/target"))
+	mustNotLExist(t, cow, "/move/a")
+	fileMustContainText(t, cow, "/move/target/b.txt", "b")
+	require.Error(cow.Rename("/move/target", "/test/dir"))
+
+	// the base filesystem is never modified
+	mustEqualFSState(t, initialState, base, "/")
+	fileMustContainText(t, base, "/test/file.txt", "original")
+}
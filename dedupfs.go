@@ -0,0 +1,666 @@
+package backupfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// assert interfaces implemented
+var (
+	_ FS   = (*DedupFS)(nil)
+	_ File = (*dedupFile)(nil)
+)
+
+var (
+	// dedupTreeDir mirrors the directory tree. Regular files are stubs that contain the content hash.
+	dedupTreeDir = filepath.Join(separator, "tree")
+	// dedupObjectsDir contains the file contents named after their sha256 sum.
+	dedupObjectsDir = filepath.Join(separator, "objects")
+	// dedupStagingDir contains the contents of files that are opened for writing.
+	dedupStagingDir = filepath.Join(separator, "staging")
+)
+
+// DedupFS is a content addressed filesystem that stores the content of every regular file only once,
+// no matter how many files share the same content. This keeps the size of backups small in case that
+// e.g. the same files are backed up over and over again in multiple runs.
+//
+// Directories and symlinks are mirrored in a tree directory of the underlying filesystem.
+// Regular files are stored as stub files in that tree, which keep the mode, ownership and
+// modification time of the file and contain the sha256 sum of its content, which makes the tree
+// the path to hash index of the store. The content itself is stored in an objects directory.
+// Contents are immutable, files that are opened for writing are copied into a staging directory
+// and moved into the objects directory when they are closed.
+// Contents that are not referenced by any file anymore are removed.
+type DedupFS struct {
+	base FS
+	tree FS
+
+	mu sync.Mutex
+	// number of files that reference a content hash, nil until loaded
+	refs map[string]int
+}
+
+// NewDedupFS creates a new content addressed storage layout on top of base.
+func NewDedupFS(base FS) *DedupFS {
+	return &DedupFS{
+		base: base,
+		tree: NewPrefixFS(base, dedupTreeDir),
+	}
+}
+
+// Unwrap returns the underlying filesystem.
+func (d *DedupFS) Unwrap() FS {
+	return d.base
+}
+
+// Name returns the name of this FileSystem
+func (d *DedupFS) Name() string {
+	return "DedupFS"
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (d *DedupFS) Create(name string) (File, error) {
+	return d.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (d *DedupFS) Mkdir(name string, perm fs.FileMode) error {
+	return d.apply("mkdir", name, func() error {
+		return d.tree.Mkdir(name, perm)
+	})
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (d *DedupFS) MkdirAll(name string, perm fs.FileMode) error {
+	return d.apply("mkdir_all", name, func() error {
+		return d.tree.MkdirAll(name, perm)
+	})
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (d *DedupFS) Open(name string) (File, error) {
+	return d.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+// Files that are opened for writing are staged and stored when they are closed.
+func (d *DedupFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.load()
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	fi, err := d.tree.Stat(name)
+	switch {
+	case err == nil && fi.IsDir():
+		f, err := d.tree.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return &dedupFile{File: f, fsys: d, name: name}, nil
+	case err != nil && (!isNotFoundError(err) || flag&os.O_CREATE == 0):
+		return nil, err
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return d.openContent(name)
+	}
+	return d.openStaged(name, flag, perm)
+}
+
+// openContent opens the content of a regular file for reading.
+func (d *DedupFS) openContent(name string) (File, error) {
+	hash, err := d.readStub(name)
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		// empty files do not have an object, the stub is empty as well.
+		f, err := d.tree.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &dedupFile{File: f, fsys: d, name: name}, nil
+	}
+
+	f, err := d.base.Open(d.objectPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	return &dedupFile{File: f, fsys: d, name: name}, nil
+}
+
+// openStaged copies the content of a regular file into a new staging file that is opened for writing.
+func (d *DedupFS) openStaged(name string, flag int, perm fs.FileMode) (_ File, err error) {
+	// creates the stub, which also checks O_EXCL and the existence of the parent directory
+	stub, err := d.tree.OpenFile(name, os.O_RDONLY|flag&(os.O_CREATE|os.O_EXCL), perm)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := readHash(stub)
+	err = errors.Join(err, stub.Close())
+	if err != nil {
+		return nil, err
+	}
+
+	staged, err := CreateTemp(d.base, dedupStagingDir, "")
+	if err != nil {
+		return nil, err
+	}
+	stagedPath := staged.Name()
+	defer func() {
+		if err != nil {
+			_ = d.base.Remove(stagedPath)
+		}
+	}()
+
+	if hash != "" && flag&os.O_TRUNC == 0 {
+		err = copyObject(d.base, d.objectPath(hash), staged)
+	}
+	err = errors.Join(err, staged.Close())
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := d.base.OpenFile(stagedPath, flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND), 0)
+	if err != nil {
+		return nil, err
+	}
+	return &dedupFile{File: f, fsys: d, name: name, staged: stagedPath}, nil
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (d *DedupFS) Remove(name string) error {
+	return d.apply("remove", name, func() error {
+		hash, err := d.lstatHash(name)
+		if err != nil {
+			return err
+		}
+		err = d.tree.Remove(name)
+		if err != nil {
+			return err
+		}
+		d.release(hash)
+		return nil
+	})
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (d *DedupFS) RemoveAll(name string) error {
+	return d.apply("remove_all", name, func() error {
+		hashes := make([]string, 0)
+		err := Walk(d.tree, name, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			hash, err := d.readStub(path)
+			if err != nil {
+				return err
+			}
+			hashes = append(hashes, hash)
+			return nil
+		})
+		if err != nil && !isNotFoundError(err) {
+			return err
+		}
+
+		err = d.tree.RemoveAll(name)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			d.release(hash)
+		}
+		return nil
+	})
+}
+
+// Rename renames a file.
+func (d *DedupFS) Rename(oldname, newname string) error {
+	return d.apply("rename", oldname, func() error {
+		// an existing file at newname is replaced
+		hash, err := d.lstatHash(newname)
+		if err != nil && !isNotFoundError(err) {
+			return err
+		}
+		err = d.tree.Rename(oldname, newname)
+		if err != nil {
+			return err
+		}
+		d.release(hash)
+		return nil
+	})
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (d *DedupFS) Stat(name string) (fs.FileInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.load()
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	fi, err := d.tree.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.fileInfo(name, fi)
+}
+
+// Lstat will call Lstat if the filesystem itself is, or it delegates to, the os filesystem.
+// Else it will call Stat.
+func (d *DedupFS) Lstat(name string) (fs.FileInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.load()
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+
+	fi, err := d.tree.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.fileInfo(name, fi)
+}
+
+// Chmod changes the mode of the named file to mode.
+func (d *DedupFS) Chmod(name string, mode fs.FileMode) error {
+	return d.apply("chmod", name, func() error {
+		return d.tree.Chmod(name, mode)
+	})
+}
+
+// Chown changes the uid and gid of the named file.
+func (d *DedupFS) Chown(name string, uid, gid int) error {
+	return d.apply("chown", name, func() error {
+		return d.tree.Chown(name, uid, gid)
+	})
+}
+
+// Chtimes changes the access and modification times of the named file
+func (d *DedupFS) Chtimes(name string, atime, mtime time.Time) error {
+	return d.apply("chtimes", name, func() error {
+		return d.tree.Chtimes(name, atime, mtime)
+	})
+}
+
+// Truncate changes the size of the named file.
+func (d *DedupFS) Truncate(name string, size int64) (err error) {
+	f, err := d.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+	return f.Truncate(size)
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+func (d *DedupFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return readDir(d, name)
+}
+
+// Lchown does not fallback to chown. It does return an error in case that lchown cannot be called.
+func (d *DedupFS) Lchown(name string, uid, gid int) error {
+	return d.apply("lchown", name, func() error {
+		return d.tree.Lchown(name, uid, gid)
+	})
+}
+
+// Symlink creates a symlink at newname that points to oldname.
+func (d *DedupFS) Symlink(oldname, newname string) error {
+	return d.apply("symlink", newname, func() error {
+		return d.tree.Symlink(oldname, newname)
+	})
+}
+
+// Readlink returns the target of the symlink.
+func (d *DedupFS) Readlink(name string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.load()
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return d.tree.Readlink(name)
+}
+
+// apply executes the operation on the tree after the reference counts have been loaded.
+func (d *DedupFS) apply(op, name string, f func() error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.load()
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return f()
+}
+
+// objectPath returns the path of the content in the underlying filesystem.
+func (d *DedupFS) objectPath(hash string) string {
+	return filepath.Join(dedupObjectsDir, hash[:2], hash)
+}
+
+// fileInfo replaces the size of stubs with the size of their content.
+func (d *DedupFS) fileInfo(name string, fi fs.FileInfo) (fs.FileInfo, error) {
+	if !fi.Mode().IsRegular() {
+		return fi, nil
+	}
+	hash, err := d.readStub(name)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(0)
+	if hash != "" {
+		ofi, err := d.base.Lstat(d.objectPath(hash))
+		if err != nil {
+			return nil, err
+		}
+		size = ofi.Size()
+	}
+	return &dedupFileInfo{FileInfo: fi, size: size}, nil
+}
+
+// lstatHash returns the content hash of the regular file at name,
+// an empty hash in case that name is not a regular file.
+func (d *DedupFS) lstatHash(name string) (string, error) {
+	fi, err := d.tree.Lstat(name)
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", nil
+	}
+	return d.readStub(name)
+}
+
+// readStub returns the content hash of a regular file, which is empty for empty files.
+func (d *DedupFS) readStub(name string) (string, error) {
+	f, err := d.tree.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readHash(f)
+}
+
+func readHash(f File) (string, error) {
+	b, err := io.ReadAll(io.LimitReader(f, 2*sha256.Size+1))
+	if err != nil {
+		return "", err
+	}
+	hash := strings.TrimSpace(string(b))
+	if hash != "" && len(hash) != 2*sha256.Size {
+		return "", fmt.Errorf("invalid content hash: %s: %q", f.Name(), hash)
+	}
+	return hash, nil
+}
+
+// store moves a closed staging file into the objects directory and updates the stub of name.
+func (d *DedupFS) store(name, stagedPath string) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	defer func() {
+		// either moved or not needed anymore
+		_ = d.base.Remove(stagedPath)
+		_ = d.base.Remove(dedupStagingDir)
+	}()
+
+	hash, err := d.hashObject(stagedPath)
+	if err != nil {
+		return err
+	}
+
+	if hash != "" && d.refs[hash] == 0 {
+		objectPath := d.objectPath(hash)
+		err = d.base.MkdirAll(filepath.Dir(objectPath), 0700)
+		if err != nil {
+			return err
+		}
+		err = d.base.Rename(stagedPath, objectPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	fi, err := d.tree.Stat(name)
+	if err != nil {
+		if isNotFoundError(err) {
+			// removed while it was opened
+			d.acquire(hash)
+			d.release(hash)
+			return nil
+		}
+		return err
+	}
+	if fi.Mode().Perm()&0200 == 0 {
+		// read only files can be written by the owner of the file handle,
+		// which must also hold for the stub.
+		err = d.tree.Chmod(name, fi.Mode()|0200)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, d.tree.Chmod(name, fi.Mode()))
+		}()
+	}
+
+	stub, err := d.tree.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, stub.Close())
+	}()
+
+	oldHash, err := readHash(stub)
+	if err != nil {
+		return err
+	}
+	err = stub.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = stub.WriteAt([]byte(hash), 0)
+	if err != nil {
+		return err
+	}
+
+	d.acquire(hash)
+	d.release(oldHash)
+	return nil
+}
+
+// hashObject returns the sha256 sum of a file of the underlying filesystem, empty for empty files.
+func (d *DedupFS) hashObject(path string) (string, error) {
+	f, err := d.base.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", nil
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (d *DedupFS) acquire(hash string) {
+	if hash == "" {
+		return
+	}
+	d.refs[hash]++
+}
+
+// release removes the content in case that it is not referenced anymore.
+func (d *DedupFS) release(hash string) {
+	if hash == "" {
+		return
+	}
+	d.refs[hash]--
+	if d.refs[hash] > 0 {
+		return
+	}
+	delete(d.refs, hash)
+
+	// best effort, unreferenced objects do not change the content of the filesystem
+	objectPath := d.objectPath(hash)
+	_ = d.base.Remove(objectPath)
+	_ = d.base.Remove(filepath.Dir(objectPath))
+	_ = d.base.Remove(dedupObjectsDir)
+}
+
+// load counts the references of all contents of the tree.
+func (d *DedupFS) load() (err error) {
+	if d.refs != nil {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to load content index: %w", err)
+		}
+	}()
+
+	err = d.base.MkdirAll(dedupTreeDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	refs := make(map[string]int)
+	err = Walk(d.tree, separator, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		hash, err := d.readStub(path)
+		if err != nil {
+			return err
+		}
+		if hash != "" {
+			refs[hash]++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.refs = refs
+	return nil
+}
+
+// copyObject copies the content of an object into dst.
+func copyObject(fsys FS, objectPath string, dst io.Writer) error {
+	f, err := fsys.Open(objectPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// dedupFileInfo reports the size of the content instead of the size of the stub.
+type dedupFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi *dedupFileInfo) Size() int64 {
+	return fi.size
+}
+
+// dedupFile is either a directory of the tree, the immutable content of a regular file
+// or a staging file that replaces the content of the regular file when it is closed.
+type dedupFile struct {
+	File
+	fsys *DedupFS
+	// name that was used to open the file
+	name string
+	// path of the staging file, empty for read only files
+	staged string
+}
+
+func (f *dedupFile) Name() string {
+	return f.name
+}
+
+func (f *dedupFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.fsys.tree.Stat(f.name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return fi, nil
+	}
+
+	// size of the content that is read or written
+	cfi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &dedupFileInfo{FileInfo: fi, size: cfi.Size()}, nil
+}
+
+func (f *dedupFile) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, readErr := f.File.Readdir(count)
+
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	var err error
+	for i, fi := range infos {
+		infos[i], err = f.fsys.fileInfo(filepath.Join(f.name, fi.Name()), fi)
+		if err != nil {
+			return infos[:i], err
+		}
+	}
+	return infos, readErr
+}
+
+func (f *dedupFile) Close() error {
+	err := f.File.Close()
+	if err != nil || f.staged == "" {
+		return err
+	}
+	staged := f.staged
+	f.staged = ""
+	return f.fsys.store(f.name, staged)
+}
@@ -0,0 +1,113 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupFS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		root    = NewTempDirPrefixFS(CallerPathTmp())
+		fsys    = NewDedupFS(root)
+	)
+
+	mkdirAll(t, fsys, "/test/dir/subdir", 0755)
+	createFile(t, fsys, "/test/dir/file.txt", "content")
+	createFile(t, fsys, "/test/dir/subdir/copy.txt", "content")
+	createFile(t, fsys, "/test/other.txt", "other")
+	createFile(t, fsys, "/test/empty.txt", "")
+	createSymlink(t, fsys, "/test/dir", "/test/link")
+
+	fileMustContainText(t, fsys, "/test/dir/file.txt", "content")
+	fileMustContainText(t, fsys, "/test/link/subdir/copy.txt", "content")
+	fileMustContainText(t, fsys, "/test/empty.txt", "")
+	symlinkMustExistWithTragetPath(t, fsys, "/test/link", "/test/dir")
+
+	// identical contents are stored once
+	countFiles(t, root, dedupObjectsDir, 5)
+
+	fi, err := fsys.Stat(filepath.FromSlash("/test/link/file.txt"))
+	require.NoError(err)
+	require.Equal(int64(len("content")), fi.Size())
+	require.Equal("file.txt", fi.Name())
+
+	entries, err := fsys.ReadDir(filepath.FromSlash("/test/dir"))
+	require.NoError(err)
+	require.Len(entries, 2)
+	fi, err = entries[0].Info()
+	require.NoError(err)
+	require.Equal(int64(len("content")), fi.Size())
+
+	// modifications do not affect files with the same content
+	f, err := fsys.OpenFile(filepath.FromSlash("/test/dir/file.txt"), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(err)
+	_, err = f.WriteString(" appended")
+	require.NoError(err)
+	fi, err = f.Stat()
+	require.NoError(err)
+	require.Equal(int64(len("content appended")), fi.Size())
+	require.NoError(f.Close())
+	fileMustContainText(t, fsys, "/test/dir/file.txt", "content appended")
+	fileMustContainText(t, fsys, "/test/dir/subdir/copy.txt", "content")
+
+	require.NoError(fsys.Truncate(filepath.FromSlash("/test/dir/file.txt"), int64(len("content"))))
+	fileMustContainText(t, fsys, "/test/dir/file.txt", "content")
+	countFiles(t, root, dedupObjectsDir, 5)
+
+	// reference counts are restored from the tree
+	reloaded := NewDedupFS(root)
+	require.NoError(reloaded.Rename(filepath.FromSlash("/test/other.txt"), filepath.FromSlash("/test/dir/file.txt")))
+	fileMustContainText(t, reloaded, "/test/dir/file.txt", "other")
+	fileMustContainText(t, reloaded, "/test/dir/subdir/copy.txt", "content")
+
+	_, err = reloaded.OpenFile(filepath.FromSlash("/test/dir/file.txt"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	require.ErrorIs(err, fs.ErrExist)
+	_, err = reloaded.Create(filepath.FromSlash("/test/missing/file.txt"))
+	require.ErrorIs(err, fs.ErrNotExist)
+
+	require.NoError(reloaded.RemoveAll(filepath.FromSlash("/test")))
+	mustNotExist(t, reloaded, "/test")
+	// only the root and the tree directories are left
+	countFiles(t, root, separator, 2)
+}
+
+func TestBackupFS_WithBackupLayoutDedup(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithBackupLayout(LayoutDedup))
+	)
+
+	createFile(t, base, "/test/a.txt", "same")
+	createFile(t, base, "/test/b.txt", "same")
+	createFile(t, base, "/test/removed/c.txt", "same")
+	createFile(t, base, "/test/readonly.txt", "readonly")
+	require.NoError(base.Chmod(filepath.FromSlash("/test/readonly.txt"), 0400))
+	createSymlink(t, base, "/test/removed", "/test/link")
+
+	baseState := createFSState(t, base, "/")
+
+	createFile(t, backupFS, "/test/a.txt", "modified")
+	createFile(t, backupFS, "/test/b.txt", "modified")
+	removeAll(t, backupFS, "/test/removed")
+	require.NoError(backupFS.Remove(filepath.FromSlash("/test/readonly.txt")))
+	require.NoError(backupFS.Remove(filepath.FromSlash("/test/link")))
+	createFile(t, backupFS, "/test/new.txt", "new")
+
+	fileMustContainText(t, backupFS.BackupFS(), "/test/removed/c.txt", "same")
+	// three backups share a single content
+	countFiles(t, backup, dedupObjectsDir, 5)
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseState, base, "/")
+	mustNotExist(t, backup, dedupObjectsDir)
+}
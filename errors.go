@@ -0,0 +1,285 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Op is the name of the operation that failed.
+// The values are equal to the Op field of the *fs.PathError and *os.LinkError values
+// that are returned by the filesystem layers of this package.
+type Op string
+
+const (
+	OpCreate    Op = "create"
+	OpMkdir     Op = "mkdir"
+	OpMkdirAll  Op = "mkdir_all"
+	OpOpen      Op = "open"
+	OpOpenFile  Op = "open_file"
+	OpRemove    Op = "remove"
+	OpRemoveAll Op = "remove_all"
+	OpRename    Op = "rename"
+	OpStat      Op = "stat"
+	OpLstat     Op = "lstat"
+	OpChmod     Op = "chmod"
+	OpChown     Op = "chown"
+	OpLchown    Op = "lchown"
+	OpChtimes   Op = "chtimes"
+	OpTruncate  Op = "truncate"
+	OpSymlink   Op = "symlink"
+	OpReadlink  Op = "readlink"
+	OpReadDir   Op = "readdir"
+	OpWalk      Op = "walk"
+
+	OpForceBackup        Op = "force_backup"
+	OpTryBackup          Op = "try_backup"
+	OpTryRemoveBackup    Op = "try_remove_backup"
+	OpBackupDirs         Op = "backup_dirs"
+	OpRemoveAllCompacted Op = "remove_all_compacted"
+	OpSimulateRollback   Op = "simulate_rollback"
+	OpExport             Op = "export"
+	OpCommit             Op = "commit"
+	OpVerifyChecksums    Op = "verify_checksums"
+	OpSnapshot           Op = "snapshot"
+	OpRollbackTo         Op = "rollback_to"
+	OpRecover            Op = "recover"
+	OpSaveState          Op = "save_state"
+	OpLoadState          Op = "load_state"
+	OpPurge              Op = "purge"
+	OpVerifySeals        Op = "verify_seals"
+	OpRestoreRange       Op = "restore_range"
+	OpPendingChanges     Op = "pending_changes"
+	OpRollback           Op = "rollback"
+	OpVerify             Op = "verify"
+)
+
+// newBackupError returns the *fs.PathError that is returned by the BackupFS.
+// Its Op is one of the Op constants, see HasOp.
+func newBackupError(op Op, path string, err error) *fs.PathError {
+	return &fs.PathError{Op: string(op), Path: path, Err: err}
+}
+
+// HasOp returns true in case that any *fs.PathError or *os.LinkError
+// in the error chain of err has the given operation name.
+func HasOp(err error, op Op) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *fs.PathError:
+			if e.Op == string(op) {
+				return true
+			}
+		case *os.LinkError:
+			if e.Op == string(op) {
+				return true
+			}
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				if HasOp(err, op) {
+					return true
+				}
+			}
+			return false
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// RollbackErrorCode classifies the failures of a rollback.
+type RollbackErrorCode string
+
+const (
+	// CodeStatFailed marks paths whose existence could not be checked.
+	CodeStatFailed RollbackErrorCode = "StatFailed"
+	// CodeRemoveFailed marks created paths that could not be removed from the base filesystem.
+	CodeRemoveFailed RollbackErrorCode = "RemoveFailed"
+	// CodeRestoreDirFailed marks directories that could not be restored.
+	CodeRestoreDirFailed RollbackErrorCode = "RestoreDirFailed"
+	// CodeRestoreFileFailed marks files that could not be restored.
+	CodeRestoreFileFailed RollbackErrorCode = "RestoreFileFailed"
+	// CodeRestoreSymlinkFailed marks symlinks that could not be restored.
+	CodeRestoreSymlinkFailed RollbackErrorCode = "RestoreSymlinkFailed"
+	// CodeRestoreSubtreeFailed marks directory trees that could not be restored as a whole.
+	CodeRestoreSubtreeFailed RollbackErrorCode = "RestoreSubtreeFailed"
+	// CodeContentNotRestored marks files whose metadata was restored, but whose content was not backed up,
+	// see WithPlaceholders.
+	CodeContentNotRestored RollbackErrorCode = "ContentNotRestored"
+	// CodeBackupMissing marks files and symlinks whose backup does not exist anymore.
+	CodeBackupMissing RollbackErrorCode = "BackupMissing"
+	// CodeBackupCorrupted marks files whose backup does not match its checksum anymore, see WithRollbackVerification.
+	// Such files are not restored.
+	CodeBackupCorrupted RollbackErrorCode = "BackupCorrupted"
+	// CodeRemoveBackupFailed marks backups that could not be removed after their restoration.
+	CodeRemoveBackupFailed RollbackErrorCode = "RemoveBackupFailed"
+	// CodeSealBroken marks generations whose backup does not match its seal anymore, see WithSealing.
+	// Nothing is restored in that case.
+	CodeSealBroken RollbackErrorCode = "SealBroken"
+	// CodeCanceled marks rollbacks that were aborted due to a canceled context.
+	CodeCanceled RollbackErrorCode = "Canceled"
+	// CodeUnknown marks failures that could not be classified.
+	CodeUnknown RollbackErrorCode = "Unknown"
+)
+
+var (
+	// ErrMissingBackup is the underlying error of rollback failures with the code CodeBackupMissing.
+	// Such files cannot be restored, as the backup was removed or replaced by a different file type.
+	ErrMissingBackup = errors.New("missing backup")
+	// ErrSealBroken is returned in case that the backup of a sealed generation was modified
+	// after the generation had been sealed, see WithSealing.
+	ErrSealBroken = errors.New("seal broken")
+)
+
+// RollbackPathError is a single failure of a rollback.
+type RollbackPathError struct {
+	Code RollbackErrorCode
+	Path string
+	Err  error
+}
+
+func newRollbackPathError(code RollbackErrorCode, path string, err error) *RollbackPathError {
+	return &RollbackPathError{Code: code, Path: path, Err: err}
+}
+
+func (e *RollbackPathError) Error() string {
+	return string(e.Code) + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *RollbackPathError) Unwrap() error {
+	return e.Err
+}
+
+// Errno returns the underlying system error number.
+// Returns 0 in case that the failure was not caused by a system call.
+func (e *RollbackPathError) Errno() syscall.Errno {
+	var errno syscall.Errno
+	if errors.As(e.Err, &errno) {
+		return errno
+	}
+	return 0
+}
+
+type rollbackPathErrorJSON struct {
+	Code  RollbackErrorCode `json:"code"`
+	Path  string            `json:"path"`
+	Errno uintptr           `json:"errno,omitempty"`
+	Error string            `json:"error"`
+}
+
+// MarshalJSON encodes the code, the path, the underlying system error number and the error message.
+func (e *RollbackPathError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rollbackPathErrorJSON{
+		Code:  e.Code,
+		Path:  e.Path,
+		Errno: uintptr(e.Errno()),
+		Error: e.Err.Error(),
+	})
+}
+
+// UnmarshalJSON decodes an error that was encoded with MarshalJSON.
+// The underlying error is restored as the system error number, if there is one.
+func (e *RollbackPathError) UnmarshalJSON(data []byte) error {
+	var v rollbackPathErrorJSON
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	e.Code = v.Code
+	e.Path = v.Path
+	switch {
+	case v.Errno != 0:
+		e.Err = syscall.Errno(v.Errno)
+	case v.Code == CodeBackupMissing:
+		e.Err = ErrMissingBackup
+	case v.Code == CodeContentNotRestored:
+		e.Err = ErrContentNotBackedUp
+	case v.Code == CodeSealBroken:
+		e.Err = ErrSealBroken
+	default:
+		e.Err = errors.New(v.Error)
+	}
+	return nil
+}
+
+// RollbackError is returned by Rollback and contains all failures of the rollback.
+// It matches ErrRollbackFailed with errors.Is.
+type RollbackError struct {
+	Errors []*RollbackPathError
+}
+
+// newRollbackError flattens the joined errors of a rollback.
+// Errors that are not classified yet are marked with CodeUnknown.
+func newRollbackError(err error) *RollbackError {
+	var (
+		errs  = unwrapJoined(err)
+		rerrs = make([]*RollbackPathError, 0, len(errs))
+	)
+	for _, err := range errs {
+		var perr *RollbackPathError
+		if !errors.As(err, &perr) {
+			perr = newRollbackPathError(CodeUnknown, "", err)
+		}
+		rerrs = append(rerrs, perr)
+	}
+	return &RollbackError{Errors: rerrs}
+}
+
+func (e *RollbackError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(ErrRollbackFailed.Error())
+	for _, err := range e.Errors {
+		sb.WriteByte('\n')
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+func (e *RollbackError) Is(target error) bool {
+	return target == ErrRollbackFailed
+}
+
+func (e *RollbackError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// MarshalJSON encodes all failures of the rollback.
+func (e *RollbackError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Error  string               `json:"error"`
+		Errors []*RollbackPathError `json:"errors"`
+	}{
+		Error:  ErrRollbackFailed.Error(),
+		Errors: e.Errors,
+	})
+}
+
+// unwrapJoined flattens joined errors and drops the ErrRollbackFailed marker
+func unwrapJoined(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if rerr, ok := err.(*RollbackError); ok {
+		return rerr.Unwrap()
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	result := make([]error, 0)
+	for _, e := range joined.Unwrap() {
+		if e == ErrRollbackFailed {
+			continue
+		}
+		result = append(result, unwrapJoined(e)...)
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_PathError(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+	backupFS := NewBackupFS(base, backup)
+
+	createFile(t, base, "/test/file.txt", "content")
+	// make the backup fail due to a file that blocks the parent directory
+	createFile(t, backup, "/test", "blocking file")
+
+	_, err := backupFS.Create("/test/file.txt")
+	require.Error(err)
+
+	pathErr, ok := err.(*fs.PathError)
+	require.True(ok)
+	require.Equal(OpCreate, Op(pathErr.Op))
+	require.Equal("/test/file.txt", pathErr.Path)
+
+	require.True(HasOp(err, OpCreate))
+	require.True(HasOp(err, OpTryBackup))
+	require.False(HasOp(err, OpRemoveAll))
+
+	err = backupFS.Chtimes("/does/not/exist", time.Now(), time.Now())
+	require.ErrorIs(err, fs.ErrNotExist)
+	require.True(HasOp(err, OpChtimes))
+}
+
+func TestRollbackError(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		filePath                  = filepath.FromSlash("/test/file.txt")
+		newDirPath                = filepath.FromSlash("/test/new")
+	)
+
+	createFile(t, base, filePath, "original")
+	createFile(t, backupFS, filePath, "modified")
+	mkdir(t, backupFS, newDirPath, 0755)
+
+	// untracked content prevents the removal of the created directory
+	createFile(t, base, "/test/new/untracked.txt", "untracked")
+	// the backup was tampered with
+	require.NoError(backup.Remove(filePath))
+
+	err := backupFS.Rollback()
+	require.Error(err)
+	require.ErrorIs(err, ErrRollbackFailed)
+	require.ErrorIs(err, ErrMissingBackup)
+
+	var rerr *RollbackError
+	require.ErrorAs(err, &rerr)
+
+	codes := make(map[RollbackErrorCode]*RollbackPathError)
+	for _, perr := range rerr.Errors {
+		codes[perr.Code] = perr
+	}
+	require.Len(codes, 2, rerr.Error())
+	require.Equal(filePath, codes[CodeBackupMissing].Path)
+	require.Equal(newDirPath, codes[CodeRemoveFailed].Path)
+	require.Equal(syscall.ENOTEMPTY, codes[CodeRemoveFailed].Errno())
+
+	data, err := json.Marshal(rerr)
+	require.NoError(err)
+
+	var decoded struct {
+		Error  string               `json:"error"`
+		Errors []*RollbackPathError `json:"errors"`
+	}
+	require.NoError(json.Unmarshal(data, &decoded))
+	require.Equal(ErrRollbackFailed.Error(), decoded.Error)
+	require.Len(decoded.Errors, len(rerr.Errors))
+	for i, perr := range decoded.Errors {
+		require.Equal(rerr.Errors[i].Code, perr.Code)
+		require.Equal(rerr.Errors[i].Path, perr.Path)
+		require.Equal(rerr.Errors[i].Errno(), perr.Errno())
+	}
+
+	report := backupFS.LastRollback()
+	require.NotNil(report)
+	require.Len(report.Errors, len(rerr.Errors))
+}
@@ -0,0 +1,96 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// FileAttributes are the Windows file attributes that are backed up and restored.
+type FileAttributes uint32
+
+const (
+	FileAttributeReadonly          FileAttributes = 0x0001
+	FileAttributeHidden            FileAttributes = 0x0002
+	FileAttributeSystem            FileAttributes = 0x0004
+	FileAttributeArchive           FileAttributes = 0x0020
+	FileAttributeNotContentIndexed FileAttributes = 0x2000
+
+	// fileAttributesMask contains all attributes that are preserved,
+	// other attributes like the directory flag cannot be changed.
+	fileAttributesMask = FileAttributeReadonly |
+		FileAttributeHidden |
+		FileAttributeSystem |
+		FileAttributeArchive |
+		FileAttributeNotContentIndexed
+)
+
+// FileAttributer is implemented by filesystems that support Windows file attributes, like OSFS on Windows and MemFS.
+// Methods return an error that wraps errors.ErrUnsupported in case that the wrapped filesystem does not support them.
+type FileAttributer interface {
+	GetFileAttributes(name string) (FileAttributes, error)
+	SetFileAttributes(name string, attrs FileAttributes) error
+}
+
+// DACLer is implemented by filesystems that support Windows access control lists, like OSFS on Windows.
+// The discretionary access control list (DACL) is represented in the security descriptor string format (SDDL),
+// e.g. "D:PAI(A;;FA;;;SY)(A;;FA;;;BA)". An empty string means that the file has no DACL, setting it is a no-op.
+// Methods return an error that wraps errors.ErrUnsupported in case that the wrapped filesystem does not support them.
+type DACLer interface {
+	GetDACL(name string) (string, error)
+	SetDACL(name string, sddl string) error
+}
+
+// GetFileAttributes returns the Windows file attributes of the named file, see FileAttributer.
+func GetFileAttributes(fsys FS, name string) (FileAttributes, error) {
+	a, ok := fsys.(FileAttributer)
+	if !ok {
+		return 0, &fs.PathError{Op: "getfileattributes", Path: name, Err: errors.ErrUnsupported}
+	}
+	return a.GetFileAttributes(name)
+}
+
+// SetFileAttributes sets the Windows file attributes of the named file, see FileAttributer.
+func SetFileAttributes(fsys FS, name string, attrs FileAttributes) error {
+	a, ok := fsys.(FileAttributer)
+	if !ok {
+		return &fs.PathError{Op: "setfileattributes", Path: name, Err: errors.ErrUnsupported}
+	}
+	return a.SetFileAttributes(name, attrs)
+}
+
+// GetDACL returns the DACL of the named file, see DACLer.
+func GetDACL(fsys FS, name string) (string, error) {
+	d, ok := fsys.(DACLer)
+	if !ok {
+		return "", &fs.PathError{Op: "getdacl", Path: name, Err: errors.ErrUnsupported}
+	}
+	return d.GetDACL(name)
+}
+
+// SetDACL sets the DACL of the named file, see DACLer.
+func SetDACL(fsys FS, name string, sddl string) error {
+	d, ok := fsys.(DACLer)
+	if !ok {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: errors.ErrUnsupported}
+	}
+	return d.SetDACL(name, sddl)
+}
+
+// copyFileAttributes copies the DACL and the Windows file attributes of name from source to target.
+// Filesystems without support as well as missing privileges are skipped.
+func copyFileAttributes(source, target FS, name string) error {
+	sddl, err := GetDACL(source, name)
+	if err == nil {
+		err = SetDACL(target, name, sddl)
+	}
+	err = ignoreXattrError(err)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := GetFileAttributes(source, name)
+	if err == nil {
+		err = SetFileAttributes(target, name, attrs)
+	}
+	return ignoreXattrError(err)
+}
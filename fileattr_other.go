@@ -0,0 +1,24 @@
+//go:build !windows
+
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+)
+
+func osGetFileAttributes(name string) (FileAttributes, error) {
+	return 0, &fs.PathError{Op: "getfileattributes", Path: name, Err: errors.ErrUnsupported}
+}
+
+func osSetFileAttributes(name string, _ FileAttributes) error {
+	return &fs.PathError{Op: "setfileattributes", Path: name, Err: errors.ErrUnsupported}
+}
+
+func osGetDACL(name string) (string, error) {
+	return "", &fs.PathError{Op: "getdacl", Path: name, Err: errors.ErrUnsupported}
+}
+
+func osSetDACL(name string, _ string) error {
+	return &fs.PathError{Op: "setdacl", Path: name, Err: errors.ErrUnsupported}
+}
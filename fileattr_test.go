@@ -0,0 +1,58 @@
+package backupfs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_FileAttributes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("memfs", func(t *testing.T) {
+		t.Parallel()
+		testBackupFSFileAttributes(t, NewMemFS(), NewMemFS())
+	})
+
+	t.Run("osfs", func(t *testing.T) {
+		t.Parallel()
+
+		_, base, backup, _ := NewTestBackupFS("/base", "/backup")
+		_, err := GetFileAttributes(base, "/")
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skipf("file attributes are not supported: %v", err)
+		}
+		require.NoError(t, err)
+		testBackupFSFileAttributes(t, base, backup)
+	})
+}
+
+func testBackupFSFileAttributes(t *testing.T, base, backup FS) {
+	var (
+		require  = require.New(t)
+		dirPath  = filepath.FromSlash("/test/dir")
+		filePath = filepath.FromSlash("/test/dir/file.txt")
+		backupFS = NewBackupFS(base, backup)
+	)
+
+	createFile(t, base, filePath, "original")
+	require.NoError(SetFileAttributes(base, dirPath, FileAttributeHidden))
+	require.NoError(SetFileAttributes(base, filePath, FileAttributeHidden|FileAttributeArchive))
+
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Chmod(dirPath, 0700))
+	require.NoError(SetFileAttributes(base, dirPath, 0))
+	require.NoError(SetFileAttributes(base, filePath, FileAttributeArchive))
+
+	require.NoError(backupFS.Rollback())
+
+	fileMustContainText(t, base, filePath, "original")
+	attrs, err := GetFileAttributes(base, dirPath)
+	require.NoError(err)
+	require.Equal(FileAttributeHidden, attrs)
+	attrs, err = GetFileAttributes(base, filePath)
+	require.NoError(err)
+	require.Equal(FileAttributeHidden|FileAttributeArchive, attrs)
+}
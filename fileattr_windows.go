@@ -0,0 +1,186 @@
+package backupfs
+
+import (
+	"io/fs"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	seFileObject = 1
+
+	daclSecurityInformation            = 0x00000004
+	protectedDACLSecurityInformation   = 0x80000000
+	unprotectedDACLSecurityInformation = 0x20000000
+
+	sddlRevision1   = 1
+	seDACLProtected = 0x1000
+)
+
+var (
+	modadvapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procGetNamedSecurityInfoW                                = modadvapi32.NewProc("GetNamedSecurityInfoW")
+	procSetNamedSecurityInfoW                                = modadvapi32.NewProc("SetNamedSecurityInfoW")
+	procGetSecurityDescriptorDacl                            = modadvapi32.NewProc("GetSecurityDescriptorDacl")
+	procGetSecurityDescriptorControl                         = modadvapi32.NewProc("GetSecurityDescriptorControl")
+	procConvertSecurityDescriptorToStringSecurityDescriptorW = modadvapi32.NewProc("ConvertSecurityDescriptorToStringSecurityDescriptorW")
+	procConvertStringSecurityDescriptorToSecurityDescriptorW = modadvapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+)
+
+func osGetFileAttributes(name string) (FileAttributes, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, &fs.PathError{Op: "getfileattributes", Path: name, Err: err}
+	}
+	attrs, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return 0, &fs.PathError{Op: "getfileattributes", Path: name, Err: err}
+	}
+	return FileAttributes(attrs) & fileAttributesMask, nil
+}
+
+func osSetFileAttributes(name string, attrs FileAttributes) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return &fs.PathError{Op: "setfileattributes", Path: name, Err: err}
+	}
+
+	attrs &= fileAttributesMask
+	if attrs == 0 {
+		attrs = syscall.FILE_ATTRIBUTE_NORMAL
+	}
+	err = syscall.SetFileAttributes(p, uint32(attrs))
+	if err != nil {
+		return &fs.PathError{Op: "setfileattributes", Path: name, Err: err}
+	}
+	return nil
+}
+
+func osGetDACL(name string) (string, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "getdacl", Path: name, Err: err}
+	}
+
+	var sd uintptr
+	r, _, _ := procGetNamedSecurityInfoW.Call(
+		uintptr(unsafe.Pointer(p)),
+		seFileObject,
+		daclSecurityInformation,
+		0,
+		0,
+		0,
+		0,
+		uintptr(unsafe.Pointer(&sd)),
+	)
+	if r != 0 {
+		return "", &fs.PathError{Op: "getdacl", Path: name, Err: syscall.Errno(r)}
+	}
+	defer syscall.LocalFree(syscall.Handle(sd))
+
+	var sddl *uint16
+	r, _, err = procConvertSecurityDescriptorToStringSecurityDescriptorW.Call(
+		sd,
+		sddlRevision1,
+		daclSecurityInformation,
+		uintptr(unsafe.Pointer(&sddl)),
+		0,
+	)
+	if r == 0 {
+		return "", &fs.PathError{Op: "getdacl", Path: name, Err: err}
+	}
+	defer syscall.LocalFree(syscall.Handle(uintptr(unsafe.Pointer(sddl))))
+
+	return utf16PtrToString(sddl), nil
+}
+
+func osSetDACL(name string, sddl string) error {
+	if sddl == "" {
+		return nil
+	}
+
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: err}
+	}
+	s, err := syscall.UTF16PtrFromString(sddl)
+	if err != nil {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: err}
+	}
+
+	var sd uintptr
+	r, _, err := procConvertStringSecurityDescriptorToSecurityDescriptorW.Call(
+		uintptr(unsafe.Pointer(s)),
+		sddlRevision1,
+		uintptr(unsafe.Pointer(&sd)),
+		0,
+	)
+	if r == 0 {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: err}
+	}
+	defer syscall.LocalFree(syscall.Handle(sd))
+
+	var (
+		present   int32
+		defaulted int32
+		dacl      uintptr
+	)
+	r, _, err = procGetSecurityDescriptorDacl.Call(
+		sd,
+		uintptr(unsafe.Pointer(&present)),
+		uintptr(unsafe.Pointer(&dacl)),
+		uintptr(unsafe.Pointer(&defaulted)),
+	)
+	if r == 0 {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: err}
+	}
+	if present == 0 {
+		return nil
+	}
+
+	var (
+		control  uint16
+		revision uint32
+	)
+	r, _, err = procGetSecurityDescriptorControl.Call(
+		sd,
+		uintptr(unsafe.Pointer(&control)),
+		uintptr(unsafe.Pointer(&revision)),
+	)
+	if r == 0 {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: err}
+	}
+
+	// keep inherited entries from being merged into an explicitly protected DACL and vice versa
+	info := uintptr(daclSecurityInformation | unprotectedDACLSecurityInformation)
+	if control&seDACLProtected != 0 {
+		info = daclSecurityInformation | protectedDACLSecurityInformation
+	}
+
+	r, _, _ = procSetNamedSecurityInfoW.Call(
+		uintptr(unsafe.Pointer(p)),
+		seFileObject,
+		info,
+		0,
+		0,
+		dacl,
+		0,
+	)
+	if r != 0 {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: syscall.Errno(r)}
+	}
+	return nil
+}
+
+// utf16PtrToString converts a null terminated string that was allocated by the system.
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, unsafe.Sizeof(*p))
+	}
+	return syscall.UTF16ToString(unsafe.Slice(p, n))
+}
@@ -52,6 +52,13 @@ type FS interface {
 	// Chtimes changes the access and modification times of the named file
 	Chtimes(name string, atime time.Time, mtime time.Time) error
 
+	// Truncate changes the size of the named file.
+	// If the file is a symlink, it changes the size of the link's target.
+	Truncate(name string, size int64) error
+
+	// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+	ReadDir(name string) ([]fs.DirEntry, error)
+
 	Symlinker
 }
 
@@ -62,6 +69,57 @@ type Symlinker interface {
 	Lchown(name string, uid int, gid int) error
 }
 
+// LinkType is the type of a symlink that is created with SymlinkWithType.
+// The distinction between file and directory links is only relevant on Windows.
+type LinkType int
+
+const (
+	// LinkAuto detects the type of the link target upon creation like os.Symlink.
+	// Links to targets that do not exist yet are created as file links on Windows.
+	LinkAuto LinkType = iota
+	// LinkFile creates a symlink to a file.
+	LinkFile
+	// LinkDir creates a symlink to a directory.
+	LinkDir
+	// LinkJunction creates a directory junction on Windows, which does not require
+	// any symlink privileges. On other operating systems a symlink is created.
+	LinkJunction
+)
+
+// TypedSymlinker is implemented by filesystems that allow to explicitly choose the type of
+// created symlinks.
+type TypedSymlinker interface {
+	SymlinkWithType(oldname, newname string, typ LinkType) error
+}
+
+// Xattrer is implemented by filesystems that support extended attributes, e.g. user.* attributes,
+// SELinux labels (security.selinux) or file capabilities (security.capability). Symlinks are followed.
+// Methods return an error that wraps errors.ErrUnsupported in case that the wrapped filesystem does not support them.
+type Xattrer interface {
+	ListXattr(name string) ([]string, error)
+	GetXattr(name, attr string) ([]byte, error)
+	SetXattr(name, attr string, value []byte) error
+}
+
+// OSPather is implemented by filesystems that are backed by the filesystem of the operating system,
+// like OSFS or a PrefixFS that wraps it. It allows to call functions of the os package that
+// operate on multiple filesystems at once, e.g. os.Link.
+// Methods return an error that wraps errors.ErrUnsupported in case that the wrapped filesystem does not support them.
+type OSPather interface {
+	// OSPath returns the path of the named file in the filesystem of the operating system.
+	OSPath(name string) (string, error)
+}
+
+// FileMetadataSetter is implemented by files that allow to change their metadata via the open handle,
+// like fchmod, fchown and futimens. Contrary to the path based methods of FS, the handle based methods are not
+// affected by other processes that rename or replace the path while the file is open.
+// Methods return an error that wraps errors.ErrUnsupported in case that the wrapped file does not support them.
+type FileMetadataSetter interface {
+	Chmod(mode fs.FileMode) error
+	Chown(uid, gid int) error
+	Chtimes(atime time.Time, mtime time.Time) error
+}
+
 // File is implemented by the imported directory.
 type File interface {
 	fs.File
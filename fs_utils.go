@@ -32,10 +32,12 @@ func IterateDirTree(name string, visitor func(string) (proceed bool, err error))
 		lastIndex = 0
 		proceed   = true
 	)
-	for i, r := range name {
+	// separators are single bytes, iterating over bytes also
+	// detects the end of names that end with multi byte runes.
+	for i := 0; i < len(name); i++ {
 		create = false
 
-		if r == '/' || r == filepath.Separator {
+		if r := name[i]; r == '/' || r == filepath.Separator {
 			create = true
 			lastIndex = max(i, 1) // root element should be visible
 		}
@@ -67,8 +69,9 @@ func ignoreChownError(err error) error {
 
 	// check is permission for chown is denied
 	// if no permission for chown, we don't chown
+	// filesystems that do not support chown are treated the same way
 	switch {
-	case errors.Is(err, fs.ErrPermission):
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, errors.ErrUnsupported):
 		return nil
 	default:
 		return err
@@ -92,10 +95,10 @@ func ignoreChtimesError(err error) error {
 	}
 }
 
-func copyDir(fs FS, name string, info fs.FileInfo) (err error) {
+func copyDir(fs FS, name string, info fs.FileInfo, opts *backupFSOptions) (err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("%w: %s: %v", errCopyDirFailed, name, err)
+			err = fmt.Errorf("%w: %s: %w", errCopyDirFailed, name, err)
 		}
 	}()
 
@@ -145,6 +148,10 @@ func copyDir(fs FS, name string, info fs.FileInfo) (err error) {
 		}
 	}
 
+	if opts.disableChown {
+		return nil
+	}
+
 	// https://pkg.go.dev/os#Chown
 	// Windows & Plan9 not supported
 	err = ignoreChownError(chown(info, name, fs))
@@ -155,32 +162,58 @@ func copyDir(fs FS, name string, info fs.FileInfo) (err error) {
 	return nil
 }
 
-func copyFile(fs FS, name string, info fs.FileInfo, sourceFile File) (err error) {
+func copyFile(fs FS, name string, info fs.FileInfo, source io.Reader, opts *backupFSOptions) (err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("%w: %s: %v", errCopyFileFailed, name, err)
+			err = fmt.Errorf("%w: %s: %w", errCopyFileFailed, name, err)
 		}
 	}()
 
 	if !info.Mode().IsRegular() {
 		return fmt.Errorf("%w: %s", errFileInfoExpected, name)
 	}
-	//
-	targetMode := info.Mode()
+	err = writeFile(fs, name, info.Mode().Perm(), source, opts, func(f File) error {
+		return copyFileMetadata(fs, f, name, info, opts)
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// copyFileAtomic writes the file to a temporary sibling file and renames it into place,
+// so that a crash never leaves a partially written file at name.
+func copyFileAtomic(fsys FS, name string, info fs.FileInfo, source io.Reader, opts *backupFSOptions) (err error) {
+	tmpName := filepath.Join(filepath.Dir(name), RandomTempName("."+filepath.Base(name)+".restore-"))
+	defer func() {
+		if err != nil {
+			_ = fsys.Remove(tmpName)
+		}
+	}()
 
-	err = writeFile(fs, name, targetMode.Perm(), sourceFile)
+	err = copyFile(fsys, tmpName, info, source, opts)
 	if err != nil {
 		return err
 	}
+	return fsys.Rename(tmpName, name)
+}
 
-	newFileInfo, err := fs.Lstat(name)
+// copyFileMetadata applies the mode, modification time and ownership of info to the open file f.
+// The metadata is changed via the file handle in case that the file supports it, see FileMetadataSetter,
+// otherwise the path based methods of fsys are used.
+func copyFileMetadata(fsys FS, f File, name string, info fs.FileInfo, opts *backupFSOptions) error {
+	newFileInfo, err := f.Stat()
 	if err != nil {
 		return err
 	}
 
+	targetMode := info.Mode()
 	if !equalMode(newFileInfo.Mode(), targetMode) {
 		// not equal, update it
-		err = fs.Chmod(name, targetMode)
+		err = fchmod(f, targetMode)
+		if errors.Is(err, errors.ErrUnsupported) {
+			err = fsys.Chmod(name, targetMode)
+		}
 		if err != nil {
 			return err
 		}
@@ -190,24 +223,38 @@ func copyFile(fs FS, name string, info fs.FileInfo, sourceFile File) (err error)
 	currentModTime := newFileInfo.ModTime()
 
 	if !currentModTime.Equal(targetModTime) {
-		err = ignoreChtimesError(fs.Chtimes(name, targetModTime, targetModTime))
+		err = fchtimes(f, targetModTime, targetModTime)
+		if errors.Is(err, errors.ErrUnsupported) {
+			err = fsys.Chtimes(name, targetModTime, targetModTime)
+		}
+		err = ignoreChtimesError(err)
 		if err != nil {
 			return err
 		}
 	}
 
+	if opts.disableChown {
+		return nil
+	}
+
+	newUid, newGid := toUID(info), toGID(info)
+	if toUID(newFileInfo) == newUid && toGID(newFileInfo) == newGid {
+		return nil
+	}
+
 	// might cause a windows error that this function is not implemented by the OS
 	// in a unix fassion
 	// permission and not implemented errors are ignored
-	err = ignoreChownError(chown(info, name, fs))
-	if err != nil {
-		return err
+	err = fchown(f, newUid, newGid)
+	if errors.Is(err, errors.ErrUnsupported) {
+		err = fsys.Chown(name, newUid, newGid)
 	}
-
-	return nil
+	return ignoreChownError(err)
 }
 
-func writeFile(fs FS, name string, perm fs.FileMode, content io.Reader) (err error) {
+// writeFile writes content to the file at name. finish, if not nil, is called
+// with the open file after the content has been written.
+func writeFile(fs FS, name string, perm fs.FileMode, content io.Reader, opts *backupFSOptions, finish func(File) error) (err error) {
 	// same as create but with custom permissions
 	file, err := fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm.Perm())
 	if err != nil {
@@ -217,17 +264,20 @@ func writeFile(fs FS, name string, perm fs.FileMode, content io.Reader) (err err
 		err = errors.Join(err, file.Close())
 	}()
 
-	_, err = io.Copy(file, content)
+	err = copyContent(file, content, opts)
 	if err != nil {
 		return err
 	}
+	if finish != nil {
+		return finish(file)
+	}
 	return nil
 }
 
-func copySymlink(source, target FS, name string, info fs.FileInfo) (err error) {
+func copySymlink(source, target FS, name string, info fs.FileInfo, opts *backupFSOptions) (err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("%w: %s: %v", errCopySymlinkFailed, name, err)
+			err = fmt.Errorf("%w: %s: %w", errCopySymlinkFailed, name, err)
 		}
 	}()
 
@@ -240,11 +290,20 @@ func copySymlink(source, target FS, name string, info fs.FileInfo) (err error) {
 		return err
 	}
 
-	err = target.Symlink(pointsAt, name)
+	typ := linkTypeOf(info)
+	err = symlinkWithType(target, pointsAt, name, typ)
+	if err != nil && typ == LinkDir && opts.junctionFallback && isSymlinkPrivilegeError(err) {
+		// directory symlinks require privileges that junctions do not require
+		err = symlinkWithType(target, pointsAt, name, LinkJunction)
+	}
 	if err != nil {
 		return err
 	}
 
+	if opts.disableChown {
+		return nil
+	}
+
 	return ignoreChownError(target.Lchown(name, toUID(info), toGID(info)))
 }
 
@@ -273,7 +332,7 @@ func chown(from fs.FileInfo, toName string, fs FS) error {
 	return nil
 }
 
-func restoreFile(name string, backupFi fs.FileInfo, base, backup FS) (err error) {
+func restoreFile(name string, backupFi fs.FileInfo, base, backup FS, opts *backupFSOptions) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to restore file: %s: %w", name, err)
@@ -292,8 +351,10 @@ func restoreFile(name string, backupFi fs.FileInfo, base, backup FS) (err error)
 		return nil
 	}
 
-	if !fi.Mode().IsRegular() {
-		// remove dir/symlink/etc and create a file there
+	baseFi, found, err := lexists(base, name)
+	if err == nil && found && !baseFi.Mode().IsRegular() {
+		// remove dir/symlink/etc and create a file there,
+		// the file content must not be written into the target of a symlink
 		err = base.RemoveAll(name)
 		if err != nil {
 			// we failed to remove the directory
@@ -309,16 +370,20 @@ func restoreFile(name string, backupFi fs.FileInfo, base, backup FS) (err error)
 	}
 
 	// move file back to base system
-	err = copyFile(base, name, backupFi, f)
+	if opts.inPlaceRestore {
+		err = copyFile(base, name, fi, f, opts)
+	} else {
+		err = copyFileAtomic(base, name, fi, f, opts)
+	}
 	if err != nil {
 		// failed to restore file
 		// critical error, most likely due to network problems
 		return err
 	}
-	return nil
+	return copyExtendedAttrs(backup, base, name, fi)
 }
 
-func restoreSymlink(name string, backupFi fs.FileInfo, base, backup FS) (err error) {
+func restoreSymlink(name string, backupFi fs.FileInfo, base, backup FS, opts *backupFSOptions) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to restore symlink: %s: %w", name, err)
@@ -344,7 +409,17 @@ func restoreSymlink(name string, backupFi fs.FileInfo, base, backup FS) (err err
 	}
 
 	// try to restore symlink
-	return copySymlink(backup, base, name, backupFi)
+	return copySymlink(backup, base, name, backupFi, opts)
+}
+
+// removeNonDir removes the symlink or file at name in order for a directory to be created there.
+// Directories and non existing paths are left untouched.
+func removeNonDir(fsys FS, name string) error {
+	fi, found, err := lexists(fsys, name)
+	if err != nil || !found || fi.IsDir() {
+		return err
+	}
+	return fsys.Remove(name)
 }
 
 // Check if a symlin, file or directory exists.
@@ -396,6 +471,44 @@ func isAbs(name string) bool {
 	return path.IsAbs(filepath.ToSlash(name)) || filepath.IsAbs(filepath.FromSlash(name))
 }
 
+// PathResolver resolves the symlinks of the parent directories of name in fsys, see WithPathResolver.
+// The last element of the path must not be resolved. fi is the FileInfo of the last element as returned by Lstat,
+// nil in case that it does not exist, in which case the resolved path is still returned.
+type PathResolver func(fsys FS, name string) (resolvedName string, fi fs.FileInfo, err error)
+
+// ResolvePath is the default PathResolver which resolves the path segment by segment with the
+// Lstat and Readlink methods of fsys.
+func ResolvePath(fsys FS, name string) (resolvedName string, fi fs.FileInfo, err error) {
+	return resolvePathWithInfo(fsys, normalizePath(name))
+}
+
+// EvalSymlinks resolves the symlinks of the parent directories of name like ResolvePath and additionally
+// follows the last element in case that it is a symlink, like filepath.EvalSymlinks, which yields the
+// canonical path of the file that a modification of name would affect.
+// fi is the FileInfo of the resolved path as returned by Lstat, nil in case that it does not exist,
+// e.g. the target of a dangling symlink, in which case the resolved path is still returned.
+// Symlink cycles are reported with an error that wraps syscall.ELOOP.
+func EvalSymlinks(fsys FS, name string) (resolvedName string, fi fs.FileInfo, err error) {
+	resolvedName, fi, err = ResolvePath(fsys, name)
+	if err != nil || fi == nil || fi.Mode()&os.ModeSymlink == 0 {
+		return resolvedName, fi, err
+	}
+
+	target, found, err := resolveSymlinkTarget(fsys, resolvedName)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve path: %s: %w", name, err)
+	}
+	if !found {
+		return target, nil, nil
+	}
+
+	fi, err = fsys.Lstat(target)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve path: %s: %w", name, err)
+	}
+	return target, fi, nil
+}
+
 type resolverFS interface {
 	Lstat(name string) (fs.FileInfo, error)
 	Readlink(name string) (string, error)
@@ -419,6 +532,13 @@ func resolvePathWithFound(fsys resolverFS, filePath string) (resolvedFilePath st
 // Returns the file info of the last unresolved element.
 // In case that the file path was not found, the returned FileInfo is nil.
 func resolvePathWithInfo(fsys resolverFS, filePath string) (resolvedFilePath string, fi fs.FileInfo, err error) {
+	resolvedFilePath, fi, _, err = resolvePathWithSymlinks(fsys, filePath)
+	return resolvedFilePath, fi, err
+}
+
+// resolvePathWithSymlinks resolves the path like resolvePathWithInfo and additionally returns the
+// resolved paths of all symlinks that were traversed as parent directories, least nested first.
+func resolvePathWithSymlinks(fsys resolverFS, filePath string) (resolvedFilePath string, fi fs.FileInfo, symlinks []string, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to resolve path: %s: %w", filePath, err)
@@ -426,7 +546,7 @@ func resolvePathWithInfo(fsys resolverFS, filePath string) (resolvedFilePath str
 	}()
 
 	if filePath == "" {
-		return "", nil, errors.New("empty file path")
+		return "", nil, nil, errors.New("empty file path")
 	}
 
 	accPaths := make([]string, 0, strings.Count(filePath, separator))
@@ -437,6 +557,7 @@ func resolvePathWithInfo(fsys resolverFS, filePath string) (resolvedFilePath str
 	})
 
 	// do not use range here
+	hops := 0
 	for i := 0; i < len(accPaths); i++ {
 		p := accPaths[i]
 
@@ -447,9 +568,9 @@ func resolvePathWithInfo(fsys resolverFS, filePath string) (resolvedFilePath str
 
 				// return current resolved path state even if it was not found
 				// e.g. /a/symlink/test.txt with /a/symlink pointing to /a/folder, then the resolved nam ewill be /a/folder/test.txt
-				return accPaths[len(accPaths)-1], nil, nil
+				return accPaths[len(accPaths)-1], nil, symlinks, nil
 			}
-			return "", nil, err
+			return "", nil, nil, err
 		}
 
 		// check if symlink
@@ -457,24 +578,108 @@ func resolvePathWithInfo(fsys resolverFS, filePath string) (resolvedFilePath str
 			// resolve symlink
 			linkedPath, err := fsys.Readlink(p)
 			if err != nil {
-				return "", nil, err
+				return "", nil, nil, err
 			}
 			linkedPath = toAbsSymlink(linkedPath, p)
+			if i == len(accPaths)-1 {
+				// the last path element is not followed
+				continue
+			}
+			symlinks = append(symlinks, p)
+
+			hops++
+			if hops > maxSymlinkHops {
+				return "", nil, nil, syscall.ELOOP
+			}
+
+			// the symlink target may contain symlinks itself, e.g. /a -> /lib/dir with /lib -> /usr/lib,
+			// which is why the path is resolved again from the target on.
+			remaining := filepath.Join(linkedPath, strings.TrimPrefix(accPaths[len(accPaths)-1], p))
+			accPaths = accPaths[:0]
+			_, _ = IterateDirTree(remaining, func(subdirPath string) (bool, error) {
+				accPaths = append(accPaths, subdirPath)
+				return true, nil
+			})
+			i = -1
+		}
+	}
+
+	return accPaths[len(accPaths)-1], fi, symlinks, nil
+}
+
+// resolvePathWithoutSymlinks is the degraded variant of resolvePathWithSymlinks for filesystems
+// without symlink support. Only the path itself is looked up, no parent directory.
+func resolvePathWithoutSymlinks(fsys resolverFS, filePath string) (resolvedFilePath string, found bool, err error) {
+	if filePath == "" {
+		return "", false, fmt.Errorf("failed to resolve path: %s: %w", filePath, errors.New("empty file path"))
+	}
 
-			// update slice in place for all following paths after the symlink
-			replacePathPrefix(accPaths[i+1:], p, linkedPath)
+	_, err = fsys.Lstat(filePath)
+	if err != nil {
+		if isNotFoundError(err) {
+			return filePath, false, nil
 		}
+		return "", false, fmt.Errorf("failed to resolve path: %s: %w", filePath, err)
 	}
+	return filePath, true, nil
+}
 
-	return accPaths[len(accPaths)-1], fi, nil
+// symlinkWithType creates a symlink of the given type in case that the filesystem supports it.
+func symlinkWithType(fsys FS, oldname, newname string, typ LinkType) error {
+	if ts, ok := fsys.(TypedSymlinker); ok && typ != LinkAuto {
+		return ts.SymlinkWithType(oldname, newname, typ)
+	}
+	return fsys.Symlink(oldname, newname)
 }
 
-func replacePathPrefix(paths []string, oldPrefix, newPrefix string) {
-	for idx, path := range paths {
-		paths[idx] = filepath.Join(newPrefix, strings.TrimPrefix(path, oldPrefix))
+// maxSymlinkHops is the maximum number of symlinks that are followed when resolving symlink targets
+const maxSymlinkHops = 255
+
+// resolveSymlinkTarget follows the symlink at symlinkPath until a non-symlink target is reached.
+// Returns the last resolved target path and whether that target exists.
+func resolveSymlinkTarget(fsys resolverFS, symlinkPath string) (target string, found bool, err error) {
+	target = symlinkPath
+	for i := 0; i < maxSymlinkHops; i++ {
+		linkedPath, err := fsys.Readlink(target)
+		if err != nil {
+			return target, false, err
+		}
+
+		var fi fs.FileInfo
+		target, fi, err = resolvePathWithInfo(fsys, toAbsSymlink(linkedPath, target))
+		if err != nil {
+			return target, false, err
+		}
+		if fi == nil {
+			return target, false, nil
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return target, true, nil
+		}
 	}
+	return target, false, syscall.ELOOP
 }
 
 func isNotFoundError(err error) bool {
 	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR)
 }
+
+// requireDir returns an error in case that name is not an existing directory of fsys.
+// In case that create is true, a missing directory is created instead.
+func requireDir(fsys FS, name string, create bool) error {
+	fi, err := fsys.Stat(name)
+	if create && isNotFoundError(err) {
+		err = fsys.MkdirAll(name, 0755)
+		if err != nil {
+			return err
+		}
+		fi, err = fsys.Stat(name)
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return syscall.ENOTDIR
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateFidelity = flag.Bool("update-fidelity", false, "regenerate the golden copy fidelity files of the current platform")
+
+// fidelityBackend creates an empty filesystem of a specific backend.
+// New backends (e.g. SFTP or S3) are added to fidelityBackends in order to
+// document which metadata they are able to preserve.
+type fidelityBackend struct {
+	Name string
+	New  func(t *testing.T) FS
+}
+
+var fidelityBackends = []fidelityBackend{
+	{
+		Name: "memfs",
+		New: func(t *testing.T) FS {
+			return NewMemFS()
+		},
+	},
+	{
+		Name: "osfs",
+		New: func(t *testing.T) FS {
+			return NewTempDirPrefixFS(CallerPathTmp(1))
+		},
+	},
+}
+
+// fidelityGoldenFile contains the metadata that is guaranteed to be preserved
+// by the copy helpers for a specific backend on a specific platform.
+func fidelityGoldenFile(backend string) string {
+	return filepath.Join("testdata", "fidelity", backend+"_"+runtime.GOOS+".json")
+}
+
+// TestCopyFidelity documents which metadata is preserved by copyFile, copyDir and copySymlink.
+// Changed expectations require the golden files of the current platform to be regenerated with:
+//
+//	go test -run TestCopyFidelity -update-fidelity
+func TestCopyFidelity(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range fidelityBackends {
+		backend := backend
+		t.Run(backend.Name, func(t *testing.T) {
+			t.Parallel()
+
+			require := require.New(t)
+			actual := copyFidelity(t, backend.New(t), backend.New(t))
+
+			goldenFile := fidelityGoldenFile(backend.Name)
+			if *updateFidelity {
+				data, err := json.MarshalIndent(actual, "", "  ")
+				require.NoError(err)
+				require.NoError(os.MkdirAll(filepath.Dir(goldenFile), 0755))
+				require.NoError(os.WriteFile(goldenFile, append(data, '\n'), 0644))
+				return
+			}
+
+			data, err := os.ReadFile(goldenFile)
+			if os.IsNotExist(err) {
+				t.Skipf("no golden file %s, run: go test -run TestCopyFidelity -update-fidelity", goldenFile)
+			}
+			require.NoError(err)
+
+			var expected map[string]bool
+			require.NoError(json.Unmarshal(data, &expected))
+			require.Equal(expected, actual, "run: go test -run TestCopyFidelity -update-fidelity")
+		})
+	}
+}
+
+// copyFidelity copies a file, a directory and a symlink from source to target
+// and reports for every metadata property whether it was preserved.
+func copyFidelity(t *testing.T, source, target FS) map[string]bool {
+	var (
+		require     = require.New(t)
+		opts        = &backupFSOptions{}
+		mtime       = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		dirPath     = filepath.FromSlash("/dir")
+		filePath    = filepath.FromSlash("/dir/file.txt")
+		symlinkPath = filepath.FromSlash("/dir/symlink")
+		uid, gid    = os.Getuid(), os.Getgid()
+	)
+
+	require.NoError(source.Mkdir(dirPath, 0750))
+	require.NoError(writeFile(source, filePath, 0640, strings.NewReader("content"), &backupFSOptions{}, nil))
+	require.NoError(source.Symlink("file.txt", symlinkPath))
+	for _, name := range []string{filePath, dirPath} {
+		require.NoError(ignoreChownError(source.Chown(name, uid, gid)))
+		require.NoError(source.Chtimes(name, mtime, mtime))
+	}
+
+	result := make(map[string]bool)
+
+	// metadata is compared right after the copy, as creating the children of a directory
+	// modifies its modification time.
+	info, err := source.Lstat(dirPath)
+	require.NoError(err)
+	require.NoError(copyDir(target, dirPath, info, opts))
+	compareFidelity(t, result, "dir", source, target, dirPath)
+
+	info, err = source.Lstat(filePath)
+	require.NoError(err)
+	f, err := source.Open(filePath)
+	require.NoError(err)
+	defer f.Close()
+	require.NoError(copyFile(target, filePath, info, f, opts))
+	compareFidelity(t, result, "file", source, target, filePath)
+
+	info, err = source.Lstat(symlinkPath)
+	require.NoError(err)
+	require.NoError(copySymlink(source, target, symlinkPath, info, opts))
+	compareFidelity(t, result, "symlink", source, target, symlinkPath)
+
+	return result
+}
+
+func compareFidelity(t *testing.T, result map[string]bool, kind string, source, target FS, name string) {
+	require := require.New(t)
+
+	expected, err := source.Lstat(name)
+	require.NoError(err)
+	actual, err := target.Lstat(name)
+	require.NoError(err)
+
+	result[kind+".type"] = expected.Mode().Type() == actual.Mode().Type()
+	result[kind+".owner"] = toUID(expected) == toUID(actual) && toGID(expected) == toGID(actual)
+	if kind == "symlink" {
+		expectedTarget, err := source.Readlink(name)
+		require.NoError(err)
+		actualTarget, err := target.Readlink(name)
+		require.NoError(err)
+		result[kind+".target"] = expectedTarget == actualTarget
+		return
+	}
+	result[kind+".mode"] = equalMode(expected.Mode(), actual.Mode())
+	result[kind+".mtime"] = expected.ModTime().Equal(actual.ModTime())
+}
@@ -0,0 +1,67 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+var (
+	_ FileMetadataSetter = osFile{}
+)
+
+// osFile adds the missing Chtimes method to *os.File.
+type osFile struct {
+	*os.File
+}
+
+func (f osFile) Chtimes(atime, mtime time.Time) error {
+	return futimes(f.File, atime, mtime)
+}
+
+// fileMetadataSetter returns the handle based metadata methods of f, if any.
+func fileMetadataSetter(f File) (FileMetadataSetter, bool) {
+	switch v := f.(type) {
+	case *os.File:
+		return osFile{v}, osFileMetadata
+	case FileMetadataSetter:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+func unsupportedFileOp(op string, f File) error {
+	return &fs.PathError{Op: op, Path: f.Name(), Err: errors.ErrUnsupported}
+}
+
+// fchmod changes the mode of the open file f.
+// Returns an error that wraps errors.ErrUnsupported in case that f does not support it.
+func fchmod(f File, mode fs.FileMode) error {
+	s, ok := fileMetadataSetter(f)
+	if !ok {
+		return unsupportedFileOp("chmod", f)
+	}
+	return s.Chmod(mode)
+}
+
+// fchown changes the uid and gid of the open file f.
+// Returns an error that wraps errors.ErrUnsupported in case that f does not support it.
+func fchown(f File, uid, gid int) error {
+	s, ok := fileMetadataSetter(f)
+	if !ok {
+		return unsupportedFileOp("chown", f)
+	}
+	return s.Chown(uid, gid)
+}
+
+// fchtimes changes the access and modification times of the open file f.
+// Returns an error that wraps errors.ErrUnsupported in case that f does not support it.
+func fchtimes(f File, atime, mtime time.Time) error {
+	s, ok := fileMetadataSetter(f)
+	if !ok {
+		return unsupportedFileOp("chtimes", f)
+	}
+	return s.Chtimes(atime, mtime)
+}
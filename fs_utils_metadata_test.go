@@ -0,0 +1,108 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// pathMetadataFS rejects all path based metadata modifications.
+type pathMetadataFS struct {
+	FS
+}
+
+var errPathMetadata = errors.New("path based metadata modification")
+
+func (pathMetadataFS) Chmod(string, fs.FileMode) error            { return errPathMetadata }
+func (pathMetadataFS) Chown(string, int, int) error               { return errPathMetadata }
+func (pathMetadataFS) Chtimes(string, time.Time, time.Time) error { return errPathMetadata }
+
+func TestCopyFile_HandleMetadata(t *testing.T) {
+	t.Parallel()
+
+	for _, b := range []fidelityBackend{
+		fidelityBackends[0],
+		{
+			Name: "prefixed osfs",
+			New: func(t *testing.T) FS {
+				return NewTempDirPrefixFS(CallerPathTmp(1))
+			},
+		},
+	} {
+		b := b
+		t.Run(b.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				require = require.New(t)
+				target  = pathMetadataFS{NewTrackingFS(b.New(t), false)}
+				source  = NewMemFS()
+				mtime   = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			)
+
+			createFile(t, source, "/file.txt", "content")
+			require.NoError(source.Chmod("/file.txt", 0640))
+			require.NoError(source.Chtimes("/file.txt", mtime, mtime))
+			info, err := source.Lstat("/file.txt")
+			require.NoError(err)
+
+			// metadata is applied via the file handle, the path is never touched
+			require.NoError(copyFile(target, "/file.txt", info, strings.NewReader("content"), &backupFSOptions{}))
+
+			fi, err := target.Lstat("/file.txt")
+			require.NoError(err)
+			require.Equal(fs.FileMode(0640), fi.Mode().Perm())
+			require.True(mtime.Equal(fi.ModTime()), "expected %v, got %v", mtime, fi.ModTime())
+		})
+	}
+}
+
+// plainFileFS returns files that do not support handle based metadata modifications.
+type plainFileFS struct {
+	FS
+}
+
+type plainFile struct {
+	File
+}
+
+func (p plainFileFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := p.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return plainFile{f}, nil
+}
+
+func TestCopyFile_PathMetadataFallback(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		target  = plainFileFS{NewMemFS()}
+		source  = NewMemFS()
+		mtime   = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	createFile(t, source, "/file.txt", "content")
+	require.NoError(source.Chmod("/file.txt", 0640))
+	require.NoError(source.Chtimes("/file.txt", mtime, mtime))
+	info, err := source.Lstat("/file.txt")
+	require.NoError(err)
+
+	f, err := target.OpenFile("/other.txt", os.O_RDWR|os.O_CREATE, 0600)
+	require.NoError(err)
+	require.ErrorIs(fchmod(f, 0640), errors.ErrUnsupported)
+	require.NoError(f.Close())
+
+	require.NoError(copyFile(target, "/file.txt", info, strings.NewReader("content"), &backupFSOptions{}))
+	fi, err := target.Lstat("/file.txt")
+	require.NoError(err)
+	require.Equal(fs.FileMode(0640), fi.Mode().Perm())
+	require.True(mtime.Equal(fi.ModTime()))
+}
@@ -0,0 +1,56 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// reference: os package
+var chmodBits fs.FileMode = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// toUID is not supported on platforms without a unix like file info, e.g. wasm.
+func toUID(_ fs.FileInfo) int {
+	return -1
+}
+
+func toGID(_ fs.FileInfo) int {
+	return -1
+}
+
+func toDevIno(_ fs.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+func toLinkCount(_ fs.FileInfo) (n uint64, ok bool) {
+	return 0, false
+}
+
+// ignorableChownError ignores errors of platforms that do not implement chown at all, e.g. wasm.
+func ignorableChownError(err error) error {
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	return err
+}
+
+func ignorableChtimesError(err error) error {
+	return err
+}
+
+// osFileMetadata is false, as *os.File does not support all handle based metadata methods.
+const osFileMetadata = false
+
+// futimes is not supported, the modification time is changed via the path.
+func futimes(f *os.File, _, _ time.Time) error {
+	return &fs.PathError{Op: "chtimes", Path: f.Name(), Err: errors.ErrUnsupported}
+}
+
+// withoutDirLinks returns sys, as there is no link count on platforms without a unix like file info.
+func withoutDirLinks(sys any, _ int) any {
+	return sys
+}
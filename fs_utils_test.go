@@ -1,8 +1,10 @@
 package backupfs
 
 import (
+	"io/fs"
 	"path"
 	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -36,6 +38,55 @@ func TestResolvePathWithFileThatDoesntExist(t *testing.T) {
 	require.Equal(t, filepath.FromSlash(originalFilePath), resolvedPath)
 }
 
+func TestEvalSymlinks(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require       = require.New(t)
+		_, base, _, _ = NewTestBackupFS("/base", "/backup")
+		filePath      = "/usr/lib/systemd/system/test.service"
+	)
+
+	createFile(t, base, filePath, "test_content")
+	createSymlink(t, base, "../usr/lib", "/lib")                            // relative parent directory
+	createSymlink(t, base, "/lib/systemd/system/test.service", "/etc/test") // absolute last element
+	for newname, oldname := range map[string]string{
+		"/etc/alias":    "test", // symlink chain
+		"/etc/dangling": "/usr/missing.txt",
+		"/etc/loop1":    "/etc/loop2",
+		"/etc/loop2":    "/etc/loop1",
+	} {
+		require.NoError(base.Symlink(filepath.FromSlash(oldname), filepath.FromSlash(newname)))
+	}
+
+	// contrary to ResolvePath the last element is resolved
+	resolvedPath, fi, err := ResolvePath(base, "/etc/alias")
+	require.NoError(err)
+	require.Equal(filepath.FromSlash("/etc/alias"), resolvedPath)
+	require.NotZero(fi.Mode() & fs.ModeSymlink)
+
+	for _, name := range []string{"/etc/alias", "/etc/test", "/lib/systemd/system/test.service", filePath} {
+		resolvedPath, fi, err = EvalSymlinks(base, name)
+		require.NoError(err, name)
+		require.Equal(filepath.FromSlash(filePath), resolvedPath, name)
+		require.True(fi.Mode().IsRegular(), name)
+	}
+
+	// missing targets are resolved without a file info
+	resolvedPath, fi, err = EvalSymlinks(base, "/etc/dangling")
+	require.NoError(err)
+	require.Equal(filepath.FromSlash("/usr/missing.txt"), resolvedPath)
+	require.Nil(fi)
+
+	resolvedPath, fi, err = EvalSymlinks(base, "/lib/missing.txt")
+	require.NoError(err)
+	require.Equal(filepath.FromSlash("/usr/lib/missing.txt"), resolvedPath)
+	require.Nil(fi)
+
+	_, _, err = EvalSymlinks(base, "/etc/loop1")
+	require.ErrorIs(err, syscall.ELOOP)
+}
+
 func TestResolveCircularSymlinkPath(t *testing.T) {
 	t.Parallel()
 
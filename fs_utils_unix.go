@@ -4,8 +4,11 @@
 package backupfs
 
 import (
+	"errors"
 	"io/fs"
+	"os"
 	"syscall"
+	"time"
 )
 
 // reference: os package
@@ -27,10 +30,71 @@ func toGID(from fs.FileInfo) int {
 	return -1
 }
 
+// toDevIno returns the device and inode number of a file.
+func toDevIno(from fs.FileInfo) (dev, ino uint64, ok bool) {
+	if stat, ok := from.Sys().(*syscall.Stat_t); ok && stat.Ino != 0 {
+		return uint64(stat.Dev), uint64(stat.Ino), true
+	}
+	return 0, 0, false
+}
+
+// toLinkCount returns the number of hard links of a file.
+func toLinkCount(from fs.FileInfo) (n uint64, ok bool) {
+	if stat, ok := from.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink), true
+	}
+	return 0, false
+}
+
+// ignorableChownError ignores EINVAL, which is returned in user namespaces, e.g. rootless containers,
+// in case that the uid or gid is not mapped into the namespace.
 func ignorableChownError(err error) error {
+	if errors.Is(err, syscall.EINVAL) {
+		return nil
+	}
 	return err
 }
 
 func ignorableChtimesError(err error) error {
 	return err
 }
+
+// osFileMetadata is true, as *os.File supports fchmod, fchown and futimes.
+const osFileMetadata = true
+
+// futimes changes the access and modification times of the open file f.
+func futimes(f *os.File, atime, mtime time.Time) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	tv := []syscall.Timeval{
+		syscall.NsecToTimeval(atime.UnixNano()),
+		syscall.NsecToTimeval(mtime.UnixNano()),
+	}
+	var errno error
+	err = conn.Control(func(fd uintptr) {
+		errno = syscall.Futimes(int(fd), tv)
+	})
+	if err != nil {
+		return err
+	}
+	if errno != nil {
+		return &fs.PathError{Op: "chtimes", Path: f.Name(), Err: errno}
+	}
+	return nil
+}
+
+// withoutDirLinks returns a copy of sys whose link count does not include n subdirectories.
+func withoutDirLinks(sys any, n int) any {
+	stat, ok := sys.(*syscall.Stat_t)
+	if !ok || n == 0 {
+		return sys
+	}
+	c := *stat
+	// the type of Nlink differs between platforms
+	for i := 0; i < n && c.Nlink > 0; i++ {
+		c.Nlink--
+	}
+	return &c
+}
@@ -3,7 +3,9 @@ package backupfs
 import (
 	"errors"
 	"io/fs"
+	"os"
 	"syscall"
+	"time"
 )
 
 // reference: os package
@@ -17,6 +19,17 @@ func toGID(_ fs.FileInfo) int {
 	return -1
 }
 
+// toDevIno is not supported on windows, as the file info does not contain
+// any device or inode information.
+func toDevIno(_ fs.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+// toLinkCount is not supported on windows, as the file info does not contain the number of hard links.
+func toLinkCount(_ fs.FileInfo) (n uint64, ok bool) {
+	return 0, false
+}
+
 // ignorableError errors that are due to such functions not being implemented on windows
 func ignorableChownError(err error) error {
 	switch {
@@ -30,3 +43,16 @@ func ignorableChownError(err error) error {
 func ignorableChtimesError(err error) error {
 	return err
 }
+
+// osFileMetadata is false, as *os.File does not support all handle based metadata methods.
+const osFileMetadata = false
+
+// futimes is not supported, the modification time is changed via the path.
+func futimes(f *os.File, _, _ time.Time) error {
+	return &fs.PathError{Op: "chtimes", Path: f.Name(), Err: errors.ErrUnsupported}
+}
+
+// withoutDirLinks returns sys, as there is no link count on windows.
+func withoutDirLinks(sys any, _ int) any {
+	return sys
+}
@@ -0,0 +1,184 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// assert interfaces implemented
+	_ FS                 = (*TrackingFS)(nil)
+	_ File               = (*trackedFile)(nil)
+	_ FileMetadataSetter = (*trackedFile)(nil)
+)
+
+// HandleInfo describes a file handle that has been opened and not yet been closed.
+type HandleInfo struct {
+	// ID is a unique, monotonically increasing handle id.
+	ID uint64
+	// Name is the file path that was passed to Create, Open or OpenFile.
+	Name string
+	// Flag is the flag that was used to open the file.
+	Flag int
+	// OpenedAt is the point in time when the file was opened.
+	OpenedAt time.Time
+	// Stack is the stack trace of the call that opened the file.
+	// It is only recorded in debug mode.
+	Stack string
+}
+
+// HandleTracker is implemented by filesystems that keep track of open file handles.
+type HandleTracker interface {
+	OpenHandles() []HandleInfo
+}
+
+func newHandleRegistry(debug bool, clock Clock) *handleRegistry {
+	return &handleRegistry{
+		debug:   debug,
+		clock:   clock,
+		handles: make(map[uint64]HandleInfo),
+	}
+}
+
+type handleRegistry struct {
+	mu      sync.Mutex
+	debug   bool
+	clock   Clock
+	nextID  uint64
+	handles map[uint64]HandleInfo
+}
+
+func (r *handleRegistry) track(f File, name string, flag int) File {
+	info := HandleInfo{
+		Name:     name,
+		Flag:     flag,
+		OpenedAt: r.clock.Now(),
+	}
+	if r.debug {
+		info.Stack = string(debug.Stack())
+	}
+
+	r.mu.Lock()
+	r.nextID++
+	info.ID = r.nextID
+	r.handles[info.ID] = info
+	r.mu.Unlock()
+
+	return &trackedFile{
+		File:     f,
+		id:       info.ID,
+		registry: r,
+	}
+}
+
+func (r *handleRegistry) untrack(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.handles, id)
+}
+
+// openHandles returns the currently open handles sorted by their id.
+func (r *handleRegistry) openHandles() []HandleInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	handles := make([]HandleInfo, 0, len(r.handles))
+	for _, h := range r.handles {
+		handles = append(handles, h)
+	}
+	sort.Slice(handles, func(i, j int) bool {
+		return handles[i].ID < handles[j].ID
+	})
+	return handles
+}
+
+type trackedFile struct {
+	File
+	id       uint64
+	registry *handleRegistry
+	once     sync.Once
+}
+
+func (tf *trackedFile) Chmod(mode fs.FileMode) error {
+	return fchmod(tf.File, mode)
+}
+
+func (tf *trackedFile) Chown(uid, gid int) error {
+	return fchown(tf.File, uid, gid)
+}
+
+func (tf *trackedFile) Chtimes(atime, mtime time.Time) error {
+	return fchtimes(tf.File, atime, mtime)
+}
+
+func (tf *trackedFile) Close() error {
+	err := tf.File.Close()
+	tf.once.Do(func() {
+		tf.registry.untrack(tf.id)
+	})
+	return err
+}
+
+// NewTrackingFS creates a filesystem wrapper that keeps track of all files that are opened via
+// Create, Open and OpenFile and that have not yet been closed.
+// In debug mode the stack trace of the opening call is recorded for every file handle.
+func NewTrackingFS(base FS, debug bool) *TrackingFS {
+	return &TrackingFS{
+		FS:       base,
+		registry: newHandleRegistry(debug, SystemClock()),
+	}
+}
+
+// TrackingFS keeps track of open file handles in order to detect file descriptor leaks
+// which are hard to attribute when multiple filesystem layers are wrapped around each other.
+type TrackingFS struct {
+	FS
+	registry *handleRegistry
+}
+
+// OpenHandles returns all file handles that have been opened and not yet been closed.
+func (fsys *TrackingFS) OpenHandles() []HandleInfo {
+	return fsys.registry.openHandles()
+}
+
+// The name of this FileSystem
+func (fsys *TrackingFS) Name() string {
+	return "TrackingFS"
+}
+
+// Unwrap returns the wrapped filesystem.
+func (fsys *TrackingFS) Unwrap() FS {
+	return fsys.FS
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (fsys *TrackingFS) Create(name string) (File, error) {
+	f, err := fsys.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.registry.track(f, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC), nil
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (fsys *TrackingFS) Open(name string) (File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.registry.track(f, name, os.O_RDONLY), nil
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+func (fsys *TrackingFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := fsys.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.registry.track(f, name, flag), nil
+}
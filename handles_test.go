@@ -0,0 +1,67 @@
+package backupfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_OpenHandles(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, backup, _ := NewTestBackupFS("/base", "/backup")
+	backupFS := NewBackupFS(base, backup, WithHandleTracking(true))
+
+	createFile(t, base, "/test/01/test_01.txt", "test_content")
+	require.Empty(backupFS.OpenHandles())
+
+	f, err := backupFS.Create("/test/01/test_01.txt")
+	require.NoError(err)
+
+	r, err := backupFS.Open("/test/01/test_01.txt")
+	require.NoError(err)
+
+	handles := backupFS.OpenHandles()
+	require.Len(handles, 2)
+	require.Equal("/test/01/test_01.txt", handles[0].Name)
+	require.Equal(os.O_RDWR|os.O_CREATE|os.O_TRUNC, handles[0].Flag)
+	require.NotEmpty(handles[0].Stack)
+	require.Equal(os.O_RDONLY, handles[1].Flag)
+	require.Less(handles[0].ID, handles[1].ID)
+
+	require.NoError(f.Close())
+	require.Len(backupFS.OpenHandles(), 1)
+
+	require.NoError(r.Close())
+	// closing twice must not panic nor affect other handles
+	_ = r.Close()
+	require.Empty(backupFS.OpenHandles())
+
+	require.NoError(backupFS.Rollback())
+}
+
+func TestTrackingFS(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, _ := NewTestBackupFS("/base", "/backup")
+	fsys := NewTrackingFS(base, false)
+
+	createFile(t, fsys, "/test.txt", "test_content")
+	require.Empty(fsys.OpenHandles())
+
+	f, err := fsys.OpenFile("/test.txt", os.O_RDONLY, 0)
+	require.NoError(err)
+
+	handles := fsys.OpenHandles()
+	require.Len(handles, 1)
+	require.Empty(handles[0].Stack, "stack traces are only recorded in debug mode")
+
+	require.NoError(f.Close())
+	require.Empty(fsys.OpenHandles())
+
+	// no tracking by default
+	require.Nil(NewBackupFS(base, base).OpenHandles())
+}
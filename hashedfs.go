@@ -0,0 +1,749 @@
+package backupfs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// assert interfaces implemented
+var (
+	_ FS   = (*HashedLayoutFS)(nil)
+	_ File = (*hashedFile)(nil)
+)
+
+// BackupLayout is the storage layout of the backup filesystem.
+type BackupLayout int
+
+const (
+	// LayoutMirror stores backups with their original absolute path below the backup location.
+	LayoutMirror BackupLayout = iota
+	// LayoutHashed stores backups in a flat hash based store, see HashedLayoutFS.
+	LayoutHashed
+	// LayoutDedup stores the contents of backed up files only once, see DedupFS.
+	LayoutDedup
+)
+
+// layoutFS applies the storage layout to the backup filesystem.
+func layoutFS(layout BackupLayout, backup FS) FS {
+	switch layout {
+	case LayoutHashed:
+		return NewHashedLayoutFS(backup)
+	case LayoutDedup:
+		return NewDedupFS(backup)
+	default:
+		return backup
+	}
+}
+
+// hashedIndexName is the name of the path index file in the root of the underlying filesystem.
+// It cannot collide with the hashed entries, which are stored in two character fanout directories.
+const hashedIndexName = "index"
+
+// HashedLayoutFS stores every file, directory and symlink in a flat hash based store of the underlying
+// filesystem. The path of an entry is the sha256 sum of its original path, which keeps path lengths constant
+// no matter how deeply nested the original path is.
+// The original paths of all entries are kept in an append only index file in the root of the underlying filesystem,
+// which is required in order to list directories.
+//
+// Symlink targets are stored verbatim and are resolved in the original path layout.
+type HashedLayoutFS struct {
+	base FS
+
+	mu sync.Mutex
+	// original paths of all stored entries, nil until the index is loaded
+	entries map[string]struct{}
+}
+
+// NewHashedLayoutFS creates a new hash based storage layout on top of base.
+func NewHashedLayoutFS(base FS) *HashedLayoutFS {
+	return &HashedLayoutFS{
+		base: base,
+	}
+}
+
+// Unwrap returns the underlying filesystem.
+func (h *HashedLayoutFS) Unwrap() FS {
+	return h.base
+}
+
+// Name returns the name of this FileSystem
+func (h *HashedLayoutFS) Name() string {
+	return "HashedLayoutFS"
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (h *HashedLayoutFS) Create(name string) (File, error) {
+	return h.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (h *HashedLayoutFS) Mkdir(name string, perm fs.FileMode) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	if h.exists(name) {
+		return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if !h.exists(filepath.Dir(name)) {
+		return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return h.mkdir(name, perm)
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (h *HashedLayoutFS) MkdirAll(name string, perm fs.FileMode) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return &os.PathError{Op: "mkdir_all", Path: name, Err: err}
+	}
+
+	_, err = IterateDirTree(name, func(dir string) (bool, error) {
+		if h.exists(dir) {
+			fi, err := h.lstat(dir)
+			if err != nil {
+				return false, err
+			}
+			if !fi.IsDir() {
+				return false, &os.PathError{Op: "mkdir_all", Path: dir, Err: syscall.ENOTDIR}
+			}
+			return true, nil
+		}
+		return true, h.mkdir(dir, perm)
+	})
+	return err
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (h *HashedLayoutFS) Open(name string) (File, error) {
+	return h.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+func (h *HashedLayoutFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	resolved, err := h.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	created := false
+	if flag&os.O_CREATE != 0 && !h.exists(resolved) {
+		if !h.exists(filepath.Dir(resolved)) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		err = h.base.MkdirAll(h.fanoutDir(resolved), 0700)
+		if err != nil {
+			return nil, err
+		}
+		created = true
+	}
+
+	f, err := h.base.OpenFile(h.hashPath(resolved), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		err = h.addEntry(resolved)
+		if err != nil {
+			return nil, errors.Join(err, f.Close())
+		}
+	}
+	return &hashedFile{File: f, fsys: h, name: name, path: resolved}, nil
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (h *HashedLayoutFS) Remove(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if !h.exists(name) || isRootPath(name) {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(h.children(name)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	return h.remove(name)
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (h *HashedLayoutFS) RemoveAll(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return &os.PathError{Op: "remove_all", Path: name, Err: err}
+	}
+
+	paths := h.descendants(name)
+	if h.exists(name) && !isRootPath(name) {
+		paths = append(paths, name)
+	}
+	sort.Sort(ByMostFilePathSeparators(paths))
+
+	for _, path := range paths {
+		err = h.remove(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename renames a file.
+func (h *HashedLayoutFS) Rename(oldname, newname string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	oldname, newname = normalizePath(oldname), normalizePath(newname)
+	err := h.load()
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if !h.exists(oldname) || isRootPath(oldname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if !h.exists(filepath.Dir(newname)) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if h.exists(newname) {
+		if len(h.children(newname)) > 0 {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOTEMPTY}
+		}
+		err = h.remove(newname)
+		if err != nil {
+			return err
+		}
+	}
+
+	paths := append(h.descendants(oldname), oldname)
+	sort.Sort(ByLeastFilePathSeparators(paths))
+	for _, oldPath := range paths {
+		newPath := filepath.Join(newname, strings.TrimPrefix(oldPath, oldname))
+		err = h.base.MkdirAll(h.fanoutDir(newPath), 0700)
+		if err != nil {
+			return err
+		}
+		err = h.base.Rename(h.hashPath(oldPath), h.hashPath(newPath))
+		if err != nil {
+			return err
+		}
+		err = h.addEntry(newPath)
+		if err != nil {
+			return err
+		}
+		err = h.removeEntry(oldPath)
+		if err != nil {
+			return err
+		}
+		// best effort, fails as long as the fanout directory contains other entries
+		_ = h.base.Remove(h.fanoutDir(oldPath))
+	}
+	return nil
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (h *HashedLayoutFS) Stat(name string) (fs.FileInfo, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	resolved, err := h.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := h.lstat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	return newHashedFileInfo(fi, name), nil
+}
+
+// Lstat will call Lstat if the filesystem itself is, or it delegates to, the os filesystem.
+// Else it will call Stat.
+func (h *HashedLayoutFS) Lstat(name string) (fs.FileInfo, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return h.lstat(name)
+}
+
+// Chmod changes the mode of the named file to mode.
+func (h *HashedLayoutFS) Chmod(name string, mode fs.FileMode) error {
+	return h.apply("chmod", name, true, func(hashedPath string) error {
+		return h.base.Chmod(hashedPath, mode)
+	})
+}
+
+// Chown changes the uid and gid of the named file.
+func (h *HashedLayoutFS) Chown(name string, uid, gid int) error {
+	return h.apply("chown", name, true, func(hashedPath string) error {
+		return h.base.Chown(hashedPath, uid, gid)
+	})
+}
+
+// Chtimes changes the access and modification times of the named file
+func (h *HashedLayoutFS) Chtimes(name string, atime, mtime time.Time) error {
+	return h.apply("chtimes", name, true, func(hashedPath string) error {
+		return h.base.Chtimes(hashedPath, atime, mtime)
+	})
+}
+
+// Truncate changes the size of the named file.
+func (h *HashedLayoutFS) Truncate(name string, size int64) error {
+	return h.apply("truncate", name, true, func(hashedPath string) error {
+		return h.base.Truncate(hashedPath, size)
+	})
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+// The entries contain the logical file names instead of the hashed ones.
+func (h *HashedLayoutFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return readDir(h, name)
+}
+
+// Lchown does not fallback to chown. It does return an error in case that lchown cannot be called.
+func (h *HashedLayoutFS) Lchown(name string, uid, gid int) error {
+	return h.apply("lchown", name, false, func(hashedPath string) error {
+		return h.base.Lchown(hashedPath, uid, gid)
+	})
+}
+
+// Symlink creates a symlink at newname that points to oldname.
+// The target is stored verbatim.
+func (h *HashedLayoutFS) Symlink(oldname, newname string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	newname = normalizePath(newname)
+	err := h.load()
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	if h.exists(newname) {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if !h.exists(filepath.Dir(newname)) {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+
+	err = h.base.MkdirAll(h.fanoutDir(newname), 0700)
+	if err != nil {
+		return err
+	}
+	err = h.base.Symlink(oldname, h.hashPath(newname))
+	if err != nil {
+		return err
+	}
+	return h.addEntry(newname)
+}
+
+// Readlink returns the verbatim target of the symlink.
+func (h *HashedLayoutFS) Readlink(name string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return h.readlink(name)
+}
+
+// apply executes the operation on the hashed path of name.
+// Symlinks are resolved in the original path layout in case that follow is true,
+// as the underlying filesystem cannot resolve their targets.
+func (h *HashedLayoutFS) apply(op, name string, follow bool, f func(hashedPath string) error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name = normalizePath(name)
+	err := h.load()
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+
+	resolved := name
+	if follow {
+		resolved, err = h.resolve(name)
+		if err != nil {
+			return err
+		}
+	}
+	if !h.exists(resolved) {
+		return &os.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return f(h.hashPath(resolved))
+}
+
+// hashPath returns the path of the entry in the underlying filesystem.
+// The root directory is the root directory of the underlying filesystem.
+func (h *HashedLayoutFS) hashPath(name string) string {
+	if isRootPath(name) {
+		return separator
+	}
+	sum := sha256.Sum256([]byte(filepath.ToSlash(name)))
+	hash := hex.EncodeToString(sum[:])
+	return separator + hash[:2] + separator + hash
+}
+
+func (h *HashedLayoutFS) fanoutDir(name string) string {
+	return filepath.Dir(h.hashPath(name))
+}
+
+func (h *HashedLayoutFS) exists(name string) bool {
+	if isRootPath(name) {
+		return true
+	}
+	_, found := h.entries[name]
+	return found
+}
+
+func (h *HashedLayoutFS) lstat(name string) (fs.FileInfo, error) {
+	if !h.exists(name) {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	fi, err := h.base.Lstat(h.hashPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return newHashedFileInfo(fi, name), nil
+}
+
+func (h *HashedLayoutFS) readlink(name string) (string, error) {
+	if !h.exists(name) {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	return h.base.Readlink(h.hashPath(name))
+}
+
+// resolve resolves all symlinks of the path in the original path layout
+func (h *HashedLayoutFS) resolve(name string) (string, error) {
+	for i := 0; i < maxSymlinkHops; i++ {
+		resolved, fi, err := resolvePathWithInfo(hashedResolver{h}, name)
+		if err != nil {
+			return "", err
+		}
+		if fi == nil || fi.Mode()&os.ModeSymlink == 0 {
+			return resolved, nil
+		}
+		target, err := h.readlink(resolved)
+		if err != nil {
+			return "", err
+		}
+		name = normalizePath(toAbsSymlink(target, resolved))
+	}
+	return "", &os.PathError{Op: "resolve", Path: name, Err: syscall.ELOOP}
+}
+
+// hashedResolver resolves paths without acquiring the lock of the HashedLayoutFS
+type hashedResolver struct {
+	h *HashedLayoutFS
+}
+
+func (r hashedResolver) Lstat(name string) (fs.FileInfo, error) {
+	return r.h.lstat(name)
+}
+
+func (r hashedResolver) Readlink(name string) (string, error) {
+	return r.h.readlink(name)
+}
+
+func (h *HashedLayoutFS) mkdir(name string, perm fs.FileMode) error {
+	err := h.base.MkdirAll(h.fanoutDir(name), 0700)
+	if err != nil {
+		return err
+	}
+	err = h.base.Mkdir(h.hashPath(name), perm)
+	if err != nil {
+		return err
+	}
+	return h.addEntry(name)
+}
+
+func (h *HashedLayoutFS) remove(name string) error {
+	err := h.base.Remove(h.hashPath(name))
+	if err != nil && !isNotFoundError(err) {
+		return err
+	}
+	err = h.removeEntry(name)
+	if err != nil {
+		return err
+	}
+	// best effort, fails as long as the fanout directory contains other entries
+	_ = h.base.Remove(h.fanoutDir(name))
+	return nil
+}
+
+// children returns the sorted original paths of the direct children of dir
+func (h *HashedLayoutFS) children(dir string) []string {
+	children := make([]string, 0)
+	for path := range h.entries {
+		if path != dir && filepath.Dir(path) == dir {
+			children = append(children, path)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// descendants returns the original paths of all entries below dir
+func (h *HashedLayoutFS) descendants(dir string) []string {
+	prefix := dir
+	if !strings.HasSuffix(prefix, separator) {
+		prefix += separator
+	}
+
+	descendants := make([]string, 0)
+	for path := range h.entries {
+		if strings.HasPrefix(path, prefix) {
+			descendants = append(descendants, path)
+		}
+	}
+	return descendants
+}
+
+// load reads the path index from the underlying filesystem.
+// Every line of the index either adds (+) or removes (-) a quoted path.
+func (h *HashedLayoutFS) load() (err error) {
+	if h.entries != nil {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to load path index: %w", err)
+		}
+	}()
+
+	entries := make(map[string]struct{})
+	f, err := h.base.Open(separator + hashedIndexName)
+	if isNotFoundError(err) {
+		h.entries = entries
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 {
+			return fmt.Errorf("invalid index line: %q", line)
+		}
+		path, err := strconv.Unquote(line[1:])
+		if err != nil {
+			return fmt.Errorf("invalid index line: %q: %w", line, err)
+		}
+		path = normalizePath(path)
+
+		switch line[0] {
+		case '+':
+			entries[path] = struct{}{}
+		case '-':
+			delete(entries, path)
+		default:
+			return fmt.Errorf("invalid index line: %q", line)
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	h.entries = entries
+	return nil
+}
+
+func (h *HashedLayoutFS) addEntry(name string) error {
+	if h.exists(name) {
+		return nil
+	}
+	err := h.appendIndex('+', name)
+	if err != nil {
+		return err
+	}
+	h.entries[name] = struct{}{}
+	return nil
+}
+
+func (h *HashedLayoutFS) removeEntry(name string) error {
+	if !h.exists(name) || isRootPath(name) {
+		return nil
+	}
+	delete(h.entries, name)
+	if len(h.entries) == 0 {
+		// nothing left, start over with an empty index
+		err := h.base.Remove(separator + hashedIndexName)
+		if err != nil && !isNotFoundError(err) {
+			return err
+		}
+		return nil
+	}
+	return h.appendIndex('-', name)
+}
+
+func (h *HashedLayoutFS) appendIndex(op byte, name string) (err error) {
+	f, err := h.base.OpenFile(separator+hashedIndexName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	_, err = f.WriteString(string(op) + strconv.Quote(filepath.ToSlash(name)) + "\n")
+	return err
+}
+
+func isRootPath(name string) bool {
+	return TrimVolume(name) == separator
+}
+
+func newHashedFileInfo(fi fs.FileInfo, name string) fs.FileInfo {
+	return &prefixFileInfo{
+		baseFi:       fi,
+		nameOverride: filepath.Base(name),
+	}
+}
+
+// hashedFile hides the hashed name of the underlying file and lists
+// directory entries with their original names.
+type hashedFile struct {
+	File
+	fsys *HashedLayoutFS
+	// name that was used to open the file
+	name string
+	// resolved original path of the file
+	path string
+
+	// remaining directory entries
+	dirEntries []string
+	dirRead    bool
+}
+
+func (f *hashedFile) Name() string {
+	return f.name
+}
+
+func (f *hashedFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return newHashedFileInfo(fi, f.name), nil
+}
+
+func (f *hashedFile) Readdir(count int) ([]fs.FileInfo, error) {
+	names, err := f.next(count)
+	if err != nil {
+		return nil, err
+	}
+
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	infos := make([]fs.FileInfo, 0, len(names))
+	for _, name := range names {
+		fi, err := f.fsys.lstat(filepath.Join(f.path, name))
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, fi)
+	}
+	return infos, nil
+}
+
+func (f *hashedFile) Readdirnames(n int) ([]string, error) {
+	return f.next(n)
+}
+
+func (f *hashedFile) next(count int) ([]string, error) {
+	if !f.dirRead {
+		fi, err := f.File.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+		}
+
+		f.fsys.mu.Lock()
+		children := f.fsys.children(f.path)
+		f.fsys.mu.Unlock()
+
+		f.dirEntries = make([]string, 0, len(children))
+		for _, child := range children {
+			f.dirEntries = append(f.dirEntries, filepath.Base(child))
+		}
+		f.dirRead = true
+	}
+
+	if count <= 0 {
+		names := f.dirEntries
+		f.dirEntries = nil
+		return names, nil
+	}
+	if len(f.dirEntries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.dirEntries) {
+		count = len(f.dirEntries)
+	}
+	names := f.dirEntries[:count]
+	f.dirEntries = f.dirEntries[count:]
+	return names, nil
+}
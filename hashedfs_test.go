@@ -0,0 +1,105 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashedLayoutFS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		root    = NewTempDirPrefixFS(CallerPathTmp())
+		fsys    = NewHashedLayoutFS(root)
+	)
+
+	mkdirAll(t, fsys, "/test/dir/subdir", 0755)
+	createFile(t, fsys, "/test/dir/file.txt", "content")
+	createSymlink(t, fsys, "/test/dir", "/test/link")
+
+	fileMustContainText(t, fsys, "/test/dir/file.txt", "content")
+	fileMustContainText(t, fsys, "/test/link/file.txt", "content")
+	symlinkMustExistWithTragetPath(t, fsys, "/test/link", "/test/dir")
+
+	fi, err := fsys.Stat(filepath.FromSlash("/test/link"))
+	require.NoError(err)
+	require.True(fi.IsDir())
+	require.Equal("link", fi.Name())
+
+	f, err := fsys.Open(filepath.FromSlash("/test/dir"))
+	require.NoError(err)
+	names, err := f.Readdirnames(-1)
+	require.NoError(err)
+	require.NoError(f.Close())
+	require.Equal([]string{"file.txt", "subdir"}, names)
+
+	entries, err := fsys.ReadDir(filepath.FromSlash("/test/dir"))
+	require.NoError(err)
+	require.Len(entries, 2)
+	require.Equal("file.txt", entries[0].Name())
+	require.True(entries[1].IsDir())
+
+	err = fsys.Remove(filepath.FromSlash("/test/dir"))
+	require.Error(err)
+
+	// original names are not visible in the underlying filesystem
+	err = Walk(root, separator, func(path string, info fs.FileInfo, err error) error {
+		require.NoError(err)
+		require.NotContains(path, "file.txt")
+		return nil
+	})
+	require.NoError(err)
+
+	require.NoError(fsys.Rename(filepath.FromSlash("/test/dir"), filepath.FromSlash("/test/moved")))
+	fileMustContainText(t, fsys, "/test/moved/file.txt", "content")
+	mustNotExist(t, fsys, "/test/dir/file.txt")
+
+	// the index is persisted
+	reloaded := NewHashedLayoutFS(root)
+	fileMustContainText(t, reloaded, "/test/moved/file.txt", "content")
+
+	require.NoError(fsys.RemoveAll(filepath.FromSlash("/test")))
+	mustNotExist(t, fsys, "/test")
+	// only the root directory is left
+	countFiles(t, root, separator, 1)
+}
+
+func TestBackupFS_WithBackupLayoutHashed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require            = require.New(t)
+		_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+		backupFS           = NewBackupFS(base, backup, WithBackupLayout(LayoutHashed), WithSubtreeCompaction(true))
+		longDir            = filepath.FromSlash("/test/" + strings.Repeat("very_long_directory_name/", 8))
+		longFilePath       = filepath.Join(longDir, "file.txt")
+	)
+
+	mkdirAll(t, base, longDir, 0755)
+	createFile(t, base, longFilePath, "original")
+	createFile(t, base, "/test/removed/file.txt", "removed")
+	createSymlink(t, base, "/test/removed", "/test/link")
+
+	baseState := createFSState(t, base, "/")
+	backupState := createFSState(t, backup, "/")
+
+	createFile(t, backupFS, longFilePath, "modified")
+	removeAll(t, backupFS, "/test/removed")
+	require.NoError(backupFS.Remove(filepath.FromSlash("/test/link")))
+	createFile(t, backupFS, "/test/new.txt", "new")
+
+	fileMustContainText(t, backupFS.BackupFS(), longFilePath, "original")
+	mustNotExist(t, backup, longFilePath)
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseState, base, "/")
+	mustEqualFSState(t, backupState, backup, "/")
+	_, err := backup.Lstat(separator + hashedIndexName)
+	require.ErrorIs(err, os.ErrNotExist)
+}
@@ -1,8 +1,10 @@
 package backupfs
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
@@ -13,8 +15,15 @@ import (
 
 var (
 	// assert interfaces implemented
-	_ FS = (*HiddenFS)(nil)
-
+	_ FS             = (*HiddenFS)(nil)
+	_ Xattrer        = (*HiddenFS)(nil)
+	_ ACLer          = (*HiddenFS)(nil)
+	_ FileAttributer = (*HiddenFS)(nil)
+	_ DACLer         = (*HiddenFS)(nil)
+	_ OSPather       = (*HiddenFS)(nil)
+
+	// ErrInvalidHiddenPath is returned by NewHiddenFSWithOptions in case that a hidden path does not pass the validation.
+	ErrInvalidHiddenPath     = errors.New("invalid hidden path")
 	ErrHiddenNotExist        = fmt.Errorf("hidden: %w", os.ErrNotExist)
 	ErrHiddenPermission      = fmt.Errorf("hidden: %w", fs.ErrPermission)
 	wrapErrHiddenCheckFailed = func(err error) error {
@@ -30,14 +39,98 @@ func NewHiddenFS(base FS, hiddenPaths ...string) *HiddenFS {
 	normalizedHiddenPaths := make([]string, 0, len(hiddenPaths))
 
 	for _, p := range hiddenPaths {
-		normalizedHiddenPaths = append(normalizedHiddenPaths, filepath.Clean(filepath.FromSlash(p)))
+		normalizedHiddenPaths = append(normalizedHiddenPaths, normalizePath(p))
 	}
 
 	sort.Sort(ByMostFilePathSeparators(normalizedHiddenPaths))
 	return &HiddenFS{
 		base:        base,
 		hiddenPaths: normalizedHiddenPaths,
+		hiddenKeys:  normalizedHiddenPaths,
+	}
+}
+
+// HiddenFSOption configures NewHiddenFSWithOptions.
+type HiddenFSOption func(*hiddenFSOptions)
+
+type hiddenFSOptions struct {
+	requireExisting bool
+	create          bool
+	keys            pathKeys
+	logger          *slog.Logger
+}
+
+// WithHiddenLogger sets the logger that receives the debug logs of accesses to hidden paths.
+// The default logger of the slog package is used by default.
+func WithHiddenLogger(l *slog.Logger) HiddenFSOption {
+	return func(o *hiddenFSOptions) {
+		o.logger = l
+	}
+}
+
+// WithRequireExistingHiddenPaths verifies that all hidden paths exist in the base filesystem upon construction.
+// In case that create is true, missing hidden paths are created as directories instead,
+// e.g. the backup location of a BackupFS that shares the base filesystem.
+func WithRequireExistingHiddenPaths(create bool) HiddenFSOption {
+	return func(o *hiddenFSOptions) {
+		o.requireExisting = true
+		o.create = create
+	}
+}
+
+// WithCaseInsensitiveHiddenPaths compares paths with the hidden paths case-insensitively,
+// which is required for case-insensitive base filesystems, e.g. NTFS or APFS by default.
+// Otherwise a hidden path can be accessed by changing the case of its name.
+func WithCaseInsensitiveHiddenPaths() HiddenFSOption {
+	return func(o *hiddenFSOptions) {
+		o.keys.caseInsensitive = true
+	}
+}
+
+// WithHiddenUnicodeNormalization compares paths with the hidden paths in the Unicode normal form,
+// which is required for trees with names in mixed normal forms, e.g. copied from macOS.
+// Otherwise a hidden path can be accessed by encoding its name in another normal form.
+func WithHiddenUnicodeNormalization(form UnicodeForm) HiddenFSOption {
+	return func(o *hiddenFSOptions) {
+		o.keys.form = form
+	}
+}
+
+// NewHiddenFSWithOptions creates a HiddenFS like NewHiddenFS, but returns an error that wraps ErrInvalidHiddenPath
+// in case that a hidden path does not pass the validation.
+// Hiding the root directory is always rejected, as it would hide the whole base filesystem.
+// Existence checks are only done with WithRequireExistingHiddenPaths.
+func NewHiddenFSWithOptions(base FS, hiddenPaths []string, opts ...HiddenFSOption) (*HiddenFS, error) {
+	var o hiddenFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	for _, p := range hiddenPaths {
+		err := validateHiddenPath(base, normalizePath(p), o)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidHiddenPath, p, err)
+		}
+	}
+	s := NewHiddenFS(base, hiddenPaths...)
+	s.logger = o.logger
+	s.setPathKeys(o.keys)
+	return s, nil
+}
+
+func validateHiddenPath(base FS, hiddenPath string, o hiddenFSOptions) error {
+	if TrimVolume(hiddenPath) == separator {
+		return errors.New("root directory cannot be hidden")
+	}
+	if !o.requireExisting {
+		return nil
+	}
+
+	_, err := base.Lstat(hiddenPath)
+	if o.create && isNotFoundError(err) {
+		return base.MkdirAll(hiddenPath, 0755)
 	}
+	return err
 }
 
 // HiddenFS hides everything inside of a list of directory prefixes from the user.
@@ -55,14 +148,36 @@ func NewHiddenFS(base FS, hiddenPaths ...string) *HiddenFS {
 type HiddenFS struct {
 	base        FS
 	hiddenPaths []string
+	// hiddenKeys are the keys of the hidden paths that the keys of names are compared with.
+	hiddenKeys []string
+	keys       pathKeys
+	// nil uses the default logger of the slog package
+	logger *slog.Logger
+}
+
+func (fs *HiddenFS) setPathKeys(keys pathKeys) {
+	fs.keys = keys
+	fs.hiddenKeys = make([]string, 0, len(fs.hiddenPaths))
+	for _, p := range fs.hiddenPaths {
+		fs.hiddenKeys = append(fs.hiddenKeys, keys.key(p))
+	}
+}
+
+// pathKey returns the key of name that is compared with the hiddenKeys.
+func (fs *HiddenFS) pathKey(name string) string {
+	return fs.keys.key(normalizePath(name))
 }
 
 func (fs *HiddenFS) isHidden(name string) (bool, error) {
-	return isHidden(name, fs.hiddenPaths)
+	hidden, err := isHidden(fs.pathKey(name), fs.hiddenKeys)
+	if hidden {
+		loggerOrDefault(fs.logger).Debug("hidden path", "path", name)
+	}
+	return hidden, err
 }
 
 func (fs *HiddenFS) isParentOfHidden(name string) (bool, error) {
-	return isParentOfHiddenDir(name, fs.hiddenPaths)
+	return isParentOfHiddenDir(fs.pathKey(name), fs.hiddenKeys)
 }
 
 // Create creates a file in the filesystem, returning the file and an
@@ -132,7 +247,7 @@ func (s *HiddenFS) OpenFile(name string, flag int, perm fs.FileMode) (File, erro
 		return nil, err
 	}
 
-	return newHiddenFile(f, name, s.hiddenPaths), nil
+	return newHiddenFile(f, name, s), nil
 }
 
 // Remove removes a file identified by name, returning an error, if any
@@ -182,21 +297,12 @@ func (s *HiddenFS) RemoveAll(name string) error {
 	dirList := make([]string, 0, 2)
 
 	// directory -> walk the dir tree
-	err = Walk(s.base, name, func(path string, info fs.FileInfo, err error) error {
+	// hidden subtrees are pruned by the walk and never visited
+	err = s.Walk(name, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		hidden, err := s.isHidden(path)
-		if err != nil {
-			return wrapErrHiddenCheckFailed(err)
-		}
-		// skip hidden files
-		if hidden {
-			// we do not touch hidden
-			return nil
-		}
-
 		if info.IsDir() {
 			// dirs will be handled after all of the other files
 			dirList = append(dirList, path)
@@ -269,11 +375,11 @@ func (s *HiddenFS) Stat(name string) (fs.FileInfo, error) {
 	if hidden {
 		return nil, &os.PathError{Op: "stat", Path: name, Err: ErrHiddenNotExist}
 	}
-	fi, err := s.base.Stat(name)
-	if err != nil {
-		return nil, err
-	}
-	return fi, nil
+
+	// symlinks must not be resolved by the base filesystem,
+	// as symlinks that point at hidden paths must not exist.
+	// the directory metadata is adjusted by Lstat.
+	return statResolved(s, name)
 }
 
 // The name of this FileSystem
@@ -281,6 +387,11 @@ func (s *HiddenFS) Name() string {
 	return "HiddenFS"
 }
 
+// Unwrap returns the filesystem that contains the hidden paths.
+func (s *HiddenFS) Unwrap() FS {
+	return s.base
+}
+
 // Chmod changes the mode of the named file to mode.
 func (s *HiddenFS) Chmod(name string, mode fs.FileMode) error {
 	hidden, err := s.isHidden(name)
@@ -330,6 +441,38 @@ func (s *HiddenFS) Chtimes(name string, atime, mtime time.Time) error {
 	return nil
 }
 
+// Truncate changes the size of the named file.
+func (s *HiddenFS) Truncate(name string, size int64) error {
+	hidden, err := s.isHidden(name)
+	if err != nil {
+		return &os.PathError{Op: "truncate", Path: name, Err: wrapErrHiddenCheckFailed(err)}
+	}
+	if hidden {
+		return &os.PathError{Op: "truncate", Path: name, Err: ErrHiddenNotExist}
+	}
+
+	err = s.base.Truncate(name, size)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+// Hidden entries are not returned.
+func (s *HiddenFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	hidden, err := s.isHidden(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: wrapErrHiddenCheckFailed(err)}
+	}
+	if hidden {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: ErrHiddenNotExist}
+	}
+
+	// the hidden file filters the hidden entries
+	return readDir(s, name)
+}
+
 // Lstat will call Lstat if the filesystem itself is, or it delegates to, the os filesystem.
 // Else it will call Stat.
 // In addtion to the FileInfo, it will return a boolean telling whether Lstat was called or not.
@@ -345,11 +488,20 @@ func (s *HiddenFS) Lstat(name string) (fs.FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return fi, nil
+	return hiddenDirInfoOf(s.base, name, fi, s.hiddenPaths, s.keys), nil
 }
 
 // Symlink changes the access and modification times of the named file
 func (s *HiddenFS) Symlink(oldname, newname string) error {
+	return s.symlink(oldname, newname, LinkAuto)
+}
+
+// SymlinkWithType creates a symlink of the given type, see TypedSymlinker.
+func (s *HiddenFS) SymlinkWithType(oldname, newname string, typ LinkType) error {
+	return s.symlink(oldname, newname, typ)
+}
+
+func (s *HiddenFS) symlink(oldname, newname string, typ LinkType) error {
 	oldname = filepath.FromSlash(oldname)
 	newname = filepath.FromSlash(newname)
 
@@ -383,7 +535,7 @@ func (s *HiddenFS) Symlink(oldname, newname string) error {
 		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrHiddenPermission}
 	}
 
-	err = s.base.Symlink(oldname, newname)
+	err = symlinkWithType(s.base, oldname, newname, typ)
 	if err != nil {
 		return err
 	}
@@ -422,13 +574,35 @@ func (s *HiddenFS) Lchown(name string, uid, gid int) error {
 	return nil
 }
 
+// Walk walks the file tree rooted at root, calling walkFn for each file
+// or directory in the tree, including root.
+// Contrary to walking the base filesystem and filtering every entry, hidden subtrees
+// are pruned at the directory level and are never read nor stat'ed.
+func (s *HiddenFS) Walk(root string, walkFn filepath.WalkFunc) error {
+	hidden, err := s.isHidden(root)
+	if err != nil {
+		return walkFn(root, nil, &os.PathError{Op: "walk", Path: root, Err: wrapErrHiddenCheckFailed(err)})
+	}
+	if hidden {
+		return walkFn(root, nil, &os.PathError{Op: "walk", Path: root, Err: ErrHiddenNotExist})
+	}
+
+	return walkWithSkip(s.base, root, walkFn, func(path string) (bool, error) {
+		hidden, err := s.isHidden(path)
+		if err != nil {
+			return false, wrapErrHiddenCheckFailed(err)
+		}
+		return hidden, nil
+	})
+}
+
 func isParentOfHiddenDir(name string, hiddenPaths []string) (bool, error) {
 	if len(hiddenPaths) == 0 {
 		return false, nil
 	}
 
 	// file normalization allows to use a single filepath separator
-	name = filepath.Clean(filepath.FromSlash(name))
+	name = normalizePath(name)
 
 	for _, hiddenDir := range hiddenPaths {
 		isParentOfHiddenDir, err := dirContains(name, hiddenDir)
@@ -479,6 +653,44 @@ func isInHiddenPath(name, hiddenDir string) (relPath string, inHiddenPath bool,
 	return relPath, true, nil
 }
 
+// hiddenDirInfo describes a directory as if its hidden entries did not exist, which keeps Stat and Lstat
+// consistent with the entries that are listed by ReadDir: the link count of Sys does not include
+// hidden subdirectories. The size of directories, which is derived from the directory entries by some
+// filesystems, is not meaningful and reported as zero for all directories.
+type hiddenDirInfo struct {
+	fs.FileInfo
+	hiddenDirs int
+}
+
+func (fi *hiddenDirInfo) Size() int64 {
+	return 0
+}
+
+func (fi *hiddenDirInfo) Sys() any {
+	return withoutDirLinks(fi.FileInfo.Sys(), fi.hiddenDirs)
+}
+
+// hiddenDirInfoOf returns a hiddenDirInfo in case that fi describes the directory dirPath, fi otherwise.
+func hiddenDirInfoOf(base FS, dirPath string, fi fs.FileInfo, hiddenPaths []string, keys pathKeys) fs.FileInfo {
+	if !fi.IsDir() {
+		return fi
+	}
+
+	hiddenDirs := 0
+	dirPath = keys.key(normalizePath(dirPath))
+	for _, hiddenPath := range hiddenPaths {
+		hiddenKey := keys.key(hiddenPath)
+		if hiddenKey == dirPath || filepath.Dir(hiddenKey) != dirPath {
+			continue
+		}
+		hfi, err := base.Lstat(hiddenPath)
+		if err == nil && hfi.IsDir() {
+			hiddenDirs++
+		}
+	}
+	return &hiddenDirInfo{FileInfo: fi, hiddenDirs: hiddenDirs}
+}
+
 // hiddenPaths should be normalized (filepath.Clean result values)
 func isHidden(name string, hiddenPaths []string) (bool, error) {
 	if len(hiddenPaths) == 0 {
@@ -486,7 +698,7 @@ func isHidden(name string, hiddenPaths []string) (bool, error) {
 	}
 
 	// file normalization allows to use a single filepath separator
-	name = filepath.Clean(filepath.FromSlash(name))
+	name = normalizePath(name)
 
 	for _, hiddenDir := range hiddenPaths {
 		_, hidden, err := isInHiddenPath(name, hiddenDir)
@@ -515,3 +727,105 @@ func allFiles(fsys FS, dir string) ([]string, error) {
 	}
 	return files, nil
 }
+
+// ListXattr returns the names of the extended attributes of the named file, see Xattrer.
+func (s *HiddenFS) ListXattr(name string) ([]string, error) {
+	err := s.checkVisible("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	return ListXattr(s.base, name)
+}
+
+// GetXattr returns the value of the extended attribute of the named file.
+func (s *HiddenFS) GetXattr(name, attr string) ([]byte, error) {
+	err := s.checkVisible("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	return GetXattr(s.base, name, attr)
+}
+
+// SetXattr sets the value of the extended attribute of the named file.
+func (s *HiddenFS) SetXattr(name, attr string, value []byte) error {
+	err := s.checkVisible("setxattr", name)
+	if err != nil {
+		return err
+	}
+	return SetXattr(s.base, name, attr, value)
+}
+
+// GetACL returns the POSIX ACL of the named file, see ACLer.
+func (s *HiddenFS) GetACL(name string, typ ACLType) (ACL, error) {
+	err := s.checkVisible("getacl", name)
+	if err != nil {
+		return nil, err
+	}
+	return GetACL(s.base, name, typ)
+}
+
+// SetACL sets the POSIX ACL of the named file, a nil ACL removes it.
+func (s *HiddenFS) SetACL(name string, typ ACLType, acl ACL) error {
+	err := s.checkVisible("setacl", name)
+	if err != nil {
+		return err
+	}
+	return SetACL(s.base, name, typ, acl)
+}
+
+// GetFileAttributes returns the Windows file attributes of the named file, see FileAttributer.
+func (s *HiddenFS) GetFileAttributes(name string) (FileAttributes, error) {
+	err := s.checkVisible("getfileattributes", name)
+	if err != nil {
+		return 0, err
+	}
+	return GetFileAttributes(s.base, name)
+}
+
+// SetFileAttributes sets the Windows file attributes of the named file.
+func (s *HiddenFS) SetFileAttributes(name string, attrs FileAttributes) error {
+	err := s.checkVisible("setfileattributes", name)
+	if err != nil {
+		return err
+	}
+	return SetFileAttributes(s.base, name, attrs)
+}
+
+// GetDACL returns the DACL of the named file, see DACLer.
+func (s *HiddenFS) GetDACL(name string) (string, error) {
+	err := s.checkVisible("getdacl", name)
+	if err != nil {
+		return "", err
+	}
+	return GetDACL(s.base, name)
+}
+
+// SetDACL sets the DACL of the named file.
+func (s *HiddenFS) SetDACL(name string, sddl string) error {
+	err := s.checkVisible("setdacl", name)
+	if err != nil {
+		return err
+	}
+	return SetDACL(s.base, name, sddl)
+}
+
+// OSPath returns the path of the named file in the filesystem of the operating system, see OSPather.
+func (s *HiddenFS) OSPath(name string) (string, error) {
+	err := s.checkVisible("ospath", name)
+	if err != nil {
+		return "", err
+	}
+	return OSPath(s.base, name)
+}
+
+// checkVisible returns an error in case that name is hidden.
+func (s *HiddenFS) checkVisible(op, name string) error {
+	hidden, err := s.isHidden(name)
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: wrapErrHiddenCheckFailed(err)}
+	}
+	if hidden {
+		return &os.PathError{Op: op, Path: name, Err: ErrHiddenNotExist}
+	}
+	return nil
+}
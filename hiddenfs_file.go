@@ -4,23 +4,28 @@ import (
 	"errors"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"time"
 )
 
-var _ File = (*hiddenFile)(nil)
+var (
+	_ File               = (*hiddenFile)(nil)
+	_ FileMetadataSetter = (*hiddenFile)(nil)
+)
 
-func newHiddenFile(f File, filePath string, hiddenPaths []string) *hiddenFile {
+func newHiddenFile(f File, filePath string, fsys *HiddenFS) *hiddenFile {
 	return &hiddenFile{
-		filePath:    filePath,
-		f:           f,
-		hiddenPaths: hiddenPaths,
+		filePath: filePath,
+		f:        f,
+		fsys:     fsys,
 	}
 }
 
 type hiddenFile struct {
-	f           File
-	filePath    string
-	hiddenPaths []string
+	f        File
+	filePath string
+	fsys     *HiddenFS
 }
 
 func (hf *hiddenFile) Name() string {
@@ -42,12 +47,12 @@ func (hf *hiddenFile) Readdir(count int) ([]fs.FileInfo, error) {
 		}
 
 		for _, info := range infos {
-			hidden, err := isHidden(info.Name(), hf.hiddenPaths)
+			hidden, err := isHidden(hf.fsys.pathKey(filepath.Join(hf.filePath, info.Name())), hf.fsys.hiddenKeys)
 			if err != nil {
 				return nil, err
 			}
 			if !hidden {
-				availableFiles = append(availableFiles, info)
+				availableFiles = append(availableFiles, hiddenDirInfoOf(hf.fsys.base, filepath.Join(hf.filePath, info.Name()), info, hf.fsys.hiddenPaths, hf.fsys.keys))
 			}
 		}
 		return availableFiles, nil
@@ -62,12 +67,12 @@ func (hf *hiddenFile) Readdir(count int) ([]fs.FileInfo, error) {
 		}
 
 		for _, info := range infos {
-			hidden, err := isHidden(filepath.Join(hf.filePath, info.Name()), hf.hiddenPaths)
+			hidden, err := isHidden(hf.fsys.pathKey(filepath.Join(hf.filePath, info.Name())), hf.fsys.hiddenKeys)
 			if err != nil {
 				return nil, err
 			}
 			if !hidden {
-				availableFiles = append(availableFiles, info)
+				availableFiles = append(availableFiles, hiddenDirInfoOf(hf.fsys.base, filepath.Join(hf.filePath, info.Name()), info, hf.fsys.hiddenPaths, hf.fsys.keys))
 			}
 		}
 
@@ -94,7 +99,7 @@ func (hf *hiddenFile) Readdirnames(count int) ([]string, error) {
 		}
 
 		for _, name := range names {
-			hidden, err := isHidden(filepath.Join(hf.filePath, name), hf.hiddenPaths)
+			hidden, err := isHidden(hf.fsys.pathKey(filepath.Join(hf.filePath, name)), hf.fsys.hiddenKeys)
 			if err != nil {
 				return nil, err
 			}
@@ -115,7 +120,7 @@ func (hf *hiddenFile) Readdirnames(count int) ([]string, error) {
 		}
 
 		for _, name := range names {
-			hidden, err := isHidden(name, hf.hiddenPaths)
+			hidden, err := isHidden(hf.fsys.pathKey(filepath.Join(hf.filePath, name)), hf.fsys.hiddenKeys)
 			if err != nil {
 				return nil, err
 			}
@@ -132,7 +137,11 @@ func (hf *hiddenFile) Readdirnames(count int) ([]string, error) {
 	return availableFiles, nil
 }
 func (hf *hiddenFile) Stat() (fs.FileInfo, error) {
-	return hf.f.Stat()
+	fi, err := hf.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return hiddenDirInfoOf(hf.fsys.base, hf.filePath, fi, hf.fsys.hiddenPaths, hf.fsys.keys), nil
 }
 func (hf *hiddenFile) Sync() error {
 	return hf.f.Sync()
@@ -140,6 +149,18 @@ func (hf *hiddenFile) Sync() error {
 func (hf *hiddenFile) Truncate(size int64) error {
 	return hf.f.Truncate(size)
 }
+func (hf *hiddenFile) Chmod(mode fs.FileMode) error {
+	return fchmod(hf.f, mode)
+}
+func (hf *hiddenFile) Chown(uid, gid int) error {
+	return fchown(hf.f, uid, gid)
+}
+func (hf *hiddenFile) Chtimes(atime, mtime time.Time) error {
+	return fchtimes(hf.f, atime, mtime)
+}
+func (hf *hiddenFile) unwrapOSFile() (*os.File, bool) {
+	return unwrapOSFile(hf.f)
+}
 func (hf *hiddenFile) WriteString(s string) (ret int, err error) {
 	return hf.f.WriteString(s)
 }
@@ -1,8 +1,10 @@
 package backupfs
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -221,3 +223,217 @@ func SetupTempDirHiddenFSTest(t *testing.T) (hiddenDirParent, hiddenDir, hiddenF
 	createFile(t, base, filepath.Join(hiddenDir, hiddenFile), "hidden content")
 	return
 }
+
+type lstatRecordingFS struct {
+	FS
+	lstats []string
+}
+
+func (fsys *lstatRecordingFS) Lstat(name string) (fs.FileInfo, error) {
+	fsys.lstats = append(fsys.lstats, name)
+	return fsys.FS.Lstat(name)
+}
+
+func TestHiddenFS_Walk(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	hiddenDirParent, hiddenDir, hiddenFile, base, _ := SetupTempDirHiddenFSTest(t)
+
+	createFile(t, base, filepath.Join(hiddenDir, "subdir", hiddenFile), "hidden content")
+	createFile(t, base, filepath.Join(hiddenDirParent, "visible.txt"), "visible content")
+
+	recorder := &lstatRecordingFS{FS: base}
+	fsys := NewHiddenFS(recorder, hiddenDir)
+
+	visited := make([]string, 0, 2)
+	err := Walk(fsys, hiddenDirParent, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, path)
+		return nil
+	})
+	require.NoError(err)
+	require.Equal([]string{
+		filepath.FromSlash(hiddenDirParent),
+		filepath.Join(hiddenDirParent, "visible.txt"),
+	}, visited)
+
+	// hidden subtrees are pruned before they are stat'ed
+	for _, p := range recorder.lstats {
+		hidden, err := isHidden(p, fsys.hiddenPaths)
+		require.NoError(err)
+		require.Falsef(hidden, "hidden path must not be stat'ed: %s", p)
+	}
+
+	err = fsys.Walk(hiddenDir, func(path string, info fs.FileInfo, err error) error {
+		return err
+	})
+	require.ErrorIs(err, ErrHiddenNotExist)
+}
+
+func TestHiddenFS_ReadDir(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	hiddenDirParent, hiddenDir, _, base, fsys := SetupTempDirHiddenFSTest(t)
+
+	createFile(t, base, filepath.Join(hiddenDirParent, "visible.txt"), "visible content")
+	mkdirAll(t, base, filepath.Join(hiddenDirParent, "a_dir"), 0755)
+
+	entries, err := fsys.ReadDir(hiddenDirParent)
+	require.NoError(err)
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.Equal([]string{"a_dir", "visible.txt"}, names)
+	require.True(entries[0].IsDir())
+
+	_, err = fsys.ReadDir(hiddenDir)
+	require.ErrorIs(err, ErrHiddenNotExist)
+
+	// the prefix is not part of the entries of the root directory
+	entries, err = NewPrefixFS(base, hiddenDirParent).ReadDir(separator)
+	require.NoError(err)
+	require.Len(entries, 3)
+	for _, e := range entries {
+		fi, err := e.Info()
+		require.NoError(err)
+		require.Equal(e.Name(), fi.Name())
+		require.NotContains(e.Name(), separator)
+	}
+}
+
+func TestNewHiddenFSWithOptions(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+	)
+	createFile(t, base, "/hidden/file.txt", "file")
+
+	_, err := NewHiddenFSWithOptions(base, []string{"/"})
+	require.ErrorIs(err, ErrInvalidHiddenPath)
+
+	_, err = NewHiddenFSWithOptions(base, []string{"/hidden", "/missing"}, WithRequireExistingHiddenPaths(false))
+	require.ErrorIs(err, ErrInvalidHiddenPath)
+	require.ErrorIs(err, fs.ErrNotExist)
+
+	hfs, err := NewHiddenFSWithOptions(base, []string{"/hidden", "/missing"}, WithRequireExistingHiddenPaths(true))
+	require.NoError(err)
+	mustLExist(t, base, "/missing")
+	mustNotLExist(t, hfs, "/hidden/file.txt")
+	mustNotLExist(t, hfs, "/missing")
+}
+
+func TestHiddenFS_CaseInsensitive(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+	)
+	createFile(t, base, "/HIDDEN/file.txt", "file")
+	createFile(t, base, "/visible.txt", "file")
+
+	hfs, err := NewHiddenFSWithOptions(base, []string{"/hidden"})
+	require.NoError(err)
+	mustLExist(t, hfs, "/HIDDEN/file.txt")
+
+	hfs, err = NewHiddenFSWithOptions(base, []string{"/hidden"}, WithCaseInsensitiveHiddenPaths())
+	require.NoError(err)
+	mustNotLExist(t, hfs, "/HIDDEN/file.txt")
+	mustNotLExist(t, hfs, "/Hidden")
+	require.ErrorIs(hfs.Remove("/HIDDEN/file.txt"), fs.ErrNotExist)
+
+	entries, err := hfs.ReadDir(separator)
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal("visible.txt", entries[0].Name())
+}
+
+func TestHiddenFS_UnicodeNormalization(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		nfc     = "/b\u00e4ckup"
+		nfd     = "/ba\u0308ckup"
+	)
+	createFile(t, base, nfd+"/file.txt", "file")
+
+	hfs, err := NewHiddenFSWithOptions(base, []string{nfc})
+	require.NoError(err)
+	mustLExist(t, hfs, nfd+"/file.txt")
+
+	hfs, err = NewHiddenFSWithOptions(base, []string{nfc}, WithHiddenUnicodeNormalization(UnicodeFormNFC))
+	require.NoError(err)
+	mustNotLExist(t, hfs, nfd+"/file.txt")
+
+	entries, err := hfs.ReadDir(separator)
+	require.NoError(err)
+	require.Empty(entries)
+}
+
+func TestHiddenFS_DirMetadata(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewTempDirPrefixFS(CallerPathTmp())
+		hfs     = NewHiddenFS(base, "/parent/hidden")
+	)
+	mkdirAll(t, base, "/parent/hidden/nested", 0755)
+	mkdirAll(t, base, "/parent/visible", 0755)
+	createFile(t, base, "/parent/file.txt", "file")
+	createSymlink(t, base, "/parent", "/link")
+
+	entries, err := hfs.ReadDir("/parent")
+	require.NoError(err)
+	require.Len(entries, 2)
+
+	f, err := hfs.Open("/parent")
+	require.NoError(err)
+	fileInfo, err := f.Stat()
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	lstatInfo, err := hfs.Lstat("/parent")
+	require.NoError(err)
+	statInfo, err := hfs.Stat("/link")
+	require.NoError(err)
+	rootInfos, err := readDirInfos(hfs, "/")
+	require.NoError(err)
+
+	for _, fi := range []fs.FileInfo{fileInfo, lstatInfo, statInfo, rootInfos[1]} {
+		require.True(fi.IsDir())
+		require.Zero(fi.Size())
+
+		if n, ok := toLinkCount(fi); ok && runtime.GOOS == "linux" {
+			// . and the visible subdirectory
+			require.Equal(uint64(2+1), n)
+		}
+	}
+
+	// directories without hidden entries report the same size, only their link count is kept
+	baseInfo, err := base.Lstat("/parent/visible")
+	require.NoError(err)
+	visibleInfo, err := hfs.Lstat("/parent/visible")
+	require.NoError(err)
+	require.True(visibleInfo.IsDir())
+	require.Zero(visibleInfo.Size())
+	require.Equal(baseInfo.Sys(), visibleInfo.Sys())
+	require.Equal(baseInfo.ModTime(), visibleInfo.ModTime())
+
+	// files are not modified
+	baseInfo, err = base.Lstat("/parent/file.txt")
+	require.NoError(err)
+	fileInfo, err = hfs.Lstat("/parent/file.txt")
+	require.NoError(err)
+	require.Equal(baseInfo, fileInfo)
+}
@@ -0,0 +1,154 @@
+package backupfs
+
+import (
+	"io"
+	"io/fs"
+	"path/filepath"
+)
+
+var (
+	// assert interfaces implemented
+	_ fs.FS          = (*ioFS)(nil)
+	_ fs.ReadDirFS   = (*ioFS)(nil)
+	_ fs.StatFS      = (*ioFS)(nil)
+	_ fs.ReadFileFS  = (*ioFS)(nil)
+	_ fs.ReadDirFile = (*ioFile)(nil)
+)
+
+// ioFS exposes a FS as standard library io/fs.FS.
+type ioFS struct {
+	fsys FS
+}
+
+// ToIOFS creates a read only io/fs.FS view of the passed filesystem, e.g. for the usage with
+// fs.WalkDir, http.FS or testing/fstest.
+// Paths are slash separated and relative to the root directory of the FS, see fs.ValidPath.
+// The returned filesystem implements fs.ReadDirFS, fs.ReadFileFS and fs.StatFS as well as
+// the ReadLink and Lstat methods of fs.ReadLinkFS.
+func ToIOFS(fsys FS) fs.FS {
+	return &ioFS{fsys: fsys}
+}
+
+// Open opens the named file for reading.
+func (i *ioFS) Open(name string) (fs.File, error) {
+	p, err := i.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := i.fsys.Open(p)
+	if err != nil {
+		return nil, toIOFSError("open", name, err)
+	}
+	return &ioFile{File: f}, nil
+}
+
+// ReadDir reads the named directory and returns a list of directory entries sorted by filename.
+func (i *ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := i.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := i.fsys.ReadDir(p)
+	if err != nil {
+		return nil, toIOFSError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+// ReadFile reads the named file and returns its contents.
+func (i *ioFS) ReadFile(name string) ([]byte, error) {
+	p, err := i.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := i.fsys.Open(p)
+	if err != nil {
+		return nil, toIOFSError("readfile", name, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, toIOFSError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (i *ioFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := i.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := i.fsys.Stat(p)
+	if err != nil {
+		return nil, toIOFSError("stat", name, err)
+	}
+	return fi, nil
+}
+
+// Lstat returns a FileInfo describing the named file without following symlinks.
+func (i *ioFS) Lstat(name string) (fs.FileInfo, error) {
+	p, err := i.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := i.fsys.Lstat(p)
+	if err != nil {
+		return nil, toIOFSError("lstat", name, err)
+	}
+	return fi, nil
+}
+
+// ReadLink returns the destination of the named symbolic link.
+func (i *ioFS) ReadLink(name string) (string, error) {
+	p, err := i.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := i.fsys.Readlink(p)
+	if err != nil {
+		return "", toIOFSError("readlink", name, err)
+	}
+	return target, nil
+}
+
+// path converts the slash separated io/fs path into an absolute path of the FS.
+func (i *ioFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(separator, filepath.FromSlash(name)), nil
+}
+
+// toIOFSError replaces the path of the FS with the io/fs path in the returned error.
+func toIOFSError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+}
+
+// unwrapPathError returns the underlying error of path and link errors.
+func unwrapPathError(err error) error {
+	for {
+		switch e := err.(type) {
+		case *fs.PathError:
+			err = e.Err
+		default:
+			return err
+		}
+	}
+}
+
+// ioFile adds fs.ReadDirFile support to File.
+type ioFile struct {
+	File
+}
+
+// ReadDir reads the contents of the directory, see fs.ReadDirFile.
+func (f *ioFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := f.File.Readdir(n)
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, fi := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	return entries, err
+}
@@ -0,0 +1,48 @@
+package backupfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToIOFS(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, _ := NewTestBackupFS("/base", "/backup")
+
+	createFile(t, base, "/test/a.txt", "a")
+	createFile(t, base, "/test/sub/b.txt", "b")
+	createSymlink(t, base, "/test/a.txt", "/test/link")
+
+	fsys := ToIOFS(base)
+	require.NoError(fstest.TestFS(fsys, "test/a.txt", "test/sub/b.txt"))
+
+	data, err := fs.ReadFile(fsys, "test/sub/b.txt")
+	require.NoError(err)
+	require.Equal("b", string(data))
+
+	_, err = fs.Stat(fsys, "/test/a.txt")
+	require.ErrorIs(err, fs.ErrInvalid)
+
+	_, err = fs.Stat(fsys, "test/missing.txt")
+	require.ErrorIs(err, fs.ErrNotExist)
+	var perr *fs.PathError
+	require.ErrorAs(err, &perr)
+	require.Equal("test/missing.txt", perr.Path)
+
+	rl, ok := fsys.(interface {
+		ReadLink(name string) (string, error)
+		Lstat(name string) (fs.FileInfo, error)
+	})
+	require.True(ok)
+	fi, err := rl.Lstat("test/link")
+	require.NoError(err)
+	require.NotZero(fi.Mode() & fs.ModeSymlink)
+	target, err := rl.ReadLink("test/link")
+	require.NoError(err)
+	require.NotEmpty(target)
+}
@@ -0,0 +1,52 @@
+package backupfs
+
+import (
+	"io"
+	"io/fs"
+)
+
+// newListedDir returns a directory whose entries are not read from the directory handle f,
+// but are listed by the list function on demand, e.g. in order to merge the entries of multiple filesystems.
+func newListedDir(f File, list func() ([]fs.FileInfo, error)) *listedDir {
+	return &listedDir{File: f, list: list}
+}
+
+type listedDir struct {
+	File
+	list func() ([]fs.FileInfo, error)
+
+	// read on demand
+	infos  []fs.FileInfo
+	offset int
+}
+
+func (d *listedDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if d.infos == nil {
+		infos, err := d.list()
+		if err != nil {
+			return nil, err
+		}
+		d.infos = infos
+	}
+
+	infos := d.infos[d.offset:]
+	if count > 0 {
+		if len(infos) == 0 {
+			return nil, io.EOF
+		}
+		if len(infos) > count {
+			infos = infos[:count]
+		}
+	}
+	d.offset += len(infos)
+	return infos, nil
+}
+
+func (d *listedDir) Readdirnames(n int) ([]string, error) {
+	infos, err := d.Readdir(n)
+	names := make([]string, 0, len(infos))
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	return names, err
+}
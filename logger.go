@@ -0,0 +1,12 @@
+package backupfs
+
+import "log/slog"
+
+// loggerOrDefault returns the default logger of the slog package in case that l is nil.
+// The default logger is looked up on every call, as it may be replaced at any time.
+func loggerOrDefault(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
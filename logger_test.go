@@ -0,0 +1,57 @@
+package backupfs
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestBackupFS_WithLogger(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		buf      bytes.Buffer
+		backupFS = NewBackupFS(base, NewMemFS(), WithLogger(newTestLogger(&buf)))
+	)
+
+	createFile(t, base, "/test/file.txt", "original")
+	createFile(t, backupFS, "/test/file.txt", "modified")
+	createFile(t, backupFS, "/test/created.txt", "created")
+	require.NoError(backupFS.Rollback())
+
+	logs := buf.String()
+	require.Contains(logs, `msg="backup required" path=/test/file.txt`)
+	require.Contains(logs, `msg="backup not required, tracked as created" path=/test/created.txt`)
+	require.Contains(logs, `msg="resolved path" path=/test/file.txt resolved=/test/file.txt`)
+	require.Contains(logs, `msg="rollback step" event=restored path=/test/file.txt`)
+	require.Contains(logs, `msg="rollback step" event=removed path=/test/created.txt`)
+}
+
+func TestPrefixAndHiddenFS_WithLogger(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		buf     bytes.Buffer
+		logger  = newTestLogger(&buf)
+	)
+
+	pfs, err := NewPrefixFSWithOptions(base, "/prefix", WithPrefixLogger(logger))
+	require.NoError(err)
+	createFile(t, pfs, "/file.txt", "file")
+	require.Contains(buf.String(), `msg="prefixed path" path=/file.txt prefixed=/prefix/file.txt`)
+
+	hfs, err := NewHiddenFSWithOptions(base, []string{"/prefix"}, WithHiddenLogger(logger))
+	require.NoError(err)
+	mustNotLExist(t, hfs, "/prefix/file.txt")
+	require.Contains(buf.String(), `msg="hidden path" path=/prefix/file.txt`)
+}
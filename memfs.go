@@ -0,0 +1,691 @@
+package backupfs
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// assert interfaces implemented
+var (
+	_ FS             = (*MemFS)(nil)
+	_ Xattrer        = (*MemFS)(nil)
+	_ FileAttributer = (*MemFS)(nil)
+)
+
+const (
+	// maximum number of symlinks that are followed while resolving a path
+	memMaxSymlinks = 255
+)
+
+// MemFS is an in-memory filesystem that supports symlinks, ownership and
+// modification times. It is intended for tests and simulations.
+// Volume names are ignored, all paths are treated as absolute paths.
+type MemFS struct {
+	mu    sync.RWMutex
+	root  *memNode
+	clock Clock
+}
+
+// NewMemFS creates a new empty in-memory filesystem that only contains the root directory.
+func NewMemFS() *MemFS {
+	return NewMemFSWithClock(SystemClock())
+}
+
+// NewMemFSWithClock creates a new empty in-memory filesystem that uses the clock
+// for the modification times of created and modified files.
+func NewMemFSWithClock(clock Clock) *MemFS {
+	uid, gid := os.Getuid(), os.Getgid()
+	return &MemFS{
+		root: &memNode{
+			name:     separator,
+			mode:     fs.ModeDir | 0755,
+			modTime:  clock.Now(),
+			uid:      uid,
+			gid:      gid,
+			children: make(map[string]*memNode),
+		},
+		clock: clock,
+	}
+}
+
+type memNode struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	uid     int
+	gid     int
+
+	// file content
+	data []byte
+	// directory entries
+	children map[string]*memNode
+	// symlink target
+	target string
+	// extended attributes
+	xattrs map[string][]byte
+	// Windows file attributes
+	attrs FileAttributes
+}
+
+func (n *memNode) info() fs.FileInfo {
+	size := int64(len(n.data))
+	if n.mode&fs.ModeSymlink != 0 {
+		size = int64(len(n.target))
+	}
+	return &memFileInfo{
+		fInfo: fInfo{
+			FileName: n.name,
+			FileMode: uint32(n.mode),
+			FileSize: size,
+			FileUid:  n.uid,
+			FileGid:  n.gid,
+		},
+		modTime: n.modTime,
+	}
+}
+
+// memFileInfo keeps the modification time as is,
+// as the nanoseconds of fInfo cannot represent times before 1678 or after 2262.
+type memFileInfo struct {
+	fInfo
+	modTime time.Time
+}
+
+func (fi *memFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+
+func (n *memNode) isDir() bool {
+	return n.mode.IsDir()
+}
+
+func (n *memNode) isSymlink() bool {
+	return n.mode&fs.ModeSymlink != 0
+}
+
+func splitMemPath(name string) []string {
+	name = filepath.ToSlash(TrimVolume(filepath.Clean(name)))
+	parts := strings.Split(name, "/")
+	result := parts[:0]
+	for _, p := range parts {
+		if p != "" && p != "." {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// resolve looks up the node of the path.
+// The last path element is only followed in case that it is a symlink and followLast is true.
+// parent is the directory that contains the node, name is the path element of the node in its parent.
+// In case that only the last path element does not exist, parent and name are returned together with
+// an fs.ErrNotExist error.
+func (m *MemFS) resolve(name string, followLast bool) (node, parent *memNode, base string, err error) {
+	var (
+		parts = splitMemPath(name)
+		stack = []*memNode{m.root}
+		hops  = 0
+	)
+
+	for len(parts) > 0 {
+		p := parts[0]
+		parts = parts[1:]
+
+		cur := stack[len(stack)-1]
+		if p == ".." {
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		if !cur.isDir() {
+			return nil, nil, "", syscall.ENOTDIR
+		}
+
+		child, found := cur.children[p]
+		if !found {
+			if len(parts) == 0 {
+				return nil, cur, p, fs.ErrNotExist
+			}
+			return nil, nil, "", fs.ErrNotExist
+		}
+
+		if child.isSymlink() && (len(parts) > 0 || followLast) {
+			hops++
+			if hops > memMaxSymlinks {
+				return nil, nil, "", syscall.ELOOP
+			}
+
+			target := filepath.ToSlash(child.target)
+			if strings.HasPrefix(target, "/") || filepath.IsAbs(child.target) {
+				stack = stack[:1]
+			}
+			parts = append(splitMemPath(target), parts...)
+			if len(parts) == 0 {
+				// link to the root directory
+				return m.root, nil, separator, nil
+			}
+			continue
+		}
+
+		if len(parts) == 0 {
+			return child, cur, p, nil
+		}
+		stack = append(stack, child)
+	}
+
+	return stack[len(stack)-1], nil, separator, nil
+}
+
+func (m *MemFS) lookup(op, name string, followLast bool) (*memNode, error) {
+	node, _, _, err := m.resolve(name, followLast)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return node, nil
+}
+
+// parentOf returns the existing parent directory of name and the base name of name.
+func (m *MemFS) parentOf(op, name string) (parent *memNode, base string, existing *memNode, err error) {
+	existing, parent, base, err = m.resolve(name, false)
+	if err != nil && parent == nil {
+		return nil, "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if parent == nil {
+		// root directory
+		return nil, "", existing, &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	return parent, base, existing, nil
+}
+
+func (m *MemFS) newNode(name string, mode fs.FileMode) *memNode {
+	n := &memNode{
+		name:    name,
+		mode:    mode,
+		modTime: m.clock.Now(),
+		uid:     os.Getuid(),
+		gid:     os.Getgid(),
+	}
+	if mode.IsDir() {
+		n.children = make(map[string]*memNode)
+	}
+	return n
+}
+
+func (m *MemFS) touch(n *memNode) {
+	n.modTime = m.clock.Now()
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (m *MemFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (m *MemFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdir(name, perm)
+}
+
+func (m *MemFS) mkdir(name string, perm fs.FileMode) error {
+	parent, base, existing, err := m.parentOf("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	parent.children[base] = m.newNode(base, fs.ModeDir|perm.Perm())
+	m.touch(parent)
+	return nil
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := IterateDirTree(normalizePath(name), func(dir string) (bool, error) {
+		node, err := m.lookup("mkdir_all", dir, true)
+		if err == nil {
+			if !node.isDir() {
+				return false, &fs.PathError{Op: "mkdir_all", Path: dir, Err: syscall.ENOTDIR}
+			}
+			return true, nil
+		}
+		if !isNotFoundError(err) {
+			return false, err
+		}
+		return true, m.mkdir(dir, perm)
+	})
+	return err
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (m *MemFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.openNode(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &memFile{
+		fsys: m,
+		node: node,
+		name: normalizePath(name),
+		flag: flag,
+	}
+	return f, nil
+}
+
+func (m *MemFS) openNode(name string, flag int, perm fs.FileMode) (*memNode, error) {
+	node, parent, base, err := m.resolve(name, true)
+	switch {
+	case err == nil:
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		if node.isDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			node.data = nil
+			m.touch(node)
+		}
+		return node, nil
+	case parent != nil && flag&os.O_CREATE != 0:
+		if existing, found := parent.children[base]; found && existing.isSymlink() {
+			// dangling symlink, create the file at the link target
+			target := existing.target
+			if !filepath.IsAbs(target) && !strings.HasPrefix(filepath.ToSlash(target), "/") {
+				target = filepath.Join(filepath.Dir(normalizePath(name)), target)
+			}
+			return m.openNode(target, flag, perm)
+		}
+		node = m.newNode(base, perm.Perm())
+		parent.children[base] = node
+		m.touch(parent)
+		return node, nil
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, parent, base, err := m.resolve(name, false)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if parent == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	if node.isDir() && len(node.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+
+	delete(parent.children, base)
+	m.touch(parent)
+	return nil
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, parent, base, err := m.resolve(name, false)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil
+		}
+		return &fs.PathError{Op: "remove_all", Path: name, Err: err}
+	}
+	if parent == nil {
+		// root directory cannot be removed, only its content
+		node.children = make(map[string]*memNode)
+		m.touch(node)
+		return nil
+	}
+
+	delete(parent.children, base)
+	m.touch(parent)
+	return nil
+}
+
+// Rename renames a file.
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	node, oldParent, oldBase, err := m.resolve(oldname, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	if oldParent == nil {
+		return linkErr(syscall.EBUSY)
+	}
+
+	existing, newParent, newBase, err := m.resolve(newname, false)
+	if err != nil && newParent == nil {
+		return linkErr(err)
+	}
+	if newParent == nil {
+		return linkErr(syscall.EBUSY)
+	}
+	if existing == node {
+		return nil
+	}
+
+	if node.isDir() {
+		// a directory cannot be moved into itself
+		contains, err := dirContains(normalizePath(oldname), normalizePath(newname))
+		if err != nil {
+			return linkErr(err)
+		}
+		if contains {
+			return linkErr(syscall.EINVAL)
+		}
+	}
+
+	if existing != nil {
+		switch {
+		case existing.isDir() && !node.isDir():
+			return linkErr(syscall.EISDIR)
+		case !existing.isDir() && node.isDir():
+			return linkErr(syscall.ENOTDIR)
+		case existing.isDir() && len(existing.children) > 0:
+			return linkErr(syscall.ENOTEMPTY)
+		}
+	}
+
+	delete(oldParent.children, oldBase)
+	node.name = newBase
+	newParent.children[newBase] = node
+	m.touch(oldParent)
+	m.touch(newParent)
+	return nil
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(), nil
+}
+
+// The name of this FileSystem
+func (m *MemFS) Name() string {
+	return "MemFS"
+}
+
+// Chmod changes the mode of the named file to mode.
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+
+	const chmodBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+	node.mode = node.mode&^chmodBits | mode&chmodBits
+	return nil
+}
+
+// Chown changes the uid and gid of the named file.
+func (m *MemFS) Chown(name string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("chown", name, true)
+	if err != nil {
+		return err
+	}
+	chownNode(node, uid, gid)
+	return nil
+}
+
+// Chtimes changes the access and modification times of the named file
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	if !mtime.IsZero() {
+		node.modTime = mtime
+	}
+	return nil
+}
+
+// Truncate changes the size of the named file.
+func (m *MemFS) Truncate(name string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("truncate", name, true)
+	if err != nil {
+		return err
+	}
+	switch {
+	case node.isDir():
+		return &fs.PathError{Op: "truncate", Path: name, Err: syscall.EISDIR}
+	case size < 0:
+		return &fs.PathError{Op: "truncate", Path: name, Err: syscall.EINVAL}
+	}
+
+	if size <= int64(len(node.data)) {
+		node.data = node.data[:size]
+	} else {
+		node.data = append(node.data, make([]byte, size-int64(len(node.data)))...)
+	}
+	m.touch(node)
+	return nil
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return readDir(m, name)
+}
+
+// Lstat returns a FileInfo describing the named file without following symlinks.
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(), nil
+}
+
+// Symlink creates a symlink at newname that points to oldname.
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, base, existing, err := m.parentOf("symlink", newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errorsUnwrapPath(err)}
+	}
+	if existing != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+
+	node := m.newNode(base, fs.ModeSymlink|fs.ModePerm)
+	node.target = oldname
+	parent.children[base] = node
+	m.touch(parent)
+	return nil
+}
+
+// Readlink returns the target of the symlink.
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !node.isSymlink() {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return node.target, nil
+}
+
+// Lchown changes the uid and gid of the named file without following symlinks.
+func (m *MemFS) Lchown(name string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("lchown", name, false)
+	if err != nil {
+		return err
+	}
+	chownNode(node, uid, gid)
+	return nil
+}
+
+// a value of -1 keeps the current id
+func chownNode(node *memNode, uid, gid int) {
+	if uid != -1 {
+		node.uid = uid
+	}
+	if gid != -1 {
+		node.gid = gid
+	}
+}
+
+func errorsUnwrapPath(err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// sortedChildren returns the directory entries sorted by name
+func (n *memNode) sortedChildren() []*memNode {
+	children := make([]*memNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+// ListXattr returns the sorted names of the extended attributes of the named file, see Xattrer.
+func (m *MemFS) ListXattr(name string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("listxattr", name, true)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([]string, 0, len(node.xattrs))
+	for attr := range node.xattrs {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	return attrs, nil
+}
+
+// GetXattr returns the value of the extended attribute of the named file.
+func (m *MemFS) GetXattr(name, attr string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("getxattr", name, true)
+	if err != nil {
+		return nil, err
+	}
+	value, found := node.xattrs[attr]
+	if !found {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: errNoXattr}
+	}
+	return bytes.Clone(value), nil
+}
+
+// SetXattr sets the value of the extended attribute of the named file.
+func (m *MemFS) SetXattr(name, attr string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("setxattr", name, true)
+	if err != nil {
+		return err
+	}
+	if node.xattrs == nil {
+		node.xattrs = make(map[string][]byte)
+	}
+	node.xattrs[attr] = bytes.Clone(value)
+	return nil
+}
+
+// GetFileAttributes returns the Windows file attributes of the named file, see FileAttributer.
+func (m *MemFS) GetFileAttributes(name string) (FileAttributes, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("getfileattributes", name, true)
+	if err != nil {
+		return 0, err
+	}
+	return node.attrs, nil
+}
+
+// SetFileAttributes sets the Windows file attributes of the named file.
+func (m *MemFS) SetFileAttributes(name string, attrs FileAttributes) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("setfileattributes", name, true)
+	if err != nil {
+		return err
+	}
+	node.attrs = attrs & fileAttributesMask
+	return nil
+}
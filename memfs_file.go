@@ -0,0 +1,282 @@
+package backupfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	_ File               = (*memFile)(nil)
+	_ FileMetadataSetter = (*memFile)(nil)
+)
+
+type memFile struct {
+	fsys *MemFS
+	node *memNode
+	name string
+	flag int
+
+	offset int64
+	// number of directory entries that have already been read
+	dirOffset int
+	closed    bool
+}
+
+func (f *memFile) pathErr(op string, err error) error {
+	return &fs.PathError{Op: op, Path: f.name, Err: err}
+}
+
+func (f *memFile) readable() bool {
+	return f.flag&os.O_WRONLY == 0
+}
+
+func (f *memFile) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Readdir(count int) ([]fs.FileInfo, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.closed {
+		return nil, f.pathErr("readdir", fs.ErrClosed)
+	}
+	if !f.node.isDir() {
+		return nil, f.pathErr("readdir", syscall.ENOTDIR)
+	}
+
+	children := f.node.sortedChildren()
+	if f.dirOffset > len(children) {
+		f.dirOffset = len(children)
+	}
+	children = children[f.dirOffset:]
+	if count > 0 {
+		if len(children) == 0 {
+			return nil, io.EOF
+		}
+		if len(children) > count {
+			children = children[:count]
+		}
+	}
+	f.dirOffset += len(children)
+
+	infos := make([]fs.FileInfo, 0, len(children))
+	for _, c := range children {
+		infos = append(infos, c.info())
+	}
+	return infos, nil
+}
+
+func (f *memFile) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	names := make([]string, 0, len(infos))
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	return names, err
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fsys.mu.RLock()
+	defer f.fsys.mu.RUnlock()
+
+	if f.closed {
+		return nil, f.pathErr("stat", fs.ErrClosed)
+	}
+	return f.node.info(), nil
+}
+
+func (f *memFile) Sync() error {
+	if f.closed {
+		return f.pathErr("sync", fs.ErrClosed)
+	}
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	switch {
+	case f.closed:
+		return f.pathErr("truncate", fs.ErrClosed)
+	case !f.writable() || f.node.isDir():
+		return f.pathErr("truncate", syscall.EBADF)
+	case size < 0:
+		return f.pathErr("truncate", syscall.EINVAL)
+	}
+
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.fsys.touch(f.node)
+	return nil
+}
+
+func (f *memFile) Chmod(mode fs.FileMode) error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.closed {
+		return f.pathErr("chmod", fs.ErrClosed)
+	}
+	const chmodBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+	f.node.mode = f.node.mode&^chmodBits | mode&chmodBits
+	return nil
+}
+
+func (f *memFile) Chown(uid, gid int) error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.closed {
+		return f.pathErr("chown", fs.ErrClosed)
+	}
+	chownNode(f.node, uid, gid)
+	return nil
+}
+
+func (f *memFile) Chtimes(atime, mtime time.Time) error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.closed {
+		return f.pathErr("chtimes", fs.ErrClosed)
+	}
+	if !mtime.IsZero() {
+		f.node.modTime = mtime
+	}
+	return nil
+}
+
+func (f *memFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *memFile) Close() error {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.closed {
+		return f.pathErr("close", fs.ErrClosed)
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (n int, err error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	n, err = f.readAt("read", p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (n int, err error) {
+	f.fsys.mu.RLock()
+	defer f.fsys.mu.RUnlock()
+
+	n, err = f.readAt("read", p, off)
+	if err == nil && n < len(p) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (f *memFile) readAt(op string, p []byte, off int64) (int, error) {
+	switch {
+	case f.closed:
+		return 0, f.pathErr(op, fs.ErrClosed)
+	case f.node.isDir():
+		return 0, f.pathErr(op, syscall.EISDIR)
+	case !f.readable():
+		return 0, f.pathErr(op, syscall.EBADF)
+	case off < 0:
+		return 0, f.pathErr(op, syscall.EINVAL)
+	}
+
+	if off >= int64(len(f.node.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.node.data[off:]), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.closed {
+		return 0, f.pathErr("seek", fs.ErrClosed)
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	default:
+		return 0, f.pathErr("seek", syscall.EINVAL)
+	}
+	if offset < 0 {
+		return 0, f.pathErr("seek", syscall.EINVAL)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Write(p []byte) (n int, err error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	n, err = f.writeAt("write", p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (n int, err error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		return 0, f.pathErr("write", syscall.EINVAL)
+	}
+	return f.writeAt("write", p, off)
+}
+
+func (f *memFile) writeAt(op string, p []byte, off int64) (int, error) {
+	switch {
+	case f.closed:
+		return 0, f.pathErr(op, fs.ErrClosed)
+	case f.node.isDir():
+		return 0, f.pathErr(op, syscall.EISDIR)
+	case !f.writable():
+		return 0, f.pathErr(op, syscall.EBADF)
+	case off < 0:
+		return 0, f.pathErr(op, syscall.EINVAL)
+	}
+
+	end := off + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[off:], p)
+	f.fsys.touch(f.node)
+	return len(p), nil
+}
@@ -0,0 +1,151 @@
+package backupfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFS(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	fsys := NewMemFS()
+
+	mkdirAll(t, fsys, "/a/b/c", 0755)
+	createFile(t, fsys, "/a/b/c/file.txt", "content")
+	fileMustContainText(t, fsys, "/a/b/c/file.txt", "content")
+
+	err := fsys.Mkdir("/a/b", 0755)
+	require.ErrorIs(err, fs.ErrExist)
+
+	err = fsys.MkdirAll("/a/b/c/file.txt/d", 0755)
+	require.ErrorIs(err, syscall.ENOTDIR)
+
+	_, err = fsys.Stat("/a/b/c/file.txt/d")
+	require.True(isNotFoundError(err))
+
+	err = fsys.Remove("/a/b")
+	require.ErrorIs(err, syscall.ENOTEMPTY)
+
+	// symlinks
+	createSymlink(t, fsys, "/a/b/c/file.txt", "/link")
+	createSymlink(t, fsys, "b/c", "/a/rel")
+	symlinkMustExistWithTragetPath(t, fsys, "/link", "/a/b/c/file.txt")
+	fileMustContainText(t, fsys, "/link", "content")
+	fileMustContainText(t, fsys, "/a/rel/file.txt", "content")
+
+	fi, err := fsys.Lstat("/link")
+	require.NoError(err)
+	require.NotZero(fi.Mode() & fs.ModeSymlink)
+
+	fi, err = fsys.Stat("/link")
+	require.NoError(err)
+	require.True(fi.Mode().IsRegular())
+
+	require.NoError(fsys.Symlink("/loop2", "/loop1"))
+	require.NoError(fsys.Symlink("/loop1", "/loop2"))
+	_, err = fsys.Stat("/loop1")
+	require.ErrorIs(err, syscall.ELOOP)
+
+	// creating a file via a dangling symlink creates the link target
+	require.NoError(fsys.Symlink("/a/target.txt", "/dangling"))
+	createFile(t, fsys, "/dangling", "via link")
+	fileMustContainText(t, fsys, "/a/target.txt", "via link")
+
+	// metadata
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(fsys.Chmod("/link", 0600))
+	require.NoError(fsys.Chtimes("/a/b/c/file.txt", mtime, mtime))
+	require.NoError(fsys.Lchown("/link", 1000, 1001))
+	fi, err = fsys.Stat("/a/b/c/file.txt")
+	require.NoError(err)
+	require.Equal(fs.FileMode(0600), fi.Mode())
+	require.True(mtime.Equal(fi.ModTime()))
+
+	// times that exceed the range of UnixNano
+	for _, mtime := range []time.Time{
+		time.Date(1600, 1, 1, 0, 0, 0, 1, time.UTC),
+		time.Date(2300, 1, 1, 0, 0, 0, 1, time.UTC),
+	} {
+		require.NoError(fsys.Chtimes("/a/b/c/file.txt", mtime, mtime))
+		fi, err = fsys.Lstat("/a/b/c/file.txt")
+		require.NoError(err)
+		require.True(mtime.Equal(fi.ModTime()), fi.ModTime())
+	}
+
+	// file operations
+	f, err := fsys.OpenFile("/a/b/c/file.txt", os.O_RDWR, 0)
+	require.NoError(err)
+	_, err = f.WriteAt([]byte("C"), 0)
+	require.NoError(err)
+	_, err = f.Seek(0, io.SeekEnd)
+	require.NoError(err)
+	_, err = f.WriteString("!")
+	require.NoError(err)
+	require.NoError(f.Truncate(4))
+	require.NoError(f.Close())
+	require.ErrorIs(f.Close(), fs.ErrClosed)
+	fileMustContainText(t, fsys, "/a/b/c/file.txt", "Cont")
+
+	f, err = fsys.Open("/a/b/c/file.txt")
+	require.NoError(err)
+	_, err = f.Write([]byte("read only"))
+	require.Error(err)
+	require.NoError(f.Close())
+
+	_, err = fsys.OpenFile("/a/b/c/file.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	require.ErrorIs(err, fs.ErrExist)
+
+	// directories
+	f, err = fsys.Open("/a")
+	require.NoError(err)
+	names, err := f.Readdirnames(-1)
+	require.NoError(err)
+	require.Equal([]string{"b", "rel", "target.txt"}, names)
+	require.NoError(f.Close())
+
+	// rename
+	err = fsys.Rename("/a", "/a/b/moved")
+	require.ErrorIs(err, syscall.EINVAL)
+	require.NoError(fsys.Rename("/a/b", "/moved"))
+	fileMustContainText(t, fsys, "/moved/c/file.txt", "Cont")
+	mustNotExist(t, fsys, "/a/b")
+
+	require.NoError(fsys.RemoveAll("/moved"))
+	mustNotExist(t, fsys, "/moved/c/file.txt")
+	require.NoError(fsys.RemoveAll("/does/not/exist"))
+}
+
+func TestMemFS_BackupFSRollback(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backup   = NewMemFS()
+		backupFS = NewBackupFS(base, backup)
+	)
+
+	createFile(t, base, "/test/file.txt", "original")
+	createSymlink(t, base, "/test/file.txt", "/test/link")
+	mkdirAll(t, base, "/test/dir/subdir", 0755)
+
+	baseState := createFSState(t, base, "/")
+
+	createFile(t, backupFS, "/test/file.txt", "modified")
+	createFile(t, backupFS, "/test/new.txt", "new")
+	removeAll(t, backupFS, "/test/dir")
+	require.NoError(backupFS.Remove("/test/link"))
+	require.NoError(backupFS.Chmod("/test", 0700))
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, baseState, base, "/")
+	mustNotExist(t, base, filepath.FromSlash("/test/new.txt"))
+}
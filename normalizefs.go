@@ -0,0 +1,215 @@
+package backupfs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// assert interfaces implemented
+var (
+	_ FS             = (*NormalizeFS)(nil)
+	_ Xattrer        = (*NormalizeFS)(nil)
+	_ ACLer          = (*NormalizeFS)(nil)
+	_ FileAttributer = (*NormalizeFS)(nil)
+	_ DACLer         = (*NormalizeFS)(nil)
+	_ OSPather       = (*NormalizeFS)(nil)
+)
+
+// normalizePath cleans the path and replaces all slashes with the
+// operating system specific separator.
+func normalizePath(name string) string {
+	return filepath.Clean(filepath.FromSlash(name))
+}
+
+// normalizeSeparators treats slashes and backslashes as separators on all operating systems
+// and replaces both of them with the operating system specific separator.
+func normalizeSeparators(name string) string {
+	return filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))
+}
+
+// NormalizeFS strictly normalizes all paths before they are passed to the underlying filesystem.
+// Slashes and backslashes are both treated as path separators on all operating systems and replaced
+// with the operating system specific separator. Afterwards the paths are cleaned.
+// This makes mixed separator inputs like "/Program Data\\x" consistent across all layers.
+//
+// On non-Windows operating systems backslashes are valid file name characters,
+// which is why this layer is optional and should be the topmost layer of the stack.
+type NormalizeFS struct {
+	base FS
+}
+
+// NewNormalizeFS creates a new strictly normalizing filesystem layer on top of base.
+func NewNormalizeFS(base FS) *NormalizeFS {
+	return &NormalizeFS{
+		base: base,
+	}
+}
+
+func (n *NormalizeFS) normalize(name string) string {
+	return filepath.Clean(normalizeSeparators(name))
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (n *NormalizeFS) Create(name string) (File, error) {
+	return n.base.Create(n.normalize(name))
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (n *NormalizeFS) Mkdir(name string, perm fs.FileMode) error {
+	return n.base.Mkdir(n.normalize(name), perm)
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (n *NormalizeFS) MkdirAll(name string, perm fs.FileMode) error {
+	return n.base.MkdirAll(n.normalize(name), perm)
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (n *NormalizeFS) Open(name string) (File, error) {
+	return n.base.Open(n.normalize(name))
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+func (n *NormalizeFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return n.base.OpenFile(n.normalize(name), flag, perm)
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (n *NormalizeFS) Remove(name string) error {
+	return n.base.Remove(n.normalize(name))
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (n *NormalizeFS) RemoveAll(name string) error {
+	return n.base.RemoveAll(n.normalize(name))
+}
+
+// Rename renames a file.
+func (n *NormalizeFS) Rename(oldname, newname string) error {
+	return n.base.Rename(n.normalize(oldname), n.normalize(newname))
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (n *NormalizeFS) Stat(name string) (fs.FileInfo, error) {
+	return n.base.Stat(n.normalize(name))
+}
+
+// The name of this FileSystem
+func (n *NormalizeFS) Name() string {
+	return "NormalizeFS"
+}
+
+// Unwrap returns the filesystem that receives the normalized paths.
+func (n *NormalizeFS) Unwrap() FS {
+	return n.base
+}
+
+// Chmod changes the mode of the named file to mode.
+func (n *NormalizeFS) Chmod(name string, mode fs.FileMode) error {
+	return n.base.Chmod(n.normalize(name), mode)
+}
+
+// Chown changes the uid and gid of the named file.
+func (n *NormalizeFS) Chown(name string, uid, gid int) error {
+	return n.base.Chown(n.normalize(name), uid, gid)
+}
+
+// Chtimes changes the access and modification times of the named file
+func (n *NormalizeFS) Chtimes(name string, atime, mtime time.Time) error {
+	return n.base.Chtimes(n.normalize(name), atime, mtime)
+}
+
+// Truncate changes the size of the named file.
+func (n *NormalizeFS) Truncate(name string, size int64) error {
+	return n.base.Truncate(n.normalize(name), size)
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+func (n *NormalizeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return n.base.ReadDir(n.normalize(name))
+}
+
+// Lstat returns a FileInfo describing the named file without following symlinks.
+func (n *NormalizeFS) Lstat(name string) (fs.FileInfo, error) {
+	return n.base.Lstat(n.normalize(name))
+}
+
+// Symlink creates a symlink at newname that points to oldname.
+// The separators of the link target are replaced but the target is not cleaned,
+// as cleaning changes the meaning of relative targets that traverse other symlinks.
+func (n *NormalizeFS) Symlink(oldname, newname string) error {
+	return n.base.Symlink(normalizeSeparators(oldname), n.normalize(newname))
+}
+
+// SymlinkWithType creates a symlink of the given type, see TypedSymlinker.
+func (n *NormalizeFS) SymlinkWithType(oldname, newname string, typ LinkType) error {
+	return symlinkWithType(n.base, normalizeSeparators(oldname), n.normalize(newname), typ)
+}
+
+// Readlink returns the target of the symlink.
+func (n *NormalizeFS) Readlink(name string) (string, error) {
+	return n.base.Readlink(n.normalize(name))
+}
+
+// Lchown changes the uid and gid of the named file without following symlinks.
+func (n *NormalizeFS) Lchown(name string, uid, gid int) error {
+	return n.base.Lchown(n.normalize(name), uid, gid)
+}
+
+// ListXattr returns the names of the extended attributes of the named file, see Xattrer.
+func (n *NormalizeFS) ListXattr(name string) ([]string, error) {
+	return ListXattr(n.base, n.normalize(name))
+}
+
+// GetXattr returns the value of the extended attribute of the named file.
+func (n *NormalizeFS) GetXattr(name, attr string) ([]byte, error) {
+	return GetXattr(n.base, n.normalize(name), attr)
+}
+
+// SetXattr sets the value of the extended attribute of the named file.
+func (n *NormalizeFS) SetXattr(name, attr string, value []byte) error {
+	return SetXattr(n.base, n.normalize(name), attr, value)
+}
+
+// GetACL returns the POSIX ACL of the named file, see ACLer.
+func (n *NormalizeFS) GetACL(name string, typ ACLType) (ACL, error) {
+	return GetACL(n.base, n.normalize(name), typ)
+}
+
+// SetACL sets the POSIX ACL of the named file, a nil ACL removes it.
+func (n *NormalizeFS) SetACL(name string, typ ACLType, acl ACL) error {
+	return SetACL(n.base, n.normalize(name), typ, acl)
+}
+
+// GetFileAttributes returns the Windows file attributes of the named file, see FileAttributer.
+func (n *NormalizeFS) GetFileAttributes(name string) (FileAttributes, error) {
+	return GetFileAttributes(n.base, n.normalize(name))
+}
+
+// SetFileAttributes sets the Windows file attributes of the named file.
+func (n *NormalizeFS) SetFileAttributes(name string, attrs FileAttributes) error {
+	return SetFileAttributes(n.base, n.normalize(name), attrs)
+}
+
+// GetDACL returns the DACL of the named file, see DACLer.
+func (n *NormalizeFS) GetDACL(name string) (string, error) {
+	return GetDACL(n.base, n.normalize(name))
+}
+
+// SetDACL sets the DACL of the named file.
+func (n *NormalizeFS) SetDACL(name string, sddl string) error {
+	return SetDACL(n.base, n.normalize(name), sddl)
+}
+
+// OSPath returns the path of the named file in the filesystem of the operating system, see OSPather.
+func (n *NormalizeFS) OSPath(name string) (string, error) {
+	return OSPath(n.base, n.normalize(name))
+}
@@ -0,0 +1,43 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func FuzzNormalizeFS_Normalize(f *testing.F) {
+	for _, seed := range []string{".", "/", "..", "\\", `/Program Data\x`, `C:\a/b`, `\\server\share/x`, `a\..\..\b`, "/var//opt/./backups/"} {
+		f.Add(seed)
+	}
+
+	var (
+		fsys        = NewNormalizeFS(NewOSFS())
+		hiddenPaths = []string{fsys.normalize("/var/opt/backups")}
+	)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		require := require.New(t)
+
+		normalized := fsys.normalize(input)
+		require.Equal(normalized, fsys.normalize(normalized), "normalization must be idempotent")
+
+		// the other separator must not be present after normalization
+		other := "/"
+		if filepath.Separator == '/' {
+			other = `\`
+		}
+		require.Falsef(strings.Contains(normalized, other), "normalized path contains %q: %s", other, normalized)
+
+		// both separators must yield the same result and thus the same hidden path check
+		swapped := fsys.normalize(strings.NewReplacer("/", `\`, `\`, "/").Replace(input))
+		require.Equal(normalized, swapped)
+
+		hidden, err := isHidden(normalized, hiddenPaths)
+		swappedHidden, swappedErr := isHidden(swapped, hiddenPaths)
+		require.Equal(err == nil, swappedErr == nil)
+		require.Equal(hidden, swappedHidden)
+	})
+}
@@ -0,0 +1,51 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeFS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/base/backup"
+	)
+	_, base, _, _ := NewTestBackupFS(basePrefix, backupPrefix)
+
+	s, err := Chain(base,
+		HiddenLayer("/backup"),
+		BackupLayer(NewPrefixFS(base, "/backup")),
+		NormalizeLayer(),
+	)
+	require.NoError(err)
+
+	createFile(t, base, "/Program Data/x/file.txt", "original")
+
+	// mixed separators must result in the same tracked paths
+	createFile(t, s.Top, `/Program Data\x\file.txt`, "modified")
+	createFile(t, s.Top, `\Program Data/x/file.txt`, "modified again")
+	require.Equal([]string{
+		filepath.FromSlash("/"),
+		filepath.FromSlash("/Program Data"),
+		filepath.FromSlash("/Program Data/x"),
+		filepath.FromSlash("/Program Data/x/file.txt"),
+	}, s.Backup.TrackedPaths())
+
+	// hidden paths cannot be reached with backslashes
+	_, err = s.Top.Stat(`\backup\Program Data`)
+	require.ErrorIs(err, ErrHiddenNotExist)
+
+	require.NoError(s.Top.Symlink(`..\x\file.txt`, `/Program Data\link`))
+	target, err := s.Top.Readlink("/Program Data/link")
+	require.NoError(err)
+	require.Equal(filepath.FromSlash("../x/file.txt"), target)
+
+	require.NoError(s.Backup.Rollback())
+	fileMustContainText(t, base, "/Program Data/x/file.txt", "original")
+	mustNotExist(t, base, "/Program Data/link")
+}
@@ -0,0 +1,63 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// assert interfaces implemented
+var (
+	_ FS = (*noSymlinkFS)(nil)
+)
+
+// AdaptNoSymlinkFS wraps a filesystem that does not support symlinks.
+// Lstat falls back to Stat and Lchown falls back to Chown, as there cannot be any symlinks.
+// Symlink and Readlink are never passed to the wrapped filesystem and consistently return
+// errors that wrap errors.ErrUnsupported.
+//
+// A BackupFS whose base filesystem is wrapped this way does not look for symlinks
+// when resolving paths, see SupportsSymlinks.
+func AdaptNoSymlinkFS(fsys FS) FS {
+	return &noSymlinkFS{FS: fsys}
+}
+
+// SupportsSymlinks returns false in case that any filesystem in the layer stack of fsys
+// has been wrapped with AdaptNoSymlinkFS.
+func SupportsSymlinks(fsys FS) bool {
+	var ns *noSymlinkFS
+	return !As(fsys, &ns)
+}
+
+type noSymlinkFS struct {
+	FS
+}
+
+// Name returns the name of the wrapped filesystem.
+func (n *noSymlinkFS) Name() string {
+	return fmt.Sprintf("NoSymlinkFS(%s)", n.FS.Name())
+}
+
+// Unwrap returns the wrapped filesystem.
+func (n *noSymlinkFS) Unwrap() FS {
+	return n.FS
+}
+
+// Lstat returns the same as Stat, as there are no symlinks to be described.
+func (n *noSymlinkFS) Lstat(name string) (fs.FileInfo, error) {
+	return n.FS.Stat(name)
+}
+
+func (n *noSymlinkFS) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+}
+
+func (n *noSymlinkFS) Readlink(name string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+}
+
+// Lchown returns the same as Chown, as there are no symlinks to be changed.
+func (n *noSymlinkFS) Lchown(name string, uid int, gid int) error {
+	return n.FS.Chown(name, uid, gid)
+}
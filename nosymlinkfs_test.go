@@ -0,0 +1,56 @@
+package backupfs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptNoSymlinkFS(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, _ := NewTestBackupFS("/base", "/backup")
+	require.True(SupportsSymlinks(base))
+
+	createFile(t, base, "/test/file.txt", "text")
+	createSymlink(t, base, "/test/file.txt", "/test/link")
+
+	fsys := AdaptNoSymlinkFS(base)
+	require.False(SupportsSymlinks(fsys))
+	require.False(SupportsSymlinks(NewPrefixFS(fsys, "/test")))
+
+	fi, err := fsys.Lstat("/test/link")
+	require.NoError(err)
+	require.True(fi.Mode().IsRegular(), "Lstat must follow symlinks like Stat")
+
+	_, err = fsys.Readlink("/test/link")
+	require.ErrorIs(err, errors.ErrUnsupported)
+
+	err = fsys.Symlink("/test/file.txt", "/test/other")
+	require.ErrorIs(err, errors.ErrUnsupported)
+	mustNotExist(t, base, "/test/other")
+}
+
+func TestBackupFS_NoSymlinkBase(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, backup, _ := NewTestBackupFS("/base", "/backup")
+	backupFS := NewBackupFS(AdaptNoSymlinkFS(base), backup)
+
+	createFile(t, base, "/test/file.txt", "text")
+
+	createFile(t, backupFS, "/test/file.txt", "text_new")
+	createFile(t, backupFS, "/test/sub/new.txt", "new")
+	fileMustContainText(t, backup, "/test/file.txt", "text")
+
+	err := backupFS.Symlink("/test/file.txt", "/test/link")
+	require.ErrorIs(err, errors.ErrUnsupported)
+	mustNotExist(t, backup, "/test/link")
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, "/test/file.txt", "text")
+	mustNotExist(t, base, "/test/sub")
+}
@@ -1,13 +1,19 @@
 package backupfs
 
 import (
+	"errors"
 	"io/fs"
 	"os"
 	"time"
 )
 
 var (
-	_ FS = (*OSFS)(nil)
+	_ FS             = (*OSFS)(nil)
+	_ Xattrer        = (*OSFS)(nil)
+	_ ACLer          = (*OSFS)(nil)
+	_ FileAttributer = (*OSFS)(nil)
+	_ DACLer         = (*OSFS)(nil)
+	_ OSPather       = (*OSFS)(nil)
 )
 
 func NewOSFS() OSFS {
@@ -135,6 +141,24 @@ func (OSFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	}
 	return nil
 }
+
+// Truncate changes the size of the named file.
+func (OSFS) Truncate(name string, size int64) error {
+	err := os.Truncate(name, size)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
 func (OSFS) Lstat(name string) (fs.FileInfo, error) {
 	fi, err := os.Lstat(name)
 	if err != nil {
@@ -149,6 +173,13 @@ func (OSFS) Symlink(oldname, newname string) error {
 	}
 	return nil
 }
+
+// SymlinkWithType creates a symlink of the given type.
+// On Windows directory links are created with the directory flag and without requiring
+// elevated privileges in case that the Developer Mode is enabled.
+func (OSFS) SymlinkWithType(oldname, newname string, typ LinkType) error {
+	return osSymlinkWithType(oldname, newname, typ)
+}
 func (OSFS) Readlink(name string) (string, error) {
 	link, err := os.Readlink(name)
 	if err != nil {
@@ -165,3 +196,72 @@ func (OSFS) Lchown(name string, uid int, gid int) error {
 	}
 	return nil
 }
+
+// ListXattr returns the names of the extended attributes of the named file, see Xattrer.
+func (OSFS) ListXattr(name string) ([]string, error) {
+	return osListXattr(name)
+}
+
+// GetXattr returns the value of the extended attribute of the named file.
+func (OSFS) GetXattr(name, attr string) ([]byte, error) {
+	return osGetXattr(name, attr)
+}
+
+// SetXattr sets the value of the extended attribute of the named file.
+func (OSFS) SetXattr(name, attr string, value []byte) error {
+	return osSetXattr(name, attr, value)
+}
+
+// GetACL returns the POSIX ACL of the named file, see ACLer.
+// Returns a nil ACL in case that the file has no ACL.
+func (OSFS) GetACL(name string, typ ACLType) (ACL, error) {
+	data, err := osGetXattr(name, aclXattr(typ))
+	if errors.Is(err, errNoXattr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	acl, err := decodeACL(data)
+	if err != nil {
+		return nil, &fs.PathError{Op: "getacl", Path: name, Err: err}
+	}
+	return acl, nil
+}
+
+// SetACL sets the POSIX ACL of the named file, a nil ACL removes it.
+func (OSFS) SetACL(name string, typ ACLType, acl ACL) error {
+	if acl == nil {
+		err := osRemoveXattr(name, aclXattr(typ))
+		if errors.Is(err, errNoXattr) {
+			return nil
+		}
+		return err
+	}
+	return osSetXattr(name, aclXattr(typ), encodeACL(acl))
+}
+
+// GetFileAttributes returns the Windows file attributes of the named file, see FileAttributer.
+func (OSFS) GetFileAttributes(name string) (FileAttributes, error) {
+	return osGetFileAttributes(name)
+}
+
+// SetFileAttributes sets the Windows file attributes of the named file.
+func (OSFS) SetFileAttributes(name string, attrs FileAttributes) error {
+	return osSetFileAttributes(name, attrs)
+}
+
+// GetDACL returns the DACL of the named file, see DACLer.
+func (OSFS) GetDACL(name string) (string, error) {
+	return osGetDACL(name)
+}
+
+// SetDACL sets the DACL of the named file.
+func (OSFS) SetDACL(name string, sddl string) error {
+	return osSetDACL(name, sddl)
+}
+
+// OSPath returns the name itself, see OSPather.
+func (OSFS) OSPath(name string) (string, error) {
+	return name, nil
+}
@@ -0,0 +1,166 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tricky path cases that have caused bugs in the past
+var pathFuzzSeeds = []string{
+	"", ".", "/", "..", "\\", "//", "/..", "/../..",
+	"a", "a/b", "./a/../b",
+	"/a/b/file.txt", "/a/b/../b/file.txt", "/a//b///file.txt/",
+	"/link/b/file.txt", "/rel/file.txt", "/up/a/b", "/dotdot/a",
+	"/loop1", "/loop1/file.txt", "/self/self/self",
+	"/var/opt/backups", "/var/opt/backups_sibling", "/var/opt/backups/../backups/x", "/var/opt/backup",
+	`C:\a\b`, `C:a`, `\\server\share\x`, `\\?\C:\a`, `/Program Data\x`,
+}
+
+// newFuzzMemFS creates an in-memory filesystem with relative, absolute and circular symlinks.
+func newFuzzMemFS(t testing.TB) *MemFS {
+	fsys := NewMemFS()
+	for _, dir := range []string{"/a/b", "/var/opt/backups/sub", "/var/opt/backups_sibling"} {
+		require.NoError(t, fsys.MkdirAll(filepath.FromSlash(dir), 0755))
+	}
+	f, err := fsys.Create(filepath.FromSlash("/a/b/file.txt"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	for newname, oldname := range map[string]string{
+		"/link":   "/a",
+		"/rel":    "a/b",
+		"/up":     "a/..",
+		"/dotdot": "../../..",
+		"/loop1":  "/loop2",
+		"/loop2":  "/loop1",
+		"/self":   ".",
+		"/a/back": "/var/opt/backups",
+	} {
+		require.NoError(t, fsys.Symlink(filepath.FromSlash(oldname), filepath.FromSlash(newname)))
+	}
+	return fsys
+}
+
+func addPathFuzzSeeds(f *testing.F) {
+	for _, seed := range pathFuzzSeeds {
+		f.Add(seed)
+	}
+}
+
+func FuzzResolvePath(f *testing.F) {
+	addPathFuzzSeeds(f)
+	fsys := newFuzzMemFS(f)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		if len(input) > 256 {
+			return
+		}
+		require := require.New(t)
+		name := normalizePath(input)
+
+		resolved, err := resolvePath(fsys, name)
+		if err != nil {
+			return
+		}
+
+		// the resolved path must point to the same file as the original path
+		expected, err := fsys.Lstat(name)
+		if err != nil {
+			return
+		}
+		actual, err := fsys.Lstat(resolved)
+		require.NoErrorf(err, "resolved path %q of %q does not exist", resolved, name)
+		require.Equal(expected.Mode(), actual.Mode())
+		require.Equal(expected.Name(), actual.Name())
+	})
+}
+
+// isHiddenReference is a component based reference implementation of isHidden
+// for absolute paths.
+func isHiddenReference(name, hidden string) bool {
+	nameParts := splitMemPath(name)
+	hiddenParts := splitMemPath(hidden)
+	if len(nameParts) < len(hiddenParts) {
+		return false
+	}
+	for i, p := range hiddenParts {
+		if nameParts[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzIsHidden(f *testing.F) {
+	addPathFuzzSeeds(f)
+	hiddenDir := normalizePath("/var/opt/backups")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		name := normalizePath(input)
+		if !filepath.IsAbs(name) || strings.Contains(name, "..") {
+			return
+		}
+
+		hidden, err := isHidden(name, []string{hiddenDir})
+		require.NoError(t, err)
+		require.Equalf(t, isHiddenReference(name, hiddenDir), hidden, "hidden check of %q", name)
+	})
+}
+
+func FuzzPrefixFS_PrefixPath(f *testing.F) {
+	addPathFuzzSeeds(f)
+
+	var (
+		prefix = normalizePath("/var/opt")
+		fsys   = NewPrefixFS(newFuzzMemFS(f), prefix)
+	)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p, err := fsys.prefixPath(input)
+		if err != nil {
+			require.ErrorIs(t, err, ErrPathEscapesPrefix)
+			return
+		}
+		require.Truef(t, hasPathPrefix(p, prefix), "path %q escapes prefix %q", p, prefix)
+	})
+}
+
+func FuzzIterateDirTree(f *testing.F) {
+	addPathFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		require := require.New(t)
+		name := normalizePath(input)
+
+		visited := make([]string, 0, strings.Count(name, separator)+1)
+		aborted, err := IterateDirTree(name, func(subdir string) (bool, error) {
+			visited = append(visited, subdir)
+			return true, nil
+		})
+		require.NoError(err)
+		require.False(aborted)
+		require.NotEmpty(visited)
+
+		// every visited path is a parent directory of the next one
+		for i, p := range visited {
+			require.Truef(strings.HasPrefix(name, p), "%q is not a prefix of %q", p, name)
+			if i > 0 {
+				require.Greater(len(p), len(visited[i-1]))
+			}
+		}
+		require.Equal(name, visited[len(visited)-1])
+
+		// aborting stops the iteration
+		cnt := 0
+		aborted, err = IterateDirTree(name, func(string) (bool, error) {
+			cnt++
+			return false, nil
+		})
+		require.NoError(err)
+		require.True(aborted)
+		require.Equal(1, cnt)
+	})
+}
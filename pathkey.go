@@ -0,0 +1,90 @@
+package backupfs
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UnicodeForm is the Unicode normal form that paths are compared in, see WithUnicodeNormalization.
+// macOS creates file names in the decomposed form (NFD), while most other systems create them
+// in the composed form (NFC), which is why the same name may be encoded differently in a tree
+// that was copied between them.
+type UnicodeForm int
+
+const (
+	// UnicodeFormNone compares paths byte by byte.
+	UnicodeFormNone UnicodeForm = iota
+	// UnicodeFormNFC compares paths in the canonical composed form.
+	UnicodeFormNFC
+	// UnicodeFormNFD compares paths in the canonical decomposed form.
+	UnicodeFormNFD
+)
+
+func (f UnicodeForm) String() string {
+	switch f {
+	case UnicodeFormNone:
+		return "none"
+	case UnicodeFormNFC:
+		return "nfc"
+	case UnicodeFormNFD:
+		return "nfd"
+	default:
+		return fmt.Sprintf("unicode_form(%d)", int(f))
+	}
+}
+
+// normalize returns name in the normal form f.
+func (f UnicodeForm) normalize(name string) string {
+	switch f {
+	case UnicodeFormNFC:
+		return norm.NFC.String(name)
+	case UnicodeFormNFD:
+		return norm.NFD.String(name)
+	default:
+		return name
+	}
+}
+
+// foldPath returns the case folded form of a path that is used in order to compare paths
+// of case-insensitive filesystems, e.g. NTFS or APFS by default.
+func foldPath(name string) string {
+	return strings.ToLower(name)
+}
+
+// pathKeys derives the keys that paths are compared with, different spellings of the same path
+// have the same key. The zero value compares paths as they are.
+type pathKeys struct {
+	caseInsensitive bool
+	form            UnicodeForm
+}
+
+// exact is true in case that the key of a path is the path itself.
+func (k pathKeys) exact() bool {
+	return !k.caseInsensitive && k.form == UnicodeFormNone
+}
+
+func (k pathKeys) key(name string) string {
+	name = k.form.normalize(name)
+	if k.caseInsensitive {
+		name = foldPath(name)
+	}
+	return name
+}
+
+// trimPrefix removes the prefix directory from name in case that a leading part of name,
+// which ends at a path separator, has the same key as prefix.
+// The spelling of the prefix in name may differ in its length, e.g. in another normal form.
+func (k pathKeys) trimPrefix(name, prefix string) (string, bool) {
+	prefixKey := k.key(prefix)
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && name[i] != separator[0] {
+			continue
+		}
+		if k.key(name[:i]) == prefixKey {
+			return name[i:], true
+		}
+	}
+	return name, false
+}
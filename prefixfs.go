@@ -1,7 +1,10 @@
 package backupfs
 
 import (
+	"errors"
+	"fmt"
 	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,9 +12,21 @@ import (
 	"time"
 )
 
-// assert interfaces implemented
 var (
-	_ FS = (*PrefixFS)(nil)
+	// assert interfaces implemented
+	_ FS             = (*PrefixFS)(nil)
+	_ Xattrer        = (*PrefixFS)(nil)
+	_ ACLer          = (*PrefixFS)(nil)
+	_ FileAttributer = (*PrefixFS)(nil)
+	_ DACLer         = (*PrefixFS)(nil)
+	_ OSPather       = (*PrefixFS)(nil)
+
+	// ErrPathEscapesPrefix is returned in case that a path would escape the prefix of a PrefixFS,
+	// e.g. via directory traversal. It wraps syscall.EPERM for backwards compatibility.
+	ErrPathEscapesPrefix = fmt.Errorf("path escapes prefix: %w", syscall.EPERM)
+
+	// ErrInvalidPrefix is returned by NewPrefixFSWithOptions in case that the prefix does not pass the validation.
+	ErrInvalidPrefix = errors.New("invalid prefix")
 )
 
 // NewPrefixFS creates a new file system abstraction that forces any path to be prepended with
@@ -25,11 +40,94 @@ func NewPrefixFS(fs FS, prefixPath string) *PrefixFS {
 	}
 }
 
+// PrefixFSOption configures NewPrefixFSWithOptions.
+type PrefixFSOption func(*prefixFSOptions)
+
+type prefixFSOptions struct {
+	requireExisting bool
+	create          bool
+	keys            pathKeys
+	logger          *slog.Logger
+	limits          symlinkLimits
+}
+
+// WithCaseInsensitivePrefix matches the prefix of absolute symlink targets case-insensitively,
+// which is required for case-insensitive base filesystems, e.g. NTFS or APFS by default.
+// Otherwise Readlink returns targets that were created with a different case of the prefix
+// including the prefix.
+func WithCaseInsensitivePrefix() PrefixFSOption {
+	return func(o *prefixFSOptions) {
+		o.keys.caseInsensitive = true
+	}
+}
+
+// WithPrefixUnicodeNormalization matches the prefix of absolute symlink targets in the Unicode normal form,
+// which is required for trees with names in mixed normal forms, e.g. copied from macOS.
+func WithPrefixUnicodeNormalization(form UnicodeForm) PrefixFSOption {
+	return func(o *prefixFSOptions) {
+		o.keys.form = form
+	}
+}
+
+// WithPrefixSymlinkLimits caps the length of symlink targets and the number of symlinks that are followed
+// in order to resolve a path as defense in depth for untrusted content, e.g. third party plugin installations.
+// Exceeding a limit results in a SymlinkLimitError, a value <= 0 disables the respective limit.
+func WithPrefixSymlinkLimits(maxTargetLength, maxDepth int) PrefixFSOption {
+	return func(o *prefixFSOptions) {
+		o.limits = symlinkLimits{maxTargetLength: maxTargetLength, maxDepth: maxDepth}
+	}
+}
+
+// WithPrefixLogger sets the logger that receives the debug logs of the path resolution.
+// The default logger of the slog package is used by default.
+func WithPrefixLogger(l *slog.Logger) PrefixFSOption {
+	return func(o *prefixFSOptions) {
+		o.logger = l
+	}
+}
+
+// WithRequireExistingPrefix verifies that the prefix is an existing directory of the wrapped filesystem
+// upon construction. In case that create is true, a missing prefix directory is created instead.
+// Otherwise a missing prefix only surfaces with the first operation as a confusing error of a path
+// that the user of the PrefixFS never passed.
+func WithRequireExistingPrefix(create bool) PrefixFSOption {
+	return func(o *prefixFSOptions) {
+		o.requireExisting = true
+		o.create = create
+	}
+}
+
+// NewPrefixFSWithOptions creates a PrefixFS like NewPrefixFS, but returns an error that wraps ErrInvalidPrefix
+// in case that the prefix does not pass the configured validation, see WithRequireExistingPrefix.
+func NewPrefixFSWithOptions(fsys FS, prefixPath string, opts ...PrefixFSOption) (*PrefixFS, error) {
+	var o prefixFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := NewPrefixFS(fsys, prefixPath)
+	s.logger = o.logger
+	s.limits = o.limits
+	s.keys = o.keys
+	if o.requireExisting {
+		err := requireDir(fsys, s.prefix, o.create)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidPrefix, prefixPath, err)
+		}
+	}
+	return s, nil
+}
+
 // PrefixFS, contrary to BasePathFS, does abstract away the existence of a base path.
 // The prefixed path is seen as the root directory.
 type PrefixFS struct {
 	prefix string
 	base   FS
+	// nil uses the default logger of the slog package
+	logger *slog.Logger
+	limits symlinkLimits
+	// keys of the prefix of symlink targets, see WithCaseInsensitivePrefix
+	keys pathKeys
 }
 
 func (s *PrefixFS) prefixPath(name string) (string, error) {
@@ -44,17 +142,49 @@ func (s *PrefixFS) prefixPath(name string) (string, error) {
 		name = filepath.Join(volumeName, nameWithoutVolume)
 	}
 
-	p := filepath.Join(s.prefix, filepath.Clean(name))
-	if !strings.HasPrefix(p, s.prefix) {
-		return "", syscall.EPERM
+	p := filepath.Join(s.prefix, normalizePath(name))
+	if !hasPathPrefix(p, s.prefix) {
+		loggerOrDefault(s.logger).Debug("path escapes prefix", "path", name, "prefix", s.prefix)
+		return "", ErrPathEscapesPrefix
+	}
+	loggerOrDefault(s.logger).Debug("prefixed path", "path", name, "prefixed", p)
+
+	err := s.limits.checkDepth(s.base, name, p, false)
+	if err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// targetPath is prefixPath for operations that follow a symlink at name.
+func (s *PrefixFS) targetPath(name string) (string, error) {
+	p, err := s.prefixPath(name)
+	if err != nil {
+		return "", err
+	}
+	err = s.limits.checkDepth(s.base, name, p, true)
+	if err != nil {
+		return "", err
 	}
 	return p, nil
 }
 
+// hasPathPrefix checks whether name is equal to or located inside of the prefix directory.
+// Both paths are expected to be cleaned.
+func hasPathPrefix(name, prefix string) bool {
+	if name == prefix {
+		return true
+	}
+	if !strings.HasSuffix(prefix, separator) {
+		prefix += separator
+	}
+	return strings.HasPrefix(name, prefix)
+}
+
 // Create creates a file in the filesystem, returning the file and an
 // error, if any happens.
 func (s *PrefixFS) Create(name string) (File, error) {
-	path, err := s.prefixPath(name)
+	path, err := s.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "create", Path: name, Err: err}
 	}
@@ -98,7 +228,7 @@ func (s *PrefixFS) MkdirAll(name string, perm fs.FileMode) error {
 // Open opens a file, returning it or an error, if any happens.
 // This returns a ready only file
 func (s *PrefixFS) Open(name string) (File, error) {
-	path, err := s.prefixPath(name)
+	path, err := s.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
@@ -113,7 +243,7 @@ func (s *PrefixFS) Open(name string) (File, error) {
 
 // OpenFile opens a file using the given flags and the given mode.
 func (s *PrefixFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
-	path, err := s.prefixPath(name)
+	path, err := s.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "open_file", Path: name, Err: err}
 	}
@@ -176,17 +306,14 @@ func (s *PrefixFS) Rename(oldname, newname string) error {
 // Stat returns a FileInfo describing the named file, or an error, if any
 // happens.
 func (s *PrefixFS) Stat(name string) (fs.FileInfo, error) {
-	path, err := s.prefixPath(name)
+	_, err := s.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
 	}
 
-	fi, err := s.base.Stat(path)
-	if err != nil {
-		return nil, err
-	}
-
-	return newPrefixFileInfo(fi, path, s.prefix), nil
+	// symlinks must not be resolved by the base filesystem,
+	// as absolute symlink targets are relative to the prefix.
+	return statResolved(s, name)
 }
 
 // The name of this FileSystem
@@ -194,11 +321,16 @@ func (s *PrefixFS) Name() string {
 	return "PrefixFS"
 }
 
+// Unwrap returns the filesystem that the prefix is applied to.
+func (s *PrefixFS) Unwrap() FS {
+	return s.base
+}
+
 // Chmod changes the mode of the named file to mode.
 func (s *PrefixFS) Chmod(name string, mode fs.FileMode) error {
-	path, err := s.prefixPath(name)
+	path, err := s.targetPath(name)
 	if err != nil {
-		return err
+		return &fs.PathError{Op: "chmod", Path: name, Err: err}
 	}
 
 	err = s.base.Chmod(path, mode)
@@ -210,7 +342,7 @@ func (s *PrefixFS) Chmod(name string, mode fs.FileMode) error {
 
 // Chown changes the uid and gid of the named file.
 func (s *PrefixFS) Chown(name string, uid, gid int) error {
-	path, err := s.prefixPath(name)
+	path, err := s.targetPath(name)
 	if err != nil {
 		return &fs.PathError{Op: "chown", Path: name, Err: err}
 	}
@@ -224,7 +356,7 @@ func (s *PrefixFS) Chown(name string, uid, gid int) error {
 
 // Chtimes changes the access and modification times of the named file
 func (s *PrefixFS) Chtimes(name string, atime, mtime time.Time) error {
-	path, err := s.prefixPath(name)
+	path, err := s.targetPath(name)
 	if err != nil {
 		return &fs.PathError{Op: "chtimes", Path: name, Err: err}
 	}
@@ -235,6 +367,31 @@ func (s *PrefixFS) Chtimes(name string, atime, mtime time.Time) error {
 	return nil
 }
 
+// Truncate changes the size of the named file.
+func (s *PrefixFS) Truncate(name string, size int64) error {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "truncate", Path: name, Err: err}
+	}
+
+	err = s.base.Truncate(path, size)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+func (s *PrefixFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	_, err := s.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	// the prefixed file removes the prefix from the returned file infos
+	return readDir(s, name)
+}
+
 // Lstat will call Lstat if the filesystem itself is, or it delegates to, the os filesystem.
 // Else it will call Stat.
 // In addtion to the FileInfo, it will return a boolean telling whether Lstat was called or not.
@@ -253,12 +410,22 @@ func (s *PrefixFS) Lstat(name string) (fs.FileInfo, error) {
 
 // Symlink changes the access and modification times of the named file
 func (s *PrefixFS) Symlink(oldname, newname string) error {
-	// links may be relative paths
+	return s.symlink(oldname, newname, LinkAuto)
+}
 
-	var (
-		err     error
-		oldPath string
-	)
+// SymlinkWithType creates a symlink of the given type, see TypedSymlinker.
+func (s *PrefixFS) SymlinkWithType(oldname, newname string, typ LinkType) error {
+	return s.symlink(oldname, newname, typ)
+}
+
+func (s *PrefixFS) symlink(oldname, newname string, typ LinkType) error {
+	err := s.limits.checkTarget(newname, oldname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+
+	// links may be relative paths
+	var oldPath string
 	if isAbs(oldname) {
 		// absolute path symlink
 		oldPath, err = s.prefixPath(oldname)
@@ -277,7 +444,7 @@ func (s *PrefixFS) Symlink(oldname, newname string) error {
 		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
 	}
 
-	err = s.base.Symlink(oldPath, newPath)
+	err = symlinkWithType(s.base, oldPath, newPath, typ)
 	if err != nil {
 		return err
 	}
@@ -297,6 +464,13 @@ func (s *PrefixFS) Readlink(name string) (string, error) {
 	cleanedPath := filepath.Clean(linkedPath)
 
 	prefixlessPath := strings.TrimPrefix(cleanedPath, s.prefix)
+	if prefixlessPath == cleanedPath && !s.keys.exact() {
+		prefixlessPath, _ = s.keys.trimPrefix(cleanedPath, s.prefix)
+	}
+	err = s.limits.checkTarget(name, prefixlessPath)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
 	return prefixlessPath, nil
 }
 
@@ -312,3 +486,93 @@ func (s *PrefixFS) Lchown(name string, uid, gid int) error {
 	}
 	return nil
 }
+
+// ListXattr returns the names of the extended attributes of the named file, see Xattrer.
+func (s *PrefixFS) ListXattr(name string) ([]string, error) {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	return ListXattr(s.base, path)
+}
+
+// GetXattr returns the value of the extended attribute of the named file.
+func (s *PrefixFS) GetXattr(name, attr string) ([]byte, error) {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	return GetXattr(s.base, path, attr)
+}
+
+// SetXattr sets the value of the extended attribute of the named file.
+func (s *PrefixFS) SetXattr(name, attr string, value []byte) error {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return SetXattr(s.base, path, attr, value)
+}
+
+// GetACL returns the POSIX ACL of the named file, see ACLer.
+func (s *PrefixFS) GetACL(name string, typ ACLType) (ACL, error) {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "getacl", Path: name, Err: err}
+	}
+	return GetACL(s.base, path, typ)
+}
+
+// SetACL sets the POSIX ACL of the named file, a nil ACL removes it.
+func (s *PrefixFS) SetACL(name string, typ ACLType, acl ACL) error {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setacl", Path: name, Err: err}
+	}
+	return SetACL(s.base, path, typ, acl)
+}
+
+// GetFileAttributes returns the Windows file attributes of the named file, see FileAttributer.
+func (s *PrefixFS) GetFileAttributes(name string) (FileAttributes, error) {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return 0, &fs.PathError{Op: "getfileattributes", Path: name, Err: err}
+	}
+	return GetFileAttributes(s.base, path)
+}
+
+// SetFileAttributes sets the Windows file attributes of the named file.
+func (s *PrefixFS) SetFileAttributes(name string, attrs FileAttributes) error {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setfileattributes", Path: name, Err: err}
+	}
+	return SetFileAttributes(s.base, path, attrs)
+}
+
+// GetDACL returns the DACL of the named file, see DACLer.
+func (s *PrefixFS) GetDACL(name string) (string, error) {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "getdacl", Path: name, Err: err}
+	}
+	return GetDACL(s.base, path)
+}
+
+// SetDACL sets the DACL of the named file.
+func (s *PrefixFS) SetDACL(name string, sddl string) error {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: err}
+	}
+	return SetDACL(s.base, path, sddl)
+}
+
+// OSPath returns the path of the named file in the filesystem of the operating system, see OSPather.
+func (s *PrefixFS) OSPath(name string) (string, error) {
+	path, err := s.targetPath(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "ospath", Path: name, Err: err}
+	}
+	return OSPath(s.base, path)
+}
@@ -2,10 +2,15 @@ package backupfs
 
 import (
 	"io/fs"
+	"os"
 	"strings"
+	"time"
 )
 
-var _ File = (*prefixFile)(nil)
+var (
+	_ File               = (*prefixFile)(nil)
+	_ FileMetadataSetter = (*prefixFile)(nil)
+)
 
 // filePath and prefix are expected to be normalized (filepath.Clean) paths
 func newPrefixFile(f File, filePath, prefix string) File {
@@ -53,6 +58,18 @@ func (pf *prefixFile) Sync() error {
 func (pf *prefixFile) Truncate(size int64) error {
 	return pf.f.Truncate(size)
 }
+func (pf *prefixFile) Chmod(mode fs.FileMode) error {
+	return fchmod(pf.f, mode)
+}
+func (pf *prefixFile) Chown(uid, gid int) error {
+	return fchown(pf.f, uid, gid)
+}
+func (pf *prefixFile) Chtimes(atime, mtime time.Time) error {
+	return fchtimes(pf.f, atime, mtime)
+}
+func (pf *prefixFile) unwrapOSFile() (*os.File, bool) {
+	return unwrapOSFile(pf.f)
+}
 func (pf *prefixFile) WriteString(s string) (ret int, err error) {
 	return pf.f.WriteString(s)
 }
@@ -0,0 +1,127 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixFS_PathEscapesPrefix(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	fsys := NewPrefixFS(NewOSFS(), "/some/prefix")
+
+	table := []struct {
+		name    string
+		escapes bool
+	}{
+		{"/", false},
+		{"/test.txt", false},
+		{"/../prefix_sibling", false}, // absolute paths are cleaned relative to the root
+		{"../test.txt", true},
+		{"test/../../test.txt", true},
+		{"../prefix_sibling", true}, // shares the prefix string but not the prefix directory
+	}
+
+	for _, row := range table {
+		p, err := fsys.prefixPath(row.name)
+		if row.escapes {
+			require.ErrorIs(err, ErrPathEscapesPrefix, row.name)
+			continue
+		}
+		require.NoError(err, row.name)
+		require.True(hasPathPrefix(p, fsys.prefix), p)
+	}
+
+	_, err := fsys.Stat("../prefix_sibling")
+	require.ErrorIs(err, ErrPathEscapesPrefix)
+	require.ErrorIs(err, syscall.EPERM, "must stay backwards compatible")
+	require.ErrorIs(err, fs.ErrPermission)
+	var pathErr *fs.PathError
+	require.True(errors.As(err, &pathErr))
+	require.Equal("stat", pathErr.Op)
+
+	require.True(hasPathPrefix(filepath.FromSlash("/some/prefix"), filepath.FromSlash("/some/prefix")))
+	require.True(hasPathPrefix(filepath.FromSlash("/some/prefix/a"), filepath.FromSlash("/some/prefix")))
+	require.False(hasPathPrefix(filepath.FromSlash("/some/prefix_sibling"), filepath.FromSlash("/some/prefix")))
+	require.False(hasPathPrefix(filepath.FromSlash("/some"), filepath.FromSlash("/some/prefix")))
+	require.True(hasPathPrefix(filepath.FromSlash("/a"), filepath.FromSlash("/")))
+}
+
+func TestPrefixFS_CaseInsensitivePrefix(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		link    = filepath.FromSlash("/prefix/link")
+	)
+	mkdirAll(t, base, "/prefix", 0755)
+	require.NoError(base.Symlink(filepath.FromSlash("/PREFIX/target.txt"), link))
+
+	pfs, err := NewPrefixFSWithOptions(base, "/prefix")
+	require.NoError(err)
+	target, err := pfs.Readlink("/link")
+	require.NoError(err)
+	require.Equal(filepath.FromSlash("/PREFIX/target.txt"), target)
+
+	pfs, err = NewPrefixFSWithOptions(base, "/prefix", WithCaseInsensitivePrefix())
+	require.NoError(err)
+	target, err = pfs.Readlink("/link")
+	require.NoError(err)
+	require.Equal(filepath.FromSlash("/target.txt"), target)
+}
+
+func TestPrefixFS_UnicodeNormalization(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		link    = filepath.FromSlash("/pr\u00e4fix/link")
+	)
+	mkdirAll(t, base, "/pr\u00e4fix", 0755)
+	require.NoError(base.Symlink(filepath.FromSlash("/pra\u0308fix/target.txt"), link))
+
+	for _, form := range []UnicodeForm{UnicodeFormNFC, UnicodeFormNFD} {
+		pfs, err := NewPrefixFSWithOptions(base, "/pr\u00e4fix", WithPrefixUnicodeNormalization(form))
+		require.NoError(err)
+		target, err := pfs.Readlink("/link")
+		require.NoError(err)
+		require.Equal(filepath.FromSlash("/target.txt"), target, form.String())
+	}
+}
+
+func TestNewPrefixFSWithOptions(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+	)
+	createFile(t, base, "/file.txt", "file")
+
+	_, err := NewPrefixFSWithOptions(base, "/missing")
+	require.NoError(err, "no validation without options")
+
+	_, err = NewPrefixFSWithOptions(base, "/missing", WithRequireExistingPrefix(false))
+	require.ErrorIs(err, ErrInvalidPrefix)
+	require.ErrorIs(err, fs.ErrNotExist)
+
+	_, err = NewPrefixFSWithOptions(base, "/file.txt", WithRequireExistingPrefix(true))
+	require.ErrorIs(err, ErrInvalidPrefix)
+	require.ErrorIs(err, syscall.ENOTDIR)
+
+	pfs, err := NewPrefixFSWithOptions(base, "/missing/prefix", WithRequireExistingPrefix(true))
+	require.NoError(err)
+	fi, err := base.Stat("/missing/prefix")
+	require.NoError(err)
+	require.True(fi.IsDir())
+	createFile(t, pfs, "/test.txt", "test")
+	fileMustContainText(t, base, "/missing/prefix/test.txt", "test")
+}
@@ -0,0 +1,158 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+// assert interfaces implemented
+var (
+	_ FS   = (*ReadOnlyFS)(nil)
+	_ File = (*readOnlyFile)(nil)
+)
+
+// NewReadOnlyFS creates a filesystem that passes all reading operations to base and
+// rejects all modifications with errors that wrap fs.ErrPermission, e.g. in order to guarantee that
+// the backup filesystem is not modified after a run or to freeze the base filesystem during inspections.
+func NewReadOnlyFS(base FS) *ReadOnlyFS {
+	return &ReadOnlyFS{base: base}
+}
+
+// ReadOnlyFS is a filesystem that cannot be modified.
+type ReadOnlyFS struct {
+	base FS
+}
+
+// Name returns the name of this FileSystem
+func (r *ReadOnlyFS) Name() string {
+	return "ReadOnlyFS"
+}
+
+// Unwrap returns the wrapped filesystem.
+func (r *ReadOnlyFS) Unwrap() FS {
+	return r.base
+}
+
+func readOnlyErr(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+}
+
+// Create is not permitted.
+func (r *ReadOnlyFS) Create(name string) (File, error) {
+	return nil, readOnlyErr("open", name)
+}
+
+// Mkdir is not permitted.
+func (r *ReadOnlyFS) Mkdir(name string, perm fs.FileMode) error {
+	return readOnlyErr("mkdir", name)
+}
+
+// MkdirAll is not permitted.
+func (r *ReadOnlyFS) MkdirAll(name string, perm fs.FileMode) error {
+	return readOnlyErr("mkdir", name)
+}
+
+// Open opens a file for reading.
+func (r *ReadOnlyFS) Open(name string) (File, error) {
+	return r.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file for reading. Any flag that would modify the file is not permitted.
+func (r *ReadOnlyFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, readOnlyErr("open", name)
+	}
+	f, err := r.base.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{File: f}, nil
+}
+
+// Remove is not permitted.
+func (r *ReadOnlyFS) Remove(name string) error {
+	return readOnlyErr("remove", name)
+}
+
+// RemoveAll is not permitted.
+func (r *ReadOnlyFS) RemoveAll(name string) error {
+	return readOnlyErr("removeall", name)
+}
+
+// Rename is not permitted.
+func (r *ReadOnlyFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrPermission}
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (r *ReadOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return r.base.Stat(name)
+}
+
+// Chmod is not permitted.
+func (r *ReadOnlyFS) Chmod(name string, mode fs.FileMode) error {
+	return readOnlyErr("chmod", name)
+}
+
+// Chown is not permitted.
+func (r *ReadOnlyFS) Chown(name string, uid, gid int) error {
+	return readOnlyErr("chown", name)
+}
+
+// Chtimes is not permitted.
+func (r *ReadOnlyFS) Chtimes(name string, atime, mtime time.Time) error {
+	return readOnlyErr("chtimes", name)
+}
+
+// Truncate is not permitted.
+func (r *ReadOnlyFS) Truncate(name string, size int64) error {
+	return readOnlyErr("truncate", name)
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+func (r *ReadOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return r.base.ReadDir(name)
+}
+
+// Lstat returns a FileInfo describing the named file without following symlinks.
+func (r *ReadOnlyFS) Lstat(name string) (fs.FileInfo, error) {
+	return r.base.Lstat(name)
+}
+
+// Symlink is not permitted.
+func (r *ReadOnlyFS) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrPermission}
+}
+
+// Readlink returns the target of the symlink.
+func (r *ReadOnlyFS) Readlink(name string) (string, error) {
+	return r.base.Readlink(name)
+}
+
+// Lchown is not permitted.
+func (r *ReadOnlyFS) Lchown(name string, uid, gid int) error {
+	return readOnlyErr("lchown", name)
+}
+
+// readOnlyFile rejects all writes, independent of the error that the wrapped file would return.
+type readOnlyFile struct {
+	File
+}
+
+func (f *readOnlyFile) Write(p []byte) (int, error) {
+	return 0, readOnlyErr("write", f.Name())
+}
+
+func (f *readOnlyFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, readOnlyErr("write", f.Name())
+}
+
+func (f *readOnlyFile) WriteString(s string) (int, error) {
+	return 0, readOnlyErr("write", f.Name())
+}
+
+func (f *readOnlyFile) Truncate(size int64) error {
+	return readOnlyErr("truncate", f.Name())
+}
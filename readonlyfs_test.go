@@ -0,0 +1,78 @@
+package backupfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyFS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		ro      = NewReadOnlyFS(base)
+	)
+
+	createFile(t, base, "/test/file.txt", "content")
+	createSymlink(t, base, "/test/file.txt", "/test/link")
+	initialState := createFSState(t, base, "/")
+
+	// reads pass through
+	fileMustContainText(t, ro, "/test/link", "content")
+	target, err := ro.Readlink("/test/link")
+	require.NoError(err)
+	require.Equal("/test/file.txt", target)
+	fi, err := ro.Lstat("/test/link")
+	require.NoError(err)
+	require.NotZero(fi.Mode() & fs.ModeSymlink)
+	entries, err := ro.ReadDir("/test")
+	require.NoError(err)
+	require.Len(entries, 2)
+
+	f, err := ro.Open("/test")
+	require.NoError(err)
+	names, err := f.Readdirnames(-1)
+	require.NoError(err)
+	require.ElementsMatch([]string{"file.txt", "link"}, names)
+	require.NoError(f.Close())
+
+	// modifications are rejected
+	for _, flag := range []int{os.O_WRONLY, os.O_RDWR, os.O_RDONLY | os.O_APPEND, os.O_RDONLY | os.O_CREATE, os.O_RDONLY | os.O_TRUNC} {
+		_, err = ro.OpenFile("/test/file.txt", flag, 0644)
+		require.ErrorIs(err, fs.ErrPermission)
+	}
+	_, err = ro.Create("/test/new.txt")
+	require.ErrorIs(err, fs.ErrPermission)
+
+	require.ErrorIs(ro.Mkdir("/test/dir", 0755), fs.ErrPermission)
+	require.ErrorIs(ro.MkdirAll("/test/dir", 0755), fs.ErrPermission)
+	require.ErrorIs(ro.Remove("/test/file.txt"), fs.ErrPermission)
+	require.ErrorIs(ro.RemoveAll("/test"), fs.ErrPermission)
+	require.ErrorIs(ro.Rename("/test/file.txt", "/test/renamed.txt"), fs.ErrPermission)
+	require.ErrorIs(ro.Chmod("/test/file.txt", 0600), fs.ErrPermission)
+	require.ErrorIs(ro.Chown("/test/file.txt", 0, 0), fs.ErrPermission)
+	require.ErrorIs(ro.Lchown("/test/link", 0, 0), fs.ErrPermission)
+	require.ErrorIs(ro.Chtimes("/test/file.txt", time.Now(), time.Now()), fs.ErrPermission)
+	require.ErrorIs(ro.Truncate("/test/file.txt", 0), fs.ErrPermission)
+	require.ErrorIs(ro.Symlink("/test/file.txt", "/test/link2"), fs.ErrPermission)
+
+	f, err = ro.Open("/test/file.txt")
+	require.NoError(err)
+	_, err = f.Write([]byte("x"))
+	require.ErrorIs(err, fs.ErrPermission)
+	_, err = f.WriteAt([]byte("x"), 0)
+	require.ErrorIs(err, fs.ErrPermission)
+	require.ErrorIs(f.Truncate(0), fs.ErrPermission)
+	data, err := io.ReadAll(f)
+	require.NoError(err)
+	require.Equal("content", string(data))
+	require.NoError(f.Close())
+
+	mustEqualFSState(t, initialState, base, "/")
+}
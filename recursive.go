@@ -0,0 +1,94 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// ChmodAll changes the mode of root and of every file and directory below it, like chmod -R.
+// Directories get dirMode, all other files get fileMode. Symlinks are skipped, as their mode
+// cannot be changed and Chmod would change the mode of their targets.
+//
+// All changes are applied via fsys, which is why every modified path is backed up
+// in case that fsys is a BackupFS.
+// Directories are changed after their content, most nested first, in order for
+// restrictive directory modes not to prevent the traversal.
+func ChmodAll(fsys FS, root string, dirMode, fileMode fs.FileMode) error {
+	files, dirs, _, err := collectTree(fsys, root)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		err = fsys.Chmod(path, fileMode)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range dirs {
+		err = fsys.Chmod(path, dirMode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChownAll changes the owner of root and of every file and directory below it, like chown -R.
+// Symlinks themselves are changed with Lchown, their targets are not touched.
+//
+// All changes are applied via fsys, which is why every modified path is backed up
+// in case that fsys is a BackupFS.
+func ChownAll(fsys FS, root string, uid, gid int) error {
+	files, dirs, symlinks, err := collectTree(fsys, root)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		err = fsys.Chown(path, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range dirs {
+		err = fsys.Chown(path, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range symlinks {
+		err = fsys.Lchown(path, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectTree walks the tree at root before any of it is modified.
+// dirs are sorted most nested first.
+func collectTree(fsys FS, root string) (files, dirs, symlinks []string, err error) {
+	err = Walk(fsys, root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			dirs = append(dirs, path)
+		case mode&os.ModeSymlink != 0:
+			symlinks = append(symlinks, path)
+		default:
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	sort.Sort(ByMostFilePathSeparators(dirs))
+	return files, dirs, symlinks, nil
+}
@@ -0,0 +1,70 @@
+package backupfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChmodAll(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, backup, backupFS := NewTestBackupFS("/base", "/backup")
+
+	createFile(t, base, "/test/a.txt", "a")
+	createFile(t, base, "/test/sub/b.txt", "b")
+	createSymlink(t, base, "/test/a.txt", "/test/link")
+	require.NoError(base.Chmod("/test/a.txt", 0o644))
+	require.NoError(base.Chmod("/test/sub", 0o755))
+
+	// restrictive directory modes must not prevent the traversal
+	require.NoError(ChmodAll(backupFS, "/test", 0o300, 0o600))
+
+	for path, mode := range map[string]os.FileMode{
+		"/test/a.txt":     0o600,
+		"/test/sub/b.txt": 0o600,
+		"/test/sub":       0o300,
+		"/test":           0o300,
+	} {
+		fi, err := base.Lstat(path)
+		require.NoError(err)
+		modeMustBeEqual(t, mode, fi.Mode())
+	}
+
+	fi, err := backup.Lstat("/test/a.txt")
+	require.NoError(err)
+	modeMustBeEqual(t, 0o644, fi.Mode())
+
+	// symlinks are skipped
+	require.False(backupFS.alreadySeen(filepath.FromSlash("/test/link")))
+
+	require.NoError(backupFS.Rollback())
+	fi, err = base.Lstat("/test/sub")
+	require.NoError(err)
+	modeMustBeEqual(t, 0o755, fi.Mode())
+	fileMustContainText(t, base, "/test/sub/b.txt", "b")
+}
+
+func TestChownAll(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, backupFS := NewTestBackupFS("/base", "/backup")
+
+	createFile(t, base, "/test/a.txt", "a")
+	createFile(t, base, "/test/sub/b.txt", "b")
+	createSymlink(t, base, "/test/a.txt", "/test/link")
+
+	fi, err := base.Lstat("/test/a.txt")
+	require.NoError(err)
+
+	require.NoError(ChownAll(backupFS, "/test", toUID(fi), toGID(fi)))
+
+	for _, path := range []string{"/test", "/test/a.txt", "/test/sub", "/test/sub/b.txt", "/test/link"} {
+		require.True(backupFS.alreadySeen(filepath.FromSlash(path)), path)
+	}
+	symlinkMustExistWithTragetPath(t, base, "/test/link", "/test/a.txt")
+}
@@ -0,0 +1,90 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	// ErrReflinkUnsupported is returned in case that WithReflink(ReflinkAlways) is configured
+	// but a file cannot be cloned, e.g. because the filesystem does not support it.
+	ErrReflinkUnsupported = errors.New("reflink not supported")
+)
+
+// ReflinkMode decides whether files are cloned instead of copied, see WithReflink.
+type ReflinkMode int
+
+const (
+	// ReflinkNever always copies the content of files.
+	ReflinkNever ReflinkMode = iota
+	// ReflinkAuto clones files in case that both filesystems support it and copies them otherwise.
+	ReflinkAuto
+	// ReflinkAlways clones files and fails with ErrReflinkUnsupported in case that this is not possible.
+	ReflinkAlways
+)
+
+func (m ReflinkMode) String() string {
+	switch m {
+	case ReflinkNever:
+		return "never"
+	case ReflinkAuto:
+		return "auto"
+	case ReflinkAlways:
+		return "always"
+	default:
+		return fmt.Sprintf("ReflinkMode(%d)", int(m))
+	}
+}
+
+// osFileUnwrapper is implemented by files that wrap a file of the operating system, e.g. the files of a PrefixFS.
+type osFileUnwrapper interface {
+	unwrapOSFile() (*os.File, bool)
+}
+
+// unwrapOSFile returns the file of the operating system that f is backed by, if any.
+func unwrapOSFile(f any) (*os.File, bool) {
+	switch v := f.(type) {
+	case *os.File:
+		return v, true
+	case osFileUnwrapper:
+		return v.unwrapOSFile()
+	default:
+		return nil, false
+	}
+}
+
+// copyContent copies the content of source into the empty file dst. The file is cloned in case that
+// WithReflink is configured, source is a file of the operating system at its start and both reside
+// on a filesystem that supports copy on write clones, e.g. btrfs or XFS.
+func copyContent(dst File, source io.Reader, opts *backupFSOptions) error {
+	d, dok := unwrapOSFile(dst)
+	s, sok := unwrapOSFile(source)
+	if opts.reflink != ReflinkNever {
+		err := ErrReflinkUnsupported
+		if dok && sok {
+			err = osReflink(d, s)
+		}
+		if err == nil {
+			return nil
+		}
+		if opts.reflink == ReflinkAlways {
+			return err
+		}
+
+		if dok && sok {
+			// the kernel may still share the data blocks via copy_file_range
+			_, err = io.Copy(d, s)
+			return err
+		}
+	}
+
+	var err error
+	if opts.bufferSize > 0 {
+		_, err = io.CopyBuffer(dst, source, make([]byte, opts.bufferSize))
+	} else {
+		_, err = io.Copy(dst, source)
+	}
+	return err
+}
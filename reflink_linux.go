@@ -0,0 +1,40 @@
+package backupfs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ficlone is the ioctl request that clones a whole file, see ioctl_ficlone(2).
+const ficlone = 0x40049409
+
+// osReflink clones the content of src into dst.
+func osReflink(dst, src *os.File) error {
+	dconn, err := dst.SyscallConn()
+	if err != nil {
+		return err
+	}
+	sconn, err := src.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	err = dconn.Control(func(dfd uintptr) {
+		err := sconn.Control(func(sfd uintptr) {
+			_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, dfd, ficlone, sfd)
+		})
+		if err != nil {
+			errno = syscall.EBADF
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		// e.g. EOPNOTSUPP, EXDEV or EINVAL
+		return fmt.Errorf("%w: %s: %w", ErrReflinkUnsupported, dst.Name(), errno)
+	}
+	return nil
+}
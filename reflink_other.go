@@ -0,0 +1,13 @@
+//go:build !linux
+
+package backupfs
+
+import (
+	"fmt"
+	"os"
+)
+
+// osReflink is only supported on Linux.
+func osReflink(dst, _ *os.File) error {
+	return fmt.Errorf("%w: %s", ErrReflinkUnsupported, dst.Name())
+}
@@ -0,0 +1,81 @@
+package backupfs
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_WithReflink(t *testing.T) {
+	t.Parallel()
+
+	t.Run("auto", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			require            = require.New(t)
+			_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+			backupFS           = NewBackupFS(base, backup, WithReflink(ReflinkAuto), WithChecksums(sha256.New))
+			filePath           = filepath.FromSlash("/test/file.txt")
+		)
+
+		createFile(t, base, filePath, "original")
+		createFile(t, backupFS, filePath, "modified")
+		fileMustContainText(t, backupFS.backup, filePath, "original")
+		require.NoError(backupFS.VerifyChecksums(0))
+
+		require.NoError(backupFS.Rollback())
+		fileMustContainText(t, base, filePath, "original")
+	})
+
+	t.Run("always", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			require            = require.New(t)
+			_, base, backup, _ = NewTestBackupFS("/base", "/backup")
+			backupFS           = NewBackupFS(base, backup, WithReflink(ReflinkAlways))
+			filePath           = filepath.FromSlash("/test/file.txt")
+			probePath          = filepath.FromSlash("/probe.txt")
+		)
+
+		createFile(t, base, probePath, "probe")
+		src, err := base.Open(probePath)
+		require.NoError(err)
+		defer src.Close()
+		dst, err := backup.Create(probePath)
+		require.NoError(err)
+		defer dst.Close()
+		err = copyContent(dst, src, &backupFSOptions{reflink: ReflinkAlways})
+		supported := err == nil
+
+		createFile(t, base, filePath, "original")
+		err = base.Chmod(filePath, 0600)
+		require.NoError(err)
+
+		err = backupFS.Chmod(filePath, 0644)
+		if !supported {
+			require.ErrorIs(err, ErrReflinkUnsupported)
+			return
+		}
+		require.NoError(err)
+		fileMustContainText(t, backupFS.backup, filePath, "original")
+	})
+
+	t.Run("memfs", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			require  = require.New(t)
+			base     = NewMemFS()
+			backupFS = NewBackupFS(base, NewMemFS(), WithReflink(ReflinkAlways))
+			filePath = filepath.FromSlash("/test/file.txt")
+		)
+
+		createFile(t, base, filePath, "original")
+		require.ErrorIs(backupFS.Remove(filePath), ErrReflinkUnsupported)
+		mustExist(t, base, filePath)
+	})
+}
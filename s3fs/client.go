@@ -0,0 +1,52 @@
+package s3fs
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Client is the subset of the S3 API that is required by the FS.
+// Implementations usually wrap the client of an S3 SDK and map its errors.
+// Missing keys must be reported with an error that matches fs.ErrNotExist, e.g. NoSuchKey or NotFound.
+type Client interface {
+	// PutObject uploads size bytes of body as object with the given key and user metadata.
+	PutObject(ctx context.Context, key string, body io.Reader, size int64, metadata map[string]string) error
+	// GetObject streams the content of the object starting at offset, e.g. with a range request.
+	GetObject(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+	// HeadObject returns the size, modification time and user metadata of the object.
+	HeadObject(ctx context.Context, key string) (ObjectInfo, error)
+	// CopyObject copies the object srcKey to dstKey on the server side.
+	// A nil metadata keeps the metadata of the source object, any other metadata replaces it.
+	CopyObject(ctx context.Context, srcKey, dstKey string, metadata map[string]string) error
+	// DeleteObject deletes the object. Deleting a missing object is not an error.
+	DeleteObject(ctx context.Context, key string) error
+	// ListObjects lists all objects whose key starts with prefix, like ListObjectsV2.
+	// In case that delimiter is not empty, keys that contain the delimiter after the prefix are grouped
+	// into common prefixes that end with the delimiter. The user metadata of the listed objects is not required.
+	ListObjects(ctx context.Context, prefix, delimiter string) (objects []ObjectInfo, commonPrefixes []string, err error)
+
+	// CreateMultipartUpload starts a multipart upload of the object with the given key and user metadata.
+	CreateMultipartUpload(ctx context.Context, key string, metadata map[string]string) (uploadID string, err error)
+	// UploadPart uploads size bytes of body as part with the number partNumber, starting at 1.
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64) (etag string, err error)
+	// CompleteMultipartUpload creates the object from the uploaded parts.
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error
+	// AbortMultipartUpload discards the uploaded parts.
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// ObjectInfo describes an object of the object storage.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	// Metadata is the user metadata of the object, it may be nil for listed objects.
+	Metadata map[string]string
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	Number int
+	ETag   string
+}
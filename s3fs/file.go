@@ -0,0 +1,435 @@
+package s3fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"syscall"
+	"time"
+
+	"github.com/jxsl13/backupfs"
+)
+
+var (
+	_ backupfs.File               = (*file)(nil)
+	_ backupfs.FileMetadataSetter = (*file)(nil)
+)
+
+// file is either a directory, a file that is read or a file that is written.
+type file struct {
+	fsys *FS
+	name string
+	info *fileInfo
+
+	// file that is written, nil in case that the file is read
+	upload *upload
+
+	// object content starting at offset
+	body   io.ReadCloser
+	offset int64
+
+	// directory entries, read on demand
+	entries   []fs.FileInfo
+	dirOffset int
+
+	closed bool
+}
+
+func (f *file) pathErr(op string, err error) error {
+	return &fs.PathError{Op: op, Path: f.name, Err: err}
+}
+
+// check returns an error in case that the file is closed or a directory.
+func (f *file) check(op string) error {
+	switch {
+	case f.closed:
+		return f.pathErr(op, fs.ErrClosed)
+	case f.info.IsDir():
+		return f.pathErr(op, syscall.EISDIR)
+	}
+	return nil
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, f.pathErr("stat", fs.ErrClosed)
+	}
+	fi := *f.info
+	if f.upload != nil {
+		fi.size = f.upload.size
+	}
+	return &fi, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	err := f.check("read")
+	if err != nil {
+		return 0, err
+	}
+	if f.upload != nil {
+		return 0, f.pathErr("read", syscall.EBADF)
+	}
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		f.body, err = f.fsys.client.GetObject(f.fsys.opts.ctx, f.info.key, f.offset)
+		if err != nil {
+			return 0, f.pathErr("read", err)
+		}
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (n int, err error) {
+	err = f.check("read")
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case f.upload != nil:
+		return 0, f.pathErr("read", syscall.EBADF)
+	case off < 0:
+		return 0, f.pathErr("read", syscall.EINVAL)
+	case off >= f.info.size:
+		return 0, io.EOF
+	}
+
+	body, err := f.fsys.client.GetObject(f.fsys.opts.ctx, f.info.key, off)
+	if err != nil {
+		return 0, f.pathErr("read", err)
+	}
+	defer func() {
+		err = errors.Join(err, body.Close())
+	}()
+
+	n, err = io.ReadFull(body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Seek moves the offset of files that are read.
+// Files that are written can only be written sequentially.
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, f.pathErr("seek", fs.ErrClosed)
+	}
+
+	var current, size int64
+	switch {
+	case f.info.IsDir():
+		current = int64(f.dirOffset)
+		size = current
+	case f.upload != nil:
+		current = f.upload.size
+		size = current
+	default:
+		current = f.offset
+		size = f.info.size
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += current
+	case io.SeekEnd:
+		offset += size
+	case io.SeekStart:
+	default:
+		return 0, f.pathErr("seek", syscall.EINVAL)
+	}
+
+	switch {
+	case offset < 0:
+		return 0, f.pathErr("seek", syscall.EINVAL)
+	case offset == current:
+		return offset, nil
+	case f.info.IsDir():
+		if offset != 0 {
+			return 0, f.pathErr("seek", syscall.EINVAL)
+		}
+		f.entries = nil
+		f.dirOffset = 0
+		return 0, nil
+	case f.upload != nil:
+		return 0, f.pathErr("seek", syscall.ENOTSUP)
+	}
+
+	// the next read requests the content starting at the new offset
+	err := f.closeBody()
+	if err != nil {
+		return 0, f.pathErr("seek", err)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	err := f.check("write")
+	if err != nil {
+		return 0, err
+	}
+	if f.upload == nil {
+		return 0, f.pathErr("write", syscall.EBADF)
+	}
+
+	n, err := f.upload.Write(p)
+	if err != nil {
+		return n, f.pathErr("write", err)
+	}
+	return n, nil
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	if f.upload != nil && off != f.upload.size {
+		return 0, f.pathErr("write", syscall.ENOTSUP)
+	}
+	return f.Write(p)
+}
+
+func (f *file) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Truncate only supports the current size of files that are written.
+func (f *file) Truncate(size int64) error {
+	err := f.check("truncate")
+	if err != nil {
+		return err
+	}
+	switch {
+	case f.upload == nil:
+		return f.pathErr("truncate", syscall.EBADF)
+	case size != f.upload.size:
+		return f.pathErr("truncate", syscall.ENOTSUP)
+	}
+	return nil
+}
+
+// Sync does nothing, as written files are uploaded when they are closed.
+func (f *file) Sync() error {
+	if f.closed {
+		return f.pathErr("sync", fs.ErrClosed)
+	}
+	return nil
+}
+
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	switch {
+	case f.closed:
+		return nil, f.pathErr("readdir", fs.ErrClosed)
+	case !f.info.IsDir():
+		return nil, f.pathErr("readdir", syscall.ENOTDIR)
+	}
+
+	if f.entries == nil {
+		entries, err := f.fsys.readDir(f.name)
+		if err != nil {
+			return nil, f.pathErr("readdir", err)
+		}
+		f.entries = entries
+	}
+
+	entries := f.entries[f.dirOffset:]
+	if count > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if len(entries) > count {
+			entries = entries[:count]
+		}
+	}
+	f.dirOffset += len(entries)
+	return entries, nil
+}
+
+func (f *file) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	names := make([]string, 0, len(infos))
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	return names, err
+}
+
+// Close uploads written files.
+// Chmod changes the mode of the file. The mode of a file that is written is stored upon Close.
+func (f *file) Chmod(mode fs.FileMode) error {
+	return f.setMetadata("chmod", func(fi *fileInfo) {
+		fi.mode = fi.mode.Type() | mode&chmodBits
+	})
+}
+
+// Chown changes the uid and gid of the file. The ownership of a file that is written is stored upon Close.
+func (f *file) Chown(uid, gid int) error {
+	return f.setMetadata("chown", func(fi *fileInfo) {
+		fi.chown(uid, gid)
+	})
+}
+
+// Chtimes changes the modification time of the file. The modification time of a file that is written is stored upon Close.
+func (f *file) Chtimes(atime, mtime time.Time) error {
+	return f.setMetadata("chtimes", func(fi *fileInfo) {
+		fi.modTime = mtime
+	})
+}
+
+func (f *file) setMetadata(op string, set func(fi *fileInfo)) error {
+	if f.closed {
+		return f.pathErr(op, fs.ErrClosed)
+	}
+	set(f.info)
+	if f.upload != nil {
+		// the object does not exist yet
+		f.upload.metadataChanged = true
+		return nil
+	}
+	err := f.fsys.update(f.info)
+	if err != nil {
+		return f.pathErr(op, err)
+	}
+	return nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return f.pathErr("close", fs.ErrClosed)
+	}
+	f.closed = true
+
+	var err error
+	if f.upload != nil {
+		err = f.upload.finish()
+	} else {
+		err = f.closeBody()
+	}
+	if err != nil {
+		return f.pathErr("close", err)
+	}
+	return nil
+}
+
+func (f *file) closeBody() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
+
+// upload buffers written content up to the part size and switches to a multipart upload
+// in case that the content exceeds it.
+type upload struct {
+	fsys *FS
+	info *fileInfo
+
+	buf      []byte
+	size     int64
+	uploadID string
+	parts    []Part
+	// the metadata was changed while the file was written
+	metadataChanged bool
+	// the first error aborts the upload
+	err error
+}
+
+func (s *FS) newUpload(fi *fileInfo) *upload {
+	return &upload{fsys: s, info: fi}
+}
+
+func (u *upload) Write(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if int64(len(u.buf)) == u.fsys.opts.partSize {
+			// a full part is only uploaded once it is known not to be the last one
+			u.err = u.uploadPart()
+			if u.err != nil {
+				return written, errors.Join(u.err, u.abort())
+			}
+		}
+
+		n := min(len(p), int(u.fsys.opts.partSize)-len(u.buf))
+		u.buf = append(u.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		u.size += int64(n)
+	}
+	return written, nil
+}
+
+func (u *upload) uploadPart() error {
+	var (
+		ctx    = u.fsys.opts.ctx
+		client = u.fsys.client
+		key    = u.info.key
+		err    error
+	)
+	if u.uploadID == "" {
+		u.uploadID, err = client.CreateMultipartUpload(ctx, key, u.info.metadata())
+		if err != nil {
+			return err
+		}
+	}
+
+	number := len(u.parts) + 1
+	etag, err := client.UploadPart(ctx, key, u.uploadID, number, bytes.NewReader(u.buf), int64(len(u.buf)))
+	if err != nil {
+		return err
+	}
+	u.parts = append(u.parts, Part{Number: number, ETag: etag})
+	u.buf = u.buf[:0]
+	return nil
+}
+
+// finish creates the object.
+func (u *upload) finish() error {
+	if u.err != nil {
+		return u.err
+	}
+
+	var (
+		ctx    = u.fsys.opts.ctx
+		client = u.fsys.client
+		key    = u.info.key
+	)
+	if u.uploadID == "" {
+		return client.PutObject(ctx, key, bytes.NewReader(u.buf), int64(len(u.buf)), u.info.metadata())
+	}
+
+	err := u.uploadPart()
+	if err == nil {
+		err = client.CompleteMultipartUpload(ctx, key, u.uploadID, u.parts)
+	}
+	if err != nil {
+		return errors.Join(err, u.abort())
+	}
+	if u.metadataChanged {
+		// multipart uploads store the metadata of their creation
+		return client.CopyObject(ctx, key, key, u.info.metadata())
+	}
+	return nil
+}
+
+// abort discards the uploaded parts.
+func (u *upload) abort() error {
+	if u.uploadID == "" {
+		return nil
+	}
+	uploadID := u.uploadID
+	u.uploadID = ""
+	return u.fsys.client.AbortMultipartUpload(u.fsys.opts.ctx, u.info.key, uploadID)
+}
@@ -0,0 +1,269 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Client = (*MemClient)(nil)
+
+// MemClient is an in-memory object storage that implements the Client interface.
+// It is intended for tests and simulations.
+type MemClient struct {
+	mu      sync.Mutex
+	objects map[string]*memObject
+	uploads map[string]*memUpload
+	nextID  int
+}
+
+type memObject struct {
+	data     []byte
+	metadata map[string]string
+	modTime  time.Time
+}
+
+type memUpload struct {
+	key      string
+	metadata map[string]string
+	parts    map[int][]byte
+}
+
+// NewMemClient creates a new empty in-memory object storage.
+func NewMemClient() *MemClient {
+	return &MemClient{
+		objects: make(map[string]*memObject),
+		uploads: make(map[string]*memUpload),
+	}
+}
+
+func notExist(op, key string) error {
+	return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+}
+
+// PutObject uploads size bytes of body as object with the given key and user metadata.
+func (c *MemClient) PutObject(ctx context.Context, key string, body io.Reader, size int64, metadata map[string]string) error {
+	data, err := readPart(body, size)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.objects[key] = &memObject{
+		data:     data,
+		metadata: maps.Clone(metadata),
+		modTime:  time.Now(),
+	}
+	return nil
+}
+
+// GetObject streams the content of the object starting at offset.
+func (c *MemClient) GetObject(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o, ok := c.objects[key]
+	if !ok {
+		return nil, notExist("get_object", key)
+	}
+	// objects are replaced, never modified, so the data can be shared
+	data := o.data[min(offset, int64(len(o.data))):]
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// HeadObject returns the size, modification time and user metadata of the object.
+func (c *MemClient) HeadObject(ctx context.Context, key string) (ObjectInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o, ok := c.objects[key]
+	if !ok {
+		return ObjectInfo{}, notExist("head_object", key)
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         int64(len(o.data)),
+		LastModified: o.modTime,
+		Metadata:     maps.Clone(o.metadata),
+	}, nil
+}
+
+// CopyObject copies the object srcKey to dstKey.
+func (c *MemClient) CopyObject(ctx context.Context, srcKey, dstKey string, metadata map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o, ok := c.objects[srcKey]
+	if !ok {
+		return notExist("copy_object", srcKey)
+	}
+	if metadata == nil {
+		metadata = o.metadata
+	}
+	c.objects[dstKey] = &memObject{
+		data:     o.data,
+		metadata: maps.Clone(metadata),
+		modTime:  time.Now(),
+	}
+	return nil
+}
+
+// DeleteObject deletes the object.
+func (c *MemClient) DeleteObject(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.objects, key)
+	return nil
+}
+
+// ListObjects lists all objects whose key starts with prefix sorted by key.
+func (c *MemClient) ListObjects(ctx context.Context, prefix, delimiter string) (objects []ObjectInfo, commonPrefixes []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.objects))
+	for key := range c.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if delimiter != "" {
+			idx := strings.Index(key[len(prefix):], delimiter)
+			if idx >= 0 {
+				p := key[:len(prefix)+idx+len(delimiter)]
+				if len(commonPrefixes) == 0 || commonPrefixes[len(commonPrefixes)-1] != p {
+					commonPrefixes = append(commonPrefixes, p)
+				}
+				continue
+			}
+		}
+
+		o := c.objects[key]
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         int64(len(o.data)),
+			LastModified: o.modTime,
+		})
+	}
+	return objects, commonPrefixes, nil
+}
+
+// CreateMultipartUpload starts a multipart upload.
+func (c *MemClient) CreateMultipartUpload(ctx context.Context, key string, metadata map[string]string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	uploadID := fmt.Sprintf("upload-%d", c.nextID)
+	c.uploads[uploadID] = &memUpload{
+		key:      key,
+		metadata: maps.Clone(metadata),
+		parts:    make(map[int][]byte),
+	}
+	return uploadID, nil
+}
+
+// UploadPart uploads a part of a multipart upload.
+func (c *MemClient) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64) (string, error) {
+	data, err := readPart(body, size)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, err := c.upload(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	u.parts[partNumber] = data
+	return etag(data), nil
+}
+
+// CompleteMultipartUpload creates the object from the uploaded parts.
+func (c *MemClient) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, err := c.upload(key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, p := range parts {
+		part, ok := u.parts[p.Number]
+		if !ok || etag(part) != p.ETag {
+			return fmt.Errorf("invalid part %d of upload %s", p.Number, uploadID)
+		}
+		data = append(data, part...)
+	}
+
+	delete(c.uploads, uploadID)
+	c.objects[key] = &memObject{
+		data:     data,
+		metadata: u.metadata,
+		modTime:  time.Now(),
+	}
+	return nil
+}
+
+// AbortMultipartUpload discards the uploaded parts.
+func (c *MemClient) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.upload(key, uploadID)
+	if err != nil {
+		return err
+	}
+	delete(c.uploads, uploadID)
+	return nil
+}
+
+// Uploads returns the number of multipart uploads that were neither completed nor aborted.
+func (c *MemClient) Uploads() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.uploads)
+}
+
+func (c *MemClient) upload(key, uploadID string) (*memUpload, error) {
+	u, ok := c.uploads[uploadID]
+	if !ok || u.key != key {
+		return nil, notExist("upload", uploadID)
+	}
+	return u, nil
+}
+
+func readPart(body io.Reader, size int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
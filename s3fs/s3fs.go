@@ -0,0 +1,844 @@
+// Package s3fs provides a backupfs.FS that stores files as objects of an S3 compatible object storage,
+// which allows to keep the backups of a backupfs.BackupFS in a bucket.
+//
+// Regular files are uploaded as objects whose key is the path of the file below a configurable prefix.
+// Files that are larger than the part size are uploaded with multipart uploads while they are written,
+// so they are never buffered completely. Reading a file streams the object with range requests,
+// which is what a Rollback does in order to restore the backups.
+//
+// Directories are synthetic: they exist as long as objects exist below their path.
+// The mode, ownership and modification time of directories are stored in empty marker objects
+// whose key ends with a slash. Symlinks are stored as empty objects, their target is stored in the metadata.
+// Symlinks are only followed as last element of a path.
+//
+// Object storages do not support modifying objects, which is why files can only be written sequentially
+// and only after they were truncated or newly created. Files are created once they are closed.
+// Renaming copies every object and is not atomic.
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jxsl13/backupfs"
+)
+
+var _ backupfs.FS = (*FS)(nil)
+
+const (
+	// DefaultPartSize is the default size of the parts of multipart uploads.
+	DefaultPartSize = 16 << 20
+	// MinPartSize is the size that all but the last part of a multipart upload must at least have in S3.
+	MinPartSize = 5 << 20
+
+	// maximum number of symlinks that are followed while resolving a path
+	maxSymlinks = 255
+
+	// user metadata keys
+	metaMode    = "mode"
+	metaUID     = "uid"
+	metaGID     = "gid"
+	metaModTime = "mtime"
+	metaSymlink = "symlink"
+)
+
+// reference: os package
+const chmodBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// Option configures the FS.
+type Option func(*options)
+
+type options struct {
+	prefix   string
+	partSize int64
+	ctx      context.Context
+	clock    backupfs.Clock
+}
+
+// WithPrefix stores all objects below the key prefix, e.g. in order to share a bucket.
+// The prefix is the root directory of the FS.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		o.prefix = prefix
+	}
+}
+
+// WithPartSize configures the size of the parts of multipart uploads.
+// Files that are not larger than size are uploaded with a single request.
+// S3 requires all but the last part to be at least MinPartSize bytes large. The default is DefaultPartSize.
+func WithPartSize(size int64) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.partSize = size
+		}
+	}
+}
+
+// WithContext configures the context of all requests, as the methods of the FS do not accept one.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		if ctx != nil {
+			o.ctx = ctx
+		}
+	}
+}
+
+// WithClock configures the clock that provides the modification times of created and modified files.
+func WithClock(c backupfs.Clock) Option {
+	return func(o *options) {
+		if c != nil {
+			o.clock = c
+		}
+	}
+}
+
+// New creates a new filesystem that stores its files in the object storage of client.
+func New(client Client, opts ...Option) *FS {
+	o := options{
+		partSize: DefaultPartSize,
+		ctx:      context.Background(),
+		clock:    backupfs.SystemClock(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &FS{
+		client: client,
+		opts:   o,
+		uid:    os.Getuid(),
+		gid:    os.Getgid(),
+	}
+}
+
+// FS is a filesystem that stores its files as objects of an S3 compatible object storage.
+type FS struct {
+	client Client
+	opts   options
+
+	// owner of new files
+	uid int
+	gid int
+}
+
+// Name returns the name of this FileSystem
+func (s *FS) Name() string {
+	return "S3FS"
+}
+
+// Client returns the client of the object storage.
+func (s *FS) Client() Client {
+	return s.client
+}
+
+// cleanPath returns the slash separated absolute path of name without volume.
+func cleanPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(backupfs.TrimVolume(name)))
+}
+
+// key returns the object key of the file name.
+func (s *FS) key(name string) string {
+	return s.opts.prefix + strings.TrimPrefix(cleanPath(name), "/")
+}
+
+// dirKey returns the key prefix of the children of the directory name, which is also the key of its marker object.
+func (s *FS) dirKey(name string) string {
+	if isRoot(name) {
+		return s.opts.prefix
+	}
+	return s.key(name) + "/"
+}
+
+func isRoot(name string) bool {
+	return cleanPath(name) == "/"
+}
+
+func (s *FS) newInfo(name string, mode fs.FileMode) *fileInfo {
+	return &fileInfo{
+		name:    path.Base(cleanPath(name)),
+		mode:    mode,
+		modTime: s.opts.clock.Now(),
+		uid:     s.uid,
+		gid:     s.gid,
+	}
+}
+
+func (s *FS) rootInfo() *fileInfo {
+	return &fileInfo{
+		name:      "/",
+		key:       s.opts.prefix,
+		mode:      fs.ModeDir | 0755,
+		uid:       s.uid,
+		gid:       s.gid,
+		synthetic: true,
+	}
+}
+
+// lstat returns the file info of name without following a symlink.
+func (s *FS) lstat(name string) (*fileInfo, error) {
+	if isRoot(name) {
+		return s.rootInfo(), nil
+	}
+	var (
+		base = path.Base(cleanPath(name))
+		key  = s.key(name)
+	)
+
+	oi, err := s.client.HeadObject(s.opts.ctx, key)
+	if err == nil {
+		return s.objectInfo(base, oi), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// directory with marker object
+	oi, err = s.client.HeadObject(s.opts.ctx, key+"/")
+	if err == nil {
+		return s.objectInfo(base, oi), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// directory that only exists because of its children
+	objects, prefixes, err := s.client.ListObjects(s.opts.ctx, key+"/", "/")
+	if err != nil {
+		return nil, err
+	}
+	if len(objects)+len(prefixes) == 0 {
+		return nil, fs.ErrNotExist
+	}
+	return &fileInfo{
+		name:      base,
+		key:       key + "/",
+		mode:      fs.ModeDir | 0755,
+		uid:       s.uid,
+		gid:       s.gid,
+		synthetic: true,
+	}, nil
+}
+
+// stat follows symlinks and returns the resolved path together with its file info.
+func (s *FS) stat(name string) (string, *fileInfo, error) {
+	for i := 0; i < maxSymlinks; i++ {
+		fi, err := s.lstat(name)
+		if err != nil {
+			return "", nil, err
+		}
+		if fi.mode&fs.ModeSymlink == 0 {
+			return name, fi, nil
+		}
+
+		target := filepath.ToSlash(backupfs.TrimVolume(fi.target))
+		if !strings.HasPrefix(target, "/") {
+			target = path.Join(path.Dir(cleanPath(name)), target)
+		}
+		name = target
+	}
+	return "", nil, syscall.ELOOP
+}
+
+// parentDir returns an error in case that the parent directory of name does not exist.
+func (s *FS) parentDir(name string) error {
+	_, fi, err := s.stat(path.Dir(cleanPath(name)))
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return syscall.ENOTDIR
+	}
+	return nil
+}
+
+// objectInfo creates the file info from the metadata of an object.
+func (s *FS) objectInfo(name string, oi ObjectInfo) *fileInfo {
+	fi := &fileInfo{
+		name:    name,
+		key:     oi.Key,
+		size:    oi.Size,
+		modTime: oi.LastModified,
+		uid:     s.uid,
+		gid:     s.gid,
+	}
+
+	meta := oi.Metadata
+	target, isSymlink := meta[metaSymlink]
+	switch {
+	case isSymlink:
+		fi.target, _ = url.PathUnescape(target)
+		fi.mode = fs.ModeSymlink | 0777
+		fi.size = int64(len(fi.target))
+	case strings.HasSuffix(oi.Key, "/"):
+		fi.mode = fs.ModeDir | 0755
+		fi.size = 0
+	default:
+		fi.mode = 0644
+	}
+
+	if mode, err := strconv.ParseUint(meta[metaMode], 10, 32); err == nil {
+		fi.mode = fs.FileMode(mode)
+	}
+	if uid, err := strconv.Atoi(meta[metaUID]); err == nil {
+		fi.uid = uid
+	}
+	if gid, err := strconv.Atoi(meta[metaGID]); err == nil {
+		fi.gid = gid
+	}
+	if mtime, err := strconv.ParseInt(meta[metaModTime], 10, 64); err == nil {
+		fi.modTime = time.Unix(0, mtime)
+	}
+	return fi
+}
+
+// update replaces the metadata of the object of fi.
+func (s *FS) update(fi *fileInfo) error {
+	if fi.key == s.opts.prefix {
+		// the root directory is not stored
+		return nil
+	}
+	if fi.synthetic {
+		return s.client.PutObject(s.opts.ctx, fi.key, strings.NewReader(""), 0, fi.metadata())
+	}
+	return s.client.CopyObject(s.opts.ctx, fi.key, fi.key, fi.metadata())
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (s *FS) Create(name string) (backupfs.File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (s *FS) Mkdir(name string, perm fs.FileMode) error {
+	err := s.mkdir(name, perm)
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (s *FS) mkdir(name string, perm fs.FileMode) error {
+	_, err := s.lstat(name)
+	if err == nil {
+		return fs.ErrExist
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = s.parentDir(name)
+	if err != nil {
+		return err
+	}
+	return s.putDir(name, perm)
+}
+
+func (s *FS) putDir(name string, perm fs.FileMode) error {
+	fi := s.newInfo(name, fs.ModeDir|perm&chmodBits)
+	return s.client.PutObject(s.opts.ctx, s.dirKey(name), strings.NewReader(""), 0, fi.metadata())
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (s *FS) MkdirAll(name string, perm fs.FileMode) error {
+	var (
+		parts   = strings.Split(strings.TrimPrefix(cleanPath(name), "/"), "/")
+		current = "/"
+	)
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		current = path.Join(current, p)
+
+		_, fi, err := s.stat(current)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			err = s.putDir(current, perm)
+			if err != nil {
+				return &fs.PathError{Op: "mkdir", Path: current, Err: err}
+			}
+		case err != nil:
+			return &fs.PathError{Op: "mkdir", Path: current, Err: err}
+		case !fi.IsDir():
+			return &fs.PathError{Op: "mkdir", Path: current, Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (s *FS) Open(name string) (backupfs.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+// Files can only be opened for writing in case that they are truncated, created or empty.
+func (s *FS) OpenFile(name string, flag int, perm fs.FileMode) (backupfs.File, error) {
+	f, err := s.openFile(name, flag, perm)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (s *FS) openFile(name string, flag int, perm fs.FileMode) (*file, error) {
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	resolvedName, fi, err := s.stat(name)
+	switch {
+	case err == nil:
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, fs.ErrExist
+		}
+		if fi.IsDir() {
+			if writable {
+				return nil, syscall.EISDIR
+			}
+			return &file{fsys: s, name: name, info: fi}, nil
+		}
+		if !writable {
+			return &file{fsys: s, name: name, info: fi}, nil
+		}
+		if flag&os.O_TRUNC == 0 && fi.size > 0 {
+			// objects cannot be modified
+			return nil, syscall.ENOTSUP
+		}
+
+		// keep mode and ownership of the existing file
+		fi.modTime = s.opts.clock.Now()
+		fi.size = 0
+		fi.key = s.key(resolvedName)
+		return &file{fsys: s, name: name, info: fi, upload: s.newUpload(fi)}, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	case flag&os.O_CREATE == 0:
+		return nil, err
+	}
+
+	err = s.parentDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi = s.newInfo(name, perm&chmodBits)
+	fi.key = s.key(name)
+	return &file{fsys: s, name: name, info: fi, upload: s.newUpload(fi)}, nil
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (s *FS) Remove(name string) error {
+	err := s.remove(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (s *FS) remove(name string) error {
+	if isRoot(name) {
+		return syscall.EBUSY
+	}
+	fi, err := s.lstat(name)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return s.client.DeleteObject(s.opts.ctx, fi.key)
+	}
+
+	objects, prefixes, err := s.client.ListObjects(s.opts.ctx, fi.key, "/")
+	if err != nil {
+		return err
+	}
+	if len(prefixes) > 0 || len(objects) > 1 || len(objects) == 1 && objects[0].Key != fi.key {
+		return syscall.ENOTEMPTY
+	}
+	return s.client.DeleteObject(s.opts.ctx, fi.key)
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (s *FS) RemoveAll(name string) error {
+	err := s.removeAll(name)
+	if err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (s *FS) removeAll(name string) error {
+	fi, err := s.lstat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !fi.IsDir() {
+		return s.client.DeleteObject(s.opts.ctx, fi.key)
+	}
+
+	objects, _, err := s.client.ListObjects(s.opts.ctx, fi.key, "")
+	if err != nil {
+		return err
+	}
+	// children before their marker objects
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key > objects[j].Key
+	})
+	for _, o := range objects {
+		err = s.client.DeleteObject(s.opts.ctx, o.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename renames a file.
+// Directories are renamed by copying all objects below them, which is not atomic.
+func (s *FS) Rename(oldname, newname string) error {
+	err := s.rename(oldname, newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (s *FS) rename(oldname, newname string) error {
+	if isRoot(oldname) || isRoot(newname) {
+		return syscall.EBUSY
+	}
+	if cleanPath(oldname) == cleanPath(newname) {
+		_, err := s.lstat(oldname)
+		return err
+	}
+
+	fi, err := s.lstat(oldname)
+	if err != nil {
+		return err
+	}
+	target, err := s.lstat(newname)
+	switch {
+	case err == nil && target.IsDir():
+		return fs.ErrExist
+	case err == nil && fi.IsDir():
+		return syscall.ENOTDIR
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	err = s.parentDir(newname)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return s.move(fi.key, s.key(newname))
+	}
+
+	var (
+		oldPrefix = fi.key
+		newPrefix = s.dirKey(newname)
+	)
+	objects, _, err := s.client.ListObjects(s.opts.ctx, oldPrefix, "")
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		err = s.move(o.Key, newPrefix+strings.TrimPrefix(o.Key, oldPrefix))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move copies the object on the server side and deletes the source.
+func (s *FS) move(srcKey, dstKey string) error {
+	err := s.client.CopyObject(s.opts.ctx, srcKey, dstKey, nil)
+	if err != nil {
+		return err
+	}
+	return s.client.DeleteObject(s.opts.ctx, srcKey)
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (s *FS) Stat(name string) (fs.FileInfo, error) {
+	_, fi, err := s.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	fi.name = path.Base(cleanPath(name))
+	return fi, nil
+}
+
+// Lstat returns a FileInfo describing the named file without following symlinks.
+func (s *FS) Lstat(name string) (fs.FileInfo, error) {
+	fi, err := s.lstat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+// modify applies f to the file info of name and stores the result in the metadata of its object.
+func (s *FS) modify(op, name string, follow bool, f func(fi *fileInfo)) error {
+	var (
+		fi  *fileInfo
+		err error
+	)
+	if follow {
+		_, fi, err = s.stat(name)
+	} else {
+		fi, err = s.lstat(name)
+	}
+	if err == nil {
+		f(fi)
+		err = s.update(fi)
+	}
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// Chmod changes the mode of the named file to mode.
+func (s *FS) Chmod(name string, mode fs.FileMode) error {
+	return s.modify("chmod", name, true, func(fi *fileInfo) {
+		fi.mode = fi.mode.Type() | mode&chmodBits
+	})
+}
+
+// Chown changes the uid and gid of the named file.
+func (s *FS) Chown(name string, uid, gid int) error {
+	return s.modify("chown", name, true, func(fi *fileInfo) {
+		fi.chown(uid, gid)
+	})
+}
+
+// Lchown does not fallback to chown. It does return an error in case that lchown cannot be called.
+func (s *FS) Lchown(name string, uid, gid int) error {
+	return s.modify("lchown", name, false, func(fi *fileInfo) {
+		fi.chown(uid, gid)
+	})
+}
+
+// Chtimes changes the access and modification times of the named file.
+// Only the modification time is stored.
+func (s *FS) Chtimes(name string, atime, mtime time.Time) error {
+	return s.modify("chtimes", name, true, func(fi *fileInfo) {
+		fi.modTime = mtime
+	})
+}
+
+// Truncate changes the size of the named file by uploading it again.
+func (s *FS) Truncate(name string, size int64) error {
+	err := s.truncate(name, size)
+	if err != nil {
+		return &fs.PathError{Op: "truncate", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (s *FS) truncate(name string, size int64) (err error) {
+	if size < 0 {
+		return syscall.EINVAL
+	}
+	_, fi, err := s.stat(name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return syscall.EISDIR
+	}
+
+	body, err := s.client.GetObject(s.opts.ctx, fi.key, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, body.Close())
+	}()
+
+	var (
+		content = io.LimitReader(body, size)
+		padding = io.LimitReader(zeroReader{}, max(0, size-fi.size))
+	)
+	fi.modTime = s.opts.clock.Now()
+	u := s.newUpload(fi)
+	_, err = io.Copy(u, io.MultiReader(content, padding))
+	if err != nil {
+		return errors.Join(err, u.abort())
+	}
+	return u.finish()
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+// The metadata of every entry is requested separately.
+func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := s.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, fi := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	return entries, nil
+}
+
+func (s *FS) readDir(name string) ([]fs.FileInfo, error) {
+	resolvedName, fi, err := s.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, syscall.ENOTDIR
+	}
+
+	prefix := s.dirKey(resolvedName)
+	objects, prefixes, err := s.client.ListObjects(s.opts.ctx, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(objects)+len(prefixes))
+	for _, o := range objects {
+		if o.Key != prefix {
+			names = append(names, strings.TrimPrefix(o.Key, prefix))
+		}
+	}
+	for _, p := range prefixes {
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"))
+	}
+	sort.Strings(names)
+
+	infos := make([]fs.FileInfo, 0, len(names))
+	for i, n := range names {
+		if i > 0 && names[i-1] == n {
+			// file and directory with the same name
+			continue
+		}
+		fi, err := s.lstat(path.Join(cleanPath(resolvedName), n))
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, fi)
+	}
+	return infos, nil
+}
+
+// Symlink creates a symlink at newname that points to oldname.
+func (s *FS) Symlink(oldname, newname string) error {
+	err := s.symlink(oldname, newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (s *FS) symlink(oldname, newname string) error {
+	_, err := s.lstat(newname)
+	if err == nil {
+		return fs.ErrExist
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = s.parentDir(newname)
+	if err != nil {
+		return err
+	}
+
+	fi := s.newInfo(newname, fs.ModeSymlink|0777)
+	fi.target = oldname
+	return s.client.PutObject(s.opts.ctx, s.key(newname), strings.NewReader(""), 0, fi.metadata())
+}
+
+// Readlink returns the target of the symlink.
+func (s *FS) Readlink(name string) (string, error) {
+	fi, err := s.lstat(name)
+	if err == nil && fi.mode&fs.ModeSymlink == 0 {
+		err = syscall.EINVAL
+	}
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return fi.target, nil
+}
+
+// fileInfo describes a file that is stored as object.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	uid     int
+	gid     int
+	target  string
+
+	// object key
+	key string
+	// directory without marker object
+	synthetic bool
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any           { return toSys(fi.uid, fi.gid) }
+
+func (fi *fileInfo) chown(uid, gid int) {
+	if uid >= 0 {
+		fi.uid = uid
+	}
+	if gid >= 0 {
+		fi.gid = gid
+	}
+}
+
+// metadata returns the user metadata of the object.
+func (fi *fileInfo) metadata() map[string]string {
+	meta := map[string]string{
+		metaMode:    strconv.FormatUint(uint64(fi.mode), 10),
+		metaUID:     strconv.Itoa(fi.uid),
+		metaGID:     strconv.Itoa(fi.gid),
+		metaModTime: strconv.FormatInt(fi.modTime.UnixNano(), 10),
+	}
+	if fi.mode&fs.ModeSymlink != 0 {
+		// metadata must be ASCII
+		meta[metaSymlink] = url.PathEscape(fi.target)
+	}
+	return meta
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
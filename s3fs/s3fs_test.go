@@ -0,0 +1,180 @@
+package s3fs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jxsl13/backupfs"
+	"github.com/jxsl13/backupfs/testingfs"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, fsys backupfs.FS, name, content string) {
+	t.Helper()
+	f, err := fsys.Create(name)
+	require.NoError(t, err)
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func readFile(t *testing.T, fsys backupfs.FS, name string) string {
+	t.Helper()
+	f, err := fsys.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		client  = NewMemClient()
+		fsys    = New(client, WithPrefix("/backups/"))
+	)
+
+	require.NoError(fsys.MkdirAll("/test/dir", 0700))
+	writeFile(t, fsys, "/test/dir/file.txt", "content")
+	require.NoError(fsys.Symlink("dir/file.txt", "/test/link"))
+
+	// objects are stored below the prefix
+	_, err := client.HeadObject(context.Background(), "backups/test/dir/file.txt")
+	require.NoError(err)
+
+	fi, err := fsys.Lstat("/test/dir")
+	require.NoError(err)
+	require.Equal(fs.ModeDir|0700, fi.Mode())
+
+	fi, err = fsys.Stat("/test/link")
+	require.NoError(err)
+	require.Equal("link", fi.Name())
+	require.Equal(int64(len("content")), fi.Size())
+	require.Equal("content", readFile(t, fsys, "/test/link"))
+
+	target, err := fsys.Readlink("/test/link")
+	require.NoError(err)
+	require.Equal("dir/file.txt", target)
+
+	entries, err := fsys.ReadDir("/test")
+	require.NoError(err)
+	require.Len(entries, 2)
+	require.Equal("dir", entries[0].Name())
+	require.True(entries[0].IsDir())
+	require.Equal("link", entries[1].Name())
+	require.Equal(fs.ModeSymlink, entries[1].Type())
+
+	require.NoError(fsys.Chmod("/test/dir/file.txt", 0600))
+	fi, err = fsys.Lstat("/test/dir/file.txt")
+	require.NoError(err)
+	require.Equal(fs.FileMode(0600), fi.Mode())
+	require.Equal("content", readFile(t, fsys, "/test/dir/file.txt"))
+
+	// reads are streamed with range requests
+	f, err := fsys.Open("/test/dir/file.txt")
+	require.NoError(err)
+	_, err = f.Seek(3, io.SeekStart)
+	require.NoError(err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(err)
+	require.Equal("tent", string(buf))
+	_, err = f.ReadAt(buf[:3], 0)
+	require.NoError(err)
+	require.Equal("con", string(buf[:3]))
+	require.NoError(f.Close())
+
+	// objects cannot be modified
+	_, err = fsys.OpenFile("/test/dir/file.txt", os.O_WRONLY, 0)
+	require.ErrorIs(err, syscall.ENOTSUP)
+
+	require.NoError(fsys.Truncate("/test/dir/file.txt", 4))
+	require.Equal("cont", readFile(t, fsys, "/test/dir/file.txt"))
+
+	require.ErrorIs(fsys.Remove("/test/dir"), syscall.ENOTEMPTY)
+	require.NoError(fsys.Rename("/test/dir", "/test/renamed"))
+	require.Equal("cont", readFile(t, fsys, "/test/renamed/file.txt"))
+	_, err = fsys.Lstat("/test/dir")
+	require.ErrorIs(err, fs.ErrNotExist)
+	fi, err = fsys.Lstat("/test/renamed")
+	require.NoError(err)
+	require.Equal(fs.ModeDir|0700, fi.Mode())
+
+	require.NoError(fsys.RemoveAll("/test"))
+	objects, _, err := client.ListObjects(context.Background(), "", "")
+	require.NoError(err)
+	require.Empty(objects)
+}
+
+// countingClient counts the uploaded parts.
+type countingClient struct {
+	*MemClient
+	parts atomic.Int64
+}
+
+func (c *countingClient) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64) (string, error) {
+	c.parts.Add(1)
+	return c.MemClient.UploadPart(ctx, key, uploadID, partNumber, body, size)
+}
+
+func TestFS_Multipart(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		client  = &countingClient{MemClient: NewMemClient()}
+		fsys    = New(client, WithPartSize(4))
+	)
+
+	// files that fit into a single part are uploaded at once
+	writeFile(t, fsys, "/small.txt", "1234")
+	require.Equal(int64(0), client.parts.Load())
+
+	content := strings.Repeat("0123456789", 3)
+	writeFile(t, fsys, "/large.txt", content)
+	require.Equal(int64(8), client.parts.Load())
+	require.Equal(0, client.Uploads())
+	require.Equal(content, readFile(t, fsys, "/large.txt"))
+
+	fi, err := fsys.Stat("/large.txt")
+	require.NoError(err)
+	require.Equal(int64(len(content)), fi.Size())
+
+	// metadata that is changed via the handle is stored with the completed upload
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	f, err := fsys.Create("/meta.txt")
+	require.NoError(err)
+	_, err = f.WriteString(content)
+	require.NoError(err)
+	m, ok := f.(backupfs.FileMetadataSetter)
+	require.True(ok)
+	require.NoError(m.Chmod(0600))
+	require.NoError(m.Chtimes(mtime, mtime))
+	_, err = fsys.Stat("/meta.txt")
+	require.ErrorIs(err, fs.ErrNotExist)
+	require.NoError(f.Close())
+
+	fi, err = fsys.Stat("/meta.txt")
+	require.NoError(err)
+	require.Equal(fs.FileMode(0600), fi.Mode().Perm())
+	require.True(mtime.Equal(fi.ModTime()))
+}
+
+func TestRunTransactionSuite(t *testing.T) {
+	t.Parallel()
+
+	s3Backend := func(t testing.TB) backupfs.FS {
+		return New(NewMemClient(), WithPrefix("backups"), WithPartSize(8))
+	}
+	testingfs.RunTransactionSuite(t, testingfs.MemBackend, s3Backend)
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package s3fs
+
+func toSys(_, _ int) any {
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package s3fs
+
+import (
+	"syscall"
+)
+
+func toSys(uid, gid int) any {
+	return &syscall.Stat_t{
+		Uid: uint32(uid),
+		Gid: uint32(gid),
+	}
+}
@@ -0,0 +1,55 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SnapshotProvider provides read access to a point in time snapshot of the base filesystem.
+// It is used as fallback source for backups of files that cannot be opened directly,
+// e.g. because they are locked by other processes.
+type SnapshotProvider interface {
+	// OpenSnapshot opens the snapshot version of the file with the given name.
+	// name is the path of the file in the base filesystem.
+	OpenSnapshot(name string) (File, error)
+}
+
+// openBackupSource opens a file of the base filesystem in order to back it up.
+// falls back to the SnapshotProvider in case that the file cannot be opened directly.
+func (fsys *BackupFS) openBackupSource(resolvedName string) (File, error) {
+	f, err := fsys.base.Open(resolvedName)
+	if err == nil {
+		return f, nil
+	}
+
+	p := fsys.opts.snapshotProvider
+	if p == nil || isNotFoundError(err) {
+		return nil, err
+	}
+
+	sf, serr := p.OpenSnapshot(resolvedName)
+	if serr != nil {
+		return nil, errors.Join(err, serr)
+	}
+	return sf, nil
+}
+
+var (
+	// ErrSnapshotUnsupported is returned by a SubtreeSnapshotter in case that it cannot
+	// snapshot a specific directory tree. The BackupFS falls back to copying the files instead.
+	ErrSnapshotUnsupported = fmt.Errorf("snapshot not supported: %w", errors.ErrUnsupported)
+)
+
+// SubtreeSnapshotter delegates the backup of entire directory trees to native snapshots of the
+// underlying filesystem, e.g. Btrfs subvolume or ZFS dataset snapshots.
+// All paths are paths of the base filesystem.
+type SubtreeSnapshotter interface {
+	// CreateSnapshot creates a snapshot of the directory tree at root.
+	// In case that the directory tree cannot be snapshotted, an error wrapping
+	// ErrSnapshotUnsupported must be returned.
+	CreateSnapshot(root string) error
+	// RestorePath replaces whatever is located at root with the content of its snapshot.
+	RestorePath(root string) error
+	// DeleteSnapshot removes the snapshot of root after it has been restored.
+	DeleteSnapshot(root string) error
+}
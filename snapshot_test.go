@@ -0,0 +1,155 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lockedFS fails to open files that are locked by other processes
+type lockedFS struct {
+	FS
+	locked string
+}
+
+func (fsys *lockedFS) Open(name string) (File, error) {
+	if filepath.Clean(name) == fsys.locked {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EBUSY}
+	}
+	return fsys.FS.Open(name)
+}
+
+type testSnapshotProvider struct {
+	snapshot FS
+	opened   []string
+}
+
+func (p *testSnapshotProvider) OpenSnapshot(name string) (File, error) {
+	p.opened = append(p.opened, name)
+	return p.snapshot.Open(name)
+}
+
+func TestBackupFS_WithSnapshotFallback(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+		lockedFile   = filepath.FromSlash("/test/locked.txt")
+	)
+	_, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+
+	createFile(t, base, lockedFile, "locked content")
+
+	locked := &lockedFS{FS: base, locked: lockedFile}
+
+	// without snapshot fallback the backup fails
+	backupFS := NewBackupFS(locked, backup)
+	_, err := backupFS.Create(lockedFile)
+	require.ErrorIs(err, syscall.EBUSY)
+
+	provider := &testSnapshotProvider{snapshot: base}
+	backupFS = NewBackupFS(locked, backup, WithSnapshotFallback(provider))
+	createFile(t, backupFS, lockedFile, "new content")
+
+	require.Equal([]string{lockedFile}, provider.opened)
+	fileMustContainText(t, backup, lockedFile, "locked content")
+
+	require.NoError(backupFS.Rollback())
+	fileMustContainText(t, base, lockedFile, "locked content")
+}
+
+// moveSnapshotter moves directory trees out of the base filesystem
+// in order to simulate native snapshots.
+type moveSnapshotter struct {
+	root        FS
+	basePrefix  string
+	unsupported string
+	deleted     []string
+}
+
+func (s *moveSnapshotter) snapshotPath(root string) string {
+	return filepath.Join("/snapshots", root)
+}
+
+func (s *moveSnapshotter) CreateSnapshot(root string) error {
+	if root == s.unsupported {
+		return ErrSnapshotUnsupported
+	}
+	err := s.root.MkdirAll(filepath.Dir(s.snapshotPath(root)), 0700)
+	if err != nil {
+		return err
+	}
+	return s.root.Rename(filepath.Join(s.basePrefix, root), s.snapshotPath(root))
+}
+
+func (s *moveSnapshotter) RestorePath(root string) error {
+	err := s.root.RemoveAll(filepath.Join(s.basePrefix, root))
+	if err != nil {
+		return err
+	}
+	return s.root.Rename(s.snapshotPath(root), filepath.Join(s.basePrefix, root))
+}
+
+func (s *moveSnapshotter) DeleteSnapshot(root string) error {
+	s.deleted = append(s.deleted, root)
+	return nil
+}
+
+func TestBackupFS_WithSubtreeSnapshots(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/backup"
+		snapshotDir  = filepath.FromSlash("/test/snapshot")
+		copiedDir    = filepath.FromSlash("/test/copied")
+		fileContent  = "test_content"
+	)
+	root, base, backup, _ := NewTestBackupFS(basePrefix, backupPrefix)
+
+	createFile(t, base, filepath.Join(snapshotDir, "sub", "test01.txt"), fileContent)
+	createFile(t, base, filepath.Join(copiedDir, "test02.txt"), fileContent)
+
+	baseFSState := createFSState(t, base, "/")
+	backupFSState := createFSState(t, backup, "/")
+
+	snapshotter := &moveSnapshotter{
+		root:        root,
+		basePrefix:  basePrefix,
+		unsupported: copiedDir,
+	}
+	backupFS := NewBackupFS(base, backup, WithSubtreeSnapshots(snapshotter))
+
+	removeAll(t, backupFS, snapshotDir)
+	removeAll(t, backupFS, copiedDir)
+	mustNotExist(t, base, snapshotDir)
+	mustNotExist(t, base, copiedDir)
+
+	require.True(isSnapshotInfo(backupFS.baseInfos.info(snapshotDir)))
+	require.True(isSubtreeInfo(backupFS.baseInfos.info(copiedDir)))
+	require.False(isSnapshotInfo(backupFS.baseInfos.info(copiedDir)))
+
+	// snapshotted trees are not copied to the backup filesystem
+	mustNotExist(t, backup, snapshotDir)
+	fileMustContainText(t, backup, filepath.Join(copiedDir, "test02.txt"), fileContent)
+
+	// the snapshot marker survives serialization
+	data, err := json.Marshal(backupFS)
+	require.NoError(err)
+	backupFSNew := NewBackupFS(base, backup, WithSubtreeSnapshots(snapshotter))
+	require.NoError(json.Unmarshal(data, backupFSNew))
+	require.True(isSnapshotInfo(backupFSNew.baseInfos.info(snapshotDir)))
+
+	require.NoError(backupFSNew.Rollback())
+
+	require.Equal([]string{snapshotDir}, snapshotter.deleted)
+	mustEqualFSState(t, baseFSState, base, "/")
+	mustEqualFSState(t, backupFSState, backup, "/")
+}
@@ -1,7 +1,9 @@
 package backupfs
 
 import (
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -30,14 +32,9 @@ func (a ByLeastFilePathSeparators) Less(i, j int) bool {
 }
 
 // LessFilePathSeparators compares two file paths by the number of file path separators
-// returns true if a has less file path separators than b
+// returns true if a has less file path separators than b.
+// The root directory is less nested than any other path, see PathDepth.
 func LessFilePathSeparators(a, b string) bool {
-	aa := TrimVolume(a)
-	ab := TrimVolume(b)
-
-	ca := strings.Count(aa, separator)
-	cb := strings.Count(ab, separator)
-
 	/*
 		Edge case where the root path is compared to a file in the root path.
 		[0] = "/test/0/2"
@@ -45,19 +42,97 @@ func LessFilePathSeparators(a, b string) bool {
 		[2] = "/"
 		[3] = "/test"
 	*/
+	da := PathDepth(a)
+	db := PathDepth(b)
 
-	// root = smallest number of separators
-	if ca == 1 && aa == separator {
-		ca = -1
+	if da == db {
+		// with volume
+		return a < b
 	}
+	return da < db
+}
+
+// OrderForDeletion returns a sorted copy of the paths in which every path is ordered before its parent
+// directories. Removing the paths in this order never fails due to a not yet removed child.
+// It is the exact reverse of OrderForCreation, so paths with the same depth are sorted in reverse lexical order.
+func OrderForDeletion(paths []string) []string {
+	ordered := append(make([]string, 0, len(paths)), paths...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return LessFilePathSeparators(ordered[j], ordered[i])
+	})
+	return ordered
+}
+
+// OrderForCreation returns a sorted copy of the paths in which every path is ordered after its parent
+// directories. Creating or restoring the paths in this order never fails due to a missing parent directory.
+// Paths with the same depth are sorted lexically, which makes the order deterministic.
+func OrderForCreation(paths []string) []string {
+	ordered := append(make([]string, 0, len(paths)), paths...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return LessFilePathSeparators(ordered[i], ordered[j])
+	})
+	return ordered
+}
 
-	if cb == 1 && ab == separator {
-		cb = -1
+// PathDepth returns the number of path elements after the volume name of the path.
+// The root directory has a depth of 0, "/a" and the relative path "a" have a depth of 1.
+// Drive letters and UNC prefixes (\\server\share or //server/share) are not counted,
+// which allows to order manifests of Windows paths on any operating system.
+// Paths are expected to be cleaned.
+func PathDepth(path string) int {
+	path = path[len(volumeName(path)):]
+
+	depth := 0
+	element := false
+	for i := 0; i < len(path); i++ {
+		if isSeparator(path[i]) {
+			element = false
+			continue
+		}
+		if !element {
+			depth++
+			element = true
+		}
 	}
+	return depth
+}
 
-	if ca == cb {
-		// with volume
-		return a < b
+// volumeName returns the volume name of the path like filepath.VolumeName and additionally
+// detects drive letters and UNC prefixes on operating systems that do not support them.
+func volumeName(path string) string {
+	if volume := filepath.VolumeName(path); volume != "" {
+		return volume
+	}
+
+	if len(path) >= 2 && path[1] == ':' && isDriveLetter(path[0]) {
+		return path[:2]
+	}
+
+	if len(path) < 3 || !isSeparator(path[0]) || path[0] != path[1] || isSeparator(path[2]) {
+		return ""
+	}
+
+	// \\server\share or //server/share
+	sep := path[0]
+	end := strings.IndexByte(path[2:], sep)
+	if end < 0 {
+		return path
+	}
+	end += 2
+	next := strings.IndexByte(path[end+1:], sep)
+	if next < 0 {
+		return path
 	}
-	return ca < cb
+	return path[:end+1+next]
+}
+
+// isSeparator treats backslashes as separators on all operating systems.
+// Additional separators only increase the depth of child paths, which keeps the order of
+// parent and child directories intact for file names that contain backslashes.
+func isSeparator(c byte) bool {
+	return os.IsPathSeparator(c) || c == '\\'
+}
+
+func isDriveLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
 }
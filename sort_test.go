@@ -117,3 +117,60 @@ func FuzzSortByLeastFilePathSeparators(f *testing.F) {
 		require.Equal(t, list[0], separator)
 	})
 }
+
+func TestPathDepth(t *testing.T) {
+	t.Parallel()
+
+	table := []struct {
+		path  string
+		depth int
+	}{
+		{"/", 0},
+		{"/a", 1},
+		{"a", 1},
+		{"/a/b/c", 3},
+		{`C:\`, 0},
+		{`C:\a\b`, 2},
+		{`\\server\share`, 0},
+		{`\\server\share\a\b`, 2},
+		{"//server/share/a", 1},
+	}
+
+	for _, tt := range table {
+		require.Equalf(t, tt.depth, PathDepth(tt.path), "path: %s", tt.path)
+	}
+}
+
+func TestOrderForDeletionAndCreation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		paths   = []string{
+			`\\server\share\a`,
+			`\\server\share\a\b\c`,
+			`\\server\share`,
+			`\\server\share\a\b`,
+			`\\server\share\b`,
+		}
+	)
+
+	require.Equal([]string{
+		`\\server\share\a\b\c`,
+		`\\server\share\a\b`,
+		`\\server\share\b`,
+		`\\server\share\a`,
+		`\\server\share`,
+	}, OrderForDeletion(paths))
+
+	require.Equal([]string{
+		`\\server\share`,
+		`\\server\share\a`,
+		`\\server\share\b`,
+		`\\server\share\a\b`,
+		`\\server\share\a\b\c`,
+	}, OrderForCreation(paths))
+
+	// input is not modified
+	require.Equal(`\\server\share\a`, paths[0])
+}
@@ -0,0 +1,52 @@
+package backupfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// statResolved returns a FileInfo describing the file that name points to, like Stat.
+//
+// All symlinks are resolved with the Lstat and Readlink methods of fsys instead of delegating
+// to Stat of the underlying filesystem. That way symlinks are resolved within the view of
+// fsys: absolute symlink targets are located relative to the root of a PrefixFS or VolumeFS
+// and targets that are hidden by a HiddenFS do not exist.
+// Every wrapper that restricts the visible paths implements Stat with this function.
+func statResolved(fsys resolverFS, name string) (fs.FileInfo, error) {
+	resolvedName, fi, err := resolvePathWithInfo(fsys, normalizePath(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if fi == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, found, err := resolveSymlinkTarget(fsys, resolvedName)
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		if !found {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+		}
+
+		fi, err = fsys.Lstat(target)
+		if err != nil {
+			return nil, err
+		}
+		return &resolvedFileInfo{FileInfo: fi, name: filepath.Base(resolvedName)}, nil
+	}
+	return fi, nil
+}
+
+// resolvedFileInfo carries the name that was passed to Stat
+// instead of the name of the resolved symlink target.
+type resolvedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi *resolvedFileInfo) Name() string {
+	return fi.name
+}
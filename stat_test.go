@@ -0,0 +1,55 @@
+package backupfs
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatResolvesWithinStack(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	root := NewTempDirPrefixFS(CallerPathTmp())
+
+	createFile(t, root, "/outside.txt", "outside")
+	createFile(t, root, "/base/dir/file.txt", "inside")
+	createFile(t, root, "/base/hidden/secret.txt", "secret")
+
+	// the absolute target is located outside of the base prefix
+	createSymlink(t, root, "/outside.txt", "/base/escape")
+	createSymlink(t, root, "/base/dir/file.txt", "/base/abs")
+	createSymlink(t, root, "file.txt", "/base/dir/rel")
+	createSymlink(t, root, "/base/dir", "/base/dirlink")
+	createSymlink(t, root, "/base/hidden/secret.txt", "/base/leak")
+
+	fsys := NewHiddenFS(NewPrefixFS(root, "/base"), "/hidden")
+
+	for _, name := range []string{"/abs", "/dir/rel", "/dirlink/file.txt", "/dirlink/rel"} {
+		fi, err := fsys.Stat(name)
+		require.NoError(err, name)
+		require.True(fi.Mode().IsRegular(), name)
+		require.Equal(int64(len("inside")), fi.Size(), name)
+	}
+
+	fi, err := fsys.Stat("/abs")
+	require.NoError(err)
+	require.Equal("abs", fi.Name())
+
+	fi, err = fsys.Stat("/dirlink")
+	require.NoError(err)
+	require.True(fi.IsDir())
+
+	for _, name := range []string{"/escape", "/leak", "/hidden/secret.txt"} {
+		_, err = fsys.Stat(name)
+		require.ErrorIs(err, fs.ErrNotExist, name)
+
+		// Lstat still reports the visible symlinks themselves
+		if name != "/hidden/secret.txt" {
+			fi, err = fsys.Lstat(name)
+			require.NoError(err, name)
+			require.NotZero(fi.Mode()&fs.ModeSymlink, name)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+)
+
+// SwapDir implements the "prepare in a staging directory, then rename into place" deployment pattern.
+// The directory at stagingPath replaces the directory at livePath and the previous live directory
+// is kept at stagingPath as rollback source, which is why calling SwapDir again reverts the swap.
+// In case that livePath does not exist, the staging directory is moved into place and stagingPath does not exist afterwards.
+//
+// Renaming a directory over an existing directory fails on Windows and for non-empty directories on unix,
+// which is why the live directory is moved aside to a temporary name in its parent directory first.
+// The staging directory is then renamed into place, so that livePath is either missing for a brief moment
+// or complete, but never partially populated. In case that the staging directory cannot be moved into place,
+// the live directory is moved back.
+//
+// Used with a BackupFS, all renames are tracked and reverted by a rollback.
+func SwapDir(fsys FS, livePath, stagingPath string) (err error) {
+	defer func() {
+		if err != nil {
+			err = &fs.PathError{Op: "swapdir", Path: livePath, Err: err}
+		}
+	}()
+
+	livePath = filepath.Clean(livePath)
+	stagingPath = filepath.Clean(stagingPath)
+	if livePath == stagingPath {
+		return errors.New("live and staging path must differ")
+	}
+
+	fi, err := fsys.Stat(stagingPath)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &fs.PathError{Op: "stat", Path: stagingPath, Err: syscall.ENOTDIR}
+	}
+
+	fi, err = fsys.Lstat(livePath)
+	if isNotFoundError(err) {
+		return fsys.Rename(stagingPath, livePath)
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &fs.PathError{Op: "lstat", Path: livePath, Err: syscall.ENOTDIR}
+	}
+
+	aside, err := swapAsidePath(fsys, livePath)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.Rename(livePath, aside)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.Rename(stagingPath, livePath)
+	if err != nil {
+		// put the live directory back in place
+		return errors.Join(err, fsys.Rename(aside, livePath))
+	}
+
+	return fsys.Rename(aside, stagingPath)
+}
+
+// swapAsidePath returns a path that does not exist yet next to livePath.
+func swapAsidePath(fsys FS, livePath string) (string, error) {
+	var (
+		dir    = filepath.Dir(livePath)
+		prefix = "." + filepath.Base(livePath) + ".swap-"
+	)
+	for i := 0; i < maxTempAttempts; i++ {
+		try := filepath.Join(dir, RandomTempName(prefix))
+		_, exists, err := lexists(fsys, try)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return try, nil
+		}
+	}
+	return "", fs.ErrExist
+}
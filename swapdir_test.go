@@ -0,0 +1,53 @@
+package backupfs
+
+import (
+	"io/fs"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwapDir(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require  = require.New(t)
+		base     = NewMemFS()
+		backupFS = NewBackupFS(base, NewMemFS())
+	)
+
+	createFile(t, base, "/app/current/version.txt", "v1")
+	createFile(t, base, "/app/current/v1.txt", "v1")
+	initialState := createFSState(t, base, "/")
+
+	createFile(t, backupFS, "/app/staging/version.txt", "v2")
+	require.NoError(SwapDir(backupFS, "/app/current", "/app/staging"))
+
+	fileMustContainText(t, backupFS, "/app/current/version.txt", "v2")
+	mustNotLExist(t, backupFS, "/app/current/v1.txt")
+	// the previous version is kept as rollback source
+	fileMustContainText(t, backupFS, "/app/staging/version.txt", "v1")
+	fileMustContainText(t, backupFS, "/app/staging/v1.txt", "v1")
+
+	entries, err := backupFS.ReadDir("/app")
+	require.NoError(err)
+	require.Len(entries, 2, "no leftover of the swap")
+
+	// swapping again reverts the swap
+	require.NoError(SwapDir(backupFS, "/app/current", "/app/staging"))
+	fileMustContainText(t, backupFS, "/app/current/version.txt", "v1")
+	fileMustContainText(t, backupFS, "/app/staging/version.txt", "v2")
+
+	// missing live directories are created
+	require.NoError(SwapDir(backupFS, "/app/next", "/app/staging"))
+	fileMustContainText(t, backupFS, "/app/next/version.txt", "v2")
+	mustNotLExist(t, backupFS, "/app/staging")
+
+	createFile(t, backupFS, "/app/file.txt", "file")
+	require.ErrorIs(SwapDir(backupFS, "/app/current", "/app/file.txt"), syscall.ENOTDIR)
+	require.ErrorIs(SwapDir(backupFS, "/app/current", "/app/missing"), fs.ErrNotExist)
+
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, initialState, base, "/")
+}
@@ -0,0 +1,87 @@
+package backupfs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// dirSymlinkInfo marks a backed up symlink that pointed to a directory,
+// which is required in order to restore the correct link type on Windows.
+// Symlinks to files do not need to be marked, as links to missing targets are
+// created as file links by default.
+type dirSymlinkInfo struct {
+	fs.FileInfo
+}
+
+// toSymlinkInfo marks the symlink at resolvedName in case that it points to a directory.
+func (fsys *BackupFS) toSymlinkInfo(resolvedName string, info fs.FileInfo) fs.FileInfo {
+	target, found, err := resolveSymlinkTarget(fsys.base, resolvedName)
+	if err != nil || !found {
+		return info
+	}
+
+	fi, err := fsys.base.Lstat(target)
+	if err != nil || !fi.IsDir() {
+		return info
+	}
+	return &dirSymlinkInfo{FileInfo: info}
+}
+
+// linkTypeOf returns the recorded link type of a symlink.
+func linkTypeOf(info fs.FileInfo) LinkType {
+	if _, ok := info.(*dirSymlinkInfo); ok {
+		return LinkDir
+	}
+	return LinkAuto
+}
+
+// orderSymlinksByTarget returns the symlink paths in an order in which every symlink comes after
+// the symlinks that it points at or through, e.g. a link to /a/link/dir after /a/link.
+// The targets are read from fsys. Symlinks without such dependencies keep their lexical order,
+// cyclic symlinks are ordered arbitrarily.
+func orderSymlinksByTarget(fsys FS, symlinkPaths []string) []string {
+	sorted := make([]string, len(symlinkPaths))
+	copy(sorted, symlinkPaths)
+	sort.Strings(sorted)
+
+	targets := make(map[string]string, len(sorted))
+	for _, p := range sorted {
+		target, err := fsys.Readlink(p)
+		if err != nil {
+			continue
+		}
+		targets[p] = filepath.Clean(toAbsSymlink(target, p))
+	}
+
+	var (
+		ordered = make([]string, 0, len(sorted))
+		visited = make(map[string]bool, len(sorted))
+		visit   func(p string)
+	)
+	visit = func(p string) {
+		if visited[p] {
+			return
+		}
+		visited[p] = true
+
+		target, ok := targets[p]
+		if ok {
+			for _, dep := range sorted {
+				if dep == p {
+					continue
+				}
+				contains, err := dirContains(dep, target)
+				if err == nil && (contains || dep == target) {
+					visit(dep)
+				}
+			}
+		}
+		ordered = append(ordered, p)
+	}
+
+	for _, p := range sorted {
+		visit(p)
+	}
+	return ordered
+}
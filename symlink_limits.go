@@ -0,0 +1,98 @@
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrSymlinkLimit is wrapped by SymlinkLimitError.
+	ErrSymlinkLimit = errors.New("symlink limit exceeded")
+)
+
+// SymlinkLimit is the kind of limit that is exceeded, see SymlinkLimitError.
+type SymlinkLimit string
+
+const (
+	// SymlinkTargetLength limits the length of symlink targets.
+	SymlinkTargetLength SymlinkLimit = "target length"
+	// SymlinkDepth limits the number of symlinks that are followed in order to resolve a path.
+	SymlinkDepth SymlinkLimit = "resolution depth"
+)
+
+// SymlinkLimitError is returned by PrefixFS and VolumeFS in case that a path exceeds the
+// symlink limits of WithPrefixSymlinkLimits or WithVolumeSymlinkLimits.
+type SymlinkLimitError struct {
+	Limit SymlinkLimit
+	Path  string
+	// Max is the configured maximum that was exceeded.
+	Max int
+}
+
+func (e *SymlinkLimitError) Error() string {
+	return fmt.Sprintf("symlink %s of %d exceeded: %s", e.Limit, e.Max, e.Path)
+}
+
+func (e *SymlinkLimitError) Is(target error) bool {
+	return target == ErrSymlinkLimit
+}
+
+// symlinkLimits caps symlinks of untrusted content, a value <= 0 disables the respective limit.
+type symlinkLimits struct {
+	maxTargetLength int
+	maxDepth        int
+}
+
+// checkTarget checks the length of the target of the symlink name.
+func (l symlinkLimits) checkTarget(name, target string) error {
+	if l.maxTargetLength <= 0 || len(target) <= l.maxTargetLength {
+		return nil
+	}
+	return &SymlinkLimitError{Limit: SymlinkTargetLength, Path: name, Max: l.maxTargetLength}
+}
+
+// checkDepth counts the symlinks of the parent directories that are followed in order to resolve the
+// resolved path in fsys. In case that follow is true, the symlinks of the last path element are counted as well.
+// name is the path that is reported. Resolution errors are left to the actual operation.
+func (l symlinkLimits) checkDepth(fsys resolverFS, name, resolvedName string, follow bool) error {
+	if l.maxDepth <= 0 {
+		return nil
+	}
+
+	depth := 0
+	exceeded := func() error {
+		return &SymlinkLimitError{Limit: SymlinkDepth, Path: name, Max: l.maxDepth}
+	}
+
+	resolvedName, fi, symlinks, err := resolvePathWithSymlinks(fsys, resolvedName)
+	for {
+		if errors.Is(err, syscall.ELOOP) {
+			return exceeded()
+		}
+		if err != nil {
+			return nil
+		}
+
+		depth += len(symlinks)
+		if depth > l.maxDepth {
+			return exceeded()
+		}
+		if !follow || fi == nil || fi.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		// the last path element is followed as well
+		depth++
+		if depth > l.maxDepth {
+			return exceeded()
+		}
+		var linkedPath string
+		linkedPath, err = fsys.Readlink(resolvedName)
+		if err != nil {
+			return nil
+		}
+		resolvedName, fi, symlinks, err = resolvePathWithSymlinks(fsys, toAbsSymlink(linkedPath, resolvedName))
+	}
+}
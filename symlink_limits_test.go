@@ -0,0 +1,65 @@
+package backupfs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlinkLimits(t *testing.T) {
+	t.Parallel()
+
+	base := NewMemFS()
+	createFile(t, base, "/prefix/dir/file.txt", "file")
+	createSymlink(t, base, "/prefix/dir", "/prefix/link1")
+	require.NoError(t, base.Symlink("/prefix/link1", "/prefix/link2"))
+	require.NoError(t, base.Symlink("link2", "/prefix/link3"))
+	require.NoError(t, base.Symlink(strings.Repeat("a", 64), "/prefix/long"))
+
+	pfs, err := NewPrefixFSWithOptions(base, "/prefix", WithPrefixSymlinkLimits(32, 2))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		fsys FS
+		root string
+	}{
+		{name: "PrefixFS", fsys: pfs},
+		{name: "VolumeFS", fsys: NewVolumeFSWithOptions("", base, WithVolumeSymlinkLimits(32, 2)), root: "/prefix"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				require = require.New(t)
+				fsys    = tt.fsys
+				root    = tt.root
+			)
+
+			fileMustContainText(t, fsys, root+"/link2/file.txt", "file")
+			_, err := fsys.Stat(root + "/link3/file.txt")
+			require.ErrorIs(err, ErrSymlinkLimit)
+
+			var lerr *SymlinkLimitError
+			require.True(errors.As(err, &lerr))
+			require.Equal(SymlinkDepth, lerr.Limit)
+			require.Equal(2, lerr.Max)
+
+			// the symlink itself is not followed by Lstat
+			_, err = fsys.Lstat(root + "/link3")
+			require.NoError(err)
+
+			err = fsys.Symlink(strings.Repeat("b", 33), root+"/new")
+			require.True(errors.As(err, &lerr))
+			require.Equal(SymlinkTargetLength, lerr.Limit)
+			mustNotLExist(t, fsys, root+"/new")
+
+			_, err = fsys.Readlink(root + "/long")
+			require.ErrorIs(err, ErrSymlinkLimit)
+		})
+	}
+}
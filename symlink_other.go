@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package backupfs
+
+import "os"
+
+// osSymlinkWithType ignores the link type, as symlinks are not typed on these platforms.
+func osSymlinkWithType(oldname, newname string, _ LinkType) error {
+	return os.Symlink(oldname, newname)
+}
+
+func isSymlinkPrivilegeError(error) bool {
+	return false
+}
@@ -0,0 +1,75 @@
+package backupfs
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_DirSymlinkType(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require                   = require.New(t)
+		_, base, backup, backupFS = NewTestBackupFS("/base", "/backup")
+		dirLink                   = filepath.FromSlash("/test/dir_link")
+		fileLink                  = filepath.FromSlash("/test/file_link")
+	)
+
+	mkdirAll(t, base, "/test/dir", 0755)
+	createFile(t, base, "/test/file.txt", "content")
+	createSymlink(t, base, "/test/dir", dirLink)
+	createSymlink(t, base, "/test/file.txt", fileLink)
+
+	baseState := createFSState(t, base, "/")
+
+	require.NoError(backupFS.Remove(dirLink))
+	require.NoError(backupFS.Remove(fileLink))
+	// the target is removed as well, which requires the recorded link type upon restoration
+	removeAll(t, backupFS, "/test/dir")
+
+	require.Equal(LinkDir, linkTypeOf(backupFS.baseInfos.info(dirLink)))
+	require.Equal(LinkAuto, linkTypeOf(backupFS.baseInfos.info(fileLink)))
+
+	// the link type survives the serialization of the state
+	data, err := json.Marshal(backupFS)
+	require.NoError(err)
+	restored := NewBackupFS(base, backup)
+	require.NoError(json.Unmarshal(data, restored))
+	require.Equal(LinkDir, linkTypeOf(restored.baseInfos.info(dirLink)))
+
+	require.NoError(restored.Rollback())
+	mustEqualFSState(t, baseState, base, "/")
+}
+
+func TestOrderSymlinksByTarget(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	fsys := NewMemFS()
+	mkdirAll(t, fsys, "/usr/lib", 0755)
+	// /a -> /lib/dir -> through /lib -> /usr/lib
+	require.NoError(fsys.Symlink("/lib/dir", "/a"))
+	require.NoError(fsys.Symlink("/usr/lib", "/lib"))
+	require.NoError(fsys.Symlink("../lib", "/usr/b"))
+	// cycle
+	require.NoError(fsys.Symlink("/c", "/d"))
+	require.NoError(fsys.Symlink("/d", "/c"))
+
+	ordered := orderSymlinksByTarget(fsys, []string{
+		filepath.FromSlash("/usr/b"),
+		filepath.FromSlash("/a"),
+		filepath.FromSlash("/d"),
+		filepath.FromSlash("/lib"),
+		filepath.FromSlash("/c"),
+	})
+	require.Equal([]string{
+		filepath.FromSlash("/lib"),
+		filepath.FromSlash("/a"),
+		filepath.FromSlash("/d"),
+		filepath.FromSlash("/c"),
+		filepath.FromSlash("/usr/b"),
+	}, ordered)
+}
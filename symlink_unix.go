@@ -0,0 +1,15 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package backupfs
+
+import "os"
+
+// osSymlinkWithType ignores the link type, as symlinks are not typed on unix filesystems.
+func osSymlinkWithType(oldname, newname string, _ LinkType) error {
+	return os.Symlink(oldname, newname)
+}
+
+func isSymlinkPrivilegeError(error) bool {
+	return false
+}
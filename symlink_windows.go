@@ -0,0 +1,137 @@
+package backupfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unicode/utf16"
+)
+
+const (
+	symbolicLinkFlagDirectory                             = 0x1
+	symbolicLinkFlagAllowUnprivilegedCreate               = 0x2
+	errorPrivilegeNotHeld                   syscall.Errno = 1314
+	fsctlSetReparsePoint                                  = 0x000900A4
+	ioReparseTagMountPoint                                = 0xA0000003
+)
+
+// osSymlinkWithType creates file and directory symlinks with the corresponding flag instead of
+// detecting the type of the target, which does not exist in case that it is restored later on.
+func osSymlinkWithType(oldname, newname string, typ LinkType) error {
+	switch typ {
+	case LinkAuto:
+		return os.Symlink(oldname, newname)
+	case LinkJunction:
+		err := createJunction(oldname, newname)
+		if err != nil {
+			return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+		}
+		return nil
+	}
+
+	target, err := syscall.UTF16PtrFromString(filepath.FromSlash(oldname))
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	link, err := syscall.UTF16PtrFromString(newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+
+	var flags uint32
+	if typ == LinkDir {
+		flags |= symbolicLinkFlagDirectory
+	}
+
+	// the unprivileged flag requires the Developer Mode and is rejected by older Windows versions
+	err = syscall.CreateSymbolicLink(link, target, flags|symbolicLinkFlagAllowUnprivilegedCreate)
+	if err != nil {
+		err = syscall.CreateSymbolicLink(link, target, flags)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func isSymlinkPrivilegeError(err error) bool {
+	return errors.Is(err, errorPrivilegeNotHeld)
+}
+
+// createJunction creates a directory junction at newname that points to the absolute path of oldname.
+func createJunction(oldname, newname string) (err error) {
+	target := filepath.FromSlash(oldname)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(newname), target)
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	err = os.Mkdir(newname, 0777)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(newname)
+		}
+	}()
+
+	name, err := syscall.UTF16PtrFromString(newname)
+	if err != nil {
+		return err
+	}
+	h, err := syscall.CreateFile(
+		name,
+		syscall.GENERIC_WRITE,
+		0,
+		nil,
+		syscall.OPEN_EXISTING,
+		syscall.FILE_FLAG_OPEN_REPARSE_POINT|syscall.FILE_FLAG_BACKUP_SEMANTICS,
+		0,
+	)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+
+	buf := mountPointReparseBuffer(target)
+	var returned uint32
+	return syscall.DeviceIoControl(h, fsctlSetReparsePoint, &buf[0], uint32(len(buf)), nil, 0, &returned, nil)
+}
+
+// mountPointReparseBuffer encodes the REPARSE_DATA_BUFFER of a mount point
+func mountPointReparseBuffer(target string) []byte {
+	var (
+		substitute = utf16.Encode([]rune(`\??\` + target))
+		print      = utf16.Encode([]rune(target))
+		// both names are null terminated
+		pathBufferLen = (len(substitute) + 1 + len(print) + 1) * 2
+		buf           = make([]byte, 8+8+pathBufferLen)
+	)
+
+	binary.LittleEndian.PutUint32(buf[0:], ioReparseTagMountPoint)
+	binary.LittleEndian.PutUint16(buf[4:], uint16(8+pathBufferLen))
+	// substitute name offset and length
+	binary.LittleEndian.PutUint16(buf[8:], 0)
+	binary.LittleEndian.PutUint16(buf[10:], uint16(len(substitute)*2))
+	// print name offset and length
+	binary.LittleEndian.PutUint16(buf[12:], uint16((len(substitute)+1)*2))
+	binary.LittleEndian.PutUint16(buf[14:], uint16(len(print)*2))
+
+	offset := 16
+	for _, c := range substitute {
+		binary.LittleEndian.PutUint16(buf[offset:], c)
+		offset += 2
+	}
+	offset += 2
+	for _, c := range print {
+		binary.LittleEndian.PutUint16(buf[offset:], c)
+		offset += 2
+	}
+	return buf
+}
@@ -0,0 +1,289 @@
+package backupfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// assert interfaces implemented
+var (
+	_ FS   = (*TeeWriteFS)(nil)
+	_ File = (*teeFile)(nil)
+)
+
+// NewTeeWriteFS creates a filesystem that reads from primary and applies every modification
+// to primary and afterwards to replica, which keeps a warm standby copy of the modified files
+// on e.g. another volume. Used as the base filesystem of a BackupFS, rollbacks are mirrored as well.
+//
+// In strict mode errors of the replica are returned, in best effort mode they are only recorded,
+// see ReplicaErr. In both modes the primary is modified first and is not reverted in case
+// that the replica fails.
+func NewTeeWriteFS(primary, replica FS, strict bool) *TeeWriteFS {
+	return &TeeWriteFS{
+		primary: primary,
+		replica: replica,
+		strict:  strict,
+	}
+}
+
+// TeeWriteFS mirrors all modifications of a primary filesystem to a replica filesystem.
+type TeeWriteFS struct {
+	primary FS
+	replica FS
+	strict  bool
+
+	mu sync.Mutex
+	// replica errors in best effort mode
+	errs []error
+}
+
+// Name returns the name of this FileSystem
+func (t *TeeWriteFS) Name() string {
+	return "TeeWriteFS"
+}
+
+// Unwrap returns the primary filesystem.
+func (t *TeeWriteFS) Unwrap() FS {
+	return t.primary
+}
+
+// Replica returns the filesystem that all modifications are mirrored to.
+func (t *TeeWriteFS) Replica() FS {
+	return t.replica
+}
+
+// ReplicaErr returns all errors of the replica that occurred in best effort mode
+// since the last call and resets them.
+func (t *TeeWriteFS) ReplicaErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := errors.Join(t.errs...)
+	t.errs = nil
+	return err
+}
+
+// mirror applies the modification to the replica in case that it succeeded on the primary.
+func (t *TeeWriteFS) mirror(err error, f func(fsys FS) error) error {
+	if err != nil {
+		return err
+	}
+	return t.replicaErr(f(t.replica))
+}
+
+// replicaErr returns the error in strict mode and records it in best effort mode.
+func (t *TeeWriteFS) replicaErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if t.strict {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errs = append(t.errs, err)
+	return nil
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (t *TeeWriteFS) Create(name string) (File, error) {
+	return t.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (t *TeeWriteFS) Mkdir(name string, perm fs.FileMode) error {
+	return t.mirror(t.primary.Mkdir(name, perm), func(fsys FS) error {
+		return fsys.Mkdir(name, perm)
+	})
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (t *TeeWriteFS) MkdirAll(name string, perm fs.FileMode) error {
+	return t.mirror(t.primary.MkdirAll(name, perm), func(fsys FS) error {
+		return fsys.MkdirAll(name, perm)
+	})
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (t *TeeWriteFS) Open(name string) (File, error) {
+	return t.primary.Open(name)
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+// Files that are opened for writing are opened in both filesystems.
+func (t *TeeWriteFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := t.primary.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+		return f, nil
+	}
+
+	// the replica is only written to
+	rf, err := t.replica.OpenFile(name, flag&^os.O_RDWR|os.O_WRONLY, perm)
+	if err != nil {
+		err = t.replicaErr(err)
+		if err != nil {
+			return nil, errors.Join(err, f.Close())
+		}
+		// best effort, continue without replica
+		return f, nil
+	}
+	return &teeFile{File: f, replica: rf, fsys: t, append: flag&os.O_APPEND != 0}, nil
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (t *TeeWriteFS) Remove(name string) error {
+	return t.mirror(t.primary.Remove(name), func(fsys FS) error {
+		return fsys.Remove(name)
+	})
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (t *TeeWriteFS) RemoveAll(name string) error {
+	return t.mirror(t.primary.RemoveAll(name), func(fsys FS) error {
+		return fsys.RemoveAll(name)
+	})
+}
+
+// Rename renames a file.
+func (t *TeeWriteFS) Rename(oldname, newname string) error {
+	return t.mirror(t.primary.Rename(oldname, newname), func(fsys FS) error {
+		return fsys.Rename(oldname, newname)
+	})
+}
+
+// Stat returns a FileInfo describing the named file of the primary filesystem.
+func (t *TeeWriteFS) Stat(name string) (fs.FileInfo, error) {
+	return t.primary.Stat(name)
+}
+
+// Chmod changes the mode of the named file to mode.
+func (t *TeeWriteFS) Chmod(name string, mode fs.FileMode) error {
+	return t.mirror(t.primary.Chmod(name, mode), func(fsys FS) error {
+		return fsys.Chmod(name, mode)
+	})
+}
+
+// Chown changes the uid and gid of the named file.
+func (t *TeeWriteFS) Chown(name string, uid, gid int) error {
+	return t.mirror(t.primary.Chown(name, uid, gid), func(fsys FS) error {
+		return fsys.Chown(name, uid, gid)
+	})
+}
+
+// Chtimes changes the access and modification times of the named file
+func (t *TeeWriteFS) Chtimes(name string, atime, mtime time.Time) error {
+	return t.mirror(t.primary.Chtimes(name, atime, mtime), func(fsys FS) error {
+		return fsys.Chtimes(name, atime, mtime)
+	})
+}
+
+// Truncate changes the size of the named file.
+func (t *TeeWriteFS) Truncate(name string, size int64) error {
+	return t.mirror(t.primary.Truncate(name, size), func(fsys FS) error {
+		return fsys.Truncate(name, size)
+	})
+}
+
+// ReadDir reads the named directory of the primary filesystem.
+func (t *TeeWriteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return t.primary.ReadDir(name)
+}
+
+// Lstat returns a FileInfo describing the named file of the primary filesystem without following symlinks.
+func (t *TeeWriteFS) Lstat(name string) (fs.FileInfo, error) {
+	return t.primary.Lstat(name)
+}
+
+// Symlink creates a symlink at newname that points to oldname.
+func (t *TeeWriteFS) Symlink(oldname, newname string) error {
+	return t.mirror(t.primary.Symlink(oldname, newname), func(fsys FS) error {
+		return fsys.Symlink(oldname, newname)
+	})
+}
+
+// Readlink returns the target of the symlink of the primary filesystem.
+func (t *TeeWriteFS) Readlink(name string) (string, error) {
+	return t.primary.Readlink(name)
+}
+
+// Lchown does not fallback to chown. It does return an error in case that lchown cannot be called.
+func (t *TeeWriteFS) Lchown(name string, uid, gid int) error {
+	return t.mirror(t.primary.Lchown(name, uid, gid), func(fsys FS) error {
+		return fsys.Lchown(name, uid, gid)
+	})
+}
+
+// teeFile writes to the file of the primary and of the replica filesystem.
+// The replica is written at the offset of the primary file, as reads and seeks only move the
+// offset of the primary file.
+type teeFile struct {
+	File
+	replica File
+	fsys    *TeeWriteFS
+	append  bool
+}
+
+func (f *teeFile) Write(p []byte) (int, error) {
+	off, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.File.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if f.append {
+		_, err = f.replica.Write(p[:n])
+	} else {
+		_, err = f.replica.WriteAt(p[:n], off)
+	}
+	return n, f.fsys.replicaErr(err)
+}
+
+func (f *teeFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *teeFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	if err != nil {
+		return n, err
+	}
+	_, err = f.replica.WriteAt(p[:n], off)
+	return n, f.fsys.replicaErr(err)
+}
+
+func (f *teeFile) Truncate(size int64) error {
+	err := f.File.Truncate(size)
+	if err != nil {
+		return err
+	}
+	return f.fsys.replicaErr(f.replica.Truncate(size))
+}
+
+func (f *teeFile) Sync() error {
+	err := f.File.Sync()
+	if err != nil {
+		return err
+	}
+	return f.fsys.replicaErr(f.replica.Sync())
+}
+
+func (f *teeFile) Close() error {
+	err := f.File.Close()
+	rerr := f.fsys.replicaErr(f.replica.Close())
+	return errors.Join(err, rerr)
+}
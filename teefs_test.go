@@ -0,0 +1,91 @@
+package backupfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeeWriteFS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		primary = NewMemFS()
+		replica = NewMemFS()
+		tee     = NewTeeWriteFS(primary, replica, true)
+	)
+
+	createFile(t, tee, "/test/file.txt", "original")
+	createFile(t, tee, "/test/dir/nested.txt", "nested")
+	createSymlink(t, tee, "/test/file.txt", "/test/link")
+	initialState := createFSState(t, primary, "/")
+	mustEqualFSState(t, initialState, replica, "/")
+
+	backupFS := NewBackupFS(tee, NewMemFS())
+
+	// reads only move the offset of the primary file
+	f, err := backupFS.OpenFile("/test/file.txt", os.O_RDWR, 0)
+	require.NoError(err)
+	_, err = io.ReadFull(f, make([]byte, 4))
+	require.NoError(err)
+	_, err = f.WriteString("INAL")
+	require.NoError(err)
+	_, err = f.WriteAt([]byte("ORIG"), 0)
+	require.NoError(err)
+	require.NoError(f.Close())
+	fileMustContainText(t, replica, "/test/file.txt", "ORIGINAL")
+
+	f, err = backupFS.OpenFile("/test/file.txt", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(err)
+	_, err = f.WriteString("|appended")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	removeAll(t, backupFS, "/test/dir")
+	require.NoError(backupFS.Rename("/test/link", "/test/moved"))
+	require.NoError(backupFS.Truncate("/test/moved", 4))
+	require.NoError(backupFS.Chmod("/test/file.txt", 0600))
+
+	mustEqualFSState(t, createFSState(t, primary, "/"), replica, "/")
+	fileMustContainText(t, replica, "/test/file.txt", "ORIG")
+
+	// rollbacks are mirrored as well
+	require.NoError(backupFS.Rollback())
+	mustEqualFSState(t, initialState, primary, "/")
+	mustEqualFSState(t, initialState, replica, "/")
+	require.NoError(tee.ReplicaErr())
+}
+
+func TestTeeWriteFS_ReplicaErrors(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		primary = NewMemFS()
+		replica = NewMemFS()
+	)
+	mkdirAll(t, primary, "/test", 0755)
+
+	// the replica is missing the parent directory
+	bestEffort := NewTeeWriteFS(primary, replica, false)
+	createFile(t, bestEffort, "/test/file.txt", "content")
+	fileMustContainText(t, primary, "/test/file.txt", "content")
+	mustNotExist(t, replica, "/test/file.txt")
+	require.NoError(bestEffort.Chmod("/test/file.txt", 0600))
+
+	err := bestEffort.ReplicaErr()
+	require.ErrorIs(err, fs.ErrNotExist)
+	require.Len(err.(interface{ Unwrap() []error }).Unwrap(), 2)
+	require.NoError(bestEffort.ReplicaErr())
+
+	strict := NewTeeWriteFS(primary, replica, true)
+	_, err = strict.Create("/test/other.txt")
+	require.ErrorIs(err, fs.ErrNotExist)
+	require.ErrorIs(strict.Remove("/test/file.txt"), fs.ErrNotExist)
+	// the primary is modified nonetheless
+	mustNotExist(t, primary, "/test/file.txt")
+}
@@ -9,32 +9,110 @@ import (
 	"path/filepath"
 )
 
+// TempNameFunc returns a candidate name for a temporary file or directory with the passed prefix.
+// It is called again in case that the candidate already exists.
+type TempNameFunc func(prefix string) string
+
+// RandomTempName is the default TempNameFunc which appends a random alphanumeric suffix
+// that is generated with crypto/rand to the prefix.
+func RandomTempName(prefix string) string {
+	const randLen = 16
+	return randStringFromCharSetWithPrefix(randLen, charSetAlphaNum, prefix)
+}
+
+// TempOption allows to manipulate the behavior of MkdirTemp and CreateTemp.
+type TempOption func(*tempOptions)
+
+type tempOptions struct {
+	nameFunc TempNameFunc
+}
+
+// WithTempNameFunc replaces the naming strategy of the temporary files and directories (default: RandomTempName).
+func WithTempNameFunc(f TempNameFunc) TempOption {
+	return func(o *tempOptions) {
+		if f != nil {
+			o.nameFunc = f
+		}
+	}
+}
+
+// maxTempAttempts is the number of names that are tried before giving up due to collisions.
+const maxTempAttempts = 10000
+
 // TempDir creates a new temporary directory in the directory dir with a name
 // that has the prefix prefix and returns the path of the new directory.
 // If dir is the empty string, TempDir uses the default OS temp directory.
+// TempDir is equivalent to MkdirTemp without any options.
 func TempDir(fsys FS, dir, prefix string) (name string, err error) {
-	if dir == "" {
-		dir = os.TempDir()
+	return MkdirTemp(fsys, dir, prefix)
+}
+
+// MkdirTemp creates a new temporary directory in the directory dir with a name
+// that has the prefix prefix and returns the path of the new directory.
+// If dir is the empty string, MkdirTemp uses the default OS temp directory.
+// In case that the generated name already exists, a new name is generated.
+func MkdirTemp(fsys FS, dir, prefix string, opts ...TempOption) (name string, err error) {
+	dir, o, err := prepareTemp(fsys, dir, opts)
+	if err != nil {
+		return "", err
 	}
 
-	const (
-		randLen = 16
-		perm    = 0o700
-	)
+	for i := 0; i < maxTempAttempts; i++ {
+		try := filepath.Join(dir, o.nameFunc(prefix))
+		err = fsys.Mkdir(try, 0o700)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return try, nil
+	}
+	return "", &fs.PathError{Op: "mkdirtemp", Path: filepath.Join(dir, prefix+"*"), Err: fs.ErrExist}
+}
 
-	for i := 0; i < 10000; i++ {
-		tmpDirName := randStringFromCharSetWithPrefix(randLen, charSetAlphaNum, prefix)
-		try := filepath.Join(dir, tmpDirName)
-		err = fsys.MkdirAll(try, perm)
+// CreateTemp creates a new temporary file in the directory dir with a name that has the prefix prefix,
+// opens the file for reading and writing and returns the resulting file.
+// If dir is the empty string, CreateTemp uses the default OS temp directory.
+// In case that the generated name already exists, a new name is generated.
+func CreateTemp(fsys FS, dir, prefix string, opts ...TempOption) (f File, err error) {
+	dir, o, err := prepareTemp(fsys, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < maxTempAttempts; i++ {
+		try := filepath.Join(dir, o.nameFunc(prefix))
+		f, err = fsys.OpenFile(try, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
 		if errors.Is(err, fs.ErrExist) {
 			continue
 		}
-		if err == nil {
-			name = try
+		if err != nil {
+			return nil, err
 		}
-		break
+		return f, nil
+	}
+	return nil, &fs.PathError{Op: "createtemp", Path: filepath.Join(dir, prefix+"*"), Err: fs.ErrExist}
+}
+
+// prepareTemp applies the options and creates the parent directory of temporary files and directories.
+func prepareTemp(fsys FS, dir string, opts []TempOption) (string, *tempOptions, error) {
+	o := &tempOptions{
+		nameFunc: RandomTempName,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	err := fsys.MkdirAll(dir, 0o700)
+	if err != nil {
+		return "", nil, err
 	}
-	return
+	return dir, o, nil
 }
 
 const (
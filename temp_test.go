@@ -0,0 +1,97 @@
+package backupfs
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMkdirTemp_Collisions(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	fsys := NewMemFS()
+
+	// every name is generated twice, so the second directory collides with the first one
+	var calls int
+	sequence := func(prefix string) string {
+		calls++
+		return fmt.Sprintf("%s%d", prefix, (calls-1)/2)
+	}
+
+	first, err := MkdirTemp(fsys, "/tmp", "test-", WithTempNameFunc(sequence))
+	require.NoError(err)
+	require.Equal("/tmp/test-0", first)
+
+	second, err := MkdirTemp(fsys, "/tmp", "test-", WithTempNameFunc(sequence))
+	require.NoError(err)
+	require.Equal("/tmp/test-1", second)
+	require.Equal(3, calls)
+
+	// a constant name cannot be created twice
+	constant := func(prefix string) string { return prefix }
+	_, err = MkdirTemp(fsys, "/tmp", "test-0", WithTempNameFunc(constant))
+	require.ErrorIs(err, fs.ErrExist)
+
+	f, err := CreateTemp(fsys, "/tmp", "test-0", WithTempNameFunc(constant))
+	require.ErrorIs(err, fs.ErrExist)
+	require.Nil(f)
+}
+
+func TestMkdirTemp_Parallel(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		fsys    = NewMemFS()
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		dirs    = make(map[string]struct{})
+		files   = make(map[string]struct{})
+	)
+
+	const workers = 32
+	errs := make(chan error, 2*workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			dir, err := TempDir(fsys, "/tmp", "dir-")
+			if err != nil {
+				errs <- err
+				return
+			}
+			f, err := CreateTemp(fsys, "/tmp", "file-")
+			if err != nil {
+				errs <- err
+				return
+			}
+			errs <- f.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			dirs[dir] = struct{}{}
+			files[f.Name()] = struct{}{}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(err)
+	}
+	require.Len(dirs, workers)
+	require.Len(files, workers)
+
+	for name := range files {
+		require.True(strings.HasPrefix(name, "/tmp/file-"), name)
+		fi, err := fsys.Stat(name)
+		require.NoError(err)
+		require.True(fi.Mode().IsRegular())
+	}
+}
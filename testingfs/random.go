@@ -0,0 +1,174 @@
+package testingfs
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jxsl13/backupfs"
+)
+
+// RandomConfig configures RunRandomTransactions.
+type RandomConfig struct {
+	// Seed of the random operation sequences. A seed of zero is replaced with the current time.
+	// The seed is logged, which allows to reproduce failures.
+	Seed int64
+	// Runs is the number of transactions, each starting with a fresh base and backup filesystem.
+	// Defaults to 100.
+	Runs int
+	// Ops is the number of operations per transaction. Defaults to 20.
+	Ops int
+}
+
+// RunRandomTransactions executes transactions of random operations like create, remove, rename, symlink and chmod
+// against a BackupFS with a base filesystem created by newBase and a backup filesystem created by newBackup.
+// Every transaction is rolled back and must restore the initial state of the base filesystem exactly.
+// Operations that fail, e.g. because their path does not exist, are part of the sequence as well, as failing
+// operations must not corrupt the bookkeeping of the BackupFS either.
+// A failure reports the seed and the operation sequence of the failing transaction.
+func RunRandomTransactions(t *testing.T, newBase, newBackup Backend, cfg RandomConfig, opts ...backupfs.BackupFSOption) {
+	t.Helper()
+
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.Runs <= 0 {
+		cfg.Runs = 100
+	}
+	if cfg.Ops <= 0 {
+		cfg.Ops = 20
+	}
+	t.Logf("random transactions with seed %d", cfg.Seed)
+
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	for run := 0; run < cfg.Runs; run++ {
+		base := newBase(t)
+		prepare(t, base)
+		before := treeState(t, base)
+
+		g := &opGenerator{
+			rnd:      rnd,
+			symlinks: backupfs.SupportsSymlinks(base),
+		}
+		fsys := backupfs.NewBackupFS(base, newBackup(t), opts...)
+
+		ops := make([]string, 0, cfg.Ops)
+		for i := 0; i < cfg.Ops; i++ {
+			ops = append(ops, g.apply(fsys))
+		}
+
+		err := fsys.Rollback()
+		if err != nil {
+			t.Fatalf("seed %d, run %d: failed to roll back: %v\noperations:\n%s", cfg.Seed, run, err, strings.Join(ops, "\n"))
+		}
+
+		after := treeState(t, base)
+		if !reflect.DeepEqual(before, after) {
+			t.Fatalf("seed %d, run %d: rollback did not restore the base filesystem:\nexpected: %v\ngot:      %v\noperations:\n%s",
+				cfg.Seed, run, before, after, strings.Join(ops, "\n"))
+		}
+	}
+}
+
+var (
+	// randomDirs contains the directories of prepare and directories that do not exist initially.
+	randomDirs = []string{
+		"/",
+		"/etc",
+		"/etc/app",
+		"/var/lib/app",
+		"/var/lib/app/data",
+		"/opt",
+		"/opt/new",
+	}
+	randomNames = []string{
+		"config.yaml",
+		"state.db",
+		"cache.db",
+		"data",
+		"app",
+		"new",
+	}
+)
+
+// opGenerator applies random operations to a BackupFS.
+type opGenerator struct {
+	rnd      *rand.Rand
+	symlinks bool
+}
+
+// path returns a random path that may or may not exist.
+// The root directory itself is never returned, as it is not restored by a rollback.
+func (g *opGenerator) path() string {
+	dir := randomDirs[g.rnd.Intn(len(randomDirs))]
+	if dir != "/" && g.rnd.Intn(5) == 0 {
+		return dir
+	}
+	return path.Join(dir, randomNames[g.rnd.Intn(len(randomNames))])
+}
+
+// apply applies a single random operation and returns its description.
+func (g *opGenerator) apply(fsys *backupfs.BackupFS) string {
+	name := g.path()
+	for {
+		switch g.rnd.Intn(9) {
+		case 0:
+			content := fmt.Sprintf("content %d", g.rnd.Intn(1000))
+			return describe(fmt.Sprintf("write %s %q", name, content), writeContent(fsys, name, content))
+		case 1:
+			return describe("mkdir "+name, fsys.Mkdir(name, 0755))
+		case 2:
+			return describe("mkdirall "+name, fsys.MkdirAll(name, 0755))
+		case 3:
+			return describe("remove "+name, fsys.Remove(name))
+		case 4:
+			return describe("removeall "+name, fsys.RemoveAll(name))
+		case 5:
+			newName := g.path()
+			return describe(fmt.Sprintf("rename %s %s", name, newName), fsys.Rename(name, newName))
+		case 6:
+			if !g.symlinks {
+				continue
+			}
+			target := g.path()
+			return describe(fmt.Sprintf("symlink %s %s", target, name), fsys.Symlink(target, name))
+		case 7:
+			if runtime.GOOS == "windows" {
+				// permission bits are not supported on windows
+				continue
+			}
+			perm := os.FileMode(0600 | g.rnd.Intn(0100)<<3)
+			return describe(fmt.Sprintf("chmod %s %o", name, perm), fsys.Chmod(name, perm))
+		case 8:
+			size := int64(g.rnd.Intn(4))
+			return describe(fmt.Sprintf("truncate %s %d", name, size), fsys.Truncate(name, size))
+		}
+	}
+}
+
+// writeContent creates or overwrites the named file.
+func writeContent(fsys backupfs.FS, name, content string) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(content))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func describe(op string, err error) string {
+	if err != nil {
+		return fmt.Sprintf("%s: %v", op, err)
+	}
+	return op
+}
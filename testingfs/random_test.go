@@ -0,0 +1,27 @@
+package testingfs
+
+import (
+	"testing"
+
+	"github.com/jxsl13/backupfs"
+)
+
+func TestRunRandomTransactions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("memfs", func(t *testing.T) {
+		RunRandomTransactions(t, MemBackend, MemBackend, RandomConfig{Seed: 1, Runs: 200})
+	})
+
+	t.Run("tempdir", func(t *testing.T) {
+		RunRandomTransactions(t, TempDirBackend, MemBackend, RandomConfig{Seed: 2, Runs: 50})
+	})
+
+	t.Run("state index", func(t *testing.T) {
+		RunRandomTransactions(t, TempDirBackend, TempDirBackend, RandomConfig{Seed: 3, Runs: 50}, backupfs.WithStateIndex(backupfs.StateIndexDisk))
+	})
+
+	t.Run("hardlinks", func(t *testing.T) {
+		RunRandomTransactions(t, TempDirBackend, TempDirBackend, RandomConfig{Seed: 31676, Runs: 50}, backupfs.WithHardlinkBackups(true))
+	})
+}
@@ -0,0 +1,238 @@
+package testingfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/jxsl13/backupfs"
+)
+
+// Backend creates a new empty filesystem for a single test, e.g. an in-memory filesystem,
+// a sandbox directory (see NewTempDirPrefixFS) or a client of a local test double of a remote storage.
+// Cleanup is expected to be registered with t.Cleanup.
+type Backend func(t testing.TB) backupfs.FS
+
+// MemBackend is a Backend that creates a new backupfs.MemFS for every test.
+func MemBackend(t testing.TB) backupfs.FS {
+	return backupfs.NewMemFS()
+}
+
+// TempDirBackend is a Backend that creates a new sandbox directory for every test, see NewTempDirPrefixFS.
+func TempDirBackend(t testing.TB) backupfs.FS {
+	return NewTempDirPrefixFS(t)
+}
+
+// RunTransactionSuite runs the transactional tests of the BackupFS with a base filesystem created by
+// newBase and a backup filesystem created by newBackup, which allows to verify that a filesystem
+// implementation can be used as either of both. Every test modifies the base filesystem via the BackupFS
+// and requires the base filesystem to be restored exactly by a Rollback.
+// Symlink tests are skipped in case that the base filesystem does not support symlinks, see
+// backupfs.SupportsSymlinks.
+func RunTransactionSuite(t *testing.T, newBase, newBackup Backend, opts ...backupfs.BackupFSOption) {
+	for _, tc := range transactionTests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			base := newBase(t)
+			if tc.symlinks && !backupfs.SupportsSymlinks(base) {
+				t.Skip("base filesystem does not support symlinks")
+			}
+
+			prepare(t, base)
+			before := treeState(t, base)
+
+			fsys := backupfs.NewBackupFS(base, newBackup(t), opts...)
+			tc.modify(t, fsys)
+			if reflect.DeepEqual(before, treeState(t, base)) {
+				t.Fatalf("base filesystem was not modified")
+			}
+
+			err := fsys.Rollback()
+			if err != nil {
+				t.Fatalf("failed to roll back: %v", err)
+			}
+
+			after := treeState(t, base)
+			if !reflect.DeepEqual(before, after) {
+				t.Fatalf("rollback did not restore the base filesystem:\nexpected: %v\ngot:      %v", before, after)
+			}
+		})
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		base := newBase(t)
+		prepare(t, base)
+
+		fsys := backupfs.NewBackupFS(base, newBackup(t), opts...)
+		writeFile(t, fsys, "/etc/app/config.yaml", "modified")
+		mustRemoveAll(t, fsys, "/var/lib/app")
+		modified := treeState(t, base)
+
+		err := fsys.Commit()
+		if err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		err = fsys.Rollback()
+		if err != nil {
+			t.Fatalf("failed to roll back: %v", err)
+		}
+
+		if got := treeState(t, base); !reflect.DeepEqual(modified, got) {
+			t.Fatalf("commit did not keep the modifications:\nexpected: %v\ngot:      %v", modified, got)
+		}
+	})
+}
+
+type transactionTest struct {
+	name     string
+	symlinks bool
+	modify   func(t *testing.T, fsys *backupfs.BackupFS)
+}
+
+var transactionTests = []transactionTest{
+	{
+		name: "overwrite",
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			writeFile(t, fsys, "/etc/app/config.yaml", "modified")
+		},
+	},
+	{
+		name: "create",
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			mustNoError(t, fsys.MkdirAll("/opt/new/dir", 0755))
+			writeFile(t, fsys, "/opt/new/dir/file.txt", "new")
+			writeFile(t, fsys, "/etc/app/new.yaml", "new")
+		},
+	},
+	{
+		name: "remove",
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			mustNoError(t, fsys.Remove("/etc/app/config.yaml"))
+		},
+	},
+	{
+		name: "remove_all",
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			mustRemoveAll(t, fsys, "/var/lib/app")
+		},
+	},
+	{
+		name: "rename",
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			mustNoError(t, fsys.Rename("/etc/app/config.yaml", "/etc/app/renamed.yaml"))
+		},
+	},
+	{
+		name: "chmod",
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			if runtime.GOOS == "windows" {
+				t.Skip("permission bits are not supported on windows")
+			}
+			mustNoError(t, fsys.Chmod("/etc/app/config.yaml", 0600))
+		},
+	},
+	{
+		name: "truncate",
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			mustNoError(t, fsys.Truncate("/var/lib/app/data/state.db", 1))
+		},
+	},
+	{
+		name:     "symlink",
+		symlinks: true,
+		modify: func(t *testing.T, fsys *backupfs.BackupFS) {
+			mustNoError(t, fsys.Symlink("/var/lib/app", "/etc/app/data"))
+			mustNoError(t, fsys.Remove("/etc/app/config.yaml"))
+			mustNoError(t, fsys.Symlink("/var/lib/app/data/state.db", "/etc/app/config.yaml"))
+		},
+	},
+}
+
+// prepare creates the initial content of the base filesystem.
+func prepare(t *testing.T, fsys backupfs.FS) {
+	t.Helper()
+
+	mustNoError(t, fsys.MkdirAll("/etc/app", 0755))
+	mustNoError(t, fsys.MkdirAll("/var/lib/app/data", 0755))
+	writeFile(t, fsys, "/etc/app/config.yaml", "config")
+	writeFile(t, fsys, "/var/lib/app/data/state.db", "state")
+	writeFile(t, fsys, "/var/lib/app/data/cache.db", "cache")
+}
+
+// fileState describes a file with all properties that a rollback restores.
+type fileState struct {
+	Type    fs.FileMode
+	Perm    fs.FileMode
+	Content string
+	Target  string
+}
+
+// treeState returns the state of all files of fsys keyed by their path.
+func treeState(t *testing.T, fsys backupfs.FS) map[string]fileState {
+	t.Helper()
+
+	state := make(map[string]fileState)
+	err := backupfs.Walk(fsys, string(filepath.Separator), func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		s := fileState{Type: info.Mode().Type()}
+		if runtime.GOOS != "windows" {
+			s.Perm = info.Mode().Perm()
+		}
+		switch {
+		case info.Mode().IsRegular():
+			s.Content = readFile(t, fsys, path)
+		case info.Mode()&os.ModeSymlink != 0:
+			s.Target, err = fsys.Readlink(path)
+			if err != nil {
+				return err
+			}
+		case info.IsDir() && path == string(filepath.Separator):
+			// the root directory is never restored
+			s.Perm = 0
+		}
+		state[filepath.ToSlash(path)] = s
+		return nil
+	})
+	mustNoError(t, err)
+	return state
+}
+
+func writeFile(t *testing.T, fsys backupfs.FS, name, content string) {
+	t.Helper()
+
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	mustNoError(t, err)
+	_, err = f.Write([]byte(content))
+	mustNoError(t, err)
+	mustNoError(t, f.Close())
+}
+
+func readFile(t *testing.T, fsys backupfs.FS, name string) string {
+	t.Helper()
+
+	f, err := fsys.Open(name)
+	mustNoError(t, err)
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	mustNoError(t, err)
+	return string(b)
+}
+
+func mustRemoveAll(t *testing.T, fsys backupfs.FS, name string) {
+	t.Helper()
+	mustNoError(t, fsys.RemoveAll(name))
+}
+
+func mustNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
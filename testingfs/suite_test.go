@@ -0,0 +1,30 @@
+package testingfs
+
+import (
+	"testing"
+
+	"github.com/jxsl13/backupfs"
+)
+
+func TestRunTransactionSuite(t *testing.T) {
+	t.Parallel()
+
+	t.Run("memfs", func(t *testing.T) {
+		RunTransactionSuite(t, MemBackend, MemBackend)
+	})
+
+	t.Run("tempdir", func(t *testing.T) {
+		RunTransactionSuite(t, TempDirBackend, MemBackend)
+	})
+
+	t.Run("dedup", func(t *testing.T) {
+		RunTransactionSuite(t, TempDirBackend, TempDirBackend, backupfs.WithBackupLayout(backupfs.LayoutDedup))
+	})
+
+	t.Run("nosymlinks", func(t *testing.T) {
+		noSymlinks := func(t testing.TB) backupfs.FS {
+			return backupfs.AdaptNoSymlinkFS(backupfs.NewMemFS())
+		}
+		RunTransactionSuite(t, noSymlinks, noSymlinks)
+	})
+}
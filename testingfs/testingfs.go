@@ -0,0 +1,113 @@
+// Package testingfs provides helpers that allow to integration test code that uses
+// the backupfs package against an isolated on-disk sandbox.
+package testingfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jxsl13/backupfs"
+)
+
+// NewTempDirPrefixFS creates a new temporary directory in the default OS temp directory and returns
+// a PrefixFS that uses the temporary directory as its root directory.
+// The temporary directory is named after the test and removed when the test and all of its subtests complete.
+func NewTempDirPrefixFS(t testing.TB) *backupfs.PrefixFS {
+	t.Helper()
+
+	var osFS = backupfs.NewOSFS()
+	tempDir, err := backupfs.TempDir(osFS, "", dirPrefix(t))
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("failed to remove temp dir: %s: %v", tempDir, err)
+		}
+	})
+
+	// on windows the temp dir contains a volume which cannot be part of the prefix
+	volume := filepath.VolumeName(tempDir)
+	volumeFS := backupfs.NewVolumeFS(volume, osFS)
+	tempDir = backupfs.TrimVolume(tempDir)
+
+	return backupfs.NewPrefixFS(volumeFS, tempDir)
+}
+
+// NewBackupFS creates an isolated sandbox (see NewTempDirPrefixFS) and returns a BackupFS that
+// writes to the basePrefix directory and backs up files to the backupPrefix directory
+// of that sandbox.
+// root is the sandbox root directory which contains both, the base and the backup directory.
+func NewBackupFS(t testing.TB, basePrefix, backupPrefix string, opts ...backupfs.BackupFSOption) (root, base, backup backupfs.FS, backupFS *backupfs.BackupFS) {
+	t.Helper()
+
+	root = NewTempDirPrefixFS(t)
+
+	err := root.MkdirAll(basePrefix, 0700)
+	if err != nil {
+		t.Fatalf("failed to create base directory: %s: %v", basePrefix, err)
+	}
+	base = backupfs.NewPrefixFS(root, basePrefix)
+
+	err = root.MkdirAll(backupPrefix, 0700)
+	if err != nil {
+		t.Fatalf("failed to create backup directory: %s: %v", backupPrefix, err)
+	}
+	backup = backupfs.NewPrefixFS(root, backupPrefix)
+
+	backupFS = backupfs.NewBackupFS(base, backup, opts...)
+	return root, base, backup, backupFS
+}
+
+// dirPrefix returns a file name friendly prefix that is derived from the test name.
+func dirPrefix(t testing.TB) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, t.Name())
+
+	const maxLen = 64
+	if len(name) > maxLen {
+		name = name[:maxLen]
+	}
+	return name + "-"
+}
+
+// RequireNoOpenHandles fails the test in case that the passed filesystem (e.g. a BackupFS created
+// with backupfs.WithHandleTracking or a backupfs.TrackingFS) reports file handles that have not been closed.
+// The stack traces of the leaked handles are part of the failure message in case that they were recorded.
+func RequireNoOpenHandles(t testing.TB, fsys backupfs.HandleTracker) {
+	t.Helper()
+
+	handles := fsys.OpenHandles()
+	if len(handles) == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	for _, h := range handles {
+		fmt.Fprintf(&sb, "\n[%d] %s (flag=%d, opened at %s)", h.ID, h.Name, h.Flag, h.OpenedAt.Format(time.RFC3339Nano))
+		if h.Stack != "" {
+			fmt.Fprintf(&sb, "\n%s", h.Stack)
+		}
+	}
+	t.Fatalf("found %d open file handle(s):%s", len(handles), sb.String())
+}
+
+// SkipWithoutChown skips the test in case that the passed filesystem does not support ownership changes,
+// see backupfs.CanChown, e.g. on windows, in rootless containers or in user namespaces with unmapped owners.
+func SkipWithoutChown(t testing.TB, fsys backupfs.FS) {
+	t.Helper()
+
+	if !backupfs.CanChown(fsys) {
+		t.Skip("filesystem does not support changing the ownership of files")
+	}
+}
@@ -0,0 +1,125 @@
+package testingfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jxsl13/backupfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTempDirPrefixFS(t *testing.T) {
+	t.Parallel()
+
+	var prefix string
+	t.Run("sandbox", func(t *testing.T) {
+		require := require.New(t)
+		prefix = dirPrefix(t)
+
+		fsys := NewTempDirPrefixFS(t)
+		f, err := fsys.Create("/test.txt")
+		require.NoError(err)
+		_, err = f.WriteString("content")
+		require.NoError(err)
+		require.NoError(f.Close())
+
+		fi, err := fsys.Lstat("/")
+		require.NoError(err)
+		require.True(fi.IsDir())
+	})
+
+	// the sandbox must have been removed after the subtest completed
+	entries, err := os.ReadDir(os.TempDir())
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.Falsef(t, strings.HasPrefix(e.Name(), prefix), "temp dir must be removed: %s", e.Name())
+	}
+}
+
+func TestNewBackupFS(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	root, base, backup, backupFS := NewBackupFS(t, "/base", "/backup")
+
+	f, err := base.Create("/test.txt")
+	require.NoError(err)
+	_, err = f.WriteString("original")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	f, err = backupFS.Create("/test.txt")
+	require.NoError(err)
+	_, err = f.WriteString("modified")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	f, err = root.Open("/backup/test.txt")
+	require.NoError(err)
+	b, err := io.ReadAll(f)
+	require.NoError(err)
+	require.NoError(f.Close())
+	require.Equal("original", string(b))
+
+	_, err = backup.Lstat("/test.txt")
+	require.NoError(err)
+
+	require.NoError(backupFS.Rollback())
+
+	f, err = base.Open("/test.txt")
+	require.NoError(err)
+	defer f.Close()
+	b, err = io.ReadAll(f)
+	require.NoError(err)
+	require.Equal("original", string(b))
+}
+
+func TestRequireNoOpenHandles(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, backup, _ := NewBackupFS(t, "/base", "/backup")
+	backupFS := backupfs.NewBackupFS(base, backup, backupfs.WithHandleTracking(true))
+
+	f, err := backupFS.Create("/test.txt")
+	require.NoError(err)
+
+	ft := &fakeTB{TB: t}
+	RequireNoOpenHandles(ft, backupFS)
+	require.True(ft.failed)
+	require.Contains(ft.msg, "/test.txt")
+
+	require.NoError(f.Close())
+	RequireNoOpenHandles(t, backupFS)
+}
+
+func TestSkipWithoutChown(t *testing.T) {
+	t.Parallel()
+
+	ft := &fakeTB{TB: t}
+	SkipWithoutChown(ft, backupfs.NewReadOnlyFS(backupfs.NewMemFS()))
+	require.True(t, ft.skipped)
+}
+
+// fakeTB records fatal failures instead of aborting the test.
+type fakeTB struct {
+	testing.TB
+	failed  bool
+	skipped bool
+	msg     string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Fatalf(format string, args ...any) {
+	tb.failed = true
+	tb.msg = fmt.Sprintf(format, args...)
+}
+
+func (tb *fakeTB) Skip(args ...any) {
+	tb.skipped = true
+	tb.msg = fmt.Sprint(args...)
+}
@@ -0,0 +1,52 @@
+package backupfs
+
+import (
+	"reflect"
+)
+
+// Unwrapper is implemented by filesystems that wrap another filesystem.
+type Unwrapper interface {
+	// Unwrap returns the wrapped filesystem.
+	Unwrap() FS
+}
+
+// Unwrap returns the result of calling the Unwrap method of fsys,
+// in case that fsys implements the Unwrapper interface. Otherwise Unwrap returns nil.
+func Unwrap(fsys FS) FS {
+	u, ok := fsys.(Unwrapper)
+	if !ok {
+		return nil
+	}
+	return u.Unwrap()
+}
+
+// As finds the first filesystem in the layer stack of fsys that matches target, and if one is found,
+// sets target to that filesystem and returns true. Otherwise, it returns false.
+// The stack is traversed from the top to the bottom by repeatedly calling Unwrap.
+//
+// target must be a non-nil pointer to either a type that implements FS, or to any interface type,
+// e.g. *(*BackupFS) or *HandleTracker.
+// As panics in case that target is not such a pointer.
+func As(fsys FS, target any) bool {
+	if target == nil {
+		panic("backupfs: target cannot be nil")
+	}
+	val := reflect.ValueOf(target)
+	typ := val.Type()
+	if typ.Kind() != reflect.Ptr || val.IsNil() {
+		panic("backupfs: target must be a non-nil pointer")
+	}
+	targetType := typ.Elem()
+	if targetType.Kind() != reflect.Interface && !targetType.Implements(reflect.TypeOf((*FS)(nil)).Elem()) {
+		panic("backupfs: *target must be interface or implement FS")
+	}
+
+	for fsys != nil {
+		if reflect.TypeOf(fsys).AssignableTo(targetType) {
+			val.Elem().Set(reflect.ValueOf(fsys))
+			return true
+		}
+		fsys = Unwrap(fsys)
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package backupfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require      = require.New(t)
+		basePrefix   = "/base"
+		backupPrefix = "/base/backup"
+	)
+	_, base, _, _ := NewTestBackupFS(basePrefix, backupPrefix)
+
+	s, err := Chain(base,
+		HiddenLayer("/backup"),
+		BackupLayer(NewPrefixFS(base, "/backup")),
+		TrackingLayer(false),
+	)
+	require.NoError(err)
+
+	var backupFS *BackupFS
+	require.True(As(s.Top, &backupFS))
+	require.Equal(s.Backup, backupFS)
+
+	var hiddenFS *HiddenFS
+	require.True(As(s.Top, &hiddenFS))
+	require.Equal(s.Hidden, hiddenFS)
+
+	// the topmost match is returned
+	var prefixFS *PrefixFS
+	require.True(As(s.Top, &prefixFS))
+	require.Equal(base, prefixFS)
+
+	var tracker HandleTracker
+	require.True(As(s.Top, &tracker))
+	require.Equal(s.Tracking, tracker)
+
+	var volumeFS *VolumeFS
+	require.True(As(s.Top, &volumeFS), "volume of the temp dir")
+	require.False(As(backupFS.BackupFS(), &hiddenFS))
+
+	require.Equal(s.Backup, Unwrap(s.Top))
+	require.Equal(s.Hidden, Unwrap(s.Backup))
+	require.Nil(Unwrap(NewOSFS()))
+
+	require.Panics(func() { As(s.Top, nil) })
+	require.Panics(func() { As(s.Top, backupFS) })
+	require.Panics(func() { As(s.Top, new(int)) })
+}
@@ -1,6 +1,7 @@
 package backupfs
 
 import (
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -11,7 +12,16 @@ import (
 
 // assert interfaces implemented
 var (
-	_ FS = (*VolumeFS)(nil)
+	_ FS             = (*VolumeFS)(nil)
+	_ Xattrer        = (*VolumeFS)(nil)
+	_ ACLer          = (*VolumeFS)(nil)
+	_ FileAttributer = (*VolumeFS)(nil)
+	_ DACLer         = (*VolumeFS)(nil)
+	_ OSPather       = (*VolumeFS)(nil)
+
+	// ErrPathEscapesVolume is returned in case that a path or a relative symlink target would refer to another volume
+	// than the one of a VolumeFS. It wraps syscall.EPERM for backwards compatibility.
+	ErrPathEscapesVolume = fmt.Errorf("path escapes volume: %w", syscall.EPERM)
 )
 
 // VolumeFS is specifically designed to prefix absolute paths with a defined volume like C:, D:, E: etc.
@@ -19,23 +29,46 @@ var (
 type VolumeFS struct {
 	volume string
 	base   FS
+	limits symlinkLimits
 }
 
 // the passed file path must not contain any os specific volume prefix.
 // primarily no windows volumes like c:, d:, etc.
 func (v *VolumeFS) prefixPath(name string) (string, error) {
-	name = filepath.Clean(name)
+	name = normalizePath(name)
 
 	if v.volume == "" {
+		err := v.limits.checkDepth(v.base, name, name, false)
+		if err != nil {
+			return "", err
+		}
 		return name, nil
 	}
 
 	volumePrefix := filepath.VolumeName(name)
 	if volumePrefix != "" {
-		return "", syscall.EPERM
+		return "", ErrPathEscapesVolume
 	}
 
-	return filepath.Clean(filepath.Join(v.volume, name)), nil
+	p := filepath.Clean(filepath.Join(v.volume, name))
+	err := v.limits.checkDepth(v.base, name, p, false)
+	if err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// targetPath is prefixPath for operations that follow a symlink at name.
+func (v *VolumeFS) targetPath(name string) (string, error) {
+	p, err := v.prefixPath(name)
+	if err != nil {
+		return "", err
+	}
+	err = v.limits.checkDepth(v.base, name, p, true)
+	if err != nil {
+		return "", err
+	}
+	return p, nil
 }
 
 func NewVolumeFS(volume string, fs FS) *VolumeFS {
@@ -45,10 +78,30 @@ func NewVolumeFS(volume string, fs FS) *VolumeFS {
 	}
 }
 
+// VolumeFSOption configures NewVolumeFSWithOptions.
+type VolumeFSOption func(*VolumeFS)
+
+// WithVolumeSymlinkLimits caps the length of symlink targets and the number of symlinks that are followed
+// in order to resolve a path, see WithPrefixSymlinkLimits.
+func WithVolumeSymlinkLimits(maxTargetLength, maxDepth int) VolumeFSOption {
+	return func(v *VolumeFS) {
+		v.limits = symlinkLimits{maxTargetLength: maxTargetLength, maxDepth: maxDepth}
+	}
+}
+
+// NewVolumeFSWithOptions creates a VolumeFS like NewVolumeFS and applies the passed options.
+func NewVolumeFSWithOptions(volume string, fs FS, opts ...VolumeFSOption) *VolumeFS {
+	v := NewVolumeFS(volume, fs)
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
 // Create creates a file in the filesystem, returning the file and an
 // error, if any happens.
 func (v *VolumeFS) Create(name string) (File, error) {
-	path, err := v.prefixPath(name)
+	path, err := v.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "create", Path: name, Err: err}
 	}
@@ -94,7 +147,7 @@ func (v *VolumeFS) MkdirAll(name string, perm fs.FileMode) error {
 // Open opens a file, returning it or an error, if any happens.
 // This returns a ready only file
 func (v *VolumeFS) Open(name string) (File, error) {
-	path, err := v.prefixPath(name)
+	path, err := v.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
@@ -109,7 +162,7 @@ func (v *VolumeFS) Open(name string) (File, error) {
 
 // OpenFile opens a file using the given flags and the given mode.
 func (v *VolumeFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
-	path, err := v.prefixPath(name)
+	path, err := v.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "open_file", Path: name, Err: err}
 	}
@@ -173,17 +226,14 @@ func (v *VolumeFS) Rename(oldname, newname string) error {
 // Stat returns a FileInfo describing the named file, or an error, if any
 // happens.
 func (v *VolumeFS) Stat(name string) (fs.FileInfo, error) {
-	path, err := v.prefixPath(name)
+	_, err := v.targetPath(name)
 	if err != nil {
 		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
 	}
 
-	fi, err := v.base.Stat(path)
-	if err != nil {
-		return nil, err
-	}
-
-	return newPrefixFileInfo(fi, path, v.volume), nil
+	// symlinks must not be resolved by the base filesystem,
+	// as symlink targets must not leave the volume.
+	return statResolved(v, name)
 }
 
 // The name of this FileSystem
@@ -191,9 +241,14 @@ func (v *VolumeFS) Name() string {
 	return "VolumeFS"
 }
 
+// Unwrap returns the filesystem that the volume is applied to.
+func (v *VolumeFS) Unwrap() FS {
+	return v.base
+}
+
 // Chmod changes the mode of the named file to mode.
 func (v *VolumeFS) Chmod(name string, mode fs.FileMode) error {
-	path, err := v.prefixPath(name)
+	path, err := v.targetPath(name)
 	if err != nil {
 		return &fs.PathError{Op: "chmod", Path: name, Err: err}
 	}
@@ -207,7 +262,7 @@ func (v *VolumeFS) Chmod(name string, mode fs.FileMode) error {
 
 // Chown changes the uid and gid of the named file.
 func (v *VolumeFS) Chown(name string, uid, gid int) error {
-	path, err := v.prefixPath(name)
+	path, err := v.targetPath(name)
 	if err != nil {
 		return &fs.PathError{Op: "chown", Path: name, Err: err}
 	}
@@ -221,7 +276,7 @@ func (v *VolumeFS) Chown(name string, uid, gid int) error {
 
 // Chtimes changes the access and modification times of the named file
 func (v *VolumeFS) Chtimes(name string, atime, mtime time.Time) error {
-	path, err := v.prefixPath(name)
+	path, err := v.targetPath(name)
 	if err != nil {
 		return &fs.PathError{Op: "chtimes", Path: name, Err: err}
 	}
@@ -232,6 +287,31 @@ func (v *VolumeFS) Chtimes(name string, atime, mtime time.Time) error {
 	return nil
 }
 
+// Truncate changes the size of the named file.
+func (v *VolumeFS) Truncate(name string, size int64) error {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "truncate", Path: name, Err: err}
+	}
+
+	err = v.base.Truncate(path, size)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadDir reads the named directory and returns all its directory entries sorted by filename.
+func (v *VolumeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	_, err := v.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	// the prefixed file removes the volume from the returned file infos
+	return readDir(v, name)
+}
+
 // Lstat will call Lstat if the filesystem itself is, or it delegates to, the os filesystem.
 // Else it will call Stat.
 // In addtion to the FileInfo, it will return a boolean telling whether Lstat was called or not.
@@ -251,19 +331,35 @@ func (v *VolumeFS) Lstat(name string) (fs.FileInfo, error) {
 
 // Symlink changes the access and modification times of the named file
 func (v *VolumeFS) Symlink(oldname, newname string) error {
-	// links may be relative paths
+	return v.symlink(oldname, newname, LinkAuto)
+}
+
+// SymlinkWithType creates a symlink of the given type, see TypedSymlinker.
+func (v *VolumeFS) SymlinkWithType(oldname, newname string, typ LinkType) error {
+	return v.symlink(oldname, newname, typ)
+}
 
-	var (
-		err     error
-		oldPath string
-	)
+func (v *VolumeFS) symlink(oldname, newname string, typ LinkType) error {
+	err := v.limits.checkTarget(newname, oldname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+
+	// links may be relative paths
+	var oldPath string
 	if isAbs(oldname) {
 		// absolute path symlink
 		oldPath, err = v.prefixPath(oldname)
 	} else {
-		// relative path symlink
-		// TODO: oldname could escape the volume prefix using relative paths
+		// relative path symlink, which is resolved relative to the directory of newname.
+		// Directory traversal stops at the root of the volume, but a volume name like D:file on Windows
+		// would make the target relative to the current directory of another volume.
 		oldPath = oldname
+		if filepath.VolumeName(oldname) != "" {
+			err = ErrPathEscapesVolume
+		} else {
+			_, err = v.prefixPath(filepath.Join(filepath.Dir(normalizePath(newname)), oldname))
+		}
 	}
 
 	if err != nil {
@@ -275,7 +371,7 @@ func (v *VolumeFS) Symlink(oldname, newname string) error {
 		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
 	}
 
-	err = v.base.Symlink(oldPath, newPath)
+	err = symlinkWithType(v.base, oldPath, newPath, typ)
 	if err != nil {
 		return err
 	}
@@ -294,7 +390,12 @@ func (v *VolumeFS) Readlink(name string) (string, error) {
 	}
 
 	cleanedPath := filepath.Clean(linkedPath)
-	return strings.TrimPrefix(cleanedPath, v.volume), nil
+	target := strings.TrimPrefix(cleanedPath, v.volume)
+	err = v.limits.checkTarget(name, target)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
 }
 
 func (v *VolumeFS) Lchown(name string, uid, gid int) error {
@@ -315,3 +416,93 @@ func TrimVolume(filePath string) string {
 	volume := filepath.VolumeName(filePath)
 	return filePath[len(volume):]
 }
+
+// ListXattr returns the names of the extended attributes of the named file, see Xattrer.
+func (v *VolumeFS) ListXattr(name string) ([]string, error) {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	return ListXattr(v.base, path)
+}
+
+// GetXattr returns the value of the extended attribute of the named file.
+func (v *VolumeFS) GetXattr(name, attr string) ([]byte, error) {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	return GetXattr(v.base, path, attr)
+}
+
+// SetXattr sets the value of the extended attribute of the named file.
+func (v *VolumeFS) SetXattr(name, attr string, value []byte) error {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return SetXattr(v.base, path, attr, value)
+}
+
+// GetACL returns the POSIX ACL of the named file, see ACLer.
+func (v *VolumeFS) GetACL(name string, typ ACLType) (ACL, error) {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "getacl", Path: name, Err: err}
+	}
+	return GetACL(v.base, path, typ)
+}
+
+// SetACL sets the POSIX ACL of the named file, a nil ACL removes it.
+func (v *VolumeFS) SetACL(name string, typ ACLType, acl ACL) error {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setacl", Path: name, Err: err}
+	}
+	return SetACL(v.base, path, typ, acl)
+}
+
+// GetFileAttributes returns the Windows file attributes of the named file, see FileAttributer.
+func (v *VolumeFS) GetFileAttributes(name string) (FileAttributes, error) {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return 0, &fs.PathError{Op: "getfileattributes", Path: name, Err: err}
+	}
+	return GetFileAttributes(v.base, path)
+}
+
+// SetFileAttributes sets the Windows file attributes of the named file.
+func (v *VolumeFS) SetFileAttributes(name string, attrs FileAttributes) error {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setfileattributes", Path: name, Err: err}
+	}
+	return SetFileAttributes(v.base, path, attrs)
+}
+
+// GetDACL returns the DACL of the named file, see DACLer.
+func (v *VolumeFS) GetDACL(name string) (string, error) {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "getdacl", Path: name, Err: err}
+	}
+	return GetDACL(v.base, path)
+}
+
+// SetDACL sets the DACL of the named file.
+func (v *VolumeFS) SetDACL(name string, sddl string) error {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return &fs.PathError{Op: "setdacl", Path: name, Err: err}
+	}
+	return SetDACL(v.base, path, sddl)
+}
+
+// OSPath returns the path of the named file in the filesystem of the operating system, see OSPather.
+func (v *VolumeFS) OSPath(name string) (string, error) {
+	path, err := v.targetPath(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "ospath", Path: name, Err: err}
+	}
+	return OSPath(v.base, path)
+}
@@ -0,0 +1,43 @@
+package backupfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumeFS_RelativeSymlinkEscape(t *testing.T) {
+	t.Parallel()
+
+	var (
+		require = require.New(t)
+		base    = NewMemFS()
+		fsys    = NewVolumeFS("C:", base)
+	)
+	mkdirAll(t, fsys, "/a/b/c", 0755)
+	createFile(t, fsys, "/outside.txt", "content")
+
+	// directory traversal stops at the root of the volume
+	for _, oldname := range []string{"../../../outside.txt", "../../../../../../outside.txt"} {
+		newname := filepath.FromSlash("/a/b/c/link")
+		require.NoError(fsys.Symlink(filepath.FromSlash(oldname), newname), oldname)
+
+		target, err := fsys.Readlink(newname)
+		require.NoError(err)
+		require.Equal(filepath.FromSlash(oldname), target)
+
+		resolved, fi, err := EvalSymlinks(fsys, newname)
+		require.NoError(err)
+		require.Equal(filepath.FromSlash("/outside.txt"), resolved)
+		require.NotNil(fi)
+		require.NoError(fsys.Remove(newname))
+	}
+
+	// a volume name makes a relative target refer to another volume
+	if filepath.VolumeName("D:outside.txt") != "" {
+		err := fsys.Symlink("D:outside.txt", filepath.FromSlash("/a/link"))
+		require.ErrorIs(err, ErrPathEscapesVolume)
+		mustNotExist(t, fsys, "/a/link")
+	}
+}
@@ -0,0 +1,21 @@
+// Package vss provides a backupfs.SnapshotProvider that is based on the Windows Volume Shadow Copy Service.
+// It allows to back up files that are locked by other processes and cannot be opened directly.
+//
+// The implementation is only available on Windows when built with the vss build tag:
+//
+//	go build -tags vss ./...
+//
+// On any other platform or without the build tag, New returns ErrUnsupported.
+// Creating shadow copies requires administrative privileges.
+package vss
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnsupported is returned in case that the Volume Shadow Copy Service is not supported
+	// by the current platform or build.
+	ErrUnsupported = fmt.Errorf("volume shadow copy service: %w", errors.ErrUnsupported)
+)
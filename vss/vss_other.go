@@ -0,0 +1,33 @@
+//go:build !windows || !vss
+// +build !windows !vss
+
+package vss
+
+import (
+	"github.com/jxsl13/backupfs"
+)
+
+var _ backupfs.SnapshotProvider = (*Provider)(nil)
+
+// Supported returns true in case that the current build supports the Volume Shadow Copy Service.
+func Supported() bool {
+	return false
+}
+
+// New returns ErrUnsupported on this platform or build.
+func New(volume string) (*Provider, error) {
+	return nil, ErrUnsupported
+}
+
+// Provider is not supported on this platform or build.
+type Provider struct{}
+
+// OpenSnapshot returns ErrUnsupported.
+func (p *Provider) OpenSnapshot(name string) (backupfs.File, error) {
+	return nil, ErrUnsupported
+}
+
+// Close is a no-op.
+func (p *Provider) Close() error {
+	return nil
+}
@@ -0,0 +1,132 @@
+//go:build windows && vss
+// +build windows,vss
+
+package vss
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jxsl13/backupfs"
+)
+
+var _ backupfs.SnapshotProvider = (*Provider)(nil)
+
+// Supported returns true in case that the current build supports the Volume Shadow Copy Service.
+func Supported() bool {
+	return true
+}
+
+// New creates a snapshot provider for the passed volume, e.g. C:.
+// The shadow copy is lazily created when the first file cannot be opened directly
+// and reused for all further files. Close must be called in order to delete the shadow copy.
+func New(volume string) (*Provider, error) {
+	volume = filepath.VolumeName(volume)
+	if volume == "" {
+		return nil, fmt.Errorf("invalid volume: %q", volume)
+	}
+	return &Provider{
+		volume: volume,
+	}, nil
+}
+
+// Provider is a backupfs.SnapshotProvider that opens files from a shadow copy of a volume.
+type Provider struct {
+	mu     sync.Mutex
+	volume string
+
+	// empty as long as no shadow copy has been created
+	id     string
+	device string
+}
+
+// OpenSnapshot opens the shadow copy of the passed file.
+// The file path may or may not contain the volume of the provider.
+func (p *Provider) OpenSnapshot(name string) (backupfs.File, error) {
+	device, err := p.shadowDevice()
+	if err != nil {
+		return nil, &os.PathError{Op: "open_snapshot", Path: name, Err: err}
+	}
+
+	volume := filepath.VolumeName(name)
+	if volume != "" && !strings.EqualFold(volume, p.volume) {
+		return nil, &os.PathError{Op: "open_snapshot", Path: name, Err: fmt.Errorf("file is not located on volume %s", p.volume)}
+	}
+
+	f, err := os.Open(device + backupfs.TrimVolume(filepath.Clean(name)))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close deletes the shadow copy in case that one was created.
+func (p *Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.id == "" {
+		return nil
+	}
+
+	script := fmt.Sprintf(
+		"Get-CimInstance -ClassName Win32_ShadowCopy | Where-Object { $_.ID -eq '%s' } | Remove-CimInstance",
+		p.id,
+	)
+	_, err := powershell(script)
+	if err != nil {
+		return fmt.Errorf("failed to delete shadow copy %s: %w", p.id, err)
+	}
+	p.id = ""
+	p.device = ""
+	return nil
+}
+
+func (p *Provider) shadowDevice() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.device != "" {
+		return p.device, nil
+	}
+
+	script := fmt.Sprintf(strings.Join([]string{
+		"$r = Invoke-CimMethod -ClassName Win32_ShadowCopy -MethodName Create -Arguments @{Volume='%s\\'; Context='ClientAccessible'}",
+		"if ($r.ReturnValue -ne 0) { exit $r.ReturnValue }",
+		"$s = Get-CimInstance -ClassName Win32_ShadowCopy | Where-Object { $_.ID -eq $r.ShadowID }",
+		"Write-Output $s.ID",
+		"Write-Output $s.DeviceObject",
+	}, "; "), p.volume)
+
+	out, err := powershell(script)
+	if err != nil {
+		return "", fmt.Errorf("failed to create shadow copy of %s: %w", p.volume, err)
+	}
+
+	lines := strings.Fields(out)
+	if len(lines) != 2 {
+		return "", fmt.Errorf("failed to create shadow copy of %s: unexpected output: %q", p.volume, out)
+	}
+
+	p.id = lines[0]
+	p.device = lines[1]
+	return p.device, nil
+}
+
+func powershell(script string) (string, error) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -1,11 +1,59 @@
 package backupfs
 
 import (
+	"context"
+	"errors"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"sort"
 )
 
+var (
+	// ErrWalkCycle is passed to the walk function in case that a directory is encountered
+	// that is also one of its own parent directories, e.g. due to a bind mount or
+	// due to a base filesystem that resolves directory symlinks.
+	// Returning nil from the walk function skips the offending directory.
+	ErrWalkCycle = errors.New("walk cycle detected")
+)
+
+// walker is implemented by filesystems that provide their own, more efficient Walk implementation.
+type walker interface {
+	Walk(root string, walkFn filepath.WalkFunc) error
+}
+
+// skipFunc returns true in case that a path must neither be visited nor traversed.
+type skipFunc func(path string) (bool, error)
+
+// dirKey uniquely identifies a directory.
+// device and inode are used where available, the resolved path otherwise.
+type dirKey struct {
+	dev  uint64
+	ino  uint64
+	path string
+}
+
+type walkState struct {
+	skip skipFunc
+	// directories of the currently walked branch
+	ancestors map[dirKey]struct{}
+}
+
+func (w *walkState) dirKey(fsys FS, path string, info fs.FileInfo) (dirKey, error) {
+	dev, ino, ok := toDevIno(info)
+	if ok {
+		return dirKey{dev: dev, ino: ino}, nil
+	}
+
+	// the last path element is a directory and not a symlink,
+	// resolving the parent directories results in a unique path.
+	resolved, err := resolvePath(fsys, path)
+	if err != nil {
+		return dirKey{}, err
+	}
+	return dirKey{path: resolved}, nil
+}
+
 func readDirNames(fs FS, dirname string) ([]string, error) {
 	f, err := fs.Open(dirname)
 	if err != nil {
@@ -20,7 +68,40 @@ func readDirNames(fs FS, dirname string) ([]string, error) {
 	return names, nil
 }
 
-func walk(fs FS, path string, info fs.FileInfo, walkFn filepath.WalkFunc) error {
+// readDir reads the directory entries of a layer whose File implementation
+// already takes care of the layer specific details, e.g. filtering hidden entries.
+func readDir(fsys FS, dirname string) ([]fs.DirEntry, error) {
+	infos, err := readDirInfos(fsys, dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, fi := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	return entries, nil
+}
+
+// readDirInfos reads the file infos of the directory entries sorted by filename, see readDir.
+func readDirInfos(fsys FS, dirname string) ([]fs.FileInfo, error) {
+	f, err := fsys.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.Readdir(-1)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+func walk(fs FS, path string, info fs.FileInfo, walkFn filepath.WalkFunc, state *walkState) error {
 	err := walkFn(path, info, nil)
 	if err != nil {
 		if info.IsDir() && err == filepath.SkipDir {
@@ -33,6 +114,20 @@ func walk(fs FS, path string, info fs.FileInfo, walkFn filepath.WalkFunc) error
 		return nil
 	}
 
+	key, err := state.dirKey(fs, path, info)
+	if err != nil {
+		return walkFn(path, info, err)
+	}
+	if _, found := state.ancestors[key]; found {
+		err = walkFn(path, info, &os.PathError{Op: "walk", Path: path, Err: ErrWalkCycle})
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	state.ancestors[key] = struct{}{}
+	defer delete(state.ancestors, key)
+
 	names, err := readDirNames(fs, path)
 	if err != nil {
 		return walkFn(path, info, err)
@@ -41,13 +136,24 @@ func walk(fs FS, path string, info fs.FileInfo, walkFn filepath.WalkFunc) error
 	for _, name := range names {
 		filename := filepath.Join(path, name)
 
+		if state.skip != nil {
+			// prune the whole subtree before calling Lstat on it
+			skipped, err := state.skip(filename)
+			if err != nil {
+				return walkFn(filename, nil, err)
+			}
+			if skipped {
+				continue
+			}
+		}
+
 		fileInfo, err := fs.Lstat(filename)
 		if err != nil {
 			if err := walkFn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
 				return err
 			}
 		} else {
-			err = walk(fs, filename, fileInfo, walkFn)
+			err = walk(fs, filename, fileInfo, walkFn, state)
 			if err != nil {
 				if !fileInfo.IsDir() || err != filepath.SkipDir {
 					return err
@@ -60,10 +166,50 @@ func walk(fs FS, path string, info fs.FileInfo, walkFn filepath.WalkFunc) error
 
 // Walk walks the file tree rooted at root, calling walkFn for each file
 // or directory in the tree, including root. All errors that arise visiting
+// files and directories are filtered by walkFn.
+// In case that fsys provides its own Walk method (e.g. HiddenFS), that method is used instead.
+// Directories that are their own parent directories are reported with ErrWalkCycle.
 func Walk(fsys FS, root string, walkFn filepath.WalkFunc) error {
+	if w, ok := fsys.(walker); ok {
+		return w.Walk(root, walkFn)
+	}
+	return walkWithSkip(fsys, root, walkFn, nil)
+}
+
+// WalkContext walks the file tree like Walk and stops as soon as the context is canceled.
+// The context is checked before every visited file or directory, the context error is returned
+// in case that the walk has been canceled.
+func WalkContext(ctx context.Context, fsys FS, root string, walkFn filepath.WalkFunc) error {
+	return Walk(fsys, root, func(path string, info fs.FileInfo, err error) error {
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+		return walkFn(path, info, err)
+	})
+}
+
+// WalkAuto walks the file tree like Walk, but accepts a root with a volume prefix like C:\ on Windows.
+// The volume is handled with a VolumeFS, the same way as the temporary directories of NewTempDirPrefixFS,
+// and is prepended to all paths that are passed to walkFn again.
+// On unix systems there are no volume prefixes and WalkAuto behaves exactly like Walk.
+func WalkAuto(fsys FS, root string, walkFn filepath.WalkFunc) error {
+	volume := filepath.VolumeName(root)
+	if volume == "" {
+		return Walk(fsys, root, walkFn)
+	}
+	return Walk(NewVolumeFS(volume, fsys), TrimVolume(root), func(path string, info fs.FileInfo, err error) error {
+		return walkFn(volume+path, info, err)
+	})
+}
+
+func walkWithSkip(fsys FS, root string, walkFn filepath.WalkFunc, skip skipFunc) error {
 	info, err := fsys.Lstat(root)
 	if err != nil {
 		return walkFn(root, nil, err)
 	}
-	return walk(fsys, root, info, walkFn)
+	state := &walkState{
+		skip:      skip,
+		ancestors: make(map[dirKey]struct{}),
+	}
+	return walk(fsys, root, info, walkFn, state)
 }
@@ -0,0 +1,112 @@
+package backupfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// followingFS resolves symlinks in Lstat, like some network filesystems do.
+type followingFS struct {
+	FS
+}
+
+func (fsys *followingFS) Lstat(name string) (fs.FileInfo, error) {
+	return fsys.FS.Stat(name)
+}
+
+func TestWalkCycle(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, _ := NewTestBackupFS("/base", "/backup")
+
+	mkdirAll(t, base, "/a/b", 0755)
+	createFile(t, base, "/a/b/test.txt", "test_content")
+	createSymlink(t, base, "/a", "/a/b/loop")
+
+	var (
+		fsys    = &followingFS{FS: base}
+		cycles  = make([]string, 0, 1)
+		visited = 0
+	)
+	err := Walk(fsys, "/a", func(path string, info fs.FileInfo, err error) error {
+		if errors.Is(err, ErrWalkCycle) {
+			cycles = append(cycles, path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		visited++
+		return nil
+	})
+	require.NoError(err)
+	require.Equal([]string{filepath.FromSlash("/a/b/loop")}, cycles)
+	// /a, /a/b, /a/b/loop, /a/b/test.txt
+	require.Equal(4, visited)
+
+	// returning the error aborts the walk
+	err = Walk(fsys, "/a", func(path string, info fs.FileInfo, err error) error {
+		return err
+	})
+	require.ErrorIs(err, ErrWalkCycle)
+}
+
+func TestWalkContext(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	_, base, _, _ := NewTestBackupFS("/base", "/backup")
+
+	mkdirAll(t, base, "/a/b", 0755)
+	createFile(t, base, "/a/b/test.txt", "test_content")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	visited := 0
+	err := WalkContext(ctx, base, "/a", func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		visited++
+		if visited == 2 {
+			cancel()
+		}
+		return nil
+	})
+	require.ErrorIs(err, context.Canceled)
+	require.Equal(2, visited)
+}
+
+func TestWalkAuto(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+	// absolute paths of the OS contain a volume prefix on windows
+	root := t.TempDir()
+	osFS := NewOSFS()
+
+	mkdirAll(t, osFS, filepath.Join(root, "a", "b"), 0755)
+	createFile(t, osFS, filepath.Join(root, "a", "b", "test.txt"), "test_content")
+
+	expected := make([]string, 0, 4)
+	err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		expected = append(expected, path)
+		return err
+	})
+	require.NoError(err)
+
+	visited := make([]string, 0, 4)
+	err = WalkAuto(osFS, root, func(path string, info fs.FileInfo, err error) error {
+		visited = append(visited, path)
+		return err
+	})
+	require.NoError(err)
+	require.Equal(expected, visited)
+}
@@ -0,0 +1,98 @@
+package backupfs
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// asXattrer returns the extended attribute methods of fsys or an error that wraps errors.ErrUnsupported.
+func asXattrer(op string, fsys FS, name string) (Xattrer, error) {
+	x, ok := fsys.(Xattrer)
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errors.ErrUnsupported}
+	}
+	return x, nil
+}
+
+// ListXattr returns the names of the extended attributes of the named file, see Xattrer.
+func ListXattr(fsys FS, name string) ([]string, error) {
+	x, err := asXattrer("listxattr", fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return x.ListXattr(name)
+}
+
+// GetXattr returns the value of the extended attribute of the named file, see Xattrer.
+func GetXattr(fsys FS, name, attr string) ([]byte, error) {
+	x, err := asXattrer("getxattr", fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return x.GetXattr(name, attr)
+}
+
+// SetXattr sets the value of the extended attribute of the named file, see Xattrer.
+func SetXattr(fsys FS, name, attr string, value []byte) error {
+	x, err := asXattrer("setxattr", fsys, name)
+	if err != nil {
+		return err
+	}
+	return x.SetXattr(name, attr, value)
+}
+
+// copyXattrs copies the extended attributes of name from source to target.
+// Attributes that only exist in target are kept. Filesystems without extended attributes as well as
+// attributes that may not be set, e.g. security.* attributes without the required privileges, are skipped.
+func copyXattrs(source, target FS, name string) error {
+	attrs, err := ListXattr(source, name)
+	if err != nil {
+		return ignoreXattrError(err)
+	}
+
+	for _, attr := range attrs {
+		value, err := GetXattr(source, name, attr)
+		if err == nil {
+			err = SetXattr(target, name, attr, value)
+		}
+		err = ignoreXattrError(err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDirWithXattrs copies the directory like copyDir and additionally its extended attributes from source.
+func copyDirWithXattrs(source, target FS, name string, info fs.FileInfo, opts *backupFSOptions) error {
+	err := copyDir(target, name, info, opts)
+	if err != nil {
+		return err
+	}
+	return copyExtendedAttrs(source, target, name, info)
+}
+
+// copyExtendedAttrs copies the extended attributes, the POSIX ACLs as well as the Windows DACL and file attributes
+// of name from source to target.
+func copyExtendedAttrs(source, target FS, name string, info fs.FileInfo) error {
+	err := copyXattrs(source, target, name)
+	if err != nil {
+		return err
+	}
+	err = copyACLs(source, target, name, info)
+	if err != nil {
+		return err
+	}
+	return copyFileAttributes(source, target, name)
+}
+
+// ignoreXattrError ignores unsupported extended attributes and missing privileges.
+func ignoreXattrError(err error) error {
+	err = ignorableXattrError(err)
+	switch {
+	case errors.Is(err, errors.ErrUnsupported), errors.Is(err, fs.ErrPermission):
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package backupfs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// errNoXattr is returned in case that the requested extended attribute does not exist.
+var errNoXattr error = syscall.ENODATA
+
+func osListXattr(name string) ([]string, error) {
+	buf, err := xattrBuffer(func(dest []byte) (int, error) {
+		return syscall.Listxattr(name, dest)
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+
+	attrs := make([]string, 0, bytes.Count(buf, []byte{0}))
+	for _, attr := range bytes.Split(buf, []byte{0}) {
+		if len(attr) > 0 {
+			attrs = append(attrs, string(attr))
+		}
+	}
+	return attrs, nil
+}
+
+func osGetXattr(name, attr string) ([]byte, error) {
+	value, err := xattrBuffer(func(dest []byte) (int, error) {
+		return syscall.Getxattr(name, attr, dest)
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	return value, nil
+}
+
+func osSetXattr(name, attr string, value []byte) error {
+	err := syscall.Setxattr(name, attr, value, 0)
+	if err != nil {
+		return &fs.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return nil
+}
+
+func osRemoveXattr(name, attr string) error {
+	err := syscall.Removexattr(name, attr)
+	if err != nil {
+		return &fs.PathError{Op: "removexattr", Path: name, Err: err}
+	}
+	return nil
+}
+
+// xattrBuffer calls f with a buffer that is large enough for the result.
+// The size is queried with an empty buffer first, which may change concurrently.
+func xattrBuffer(f func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := f(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := f(buf)
+		if errors.Is(err, syscall.ERANGE) {
+			// grown in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+func ignorableXattrError(err error) error {
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, errNoXattr) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package backupfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// errNoXattr is returned in case that the requested extended attribute does not exist.
+// ENODATA does not exist on all platforms, e.g. freebsd or wasip1, and platforms that define ENOATTR instead
+// do not implement extended attributes in this package.
+var errNoXattr = fmt.Errorf("no such extended attribute: %w", fs.ErrNotExist)
+
+func osListXattr(name string) ([]string, error) {
+	return nil, &fs.PathError{Op: "listxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func osGetXattr(name, _ string) ([]byte, error) {
+	return nil, &fs.PathError{Op: "getxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func osSetXattr(name, _ string, _ []byte) error {
+	return &fs.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func osRemoveXattr(name, _ string) error {
+	return &fs.PathError{Op: "removexattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func ignorableXattrError(err error) error {
+	if errors.Is(err, errNoXattr) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package backupfs
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS_Xattrs(t *testing.T) {
+	t.Parallel()
+
+	t.Run("memfs", func(t *testing.T) {
+		t.Parallel()
+		testBackupFSXattrs(t, NewMemFS(), NewMemFS())
+	})
+
+	t.Run("osfs", func(t *testing.T) {
+		t.Parallel()
+
+		_, base, backup, _ := NewTestBackupFS("/base", "/backup")
+		err := SetXattr(base, "/", "user.backupfs", []byte("probe"))
+		if errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+			t.Skipf("extended attributes are not supported: %v", err)
+		}
+		require.NoError(t, err)
+		testBackupFSXattrs(t, base, backup)
+	})
+}
+
+func testBackupFSXattrs(t *testing.T, base, backup FS) {
+	var (
+		require  = require.New(t)
+		dirPath  = filepath.FromSlash("/test/dir")
+		filePath = filepath.FromSlash("/test/dir/file.txt")
+		backupFS = NewBackupFS(base, backup)
+	)
+
+	createFile(t, base, filePath, "original")
+	require.NoError(SetXattr(base, dirPath, "user.label", []byte("dir")))
+	require.NoError(SetXattr(base, filePath, "user.label", []byte("file")))
+
+	createFile(t, backupFS, filePath, "modified")
+	require.NoError(backupFS.Chmod(dirPath, 0700))
+	require.NoError(SetXattr(base, dirPath, "user.label", []byte("modified")))
+	require.NoError(SetXattr(base, filePath, "user.label", []byte("modified")))
+
+	require.NoError(backupFS.Rollback())
+
+	fileMustContainText(t, base, filePath, "original")
+	value, err := GetXattr(base, dirPath, "user.label")
+	require.NoError(err)
+	require.Equal("dir", string(value))
+	value, err = GetXattr(base, filePath, "user.label")
+	require.NoError(err)
+	require.Equal("file", string(value))
+}